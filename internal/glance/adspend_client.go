@@ -0,0 +1,149 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// adSpendClient wraps the requests to an ad platform with their own circuit
+// breaker, rate limiter and retries, apart from the Stripe clients
+type adSpendClient struct {
+	circuitBreaker *CircuitBreaker
+	rateLimiter    *RateLimiter
+	maxRetries     int
+	retryBackoff   time.Duration
+}
+
+var adSpendClients sync.Map // map[string]*adSpendClient
+
+// adSpendClientFor returns the client of an ad account, shared by the widgets
+// reading it
+func adSpendClientFor(name string) *adSpendClient {
+	if cached, ok := adSpendClients.Load(name); ok {
+		return cached.(*adSpendClient)
+	}
+
+	client, _ := adSpendClients.LoadOrStore(name, &adSpendClient{
+		circuitBreaker: &CircuitBreaker{
+			maxFailures:  3,
+			resetTimeout: 10 * time.Minute,
+			state:        CircuitClosed,
+		},
+		rateLimiter: &RateLimiter{
+			tokens:     5.0,
+			maxTokens:  5.0,
+			refillRate: 1.0, // 1 request per second
+			lastRefill: time.Now(),
+		},
+		maxRetries:   2,
+		retryBackoff: 2 * time.Second,
+	})
+
+	return client.(*adSpendClient)
+}
+
+// adSpendAPIError is an unexpected response status from an ad platform
+type adSpendAPIError struct {
+	StatusCode int
+	URL        string
+	Body       string
+}
+
+func (e *adSpendAPIError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s, response: %s", e.StatusCode, e.URL, e.Body)
+}
+
+// isRetryableAdSpendError reports whether a failed request may succeed when
+// retried: rate limiting, server errors and network errors
+func isRetryableAdSpendError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *adSpendAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// execute runs fn with the circuit breaker, rate limiter and retries with
+// exponential backoff
+func (c *adSpendClient) execute(ctx context.Context, operation string, fn func() error) error {
+	if !c.circuitBreaker.CanExecute() {
+		return fmt.Errorf("circuit breaker open for %s: too many failures", operation)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := c.retryBackoff << (attempt - 1)
+			slog.Info("Retrying ad spend request", "operation", operation, "attempt", attempt, "backoff", backoff)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		if err := c.rateLimiter.Wait(ctx); err != nil {
+			return fmt.Errorf("rate limit exceeded: %w", err)
+		}
+
+		err := fn()
+		if err == nil {
+			c.circuitBreaker.RecordSuccess()
+			return nil
+		}
+
+		lastErr = err
+		c.circuitBreaker.RecordFailure()
+
+		if !isRetryableAdSpendError(err) {
+			return fmt.Errorf("non-retryable error in %s: %w", operation, err)
+		}
+
+		slog.Warn("Ad spend request failed", "operation", operation, "attempt", attempt, "error", err)
+	}
+
+	return fmt.Errorf("%s failed after %d retries: %w", operation, c.maxRetries, lastErr)
+}
+
+// decodeAdSpendResponse sends request and decodes its JSON response,
+// returning an adSpendAPIError for any status but 200
+func decodeAdSpendResponse[T any](request *http.Request) (T, error) {
+	var result T
+
+	response, err := defaultHTTPClient.Do(request)
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return result, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		truncatedBody, _ := limitStringLength(string(body), 256)
+		return result, &adSpendAPIError{StatusCode: response.StatusCode, URL: request.URL.Redacted(), Body: truncatedBody}
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
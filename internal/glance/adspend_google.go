@@ -0,0 +1,191 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	googleOAuthTokenURL = "https://oauth2.googleapis.com/token"
+	googleAdsAPIURL     = "https://googleads.googleapis.com/v18"
+)
+
+var googleAdsCustomerIDPattern = regexp.MustCompile(`^\d{10}$`)
+
+// googleAdsConfig is the google-ads block of the ad-spend option. Requests
+// are authorized with an OAuth refresh token of a user with access to the
+// account, and a developer token of the Google Ads API.
+type googleAdsConfig struct {
+	CustomerID string `yaml:"customer-id"`
+	// Manager account the customer is accessed through, if any
+	LoginCustomerID string `yaml:"login-customer-id"`
+	DeveloperToken  string `yaml:"developer-token"`
+	ClientID        string `yaml:"client-id"`
+	ClientSecret    string `yaml:"client-secret"`
+	RefreshToken    string `yaml:"refresh-token"`
+}
+
+type googleAdsProvider struct {
+	config   googleAdsConfig
+	tokenURL string
+	apiURL   string
+}
+
+// normalizeGoogleAdsCustomerID removes the dashes of a customer ID like
+// 123-456-7890 and validates it
+func normalizeGoogleAdsCustomerID(option, id string) (string, error) {
+	normalized := strings.ReplaceAll(id, "-", "")
+	if !googleAdsCustomerIDPattern.MatchString(normalized) {
+		return "", fmt.Errorf("%s must be a customer ID like 123-456-7890, got: %s", option, id)
+	}
+
+	return normalized, nil
+}
+
+// newGoogleAdsProvider returns a provider for config, or nil when any of its
+// credentials is missing
+func newGoogleAdsProvider(config *googleAdsConfig) (*googleAdsProvider, error) {
+	if config.CustomerID == "" {
+		return nil, errors.New("customer-id is required")
+	}
+
+	provider := &googleAdsProvider{config: *config, tokenURL: googleOAuthTokenURL, apiURL: googleAdsAPIURL}
+
+	var err error
+	if provider.config.CustomerID, err = normalizeGoogleAdsCustomerID("customer-id", config.CustomerID); err != nil {
+		return nil, err
+	}
+
+	if config.LoginCustomerID != "" {
+		if provider.config.LoginCustomerID, err = normalizeGoogleAdsCustomerID("login-customer-id", config.LoginCustomerID); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DeveloperToken == "" || config.ClientID == "" || config.ClientSecret == "" || config.RefreshToken == "" {
+		return nil, nil
+	}
+
+	return provider, nil
+}
+
+func (p *googleAdsProvider) name() string {
+	return "google-ads:" + p.config.CustomerID
+}
+
+type googleOAuthTokenResponseJson struct {
+	AccessToken string `json:"access_token"`
+}
+
+type googleAdsSearchResponseJson struct {
+	Results []struct {
+		Customer struct {
+			CurrencyCode string `json:"currencyCode"`
+		} `json:"customer"`
+		Metrics struct {
+			// int64 values are strings in the JSON of the Google Ads API
+			CostMicros string `json:"costMicros"`
+		} `json:"metrics"`
+	} `json:"results"`
+}
+
+func (p *googleAdsProvider) fetchSpend(ctx context.Context, client *adSpendClient, from, to time.Time) (adSpend, error) {
+	credentials, err := decryptAdSpendCredentials(p.config.DeveloperToken, p.config.ClientSecret, p.config.RefreshToken)
+	if err != nil {
+		return adSpend{}, err
+	}
+	developerToken, clientSecret, refreshToken := credentials[0], credentials[1], credentials[2]
+
+	var accessToken string
+	err = client.execute(ctx, "Google Ads token", func() error {
+		form := url.Values{
+			"client_id":     {p.config.ClientID},
+			"client_secret": {clientSecret},
+			"refresh_token": {refreshToken},
+			"grant_type":    {"refresh_token"},
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		response, err := decodeAdSpendResponse[googleOAuthTokenResponseJson](request)
+		if err != nil {
+			return err
+		}
+		if response.AccessToken == "" {
+			return errors.New("token response contains no access token")
+		}
+
+		accessToken = response.AccessToken
+		return nil
+	})
+	if err != nil {
+		return adSpend{}, err
+	}
+
+	// Dates are inclusive, and in the time zone of the account
+	query := fmt.Sprintf(
+		"SELECT customer.currency_code, metrics.cost_micros FROM customer WHERE segments.date BETWEEN '%s' AND '%s'",
+		from.Format(time.DateOnly),
+		to.AddDate(0, 0, -1).Format(time.DateOnly),
+	)
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return adSpend{}, err
+	}
+
+	var spend adSpend
+	err = client.execute(ctx, "Google Ads search", func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.apiURL+"/customers/"+p.config.CustomerID+"/googleAds:search", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+		request.Header.Set("developer-token", developerToken)
+		if p.config.LoginCustomerID != "" {
+			request.Header.Set("login-customer-id", p.config.LoginCustomerID)
+		}
+
+		response, err := decodeAdSpendResponse[googleAdsSearchResponseJson](request)
+		if err != nil {
+			return err
+		}
+
+		spend = adSpend{}
+		for _, result := range response.Results {
+			spend.Currency = result.Customer.CurrencyCode
+
+			// Zero values are left out
+			if result.Metrics.CostMicros == "" {
+				continue
+			}
+
+			micros, err := strconv.ParseInt(result.Metrics.CostMicros, 10, 64)
+			if err != nil {
+				return fmt.Errorf("cost is not a number: %q", result.Metrics.CostMicros)
+			}
+
+			spend.Amount += float64(micros) / 1e6
+		}
+
+		return nil
+	})
+	if err != nil {
+		return adSpend{}, err
+	}
+
+	return spend, nil
+}
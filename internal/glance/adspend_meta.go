@@ -0,0 +1,115 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metaGraphAPIURL = "https://graph.facebook.com/v21.0"
+
+var metaAdAccountIDPattern = regexp.MustCompile(`^\d+$`)
+
+// metaAdsConfig is the meta block of the ad-spend option, read with an access
+// token of the Marketing API that has the ads_read permission
+type metaAdsConfig struct {
+	AdAccountID string `yaml:"ad-account-id"`
+	AccessToken string `yaml:"access-token"`
+}
+
+type metaAdsProvider struct {
+	// Without the act_ prefix
+	adAccountID string
+	accessToken string
+	apiURL      string
+}
+
+// newMetaAdsProvider returns a provider for config, or nil when the access
+// token is missing
+func newMetaAdsProvider(config *metaAdsConfig) (*metaAdsProvider, error) {
+	id := strings.TrimPrefix(config.AdAccountID, "act_")
+	if !metaAdAccountIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("ad-account-id must be an ad account ID like act_1234567890, got: %q", config.AdAccountID)
+	}
+
+	if config.AccessToken == "" {
+		return nil, nil
+	}
+
+	return &metaAdsProvider{adAccountID: id, accessToken: config.AccessToken, apiURL: metaGraphAPIURL}, nil
+}
+
+func (p *metaAdsProvider) name() string {
+	return "meta:act_" + p.adAccountID
+}
+
+type metaInsightsResponseJson struct {
+	Data []struct {
+		// Amounts are strings in the account currency
+		Spend           string `json:"spend"`
+		AccountCurrency string `json:"account_currency"`
+	} `json:"data"`
+}
+
+func (p *metaAdsProvider) fetchSpend(ctx context.Context, client *adSpendClient, from, to time.Time) (adSpend, error) {
+	credentials, err := decryptAdSpendCredentials(p.accessToken)
+	if err != nil {
+		return adSpend{}, err
+	}
+	accessToken := credentials[0]
+
+	// Dates are inclusive, and in the time zone of the account
+	timeRange, err := json.Marshal(map[string]string{
+		"since": from.Format(time.DateOnly),
+		"until": to.AddDate(0, 0, -1).Format(time.DateOnly),
+	})
+	if err != nil {
+		return adSpend{}, err
+	}
+
+	query := url.Values{
+		"fields":     {"spend,account_currency"},
+		"level":      {"account"},
+		"time_range": {string(timeRange)},
+	}
+
+	var spend adSpend
+	err = client.execute(ctx, "Meta insights", func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+"/act_"+p.adAccountID+"/insights?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		// In a header rather than the query, to keep it out of logged URLs
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+
+		response, err := decodeAdSpendResponse[metaInsightsResponseJson](request)
+		if err != nil {
+			return err
+		}
+
+		// Accounts without spend in the period have no rows
+		spend = adSpend{}
+		for _, row := range response.Data {
+			amount, err := strconv.ParseFloat(row.Spend, 64)
+			if err != nil {
+				return fmt.Errorf("spend is not a number: %q", row.Spend)
+			}
+
+			spend.Amount += amount
+			spend.Currency = row.AccountCurrency
+		}
+
+		return nil
+	})
+	if err != nil {
+		return adSpend{}, err
+	}
+
+	return spend, nil
+}
@@ -0,0 +1,316 @@
+package glance
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/api")
+
+var goldenTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// apiResponseFixtures holds one fully populated value for every JSON response
+// served by the API, keyed by the name of its golden file
+func apiResponseFixtures() map[string]any {
+	return map[string]any{
+		"health": &HealthResponse{
+			Status:    HealthStatusDegraded,
+			Timestamp: goldenTime,
+			Uptime:    time.Hour,
+			Version:   "1.0.0",
+			Checks: map[string]*HealthCheckResult{
+				"database": {
+					Status:  HealthStatusHealthy,
+					Message: "Database operational",
+					Details: &DatabaseStats{
+						RevenueMetricsCount:  10,
+						CustomerMetricsCount: 8,
+						Modes:                1,
+						SkippedDuplicates:    3,
+						ApproxBytes:          1568,
+						TotalSnapshots:       20,
+						BudgetSnapshots:      5000,
+						PerMode: map[string]*ModeStats{
+							"live": {
+								RevenueSnapshots:  10,
+								CustomerSnapshots: 8,
+								OldestRevenueAt:   &goldenTime,
+								NewestRevenueAt:   &goldenTime,
+								OldestCustomerAt:  &goldenTime,
+								NewestCustomerAt:  &goldenTime,
+								Deltas:            2,
+								ApproxBytes:       1568,
+							},
+						},
+					},
+					Timestamp: goldenTime,
+					Duration:  time.Millisecond,
+				},
+				"memory": {
+					Status:    HealthStatusHealthy,
+					Message:   "Memory usage: 12 MB",
+					Details:   &MemoryHealthDetails{AllocMB: 12, SysMB: 30, NumGC: 4, Goroutines: 9, ThresholdMB: 512},
+					Timestamp: goldenTime,
+					Duration:  time.Millisecond,
+				},
+				"pause": {
+					Status:    HealthStatusDegraded,
+					Message:   "administratively paused",
+					Details:   &PauseHealthDetails{PausedSince: goldenTime},
+					Timestamp: goldenTime,
+					Duration:  time.Millisecond,
+				},
+				"primary": {
+					Status:    HealthStatusDegraded,
+					Message:   "Primary is stale, last snapshot 3h0m0s ago",
+					Details:   &PrimaryHealthDetails{LastSnapshotAt: &goldenTime, StaleAfter: "2h0m0s"},
+					Timestamp: goldenTime,
+					Duration:  time.Millisecond,
+				},
+				"stripe_pool": {
+					Status:    HealthStatusHealthy,
+					Message:   "Stripe pool operational",
+					Details:   &StripePoolMetrics{TotalClients: 2, CircuitStates: CircuitStateCounts{Closed: 2}},
+					Timestamp: goldenTime,
+					Duration:  time.Millisecond,
+				},
+			},
+		},
+		"readiness": &ReadinessResponse{Ready: false, Status: HealthStatusDegraded},
+		"liveness":  &LivenessResponse{Alive: true, Uptime: "1h0m0s"},
+		"pause":     &PauseStatusResponse{Paused: true, Since: &goldenTime},
+		"series": &SeriesResponse{
+			Metric:      "mrr",
+			Mode:        "live",
+			Granularity: MetricsBucketMonth,
+			Points: []SeriesPoint{
+				{Timestamp: goldenTime, Value: nil},
+				{Timestamp: goldenTime.AddDate(0, 1, 0), Value: &[]float64{1250.5}[0]},
+			},
+		},
+		"error": &APIErrorResponse{Error: "unknown metric"},
+		"revenue-history": &RevenueHistoryResponse{
+			Mode:  "live",
+			From:  goldenTime.AddDate(0, -1, 0),
+			To:    goldenTime,
+			Count: 1,
+			Snapshots: []*RevenueSnapshot{
+				{Timestamp: goldenTime, MRR: 1000, ARR: 12000, GrowthRate: 5, NewMRR: 100, ChurnedMRR: 50, Mode: "live"},
+			},
+			Annotations: []*Annotation{
+				{Timestamp: goldenTime.AddDate(0, 0, -7), Mode: "live", Label: "Price change", Description: "Pro plan moved to $49"},
+			},
+		},
+		"customer-history": &CustomerHistoryResponse{
+			Mode:  "live",
+			From:  goldenTime.AddDate(0, -1, 0),
+			To:    goldenTime,
+			Count: 1,
+			Snapshots: []*CustomerSnapshot{
+				{Timestamp: goldenTime, TotalCustomers: 40, NewCustomers: 4, ChurnedCustomers: 1, ChurnRate: 2.5, ActiveCustomers: 35, Mode: "live"},
+			},
+			Annotations: []*Annotation{},
+		},
+		"annotations": &AnnotationsResponse{
+			Mode: "live",
+			From: goldenTime.AddDate(0, -1, 0),
+			To:   goldenTime,
+			Annotations: []*Annotation{
+				{Timestamp: goldenTime.AddDate(0, 0, -7), Mode: "live", Label: "Price change", Description: "Pro plan moved to $49"},
+			},
+		},
+		"compare": func() *PeriodComparison {
+			mrrA, mrrB, mrrDelta, mrrPercent := 1000.0, 1100.0, 100.0, 10.0
+			return &PeriodComparison{
+				Mode:    "live",
+				A:       PeriodSummary{MetricsPeriod: MetricsPeriod{From: goldenTime.AddDate(0, -1, 0), To: goldenTime}, MRR: &mrrA},
+				B:       PeriodSummary{MetricsPeriod: MetricsPeriod{From: goldenTime, To: goldenTime.AddDate(0, 1, 0)}, MRR: &mrrB},
+				Changes: PeriodChanges{MRR: &mrrDelta, MRRPercent: &mrrPercent},
+			}
+		}(),
+		"purge": &MetricsPurgeResponse{Mode: "test", RevenueDeleted: 42, CustomerDeleted: 40, DeltasDeleted: 7, AnnotationsDeleted: 2},
+		"import": &MetricsImportResponse{
+			Imported: 11,
+			Skipped:  1,
+			Errors:   []ImportRowError{{Line: 4, Reason: "duplicate of line 3"}},
+		},
+		"webhook-received": &WebhookReceivedResponse{
+			Received: true,
+			EventID:  "evt_123",
+		},
+		"webhook-status": &WebhookStatusResponse{
+			TotalEvents:  1,
+			FailedEvents: 1,
+			EventsByType: map[string]int{"customer.created": 1},
+			RecentEvents: []WebhookEvent{
+				{ID: "evt_123", Type: "customer.created", Mode: "live", Processed: goldenTime, Success: false, Error: "boom", Attempts: 1},
+			},
+			Limit:            100,
+			RejectedEvents:   3,
+			RejectionReasons: map[string]int{"bad_signature": 2, "expired_timestamp": 1},
+			ModeFilter: WebhookModeFilter{
+				AcceptedModes:  []string{"live"},
+				Reason:         "stripe-mode of the configured widgets",
+				FilteredEvents: map[string]int{"test": 2},
+			},
+			PendingRetries: 1,
+			DeadLetters: []WebhookEvent{
+				{ID: "evt_122", Type: "charge.refunded", Mode: "live", Processed: goldenTime, Success: false, Error: "boom", Attempts: 5},
+			},
+		},
+		"webhook-replay": &WebhookReplayResponse{
+			Event: WebhookEvent{ID: "evt_123", Type: "customer.created", Mode: "live", Processed: goldenTime, Success: true, Replayed: true},
+		},
+		"webhook-dead-letters": &WebhookDeadLettersResponse{
+			DeadLetters: []WebhookDeadLetter{
+				{
+					ID:       "evt_122",
+					Type:     "charge.refunded",
+					Mode:     "live",
+					FailedAt: goldenTime,
+					Attempts: 2,
+					Errors: []WebhookAttemptError{
+						{Attempt: 1, At: goldenTime, Error: "boom"},
+						{Attempt: 2, At: goldenTime, Error: "boom again"},
+					},
+					Payload: json.RawMessage(`{"id":"ch_123","amount_refunded":500}`),
+				},
+			},
+			Count:          1,
+			MaxDeadLetters: 100,
+		},
+		"webhook-events": &WebhookEventsResponse{
+			Events: []WebhookEvent{
+				{ID: "evt_123", Type: "customer.created", Mode: "live", Processed: goldenTime, Success: true},
+				{ID: "evt_123", Type: "customer.created", Mode: "live", Processed: goldenTime, Success: true, Duplicate: true},
+			},
+			Count:      2,
+			Duplicates: 1,
+		},
+	}
+}
+
+func TestAPIResponses_MatchGoldenFiles(t *testing.T) {
+	for name, value := range apiResponseFixtures() {
+		t.Run(name, func(t *testing.T) {
+			actual, err := json.MarshalIndent(value, "", "  ")
+			if err != nil {
+				t.Fatalf("failed to marshal response: %v", err)
+			}
+			actual = append(actual, '\n')
+
+			path := filepath.Join("testdata", "api", name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(path, actual, 0644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+			}
+
+			expected, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+			}
+
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("response does not match %s, run with -update if the change is intended\ngot:\n%s\nwant:\n%s", path, actual, expected)
+			}
+		})
+	}
+}
+
+// Fields may be added to API responses but never removed, renamed or retyped, so
+// that clients parsing an older shape keep working. The golden files record the
+// shape clients rely on, the current response must be a superset of it.
+func TestAPIResponses_ChangesAreAdditiveOnly(t *testing.T) {
+	for name, value := range apiResponseFixtures() {
+		t.Run(name, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "api", name+".json"))
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+
+			actual, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("failed to marshal response: %v", err)
+			}
+
+			if path, ok := jsonShapeIsSuperset(decodeJSONShape(t, golden), decodeJSONShape(t, actual)); !ok {
+				t.Errorf("field %s was removed or changed type", path)
+			}
+		})
+	}
+
+	t.Run("extra field is additive", func(t *testing.T) {
+		previous := decodeJSONShape(t, []byte(`{"received": true}`))
+		current := decodeJSONShape(t, []byte(`{"received": true, "event_id": "evt_1"}`))
+
+		if _, ok := jsonShapeIsSuperset(previous, current); !ok {
+			t.Error("expected adding a field to be compatible")
+		}
+	})
+
+	t.Run("renamed field is breaking", func(t *testing.T) {
+		previous := decodeJSONShape(t, []byte(`{"total_events": 1}`))
+		current := decodeJSONShape(t, []byte(`{"TotalEvents": 1}`))
+
+		if _, ok := jsonShapeIsSuperset(previous, current); ok {
+			t.Error("expected renaming a field to be incompatible")
+		}
+	})
+}
+
+func decodeJSONShape(t *testing.T, data []byte) any {
+	t.Helper()
+
+	var shape any
+	if err := json.Unmarshal(data, &shape); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+
+	return shape
+}
+
+// jsonShapeIsSuperset reports whether every field in previous exists in current
+// with the same JSON type, returning the path of the first field that doesn't
+func jsonShapeIsSuperset(previous, current any) (string, bool) {
+	switch previousValue := previous.(type) {
+	case map[string]any:
+		currentValue, ok := current.(map[string]any)
+		if !ok {
+			return "", false
+		}
+
+		for key, value := range previousValue {
+			if path, ok := jsonShapeIsSuperset(value, currentValue[key]); !ok {
+				return "." + key + path, false
+			}
+		}
+	case []any:
+		currentValue, ok := current.([]any)
+		if !ok {
+			return "", false
+		}
+
+		if len(previousValue) > 0 && len(currentValue) > 0 {
+			if path, ok := jsonShapeIsSuperset(previousValue[0], currentValue[0]); !ok {
+				return "[0]" + path, false
+			}
+		}
+	case string:
+		_, ok := current.(string)
+		return "", ok
+	case float64:
+		_, ok := current.(float64)
+		return "", ok
+	case bool:
+		_, ok := current.(bool)
+		return "", ok
+	}
+
+	return "", true
+}
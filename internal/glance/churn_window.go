@@ -0,0 +1,63 @@
+package glance
+
+import (
+	"fmt"
+	"time"
+)
+
+const churnWindowCalendarMonth = "calendar-month"
+
+// churnWindows are the rolling churn windows besides the calendar month, in
+// days
+var churnWindows = map[string]int{"30d": 30, "90d": 90}
+
+// churnWindow is the period churn is measured over, set with churn-window:
+// the calendar month so far, which starts near zero on the 1st and grows
+// all month, or a rolling number of days ending now. The zero value is the
+// calendar month.
+type churnWindow struct {
+	days int
+}
+
+// parseChurnWindow parses a churn-window option, defaulting to calendar-month
+func parseChurnWindow(value string) (churnWindow, error) {
+	if value == "" || value == churnWindowCalendarMonth {
+		return churnWindow{}, nil
+	}
+
+	days, ok := churnWindows[value]
+	if !ok {
+		return churnWindow{}, fmt.Errorf("churn-window must be calendar-month, 30d or 90d, got: %s", value)
+	}
+
+	return churnWindow{days: days}, nil
+}
+
+// start returns when the window ending at now starts, the start of the month
+// in the time zone of now for the calendar month
+func (c churnWindow) start(now time.Time) time.Time {
+	if c.days == 0 {
+		return bucketStart(now, MetricsBucketMonth)
+	}
+
+	return now.AddDate(0, 0, -c.days)
+}
+
+// label describes the window next to churn figures
+func (c churnWindow) label() string {
+	if c.days == 0 {
+		return "this month"
+	}
+
+	return fmt.Sprintf("last %dd", c.days)
+}
+
+// perMonth scales a churn rate over the window to a month of 30 days, as
+// used for the lifetime value
+func (c churnWindow) perMonth(rate float64) float64 {
+	if c.days == 0 {
+		return rate
+	}
+
+	return rate * 30 / float64(c.days)
+}
@@ -0,0 +1,167 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestParseChurnWindow(t *testing.T) {
+	tests := []struct {
+		value   string
+		label   string
+		wantErr bool
+	}{
+		{value: "", label: "this month"},
+		{value: "calendar-month", label: "this month"},
+		{value: "30d", label: "last 30d"},
+		{value: "90d", label: "last 90d"},
+		{value: "7d", wantErr: true},
+		{value: "month", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			window, err := parseChurnWindow(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err == nil && window.label() != tt.label {
+				t.Errorf("expected label %q, got %q", tt.label, window.label())
+			}
+		})
+	}
+}
+
+func TestSubscriptionScan_CanceledSinceWindowEdges(t *testing.T) {
+	now := time.Date(2026, time.April, 10, 12, 0, 0, 0, time.UTC)
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	canceled := func(customer string, at time.Time) *stripe.Subscription {
+		return &stripe.Subscription{Customer: &stripe.Customer{ID: customer}, Status: stripe.SubscriptionStatusCanceled, CanceledAt: at.Unix()}
+	}
+
+	thirtyDaysAgo := time.Date(2026, time.March, 11, 12, 0, 0, 0, time.UTC)
+	scan := &subscriptionScan{
+		StartOfMonth:  startOfMonth,
+		CanceledSince: now.AddDate(0, 0, -90),
+		Canceled: []*stripe.Subscription{
+			canceled("cus_this_month", startOfMonth),
+			canceled("cus_today", now.Add(-time.Hour)),
+		},
+		EarlierCanceled: []*stripe.Subscription{
+			canceled("cus_window_start", thirtyDaysAgo),
+			canceled("cus_just_outside", thirtyDaysAgo.Add(-time.Second)),
+			canceled("cus_february", time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)),
+		},
+	}
+
+	tests := []struct {
+		window   string
+		expected int
+	}{
+		// Only cancellations since April 1, the first one right at midnight
+		{window: "calendar-month", expected: 2},
+		// Rolling from March 11 12:00, inclusive
+		{window: "30d", expected: 3},
+		{window: "90d", expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			window, err := parseChurnWindow(tt.window)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := countChurnedCustomers(scan, scan.canceledSince(window.start(now))); got != tt.expected {
+				t.Errorf("expected %d churned customers, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestChurnWindow_RollingWithinTheMonth(t *testing.T) {
+	// On the 31st a 30 day window starts after the start of the month, so
+	// cancellations of this month before it are left out
+	now := time.Date(2026, time.March, 31, 18, 0, 0, 0, time.UTC)
+	window, _ := parseChurnWindow("30d")
+
+	scan := &subscriptionScan{
+		StartOfMonth: time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Canceled: []*stripe.Subscription{
+			{Customer: &stripe.Customer{ID: "cus_1"}, CanceledAt: time.Date(2026, time.March, 1, 6, 0, 0, 0, time.UTC).Unix()},
+			{Customer: &stripe.Customer{ID: "cus_2"}, CanceledAt: time.Date(2026, time.March, 1, 18, 0, 0, 0, time.UTC).Unix()},
+		},
+	}
+
+	if got := countChurnedCustomers(scan, scan.canceledSince(window.start(now))); got != 1 {
+		t.Errorf("expected 1 churned customer in the last 30 days, got %d", got)
+	}
+}
+
+func TestScanSubscriptions_WiderChurnWindowListsAgain(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.April, 10, 12, 0, 0, 0, time.UTC)
+
+	lister := &fakeSubscriptionLister{}
+	client := newFakeStripeClient("sk_test_churn_window", lister)
+	defer subscriptionScans.invalidate()
+
+	monthly, _ := scanSubscriptions(ctx, client, now)
+	wide, _ := scanSubscriptionsCanceledSince(ctx, client, now, now.AddDate(0, 0, -90), subscriptionScanTTL)
+	if wide == nil || wide == monthly || !wide.CanceledSince.Equal(now.AddDate(0, 0, -90)) || lister.listings.Load() != 4 {
+		t.Fatalf("expected a wider churn window to list the canceled subscriptions again, got %d listings", lister.listings.Load())
+	}
+
+	if scan, _ := scanSubscriptionsCanceledSince(ctx, client, now, now.AddDate(0, 0, -30), subscriptionScanTTL); scan != wide {
+		t.Error("expected a narrower churn window to reuse the wider scan")
+	}
+
+	if scan, _ := scanSubscriptions(ctx, client, now); scan != wide {
+		t.Error("expected the calendar month to reuse the wider scan")
+	}
+
+	if listings := lister.listings.Load(); listings != 4 {
+		t.Errorf("expected no more listings for the reused scans, got %d", listings)
+	}
+}
+
+func TestRevenueWidget_GrossRevenueChurnOverRollingWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	for _, snapshot := range []*RevenueSnapshot{
+		{Timestamp: time.Date(2026, time.March, 20, 0, 0, 0, 0, time.UTC), MRR: 2000},
+		{Timestamp: time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC), MRR: 4000},
+	} {
+		snapshot.Mode = "test"
+		db.SaveRevenueSnapshot(ctx, snapshot)
+	}
+
+	window, _ := parseChurnWindow("30d")
+	w := &revenueWidget{StripeMode: "test", ChurnedMRR: 100, churnWindow: window}
+	w.updateGrossRevenueChurn(ctx, db, now)
+
+	// Against MRR on March 21, not at the start of April
+	if !w.GrossRevenueChurnDefined || !floatEquals(w.GrossRevenueChurnRate, 5, 0.001) {
+		t.Errorf("expected 5%%, got %v%% (defined %v)", w.GrossRevenueChurnRate, w.GrossRevenueChurnDefined)
+	}
+}
+
+func TestChurnWindow_PerMonth(t *testing.T) {
+	calendar, _ := parseChurnWindow("calendar-month")
+	quarter, _ := parseChurnWindow("90d")
+
+	if got := calendar.perMonth(6); got != 6 {
+		t.Errorf("expected the calendar month rate as is, got %v", got)
+	}
+
+	if got := quarter.perMonth(6); !floatEquals(got, 2, 0.001) {
+		t.Errorf("expected a third of the 90 day rate, got %v", got)
+	}
+}
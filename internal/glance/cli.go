@@ -22,6 +22,7 @@ const (
 	cliIntentMountpointInfo
 	cliIntentSecretMake
 	cliIntentPasswordHash
+	cliIntentStripeBackfill
 )
 
 type cliOptions struct {
@@ -55,6 +56,7 @@ func parseCliOptions() (*cliOptions, error) {
 		fmt.Println("  sensors:print         List all sensors")
 		fmt.Println("  mountpoint:info       Print information about a given mountpoint path")
 		fmt.Println("  diagnose              Run diagnostic checks")
+		fmt.Println("  stripe:backfill       Save monthly metrics rebuilt from Stripe to metrics.path (--months 12)")
 	}
 
 	configPath := flags.String("config", "glance.yml", "Set config path")
@@ -69,6 +71,8 @@ func parseCliOptions() (*cliOptions, error) {
 
 	if len(args) == 0 {
 		intent = cliIntentServe
+	} else if args[0] == "stripe:backfill" {
+		intent = cliIntentStripeBackfill
 	} else if len(args) == 1 {
 		if args[0] == "config:validate" {
 			intent = cliIntentConfigValidate
@@ -65,6 +65,53 @@ type config struct {
 		AppBackgroundColor string        `yaml:"app-background-color"`
 	} `yaml:"branding"`
 
+	Metrics struct {
+		CleanupInterval durationField `yaml:"cleanup-interval"`
+		Retention       durationField `yaml:"retention"`
+		DedupeWindow    durationField `yaml:"dedupe-window"`
+		DedupeTolerance float64       `yaml:"dedupe-tolerance"`
+		Path            string        `yaml:"path"`
+		SaveInterval    durationField `yaml:"save-interval"`
+		Encrypt         bool          `yaml:"encrypt"`
+		MaxSizeMB       int           `yaml:"max-size-mb"`
+		MaxSnapshots    int           `yaml:"max-snapshots"`
+		Timezone        string        `yaml:"timezone"`
+	} `yaml:"metrics"`
+
+	Currency struct {
+		ReportingCurrency string             `yaml:"reporting-currency"`
+		CurrencyRates     map[string]float64 `yaml:"currency-rates"`
+		RateProvider      string             `yaml:"rate-provider"`
+	} `yaml:"currency"`
+
+	StripeWebhook struct {
+		Secret         string          `yaml:"secret"`
+		Secrets        []webhookSecret `yaml:"secrets"`
+		MaxAttempts    int             `yaml:"max-attempts"`
+		MaxDeadLetters int             `yaml:"max-dead-letters"`
+		Workers        int             `yaml:"workers"`
+		QueueSize      int             `yaml:"queue-size"`
+		Processing     string          `yaml:"processing"` // sync to answer Stripe with a 500 when handlers fail
+		AcceptMode     string          `yaml:"accept-mode"`
+		StatusToken    string          `yaml:"status-token"` // bearer token for the webhook status, events and replay endpoints
+		RedactIDs      bool            `yaml:"redact-ids"`
+		Tolerance      durationField   `yaml:"tolerance"` // how long after they were signed deliveries are accepted
+
+		EventRetention   durationField `yaml:"event-retention"`   // how long the event log is kept
+		PayloadRetention durationField `yaml:"payload-retention"` // how long payloads are kept for replays, not saved when 0
+
+		IgnoreAPIVersionMismatch bool `yaml:"ignore-api-version-mismatch"`
+		InsecureSkipVerify       bool `yaml:"insecure-skip-verify"` // for local development, refused with live Stripe keys
+
+		Invalidations []webhookInvalidation `yaml:"invalidations"` // widget caches events invalidate, besides the built-in ones
+	} `yaml:"stripe-webhook"`
+
+	Replication struct {
+		Role         string        `yaml:"role"`
+		PollInterval durationField `yaml:"poll-interval"`
+		StaleAfter   durationField `yaml:"stale-after"`
+	} `yaml:"replication"`
+
 	Pages []page `yaml:"pages"`
 }
 
@@ -99,6 +146,22 @@ func newConfigFromYAML(contents []byte) (*config, error) {
 
 	config := &config{}
 	config.Server.Port = 8080
+	config.Metrics.CleanupInterval = durationField(time.Hour)
+	config.Metrics.Retention = durationField(90 * 24 * time.Hour)
+	config.Metrics.SaveInterval = durationField(5 * time.Minute)
+	config.Metrics.MaxSnapshots = defaultMetricsMaxSnapshots
+	config.Replication.Role = replicationRolePrimary
+	config.Replication.PollInterval = durationField(10 * time.Second)
+	config.Replication.StaleAfter = durationField(2 * time.Hour)
+	config.StripeWebhook.MaxAttempts = defaultWebhookMaxAttempts
+	config.StripeWebhook.MaxDeadLetters = defaultWebhookMaxDeadLetters
+	config.StripeWebhook.Workers = defaultWebhookWorkers
+	config.StripeWebhook.QueueSize = defaultWebhookQueueSize
+	config.StripeWebhook.Processing = webhookProcessingAsync
+	config.StripeWebhook.AcceptMode = webhookAcceptAuto
+	config.StripeWebhook.Tolerance = durationField(defaultWebhookTolerance)
+	config.StripeWebhook.EventRetention = durationField(defaultWebhookEventRetention)
+	config.StripeWebhook.PayloadRetention = durationField(defaultWebhookPayloadRetention)
 
 	err = yaml.Unmarshal(contents, config)
 	if err != nil {
@@ -477,6 +540,126 @@ func isConfigStateValid(config *config) error {
 		}
 	}
 
+	if config.Metrics.CleanupInterval <= 0 {
+		return fmt.Errorf("metrics cleanup-interval must be greater than 0")
+	}
+
+	if config.Metrics.Retention <= 0 {
+		return fmt.Errorf("metrics retention must be greater than 0")
+	}
+
+	if config.Metrics.DedupeWindow < 0 {
+		return fmt.Errorf("metrics dedupe-window cannot be negative")
+	}
+
+	if config.Metrics.DedupeTolerance < 0 {
+		return fmt.Errorf("metrics dedupe-tolerance cannot be negative")
+	}
+
+	if config.Metrics.MaxSizeMB < 0 {
+		return fmt.Errorf("metrics max-size-mb cannot be negative")
+	}
+
+	if config.Metrics.MaxSnapshots < 0 {
+		return fmt.Errorf("metrics max-snapshots cannot be negative")
+	}
+
+	if config.Metrics.SaveInterval <= 0 {
+		return fmt.Errorf("metrics save-interval must be greater than 0")
+	}
+
+	if config.Metrics.Encrypt {
+		if config.Metrics.Path == "" {
+			return fmt.Errorf("metrics encrypt requires metrics path to be set")
+		}
+
+		// Without a master key the encryption key is derived from the hostname,
+		// which would make the file unreadable after moving to another host
+		if os.Getenv("GLANCE_MASTER_KEY") == "" {
+			return fmt.Errorf("metrics encrypt requires GLANCE_MASTER_KEY to be set")
+		}
+	}
+
+	if _, err := loadTimezone(config.Metrics.Timezone); err != nil {
+		return fmt.Errorf("metrics %v", err)
+	}
+
+	if config.Currency.ReportingCurrency != "" {
+		if err := validateCurrencyCode(config.Currency.ReportingCurrency); err != nil {
+			return fmt.Errorf("currency reporting-currency: %v", err)
+		}
+	}
+
+	for currency, rate := range config.Currency.CurrencyRates {
+		if err := validateCurrencyCode(currency); err != nil {
+			return fmt.Errorf("currency currency-rates: %v", err)
+		}
+
+		if rate <= 0 {
+			return fmt.Errorf("currency currency-rates: the rate of %s must be greater than 0", currency)
+		}
+	}
+
+	if _, err := newExchangeRateProvider(config.Currency.RateProvider); err != nil {
+		return fmt.Errorf("currency %v", err)
+	}
+
+	if err := validateWebhookSecrets(config.StripeWebhook.Secrets); err != nil {
+		return err
+	}
+
+	if err := validateWebhookInvalidations(config.StripeWebhook.Invalidations); err != nil {
+		return err
+	}
+
+	if err := validateWebhookAcceptMode(config.StripeWebhook.AcceptMode); err != nil {
+		return err
+	}
+
+	if err := validateWebhookProcessing(config.StripeWebhook.Processing); err != nil {
+		return err
+	}
+
+	if config.StripeWebhook.MaxAttempts < 1 {
+		return fmt.Errorf("stripe-webhook max-attempts must be at least 1")
+	}
+
+	if config.StripeWebhook.MaxDeadLetters < 1 {
+		return fmt.Errorf("stripe-webhook max-dead-letters must be at least 1")
+	}
+
+	if config.StripeWebhook.Workers < 1 {
+		return fmt.Errorf("stripe-webhook workers must be at least 1")
+	}
+
+	if config.StripeWebhook.QueueSize < 1 {
+		return fmt.Errorf("stripe-webhook queue-size must be at least 1")
+	}
+
+	if config.StripeWebhook.Tolerance <= 0 {
+		return fmt.Errorf("stripe-webhook tolerance must be positive")
+	}
+
+	if config.StripeWebhook.EventRetention <= 0 {
+		return fmt.Errorf("stripe-webhook event-retention must be positive")
+	}
+
+	if config.Replication.Role != replicationRolePrimary && config.Replication.Role != replicationRoleReplica {
+		return fmt.Errorf("replication role must be 'primary' or 'replica', got: %s", config.Replication.Role)
+	}
+
+	if config.Replication.Role == replicationRoleReplica && config.Metrics.Path == "" {
+		return fmt.Errorf("replication role 'replica' requires metrics.path, set to the file saved by the primary")
+	}
+
+	if config.Replication.PollInterval <= 0 {
+		return fmt.Errorf("replication poll-interval must be greater than 0")
+	}
+
+	if config.Replication.StaleAfter <= 0 {
+		return fmt.Errorf("replication stale-after must be greater than 0")
+	}
+
 	if config.Server.AssetsPath != "" {
 		if _, err := os.Stat(config.Server.AssetsPath); os.IsNotExist(err) {
 			return fmt.Errorf("assets directory does not exist: %s", config.Server.AssetsPath)
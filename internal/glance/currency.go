@@ -0,0 +1,428 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const (
+	defaultReportingCurrency = "usd"
+	// exchangeRatesCacheDuration is how long rates from a provider are used
+	// before they are fetched again
+	exchangeRatesCacheDuration = 12 * time.Hour
+	// exchangeRatesRetryInterval is how long to wait after a failed fetch
+	exchangeRatesRetryInterval = 10 * time.Minute
+	ecbDailyRatesURL           = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+)
+
+var currencyCodePattern = regexp.MustCompile(`^[a-z]{3}$`)
+
+// zeroDecimalCurrencies are charged by Stripe in whole units rather than cents
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true,
+	"krw": true, "mga": true, "pyg": true, "rwf": true, "ugx": true, "vnd": true,
+	"vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// normalizeCurrency returns a currency code in the lower case used by Stripe
+func normalizeCurrency(currency string) string {
+	return strings.ToLower(strings.TrimSpace(currency))
+}
+
+// validateCurrencyCode checks that a currency is a three letter ISO 4217 code
+func validateCurrencyCode(currency string) error {
+	if !currencyCodePattern.MatchString(normalizeCurrency(currency)) {
+		return fmt.Errorf("%q is not a three letter currency code", currency)
+	}
+
+	return nil
+}
+
+// currencyUnitAmount converts an amount in the smallest unit of a currency as
+// used by Stripe to whole units
+func currencyUnitAmount(amount float64, currency string) float64 {
+	if zeroDecimalCurrencies[normalizeCurrency(currency)] {
+		return amount
+	}
+
+	return amount / 100.0
+}
+
+// currencyAmounts holds monthly amounts keyed by lower case currency code
+type currencyAmounts map[string]float64
+
+// itemMRR is the MRR of a subscription item after the discounts of its
+// subscription
+type itemMRR struct {
+	Price    *stripe.Price
+	Currency string
+	Amount   float64
+}
+
+// subscriptionItemsMRR returns the MRR of a subscription's recurring items
+// after its discounts, and whether any of them is billed per day. Items
+// without a currency of their own are counted in the currency of the
+// subscription. Tiered prices are resolved through resolver when it's set,
+// otherwise only when their tiers are included. Metered items are left out,
+// see estimateMeteredMRR. Discounts are spread over the items in proportion
+// to their amount.
+func subscriptionItemsMRR(sub *stripe.Subscription, resolver *priceResolver) ([]itemMRR, bool) {
+	if sub.Items == nil {
+		return nil, false
+	}
+
+	var items []itemMRR
+	subAmounts := make(currencyAmounts)
+	var billingInterval stripe.PriceRecurringInterval
+	var billingIntervalCount int64
+
+	dailyPlan := false
+	for _, item := range sub.Items.Data {
+		if item.Price == nil || item.Price.Recurring == nil || isMeteredItem(item) {
+			continue
+		}
+
+		currency := normalizeCurrency(string(item.Price.Currency))
+		if currency == "" {
+			currency = normalizeCurrency(string(sub.Currency))
+		}
+
+		itemPrice := item.Price
+		if resolver != nil {
+			itemPrice = resolver.withTiers(itemPrice)
+		}
+
+		amount, ok := itemPeriodAmount(itemPrice, item.Quantity)
+		if !ok && resolver != nil {
+			amount, ok = resolver.upcomingAmount(sub, item)
+		}
+
+		if !ok {
+			slog.Warn("Could not resolve the amount of a tiered price", "subscription_id", sub.ID, "price_id", item.Price.ID)
+			continue
+		}
+
+		interval := item.Price.Recurring.Interval
+		monthlyAmount, ok := normalizeMonthlyAmount(currencyUnitAmount(amount, currency), interval, item.Price.Recurring.IntervalCount)
+		if !ok {
+			slog.Warn("Unknown subscription interval", "interval", interval)
+			continue
+		}
+
+		if interval == stripe.PriceRecurringIntervalDay {
+			dailyPlan = true
+		}
+
+		if billingInterval == "" {
+			billingInterval, billingIntervalCount = interval, item.Price.Recurring.IntervalCount
+		}
+
+		items = append(items, itemMRR{Price: item.Price, Currency: currency, Amount: monthlyAmount})
+		subAmounts[currency] += monthlyAmount
+	}
+
+	undiscounted := make(currencyAmounts, len(subAmounts))
+	for currency, amount := range subAmounts {
+		undiscounted[currency] = amount
+	}
+
+	applyDiscounts(subAmounts, subscriptionDiscounts(sub), billingInterval, billingIntervalCount, time.Now())
+	for i := range items {
+		if total := undiscounted[items[i].Currency]; total > 0 {
+			items[i].Amount *= subAmounts[items[i].Currency] / total
+		}
+	}
+
+	return items, dailyPlan
+}
+
+// addSubscription adds the MRR of a subscription's recurring items after its
+// discounts, returning whether any of them is billed per day, see
+// subscriptionItemsMRR
+func (amounts currencyAmounts) addSubscription(sub *stripe.Subscription, resolver *priceResolver) bool {
+	items, dailyPlan := subscriptionItemsMRR(sub, resolver)
+	for _, item := range items {
+		amounts[item.Currency] += item.Amount
+	}
+
+	return dailyPlan
+}
+
+// currencyMRR is the MRR in a single currency
+type currencyMRR struct {
+	Currency  string  `json:"currency"`
+	Amount    float64 `json:"amount"`              // in the currency itself
+	Converted float64 `json:"converted,omitempty"` // in the reporting currency
+}
+
+// mrrConversion is the result of converting amounts to the reporting currency
+type mrrConversion struct {
+	Total float64
+	// Converted currencies, largest first
+	Breakdown []currencyMRR
+	// Currencies without an exchange rate, which are left out of Total
+	Unconverted []currencyMRR
+}
+
+// exchangeRateProvider fetches exchange rates, returning how many units of
+// each currency one unit of the base currency buys
+type exchangeRateProvider interface {
+	fetchRates(ctx context.Context) (base string, rates map[string]float64, err error)
+}
+
+// CurrencyConverter converts MRR from the currencies subscriptions are billed
+// in to the reporting currency, using fixed rates from the config and
+// otherwise the rates of a provider
+type CurrencyConverter struct {
+	mu        sync.RWMutex
+	reporting string
+	// Value of one unit of a currency in the reporting currency
+	fixedRates    map[string]float64
+	providerRates map[string]float64
+
+	provider  exchangeRateProvider
+	fetchedAt time.Time
+	nextFetch time.Time
+}
+
+var (
+	currencyConverterOnce     sync.Once
+	currencyConverterInstance *CurrencyConverter
+)
+
+// GetCurrencyConverter returns the converter shared by the Stripe widgets and
+// the webhook handler
+func GetCurrencyConverter() *CurrencyConverter {
+	currencyConverterOnce.Do(func() {
+		currencyConverterInstance = newCurrencyConverter(defaultReportingCurrency, nil, nil)
+	})
+
+	return currencyConverterInstance
+}
+
+func newCurrencyConverter(reporting string, rates map[string]float64, provider exchangeRateProvider) *CurrencyConverter {
+	c := &CurrencyConverter{}
+	c.Configure(reporting, rates, provider)
+	return c
+}
+
+// Configure sets the reporting currency, the fixed rates giving the value of
+// one unit of a currency in the reporting currency and an optional provider
+// for the currencies without a fixed rate
+func (c *CurrencyConverter) Configure(reporting string, rates map[string]float64, provider exchangeRateProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reporting = normalizeCurrency(reporting)
+	if c.reporting == "" {
+		c.reporting = defaultReportingCurrency
+	}
+
+	c.fixedRates = make(map[string]float64, len(rates))
+	for currency, rate := range rates {
+		c.fixedRates[normalizeCurrency(currency)] = rate
+	}
+
+	c.provider = provider
+	c.providerRates = nil
+	c.fetchedAt, c.nextFetch = time.Time{}, time.Time{}
+}
+
+// ReportingCurrency returns the lower case code of the reporting currency
+func (c *CurrencyConverter) ReportingCurrency() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.reporting
+}
+
+// refreshRates fetches the provider rates when they are older than
+// exchangeRatesCacheDuration, keeping the previous rates when fetching fails
+func (c *CurrencyConverter) refreshRates(ctx context.Context) {
+	c.mu.Lock()
+	now := time.Now()
+	provider, reporting := c.provider, c.reporting
+	if provider == nil || now.Before(c.nextFetch) {
+		c.mu.Unlock()
+		return
+	}
+	// Other conversions keep using the current rates while this one fetches
+	c.nextFetch = now.Add(exchangeRatesRetryInterval)
+	c.mu.Unlock()
+
+	base, rates, err := provider.fetchRates(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		slog.Error("Failed to fetch exchange rates", "error", err, "rates_from", c.fetchedAt)
+		return
+	}
+
+	converted := reportingRates(reporting, normalizeCurrency(base), rates)
+	if converted == nil {
+		slog.Error("Exchange rates don't include the reporting currency", "currency", reporting)
+		return
+	}
+
+	c.providerRates = converted
+	c.fetchedAt, c.nextFetch = now, now.Add(exchangeRatesCacheDuration)
+}
+
+// reportingRates turns rates relative to a base currency into the value of one
+// unit of each currency in the reporting currency. Returns nil when the
+// reporting currency isn't among the rates.
+func reportingRates(reporting, base string, rates map[string]float64) map[string]float64 {
+	perBase := make(map[string]float64, len(rates)+1)
+	for currency, rate := range rates {
+		if rate > 0 {
+			perBase[normalizeCurrency(currency)] = rate
+		}
+	}
+	perBase[base] = 1
+
+	reportingPerBase, ok := perBase[reporting]
+	if !ok {
+		return nil
+	}
+
+	converted := make(map[string]float64, len(perBase))
+	for currency, rate := range perBase {
+		converted[currency] = reportingPerBase / rate
+	}
+
+	return converted
+}
+
+// rate returns the value of one unit of a currency in the reporting currency
+func (c *CurrencyConverter) rate(currency string) (float64, bool) {
+	if currency == c.reporting {
+		return 1, true
+	}
+
+	if rate, ok := c.fixedRates[currency]; ok {
+		return rate, true
+	}
+
+	rate, ok := c.providerRates[currency]
+	return rate, ok
+}
+
+// Rate returns the value of one unit of a currency in the reporting currency
+func (c *CurrencyConverter) Rate(ctx context.Context, currency string) (float64, bool) {
+	c.refreshRates(ctx)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.rate(normalizeCurrency(currency))
+}
+
+// Convert converts the amounts to the reporting currency. Amounts in a
+// currency without a rate are reported as unconverted instead of being added
+// to the total.
+func (c *CurrencyConverter) Convert(ctx context.Context, amounts currencyAmounts) mrrConversion {
+	c.refreshRates(ctx)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var conversion mrrConversion
+	for currency, amount := range amounts {
+		rate, ok := c.rate(currency)
+		if !ok {
+			conversion.Unconverted = append(conversion.Unconverted, currencyMRR{Currency: currency, Amount: amount})
+			continue
+		}
+
+		converted := amount * rate
+		conversion.Total += converted
+		conversion.Breakdown = append(conversion.Breakdown, currencyMRR{Currency: currency, Amount: amount, Converted: converted})
+	}
+
+	slices.SortFunc(conversion.Breakdown, func(a, b currencyMRR) int {
+		if a.Converted != b.Converted {
+			if a.Converted > b.Converted {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Currency, b.Currency)
+	})
+
+	slices.SortFunc(conversion.Unconverted, func(a, b currencyMRR) int {
+		return strings.Compare(a.Currency, b.Currency)
+	})
+
+	return conversion
+}
+
+// currencySymbol returns the symbol of a currency, or its upper case code
+// followed by a space when it has none
+func currencySymbol(currency string) string {
+	code := strings.ToUpper(currency)
+	if symbol, ok := currencyToSymbol[code]; ok {
+		return symbol
+	}
+
+	return code + " "
+}
+
+// newExchangeRateProvider returns the provider named in the config, or nil
+// when none is set
+func newExchangeRateProvider(name string) (exchangeRateProvider, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "ecb":
+		return &ecbRateProvider{url: ecbDailyRatesURL}, nil
+	}
+
+	return nil, fmt.Errorf("unknown rate-provider %q, must be 'ecb'", name)
+}
+
+// ecbRateProvider reads the daily reference rates published by the European
+// Central Bank, which are relative to the euro
+type ecbRateProvider struct {
+	url string
+}
+
+type ecbRatesResponseXml struct {
+	Rates []struct {
+		Currency string  `xml:"currency,attr"`
+		Rate     float64 `xml:"rate,attr"`
+	} `xml:"Cube>Cube>Cube"`
+}
+
+func (p *ecbRateProvider) fetchRates(ctx context.Context) (string, map[string]float64, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	response, err := decodeXmlFromRequest[ecbRatesResponseXml](defaultHTTPClient, request)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetching ECB rates: %w", err)
+	}
+
+	if len(response.Rates) == 0 {
+		return "", nil, fmt.Errorf("ECB response contains no rates")
+	}
+
+	rates := make(map[string]float64, len(response.Rates))
+	for _, rate := range response.Rates {
+		rates[normalizeCurrency(rate.Currency)] = rate.Rate
+	}
+
+	return "eur", rates, nil
+}
@@ -0,0 +1,184 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCurrencyAmounts_AddSubscription(t *testing.T) {
+	item := func(currency stripe.Currency, amount int64, interval stripe.PriceRecurringInterval, quantity int64) *stripe.SubscriptionItem {
+		return &stripe.SubscriptionItem{
+			Quantity: quantity,
+			Price: &stripe.Price{
+				Currency:   currency,
+				UnitAmount: amount,
+				Recurring:  &stripe.PriceRecurring{Interval: interval, IntervalCount: 1},
+			},
+		}
+	}
+
+	amounts := make(currencyAmounts)
+	daily := amounts.addSubscription(&stripe.Subscription{
+		Currency: "eur",
+		Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{
+			item("usd", 10000, "month", 2),
+			item("EUR", 120000, "year", 1),
+			item("", 500, "month", 1),
+			item("jpy", 3000, "month", 1),
+			item("usd", 100, "day", 1),
+			{Price: &stripe.Price{Currency: "usd", UnitAmount: 100}},
+		}},
+	}, nil)
+
+	expected := map[string]float64{"usd": 230, "eur": 105, "jpy": 3000}
+	if len(amounts) != len(expected) {
+		t.Fatalf("expected %d currencies, got %v", len(expected), amounts)
+	}
+
+	for currency, amount := range expected {
+		if !floatEquals(amounts[currency], amount, 0.01) {
+			t.Errorf("expected %v %s, got %v", amount, currency, amounts[currency])
+		}
+	}
+
+	if !daily {
+		t.Error("expected the subscription to be flagged as billed per day")
+	}
+}
+
+type fakeRateProvider struct {
+	base  string
+	rates map[string]float64
+	err   error
+	calls int
+}
+
+func (p *fakeRateProvider) fetchRates(ctx context.Context) (string, map[string]float64, error) {
+	p.calls++
+	return p.base, p.rates, p.err
+}
+
+func TestCurrencyConverter_Convert(t *testing.T) {
+	ctx := context.Background()
+	amounts := currencyAmounts{"usd": 1000, "eur": 500, "gbp": 200, "chf": 100}
+
+	tests := []struct {
+		name                string
+		reporting           string
+		rates               map[string]float64
+		provider            *fakeRateProvider
+		expectedTotal       float64
+		expectedUnconverted []string
+	}{
+		{
+			name:                "fixed rates",
+			reporting:           "usd",
+			rates:               map[string]float64{"EUR": 1.1, "gbp": 1.25},
+			expectedTotal:       1000 + 550 + 250,
+			expectedUnconverted: []string{"chf"},
+		},
+		{
+			name:                "no rates",
+			reporting:           "",
+			expectedTotal:       1000,
+			expectedUnconverted: []string{"chf", "eur", "gbp"},
+		},
+		{
+			name:          "provider rates relative to another base",
+			reporting:     "usd",
+			provider:      &fakeRateProvider{base: "eur", rates: map[string]float64{"usd": 1.1, "gbp": 0.88, "chf": 0.55}},
+			expectedTotal: 1000 + 550 + 250 + 200,
+		},
+		{
+			name:          "fixed rates take precedence",
+			reporting:     "usd",
+			rates:         map[string]float64{"chf": 1},
+			provider:      &fakeRateProvider{base: "eur", rates: map[string]float64{"usd": 1.1, "gbp": 0.88, "chf": 0.55}},
+			expectedTotal: 1000 + 550 + 250 + 100,
+		},
+		{
+			name:                "failing provider",
+			reporting:           "usd",
+			provider:            &fakeRateProvider{err: errors.New("unavailable")},
+			expectedTotal:       1000,
+			expectedUnconverted: []string{"chf", "eur", "gbp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var provider exchangeRateProvider
+			if tt.provider != nil {
+				provider = tt.provider
+			}
+
+			conversion := newCurrencyConverter(tt.reporting, tt.rates, provider).Convert(ctx, amounts)
+
+			if !floatEquals(conversion.Total, tt.expectedTotal, 0.01) {
+				t.Errorf("expected total %v, got %v", tt.expectedTotal, conversion.Total)
+			}
+
+			if len(conversion.Unconverted) != len(tt.expectedUnconverted) {
+				t.Fatalf("expected unconverted %v, got %+v", tt.expectedUnconverted, conversion.Unconverted)
+			}
+
+			for i, currency := range tt.expectedUnconverted {
+				if conversion.Unconverted[i].Currency != currency || conversion.Unconverted[i].Amount != amounts[currency] {
+					t.Errorf("expected %s to be unconverted, got %+v", currency, conversion.Unconverted[i])
+				}
+			}
+
+			if len(conversion.Breakdown) > 0 && conversion.Breakdown[0].Currency != "usd" {
+				t.Errorf("expected the largest currency first, got %+v", conversion.Breakdown)
+			}
+		})
+	}
+}
+
+func TestCurrencyConverter_CachesProviderRates(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeRateProvider{base: "eur", rates: map[string]float64{"usd": 1.1}}
+	converter := newCurrencyConverter("usd", nil, provider)
+
+	converter.Convert(ctx, currencyAmounts{"eur": 1})
+	provider.err = errors.New("unavailable")
+	conversion := converter.Convert(ctx, currencyAmounts{"eur": 1})
+
+	if provider.calls != 1 {
+		t.Errorf("expected rates to be fetched once, got %d", provider.calls)
+	}
+
+	if !floatEquals(conversion.Total, 1.1, 0.001) {
+		t.Errorf("expected cached rates to be used, got %v", conversion.Total)
+	}
+}
+
+func TestECBRateProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-10-15">
+			<Cube currency="USD" rate="1.0850"/>
+			<Cube currency="GBP" rate="0.8412"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`))
+	}))
+	defer server.Close()
+
+	base, rates, err := (&ecbRateProvider{url: server.URL}).fetchRates(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if base != "eur" || len(rates) != 2 || rates["usd"] != 1.085 || rates["gbp"] != 0.8412 {
+		t.Errorf("unexpected rates: %s %v", base, rates)
+	}
+}
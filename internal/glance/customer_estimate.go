@@ -0,0 +1,81 @@
+package glance
+
+import (
+	"math"
+	"time"
+)
+
+// customerEstimateConfidence is the confidence level of the reported margin
+const customerEstimateConfidence = 0.95
+
+// customerEstimateZScore is the two-sided z-score for customerEstimateConfidence
+const customerEstimateZScore = 1.96
+
+// customerEstimateInput holds everything the estimator needs, gathered by the
+// customers widget from the metrics database and a sample of recent customers
+type customerEstimateInput struct {
+	Now time.Time
+
+	// Last exact enumeration
+	BaselineTotal int
+	BaselineAt    time.Time
+
+	// Customers created since BaselineAt found by listing the most recent pages.
+	// When SampleComplete is false the listing stopped early and OldestSampledAt
+	// is the creation time of the oldest customer that was seen.
+	SampledNew      int
+	SampleComplete  bool
+	OldestSampledAt time.Time
+
+	// customer.created and customer.deleted webhook events since BaselineAt
+	WebhookCreated int
+	WebhookDeleted int
+}
+
+// customerEstimate is the result of estimateCustomerTotal
+type customerEstimate struct {
+	Total      int
+	Margin     int     // +/- Margin customers at Confidence
+	Confidence float64 // e.g. 0.95
+}
+
+// estimateCustomerTotal estimates the current number of customers from the last
+// exact count, a sample of the most recently created customers and the webhook
+// events seen since. Additions are taken from the sample when it reached back to
+// the baseline, otherwise from webhooks when any were received, and otherwise by
+// extrapolating the sampled creation rate over the time since the baseline. The
+// margin models sampled creations as a Poisson process.
+func estimateCustomerTotal(in customerEstimateInput) customerEstimate {
+	added := 0.0
+	margin := 0.0
+
+	switch {
+	case in.SampleComplete:
+		added = float64(in.SampledNew)
+	case in.WebhookCreated > 0:
+		added = float64(max(in.WebhookCreated, in.SampledNew))
+	default:
+		elapsed := in.Now.Sub(in.BaselineAt)
+		sampledSpan := in.Now.Sub(in.OldestSampledAt)
+
+		if sampledSpan <= 0 || elapsed <= 0 {
+			added = float64(in.SampledNew)
+			break
+		}
+
+		factor := max(elapsed.Seconds()/sampledSpan.Seconds(), 1)
+		added = float64(in.SampledNew) * factor
+		margin = customerEstimateZScore * factor * math.Sqrt(math.Max(float64(in.SampledNew), 1))
+	}
+
+	total := in.BaselineTotal + int(math.Round(added)) - in.WebhookDeleted
+	if total < 0 {
+		total = 0
+	}
+
+	return customerEstimate{
+		Total:      total,
+		Margin:     int(math.Ceil(margin)),
+		Confidence: customerEstimateConfidence,
+	}
+}
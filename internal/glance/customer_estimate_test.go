@@ -0,0 +1,88 @@
+package glance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateCustomerTotal(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		input          customerEstimateInput
+		expectedTotal  int
+		expectedMargin int
+	}{
+		{
+			name: "complete sample is exact",
+			input: customerEstimateInput{
+				Now:            now,
+				BaselineTotal:  300000,
+				BaselineAt:     now.Add(-9 * time.Hour),
+				SampledNew:     120,
+				SampleComplete: true,
+				WebhookDeleted: 20,
+			},
+			expectedTotal:  300100,
+			expectedMargin: 0,
+		},
+		{
+			name: "webhook counts preferred over incomplete sample",
+			input: customerEstimateInput{
+				Now:             now,
+				BaselineTotal:   300000,
+				BaselineAt:      now.Add(-12 * time.Hour),
+				SampledNew:      500,
+				OldestSampledAt: now.Add(-6 * time.Hour),
+				WebhookCreated:  900,
+				WebhookDeleted:  50,
+			},
+			expectedTotal:  300850,
+			expectedMargin: 0,
+		},
+		{
+			name: "incomplete sample is extrapolated",
+			input: customerEstimateInput{
+				Now:             now,
+				BaselineTotal:   300000,
+				BaselineAt:      now.Add(-12 * time.Hour),
+				SampledNew:      400,
+				OldestSampledAt: now.Add(-6 * time.Hour),
+			},
+			// 400 in 6h extrapolated to 12h, margin 1.96 * 2 * sqrt(400)
+			expectedTotal:  300800,
+			expectedMargin: 79,
+		},
+		{
+			name: "never goes negative",
+			input: customerEstimateInput{
+				Now:            now,
+				BaselineTotal:  10,
+				BaselineAt:     now.Add(-time.Hour),
+				SampleComplete: true,
+				WebhookDeleted: 25,
+			},
+			expectedTotal:  0,
+			expectedMargin: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimate := estimateCustomerTotal(tt.input)
+
+			if estimate.Total != tt.expectedTotal {
+				t.Errorf("expected total %d, got %d", tt.expectedTotal, estimate.Total)
+			}
+
+			if estimate.Margin != tt.expectedMargin {
+				t.Errorf("expected margin %d, got %d", tt.expectedMargin, estimate.Margin)
+			}
+
+			if estimate.Confidence != customerEstimateConfidence {
+				t.Errorf("expected confidence %f, got %f", customerEstimateConfidence, estimate.Confidence)
+			}
+		})
+	}
+}
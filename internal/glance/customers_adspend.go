@@ -0,0 +1,205 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// adSpendCacheDuration is how long the spend of a month is used before it
+	// is fetched again, as ad platforms keep adjusting it for a few days
+	adSpendCacheDuration = 24 * time.Hour
+	// adSpendRetryInterval is how long to wait after a failed fetch
+	adSpendRetryInterval = 15 * time.Minute
+)
+
+// adSpendConfig is the ad-spend option of a customers widget, the ad
+// accounts whose spend last month divided by last month's new customers is
+// the CAC. Credentials may be encrypted like the Stripe API key.
+type adSpendConfig struct {
+	GoogleAds *googleAdsConfig `yaml:"google-ads"`
+	Meta      *metaAdsConfig   `yaml:"meta"`
+}
+
+// adSpend is an amount spent on ads in the currency of the ad account
+type adSpend struct {
+	Amount   float64
+	Currency string
+}
+
+// adSpendProvider fetches the spend of an ad account
+type adSpendProvider interface {
+	// name identifies the provider and ad account, for the cache and logs
+	name() string
+	// fetchSpend returns the spend from the start of the day of from up to
+	// the start of the day of to
+	fetchSpend(ctx context.Context, client *adSpendClient, from, to time.Time) (adSpend, error)
+}
+
+// newAdSpendProviders returns the providers of the ad-spend option. Providers
+// with missing credentials are skipped with a warning, leaving the CAC to the
+// cac option.
+func newAdSpendProviders(config *adSpendConfig) ([]adSpendProvider, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	var providers []adSpendProvider
+
+	if config.GoogleAds != nil {
+		provider, err := newGoogleAdsProvider(config.GoogleAds)
+		if err != nil {
+			return nil, fmt.Errorf("ad-spend: google-ads: %w", err)
+		}
+		if provider != nil {
+			providers = append(providers, provider)
+		} else {
+			slog.Warn("Google Ads credentials are missing, not fetching its ad spend")
+		}
+	}
+
+	if config.Meta != nil {
+		provider, err := newMetaAdsProvider(config.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("ad-spend: meta: %w", err)
+		}
+		if provider != nil {
+			providers = append(providers, provider)
+		} else {
+			slog.Warn("Meta credentials are missing, not fetching its ad spend")
+		}
+	}
+
+	return providers, nil
+}
+
+// adSpendCacheEntry is the spend of a provider in a month, or the error of
+// fetching it
+type adSpendCacheEntry struct {
+	spend   adSpend
+	err     error
+	expires time.Time
+}
+
+type adSpendCache struct {
+	mu      sync.Mutex
+	entries map[string]adSpendCacheEntry
+}
+
+var adSpendCached = &adSpendCache{entries: make(map[string]adSpendCacheEntry)}
+
+// fetch returns the spend of provider from from to to, fetching it unless it
+// was fetched in the last adSpendCacheDuration. Failures are cached for
+// adSpendRetryInterval so that every update doesn't retry them.
+func (c *adSpendCache) fetch(ctx context.Context, provider adSpendProvider, from, to time.Time) (adSpend, error) {
+	key := provider.name() + ":" + from.Format(time.DateOnly) + ":" + to.Format(time.DateOnly)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.spend, entry.err
+	}
+
+	spend, err := provider.fetchSpend(ctx, adSpendClientFor(provider.name()), from, to)
+
+	entry = adSpendCacheEntry{spend: spend, err: err, expires: now.Add(adSpendCacheDuration)}
+	if err != nil {
+		entry.expires = now.Add(adSpendRetryInterval)
+	}
+
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	return spend, err
+}
+
+// invalidate drops every cached spend
+func (c *adSpendCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+}
+
+// totalAdSpend returns the spend of every provider from from to to in the
+// reporting currency. Any provider failing fails the total, as a partial
+// spend would understate the CAC.
+func totalAdSpend(ctx context.Context, providers []adSpendProvider, converter *CurrencyConverter, from, to time.Time) (float64, error) {
+	total := 0.0
+	for _, provider := range providers {
+		spend, err := adSpendCached.fetch(ctx, provider, from, to)
+		if err != nil {
+			return 0, fmt.Errorf("fetching %s ad spend: %w", provider.name(), err)
+		}
+
+		if spend.Amount == 0 {
+			continue
+		}
+
+		rate, ok := converter.Rate(ctx, spend.Currency)
+		if !ok {
+			return 0, fmt.Errorf("no exchange rate for the %s ad spend in %s", provider.name(), spend.Currency)
+		}
+
+		total += spend.Amount * rate
+	}
+
+	return total, nil
+}
+
+// updateCACFromAdSpend sets the CAC to last month's ad spend divided by last
+// month's new customers from its last stored snapshot, keeping the CAC of
+// the cac option when either isn't available
+func (w *customersWidget) updateCACFromAdSpend(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	to := bucketStart(now, MetricsBucketMonth)
+	from := to.AddDate(0, -1, 0)
+
+	lastMonth, err := db.GetCustomersBefore(ctx, w.metricsKey(), to.Add(-time.Nanosecond))
+	if errors.Is(err, ErrNoSnapshot) || (err == nil && lastMonth.Timestamp.Before(from)) {
+		slog.Debug("No customer snapshot from last month, using the cac option")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get last month's customer snapshot", "error", err)
+		return
+	}
+	if lastMonth.NewCustomers == 0 {
+		slog.Debug("No new customers last month, using the cac option")
+		return
+	}
+
+	spend, err := totalAdSpend(ctx, w.adSpend, GetCurrencyConverter(), from, to)
+	if err != nil {
+		slog.Error("Failed to fetch ad spend, using the cac option", "error", err)
+		return
+	}
+
+	w.AdSpend = spend
+	w.CAC = spend / float64(lastMonth.NewCustomers)
+	w.CACFromAdSpend = true
+}
+
+// decryptAdSpendCredentials decrypts credentials encrypted like the Stripe
+// API key, returning them in the same order
+func decryptAdSpendCredentials(values ...string) ([]string, error) {
+	encService, err := GetEncryptionService()
+	if err != nil {
+		return nil, fmt.Errorf("encryption service unavailable: %w", err)
+	}
+
+	decrypted := make([]string, len(values))
+	for i, value := range values {
+		if decrypted[i], err = encService.DecryptIfNeeded(value); err != nil {
+			return nil, fmt.Errorf("failed to decrypt ad spend credential: %w", err)
+		}
+	}
+
+	return decrypted, nil
+}
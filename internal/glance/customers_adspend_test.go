@@ -0,0 +1,282 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAdSpendClient returns a client that retries without waiting
+func newTestAdSpendClient() *adSpendClient {
+	return &adSpendClient{
+		circuitBreaker: &CircuitBreaker{maxFailures: 10, resetTimeout: time.Minute, state: CircuitClosed},
+		rateLimiter:    &RateLimiter{tokens: 10, maxTokens: 10, refillRate: 10, lastRefill: time.Now()},
+		maxRetries:     2,
+		retryBackoff:   time.Millisecond,
+	}
+}
+
+var (
+	adSpendFrom = time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+	adSpendTo   = time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestGoogleAdsProvider_FetchSpend(t *testing.T) {
+	searches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("refresh_token") != "refresh" || r.PostForm.Get("client_secret") != "secret" {
+				http.Error(w, "invalid_grant", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token": "access", "expires_in": 3599}`))
+		case "/customers/1234567890/googleAds:search":
+			searches++
+			// The first search fails like an overloaded server would
+			if searches == 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			var body struct{ Query string }
+			json.NewDecoder(r.Body).Decode(&body)
+			if r.Header.Get("Authorization") != "Bearer access" || r.Header.Get("developer-token") != "developer" || r.Header.Get("login-customer-id") != "9876543210" {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(body.Query, "BETWEEN '2026-09-01' AND '2026-09-30'") {
+				http.Error(w, "unexpected query: "+body.Query, http.StatusBadRequest)
+				return
+			}
+
+			w.Write([]byte(`{"results": [{"customer": {"currencyCode": "EUR"}, "metrics": {"costMicros": "1234560000"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := newGoogleAdsProvider(&googleAdsConfig{
+		CustomerID:      "123-456-7890",
+		LoginCustomerID: "987-654-3210",
+		DeveloperToken:  "developer",
+		ClientID:        "client",
+		ClientSecret:    "secret",
+		RefreshToken:    "refresh",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provider.tokenURL, provider.apiURL = server.URL+"/token", server.URL
+
+	spend, err := provider.fetchSpend(context.Background(), newTestAdSpendClient(), adSpendFrom, adSpendTo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !floatEquals(spend.Amount, 1234.56, 0.001) || spend.Currency != "EUR" {
+		t.Errorf("expected 1234.56 EUR, got %+v", spend)
+	}
+
+	if searches != 2 {
+		t.Errorf("expected the failed search to be retried once, got %d searches", searches)
+	}
+}
+
+func TestMetaAdsProvider_FetchSpend(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"error": {"message": "Invalid OAuth access token"}}`, http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/act_42/insights" || r.URL.Query().Get("time_range") != `{"since":"2026-09-01","until":"2026-09-30"}` {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{"data": [{"spend": "310.5", "account_currency": "USD"}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := newMetaAdsProvider(&metaAdsConfig{AdAccountID: "act_42", AccessToken: "token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provider.apiURL = server.URL
+
+	spend, err := provider.fetchSpend(context.Background(), newTestAdSpendClient(), adSpendFrom, adSpendTo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if spend.Amount != 310.5 || spend.Currency != "USD" {
+		t.Errorf("expected 310.5 USD, got %+v", spend)
+	}
+
+	// Invalid credentials aren't retried
+	provider.accessToken = "expired"
+	requests = 0
+	if _, err := provider.fetchSpend(context.Background(), newTestAdSpendClient(), adSpendFrom, adSpendTo); err == nil {
+		t.Error("expected an error for an invalid access token")
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request for a client error, got %d", requests)
+	}
+}
+
+func TestNewAdSpendProviders(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *adSpendConfig
+		wantProviders int
+		wantErr       bool
+	}{
+		{name: "not configured"},
+		{
+			name: "both",
+			config: &adSpendConfig{
+				GoogleAds: &googleAdsConfig{CustomerID: "1234567890", DeveloperToken: "d", ClientID: "c", ClientSecret: "s", RefreshToken: "r"},
+				Meta:      &metaAdsConfig{AdAccountID: "42", AccessToken: "t"},
+			},
+			wantProviders: 2,
+		},
+		{
+			name:   "missing credentials are skipped",
+			config: &adSpendConfig{GoogleAds: &googleAdsConfig{CustomerID: "1234567890"}, Meta: &metaAdsConfig{AdAccountID: "act_42"}},
+		},
+		{name: "invalid customer ID", config: &adSpendConfig{GoogleAds: &googleAdsConfig{CustomerID: "123-456"}}, wantErr: true},
+		{name: "invalid ad account", config: &adSpendConfig{Meta: &metaAdsConfig{AdAccountID: "my-account"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers, err := newAdSpendProviders(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if len(providers) != tt.wantProviders {
+				t.Errorf("expected %d providers, got %d", tt.wantProviders, len(providers))
+			}
+		})
+	}
+}
+
+// fakeAdSpendProvider returns a fixed spend and counts its fetches
+type fakeAdSpendProvider struct {
+	id      string
+	spend   adSpend
+	err     error
+	fetches int
+}
+
+func (p *fakeAdSpendProvider) name() string {
+	return "fake:" + p.id
+}
+
+func (p *fakeAdSpendProvider) fetchSpend(ctx context.Context, client *adSpendClient, from, to time.Time) (adSpend, error) {
+	p.fetches++
+	return p.spend, p.err
+}
+
+func TestCustomersWidget_UpdateCACFromAdSpend(t *testing.T) {
+	ctx := context.Background()
+	defer adSpendCached.invalidate()
+
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	db := newSimpleMetricsDB()
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: time.Date(2026, time.September, 30, 23, 0, 0, 0, time.UTC), NewCustomers: 20, Mode: "test"})
+
+	tests := []struct {
+		name      string
+		providers []adSpendProvider
+		wantCAC   float64
+		wantAds   bool
+	}{
+		{
+			name: "spend per new customer",
+			providers: []adSpendProvider{
+				&fakeAdSpendProvider{id: "google", spend: adSpend{Amount: 600, Currency: "USD"}},
+				&fakeAdSpendProvider{id: "meta", spend: adSpend{Amount: 400, Currency: "usd"}},
+			},
+			wantCAC: 50,
+			wantAds: true,
+		},
+		{
+			name: "falls back to the cac option when a provider fails",
+			providers: []adSpendProvider{
+				&fakeAdSpendProvider{id: "google-ok", spend: adSpend{Amount: 600, Currency: "USD"}},
+				&fakeAdSpendProvider{id: "meta-down", err: errors.New("unavailable")},
+			},
+			wantCAC: 80,
+		},
+		{
+			name:      "falls back to the cac option without an exchange rate",
+			providers: []adSpendProvider{&fakeAdSpendProvider{id: "google-xts", spend: adSpend{Amount: 600, Currency: "XTS"}}},
+			wantCAC:   80,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &customersWidget{StripeMode: "test", timezone: time.UTC, adSpend: tt.providers, CAC: 80}
+			w.updateCACFromAdSpend(ctx, db, now)
+
+			if w.CAC != tt.wantCAC || w.CACFromAdSpend != tt.wantAds {
+				t.Errorf("expected CAC %v from ads %v, got %v from ads %v", tt.wantCAC, tt.wantAds, w.CAC, w.CACFromAdSpend)
+			}
+		})
+	}
+}
+
+func TestCustomersWidget_UpdateCACFromAdSpend_WithoutLastMonth(t *testing.T) {
+	ctx := context.Background()
+	defer adSpendCached.invalidate()
+
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	db := newSimpleMetricsDB()
+	// Only a snapshot from August, which isn't last month's count
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: time.Date(2026, time.August, 31, 0, 0, 0, 0, time.UTC), NewCustomers: 20, Mode: "test"})
+
+	provider := &fakeAdSpendProvider{id: "no-history", spend: adSpend{Amount: 600, Currency: "USD"}}
+	w := &customersWidget{StripeMode: "test", timezone: time.UTC, adSpend: []adSpendProvider{provider}, CAC: 80}
+	w.updateCACFromAdSpend(ctx, db, now)
+
+	if w.CAC != 80 || w.CACFromAdSpend {
+		t.Errorf("expected the cac option without last month's new customers, got %v", w.CAC)
+	}
+
+	if provider.fetches != 0 {
+		t.Errorf("expected no ad spend to be fetched, got %d fetches", provider.fetches)
+	}
+}
+
+func TestAdSpendCache(t *testing.T) {
+	ctx := context.Background()
+	defer adSpendCached.invalidate()
+
+	provider := &fakeAdSpendProvider{id: "cached", spend: adSpend{Amount: 100, Currency: "USD"}}
+	for range 3 {
+		if _, err := adSpendCached.fetch(ctx, provider, adSpendFrom, adSpendTo); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if provider.fetches != 1 {
+		t.Errorf("expected the spend to be fetched once and cached, got %d fetches", provider.fetches)
+	}
+
+	// Another month is fetched on its own
+	adSpendCached.fetch(ctx, provider, adSpendTo, adSpendTo.AddDate(0, 1, 0))
+	if provider.fetches != 2 {
+		t.Errorf("expected another month to be fetched, got %d fetches", provider.fetches)
+	}
+}
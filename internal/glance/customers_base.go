@@ -0,0 +1,61 @@
+package glance
+
+import (
+	"fmt"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// Populations the churn rate of the customers widget can be measured against,
+// set with customer-base
+const (
+	customerBaseAll    = "all"
+	customerBasePaying = "paying"
+)
+
+func validateCustomerBase(base *string) error {
+	if *base == "" {
+		*base = customerBaseAll
+	}
+
+	if *base != customerBaseAll && *base != customerBasePaying {
+		return fmt.Errorf("customer-base must be 'all' or 'paying', got: %s", *base)
+	}
+
+	return nil
+}
+
+// countPayingCustomers returns the number of customers with an active or
+// trialing subscription
+func countPayingCustomers(scan *subscriptionScan) int {
+	uniqueCustomers := make(subscriptionCustomers)
+	scan.withStatus(uniqueCustomers.add, stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing)
+
+	return len(uniqueCustomers)
+}
+
+// updatePayingSplit sets the paying customers from scan and the free ones,
+// every other customer, who never subscribed or only has canceled
+// subscriptions. Without the subscriptions neither is known.
+func (w *customersWidget) updatePayingSplit(scan *subscriptionScan) {
+	w.PayingCustomers, w.FreeCustomers, w.PayingShare = 0, 0, 0
+	if scan == nil {
+		return
+	}
+
+	w.PayingCustomers = countPayingCustomers(scan)
+	w.FreeCustomers = max(0, w.TotalCustomers-w.PayingCustomers)
+	if w.TotalCustomers > 0 {
+		w.PayingShare = min(100, float64(w.PayingCustomers)/float64(w.TotalCustomers)*100)
+	}
+}
+
+// churnBase returns the number of customers the churn rate is a percentage
+// of, every customer or only the paying ones with customer-base: paying
+func (w *customersWidget) churnBase() int {
+	if w.CustomerBase == customerBasePaying {
+		return w.PayingCustomers
+	}
+
+	return w.TotalCustomers
+}
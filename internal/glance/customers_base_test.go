@@ -0,0 +1,52 @@
+package glance
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCustomersWidget_PayingSplit(t *testing.T) {
+	sub := func(customer string, status stripe.SubscriptionStatus) *stripe.Subscription {
+		return &stripe.Subscription{Customer: &stripe.Customer{ID: customer}, Status: status}
+	}
+
+	// 3 paying customers out of 10, one of them with two subscriptions
+	scan := &subscriptionScan{
+		Current: []*stripe.Subscription{
+			sub("cus_1", stripe.SubscriptionStatusActive),
+			sub("cus_1", stripe.SubscriptionStatusActive),
+			sub("cus_2", stripe.SubscriptionStatusTrialing),
+			sub("cus_3", stripe.SubscriptionStatusActive),
+			sub("cus_4", stripe.SubscriptionStatusIncomplete),
+		},
+		Canceled: []*stripe.Subscription{sub("cus_5", stripe.SubscriptionStatusCanceled)},
+	}
+
+	w := &customersWidget{TotalCustomers: 10, ChurnedCustomers: 1, CustomerBase: customerBaseAll}
+	w.updatePayingSplit(scan)
+
+	if w.PayingCustomers != 3 || w.FreeCustomers != 7 || !floatEquals(w.PayingShare, 30, 0.001) {
+		t.Errorf("expected 3 paying, 7 free and a 30%% paying share, got %d, %d and %v", w.PayingCustomers, w.FreeCustomers, w.PayingShare)
+	}
+
+	tests := []struct {
+		base     string
+		expected int
+	}{
+		{customerBaseAll, 10},
+		{customerBasePaying, 3},
+	}
+
+	for _, tt := range tests {
+		w.CustomerBase = tt.base
+		if got := w.churnBase(); got != tt.expected {
+			t.Errorf("%s: expected a churn base of %d, got %d", tt.base, tt.expected, got)
+		}
+	}
+
+	w.updatePayingSplit(nil)
+	if w.PayingCustomers != 0 || w.FreeCustomers != 0 || w.PayingShare != 0 {
+		t.Error("expected no split without the subscriptions")
+	}
+}
@@ -0,0 +1,138 @@
+package glance
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cacMonthLayout is the layout of the months of a cac option, e.g. 2024-01
+const cacMonthLayout = "2006-01"
+
+// cacConfig is the cac option of a customers widget, either a flat customer
+// acquisition cost or one per month:
+//
+//	cac:
+//	  2024-01: 380
+//	  2024-04: 420
+type cacConfig struct {
+	Flat    *float64
+	Monthly map[string]float64
+}
+
+func (c *cacConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var value float64
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("cac must be a number or a map of months like 2024-01 to numbers: %w", err)
+		}
+
+		c.Flat = &value
+		return nil
+	}
+
+	if err := node.Decode(&c.Monthly); err != nil {
+		return fmt.Errorf("cac must be a number or a map of months like 2024-01 to numbers: %w", err)
+	}
+
+	return nil
+}
+
+func (c cacConfig) set() bool {
+	return c.Flat != nil || len(c.Monthly) > 0
+}
+
+// monthlyCAC is the customer acquisition cost from a month on
+type monthlyCAC struct {
+	// Months since year 0, so that months compare the same in every time zone
+	month int
+	value float64
+}
+
+// cacSchedule is the parsed cac option, a flat value or the values of months
+// in chronological order
+type cacSchedule struct {
+	flat   float64
+	months []monthlyCAC
+}
+
+func cacMonthIndex(year int, month time.Month) int {
+	return year*12 + int(month) - 1
+}
+
+// parseCAC parses and validates the cac option of a customers widget
+func parseCAC(config cacConfig) (cacSchedule, error) {
+	var schedule cacSchedule
+
+	if config.Flat != nil {
+		if *config.Flat < 0 {
+			return cacSchedule{}, fmt.Errorf("cac must not be negative, got: %g", *config.Flat)
+		}
+
+		schedule.flat = *config.Flat
+		return schedule, nil
+	}
+
+	for key, value := range config.Monthly {
+		month, err := time.Parse(cacMonthLayout, key)
+		if err != nil {
+			return cacSchedule{}, fmt.Errorf("cac months must be like 2024-01, got: %s", key)
+		}
+
+		if value < 0 {
+			return cacSchedule{}, fmt.Errorf("cac of %s must not be negative, got: %g", key, value)
+		}
+
+		schedule.months = append(schedule.months, monthlyCAC{month: cacMonthIndex(month.Year(), month.Month()), value: value})
+	}
+
+	slices.SortFunc(schedule.months, func(a, b monthlyCAC) int {
+		return a.month - b.month
+	})
+
+	return schedule, nil
+}
+
+// at returns the customer acquisition cost of the month of t: the value of
+// the latest configured month up to it, as costs are usually only entered
+// when they change, or 0 before the first month
+func (s cacSchedule) at(t time.Time) float64 {
+	if s.months == nil {
+		return s.flat
+	}
+
+	month := cacMonthIndex(t.Year(), t.Month())
+
+	cac := 0.0
+	for _, m := range s.months {
+		if m.month > month {
+			break
+		}
+		cac = m.value
+	}
+
+	return cac
+}
+
+// cacFromEnv reads the flat customer acquisition cost of the deprecated
+// BUSINESS_CAC environment variable, for widgets without a cac option
+func cacFromEnv() cacSchedule {
+	value := os.Getenv("BUSINESS_CAC")
+	if value == "" {
+		return cacSchedule{}
+	}
+
+	cac, err := strconv.ParseFloat(value, 64)
+	if err != nil || cac < 0 {
+		slog.Warn("Ignoring invalid BUSINESS_CAC environment variable", "value", value)
+		return cacSchedule{}
+	}
+
+	slog.Warn("The BUSINESS_CAC environment variable is deprecated, set the cac option of the customers widget instead")
+	return cacSchedule{flat: cac}
+}
@@ -0,0 +1,99 @@
+package glance
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func decodeCACConfig(t *testing.T, source string) cacConfig {
+	t.Helper()
+
+	var options struct {
+		CAC cacConfig `yaml:"cac"`
+	}
+	if err := yaml.Unmarshal([]byte(source), &options); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return options.CAC
+}
+
+func TestParseCAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		at      time.Time
+		want    float64
+		wantErr bool
+	}{
+		{name: "flat", source: "cac: 250", at: time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC), want: 250},
+		{
+			name:   "month with a value",
+			source: "cac:\n  2024-01: 380\n  2024-04: 420",
+			at:     time.Date(2024, time.April, 30, 0, 0, 0, 0, time.UTC),
+			want:   420,
+		},
+		{
+			name:   "carried over from an earlier month",
+			source: "cac:\n  2024-04: 420\n  2024-01: 380",
+			at:     time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC),
+			want:   380,
+		},
+		{
+			name:   "before the first month",
+			source: "cac:\n  2024-01: 380",
+			at:     time.Date(2023, time.December, 31, 0, 0, 0, 0, time.UTC),
+			want:   0,
+		},
+		{name: "negative", source: "cac: -5", wantErr: true},
+		{name: "invalid month", source: "cac:\n  2024-13: 380", wantErr: true},
+		{name: "date instead of month", source: "cac:\n  2024-01-15: 380", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCAC(decodeCACConfig(t, tt.source))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err == nil && schedule.at(tt.at) != tt.want {
+				t.Errorf("expected CAC %v, got %v", tt.want, schedule.at(tt.at))
+			}
+		})
+	}
+}
+
+func TestCACConfig_RejectsLists(t *testing.T) {
+	var options struct {
+		CAC cacConfig `yaml:"cac"`
+	}
+	if err := yaml.Unmarshal([]byte("cac: [380, 420]"), &options); err == nil {
+		t.Error("expected an error for a list of values")
+	}
+}
+
+func TestCustomersWidget_CACFromEnv(t *testing.T) {
+	t.Setenv("BUSINESS_CAC", "120")
+	now := time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	w := &customersWidget{StripeAPIKey: "sk_test_cac_env"}
+	if err := w.initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cac := w.cac.at(now); cac != 120 {
+		t.Errorf("expected the environment variable as a fallback, got %v", cac)
+	}
+
+	w = &customersWidget{StripeAPIKey: "sk_test_cac_option", CACConfig: decodeCACConfig(t, "cac: 300")}
+	if err := w.initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cac := w.cac.at(now); cac != 300 {
+		t.Errorf("expected the cac option to take precedence, got %v", cac)
+	}
+}
@@ -0,0 +1,94 @@
+package glance
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// maxChannels is how many acquisition channels are listed, the rest are
+// grouped as Other so that one-off values don't flood the widget
+const maxChannels = 8
+
+// channelUnknown groups the new customers without a channel
+const channelUnknown = "direct/unknown"
+
+// channelCustomers is the number of new customers of an acquisition channel
+// this month and the MRR of their active subscriptions in the reporting
+// currency
+type channelCustomers struct {
+	Channel      string
+	NewCustomers int
+	MRR          float64
+	// Other groups the channels outside of the top channels, Unknown the
+	// customers without a channel
+	Other   bool
+	Unknown bool
+}
+
+// customerChannel returns the channel of c under the metadata key, lower case
+// so that sources like Google and google are one channel, or channelUnknown
+func customerChannel(c *stripe.Customer, key string) string {
+	if c == nil {
+		return channelUnknown
+	}
+
+	channel := strings.ToLower(strings.TrimSpace(c.Metadata[key]))
+	if channel == "" {
+		return channelUnknown
+	}
+
+	return channel
+}
+
+// channelBreakdown groups the new customers by the channel in their metadata
+// under key along with the MRR of their active subscriptions, returning the
+// limit channels with the most new customers, followed by the rest of the
+// channels grouped together and the customers without a channel
+func channelBreakdown(ctx context.Context, newCustomers map[string]*stripe.Customer, key string, scan *subscriptionScan, converter *CurrencyConverter, limit int) []channelCustomers {
+	channels := make(map[string]string, len(newCustomers))
+	counts := make(map[string]int)
+	for id, c := range newCustomers {
+		channel := customerChannel(c, key)
+		channels[id] = channel
+		counts[channel]++
+	}
+
+	// Subscriptions of customers who aren't new are summed under ""
+	amounts := activeMRRByGroup(ctx, channels, scan)
+
+	breakdown := make([]channelCustomers, 0, len(counts))
+	var unknown *channelCustomers
+	for channel, count := range counts {
+		c := channelCustomers{Channel: channel, NewCustomers: count, MRR: converter.Convert(ctx, amounts[channel]).Total}
+		if channel == channelUnknown {
+			c.Unknown = true
+			unknown = &c
+			continue
+		}
+
+		breakdown = append(breakdown, c)
+	}
+
+	slices.SortFunc(breakdown, func(a, b channelCustomers) int {
+		return cmp.Or(cmp.Compare(b.NewCustomers, a.NewCustomers), cmp.Compare(b.MRR, a.MRR), strings.Compare(a.Channel, b.Channel))
+	})
+
+	if len(breakdown) > limit {
+		other := channelCustomers{Channel: "Other", Other: true}
+		for _, rest := range breakdown[limit:] {
+			other.NewCustomers += rest.NewCustomers
+			other.MRR += rest.MRR
+		}
+		breakdown = append(breakdown[:limit], other)
+	}
+
+	if unknown != nil {
+		breakdown = append(breakdown, *unknown)
+	}
+
+	return breakdown
+}
@@ -0,0 +1,82 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestChannelBreakdown(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	customer := func(id, channel string) *stripe.Customer {
+		c := &stripe.Customer{ID: id}
+		if channel != "" {
+			c.Metadata = map[string]string{"utm_source": channel}
+		}
+		return c
+	}
+
+	newCustomers := map[string]*stripe.Customer{
+		"cus_g1": customer("cus_g1", "google"),
+		"cus_g2": customer("cus_g2", " Google "),
+		"cus_g3": customer("cus_g3", "google"),
+		"cus_n1": customer("cus_n1", "newsletter"),
+		"cus_d1": customer("cus_d1", ""),
+		"cus_d2": {ID: "cus_d2", Metadata: map[string]string{"utm_medium": "cpc"}},
+	}
+	// One-off values beyond the top channels
+	for i := range 8 {
+		id := fmt.Sprintf("cus_once_%d", i)
+		newCustomers[id] = customer(id, fmt.Sprintf("partner-%d", i))
+	}
+
+	sub := func(c *stripe.Customer, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			Customer: c,
+			Status:   stripe.SubscriptionStatusActive,
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: amount, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+			}}},
+		}
+	}
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{
+		sub(newCustomers["cus_g1"], 5000),
+		sub(newCustomers["cus_g2"], 5000),
+		sub(newCustomers["cus_n1"], 2000),
+		sub(newCustomers["cus_d1"], 1000),
+		// Not new, so not attributed
+		sub(customer("cus_old", "google"), 99900),
+	}}
+
+	channels := channelBreakdown(ctx, newCustomers, "utm_source", scan, GetCurrencyConverter(), 3)
+
+	expected := []channelCustomers{
+		{Channel: "google", NewCustomers: 3, MRR: 100},
+		{Channel: "newsletter", NewCustomers: 1, MRR: 20},
+		{Channel: "partner-0", NewCustomers: 1},
+		{Channel: "Other", NewCustomers: 7, Other: true},
+		{Channel: channelUnknown, NewCustomers: 2, MRR: 10, Unknown: true},
+	}
+
+	if len(channels) != len(expected) {
+		t.Fatalf("expected %d channels, got %+v", len(expected), channels)
+	}
+
+	for i, want := range expected {
+		got := channels[i]
+		if got.Channel != want.Channel || got.NewCustomers != want.NewCustomers || !floatEquals(got.MRR, want.MRR, 0.001) || got.Other != want.Other || got.Unknown != want.Unknown {
+			t.Errorf("channel %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	if got := channelBreakdown(ctx, nil, "utm_source", scan, GetCurrencyConverter(), maxChannels); len(got) != 0 {
+		t.Errorf("expected no channels without new customers, got %+v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package glance
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// delinquentCustomer is a delinquent customer and the MRR of their active and
+// past due subscriptions in the reporting currency
+type delinquentCustomer struct {
+	ID   string
+	Name string
+	MRR  float64
+}
+
+// customerDisplayName returns the name of a customer, or their email or ID
+// when they have no name
+func customerDisplayName(c *stripe.Customer) string {
+	return cmp.Or(c.Name, c.Email, c.ID)
+}
+
+// pastDueCustomers returns the customers of past due subscriptions by ID, for
+// when the customer list with Stripe's delinquent flag isn't available
+func pastDueCustomers(scan *subscriptionScan) map[string]string {
+	customers := make(map[string]string)
+	scan.withStatus(func(sub *stripe.Subscription) {
+		if sub.Customer != nil && sub.Customer.ID != "" {
+			customers[sub.Customer.ID] = customerDisplayName(sub.Customer)
+		}
+	}, stripe.SubscriptionStatusPastDue)
+
+	return customers
+}
+
+// delinquentBreakdown returns the number of delinquent customers and the
+// limit of them with the most MRR at stake, from their active and past due
+// subscriptions of scan. scan may be nil, leaving the MRR at 0.
+func delinquentBreakdown(ctx context.Context, delinquent map[string]string, scan *subscriptionScan, converter *CurrencyConverter, limit int) (int, []delinquentCustomer) {
+	if len(delinquent) == 0 || limit == 0 {
+		return len(delinquent), nil
+	}
+
+	amounts := make(map[string]currencyAmounts)
+	if scan != nil {
+		resolver := newPriceResolver(ctx)
+		scan.withStatus(func(sub *stripe.Subscription) {
+			if sub.Customer == nil {
+				return
+			}
+
+			if _, ok := delinquent[sub.Customer.ID]; !ok {
+				return
+			}
+
+			if amounts[sub.Customer.ID] == nil {
+				amounts[sub.Customer.ID] = make(currencyAmounts)
+			}
+			amounts[sub.Customer.ID].addSubscription(sub, resolver)
+		}, stripe.SubscriptionStatusActive, stripe.SubscriptionStatusPastDue)
+	}
+
+	customers := make([]delinquentCustomer, 0, len(delinquent))
+	for id, name := range delinquent {
+		customers = append(customers, delinquentCustomer{ID: id, Name: name, MRR: converter.Convert(ctx, amounts[id]).Total})
+	}
+
+	slices.SortFunc(customers, func(a, b delinquentCustomer) int {
+		return cmp.Or(cmp.Compare(b.MRR, a.MRR), strings.Compare(a.ID, b.ID))
+	})
+
+	return len(delinquent), customers[:min(limit, len(customers))]
+}
@@ -0,0 +1,87 @@
+package glance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestDelinquentBreakdown(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	sub := func(customer string, status stripe.SubscriptionStatus, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       "sub_" + customer + "_" + string(status),
+			Customer: &stripe.Customer{ID: customer},
+			Status:   status,
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: amount, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+			}}},
+		}
+	}
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{
+		sub("cus_1", stripe.SubscriptionStatusPastDue, 5000),
+		sub("cus_1", stripe.SubscriptionStatusActive, 1000),
+		sub("cus_2", stripe.SubscriptionStatusPastDue, 9000),
+		sub("cus_3", stripe.SubscriptionStatusActive, 2000),
+		sub("cus_4", stripe.SubscriptionStatusActive, 500),
+	}}
+
+	delinquent := map[string]string{"cus_1": "Acme", "cus_2": "ops@example.com", "cus_4": "cus_4", "cus_5": "No subscriptions"}
+
+	count, top := delinquentBreakdown(ctx, delinquent, scan, GetCurrencyConverter(), 3)
+	if count != 4 {
+		t.Errorf("expected 4 delinquent customers, got %d", count)
+	}
+
+	expected := []delinquentCustomer{
+		{ID: "cus_2", Name: "ops@example.com", MRR: 90},
+		{ID: "cus_1", Name: "Acme", MRR: 60},
+		{ID: "cus_4", Name: "cus_4", MRR: 5},
+	}
+
+	if len(top) != len(expected) {
+		t.Fatalf("expected %d customers, got %+v", len(expected), top)
+	}
+
+	for i := range expected {
+		if top[i].ID != expected[i].ID || top[i].Name != expected[i].Name || !floatEquals(top[i].MRR, expected[i].MRR, 0.001) {
+			t.Errorf("customer %d: expected %+v, got %+v", i, expected[i], top[i])
+		}
+	}
+
+	if count, top := delinquentBreakdown(ctx, delinquent, scan, GetCurrencyConverter(), 0); count != 4 || top != nil {
+		t.Errorf("expected only the count without delinquent-list, got %d and %+v", count, top)
+	}
+
+	if got := pastDueCustomers(scan); len(got) != 2 || got["cus_1"] != "cus_1" || got["cus_2"] != "cus_2" {
+		t.Errorf("expected the customers of past due subscriptions, got %v", got)
+	}
+}
+
+func TestInvalidateCachesForEvent_PaymentFailedInvalidatesCustomers(t *testing.T) {
+	invalidator := &recordingInvalidator{}
+	wh := &WebhookHandler{cacheInvalidator: invalidator}
+
+	if err := wh.invalidateCachesForEvent("invoice.payment_failed"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(invalidator.widgetTypes) != 2 || invalidator.widgetTypes[0] != "revenue" || invalidator.widgetTypes[1] != "customers" {
+		t.Errorf("expected the revenue and customers caches to be invalidated, got %v", invalidator.widgetTypes)
+	}
+}
+
+type recordingInvalidator struct {
+	widgetTypes []string
+}
+
+func (r *recordingInvalidator) InvalidateCache(widgetType string) error {
+	r.widgetTypes = append(r.widgetTypes, widgetType)
+	return nil
+}
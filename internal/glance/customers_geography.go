@@ -0,0 +1,140 @@
+package glance
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const defaultTopCountries = 5
+
+// customerCountries maps customer IDs to their country, an upper case ISO
+// 3166-1 code or "" when unknown
+type customerCountries map[string]string
+
+// customerCountry returns the country of a customer's address, falling back
+// to the country of the card of their default payment method, which must be
+// expanded. Returns "" when neither is known.
+func customerCountry(c *stripe.Customer) string {
+	if c.Address != nil && c.Address.Country != "" {
+		return strings.ToUpper(c.Address.Country)
+	}
+
+	if c.InvoiceSettings != nil && c.InvoiceSettings.DefaultPaymentMethod != nil {
+		if card := c.InvoiceSettings.DefaultPaymentMethod.Card; card != nil && card.Country != "" {
+			return strings.ToUpper(card.Country)
+		}
+	}
+
+	return ""
+}
+
+// countryCustomers is the number of customers in a country and the MRR of
+// their active subscriptions in the reporting currency
+type countryCustomers struct {
+	Country    string
+	Customers  int
+	MRR        float64
+	Percentage float64 // of all customers
+	// Other groups the countries outside of the top countries, Unknown the
+	// customers without a country
+	Other   bool
+	Unknown bool
+}
+
+// countryBreakdown counts the customers of each country along with the MRR
+// of their active subscriptions, returning the limit countries with the most
+// customers, followed by the rest of the countries grouped together and the
+// customers without a country. Subscriptions of customers that weren't listed
+// are counted as unknown.
+func countryBreakdown(ctx context.Context, countries customerCountries, scan *subscriptionScan, converter *CurrencyConverter, limit int) []countryCustomers {
+	customers := make(map[string]int)
+	for _, country := range countries {
+		customers[country]++
+	}
+
+	amounts := activeMRRByGroup(ctx, countries, scan)
+
+	breakdown := make([]countryCustomers, 0, len(customers))
+	var unknown *countryCustomers
+	for country, count := range customers {
+		c := countryCustomers{Country: country, Customers: count}
+		if country == "" {
+			c.Unknown = true
+			unknown = &c
+			continue
+		}
+
+		breakdown = append(breakdown, c)
+	}
+
+	if _, ok := customers[""]; !ok && amounts[""] != nil {
+		unknown = &countryCustomers{Unknown: true}
+	}
+
+	for i := range breakdown {
+		breakdown[i].MRR = converter.Convert(ctx, amounts[breakdown[i].Country]).Total
+	}
+
+	slices.SortFunc(breakdown, func(a, b countryCustomers) int {
+		return cmp.Or(cmp.Compare(b.Customers, a.Customers), cmp.Compare(b.MRR, a.MRR), strings.Compare(a.Country, b.Country))
+	})
+
+	if len(breakdown) > limit {
+		other := countryCustomers{Other: true}
+		for _, rest := range breakdown[limit:] {
+			other.Customers += rest.Customers
+			other.MRR += rest.MRR
+		}
+		breakdown = append(breakdown[:limit], other)
+	}
+
+	if unknown != nil {
+		unknown.MRR = converter.Convert(ctx, amounts[""]).Total
+		breakdown = append(breakdown, *unknown)
+	}
+
+	if total := len(countries); total > 0 {
+		for i := range breakdown {
+			breakdown[i].Percentage = float64(breakdown[i].Customers) / float64(total) * 100
+		}
+	}
+
+	return breakdown
+}
+
+// activeMRRByGroup sums the MRR of active subscriptions by the group of their
+// customer in groups, which maps customer IDs to a group. Subscriptions of
+// customers that aren't in groups are summed under "".
+func activeMRRByGroup(ctx context.Context, groups map[string]string, scan *subscriptionScan) map[string]currencyAmounts {
+	amounts := make(map[string]currencyAmounts)
+	if scan == nil {
+		return amounts
+	}
+
+	resolver := newPriceResolver(ctx)
+	now := time.Now()
+
+	scan.withStatus(func(sub *stripe.Subscription) {
+		// Paused subscriptions aren't part of MRR, as on the revenue widget
+		if subscriptionPaused(sub, now) {
+			return
+		}
+
+		group := ""
+		if sub.Customer != nil {
+			group = groups[sub.Customer.ID]
+		}
+
+		if amounts[group] == nil {
+			amounts[group] = make(currencyAmounts)
+		}
+		amounts[group].addSubscription(sub, resolver)
+	}, stripe.SubscriptionStatusActive)
+
+	return amounts
+}
@@ -0,0 +1,94 @@
+package glance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCustomerCountry(t *testing.T) {
+	card := func(country string) *stripe.CustomerInvoiceSettings {
+		return &stripe.CustomerInvoiceSettings{DefaultPaymentMethod: &stripe.PaymentMethod{Card: &stripe.PaymentMethodCard{Country: country}}}
+	}
+
+	tests := []struct {
+		name     string
+		customer *stripe.Customer
+		expected string
+	}{
+		{"address", &stripe.Customer{Address: &stripe.Address{Country: "de"}, InvoiceSettings: card("FR")}, "DE"},
+		{"card without an address", &stripe.Customer{InvoiceSettings: card("fr")}, "FR"},
+		{"card with an empty address", &stripe.Customer{Address: &stripe.Address{City: "Paris"}, InvoiceSettings: card("FR")}, "FR"},
+		{"payment method without a card", &stripe.Customer{InvoiceSettings: &stripe.CustomerInvoiceSettings{DefaultPaymentMethod: &stripe.PaymentMethod{ID: "pm_1"}}}, ""},
+		{"nothing known", &stripe.Customer{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := customerCountry(tt.customer); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountryBreakdown(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	countries := customerCountries{
+		"cus_1": "US", "cus_2": "US", "cus_3": "US",
+		"cus_4": "DE", "cus_5": "DE",
+		"cus_6": "FR",
+		"cus_7": "GB",
+		"cus_8": "", "cus_9": "",
+	}
+
+	sub := func(customer string, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       "sub_" + customer,
+			Customer: &stripe.Customer{ID: customer},
+			Status:   stripe.SubscriptionStatusActive,
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: amount, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+			}}},
+		}
+	}
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{
+		sub("cus_1", 1000),
+		sub("cus_4", 5000),
+		sub("cus_6", 2000),
+		sub("cus_7", 3000),
+		sub("cus_8", 700),
+		// Customer created after the customers were listed
+		sub("cus_10", 300),
+	}}
+
+	breakdown := countryBreakdown(ctx, countries, scan, GetCurrencyConverter(), 2)
+
+	expected := []countryCustomers{
+		{Country: "US", Customers: 3, MRR: 10},
+		{Country: "DE", Customers: 2, MRR: 50},
+		{Customers: 2, MRR: 50, Other: true},
+		{Customers: 2, MRR: 10, Unknown: true},
+	}
+
+	if len(breakdown) != len(expected) {
+		t.Fatalf("expected %d rows, got %+v", len(expected), breakdown)
+	}
+
+	for i, row := range breakdown {
+		want := expected[i]
+		if row.Country != want.Country || row.Customers != want.Customers || row.Other != want.Other || row.Unknown != want.Unknown || !floatEquals(row.MRR, want.MRR, 0.001) {
+			t.Errorf("row %d: expected %+v, got %+v", i, want, row)
+		}
+
+		if percentage := float64(want.Customers) / 9 * 100; !floatEquals(row.Percentage, percentage, 0.001) {
+			t.Errorf("row %d: expected %v%% of customers, got %v", i, percentage, row.Percentage)
+		}
+	}
+}
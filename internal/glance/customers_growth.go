@@ -0,0 +1,75 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// customerBaselineSnapshot returns the customer snapshot the growth rate
+// compares against, picked the same way as for revenue
+func (b growthBaseline) customerBaselineSnapshot(ctx context.Context, db *SimpleMetricsDB, key string, now time.Time) (*CustomerSnapshot, error) {
+	if b.kind == growthBaselinePreviousUpdate {
+		return db.GetCustomersBefore(ctx, key, now.Add(-time.Nanosecond))
+	}
+
+	return db.GetCustomersNearest(ctx, key, b.target(now))
+}
+
+// updateGrowth sets the net growth of the month, and the growth rate of the
+// total against the snapshot of the widget's growth baseline. The rate is
+// unavailable until there is history reaching back to the baseline, rather
+// than comparing with a snapshot from a few hours ago.
+func (w *customersWidget) updateGrowth(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	baseline := w.baseline()
+	w.NetGrowth = w.NewCustomers - w.ChurnedCustomers
+	w.GrowthRate, w.GrowthDefined = 0, false
+	w.GrowthComparedAt = time.Time{}
+	w.GrowthBaselineLabel = baseline.label()
+	if db == nil {
+		return
+	}
+
+	previous, err := baseline.customerBaselineSnapshot(ctx, db, w.metricsKey(), now)
+	switch {
+	case err == nil:
+		w.compareGrowthWith(previous, now)
+	case errors.Is(err, ErrNoSnapshot):
+		// First update, growth is compared once enough history is stored
+	default:
+		slog.Error("Failed to get previous customer snapshot", "error", err)
+	}
+}
+
+// compareGrowthWith sets the growth rate of the total against a previous
+// snapshot, leaving it undefined when the snapshot is too recent
+func (w *customersWidget) compareGrowthWith(previous *CustomerSnapshot, now time.Time) {
+	if w.baseline().short(previous.Timestamp, now) {
+		return
+	}
+
+	w.GrowthComparedAt = previous.Timestamp
+	w.GrowthRate, w.GrowthDefined = growthPercent(float64(previous.TotalCustomers), float64(w.TotalCustomers))
+}
+
+// growthRateValue returns the growth rate stored in snapshots, nil while it's
+// unavailable
+func (w *customersWidget) growthRateValue() *float64 {
+	if !w.GrowthDefined {
+		return nil
+	}
+
+	rate := w.GrowthRate
+	return &rate
+}
+
+// baseline returns the parsed growth-baseline, the default for widgets that
+// weren't initialized from a config
+func (w *customersWidget) baseline() growthBaseline {
+	if w.growthBaseline.kind == "" {
+		return defaultGrowthBaseline
+	}
+
+	return w.growthBaseline
+}
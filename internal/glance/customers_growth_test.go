@@ -0,0 +1,109 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCustomersWidget_UpdateGrowth(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.May, 20, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	for _, snapshot := range []*CustomerSnapshot{
+		{Timestamp: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), TotalCustomers: 50},
+		{Timestamp: time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC), TotalCustomers: 80},
+		{Timestamp: time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC), TotalCustomers: 90},
+		{Timestamp: now.Add(-time.Hour), TotalCustomers: 99},
+	} {
+		snapshot.Mode = "test"
+		db.SaveCustomerSnapshot(ctx, snapshot)
+	}
+
+	tests := []struct {
+		baseline    string
+		wantGrowth  float64
+		wantDefined bool
+	}{
+		{baseline: "previous-update", wantGrowth: 1.0101, wantDefined: true},
+		{baseline: "30d", wantGrowth: 25, wantDefined: true},
+		{baseline: "start-of-month", wantGrowth: 11.1111, wantDefined: true},
+		{baseline: "start-of-year", wantGrowth: 100, wantDefined: true},
+		// Only four and a half months of history
+		{baseline: "365d", wantDefined: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseline, func(t *testing.T) {
+			baseline, err := parseGrowthBaseline(tt.baseline)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			w := &customersWidget{StripeMode: "test", TotalCustomers: 100, NewCustomers: 12, ChurnedCustomers: 4, growthBaseline: baseline}
+			w.updateGrowth(ctx, db, now)
+
+			if w.GrowthDefined != tt.wantDefined || !floatEquals(w.GrowthRate, tt.wantGrowth, 0.001) {
+				t.Errorf("expected growth rate %v (defined %v), got %v (defined %v)", tt.wantGrowth, tt.wantDefined, w.GrowthRate, w.GrowthDefined)
+			}
+
+			if w.NetGrowth != 8 {
+				t.Errorf("expected net growth 8, got %d", w.NetGrowth)
+			}
+
+			if w.GrowthBaselineLabel != baseline.label() {
+				t.Errorf("expected label %q, got %q", baseline.label(), w.GrowthBaselineLabel)
+			}
+		})
+	}
+}
+
+func TestCustomersWidget_GrowthUnavailableOnNewInstalls(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.May, 20, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	w := &customersWidget{StripeMode: "test", TotalCustomers: 500, NewCustomers: 3, ChurnedCustomers: 5}
+
+	w.updateGrowth(ctx, db, now)
+	if w.GrowthDefined || w.NetGrowth != -2 {
+		t.Errorf("expected no growth rate without history and net growth -2, got %v (defined %v) and %d", w.GrowthRate, w.GrowthDefined, w.NetGrowth)
+	}
+
+	// A first snapshot of a handful of customers an hour ago would be a
+	// growth of thousands of percent
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: now.Add(-time.Hour), TotalCustomers: 2, Mode: "test"})
+	w.updateGrowth(ctx, db, now)
+	if w.GrowthDefined || w.growthRateValue() != nil {
+		t.Errorf("expected the growth rate to be unavailable with an hour of history, got %v", w.GrowthRate)
+	}
+
+	w.updateGrowth(ctx, db, now.AddDate(0, 0, 30))
+	if !w.GrowthDefined || !floatEquals(*w.growthRateValue(), 24900, 0.001) {
+		t.Errorf("expected the growth rate once there are 30 days of history, got %v (defined %v)", w.GrowthRate, w.GrowthDefined)
+	}
+
+	w.updateGrowth(ctx, nil, now)
+	if w.GrowthDefined {
+		t.Error("expected no growth rate without the metrics database")
+	}
+}
+
+func TestSimpleMetricsDB_KeepsCustomerSnapshotWithNewGrowthRate(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	db.SetDeduplication(time.Hour, 0)
+	now := time.Now()
+
+	growth := 10.0
+	for i, rate := range []*float64{nil, &growth} {
+		db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: now.Add(time.Duration(i) * time.Minute), TotalCustomers: 10, GrowthRate: rate, Mode: "live"})
+	}
+
+	stats, _ := db.GetDatabaseStats(ctx)
+	if stats.CustomerMetricsCount != 2 {
+		t.Errorf("expected a changed growth rate not to be skipped as a duplicate, got %d snapshots", stats.CustomerMetricsCount)
+	}
+	db.Close()
+}
@@ -0,0 +1,65 @@
+package glance
+
+import (
+	"context"
+	"time"
+)
+
+// Where the total of the customers widget comes from, shown next to it
+const (
+	customerCountSourceWebhook = "live (webhook)"
+	customerCountSourceScanned = "scanned"
+)
+
+// webhooksConfigured returns whether Stripe webhooks of mode are received,
+// which the customer.created and customer.deleted counts of incremental
+// counting rely on
+func webhooksConfigured(mode string) bool {
+	for _, secret := range stripeWebhookSecrets() {
+		if secret.Mode == "" || secret.Mode == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// incrementalCustomerCount returns the last exact count adjusted by the
+// customer webhook events received since it was taken
+func incrementalCustomerCount(baseline *CustomerCountBaseline) int {
+	return max(0, baseline.TotalCustomers+baseline.CreatedSince-baseline.DeletedSince)
+}
+
+// countCustomersIncrementally returns the total kept from webhooks since the
+// last exact count, which the nightly job reconciles. The customers are listed
+// instead, and returned, when webhooks aren't configured or to seed the count
+// the first time.
+func (w *customersWidget) countCustomersIncrementally(ctx context.Context, client *StripeClientWrapper) (int, *listedCustomers, error) {
+	if !webhooksConfigured(w.StripeMode) {
+		listed, err := w.listCustomersWithRetry(ctx, client)
+		w.CountSource = customerCountSourceScanned
+		w.LastExactCountAt = time.Time{}
+		return 0, listed, err
+	}
+
+	db, err := GetMetricsDatabase("")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	baseline, err := db.GetCustomerBaseline(ctx, w.metricsKey())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if baseline == nil {
+		listed, err := w.recordExactCount(ctx, client)
+		w.CountSource = customerCountSourceScanned
+		w.LastExactCountAt = time.Now()
+		return 0, listed, err
+	}
+
+	w.CountSource = customerCountSourceWebhook
+	w.LastExactCountAt = baseline.Timestamp
+	return incrementalCustomerCount(baseline), nil, nil
+}
@@ -0,0 +1,105 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestIncrementalCustomerCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseline CustomerCountBaseline
+		expected int
+	}{
+		{"no events", CustomerCountBaseline{TotalCustomers: 40000}, 40000},
+		{"created and deleted", CustomerCountBaseline{TotalCustomers: 40000, CreatedSince: 25, DeletedSince: 3}, 40022},
+		{"more deletions than customers", CustomerCountBaseline{TotalCustomers: 1, DeletedSince: 3}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := incrementalCustomerCount(&tt.baseline); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCustomersWidget_CountCustomersIncrementally(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	takenAt := time.Now().Add(-6 * time.Hour).Truncate(time.Second)
+	db.SaveCustomerBaseline(ctx, "test", 100, takenAt)
+
+	customer := func(raw string) stripe.Event {
+		return stripe.Event{Type: "customer.created", Data: &stripe.EventData{Raw: json.RawMessage(raw)}}
+	}
+	for _, event := range []stripe.Event{
+		customer(`{"id": "cus_1"}`),
+		customer(`{"id": "cus_2"}`),
+		// Customers on a test clock are left out of the counts
+		customer(`{"id": "cus_3", "test_clock": "clock_1"}`),
+	} {
+		if err := handleCustomerCreated(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := handleCustomerDeleted(ctx, stripe.Event{Type: "customer.deleted", Data: &stripe.EventData{Raw: json.RawMessage(`{"id": "cus_0"}`)}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := &customersWidget{StripeMode: "test"}
+	total, listed, err := w.countCustomersIncrementally(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if total != 101 || listed != nil {
+		t.Errorf("expected 101 customers without listing them, got %d", total)
+	}
+
+	if w.CountSource != customerCountSourceWebhook || !w.LastExactCountAt.Equal(takenAt) {
+		t.Errorf("expected the count to be from webhooks since %v, got %q since %v", takenAt, w.CountSource, w.LastExactCountAt)
+	}
+}
+
+func TestCustomersWidget_CountCustomersIncrementallyWithoutWebhooks(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "")
+
+	client := newStripeClientWrapper("sk_test_incremental", "test")
+	client.customers = fakeCustomerLister{{ID: "cus_1"}, {ID: "cus_2", Delinquent: true}}
+
+	w := &customersWidget{StripeMode: "test", LastExactCountAt: time.Now()}
+	_, listed, err := w.countCustomersIncrementally(ctx, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if listed == nil || len(listed.Countries) != 2 || len(listed.Delinquent) != 1 || w.CountSource != customerCountSourceScanned || !w.LastExactCountAt.IsZero() {
+		t.Errorf("expected the customers to be listed without webhooks, got %+v from %q", listed, w.CountSource)
+	}
+}
+
+// fakeCustomerLister lists fixed customers instead of the ones of a Stripe
+// account
+type fakeCustomerLister []*stripe.Customer
+
+func (l fakeCustomerLister) listCustomers(params *stripe.CustomerListParams, fn func(c *stripe.Customer) bool) error {
+	for _, c := range l {
+		if !fn(c) {
+			break
+		}
+	}
+
+	return nil
+}
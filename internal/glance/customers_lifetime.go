@@ -0,0 +1,54 @@
+package glance
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// averageDaysPerMonth converts subscription ages to months
+const averageDaysPerMonth = 365.25 / 12
+
+// modelLifetimeMonths returns how many months a customer stays on average at
+// a monthly churn rate in percent, 1 / churn rate, or infinite without churn
+func modelLifetimeMonths(monthlyChurnRate float64) (months float64, infinite bool) {
+	if monthlyChurnRate <= 0 {
+		return 0, true
+	}
+
+	return 100 / monthlyChurnRate, false
+}
+
+// actualLifetimeMonths returns the mean age in months of the active
+// subscriptions of scan at now, false without any
+func actualLifetimeMonths(scan *subscriptionScan, now time.Time) (float64, bool) {
+	var total time.Duration
+	var count int
+	scan.withStatus(func(sub *stripe.Subscription) {
+		if age := now.Sub(time.Unix(sub.Created, 0)); age > 0 {
+			total += age
+		}
+		count++
+	}, stripe.SubscriptionStatusActive)
+
+	if count == 0 {
+		return 0, false
+	}
+
+	return total.Hours() / 24 / averageDaysPerMonth / float64(count), true
+}
+
+// updateLifetime sets the average customer lifetime modeled from the churn
+// rate, and the actual mean age of the active subscriptions. Without active
+// customers neither is defined.
+func (w *customersWidget) updateLifetime(scan *subscriptionScan, now time.Time) {
+	w.AverageLifetimeMonths, w.AverageLifetimeInfinite, w.AverageLifetimeDefined = 0, false, false
+	w.ActualLifetimeMonths, w.ActualLifetimeDefined = 0, false
+	if scan == nil || w.ActiveCustomers == 0 {
+		return
+	}
+
+	w.AverageLifetimeMonths, w.AverageLifetimeInfinite = modelLifetimeMonths(w.churnWindow.perMonth(w.ChurnRate))
+	w.AverageLifetimeDefined = true
+	w.ActualLifetimeMonths, w.ActualLifetimeDefined = actualLifetimeMonths(scan, now)
+}
@@ -0,0 +1,65 @@
+package glance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestModelLifetimeMonths(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		months   float64
+		infinite bool
+	}{
+		{rate: 5, months: 20},
+		{rate: 100, months: 1},
+		{rate: 0, infinite: true},
+	}
+
+	for _, tt := range tests {
+		months, infinite := modelLifetimeMonths(tt.rate)
+		if infinite != tt.infinite || !floatEquals(months, tt.months, 0.001) {
+			t.Errorf("rate %v: expected %v months (infinite %v), got %v (infinite %v)", tt.rate, tt.months, tt.infinite, months, infinite)
+		}
+	}
+}
+
+func TestCustomersWidget_UpdateLifetime(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	created := func(days int) int64 {
+		return now.AddDate(0, 0, -days).Unix()
+	}
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{
+		{ID: "sub_1", Status: stripe.SubscriptionStatusActive, Created: created(365)},
+		{ID: "sub_2", Status: stripe.SubscriptionStatusActive, Created: created(0)},
+		{ID: "sub_3", Status: stripe.SubscriptionStatusTrialing, Created: created(3650)},
+	}}
+
+	// A 90 day churn rate of 15% is 5% a month
+	window, _ := parseChurnWindow("90d")
+	w := &customersWidget{ActiveCustomers: 2, ChurnRate: 15, churnWindow: window}
+	w.updateLifetime(scan, now)
+
+	if !w.AverageLifetimeDefined || w.AverageLifetimeInfinite || !floatEquals(w.AverageLifetimeMonths, 20, 0.001) {
+		t.Errorf("expected a modeled lifetime of 20 months, got %v", w.AverageLifetimeMonths)
+	}
+
+	if !w.ActualLifetimeDefined || !floatEquals(w.ActualLifetimeMonths, 6, 0.01) {
+		t.Errorf("expected an actual lifetime of 6 months, got %v", w.ActualLifetimeMonths)
+	}
+
+	w.ChurnRate = 0
+	w.updateLifetime(scan, now)
+	if !w.AverageLifetimeInfinite {
+		t.Error("expected an infinite lifetime without churn")
+	}
+
+	w.ActiveCustomers = 0
+	w.updateLifetime(&subscriptionScan{}, now)
+	if w.AverageLifetimeDefined || w.ActualLifetimeDefined {
+		t.Error("expected no lifetime without active customers")
+	}
+}
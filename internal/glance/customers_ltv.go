@@ -0,0 +1,84 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// Where the average revenue per customer the LTV is computed from came from,
+// shown with the LTV
+const (
+	ltvSourceStoredMRR    = "stored MRR"
+	ltvSourceScannedMRR   = "subscriptions"
+	ltvSourceFallbackARPU = "fallback-arpu"
+)
+
+// averageRevenuePerCustomer returns the MRR per active customer and where the
+// MRR came from: the latest revenue snapshot, the active subscriptions of
+// scan, or the configured fallback-arpu. Returns false when none is
+// available rather than making one up.
+func (w *customersWidget) averageRevenuePerCustomer(ctx context.Context, db *SimpleMetricsDB, scan *subscriptionScan, scanErr error) (float64, string, bool) {
+	if db != nil {
+		revenueSnapshot, err := db.GetLatestRevenue(ctx, w.metricsKey())
+		if errors.Is(err, ErrNoSnapshot) {
+			slog.Debug("No revenue snapshot stored yet, calculating MRR for LTV from Stripe")
+		} else if err != nil {
+			slog.Error("Failed to get latest revenue snapshot", "error", err)
+		}
+
+		if err == nil && revenueSnapshot.MRR > 0 {
+			return revenueSnapshot.MRR / float64(w.ActiveCustomers), ltvSourceStoredMRR, true
+		}
+	}
+
+	err := scanErr
+	if scan != nil {
+		var currentMRR float64
+		currentMRR, err = calculateCurrentMRR(ctx, scan, scanErr)
+		if err == nil && currentMRR > 0 {
+			return currentMRR / float64(w.ActiveCustomers), ltvSourceScannedMRR, true
+		}
+	}
+
+	if w.FallbackARPU > 0 {
+		slog.Warn("Using fallback-arpu for the LTV, as no MRR is available",
+			"mode", w.StripeMode,
+			"source", ltvSourceFallbackARPU,
+			"fallback_arpu", w.FallbackARPU,
+			"error", err)
+		return w.FallbackARPU, ltvSourceFallbackARPU, true
+	}
+
+	slog.Warn("Leaving the LTV out, as no MRR is available and fallback-arpu isn't set",
+		"mode", w.StripeMode,
+		"error", err)
+	return 0, "", false
+}
+
+// updateLTV sets the LTV, the average revenue per customer over the monthly
+// churn rate. Without churn it's left out, as is it without revenue data,
+// flagged with LTVUnavailable.
+func (w *customersWidget) updateLTV(ctx context.Context, db *SimpleMetricsDB, scan *subscriptionScan, scanErr error) {
+	w.LTV, w.LTVSource, w.LTVUnavailable = 0, "", false
+	if w.ActiveCustomers == 0 || w.ChurnRate <= 0 {
+		return
+	}
+
+	avgRevenuePerCustomer, source, ok := w.averageRevenuePerCustomer(ctx, db, scan, scanErr)
+	if !ok {
+		w.LTVUnavailable = true
+		return
+	}
+
+	slog.Debug("Calculated LTV",
+		"source", source,
+		"active_customers", w.ActiveCustomers,
+		"avg_revenue", avgRevenuePerCustomer)
+
+	monthlyChurnRate := w.churnWindow.perMonth(w.ChurnRate) / 100.0
+	if monthlyChurnRate > 0 {
+		w.LTV = avgRevenuePerCustomer / monthlyChurnRate
+		w.LTVSource = source
+	}
+}
@@ -0,0 +1,65 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCustomersWidget_UpdateLTV(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	storedDB := newSimpleMetricsDB()
+	storedDB.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now(), MRR: 2000, Mode: "test"})
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{{
+		Customer: &stripe.Customer{ID: "cus_1"},
+		Status:   stripe.SubscriptionStatusActive,
+		Currency: "usd",
+		Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+			Quantity: 1,
+			Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: 50000, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+		}}},
+	}}}
+	scanErr := errors.New("rate limited")
+
+	tests := []struct {
+		name            string
+		db              *SimpleMetricsDB
+		scan            *subscriptionScan
+		scanErr         error
+		fallbackARPU    float64
+		wantLTV         float64
+		wantSource      string
+		wantUnavailable bool
+	}{
+		{name: "stored MRR", db: storedDB, scan: scan, wantLTV: 8000, wantSource: ltvSourceStoredMRR},
+		{name: "listed subscriptions", db: newSimpleMetricsDB(), scan: scan, wantLTV: 2000, wantSource: ltvSourceScannedMRR},
+		{name: "fallback-arpu", scanErr: scanErr, fallbackARPU: 80, wantLTV: 1600, wantSource: ltvSourceFallbackARPU},
+		{name: "no revenue data", scanErr: scanErr, wantUnavailable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 5 active customers, 5% monthly churn
+			w := &customersWidget{StripeMode: "test", ActiveCustomers: 5, ChurnRate: 5, FallbackARPU: tt.fallbackARPU}
+			w.updateLTV(ctx, tt.db, tt.scan, tt.scanErr)
+
+			if !floatEquals(w.LTV, tt.wantLTV, 0.001) || w.LTVSource != tt.wantSource || w.LTVUnavailable != tt.wantUnavailable {
+				t.Errorf("expected LTV %v from %q (unavailable %v), got %v from %q (unavailable %v)",
+					tt.wantLTV, tt.wantSource, tt.wantUnavailable, w.LTV, w.LTVSource, w.LTVUnavailable)
+			}
+		})
+	}
+
+	// Without churn the LTV is left out, but there's revenue data
+	w := &customersWidget{StripeMode: "test", ActiveCustomers: 5, LTV: 100}
+	w.updateLTV(ctx, storedDB, scan, nil)
+	if w.LTV != 0 || w.LTVUnavailable {
+		t.Errorf("expected no LTV without churn, got %v (unavailable %v)", w.LTV, w.LTVUnavailable)
+	}
+}
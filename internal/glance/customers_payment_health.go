@@ -0,0 +1,62 @@
+package glance
+
+import (
+	"context"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// paymentHealth is the number of customers with an active subscription that
+// has nothing to charge, and the MRR of those subscriptions in the reporting
+// currency
+type paymentHealth struct {
+	Customers int
+	MRR       float64
+}
+
+// missingPaymentMethod returns whether Stripe has nothing to charge for sub:
+// it's charged automatically, but neither it nor its customer has a default
+// payment method or source. Needs the customer expanded, as on the
+// subscription scan.
+func missingPaymentMethod(sub *stripe.Subscription) bool {
+	// Customers paying invoices by bank transfer don't need one
+	if sub.CollectionMethod == stripe.SubscriptionCollectionMethodSendInvoice {
+		return false
+	}
+
+	if sub.DefaultPaymentMethod != nil || sub.DefaultSource != nil {
+		return false
+	}
+
+	c := sub.Customer
+	if c == nil || c.Deleted {
+		return false
+	}
+
+	if c.InvoiceSettings != nil && c.InvoiceSettings.DefaultPaymentMethod != nil {
+		return false
+	}
+
+	return c.DefaultSource == nil
+}
+
+// countMissingPaymentMethods counts the customers of active subscriptions
+// without a payment method and sums their MRR, leaving paused subscriptions
+// out as they aren't charged
+func countMissingPaymentMethods(ctx context.Context, scan *subscriptionScan, converter *CurrencyConverter, now time.Time) paymentHealth {
+	resolver := newPriceResolver(ctx)
+	customers := make(map[string]bool)
+	amounts := make(currencyAmounts)
+
+	scan.withStatus(func(sub *stripe.Subscription) {
+		if subscriptionPaused(sub, now) || !missingPaymentMethod(sub) {
+			return
+		}
+
+		customers[sub.Customer.ID] = true
+		amounts.addSubscription(sub, resolver)
+	}, stripe.SubscriptionStatusActive)
+
+	return paymentHealth{Customers: len(customers), MRR: converter.Convert(ctx, amounts).Total}
+}
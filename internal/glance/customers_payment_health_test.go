@@ -0,0 +1,74 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestMissingPaymentMethod(t *testing.T) {
+	withDefault := &stripe.CustomerInvoiceSettings{DefaultPaymentMethod: &stripe.PaymentMethod{ID: "pm_1"}}
+
+	tests := []struct {
+		name     string
+		sub      *stripe.Subscription
+		expected bool
+	}{
+		{"customer default payment method", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", InvoiceSettings: withDefault}}, false},
+		{"customer default source", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", DefaultSource: &stripe.PaymentSource{ID: "card_1"}}}, false},
+		{"subscription default payment method", &stripe.Subscription{DefaultPaymentMethod: &stripe.PaymentMethod{ID: "pm_1"}, Customer: &stripe.Customer{ID: "cus_1"}}, false},
+		{"nothing to charge", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", InvoiceSettings: &stripe.CustomerInvoiceSettings{}}}, true},
+		{"paid by invoice", &stripe.Subscription{CollectionMethod: stripe.SubscriptionCollectionMethodSendInvoice, Customer: &stripe.Customer{ID: "cus_1"}}, false},
+		{"deleted customer", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", Deleted: true}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingPaymentMethod(tt.sub); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountMissingPaymentMethods(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	sub := func(customer string, status stripe.SubscriptionStatus, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       "sub_" + customer,
+			Customer: &stripe.Customer{ID: customer},
+			Status:   status,
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: amount, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+			}}},
+		}
+	}
+
+	paid := sub("cus_paid", stripe.SubscriptionStatusActive, 9000)
+	paid.Customer.InvoiceSettings = &stripe.CustomerInvoiceSettings{DefaultPaymentMethod: &stripe.PaymentMethod{ID: "pm_1"}}
+	paused := sub("cus_paused", stripe.SubscriptionStatusActive, 7000)
+	paused.PauseCollection = &stripe.SubscriptionPauseCollection{Behavior: "void"}
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{
+		sub("cus_1", stripe.SubscriptionStatusActive, 2000),
+		// Both subscriptions of a customer count toward the MRR but the
+		// customer once
+		sub("cus_1", stripe.SubscriptionStatusActive, 500),
+		sub("cus_2", stripe.SubscriptionStatusActive, 1000),
+		sub("cus_trial", stripe.SubscriptionStatusTrialing, 3000),
+		paid,
+		paused,
+	}}
+
+	health := countMissingPaymentMethods(ctx, scan, GetCurrencyConverter(), now)
+	if health.Customers != 2 || !floatEquals(health.MRR, 35, 0.001) {
+		t.Errorf("expected 2 customers with 35 MRR, got %d with %v", health.Customers, health.MRR)
+	}
+}
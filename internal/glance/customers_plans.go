@@ -0,0 +1,174 @@
+package glance
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const defaultTopPlans = 5
+
+// planCustomers is the number of customers of a price: active, started on it
+// this month and churned from it over the churn window, with the churn rate
+// as a percentage of the plan's customers over the window
+type planCustomers struct {
+	PriceID   string
+	ProductID string
+	// Product name followed by the price nickname when there is one
+	Name      string
+	Active    int
+	New       int
+	Churned   int
+	ChurnRate float64
+	// Other groups the plans outside of the top plans
+	Other bool
+}
+
+// planCounts collects the distinct customers of each price
+type planCounts struct {
+	active   map[string]subscriptionCustomers
+	started  map[string]subscriptionCustomers
+	churned  map[string]subscriptionCustomers
+	prices   map[string]*stripe.Price
+	products map[string]string
+}
+
+func newPlanCounts() *planCounts {
+	return &planCounts{
+		active:   make(map[string]subscriptionCustomers),
+		started:  make(map[string]subscriptionCustomers),
+		churned:  make(map[string]subscriptionCustomers),
+		prices:   make(map[string]*stripe.Price),
+		products: make(map[string]string),
+	}
+}
+
+// add counts the customer of sub toward each price of its recurring items
+func (p *planCounts) add(counts map[string]subscriptionCustomers, sub *stripe.Subscription) {
+	if sub.Items == nil || sub.Customer == nil {
+		return
+	}
+
+	for _, item := range sub.Items.Data {
+		if item.Price == nil || item.Price.Recurring == nil {
+			continue
+		}
+
+		id := item.Price.ID
+		p.prices[id] = item.Price
+		if item.Price.Product != nil && item.Price.Product.Name != "" {
+			p.products[item.Price.Product.ID] = item.Price.Product.Name
+		}
+
+		if counts[id] == nil {
+			counts[id] = make(subscriptionCustomers)
+		}
+		counts[id].add(sub)
+	}
+}
+
+// countPlans groups the customers of the subscriptions of scan by price: the
+// ones with an active subscription, the ones whose subscription started this
+// month and the ones of the subscriptions canceled since churnSince
+func countPlans(scan *subscriptionScan, churnSince time.Time) *planCounts {
+	counts := newPlanCounts()
+	startOfMonth := scan.StartOfMonth.Unix()
+
+	scan.withStatus(func(sub *stripe.Subscription) {
+		counts.add(counts.active, sub)
+		if sub.Created >= startOfMonth {
+			counts.add(counts.started, sub)
+		}
+	}, stripe.SubscriptionStatusActive)
+
+	for _, sub := range scan.canceledSince(churnSince) {
+		counts.add(counts.churned, sub)
+	}
+
+	return counts
+}
+
+// planBreakdown returns the limit plans with the most active customers,
+// followed by the rest of the plans grouped together. Plans are named after
+// their product, whose name names resolves when it wasn't expanded.
+func planBreakdown(counts *planCounts, limit int, names func(productID string) string) []planCustomers {
+	plans := make([]planCustomers, 0, len(counts.prices))
+	for id, price := range counts.prices {
+		plans = append(plans, planCustomers{
+			PriceID: id,
+			Active:  len(counts.active[id]),
+			New:     len(counts.started[id]),
+			Churned: len(counts.churned[id]),
+		})
+
+		if price.Product != nil {
+			plans[len(plans)-1].ProductID = price.Product.ID
+		}
+	}
+
+	slices.SortFunc(plans, func(a, b planCustomers) int {
+		return cmp.Or(cmp.Compare(b.Active, a.Active), cmp.Compare(b.Churned, a.Churned), strings.Compare(a.PriceID, b.PriceID))
+	})
+
+	if len(plans) > limit {
+		other := planCustomers{Name: "Other", Other: true}
+		for _, rest := range plans[limit:] {
+			other.Active += rest.Active
+			other.New += rest.New
+			other.Churned += rest.Churned
+		}
+		plans = append(plans[:limit], other)
+	}
+
+	for i := range plans {
+		p := &plans[i]
+		if during := p.Active + p.Churned; during > 0 {
+			p.ChurnRate = float64(p.Churned) / float64(during) * 100
+		}
+
+		if p.Other {
+			continue
+		}
+
+		p.Name = planName(counts, p, names)
+	}
+
+	return plans
+}
+
+func planName(counts *planCounts, p *planCustomers, names func(productID string) string) string {
+	name := "No product"
+	if p.ProductID != "" {
+		name = counts.products[p.ProductID]
+		if name == "" {
+			name = names(p.ProductID)
+		}
+	}
+
+	if nickname := counts.prices[p.PriceID].Nickname; nickname != "" {
+		name += " · " + nickname
+	}
+
+	return name
+}
+
+// updatePlans sets the per-plan breakdown from the subscriptions of scan,
+// looking up the names of products once for the lifetime of the widget
+func (w *customersWidget) updatePlans(ctx context.Context, client *StripeClientWrapper, scan *subscriptionScan, churnSince time.Time) {
+	w.Plans = nil
+	if scan == nil {
+		return
+	}
+
+	if w.productNames == nil {
+		w.productNames = make(productNameCache)
+	}
+
+	w.Plans = planBreakdown(countPlans(scan, churnSince), w.TopPlans, func(productID string) string {
+		return w.productNames.lookup(ctx, client, productID)
+	})
+}
@@ -0,0 +1,78 @@
+package glance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestPlanBreakdown(t *testing.T) {
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	lastYear := startOfMonth.AddDate(-1, 0, 0).Unix()
+
+	starter := &stripe.Price{ID: "price_starter", Product: &stripe.Product{ID: "prod_starter", Name: "Starter"}, Recurring: &stripe.PriceRecurring{Interval: "month"}}
+	enterprise := &stripe.Price{ID: "price_enterprise", Nickname: "Annual", Product: &stripe.Product{ID: "prod_enterprise"}, Recurring: &stripe.PriceRecurring{Interval: "year"}}
+	legacy := &stripe.Price{ID: "price_legacy", Product: &stripe.Product{ID: "prod_legacy", Name: "Legacy"}, Recurring: &stripe.PriceRecurring{Interval: "month"}}
+	oneTime := &stripe.Price{ID: "price_setup", Product: &stripe.Product{ID: "prod_setup", Name: "Setup"}}
+
+	sub := func(customer string, status stripe.SubscriptionStatus, created int64, prices ...*stripe.Price) *stripe.Subscription {
+		s := &stripe.Subscription{Customer: &stripe.Customer{ID: customer}, Status: status, Created: created, Items: &stripe.SubscriptionItemList{}}
+		for _, price := range prices {
+			s.Items.Data = append(s.Items.Data, &stripe.SubscriptionItem{Price: price})
+		}
+		return s
+	}
+
+	scan := &subscriptionScan{StartOfMonth: startOfMonth}
+	for i := range 20 {
+		scan.Current = append(scan.Current, sub(fmt.Sprintf("cus_s%d", i), stripe.SubscriptionStatusActive, lastYear, starter))
+	}
+	// Two new starters, one of them with a second subscription on the same plan
+	scan.Current = append(scan.Current,
+		sub("cus_s0", stripe.SubscriptionStatusActive, startOfMonth.Unix(), starter),
+		sub("cus_new", stripe.SubscriptionStatusActive, startOfMonth.Unix(), starter, oneTime),
+	)
+	for i := range 3 {
+		scan.Current = append(scan.Current, sub(fmt.Sprintf("cus_e%d", i), stripe.SubscriptionStatusActive, lastYear, enterprise))
+	}
+	scan.Current = append(scan.Current, sub("cus_l0", stripe.SubscriptionStatusActive, lastYear, legacy))
+	// Not counted as active
+	scan.Current = append(scan.Current, sub("cus_trial", stripe.SubscriptionStatusTrialing, lastYear, legacy))
+
+	canceled := sub("cus_e3", stripe.SubscriptionStatusCanceled, lastYear, enterprise)
+	canceled.CanceledAt = startOfMonth.AddDate(0, 0, 5).Unix()
+	starterCanceled := sub("cus_s20", stripe.SubscriptionStatusCanceled, lastYear, starter)
+	starterCanceled.CanceledAt = startOfMonth.AddDate(0, 0, 6).Unix()
+	scan.Canceled = []*stripe.Subscription{canceled, starterCanceled}
+
+	var lookups []string
+	names := func(productID string) string {
+		lookups = append(lookups, productID)
+		return "Enterprise"
+	}
+
+	plans := planBreakdown(countPlans(scan, startOfMonth), 2, names)
+	if len(plans) != 3 {
+		t.Fatalf("expected 2 plans and Other, got %+v", plans)
+	}
+
+	expected := []planCustomers{
+		{PriceID: "price_starter", ProductID: "prod_starter", Name: "Starter", Active: 21, New: 2, Churned: 1, ChurnRate: 100.0 / 22},
+		{PriceID: "price_enterprise", ProductID: "prod_enterprise", Name: "Enterprise · Annual", Active: 3, Churned: 1, ChurnRate: 25},
+		{Name: "Other", Active: 1, Other: true},
+	}
+
+	for i, want := range expected {
+		got := plans[i]
+		if got.PriceID != want.PriceID || got.ProductID != want.ProductID || got.Name != want.Name || got.Other != want.Other ||
+			got.Active != want.Active || got.New != want.New || got.Churned != want.Churned || !floatEquals(got.ChurnRate, want.ChurnRate, 0.001) {
+			t.Errorf("plan %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	if len(lookups) != 1 || lookups[0] != "prod_enterprise" {
+		t.Errorf("expected only the product without an expanded name to be looked up, got %v", lookups)
+	}
+}
@@ -0,0 +1,55 @@
+package glance
+
+import (
+	"context"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// scanStartMRR estimates MRR at start from the subscriptions of scan: the
+// active ones created before it, and the ones canceled since that were
+// created before it. Plan changes since start aren't known, so it's only used
+// without a revenue snapshot from then.
+func scanStartMRR(scan *subscriptionScan, start time.Time, resolver *priceResolver) currencyAmounts {
+	amounts := make(currencyAmounts)
+	scan.withStatus(func(sub *stripe.Subscription) {
+		if sub.Created < start.Unix() {
+			amounts.addSubscription(sub, resolver)
+		}
+	}, stripe.SubscriptionStatusActive)
+
+	for _, sub := range scan.canceledSince(start) {
+		if sub.Created < start.Unix() {
+			amounts.addSubscription(sub, resolver)
+		}
+	}
+
+	return amounts
+}
+
+// updateRevenueChurn sets the MRR churned in the churn window and the revenue
+// churn rate against MRR at its start, the same window as the logo churn
+// rate. MRR at the start comes from the revenue snapshots when stored, or
+// otherwise from the subscriptions of scan.
+func (w *customersWidget) updateRevenueChurn(ctx context.Context, db *SimpleMetricsDB, scan *subscriptionScan, now time.Time) {
+	w.ChurnedMRR, w.RevenueChurnRate, w.RevenueChurnDefined = 0, 0, false
+	if scan == nil {
+		return
+	}
+
+	converter := GetCurrencyConverter()
+	resolver := newPriceResolver(ctx)
+	start := w.churnWindow.start(now)
+	w.ChurnedMRR = converter.Convert(ctx, calculateChurnedMRR(scan.canceledSince(start), resolver)).Total
+
+	startMRR, ok := 0.0, false
+	if db != nil {
+		startMRR, ok = churnWindowStartMRR(ctx, db, w.metricsKey(), w.churnWindow, now)
+	}
+	if !ok {
+		startMRR = converter.Convert(ctx, scanStartMRR(scan, start, resolver)).Total
+	}
+
+	w.RevenueChurnRate, w.RevenueChurnDefined = grossRevenueChurnRate(w.ChurnedMRR, startMRR)
+}
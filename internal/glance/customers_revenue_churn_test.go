@@ -0,0 +1,77 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCustomersWidget_RevenueChurnOfOneBigCustomer(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	now := time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC)
+	lastYear := now.AddDate(-1, 0, 0).Unix()
+
+	sub := func(customer string, status stripe.SubscriptionStatus, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       "sub_" + customer,
+			Customer: &stripe.Customer{ID: customer},
+			Status:   status,
+			Created:  lastYear,
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: amount, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+			}}},
+		}
+	}
+
+	// 19 customers paying $100 stay, the one paying $5,000 churns
+	scan := &subscriptionScan{StartOfMonth: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)}
+	for i := range 19 {
+		scan.Current = append(scan.Current, sub(fmt.Sprintf("cus_%d", i), stripe.SubscriptionStatusActive, 10000))
+	}
+	big := sub("cus_big", stripe.SubscriptionStatusCanceled, 500000)
+	big.CanceledAt = time.Date(2026, time.April, 10, 0, 0, 0, 0, time.UTC).Unix()
+	scan.Canceled = []*stripe.Subscription{big}
+	// Started this month, so not part of MRR at its start
+	scan.Current = append(scan.Current, sub("cus_new", stripe.SubscriptionStatusActive, 10000))
+	scan.Current[len(scan.Current)-1].Created = now.Unix()
+
+	w := &customersWidget{StripeMode: "test", TotalCustomers: 20, ChurnedCustomers: 1}
+	w.ChurnRate = float64(w.ChurnedCustomers) / float64(w.TotalCustomers) * 100
+
+	t.Run("estimated from the subscriptions", func(t *testing.T) {
+		w.updateRevenueChurn(ctx, newSimpleMetricsDB(), scan, now)
+
+		// $5,000 of $6,900
+		if !w.RevenueChurnDefined || !floatEquals(w.RevenueChurnRate, 72.46, 0.01) || !floatEquals(w.ChurnedMRR, 5000, 0.001) {
+			t.Errorf("expected a revenue churn of 72.46%%, got %v%% of %v", w.RevenueChurnRate, w.ChurnedMRR)
+		}
+
+		if w.ChurnRate != 5 || w.RevenueChurnRate < 10*w.ChurnRate {
+			t.Errorf("expected a low logo churn next to a high revenue churn, got %v%% and %v%%", w.ChurnRate, w.RevenueChurnRate)
+		}
+	})
+
+	t.Run("from the revenue snapshot at the start of the month", func(t *testing.T) {
+		db := newSimpleMetricsDB()
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC), MRR: 8000, Mode: "test"})
+
+		w.updateRevenueChurn(ctx, db, scan, now)
+		if !w.RevenueChurnDefined || !floatEquals(w.RevenueChurnRate, 62.5, 0.001) {
+			t.Errorf("expected a revenue churn of 62.5%%, got %v%%", w.RevenueChurnRate)
+		}
+	})
+
+	t.Run("without subscriptions", func(t *testing.T) {
+		w.updateRevenueChurn(ctx, nil, nil, now)
+		if w.RevenueChurnDefined || w.ChurnedMRR != 0 {
+			t.Error("expected no revenue churn without the subscriptions")
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package glance
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// metadataScore is the average of a numeric customer metadata field, such as
+// an NPS score, over the customers that have one
+type metadataScore struct {
+	Average   float64
+	Responses int
+}
+
+// metadataScoreValue returns the score of c under key, false when the key is
+// missing or the value isn't a number
+func metadataScoreValue(c *stripe.Customer, key string) (float64, bool) {
+	if c == nil || c.Deleted {
+		return 0, false
+	}
+
+	value, ok := c.Metadata[key]
+	if !ok {
+		return 0, false
+	}
+
+	score, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// averageMetadataScore averages the scores of customers under key, skipping
+// the ones without a score
+func averageMetadataScore(customers map[string]*stripe.Customer, key string) metadataScore {
+	var result metadataScore
+	total := 0.0
+	for _, c := range customers {
+		if score, ok := metadataScoreValue(c, key); ok {
+			total += score
+			result.Responses++
+		}
+	}
+
+	if result.Responses > 0 {
+		result.Average = total / float64(result.Responses)
+	}
+
+	return result
+}
+
+// activeSubscriptionCustomers returns the customers of the active
+// subscriptions of scan, expanded on the subscriptions, by ID
+func activeSubscriptionCustomers(scan *subscriptionScan) map[string]*stripe.Customer {
+	customers := make(map[string]*stripe.Customer)
+	scan.withStatus(func(sub *stripe.Subscription) {
+		if sub.Customer != nil {
+			customers[sub.Customer.ID] = sub.Customer
+		}
+	}, stripe.SubscriptionStatusActive)
+
+	return customers
+}
+
+// updateMetadataScore sets the average metadata-score-key of the retained
+// customers, the ones with an active subscription, and of the customers who
+// churned over the churn window. The scores are read from the customers
+// expanded on the subscriptions, with no extra API calls.
+func (w *customersWidget) updateMetadataScore(scan *subscriptionScan, churnSince time.Time) {
+	w.RetainedScore, w.ChurnedScore = metadataScore{}, metadataScore{}
+	if w.MetadataScoreKey == "" || scan == nil {
+		return
+	}
+
+	w.RetainedScore = averageMetadataScore(activeSubscriptionCustomers(scan), w.MetadataScoreKey)
+	w.ChurnedScore = averageMetadataScore(churnedCustomers(scan, scan.canceledSince(churnSince)), w.MetadataScoreKey)
+}
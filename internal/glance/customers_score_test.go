@@ -0,0 +1,66 @@
+package glance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCustomersWidget_UpdateMetadataScore(t *testing.T) {
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	canceledAt := startOfMonth.AddDate(0, 0, 3).Unix()
+
+	sub := func(id, score string, status stripe.SubscriptionStatus) *stripe.Subscription {
+		c := &stripe.Customer{ID: id}
+		if score != "" {
+			c.Metadata = map[string]string{"nps_score": score}
+		}
+
+		s := &stripe.Subscription{Customer: c, Status: status}
+		if status == stripe.SubscriptionStatusCanceled {
+			s.CanceledAt = canceledAt
+		}
+		return s
+	}
+
+	scan := &subscriptionScan{
+		StartOfMonth: startOfMonth,
+		Current: []*stripe.Subscription{
+			sub("cus_1", "9", stripe.SubscriptionStatusActive),
+			sub("cus_1", "9", stripe.SubscriptionStatusActive),
+			sub("cus_2", " 10 ", stripe.SubscriptionStatusActive),
+			sub("cus_3", "8", stripe.SubscriptionStatusActive),
+			// Skipped
+			sub("cus_4", "", stripe.SubscriptionStatusActive),
+			sub("cus_5", "great", stripe.SubscriptionStatusActive),
+			sub("cus_6", "NaN", stripe.SubscriptionStatusActive),
+			// Not retained
+			sub("cus_7", "0", stripe.SubscriptionStatusPastDue),
+		},
+		Canceled: []*stripe.Subscription{
+			sub("cus_8", "2", stripe.SubscriptionStatusCanceled),
+			sub("cus_9", "5", stripe.SubscriptionStatusCanceled),
+			sub("cus_10", "", stripe.SubscriptionStatusCanceled),
+			// Still has an active subscription
+			sub("cus_3", "8", stripe.SubscriptionStatusCanceled),
+		},
+	}
+
+	w := &customersWidget{MetadataScoreKey: "nps_score"}
+	w.updateMetadataScore(scan, startOfMonth)
+
+	if w.RetainedScore.Responses != 3 || !floatEquals(w.RetainedScore.Average, 9, 0.001) {
+		t.Errorf("expected a retained score of 9 from 3 responses, got %v from %d", w.RetainedScore.Average, w.RetainedScore.Responses)
+	}
+
+	if w.ChurnedScore.Responses != 2 || !floatEquals(w.ChurnedScore.Average, 3.5, 0.001) {
+		t.Errorf("expected a churned score of 3.5 from 2 responses, got %v from %d", w.ChurnedScore.Average, w.ChurnedScore.Responses)
+	}
+
+	w.MetadataScoreKey = ""
+	w.updateMetadataScore(scan, startOfMonth)
+	if w.RetainedScore.Responses != 0 || w.ChurnedScore.Responses != 0 {
+		t.Error("expected no score without metadata-score-key")
+	}
+}
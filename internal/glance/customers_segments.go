@@ -0,0 +1,121 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	customerSegmentBusiness = "business"
+	customerSegmentConsumer = "consumer"
+	// Customers without an email or with one that has no domain
+	customerSegmentUnknown = ""
+)
+
+// defaultFreeEmailProviders are the domains of free email providers, whose
+// customers are counted as consumers rather than businesses
+var defaultFreeEmailProviders = []string{
+	"gmail.com", "googlemail.com",
+	"yahoo.com", "yahoo.co.uk", "yahoo.fr", "yahoo.de", "yahoo.co.jp", "ymail.com", "rocketmail.com",
+	"outlook.com", "hotmail.com", "hotmail.co.uk", "hotmail.fr", "live.com", "msn.com",
+	"icloud.com", "me.com", "mac.com",
+	"aol.com",
+	"proton.me", "protonmail.com", "pm.me",
+	"gmx.com", "gmx.de", "gmx.net", "web.de", "t-online.de",
+	"mail.com", "zoho.com", "tutanota.com", "fastmail.com",
+	"yandex.com", "yandex.ru", "mail.ru",
+	"qq.com", "163.com", "126.com", "naver.com",
+}
+
+// freeEmailProviders is a set of lower case free email provider domains
+type freeEmailProviders map[string]bool
+
+// newFreeEmailProviders returns the built-in providers unless replaced, along
+// with the configured ones
+func newFreeEmailProviders(useDefaults bool, configured []string) (freeEmailProviders, error) {
+	providers := make(freeEmailProviders)
+	if useDefaults {
+		for _, domain := range defaultFreeEmailProviders {
+			providers[domain] = true
+		}
+	}
+
+	for _, domain := range configured {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+			return nil, fmt.Errorf("free-email-providers must be domains like example.com, got: %q", domain)
+		}
+
+		providers[domain] = true
+	}
+
+	return providers, nil
+}
+
+// segment returns whether an email address belongs to a business or a
+// consumer, or customerSegmentUnknown without a domain
+func (p freeEmailProviders) segment(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return customerSegmentUnknown
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	if domain == "" {
+		return customerSegmentUnknown
+	}
+
+	if p[domain] {
+		return customerSegmentConsumer
+	}
+
+	return customerSegmentBusiness
+}
+
+// customerSegments maps customer IDs to their segment
+type customerSegments map[string]string
+
+// segmentCustomers is the number of customers of a segment and the MRR of
+// their active subscriptions in the reporting currency
+type segmentCustomers struct {
+	Customers int
+	MRR       float64
+}
+
+// segmentBreakdown counts the customers of each segment along with the MRR of
+// their active subscriptions. Subscriptions of customers that weren't listed
+// are counted as unknown.
+func segmentBreakdown(ctx context.Context, segments customerSegments, scan *subscriptionScan, converter *CurrencyConverter) map[string]segmentCustomers {
+	breakdown := make(map[string]segmentCustomers)
+	for _, segment := range segments {
+		s := breakdown[segment]
+		s.Customers++
+		breakdown[segment] = s
+	}
+
+	for segment, amounts := range activeMRRByGroup(ctx, segments, scan) {
+		s := breakdown[segment]
+		s.MRR = converter.Convert(ctx, amounts).Total
+		breakdown[segment] = s
+	}
+
+	return breakdown
+}
+
+// updateSegments sets the business, consumer and unknown customers and their
+// MRR from the segments of the listed customers, or zeroes them when the
+// customers weren't listed
+func (w *customersWidget) updateSegments(ctx context.Context, segments customerSegments, scan *subscriptionScan) {
+	var breakdown map[string]segmentCustomers
+	if segments != nil {
+		breakdown = segmentBreakdown(ctx, segments, scan, GetCurrencyConverter())
+	}
+
+	w.BusinessCustomers = breakdown[customerSegmentBusiness].Customers
+	w.BusinessMRR = breakdown[customerSegmentBusiness].MRR
+	w.ConsumerCustomers = breakdown[customerSegmentConsumer].Customers
+	w.ConsumerMRR = breakdown[customerSegmentConsumer].MRR
+	w.UnknownSegmentCustomers = breakdown[customerSegmentUnknown].Customers
+	w.UnknownSegmentMRR = breakdown[customerSegmentUnknown].MRR
+}
@@ -0,0 +1,113 @@
+package glance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestFreeEmailProviders_Segment(t *testing.T) {
+	providers, err := newFreeEmailProviders(true, []string{"Seznam.cz", "@libero.it"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"jane@acme.io", customerSegmentBusiness},
+		{"jane@gmail.com", customerSegmentConsumer},
+		{"Jane@GMail.COM", customerSegmentConsumer},
+		{"jane@outlook.com", customerSegmentConsumer},
+		// Configured providers extend the built-in ones
+		{"jane@seznam.cz", customerSegmentConsumer},
+		{"jane@libero.it", customerSegmentConsumer},
+		// Subdomains aren't the provider
+		{"jane@mail.gmail.com", customerSegmentBusiness},
+		{"", customerSegmentUnknown},
+		{"jane", customerSegmentUnknown},
+		{"jane@", customerSegmentUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := providers.segment(tt.email); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewFreeEmailProviders(t *testing.T) {
+	replaced, err := newFreeEmailProviders(false, []string{"example.org"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if replaced.segment("jane@gmail.com") != customerSegmentBusiness || replaced.segment("jane@example.org") != customerSegmentConsumer {
+		t.Error("expected the configured providers to replace the built-in ones")
+	}
+
+	for _, domain := range []string{"", "gmail", "jane@gmail.com", "g mail.com"} {
+		if _, err := newFreeEmailProviders(true, []string{domain}); err == nil {
+			t.Errorf("expected an error for %q", domain)
+		}
+	}
+}
+
+func TestSegmentBreakdown(t *testing.T) {
+	ctx := context.Background()
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	segments := customerSegments{
+		"cus_1": customerSegmentBusiness, "cus_2": customerSegmentBusiness,
+		"cus_3": customerSegmentConsumer,
+		"cus_4": customerSegmentUnknown,
+	}
+
+	sub := func(customer string, status stripe.SubscriptionStatus, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       "sub_" + customer,
+			Customer: &stripe.Customer{ID: customer},
+			Status:   status,
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: amount, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}},
+			}}},
+		}
+	}
+
+	scan := &subscriptionScan{Current: []*stripe.Subscription{
+		sub("cus_1", stripe.SubscriptionStatusActive, 5000),
+		sub("cus_2", stripe.SubscriptionStatusActive, 2500),
+		sub("cus_3", stripe.SubscriptionStatusActive, 1000),
+		// Not part of MRR
+		sub("cus_3", stripe.SubscriptionStatusTrialing, 1000),
+		// Customer created after the customers were listed
+		sub("cus_5", stripe.SubscriptionStatusActive, 300),
+	}}
+
+	w := &customersWidget{}
+	w.updateSegments(ctx, segments, scan)
+
+	if w.BusinessCustomers != 2 || !floatEquals(w.BusinessMRR, 75, 0.001) {
+		t.Errorf("expected 2 business customers with 75 MRR, got %d with %v", w.BusinessCustomers, w.BusinessMRR)
+	}
+
+	if w.ConsumerCustomers != 1 || !floatEquals(w.ConsumerMRR, 10, 0.001) {
+		t.Errorf("expected 1 consumer with 10 MRR, got %d with %v", w.ConsumerCustomers, w.ConsumerMRR)
+	}
+
+	if w.UnknownSegmentCustomers != 1 || !floatEquals(w.UnknownSegmentMRR, 3, 0.001) {
+		t.Errorf("expected 1 unknown customer with 3 MRR, got %d with %v", w.UnknownSegmentCustomers, w.UnknownSegmentMRR)
+	}
+
+	// Without the customer list, as with estimated counting
+	w.updateSegments(ctx, nil, scan)
+	if w.BusinessCustomers != 0 || w.ConsumerMRR != 0 || w.UnknownSegmentMRR != 0 {
+		t.Errorf("expected no segments without listed customers, got %+v", w)
+	}
+}
@@ -0,0 +1,100 @@
+package glance
+
+import (
+	"context"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// customerStarts counts the customers who started a subscription this month:
+// the ones starting their first-ever subscription and the ones coming back
+// after a previous subscription was canceled
+type customerStarts struct {
+	New         int
+	Reactivated int
+	// The new customers by ID, as expanded on their subscription
+	NewCustomers map[string]*stripe.Customer
+}
+
+// subscriptionStarted reports whether sub was ever started, unlike incomplete
+// subscriptions whose first payment never went through
+func subscriptionStarted(sub *stripe.Subscription) bool {
+	return sub.Status != stripe.SubscriptionStatusIncomplete && sub.Status != stripe.SubscriptionStatusIncompleteExpired
+}
+
+// countCustomerStarts tells the customers of the subscriptions of scan
+// created this month apart. Customers who still have an older subscription
+// only added one and aren't counted, customers whose earlier subscription
+// was canceled before their new one are reactivated, and the rest are new.
+func countCustomerStarts(ctx context.Context, scan *subscriptionScan) (customerStarts, error) {
+	reactivations := scan.reactivations()
+
+	startOfMonth := scan.StartOfMonth.Unix()
+
+	// Earliest subscription created this month per customer
+	first := make(map[string]*stripe.Subscription)
+	// Customers with a subscription created before this month, and whether
+	// it's still current
+	earlier := make(map[string]bool)
+
+	visit := func(sub *stripe.Subscription, current bool) {
+		if sub.Customer == nil || sub.Customer.ID == "" || !subscriptionStarted(sub) {
+			return
+		}
+
+		id := sub.Customer.ID
+		if sub.Created < startOfMonth {
+			earlier[id] = earlier[id] || current
+			return
+		}
+
+		if existing, ok := first[id]; !ok || sub.Created < existing.Created {
+			first[id] = sub
+		}
+	}
+
+	for _, sub := range scan.Current {
+		visit(sub, true)
+	}
+	for _, sub := range scan.Canceled {
+		visit(sub, false)
+	}
+
+	starts := customerStarts{NewCustomers: make(map[string]*stripe.Customer)}
+	for id, sub := range first {
+		current, hadEarlier := earlier[id]
+		if current {
+			continue
+		}
+
+		reactivated, err := reactivations.isReactivation(ctx, sub)
+		if err != nil {
+			return customerStarts{}, err
+		}
+
+		switch {
+		case reactivated:
+			starts.Reactivated++
+		case !hadEarlier:
+			// An older subscription canceled this month after the new one
+			// started is a plan switch rather than a first subscription
+			starts.New++
+			starts.NewCustomers[id] = sub.Customer
+		}
+	}
+
+	return starts, nil
+}
+
+// countCustomerStartsWithRetry wraps countCustomerStarts with circuit breaker
+// and retry logic, as telling reactivations apart lists the canceled
+// subscriptions of customers
+func countCustomerStartsWithRetry(ctx context.Context, client *StripeClientWrapper, scan *subscriptionScan) (customerStarts, error) {
+	var result customerStarts
+	err := client.ExecuteWithRetry(ctx, "countCustomerStarts", func() error {
+		starts, err := countCustomerStarts(ctx, scan)
+		result = starts
+		return err
+	})
+	return result, err
+}
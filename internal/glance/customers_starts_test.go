@@ -0,0 +1,88 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCountCustomerStarts(t *testing.T) {
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	thisMonth := startOfMonth.AddDate(0, 0, 5).Unix()
+	lastYear := startOfMonth.AddDate(-1, 0, 0).Unix()
+
+	sub := func(customer string, status stripe.SubscriptionStatus, created int64) *stripe.Subscription {
+		return &stripe.Subscription{Customer: &stripe.Customer{ID: customer}, Status: status, Created: created}
+	}
+
+	scan := &subscriptionScan{
+		StartOfMonth: startOfMonth,
+		Current: []*stripe.Subscription{
+			// First-ever subscriptions, one of them in trial
+			sub("cus_new", stripe.SubscriptionStatusActive, thisMonth),
+			sub("cus_trial", stripe.SubscriptionStatusTrialing, thisMonth),
+			// Re-subscribed after canceling last year
+			sub("cus_back", stripe.SubscriptionStatusActive, thisMonth),
+			// Added a second subscription next to an older one
+			sub("cus_existing", stripe.SubscriptionStatusActive, lastYear),
+			sub("cus_existing", stripe.SubscriptionStatusActive, thisMonth),
+			// Switched plans by canceling after the new one started
+			sub("cus_switch", stripe.SubscriptionStatusActive, thisMonth),
+			// Never paid
+			sub("cus_incomplete", stripe.SubscriptionStatusIncomplete, thisMonth),
+		},
+		Canceled: []*stripe.Subscription{
+			sub("cus_switch", stripe.SubscriptionStatusCanceled, lastYear),
+			// Subscribed and canceled again this month
+			sub("cus_gone", stripe.SubscriptionStatusCanceled, thisMonth),
+		},
+		// Customers with canceled subscriptions before this month
+		reactivationCheck: newReactivationChecker(&fakeCanceledSubscriptionLister{canceled: map[string][]*stripe.Subscription{
+			"cus_back":   {{EndedAt: startOfMonth.AddDate(0, -6, 0).Unix()}},
+			"cus_switch": {{EndedAt: thisMonth + 3600}},
+		}}),
+	}
+
+	starts, err := countCustomerStarts(context.Background(), scan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if starts.New != 3 || len(starts.NewCustomers) != 3 {
+		t.Errorf("expected 3 new customers, got %d", starts.New)
+	}
+
+	if starts.Reactivated != 1 {
+		t.Errorf("expected 1 reactivated customer, got %d", starts.Reactivated)
+	}
+}
+
+func TestCountCustomerStarts_ResubscribeIsNotNew(t *testing.T) {
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	// A customer who canceled in February comes back with a new subscription
+	// in April. Their customer object is from last year, so it wasn't
+	// counted before either, and now counts as reactivated only.
+	scan := &subscriptionScan{
+		StartOfMonth: startOfMonth,
+		Current: []*stripe.Subscription{{
+			Customer: &stripe.Customer{ID: "cus_back", Created: startOfMonth.AddDate(-1, 0, 0).Unix()},
+			Status:   stripe.SubscriptionStatusActive,
+			Created:  startOfMonth.AddDate(0, 0, 10).Unix(),
+		}},
+		reactivationCheck: newReactivationChecker(&fakeCanceledSubscriptionLister{canceled: map[string][]*stripe.Subscription{
+			"cus_back": {{CanceledAt: time.Date(2026, time.February, 14, 0, 0, 0, 0, time.UTC).Unix()}},
+		}}),
+	}
+
+	starts, err := countCustomerStarts(context.Background(), scan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if starts.New != 0 || starts.Reactivated != 1 || len(starts.NewCustomers) != 0 {
+		t.Errorf("expected the customer to count as reactivated only, got %+v", starts)
+	}
+}
@@ -0,0 +1,58 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// trialStartedSince reports whether sub started a trial at or after t: its
+// trial started then, or it was created then and is trialing
+func trialStartedSince(sub *stripe.Subscription, t time.Time) bool {
+	if sub.TrialStart != 0 {
+		return sub.TrialStart >= t.Unix()
+	}
+
+	return sub.Status == stripe.SubscriptionStatusTrialing && sub.Created >= t.Unix()
+}
+
+// countNewTrials counts the subscriptions of scan that started a trial this
+// month, including the ones canceled or converted since
+func countNewTrials(scan *subscriptionScan) int {
+	seen := make(map[string]bool)
+	for _, subs := range [][]*stripe.Subscription{scan.Current, scan.Canceled} {
+		for _, sub := range subs {
+			if trialStartedSince(sub, scan.StartOfMonth) {
+				seen[sub.ID] = true
+			}
+		}
+	}
+
+	return len(seen)
+}
+
+// updateNewTrials sets the trials started this month from the subscriptions of
+// scan, adding the trials customer.subscription.created webhooks reported
+// since they were listed. Webhooks don't tell which account of a mode they
+// came from, so they're only added to widgets without an account-label.
+func (w *customersWidget) updateNewTrials(ctx context.Context, db *SimpleMetricsDB, scan *subscriptionScan, now time.Time) {
+	w.NewTrials = 0
+	if scan == nil {
+		return
+	}
+
+	w.NewTrials = countNewTrials(scan)
+	if db == nil || w.AccountLabel != "" || scan.listedAt.IsZero() {
+		return
+	}
+
+	deltas, err := db.SumDeltas(ctx, w.StripeMode, scan.listedAt, now)
+	if err != nil {
+		slog.Error("Failed to sum trial deltas", "error", err)
+		return
+	}
+
+	w.NewTrials += deltas.NewTrials
+}
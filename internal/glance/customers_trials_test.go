@@ -0,0 +1,60 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCustomersWidget_UpdateNewTrials(t *testing.T) {
+	ctx := context.Background()
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	listedAt := startOfMonth.AddDate(0, 0, 10)
+	lastMonth := startOfMonth.AddDate(0, 0, -3).Unix()
+	thisMonth := startOfMonth.AddDate(0, 0, 2).Unix()
+
+	scan := &subscriptionScan{
+		StartOfMonth: startOfMonth,
+		listedAt:     listedAt,
+		Current: []*stripe.Subscription{
+			{ID: "sub_trialing", Status: stripe.SubscriptionStatusTrialing, Created: thisMonth, TrialStart: thisMonth},
+			{ID: "sub_converted", Status: stripe.SubscriptionStatusActive, Created: thisMonth, TrialStart: thisMonth},
+			// Without trial_start, trialing since it was created this month
+			{ID: "sub_created", Status: stripe.SubscriptionStatusTrialing, Created: thisMonth},
+			// Not trial starts of this month
+			{ID: "sub_last_month", Status: stripe.SubscriptionStatusTrialing, Created: lastMonth, TrialStart: lastMonth},
+			{ID: "sub_paid", Status: stripe.SubscriptionStatusActive, Created: thisMonth},
+		},
+		Canceled: []*stripe.Subscription{
+			{ID: "sub_abandoned", Status: stripe.SubscriptionStatusCanceled, Created: thisMonth, TrialStart: thisMonth},
+		},
+	}
+
+	if got := countNewTrials(scan); got != 4 {
+		t.Errorf("expected 4 new trials, got %d", got)
+	}
+
+	db := newSimpleMetricsDB()
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: listedAt.Add(-time.Hour), NewTrials: 1, Mode: "test"})
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: listedAt.Add(time.Hour), NewTrials: 1, Mode: "test"})
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: listedAt.Add(2 * time.Hour), NewMRR: 10, Mode: "test"})
+
+	w := &customersWidget{StripeMode: "test"}
+	w.updateNewTrials(ctx, db, scan, listedAt.Add(3*time.Hour))
+	if w.NewTrials != 5 {
+		t.Errorf("expected the trial started after the listing to be added, got %d", w.NewTrials)
+	}
+
+	w.AccountLabel = "eu"
+	w.updateNewTrials(ctx, db, scan, listedAt.Add(3*time.Hour))
+	if w.NewTrials != 4 {
+		t.Errorf("expected webhook trials to be left out with an account label, got %d", w.NewTrials)
+	}
+
+	w.updateNewTrials(ctx, db, nil, listedAt)
+	if w.NewTrials != 0 {
+		t.Errorf("expected no trials without the subscriptions, got %d", w.NewTrials)
+	}
+}
@@ -0,0 +1,152 @@
+package glance
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// storeBudgetWarning is the share of the store budget above which the
+	// memory health check reports degraded
+	storeBudgetWarning = 0.9
+
+	// defaultMetricsMaxSnapshots bounds the store when max-snapshots isn't
+	// set, webhook driven widget updates saving snapshots far more often than
+	// hourly
+	defaultMetricsMaxSnapshots = 100000
+)
+
+// SetBudget limits the approximate size and the number of snapshots and
+// webhook deltas kept across all modes, evicting the oldest when either is
+// exceeded. A limit of 0 disables it.
+func (db *SimpleMetricsDB) SetBudget(maxBytes int64, maxSnapshots int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.budgetBytes = maxBytes
+	db.budgetSnapshots = maxSnapshots
+	db.enforceBudget()
+}
+
+// storeUsage returns the number and approximate size of stored snapshots and
+// deltas. Must be called with the lock held.
+func (db *SimpleMetricsDB) storeUsage() (int, int64) {
+	count, bytes := 0, int64(0)
+
+	for _, history := range db.revenueHistory {
+		count += len(history)
+		bytes += int64(len(history)) * revenueSnapshotBytes
+	}
+
+	for _, history := range db.customerHistory {
+		count += len(history)
+		bytes += int64(len(history)) * customerSnapshotBytes
+	}
+
+	for _, deltas := range db.deltas {
+		count += len(deltas)
+		bytes += int64(len(deltas)) * deltaBytes
+	}
+
+	return count, bytes
+}
+
+func (db *SimpleMetricsDB) overBudget(count int, bytes int64) bool {
+	return (db.budgetSnapshots > 0 && count > db.budgetSnapshots) ||
+		(db.budgetBytes > 0 && bytes > db.budgetBytes)
+}
+
+// evictedSnapshots summarizes the snapshots evicted from one table of a mode
+type evictedSnapshots struct {
+	count  int
+	newest time.Time
+}
+
+// enforceBudget evicts the oldest snapshots or deltas across all modes until
+// the store is within its budget. Must be called with the lock held.
+func (db *SimpleMetricsDB) enforceBudget() {
+	if db.budgetBytes <= 0 && db.budgetSnapshots <= 0 {
+		return
+	}
+
+	count, bytes := db.storeUsage()
+	if !db.overBudget(count, bytes) {
+		return
+	}
+
+	type table struct{ mode, name string }
+	evicted := make(map[table]*evictedSnapshots)
+
+	for db.overBudget(count, bytes) {
+		// Every history is in chronological order, so the oldest entry in the
+		// store is the first of one of them
+		var oldest time.Time
+		var evict func()
+		var evictedFrom table
+		var size int64
+
+		consider := func(from table, timestamp time.Time, remove func(), entryBytes int64) {
+			if evict == nil || timestamp.Before(oldest) {
+				oldest, evict, evictedFrom, size = timestamp, remove, from, entryBytes
+			}
+		}
+
+		for mode, history := range db.revenueHistory {
+			if len(history) > 0 {
+				consider(table{mode, "revenue"}, history[0].Timestamp, func() { db.revenueHistory[mode] = history[1:] }, revenueSnapshotBytes)
+			}
+		}
+
+		for mode, history := range db.customerHistory {
+			if len(history) > 0 {
+				consider(table{mode, "customer"}, history[0].Timestamp, func() { db.customerHistory[mode] = history[1:] }, customerSnapshotBytes)
+			}
+		}
+
+		for mode, deltas := range db.deltas {
+			if len(deltas) > 0 {
+				consider(table{mode, "delta"}, deltas[0].Timestamp, func() { db.deltas[mode] = deltas[1:] }, deltaBytes)
+			}
+		}
+
+		if evict == nil {
+			break
+		}
+
+		evict()
+		count--
+		bytes -= size
+		db.evictedSnapshots++
+
+		if evicted[evictedFrom] == nil {
+			evicted[evictedFrom] = &evictedSnapshots{}
+		}
+		evicted[evictedFrom].count++
+		evicted[evictedFrom].newest = oldest
+	}
+
+	for from, e := range evicted {
+		slog.Warn("Evicted oldest metrics over the store budget",
+			"mode", from.mode,
+			"table", from.name,
+			"evicted", e.count,
+			"up_to", e.newest,
+		)
+	}
+}
+
+// storeBudgetUsage returns how much of the tighter of the two store budgets is
+// used, from 0 to 1, or 0 when no budget is set
+func storeBudgetUsage(stats *DatabaseStats) float64 {
+	usage := 0.0
+
+	if stats.BudgetSnapshots > 0 {
+		usage = max(usage, float64(stats.TotalSnapshots)/float64(stats.BudgetSnapshots))
+	}
+
+	if stats.BudgetBytes > 0 {
+		usage = max(usage, float64(stats.ApproxBytes)/float64(stats.BudgetBytes))
+	}
+
+	return usage
+}
@@ -2,39 +2,178 @@ package glance
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// RevenueSnapshot stores historical revenue data
+// RevenueSnapshot stores historical revenue data. Fields tagged with series
+// are queryable through the series API.
 type RevenueSnapshot struct {
-	Timestamp    time.Time
-	MRR          float64
-	ARR          float64
-	GrowthRate   float64
-	NewMRR       float64
-	ChurnedMRR   float64
-	Mode         string
+	Timestamp  time.Time `json:"timestamp"`
+	MRR        float64   `json:"mrr" series:"mrr"`
+	ARR        float64   `json:"arr" series:"arr"`
+	GrowthRate float64   `json:"growth_rate" series:"growth_rate"`
+	NewMRR     float64   `json:"new_mrr" series:"new_mrr"`
+	ChurnedMRR float64   `json:"churned_mrr" series:"churned_mrr"`
+	ARPU       float64   `json:"arpu" series:"arpu"`               // MRR per paying customer
+	Collected  float64   `json:"collected" series:"collected"`     // paid invoices this month, less refunds
+	QuickRatio *float64  `json:"quick_ratio" series:"quick_ratio"` // nil when no MRR was lost
+	NRR        *float64  `json:"nrr" series:"nrr"`                 // net revenue retention, nil without enough history
+	Mode       string    `json:"mode"`
+	Account    string    `json:"account,omitempty"` // account-label of the widget that saved it
 }
 
-// CustomerSnapshot stores historical customer data
+// CustomerSnapshot stores historical customer data. Fields tagged with series
+// are queryable through the series API.
 type CustomerSnapshot struct {
-	Timestamp        time.Time
-	TotalCustomers   int
-	NewCustomers     int
-	ChurnedCustomers int
-	ChurnRate        float64
-	ActiveCustomers  int
-	Mode             string
+	Timestamp            time.Time `json:"timestamp"`
+	TotalCustomers       int       `json:"total_customers" series:"customers"`
+	NewCustomers         int       `json:"new_customers" series:"new_customers"`                 // first-ever subscription this month
+	ReactivatedCustomers int       `json:"reactivated_customers" series:"reactivated_customers"` // re-subscribed after canceling
+	ChurnedCustomers     int       `json:"churned_customers" series:"churned_customers"`
+	ChurnRate            float64   `json:"churn_rate" series:"churn_rate"`
+	ActiveCustomers      int       `json:"active_customers" series:"active_customers"`
+	GrowthRate           *float64  `json:"growth_rate" series:"customer_growth_rate"` // nil without enough history
+	NetGrowth            int       `json:"net_growth" series:"net_growth"`            // new minus churned customers
+	Mode                 string    `json:"mode"`
+	Account              string    `json:"account,omitempty"` // account-label of the widget that saved it
+	Estimated            bool      `json:"estimated"`         // TotalCustomers was estimated rather than enumerated
 }
 
-// SimpleMetricsDB handles in-memory storage of historical metrics
+// CustomerCountBaseline stores the last exact customer count for a mode along
+// with the customer webhook events observed since it was taken
+type CustomerCountBaseline struct {
+	Timestamp      time.Time `json:"timestamp"`
+	TotalCustomers int       `json:"total_customers"`
+	Mode           string    `json:"mode"`
+	CreatedSince   int       `json:"created_since"`
+	DeletedSince   int       `json:"deleted_since"`
+}
+
+// metricsKey returns the key snapshots of a mode and Stripe account are stored
+// under, which is what the mode parameter of the query methods expects. Without
+// an account label it is the mode alone, as it was before accounts existed.
+func metricsKey(mode, account string) string {
+	if account == "" {
+		return mode
+	}
+
+	return mode + "/" + account
+}
+
+var accountLabelPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// validateAccountLabel checks an account-label option or account parameter, an
+// empty label being the default account
+func validateAccountLabel(account string) error {
+	if account != "" && !accountLabelPattern.MatchString(account) {
+		return fmt.Errorf("account must be up to 32 letters, digits, dashes or underscores, got: %s", account)
+	}
+
+	return nil
+}
+
+// SimpleMetricsDB handles in-memory storage of historical metrics, keyed by
+// metricsKey
 type SimpleMetricsDB struct {
 	revenueHistory  map[string][]*RevenueSnapshot  // key: mode
 	customerHistory map[string][]*CustomerSnapshot // key: mode
+	customerBaselines map[string]*CustomerCountBaseline // key: mode
+	deltas          map[string][]*MetricsDelta     // key: mode
+	annotations     map[string][]*Annotation       // key: mode
+	processedEvents *processedEvents               // webhook event IDs, see webhook_dedupe.go
+	webhookEvents   []WebhookEvent                 // oldest first, see webhook_event_log.go
+	webhookPayloads map[string]webhookPayload      // key: event ID, see webhook_replay.go
+	webhookPayloadOrder []string                   // event IDs, oldest first
 	mu              sync.RWMutex
-	maxHistory      int
+	now             func() time.Time
+
+	// Snapshots matching the latest one for their mode within dedupeWindow are
+	// skipped, values may differ by up to dedupeTolerance
+	dedupeWindow      time.Duration
+	dedupeTolerance   float64
+	skippedDuplicates int
+
+	// How long webhook events and their payloads are kept, see
+	// webhook_log_retention.go
+	webhookEventRetention   time.Duration
+	webhookPayloadRetention time.Duration
+
+	// Changes recorded by the primary for replicas to poll
+	changes        []MetricsChange
+	changeSequence int64
+
+	// Saved snapshots waiting to be applied by the flusher, see database_write_queue.go
+	queueMu     sync.Mutex
+	queue       []queuedWrite
+	flushNow    chan struct{}
+	stopFlusher chan struct{}
+	flusherDone chan struct{}
+
+	// File snapshots are saved to, see metrics_persist.go
+	persistPath    string
+	persistEncrypt bool
+	encryption     *EncryptionService
+	loadedPath     string
+
+	// Limits on the whole store, see database_budget.go
+	budgetBytes      int64
+	budgetSnapshots  int
+	evictedSnapshots int
+}
+
+// MetricsChange records that the primary refreshed widgets of a type
+type MetricsChange struct {
+	Sequence   int64     `json:"sequence"`
+	Timestamp  time.Time `json:"timestamp"`
+	WidgetType string    `json:"widget_type"`
+}
+
+// maxChanges is how many changes are kept for replicas to poll
+const maxChanges = 100
+
+// MetricsDelta is a change reported by a single webhook event. Deltas are kept
+// apart from snapshots, which always hold the complete state at a point in time.
+type MetricsDelta struct {
+	Timestamp              time.Time `json:"timestamp"`
+	EventType              string    `json:"event_type"`
+	NewMRR                 float64   `json:"new_mrr"`
+	ChurnedMRR             float64   `json:"churned_mrr"`
+	ExpansionMRR           float64   `json:"expansion_mrr"`
+	ContractionMRR         float64   `json:"contraction_mrr"`
+	NewCustomers           int       `json:"new_customers"`
+	ChurnedCustomers       int       `json:"churned_customers"`
+	NewTrials              int       `json:"new_trials"`
+	TrialsEnding           int       `json:"trials_ending"` // trials ending within three days, about to convert or churn
+	Refunded               float64   `json:"refunded"`
+	FailedPayments         int       `json:"failed_payments"`
+	FailedAmount           float64   `json:"failed_amount"`
+	UncollectibleInvoices  int       `json:"uncollectible_invoices"`
+	UncollectibleAmount    float64   `json:"uncollectible_amount"` // revenue given up on, rather than still being retried
+	OneTimeRevenue         float64   `json:"one_time_revenue"`
+	CompletedCheckouts     int       `json:"completed_checkouts"`
+	CheckoutAmount         float64   `json:"checkout_amount"`
+	DetachedPaymentMethods int       `json:"detached_payment_methods"`
+	Mode                   string    `json:"mode"`
+}
+
+// maxDeltas is how many webhook deltas are kept per mode
+const maxDeltas = 1000
+
+// MetricsCleanupResult reports how many snapshots were removed per mode
+type MetricsCleanupResult struct {
+	RevenueRemoved  map[string]int
+	CustomerRemoved map[string]int
+	DeltasRemoved   map[string]int
 }
 
 var (
@@ -45,58 +184,337 @@ var (
 // GetSimpleMetricsDB returns the global simple metrics database (singleton)
 func GetSimpleMetricsDB() *SimpleMetricsDB {
 	globalSimpleDBOnce.Do(func() {
-		globalSimpleDB = &SimpleMetricsDB{
-			revenueHistory:  make(map[string][]*RevenueSnapshot),
-			customerHistory: make(map[string][]*CustomerSnapshot),
-			maxHistory:      100, // Keep last 100 snapshots per mode
-		}
+		globalSimpleDB = newSimpleMetricsDB()
 		slog.Info("Simple metrics database initialized")
 	})
 	return globalSimpleDB
 }
 
-// SaveRevenueSnapshot saves a revenue snapshot to memory
-func (db *SimpleMetricsDB) SaveRevenueSnapshot(ctx context.Context, snapshot *RevenueSnapshot) error {
+func newSimpleMetricsDB() *SimpleMetricsDB {
+	return &SimpleMetricsDB{
+		revenueHistory:    make(map[string][]*RevenueSnapshot),
+		customerHistory:   make(map[string][]*CustomerSnapshot),
+		customerBaselines: make(map[string]*CustomerCountBaseline),
+		deltas:            make(map[string][]*MetricsDelta),
+		annotations:       make(map[string][]*Annotation),
+		processedEvents:   newProcessedEvents(maxProcessedEvents),
+		now:               time.Now,
+		flushNow:          make(chan struct{}, 1),
+	}
+}
+
+// SetDeduplication configures skipping of snapshots that repeat the latest
+// snapshot for their mode. A window of 0 disables deduplication.
+func (db *SimpleMetricsDB) SetDeduplication(window time.Duration, tolerance float64) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	mode := snapshot.Mode
+	db.dedupeWindow = window
+	db.dedupeTolerance = tolerance
+}
+
+// isDuplicate reports whether a snapshot taken at timestamp with the given
+// values repeats the previous snapshot. Must be called with the lock held.
+func (db *SimpleMetricsDB) isDuplicate(previousTimestamp, timestamp time.Time, previous, current []float64) bool {
+	if db.dedupeWindow <= 0 || timestamp.Sub(previousTimestamp) >= db.dedupeWindow {
+		return false
+	}
+
+	for i := range previous {
+		if math.Abs(previous[i]-current[i]) > db.dedupeTolerance {
+			return false
+		}
+	}
+
+	return true
+}
+
+func revenueSnapshotValues(s *RevenueSnapshot) []float64 {
+	return []float64{s.MRR, s.ARR, s.GrowthRate, s.NewMRR, s.ChurnedMRR, s.ARPU, s.Collected, optionalSnapshotValue(s.QuickRatio), optionalSnapshotValue(s.NRR)}
+}
+
+// optionalSnapshotValue compares an undefined value as infinity, so that it
+// equals another undefined value and differs from every defined one
+func optionalSnapshotValue(value *float64) float64 {
+	if value == nil {
+		return math.Inf(1)
+	}
+
+	return *value
+}
+
+func customerSnapshotValues(s *CustomerSnapshot) []float64 {
+	estimated := 0.0
+	if s.Estimated {
+		estimated = 1
+	}
+
+	return []float64{
+		float64(s.TotalCustomers),
+		float64(s.NewCustomers),
+		float64(s.ReactivatedCustomers),
+		float64(s.ChurnedCustomers),
+		s.ChurnRate,
+		float64(s.ActiveCustomers),
+		estimated,
+		optionalSnapshotValue(s.GrowthRate),
+	}
+}
+
+// insertChronological inserts a snapshot after every snapshot that isn't newer
+// than it, keeping history in chronological order when snapshots are saved out
+// of order
+func insertChronological[T any](history []T, snapshot T, timestamp func(T) time.Time) []T {
+	i := sort.Search(len(history), func(i int) bool {
+		return timestamp(history[i]).After(timestamp(snapshot))
+	})
+
+	return slices.Insert(history, i, snapshot)
+}
+
+// SaveDelta records a change reported by a webhook event
+func (db *SimpleMetricsDB) SaveDelta(ctx context.Context, delta *MetricsDelta) error {
+	if globalPause.isPaused() {
+		return errAdministrativelyPaused
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	mode := delta.Mode
+	db.deltas[mode] = insertChronological(db.deltas[mode], delta, func(d *MetricsDelta) time.Time { return d.Timestamp })
+
+	if len(db.deltas[mode]) > maxDeltas {
+		db.deltas[mode] = db.deltas[mode][len(db.deltas[mode])-maxDeltas:]
+	}
+
+	db.enforceBudget()
+	return nil
+}
+
+// GetDeltas returns the webhook deltas recorded for a mode in the specified
+// period, oldest first
+func (db *SimpleMetricsDB) GetDeltas(ctx context.Context, mode string, startTime, endTime time.Time) ([]*MetricsDelta, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var filtered []*MetricsDelta
+	for _, delta := range db.deltas[mode] {
+		if !delta.Timestamp.Before(startTime) && !delta.Timestamp.After(endTime) {
+			filtered = append(filtered, delta)
+		}
+	}
+
+	return filtered, nil
+}
+
+// SumDeltas adds up the webhook deltas recorded for a mode in the specified period
+func (db *SimpleMetricsDB) SumDeltas(ctx context.Context, mode string, startTime, endTime time.Time) (*MetricsDelta, error) {
+	deltas, err := db.GetDeltas(ctx, mode, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &MetricsDelta{Timestamp: endTime, Mode: mode}
+	for _, delta := range deltas {
+		sum.NewMRR += delta.NewMRR
+		sum.ChurnedMRR += delta.ChurnedMRR
+		sum.ExpansionMRR += delta.ExpansionMRR
+		sum.ContractionMRR += delta.ContractionMRR
+		sum.NewCustomers += delta.NewCustomers
+		sum.ChurnedCustomers += delta.ChurnedCustomers
+		sum.NewTrials += delta.NewTrials
+		sum.TrialsEnding += delta.TrialsEnding
+		sum.Refunded += delta.Refunded
+		sum.FailedPayments += delta.FailedPayments
+		sum.FailedAmount += delta.FailedAmount
+		sum.UncollectibleInvoices += delta.UncollectibleInvoices
+		sum.UncollectibleAmount += delta.UncollectibleAmount
+		sum.OneTimeRevenue += delta.OneTimeRevenue
+		sum.CompletedCheckouts += delta.CompletedCheckouts
+		sum.CheckoutAmount += delta.CheckoutAmount
+		sum.DetachedPaymentMethods += delta.DetachedPaymentMethods
+	}
+
+	return sum, nil
+}
+
+// SaveRevenueSnapshot queues a revenue snapshot to be saved to memory. The only
+// error is errAdministrativelyPaused, returned without queuing the snapshot.
+// Once queued it is always applied, unless it repeats the latest snapshot of
+// its mode, which is skipped without an error and counted in the database
+// stats, see SetDeduplication.
+func (db *SimpleMetricsDB) SaveRevenueSnapshot(ctx context.Context, snapshot *RevenueSnapshot) error {
+	if globalPause.isPaused() {
+		return errAdministrativelyPaused
+	}
+
+	db.enqueueWrite(queuedWrite{revenue: snapshot})
+	return nil
+}
+
+// saveRevenueSnapshot stores a revenue snapshot. Must be called with the lock held.
+func (db *SimpleMetricsDB) saveRevenueSnapshot(snapshot *RevenueSnapshot) {
+	mode := metricsKey(snapshot.Mode, snapshot.Account)
 	if db.revenueHistory[mode] == nil {
 		db.revenueHistory[mode] = make([]*RevenueSnapshot, 0)
 	}
 
-	db.revenueHistory[mode] = append(db.revenueHistory[mode], snapshot)
+	if history := db.revenueHistory[mode]; len(history) > 0 {
+		previous := history[len(history)-1]
+		if !snapshot.Timestamp.Before(previous.Timestamp) &&
+			db.isDuplicate(previous.Timestamp, snapshot.Timestamp, revenueSnapshotValues(previous), revenueSnapshotValues(snapshot)) {
+			db.skippedDuplicates++
+			return
+		}
+	}
 
-	// Keep only last N snapshots
-	if len(db.revenueHistory[mode]) > db.maxHistory {
-		db.revenueHistory[mode] = db.revenueHistory[mode][len(db.revenueHistory[mode])-db.maxHistory:]
+	// Snapshots older than the retention are removed by the cleanup job, and
+	// the oldest of all modes once over the store budget
+	db.revenueHistory[mode] = insertChronological(db.revenueHistory[mode], snapshot, func(s *RevenueSnapshot) time.Time { return s.Timestamp })
+}
+
+// SaveCustomerSnapshot queues a customer snapshot to be saved to memory, with
+// the same errors as SaveRevenueSnapshot
+func (db *SimpleMetricsDB) SaveCustomerSnapshot(ctx context.Context, snapshot *CustomerSnapshot) error {
+	if globalPause.isPaused() {
+		return errAdministrativelyPaused
 	}
 
+	db.enqueueWrite(queuedWrite{customer: snapshot})
 	return nil
 }
 
-// SaveCustomerSnapshot saves a customer snapshot to memory
-func (db *SimpleMetricsDB) SaveCustomerSnapshot(ctx context.Context, snapshot *CustomerSnapshot) error {
+// saveCustomerSnapshot stores a customer snapshot. Must be called with the lock held.
+func (db *SimpleMetricsDB) saveCustomerSnapshot(snapshot *CustomerSnapshot) {
+	mode := metricsKey(snapshot.Mode, snapshot.Account)
+	if db.customerHistory[mode] == nil {
+		db.customerHistory[mode] = make([]*CustomerSnapshot, 0)
+	}
+
+	if history := db.customerHistory[mode]; len(history) > 0 {
+		previous := history[len(history)-1]
+		if !snapshot.Timestamp.Before(previous.Timestamp) &&
+			db.isDuplicate(previous.Timestamp, snapshot.Timestamp, customerSnapshotValues(previous), customerSnapshotValues(snapshot)) {
+			db.skippedDuplicates++
+			return
+		}
+	}
+
+	// Snapshots older than the retention are removed by the cleanup job, and
+	// the oldest of all modes once over the store budget
+	db.customerHistory[mode] = insertChronological(db.customerHistory[mode], snapshot, func(s *CustomerSnapshot) time.Time { return s.Timestamp })
+}
+
+// MetricsImportResult reports how many imported snapshots were stored, and
+// which were skipped because a snapshot with the same timestamp already existed
+// or because the store budget evicted them right away
+type MetricsImportResult struct {
+	Imported   int
+	Duplicates []time.Time
+	Trimmed    []time.Time
+}
+
+// mergeSnapshots inserts imported snapshots into history, keeping chronological
+// order and skipping any whose timestamp is already present
+func mergeSnapshots[T any](history, imported []T, timestamp func(T) time.Time) ([]T, *MetricsImportResult) {
+	result := &MetricsImportResult{}
+	existing := make(map[int64]bool, len(history))
+	for _, snapshot := range history {
+		existing[timestamp(snapshot).UnixNano()] = true
+	}
+
+	merged := slices.Clone(history)
+	added := make(map[int64]bool, len(imported))
+	for _, snapshot := range imported {
+		key := timestamp(snapshot).UnixNano()
+		if existing[key] {
+			result.Duplicates = append(result.Duplicates, timestamp(snapshot))
+			continue
+		}
+
+		existing[key] = true
+		added[key] = true
+		merged = append(merged, snapshot)
+	}
+
+	slices.SortStableFunc(merged, func(a, b T) int {
+		return timestamp(a).Compare(timestamp(b))
+	})
+
+	result.Imported = len(added)
+	return merged, result
+}
+
+// trimEvicted reports the imported snapshots no longer in history, evicted by
+// the store budget as soon as they were merged, as trimmed
+func trimEvicted[T any](result *MetricsImportResult, history, imported []T, timestamp func(T) time.Time) {
+	kept := make(map[int64]bool, len(history))
+	for _, snapshot := range history {
+		kept[timestamp(snapshot).UnixNano()] = true
+	}
+
+	skipped := make(map[int64]bool, len(result.Duplicates))
+	for _, duplicate := range result.Duplicates {
+		skipped[duplicate.UnixNano()] = true
+	}
+
+	for _, snapshot := range imported {
+		if key := timestamp(snapshot).UnixNano(); !kept[key] && !skipped[key] {
+			result.Trimmed = append(result.Trimmed, timestamp(snapshot))
+			result.Imported--
+		}
+	}
+}
+
+// ImportRevenueSnapshots stores historical revenue snapshots for a mode,
+// skipping timestamps that already have a snapshot
+func (db *SimpleMetricsDB) ImportRevenueSnapshots(ctx context.Context, mode string, snapshots []*RevenueSnapshot) (*MetricsImportResult, error) {
+	if globalPause.isPaused() {
+		return nil, errAdministrativelyPaused
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.applyQueuedWrites()
 
-	mode := snapshot.Mode
-	if db.customerHistory[mode] == nil {
-		db.customerHistory[mode] = make([]*CustomerSnapshot, 0)
+	timestamp := func(s *RevenueSnapshot) time.Time { return s.Timestamp }
+	merged, result := mergeSnapshots(db.revenueHistory[mode], snapshots, timestamp)
+	if len(merged) > 0 {
+		db.revenueHistory[mode] = merged
 	}
 
-	db.customerHistory[mode] = append(db.customerHistory[mode], snapshot)
+	db.enforceBudget()
+	trimEvicted(result, db.revenueHistory[mode], snapshots, timestamp)
+	return result, nil
+}
 
-	// Keep only last N snapshots
-	if len(db.customerHistory[mode]) > db.maxHistory {
-		db.customerHistory[mode] = db.customerHistory[mode][len(db.customerHistory[mode])-db.maxHistory:]
+// ImportCustomerSnapshots stores historical customer snapshots for a mode,
+// skipping timestamps that already have a snapshot
+func (db *SimpleMetricsDB) ImportCustomerSnapshots(ctx context.Context, mode string, snapshots []*CustomerSnapshot) (*MetricsImportResult, error) {
+	if globalPause.isPaused() {
+		return nil, errAdministrativelyPaused
 	}
 
-	return nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.applyQueuedWrites()
+
+	timestamp := func(s *CustomerSnapshot) time.Time { return s.Timestamp }
+	merged, result := mergeSnapshots(db.customerHistory[mode], snapshots, timestamp)
+	if len(merged) > 0 {
+		db.customerHistory[mode] = merged
+	}
+
+	db.enforceBudget()
+	trimEvicted(result, db.customerHistory[mode], snapshots, timestamp)
+	return result, nil
 }
 
-// GetRevenueHistory returns historical revenue data for the specified period
-func (db *SimpleMetricsDB) GetRevenueHistory(ctx context.Context, mode string, startTime, endTime time.Time) ([]*RevenueSnapshot, error) {
+// GetRevenueHistory returns historical revenue data for the specified period,
+// downsampled to at most maxPoints snapshots. A maxPoints of 0 returns all.
+func (db *SimpleMetricsDB) GetRevenueHistory(ctx context.Context, mode string, startTime, endTime time.Time, maxPoints int) ([]*RevenueSnapshot, error) {
+	db.flushWrites()
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -114,11 +532,13 @@ func (db *SimpleMetricsDB) GetRevenueHistory(ctx context.Context, mode string, s
 		}
 	}
 
-	return filtered, nil
+	return downsample(filtered, maxPoints), nil
 }
 
-// GetCustomerHistory returns historical customer data for the specified period
-func (db *SimpleMetricsDB) GetCustomerHistory(ctx context.Context, mode string, startTime, endTime time.Time) ([]*CustomerSnapshot, error) {
+// GetCustomerHistory returns historical customer data for the specified period,
+// downsampled to at most maxPoints snapshots. A maxPoints of 0 returns all.
+func (db *SimpleMetricsDB) GetCustomerHistory(ctx context.Context, mode string, startTime, endTime time.Time, maxPoints int) ([]*CustomerSnapshot, error) {
+	db.flushWrites()
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -136,65 +556,482 @@ func (db *SimpleMetricsDB) GetCustomerHistory(ctx context.Context, mode string,
 		}
 	}
 
-	return filtered, nil
+	return downsample(filtered, maxPoints), nil
+}
+
+// downsample reduces snapshots to at most maxPoints by sampling at an even
+// stride, always keeping the first and most recent snapshot
+func downsample[T any](snapshots []T, maxPoints int) []T {
+	if maxPoints <= 0 || len(snapshots) <= maxPoints {
+		return snapshots
+	}
+
+	if maxPoints == 1 {
+		return snapshots[len(snapshots)-1:]
+	}
+
+	sampled := make([]T, 0, maxPoints)
+	last := len(snapshots) - 1
+
+	for i := 0; i < maxPoints; i++ {
+		sampled = append(sampled, snapshots[i*last/(maxPoints-1)])
+	}
+
+	return sampled
+}
+
+// MetricsBucket is the period snapshots are grouped by when aggregating history
+type MetricsBucket string
+
+const (
+	MetricsBucketDay   MetricsBucket = "day"
+	MetricsBucketMonth MetricsBucket = "month"
+)
+
+// bucketStart returns the start of the bucket a timestamp falls into
+func bucketStart(t time.Time, bucket MetricsBucket) time.Time {
+	if bucket == MetricsBucketMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// lastPerBucket keeps the most recent snapshot in each bucket of the metrics
+// timezone. Snapshots must be in chronological order, buckets without
+// snapshots are omitted.
+func lastPerBucket[T any](snapshots []T, timestamp func(T) time.Time, bucket MetricsBucket) []T {
+	aggregated := make([]T, 0)
+	var current time.Time
+
+	for _, snapshot := range snapshots {
+		start := bucketStart(timestamp(snapshot).In(defaultTimezone()), bucket)
+
+		if len(aggregated) > 0 && start.Equal(current) {
+			aggregated[len(aggregated)-1] = snapshot
+			continue
+		}
+
+		aggregated = append(aggregated, snapshot)
+		current = start
+	}
+
+	return aggregated
+}
+
+// lastPerMonth returns one entry for each of the months calendar months ending
+// with the month of end, holding the last snapshot of the month or the zero
+// value for months without snapshots. Snapshots must be in chronological order.
+func lastPerMonth[T any](snapshots []T, timestamp func(T) time.Time, end time.Time, months int) []T {
+	monthly := make([]T, months)
+	first := bucketStart(end, MetricsBucketMonth).AddDate(0, -(months - 1), 0)
+
+	for _, snapshot := range snapshots {
+		t := timestamp(snapshot).In(end.Location())
+		i := (t.Year()-first.Year())*12 + int(t.Month()) - int(first.Month())
+		if i >= 0 && i < months {
+			monthly[i] = snapshot
+		}
+	}
+
+	return monthly
+}
+
+// GetRevenueMonthly returns the last revenue snapshot of each of the months
+// calendar months ending with the month of end, oldest first. Months without
+// snapshots are nil.
+func (db *SimpleMetricsDB) GetRevenueMonthly(ctx context.Context, mode string, end time.Time, months int) ([]*RevenueSnapshot, error) {
+	start := bucketStart(end, MetricsBucketMonth).AddDate(0, -(months - 1), 0)
+	history, err := db.GetRevenueHistory(ctx, mode, start, end, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return lastPerMonth(history, func(s *RevenueSnapshot) time.Time { return s.Timestamp }, end, months), nil
+}
+
+// GetCustomerMonthly returns the last customer snapshot of each of the months
+// calendar months ending with the month of end, oldest first. Months without
+// snapshots are nil.
+func (db *SimpleMetricsDB) GetCustomerMonthly(ctx context.Context, mode string, end time.Time, months int) ([]*CustomerSnapshot, error) {
+	start := bucketStart(end, MetricsBucketMonth).AddDate(0, -(months - 1), 0)
+	history, err := db.GetCustomerHistory(ctx, mode, start, end, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return lastPerMonth(history, func(s *CustomerSnapshot) time.Time { return s.Timestamp }, end, months), nil
+}
+
+// GetRevenueHistoryAggregated returns the last revenue snapshot of each day or
+// month in the specified period, downsampled to at most maxPoints buckets
+func (db *SimpleMetricsDB) GetRevenueHistoryAggregated(ctx context.Context, mode string, startTime, endTime time.Time, bucket MetricsBucket, maxPoints int) ([]*RevenueSnapshot, error) {
+	history, err := db.GetRevenueHistory(ctx, mode, startTime, endTime, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated := lastPerBucket(history, func(s *RevenueSnapshot) time.Time { return s.Timestamp }, bucket)
+	return downsample(aggregated, maxPoints), nil
+}
+
+// GetCustomerHistoryAggregated returns the last customer snapshot of each day or
+// month in the specified period, downsampled to at most maxPoints buckets
+func (db *SimpleMetricsDB) GetCustomerHistoryAggregated(ctx context.Context, mode string, startTime, endTime time.Time, bucket MetricsBucket, maxPoints int) ([]*CustomerSnapshot, error) {
+	history, err := db.GetCustomerHistory(ctx, mode, startTime, endTime, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated := lastPerBucket(history, func(s *CustomerSnapshot) time.Time { return s.Timestamp }, bucket)
+	return downsample(aggregated, maxPoints), nil
 }
 
-// GetLatestRevenue returns the most recent revenue snapshot
+// ErrNoSnapshot is returned by the single snapshot queries when no snapshot is
+// stored for the mode, or none matches the query
+var ErrNoSnapshot = errors.New("no snapshot stored")
+
+// GetLatestRevenue returns the most recent revenue snapshot, or ErrNoSnapshot
+// when the history is empty
 func (db *SimpleMetricsDB) GetLatestRevenue(ctx context.Context, mode string) (*RevenueSnapshot, error) {
+	db.flushWrites()
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
 	history, exists := db.revenueHistory[mode]
 	if !exists || len(history) == 0 {
-		return nil, nil
+		return nil, ErrNoSnapshot
 	}
 
 	return history[len(history)-1], nil
 }
 
-// GetLatestCustomers returns the most recent customer snapshot
+// GetLatestCustomers returns the most recent customer snapshot, or
+// ErrNoSnapshot when the history is empty
 func (db *SimpleMetricsDB) GetLatestCustomers(ctx context.Context, mode string) (*CustomerSnapshot, error) {
+	db.flushWrites()
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
 	history, exists := db.customerHistory[mode]
 	if !exists || len(history) == 0 {
-		return nil, nil
+		return nil, ErrNoSnapshot
 	}
 
 	return history[len(history)-1], nil
 }
 
-// GetDatabaseStats returns database statistics
-func (db *SimpleMetricsDB) GetDatabaseStats(ctx context.Context) (map[string]interface{}, error) {
+// nearestSnapshot returns the index of the snapshot closest to t, preferring the
+// older one on ties. Snapshots must be in chronological order and non-empty.
+func nearestSnapshot[T any](snapshots []T, timestamp func(T) time.Time, t time.Time) int {
+	i := sort.Search(len(snapshots), func(i int) bool {
+		return !timestamp(snapshots[i]).Before(t)
+	})
+
+	if i == 0 {
+		return 0
+	}
+
+	if i == len(snapshots) || t.Sub(timestamp(snapshots[i-1])) <= timestamp(snapshots[i]).Sub(t) {
+		return i - 1
+	}
+
+	return i
+}
+
+// snapshotBefore returns the index of the last snapshot at or before t, or -1
+// when every snapshot is later. Snapshots must be in chronological order.
+func snapshotBefore[T any](snapshots []T, timestamp func(T) time.Time, t time.Time) int {
+	return sort.Search(len(snapshots), func(i int) bool {
+		return timestamp(snapshots[i]).After(t)
+	}) - 1
+}
+
+// GetRevenueNearest returns the revenue snapshot closest to the given time, or
+// ErrNoSnapshot when the history is empty
+func (db *SimpleMetricsDB) GetRevenueNearest(ctx context.Context, mode string, t time.Time) (*RevenueSnapshot, error) {
+	db.flushWrites()
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	stats := make(map[string]interface{})
+	history, exists := db.revenueHistory[mode]
+	if !exists || len(history) == 0 {
+		return nil, ErrNoSnapshot
+	}
+
+	return history[nearestSnapshot(history, func(s *RevenueSnapshot) time.Time { return s.Timestamp }, t)], nil
+}
+
+// GetCustomersNearest returns the customer snapshot closest to the given time,
+// or ErrNoSnapshot when the history is empty
+func (db *SimpleMetricsDB) GetCustomersNearest(ctx context.Context, mode string, t time.Time) (*CustomerSnapshot, error) {
+	db.flushWrites()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	history, exists := db.customerHistory[mode]
+	if !exists || len(history) == 0 {
+		return nil, ErrNoSnapshot
+	}
+
+	return history[nearestSnapshot(history, func(s *CustomerSnapshot) time.Time { return s.Timestamp }, t)], nil
+}
+
+// GetSnapshotBefore returns the last revenue snapshot taken at or before the
+// given time, or ErrNoSnapshot when there is none
+func (db *SimpleMetricsDB) GetSnapshotBefore(ctx context.Context, mode string, t time.Time) (*RevenueSnapshot, error) {
+	db.flushWrites()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	history := db.revenueHistory[mode]
+	i := snapshotBefore(history, func(s *RevenueSnapshot) time.Time { return s.Timestamp }, t)
+	if i < 0 {
+		return nil, ErrNoSnapshot
+	}
+
+	return history[i], nil
+}
+
+// GetCustomersBefore returns the last customer snapshot taken at or before the
+// given time, or ErrNoSnapshot when there is none
+func (db *SimpleMetricsDB) GetCustomersBefore(ctx context.Context, mode string, t time.Time) (*CustomerSnapshot, error) {
+	db.flushWrites()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	history := db.customerHistory[mode]
+	i := snapshotBefore(history, func(s *CustomerSnapshot) time.Time { return s.Timestamp }, t)
+	if i < 0 {
+		return nil, ErrNoSnapshot
+	}
+
+	return history[i], nil
+}
+
+// SaveCustomerBaseline records an exact customer count, resetting the webhook
+// event counters for the mode
+func (db *SimpleMetricsDB) SaveCustomerBaseline(ctx context.Context, mode string, totalCustomers int, timestamp time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.customerBaselines[mode] = &CustomerCountBaseline{
+		Timestamp:      timestamp,
+		TotalCustomers: totalCustomers,
+		Mode:           mode,
+	}
+
+	return nil
+}
+
+// GetCustomerBaseline returns a copy of the last exact customer count for a mode
+func (db *SimpleMetricsDB) GetCustomerBaseline(ctx context.Context, mode string) (*CustomerCountBaseline, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	baseline, exists := db.customerBaselines[mode]
+	if !exists {
+		return nil, nil
+	}
+
+	copied := *baseline
+	return &copied, nil
+}
+
+// RecordCustomerEvent counts a customer created or deleted webhook event
+// against the current baseline. Events arriving before any baseline exists are
+// ignored since the next exact count will include them.
+func (db *SimpleMetricsDB) RecordCustomerEvent(ctx context.Context, mode string, created bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	baseline, exists := db.customerBaselines[mode]
+	if !exists {
+		return
+	}
+
+	if created {
+		baseline.CreatedSince++
+	} else {
+		baseline.DeletedSince++
+	}
+}
+
+// RecordChange notes that widgets of the given type were refreshed so that
+// replicas polling the store refresh them too
+func (db *SimpleMetricsDB) RecordChange(ctx context.Context, widgetType string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.changeSequence++
+	db.changes = append(db.changes, MetricsChange{
+		Sequence:   db.changeSequence,
+		Timestamp:  db.now(),
+		WidgetType: widgetType,
+	})
+
+	if len(db.changes) > maxChanges {
+		db.changes = db.changes[len(db.changes)-maxChanges:]
+	}
+}
+
+// GetChangesSince returns the changes recorded after the given sequence number
+func (db *SimpleMetricsDB) GetChangesSince(ctx context.Context, sequence int64) ([]MetricsChange, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var changes []MetricsChange
+	for _, change := range db.changes {
+		if change.Sequence > sequence {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
 
-	totalRevenue := 0
+// LatestChangeSequence returns the sequence number of the last recorded change
+func (db *SimpleMetricsDB) LatestChangeSequence(ctx context.Context) int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.changeSequence
+}
+
+// GetLatestSnapshotTime returns the time of the most recent revenue or customer
+// snapshot across all modes, and false if there are none
+func (db *SimpleMetricsDB) GetLatestSnapshotTime(ctx context.Context) (time.Time, bool) {
+	db.flushWrites()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var latest time.Time
 	for _, history := range db.revenueHistory {
-		totalRevenue += len(history)
+		if len(history) > 0 && history[len(history)-1].Timestamp.After(latest) {
+			latest = history[len(history)-1].Timestamp
+		}
 	}
 
-	totalCustomer := 0
 	for _, history := range db.customerHistory {
-		totalCustomer += len(history)
+		if len(history) > 0 && history[len(history)-1].Timestamp.After(latest) {
+			latest = history[len(history)-1].Timestamp
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
+
+// DatabaseStats holds metrics database statistics
+type DatabaseStats struct {
+	RevenueMetricsCount  int                   `json:"revenue_metrics_count"`
+	CustomerMetricsCount int                   `json:"customer_metrics_count"`
+	Modes                int                   `json:"modes"`
+	SkippedDuplicates    int                   `json:"skipped_duplicates"`
+	ApproxBytes          int64                 `json:"approx_bytes"`
+	TotalSnapshots       int                   `json:"total_snapshots"` // Snapshots and webhook deltas across all modes
+	BudgetBytes          int64                 `json:"budget_bytes,omitempty"`
+	BudgetSnapshots      int                   `json:"budget_snapshots,omitempty"`
+	EvictedSnapshots     int                   `json:"evicted_snapshots"`
+	PerMode              map[string]*ModeStats `json:"per_mode"`
+}
+
+// ModeStats holds the statistics of the snapshots stored for a single mode
+type ModeStats struct {
+	RevenueSnapshots  int        `json:"revenue_snapshots"`
+	CustomerSnapshots int        `json:"customer_snapshots"`
+	OldestRevenueAt   *time.Time `json:"oldest_revenue_at,omitempty"`
+	NewestRevenueAt   *time.Time `json:"newest_revenue_at,omitempty"`
+	OldestCustomerAt  *time.Time `json:"oldest_customer_at,omitempty"`
+	NewestCustomerAt  *time.Time `json:"newest_customer_at,omitempty"`
+	Deltas            int        `json:"deltas"`
+	ApproxBytes       int64      `json:"approx_bytes"`
+}
+
+// Approximate memory held by a stored snapshot, including the slice pointer
+var (
+	revenueSnapshotBytes  = int64(reflect.TypeFor[RevenueSnapshot]().Size() + reflect.TypeFor[*RevenueSnapshot]().Size())
+	customerSnapshotBytes = int64(reflect.TypeFor[CustomerSnapshot]().Size() + reflect.TypeFor[*CustomerSnapshot]().Size())
+	deltaBytes            = int64(reflect.TypeFor[MetricsDelta]().Size() + reflect.TypeFor[*MetricsDelta]().Size())
+)
+
+// GetDatabaseStats returns database statistics, in total and per mode
+func (db *SimpleMetricsDB) GetDatabaseStats(ctx context.Context) (*DatabaseStats, error) {
+	db.flushWrites()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stats := &DatabaseStats{
+		SkippedDuplicates: db.skippedDuplicates,
+		BudgetBytes:       db.budgetBytes,
+		BudgetSnapshots:   db.budgetSnapshots,
+		EvictedSnapshots:  db.evictedSnapshots,
+		PerMode:           make(map[string]*ModeStats),
+	}
+
+	modeStats := func(mode string) *ModeStats {
+		if _, ok := stats.PerMode[mode]; !ok {
+			stats.PerMode[mode] = &ModeStats{}
+		}
+		return stats.PerMode[mode]
+	}
+
+	for mode, history := range db.revenueHistory {
+		if len(history) == 0 {
+			continue
+		}
+
+		ms := modeStats(mode)
+		ms.RevenueSnapshots = len(history)
+		oldest, newest := history[0].Timestamp, history[len(history)-1].Timestamp
+		ms.OldestRevenueAt, ms.NewestRevenueAt = &oldest, &newest
+		ms.ApproxBytes += int64(len(history)) * revenueSnapshotBytes
+		stats.RevenueMetricsCount += len(history)
+	}
+
+	for mode, history := range db.customerHistory {
+		if len(history) == 0 {
+			continue
+		}
+
+		ms := modeStats(mode)
+		ms.CustomerSnapshots = len(history)
+		oldest, newest := history[0].Timestamp, history[len(history)-1].Timestamp
+		ms.OldestCustomerAt, ms.NewestCustomerAt = &oldest, &newest
+		ms.ApproxBytes += int64(len(history)) * customerSnapshotBytes
+		stats.CustomerMetricsCount += len(history)
 	}
 
-	stats["revenue_metrics_count"] = totalRevenue
-	stats["customer_metrics_count"] = totalCustomer
-	stats["modes"] = len(db.revenueHistory)
+	for mode, deltas := range db.deltas {
+		if len(deltas) == 0 {
+			continue
+		}
+
+		ms := modeStats(mode)
+		ms.Deltas = len(deltas)
+		ms.ApproxBytes += int64(len(deltas)) * deltaBytes
+	}
+
+	for _, ms := range stats.PerMode {
+		stats.ApproxBytes += ms.ApproxBytes
+		stats.TotalSnapshots += ms.RevenueSnapshots + ms.CustomerSnapshots + ms.Deltas
+	}
+	stats.Modes = len(stats.PerMode)
 
 	return stats, nil
 }
 
 // CleanupOldMetrics removes metrics older than the specified duration
-func (db *SimpleMetricsDB) CleanupOldMetrics(ctx context.Context, retentionPeriod time.Duration) error {
+func (db *SimpleMetricsDB) CleanupOldMetrics(ctx context.Context, retentionPeriod time.Duration) (*MetricsCleanupResult, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.applyQueuedWrites()
 
-	cutoff := time.Now().Add(-retentionPeriod)
+	cutoff := db.now().Add(-retentionPeriod)
+	result := &MetricsCleanupResult{
+		RevenueRemoved:  make(map[string]int),
+		CustomerRemoved: make(map[string]int),
+		DeltasRemoved:   make(map[string]int),
+	}
 
 	// Clean revenue history
 	for mode, history := range db.revenueHistory {
@@ -205,6 +1042,7 @@ func (db *SimpleMetricsDB) CleanupOldMetrics(ctx context.Context, retentionPerio
 			}
 		}
 		db.revenueHistory[mode] = filtered
+		result.RevenueRemoved[mode] = len(history) - len(filtered)
 	}
 
 	// Clean customer history
@@ -216,15 +1054,138 @@ func (db *SimpleMetricsDB) CleanupOldMetrics(ctx context.Context, retentionPerio
 			}
 		}
 		db.customerHistory[mode] = filtered
+		result.CustomerRemoved[mode] = len(history) - len(filtered)
 	}
 
-	slog.Info("Cleaned up old metrics", "cutoff", cutoff)
-	return nil
+	// Clean webhook deltas
+	for mode, deltas := range db.deltas {
+		filtered := make([]*MetricsDelta, 0)
+		for _, delta := range deltas {
+			if delta.Timestamp.After(cutoff) {
+				filtered = append(filtered, delta)
+			}
+		}
+		db.deltas[mode] = filtered
+		result.DeltasRemoved[mode] = len(deltas) - len(filtered)
+	}
+
+	return result, nil
+}
+
+// MetricsPurgeResult reports how many snapshots, deltas and annotations were
+// removed from a mode
+type MetricsPurgeResult struct {
+	RevenueDeleted     int
+	CustomerDeleted    int
+	DeltasDeleted      int
+	AnnotationsDeleted int
+}
+
+// PurgeMode removes every revenue and customer snapshot, webhook delta,
+// annotation and customer count baseline stored for a mode, including those
+// of every account. Given a key of a single account from metricsKey, only that
+// account is removed.
+func (db *SimpleMetricsDB) PurgeMode(ctx context.Context, mode string) (*MetricsPurgeResult, error) {
+	if globalPause.isPaused() {
+		return nil, errAdministrativelyPaused
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.applyQueuedWrites()
+
+	matches := func(key string) bool {
+		return key == mode || strings.HasPrefix(key, mode+"/")
+	}
+
+	result := &MetricsPurgeResult{}
+	for key, history := range db.revenueHistory {
+		if matches(key) {
+			result.RevenueDeleted += len(history)
+			delete(db.revenueHistory, key)
+		}
+	}
+
+	for key, history := range db.customerHistory {
+		if matches(key) {
+			result.CustomerDeleted += len(history)
+			delete(db.customerHistory, key)
+		}
+	}
+
+	for key, deltas := range db.deltas {
+		if matches(key) {
+			result.DeltasDeleted += len(deltas)
+			delete(db.deltas, key)
+		}
+	}
+
+	for key, annotations := range db.annotations {
+		if matches(key) {
+			result.AnnotationsDeleted += len(annotations)
+			delete(db.annotations, key)
+		}
+	}
+
+	// The customer count baseline goes with the snapshots, for the next
+	// update to count the customers again
+	for key := range db.customerBaselines {
+		if matches(key) {
+			delete(db.customerBaselines, key)
+		}
+	}
+
+	return result, nil
+}
+
+// newMetricsCleanupJob returns a background job that prunes snapshots older
+// than the retention period
+func newMetricsCleanupJob(db *SimpleMetricsDB, interval, retention time.Duration) *backgroundJob {
+	return &backgroundJob{
+		name:    "metrics-cleanup",
+		nextRun: everyInterval(interval),
+		run: func(ctx context.Context) {
+			result, err := db.CleanupOldMetrics(ctx, retention)
+			if err != nil {
+				slog.Error("Failed to clean up old metrics", "error", err)
+				return
+			}
+
+			for mode, removed := range result.RevenueRemoved {
+				if removed > 0 {
+					slog.Info("Cleaned up old revenue snapshots", "mode", mode, "removed", removed)
+				}
+			}
+
+			for mode, removed := range result.CustomerRemoved {
+				if removed > 0 {
+					slog.Info("Cleaned up old customer snapshots", "mode", mode, "removed", removed)
+				}
+			}
+
+			for mode, removed := range result.DeltasRemoved {
+				if removed > 0 {
+					slog.Info("Cleaned up old webhook deltas", "mode", mode, "removed", removed)
+				}
+			}
+		},
+	}
 }
 
-// Close is a no-op for in-memory database
+// Close stops the flusher after applying every queued snapshot and saves
+// metrics when persistence is set. Saving again afterwards starts a new flusher.
 func (db *SimpleMetricsDB) Close() error {
-	return nil
+	db.queueMu.Lock()
+	stop, done := db.stopFlusher, db.flusherDone
+	db.stopFlusher, db.flusherDone = nil, nil
+	db.queueMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	return db.Persist()
 }
 
 // GetMetricsDatabase returns the simple metrics database (compatibility wrapper)
@@ -0,0 +1,693 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimpleMetricsDB_CleanupOldMetrics(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.now = func() time.Time { return clock }
+
+	for _, snapshot := range []*RevenueSnapshot{
+		{Timestamp: clock.AddDate(0, 0, -40), MRR: 100, Mode: "live"},
+		{Timestamp: clock.AddDate(0, 0, -10), MRR: 200, Mode: "live"},
+		{Timestamp: clock.AddDate(0, 0, -35), MRR: 10, Mode: "test"},
+	} {
+		db.SaveRevenueSnapshot(ctx, snapshot)
+	}
+
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: clock.AddDate(0, 0, -5), TotalCustomers: 3, Mode: "live"})
+
+	result, err := db.CleanupOldMetrics(ctx, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.RevenueRemoved["live"] != 1 || result.RevenueRemoved["test"] != 1 {
+		t.Errorf("expected 1 revenue snapshot removed per mode, got %v", result.RevenueRemoved)
+	}
+
+	if result.CustomerRemoved["live"] != 0 {
+		t.Errorf("expected no customer snapshots removed, got %v", result.CustomerRemoved)
+	}
+
+	// Advance the clock so the remaining snapshots age out
+	clock = clock.AddDate(0, 0, 30)
+
+	result, err = db.CleanupOldMetrics(ctx, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.RevenueRemoved["live"] != 1 || result.CustomerRemoved["live"] != 1 {
+		t.Errorf("expected remaining live snapshots to be removed, got %v / %v", result.RevenueRemoved, result.CustomerRemoved)
+	}
+
+	latest, _ := db.GetLatestRevenue(ctx, "live")
+	if latest != nil {
+		t.Errorf("expected no revenue snapshots left, got %+v", latest)
+	}
+}
+
+func TestSimpleMetricsDB_CleanupConcurrentWithSaves(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now(), Mode: "live"})
+		}()
+		go func() {
+			defer wg.Done()
+			db.CleanupOldMetrics(ctx, time.Hour)
+		}()
+	}
+	wg.Wait()
+
+	history, _ := db.GetRevenueHistory(ctx, "live", time.Now().Add(-time.Hour), time.Now(), 0)
+	if len(history) != 50 {
+		t.Errorf("expected all 50 recent snapshots to survive cleanup, got %d", len(history))
+	}
+}
+
+func TestSimpleMetricsDB_GetRevenueHistoryAggregated(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	// Hourly snapshots in January, nothing in February, a partial March
+	for _, snapshot := range []*RevenueSnapshot{
+		{Timestamp: at(time.January, 10, 1), MRR: 100, Mode: "live"},
+		{Timestamp: at(time.January, 10, 2), MRR: 110, Mode: "live"},
+		{Timestamp: at(time.January, 31, 23), MRR: 120, Mode: "live"},
+		{Timestamp: at(time.March, 2, 5), MRR: 150, Mode: "live"},
+		{Timestamp: at(time.March, 2, 6), MRR: 155, Mode: "live"},
+	} {
+		db.SaveRevenueSnapshot(ctx, snapshot)
+	}
+
+	t.Run("monthly keeps last snapshot and skips gaps", func(t *testing.T) {
+		history, err := db.GetRevenueHistoryAggregated(ctx, "live", at(time.January, 1, 0), at(time.April, 1, 0), MetricsBucketMonth, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []float64{120, 155}
+		if len(history) != len(expected) {
+			t.Fatalf("expected %d monthly points, got %d", len(expected), len(history))
+		}
+
+		for i, snapshot := range history {
+			if snapshot.MRR != expected[i] {
+				t.Errorf("point %d: expected MRR %f, got %f", i, expected[i], snapshot.MRR)
+			}
+		}
+	})
+
+	t.Run("partial month at start of range", func(t *testing.T) {
+		history, err := db.GetRevenueHistoryAggregated(ctx, "live", at(time.January, 20, 0), at(time.March, 2, 5), MetricsBucketMonth, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(history) != 2 || history[0].MRR != 120 || history[1].MRR != 150 {
+			t.Errorf("expected January 31st and the first March snapshot, got %d points", len(history))
+		}
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		history, err := db.GetRevenueHistoryAggregated(ctx, "live", at(time.January, 1, 0), at(time.April, 1, 0), MetricsBucketDay, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(history) != 3 {
+			t.Errorf("expected 3 daily points, got %d", len(history))
+		}
+	})
+}
+
+func TestSimpleMetricsDB_HistoryDownsampling(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// One snapshot per month for two years
+	for i := 0; i < 24; i++ {
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start.AddDate(0, i, 0), MRR: float64(i), Mode: "live"})
+	}
+
+	end := start.AddDate(2, 0, 0)
+
+	tests := []struct {
+		name      string
+		maxPoints int
+		expected  []float64
+	}{
+		{name: "no limit", maxPoints: 0, expected: nil},
+		{name: "limit above length", maxPoints: 30, expected: nil},
+		{name: "single point is most recent", maxPoints: 1, expected: []float64{23}},
+		{name: "keeps first and most recent", maxPoints: 4, expected: []float64{0, 7, 15, 23}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history, err := db.GetRevenueHistory(ctx, "live", start, end, tt.maxPoints)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.expected == nil {
+				if len(history) != 24 {
+					t.Errorf("expected all 24 snapshots, got %d", len(history))
+				}
+				return
+			}
+
+			if len(history) != len(tt.expected) {
+				t.Fatalf("expected %d snapshots, got %d", len(tt.expected), len(history))
+			}
+
+			for i, snapshot := range history {
+				if snapshot.MRR != tt.expected[i] {
+					t.Errorf("point %d: expected MRR %f, got %f", i, tt.expected[i], snapshot.MRR)
+				}
+			}
+		})
+	}
+
+	t.Run("aggregated history keeps the latest month", func(t *testing.T) {
+		monthly, err := db.GetRevenueHistoryAggregated(ctx, "live", start, end, MetricsBucketMonth, defaultTrendMonths)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(monthly) != defaultTrendMonths || monthly[len(monthly)-1].MRR != 23 {
+			t.Errorf("expected %d months ending with the latest, got %d", defaultTrendMonths, len(monthly))
+		}
+	})
+}
+
+func TestSimpleMetricsDB_Deduplication(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		window      time.Duration
+		tolerance   float64
+		offset      time.Duration
+		mrr         float64
+		wantSkipped int
+	}{
+		{name: "disabled", window: 0, offset: time.Minute, mrr: 100, wantSkipped: 0},
+		{name: "identical within window", window: 15 * time.Minute, offset: time.Minute, mrr: 100, wantSkipped: 1},
+		{name: "identical outside window", window: 15 * time.Minute, offset: 20 * time.Minute, mrr: 100, wantSkipped: 0},
+		{name: "changed within window", window: 15 * time.Minute, offset: time.Minute, mrr: 101, wantSkipped: 0},
+		{name: "within tolerance", window: 15 * time.Minute, tolerance: 0.5, offset: time.Minute, mrr: 100.25, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSimpleMetricsDB()
+			db.SetDeduplication(tt.window, tt.tolerance)
+
+			db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start, MRR: 100, Mode: "live"})
+			db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start.Add(tt.offset), MRR: tt.mrr, Mode: "live"})
+
+			// Snapshots for another mode are never compared
+			db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start.Add(tt.offset), MRR: 100, Mode: "test"})
+
+			stats, _ := db.GetDatabaseStats(ctx)
+			if stats.SkippedDuplicates != tt.wantSkipped {
+				t.Errorf("expected %d skipped snapshots, got %d", tt.wantSkipped, stats.SkippedDuplicates)
+			}
+
+			if stats.RevenueMetricsCount != 3-tt.wantSkipped {
+				t.Errorf("expected %d stored snapshots, got %d", 3-tt.wantSkipped, stats.RevenueMetricsCount)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_GetRevenueNearest(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	day := func(d int) time.Time { return time.Date(2026, time.March, d, 0, 0, 0, 0, time.UTC) }
+
+	if snapshot, err := db.GetRevenueNearest(ctx, "live", day(1)); !errors.Is(err, ErrNoSnapshot) {
+		t.Fatalf("expected ErrNoSnapshot from empty history, got %+v, %v", snapshot, err)
+	}
+
+	for _, d := range []int{5, 10, 20} {
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: day(d), MRR: float64(d), Mode: "live"})
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected float64
+	}{
+		{name: "before oldest falls back to oldest", at: day(1), expected: 5},
+		{name: "exact match", at: day(10), expected: 10},
+		{name: "closer to earlier", at: day(12), expected: 10},
+		{name: "closer to later", at: day(18), expected: 20},
+		{name: "tie prefers earlier", at: day(15), expected: 10},
+		{name: "after latest", at: day(30), expected: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := db.GetRevenueNearest(ctx, "live", tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if snapshot == nil || snapshot.MRR != tt.expected {
+				t.Errorf("expected snapshot with MRR %f, got %+v", tt.expected, snapshot)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_GetSnapshotBefore(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	day := func(d int) time.Time { return time.Date(2026, time.March, d, 0, 0, 0, 0, time.UTC) }
+
+	for _, d := range []int{5, 10, 20} {
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: day(d), MRR: float64(d), Mode: "live"})
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		at          time.Time
+		expected    float64
+		expectedErr error
+	}{
+		{name: "before oldest", mode: "live", at: day(1), expectedErr: ErrNoSnapshot},
+		{name: "exact match", mode: "live", at: day(10), expected: 10},
+		{name: "between snapshots takes the earlier", mode: "live", at: day(18), expected: 10},
+		{name: "after latest", mode: "live", at: day(30), expected: 20},
+		{name: "empty mode", mode: "test", at: day(30), expectedErr: ErrNoSnapshot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := db.GetSnapshotBefore(ctx, tt.mode, tt.at)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+
+			if tt.expectedErr == nil && snapshot.MRR != tt.expected {
+				t.Errorf("expected snapshot with MRR %f, got %+v", tt.expected, snapshot)
+			}
+		})
+	}
+
+	if _, err := db.GetLatestCustomers(ctx, "live"); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected ErrNoSnapshot without customer snapshots, got %v", err)
+	}
+}
+
+func TestSimpleMetricsDB_GetDatabaseStats(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	day := func(d int) time.Time { return time.Date(2026, time.March, d, 0, 0, 0, 0, time.UTC) }
+
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: day(1), MRR: 100, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: day(5), MRR: 110, Mode: "live"})
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: day(3), TotalCustomers: 10, Mode: "live"})
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: day(2), TotalCustomers: 4, Mode: "test"})
+
+	stats, err := db.GetDatabaseStats(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stats.Modes != 2 || stats.RevenueMetricsCount != 2 || stats.CustomerMetricsCount != 2 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+
+	live := stats.PerMode["live"]
+	if live == nil || live.RevenueSnapshots != 2 || live.CustomerSnapshots != 1 {
+		t.Fatalf("unexpected live stats: %+v", live)
+	}
+
+	if !live.OldestRevenueAt.Equal(day(1)) || !live.NewestRevenueAt.Equal(day(5)) || !live.NewestCustomerAt.Equal(day(3)) {
+		t.Errorf("unexpected live timestamps: %v %v %v", live.OldestRevenueAt, live.NewestRevenueAt, live.NewestCustomerAt)
+	}
+
+	test := stats.PerMode["test"]
+	if test == nil || test.RevenueSnapshots != 0 || test.NewestRevenueAt != nil || test.CustomerSnapshots != 1 {
+		t.Errorf("unexpected test stats: %+v", test)
+	}
+
+	if stats.ApproxBytes != live.ApproxBytes+test.ApproxBytes || test.ApproxBytes != customerSnapshotBytes {
+		t.Errorf("unexpected approximate size: total %d, live %d, test %d", stats.ApproxBytes, live.ApproxBytes, test.ApproxBytes)
+	}
+}
+
+func TestStaleRevenueModes(t *testing.T) {
+	now := startTime.Add(24 * time.Hour)
+	recent := now.Add(-time.Hour)
+	old := now.Add(-3 * time.Hour)
+	stats := &DatabaseStats{PerMode: map[string]*ModeStats{
+		"live": {NewestRevenueAt: &recent},
+		"test": {NewestRevenueAt: &old},
+	}}
+
+	tests := []struct {
+		name       string
+		modes      []string
+		staleAfter time.Duration
+		now        time.Time
+		expected   []string
+	}{
+		{name: "disabled", modes: []string{"live", "test"}, staleAfter: 0, now: now},
+		{name: "fresh", modes: []string{"live"}, staleAfter: 2 * time.Hour, now: now},
+		{name: "stale", modes: []string{"live", "test"}, staleAfter: 2 * time.Hour, now: now, expected: []string{"test"}},
+		{name: "mode without snapshots after startup", modes: []string{"other"}, staleAfter: 2 * time.Hour, now: now, expected: []string{"other"}},
+		{name: "mode without snapshots during startup", modes: []string{"other"}, staleAfter: 2 * time.Hour, now: startTime.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale := staleRevenueModes(stats, tt.modes, tt.staleAfter, tt.now)
+			if !slices.Equal(stale, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, stale)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_PurgeMode(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	start := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 3 {
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start.Add(time.Duration(i) * time.Hour), MRR: float64(i), Mode: "test"})
+		db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: start.Add(time.Duration(i) * time.Hour), TotalCustomers: i, Mode: "test"})
+	}
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start, MRR: 100, Mode: "live"})
+
+	result, err := db.PurgeMode(ctx, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.RevenueDeleted != 3 || result.CustomerDeleted != 3 {
+		t.Errorf("expected 3 revenue and 3 customer snapshots deleted, got %+v", result)
+	}
+
+	stats, _ := db.GetDatabaseStats(ctx)
+	if _, ok := stats.PerMode["test"]; ok || stats.Modes != 1 || stats.RevenueMetricsCount != 1 {
+		t.Errorf("expected only live snapshots to remain, got %+v", stats)
+	}
+
+	if result, _ := db.PurgeMode(ctx, "test"); result.RevenueDeleted != 0 || result.CustomerDeleted != 0 {
+		t.Errorf("expected purging an empty mode to delete nothing, got %+v", result)
+	}
+}
+
+func TestSimpleMetricsDB_OutOfOrderSaves(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	at := func(month time.Month, day int) time.Time { return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC) }
+
+	for _, snapshot := range []*RevenueSnapshot{
+		{Timestamp: at(time.March, 10), MRR: 3},
+		{Timestamp: at(time.January, 10), MRR: 1},
+		{Timestamp: at(time.March, 1), MRR: 2},
+		{Timestamp: at(time.May, 20), MRR: 5},
+	} {
+		snapshot.Mode = "live"
+		db.SaveRevenueSnapshot(ctx, snapshot)
+	}
+
+	history, _ := db.GetRevenueHistory(ctx, "live", at(time.January, 1), at(time.December, 31), 0)
+	for i := 1; i < len(history); i++ {
+		if history[i].Timestamp.Before(history[i-1].Timestamp) {
+			t.Fatalf("history is not chronological at %d: %s before %s", i, history[i].Timestamp, history[i-1].Timestamp)
+		}
+	}
+
+	if latest, _ := db.GetLatestRevenue(ctx, "live"); latest.MRR != 5 {
+		t.Errorf("expected the newest snapshot to be the latest, got MRR %f", latest.MRR)
+	}
+
+	t.Run("one point per month", func(t *testing.T) {
+		monthly, err := db.GetRevenueMonthly(ctx, "live", at(time.June, 15), 6)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// January, March and May have snapshots, February, April and June don't
+		expected := []float64{1, -1, 3, -1, 5, -1}
+		if len(monthly) != len(expected) {
+			t.Fatalf("expected %d months, got %d", len(expected), len(monthly))
+		}
+
+		for i, snapshot := range monthly {
+			if expected[i] < 0 {
+				if snapshot != nil {
+					t.Errorf("month %d: expected no snapshot, got MRR %f", i, snapshot.MRR)
+				}
+				continue
+			}
+
+			if snapshot == nil || snapshot.MRR != expected[i] {
+				t.Errorf("month %d: expected MRR %f, got %+v", i, expected[i], snapshot)
+			}
+		}
+	})
+
+	t.Run("months before the range are left out", func(t *testing.T) {
+		monthly, _ := db.GetRevenueMonthly(ctx, "live", at(time.May, 31), 2)
+		if len(monthly) != 2 || monthly[0] != nil || monthly[1] == nil || monthly[1].MRR != 5 {
+			t.Errorf("expected April empty and May with MRR 5, got %+v", monthly)
+		}
+	})
+}
+
+func TestSimpleMetricsDB_QueuedWrites(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	base := time.Now().Add(-time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timestamp := base.Add(time.Duration(i) * time.Second)
+			if i%2 == 0 {
+				db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timestamp, MRR: float64(i), Mode: "live"})
+			} else {
+				db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: timestamp, TotalCustomers: i, Mode: "live"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revenue, _ := db.GetRevenueHistory(ctx, "live", base, time.Now(), 0)
+	customers, _ := db.GetCustomerHistory(ctx, "live", base, time.Now(), 0)
+	if len(revenue) != 500 || len(customers) != 500 {
+		t.Fatalf("expected 500 revenue and 500 customer snapshots, got %d and %d", len(revenue), len(customers))
+	}
+
+	if !slices.IsSortedFunc(revenue, func(a, b *RevenueSnapshot) int { return a.Timestamp.Compare(b.Timestamp) }) {
+		t.Error("expected revenue history in chronological order")
+	}
+
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now(), MRR: 5000, Mode: "live"})
+	if latest, _ := db.GetLatestRevenue(ctx, "live"); latest == nil || latest.MRR != 5000 {
+		t.Errorf("expected a read to see the snapshot saved after close, got %+v", latest)
+	}
+	db.Close()
+}
+
+func TestSimpleMetricsDB_SaveErrorsBeforeQueuing(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	db.SetDeduplication(time.Hour, 0)
+	now := time.Now()
+
+	globalPause.pause()
+	err := db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: now, TotalCustomers: 1, Mode: "live"})
+	globalPause.resume()
+
+	if !errors.Is(err, errAdministrativelyPaused) {
+		t.Errorf("expected the paused save to be refused, got %v", err)
+	}
+
+	db.queueMu.Lock()
+	queued := len(db.queue)
+	db.queueMu.Unlock()
+	if queued != 0 {
+		t.Fatalf("expected the refused snapshot not to be queued, got %d queued", queued)
+	}
+
+	// Duplicates are only known once applied, and aren't an error
+	for i := range 2 {
+		if err := db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: now.Add(time.Duration(i) * time.Minute), TotalCustomers: 2, Mode: "live"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	stats, _ := db.GetDatabaseStats(ctx)
+	if stats.CustomerMetricsCount != 1 || stats.SkippedDuplicates != 1 {
+		t.Errorf("expected the repeated snapshot to be skipped and counted, got %+v", stats)
+	}
+	db.Close()
+}
+
+func TestSimpleMetricsDB_KeepsHistoryWithinRetention(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	now := time.Now()
+	db.now = func() time.Time { return now }
+	start := now.AddDate(0, 0, -30).Add(time.Hour)
+
+	// A month of hourly saves up to now, as the scheduler makes them
+	hours := 30 * 24
+	for i := 0; i < hours; i++ {
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: start.Add(time.Duration(i) * time.Hour), MRR: float64(i), Mode: "live"})
+	}
+
+	revenue, _ := db.GetRevenueHistory(ctx, "live", start, now, 0)
+	if len(revenue) != hours || !revenue[0].Timestamp.Equal(start) {
+		t.Fatalf("expected all %d hourly snapshots back to %s, got %d", hours, start, len(revenue))
+	}
+
+	if _, err := db.CleanupOldMetrics(ctx, 7*24*time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revenue, _ = db.GetRevenueHistory(ctx, "live", start, now, 0)
+	if len(revenue) != 7*24 {
+		t.Errorf("expected the retention to keep the last week, got %d snapshots", len(revenue))
+	}
+}
+
+func TestSimpleMetricsDB_Budget(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	day := func(d int) time.Time { return now.AddDate(0, 0, d-30) }
+
+	tests := []struct {
+		name              string
+		maxBytes          int64
+		maxSnapshots      int
+		expectedLive      int
+		expectedTest      int
+		expectedDeltas    int
+		expectedOldestDay int
+	}{
+		{
+			name:              "snapshot count evicts oldest across modes",
+			maxSnapshots:      6,
+			expectedLive:      3,
+			expectedTest:      2,
+			expectedDeltas:    1,
+			expectedOldestDay: 4,
+		},
+		{
+			name:              "size",
+			maxBytes:          deltaBytes + 3*revenueSnapshotBytes,
+			expectedLive:      2,
+			expectedTest:      1,
+			expectedDeltas:    1,
+			expectedOldestDay: 8,
+		},
+		{
+			name:              "no budget",
+			expectedLive:      5,
+			expectedTest:      3,
+			expectedDeltas:    1,
+			expectedOldestDay: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSimpleMetricsDB()
+			db.SetBudget(tt.maxBytes, tt.maxSnapshots)
+
+			for _, d := range []int{0, 2, 4, 8, 10} {
+				db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: day(d), Mode: "live"})
+			}
+			for _, d := range []int{1, 5, 9} {
+				db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: day(d), Mode: "test"})
+			}
+			db.SaveDelta(ctx, &MetricsDelta{Timestamp: day(11), Mode: "live"})
+
+			live, _ := db.GetRevenueHistory(ctx, "live", day(-1), now, 0)
+			test, _ := db.GetRevenueHistory(ctx, "test", day(-1), now, 0)
+			deltas, _ := db.GetDeltas(ctx, "live", day(-1), now)
+			if len(live) != tt.expectedLive || len(test) != tt.expectedTest || len(deltas) != tt.expectedDeltas {
+				t.Fatalf("expected %d live, %d test and %d deltas, got %d, %d and %d",
+					tt.expectedLive, tt.expectedTest, tt.expectedDeltas, len(live), len(test), len(deltas))
+			}
+
+			if !live[0].Timestamp.Equal(day(tt.expectedOldestDay)) {
+				t.Errorf("expected oldest live snapshot from day %d, got %s", tt.expectedOldestDay, live[0].Timestamp)
+			}
+
+			stats, _ := db.GetDatabaseStats(ctx)
+			if stats.TotalSnapshots != tt.expectedLive+tt.expectedTest+tt.expectedDeltas || stats.EvictedSnapshots != 9-stats.TotalSnapshots {
+				t.Errorf("unexpected usage: %d stored, %d evicted", stats.TotalSnapshots, stats.EvictedSnapshots)
+			}
+
+			if usage := storeBudgetUsage(stats); (tt.maxBytes > 0 || tt.maxSnapshots > 0) != (usage > 0.5) {
+				t.Errorf("unexpected budget usage %v", usage)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_Accounts(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	now := time.Now()
+
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: now.Add(-2 * time.Hour), MRR: 100, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: now.Add(-time.Hour), MRR: 5000, Mode: "live", Account: "eu"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: now, MRR: 110, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: now, MRR: 7, Mode: "test", Account: "eu"})
+
+	defaultAccount, _ := db.GetRevenueHistory(ctx, metricsKey("live", ""), now.Add(-3*time.Hour), now, 0)
+	eu, _ := db.GetRevenueHistory(ctx, metricsKey("live", "eu"), now.Add(-3*time.Hour), now, 0)
+	if len(defaultAccount) != 2 || defaultAccount[1].MRR != 110 || len(eu) != 1 || eu[0].MRR != 5000 {
+		t.Fatalf("expected separate histories per account, got %d default and %d eu snapshots", len(defaultAccount), len(eu))
+	}
+
+	result, _ := db.PurgeMode(ctx, "live")
+	if result.RevenueDeleted != 3 {
+		t.Errorf("expected purging a mode to remove every account, removed %d", result.RevenueDeleted)
+	}
+
+	if latest, _ := db.GetLatestRevenue(ctx, metricsKey("test", "eu")); latest == nil {
+		t.Error("expected the test mode to be kept")
+	}
+}
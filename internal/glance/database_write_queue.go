@@ -0,0 +1,95 @@
+package glance
+
+import "time"
+
+const (
+	// writeBatchSize is how many queued snapshots wake the flusher before its
+	// next tick
+	writeBatchSize = 64
+	// writeFlushInterval is how often the flusher applies queued snapshots
+	writeFlushInterval = 100 * time.Millisecond
+)
+
+// queuedWrite is a saved snapshot waiting to be applied, only one of the
+// fields is set
+type queuedWrite struct {
+	revenue  *RevenueSnapshot
+	customer *CustomerSnapshot
+}
+
+// enqueueWrite queues a snapshot for the flusher so that saving doesn't wait
+// on the database lock, starting the flusher if it isn't running
+func (db *SimpleMetricsDB) enqueueWrite(write queuedWrite) {
+	db.queueMu.Lock()
+	defer db.queueMu.Unlock()
+
+	db.queue = append(db.queue, write)
+
+	if db.stopFlusher == nil {
+		db.stopFlusher, db.flusherDone = make(chan struct{}), make(chan struct{})
+		go db.runFlusher(db.stopFlusher, db.flusherDone)
+	}
+
+	if len(db.queue) >= writeBatchSize {
+		select {
+		case db.flushNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (db *SimpleMetricsDB) runFlusher(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(writeFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-db.flushNow:
+			db.flushWrites()
+		case <-ticker.C:
+			db.flushWrites()
+		}
+	}
+}
+
+// flushWrites applies every queued snapshot. Reads call it before taking the
+// read lock so that they see every snapshot saved before them.
+func (db *SimpleMetricsDB) flushWrites() {
+	db.queueMu.Lock()
+	pending := len(db.queue)
+	db.queueMu.Unlock()
+
+	if pending == 0 {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.applyQueuedWrites()
+}
+
+// applyQueuedWrites applies queued snapshots in the order they were saved. Must
+// be called with the lock held, which also keeps batches from being applied out
+// of order.
+func (db *SimpleMetricsDB) applyQueuedWrites() {
+	db.queueMu.Lock()
+	batch := db.queue
+	db.queue = nil
+	db.queueMu.Unlock()
+
+	for _, write := range batch {
+		if write.revenue != nil {
+			db.saveRevenueSnapshot(write.revenue)
+		} else {
+			db.saveCustomerSnapshot(write.customer)
+		}
+	}
+
+	if len(batch) > 0 {
+		db.enforceBudget()
+	}
+}
@@ -66,25 +66,11 @@ func (e *EncryptionService) Encrypt(plaintext string) (string, error) {
 		return cached.(string), nil
 	}
 
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-
-	block, err := aes.NewCipher(e.key)
+	ciphertext, err := e.EncryptBytes([]byte(plaintext))
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("failed to generate nonce: %w", err)
+		return "", err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 	encoded := base64.StdEncoding.EncodeToString(ciphertext)
 
 	// Cache the result
@@ -99,36 +85,70 @@ func (e *EncryptionService) Decrypt(ciphertext string) (string, error) {
 		return "", nil
 	}
 
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	plaintext, err := e.DecryptBytes(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptBytes encrypts data using AES-256-GCM, prefixed with the nonce.
+// Unlike Encrypt the result isn't cached, so it suits large values.
+func (e *EncryptionService) EncryptBytes(plaintext []byte) ([]byte, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	block, err := aes.NewCipher(e.key)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// DecryptBytes decrypts data returned by EncryptBytes
+func (e *EncryptionService) DecryptBytes(data []byte) ([]byte, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	block, err := aes.NewCipher(e.key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+		return nil, fmt.Errorf("ciphertext too short")
 	}
 
 	nonce, ciphertextBytes := data[:nonceSize], data[nonceSize:]
 	plaintext, err := gcm.Open(nil, nonce, ciphertextBytes, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
 
-	return string(plaintext), nil
+	return plaintext, nil
 }
 
 // EncryptIfNeeded encrypts a value if it doesn't start with "encrypted:"
@@ -5,11 +5,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
-	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
@@ -39,22 +39,38 @@ type application struct {
 
 	slugToPage map[string]*page
 	widgetByID map[uint64]widget
+	widgetPage map[uint64]*page
+
+	// Widget refreshes pushed to browsers, see widget_events.go
+	widgetEvents *widgetEventBroker
+
+	// Refreshes the widgets webhook events affect, see widget_refresh.go
+	widgetRefreshes *widgetRefresher
 
 	RequiresAuth           bool
 	authSecretKey          []byte
 	usernameHashToUsername map[string]string
 	authAttemptsMu         sync.Mutex
 	failedAuthAttempts     map[string]*failedAuthAttempt
+
+	scheduler *backgroundScheduler
+
+	// Verifies and processes Stripe webhooks with the secrets of this config,
+	// nil on replicas and without secrets
+	webhookHandler *WebhookHandler
 }
 
 func newApplication(c *config) (*application, error) {
 	app := &application{
-		Version:    buildVersion,
-		CreatedAt:  time.Now(),
-		Config:     *c,
-		slugToPage: make(map[string]*page),
-		widgetByID: make(map[uint64]widget),
-	}
+		Version:      buildVersion,
+		CreatedAt:    time.Now(),
+		Config:       *c,
+		slugToPage:   make(map[string]*page),
+		widgetByID:   make(map[uint64]widget),
+		widgetPage:   make(map[uint64]*page),
+		widgetEvents: newWidgetEventBroker(),
+	}
+	app.widgetRefreshes = newWidgetRefresher(widgetRefreshDelay, app.refreshWidgets)
 	config := &app.Config
 
 	//
@@ -178,6 +194,7 @@ func newApplication(c *config) (*application, error) {
 		for i := range page.HeadWidgets {
 			widget := page.HeadWidgets[i]
 			app.widgetByID[widget.GetID()] = widget
+			app.widgetPage[widget.GetID()] = page
 			widget.setProviders(providers)
 		}
 
@@ -191,6 +208,7 @@ func newApplication(c *config) (*application, error) {
 			for w := range column.Widgets {
 				widget := column.Widgets[w]
 				app.widgetByID[widget.GetID()] = widget
+				app.widgetPage[widget.GetID()] = page
 				widget.setProviders(providers)
 			}
 		}
@@ -230,10 +248,178 @@ func newApplication(c *config) (*application, error) {
 	}
 	app.parsedManifest = []byte(manifest)
 
+	//
+	// Init background jobs
+	//
+
+	app.scheduler = newBackgroundScheduler()
+
+	db, err := GetMetricsDatabase("")
+	if err != nil {
+		return nil, fmt.Errorf("opening metrics database: %v", err)
+	}
+
+	db.SetBudget(int64(config.Metrics.MaxSizeMB)*1024*1024, config.Metrics.MaxSnapshots)
+
+	// Validated along with the rest of the config
+	rateProvider, _ := newExchangeRateProvider(config.Currency.RateProvider)
+	GetCurrencyConverter().Configure(config.Currency.ReportingCurrency, config.Currency.CurrencyRates, rateProvider)
+
+	// Rebuilt with the application, so that a reload picks up rotated secrets
+	configuredWebhookSecrets = configWebhookSecrets(config)
+	skipVerify := config.StripeWebhook.InsecureSkipVerify
+	if skipVerify {
+		if err := checkInsecureSkipVerify(app.widgetByID, stripeWebhookSecrets()); err != nil {
+			return nil, err
+		}
+	}
+
+	if secrets := stripeWebhookSecrets(); (len(secrets) > 0 || skipVerify) && !app.isReplica() {
+		app.webhookHandler = newWebhookHandler(secrets, app)
+		app.webhookHandler.SetInsecureSkipVerify(skipVerify)
+		app.webhookHandler.SetMaxAttempts(config.StripeWebhook.MaxAttempts)
+		app.webhookHandler.SetMaxDeadLetters(config.StripeWebhook.MaxDeadLetters)
+		app.webhookHandler.SetAcceptedModes(resolveWebhookModes(config.StripeWebhook.AcceptMode, app.widgetByID))
+		app.webhookHandler.SetRedactIDs(config.StripeWebhook.RedactIDs)
+		app.webhookHandler.SetVerification(time.Duration(config.StripeWebhook.Tolerance), config.StripeWebhook.IgnoreAPIVersionMismatch)
+		app.webhookHandler.SetProcessing(config.StripeWebhook.Processing)
+		// Events are processed by the request in sync mode
+		if config.StripeWebhook.Processing == webhookProcessingAsync {
+			app.webhookHandler.StartWorkers(config.StripeWebhook.Workers, config.StripeWebhook.QueueSize)
+		}
+		for _, rule := range config.StripeWebhook.Invalidations {
+			// Validated along with the rest of the config
+			app.webhookHandler.RegisterInvalidation(rule.Events, rule.Widgets...)
+		}
+		GetHealthChecker().RegisterCheck("webhooks", newWebhookHealthCheck(app.webhookHandler))
+	} else {
+		GetHealthChecker().UnregisterCheck("webhooks")
+	}
+
+	timezone, _ := loadTimezone(config.Metrics.Timezone)
+	setMetricsTimezone(timezone)
+
+	if err := checkMetricsAccounts(app.widgetByID); err != nil {
+		return nil, err
+	}
+
+	// Revenue snapshots older than twice the longest revenue widget cache
+	// duration mean that widget updates are failing
+	var staleAfter time.Duration
+	var revenueModes []string
+	for _, widget := range app.widgetByID {
+		if revenue, ok := widget.(*revenueWidget); ok {
+			staleAfter = max(staleAfter, 2*revenue.cacheDuration)
+			if key := revenue.metricsKey(); !slices.Contains(revenueModes, key) {
+				revenueModes = append(revenueModes, key)
+			}
+		}
+	}
+	GetHealthChecker().RegisterCheck("database", newDatabaseHealthCheck(staleAfter, revenueModes))
+
+	if app.isReplica() {
+		// Replicas render Stripe widgets from the store and leave writes,
+		// Stripe calls and background jobs to the primary
+		for _, widget := range app.widgetByID {
+			switch widget := widget.(type) {
+			case *revenueWidget:
+				widget.store = db
+			case *customersWidget:
+				widget.store = db
+			}
+		}
+
+		encryption, err := GetEncryptionService()
+		if err != nil {
+			return nil, fmt.Errorf("initializing encryption: %v", err)
+		}
+
+		// The metrics file is the primary's to write, replicas only reload it
+		if err := db.SetPersistence("", false, encryption); err != nil {
+			return nil, fmt.Errorf("opening metrics file: %v", err)
+		}
+
+		source := &replicaSource{path: config.Metrics.Path, encryption: encryption}
+		app.scheduler.addJob(newReplicaPollJob(app, db, source, time.Duration(config.Replication.PollInterval)))
+		GetHealthChecker().RegisterCheck("primary", newPrimaryHealthCheck(db, time.Duration(config.Replication.StaleAfter)))
+	} else {
+		GetHealthChecker().UnregisterCheck("primary")
+		db.SetDeduplication(time.Duration(config.Metrics.DedupeWindow), config.Metrics.DedupeTolerance)
+
+		encryption, err := GetEncryptionService()
+		if err != nil {
+			return nil, fmt.Errorf("initializing encryption: %v", err)
+		}
+
+		if err := db.SetPersistence(config.Metrics.Path, config.Metrics.Encrypt, encryption); err != nil {
+			return nil, fmt.Errorf("opening metrics file: %v", err)
+		}
+
+		if config.Metrics.Path != "" {
+			app.scheduler.addJob(newMetricsPersistJob(db, time.Duration(config.Metrics.SaveInterval)))
+
+			if app.webhookHandler != nil {
+				app.webhookHandler.SetEventStore(db)
+			}
+		}
+
+		app.scheduler.addJob(newMetricsCleanupJob(
+			db,
+			time.Duration(config.Metrics.CleanupInterval),
+			time.Duration(config.Metrics.Retention),
+		))
+
+		// Kept apart from snapshots, since payloads take up more room
+		db.SetWebhookRetention(time.Duration(config.StripeWebhook.EventRetention), time.Duration(config.StripeWebhook.PayloadRetention))
+		app.scheduler.addJob(newWebhookLogCleanupJob(db, time.Duration(config.Metrics.CleanupInterval)))
+
+		for _, widget := range app.widgetByID {
+			if customers, ok := widget.(*customersWidget); ok && (customers.Counting == customerCountingEstimated || customers.Counting == customerCountingIncremental) {
+				app.scheduler.addJob(&backgroundJob{
+					name:    "customers-exact-count",
+					nextRun: dailyAt(customerExactCountHour),
+					run:     customers.runExactCount,
+				})
+			}
+		}
+	}
+
+	app.scheduler.start()
+
 	return app, nil
 }
 
+// checkMetricsAccounts refuses Stripe widgets that would store snapshots from
+// different API keys under the same mode and account-label, which would
+// interleave the histories of separate Stripe accounts
+func checkMetricsAccounts(widgets map[uint64]widget) error {
+	apiKeys := make(map[string]string)
+
+	for _, widget := range widgets {
+		var key, apiKey string
+		switch widget := widget.(type) {
+		case *revenueWidget:
+			key, apiKey = widget.metricsKey(), widget.StripeAPIKey
+		case *customersWidget:
+			key, apiKey = widget.metricsKey(), widget.StripeAPIKey
+		default:
+			continue
+		}
+
+		if existing, ok := apiKeys[key]; ok && existing != apiKey {
+			return fmt.Errorf("stripe widgets with different stripe-api-key values store snapshots under %s, set a distinct account-label on each", key)
+		}
+		apiKeys[key] = apiKey
+	}
+
+	return nil
+}
+
 func (p *page) updateOutdatedWidgets() {
+	if globalPause.isPaused() {
+		return
+	}
+
 	now := time.Now()
 
 	var wg sync.WaitGroup
@@ -439,25 +625,184 @@ func (a *application) VersionedAssetPath(asset string) string {
 // InvalidateCache invalidates the cache for widgets of a specific type
 // This implements the CacheInvalidator interface for webhook support
 func (a *application) InvalidateCache(widgetType string) error {
-	// Iterate through all widgets and invalidate matching types
-	for _, widget := range a.widgetByID {
-		// Check if widget type matches (using type assertion)
-		switch widgetType {
-		case "revenue":
-			if _, ok := widget.(*revenueWidget); ok {
-				widget.update(context.Background())
-				slog.Info("Invalidated revenue widget cache", "widget_type", widgetType)
+	if globalPause.isPaused() {
+		return errAdministrativelyPaused
+	}
+
+	// Subscriptions listed before the event are stale
+	subscriptionScans.invalidate()
+
+	// Updating the widgets lists subscriptions, too slow for every event and
+	// for Stripe to wait on in sync processing, so it's done in the
+	// background once for a burst of events
+	if a.widgetRefreshes != nil {
+		a.widgetRefreshes.request(widgetType)
+	}
+
+	return nil
+}
+
+// refreshWidgets updates the widgets of widgetType on every page, including
+// the ones in groups and split columns, rather than once their cache expires,
+// and lets open dashboards fetch them. Their caches are invalidated here
+// rather than when requested, as their page stays locked while a render
+// updates its widgets.
+func (a *application) refreshWidgets(ctx context.Context, widgetType string) {
+	// Let replicas know to refresh the same widgets from the store, once the
+	// snapshots of the refresh are saved
+	if !a.isReplica() {
+		if db, err := GetMetricsDatabase(""); err == nil {
+			defer db.RecordChange(context.Background(), widgetType)
+		}
+	}
+
+	var refreshed []uint64
+	for id, widget := range a.widgetByID {
+		matching := widgetsOfType(widget, widgetType)
+		if len(matching) == 0 {
+			continue
+		}
+
+		func() {
+			// Widgets are updated with their page locked
+			if page, ok := a.widgetPage[id]; ok {
+				page.mu.Lock()
+				defer page.mu.Unlock()
 			}
-		case "customers":
-			if _, ok := widget.(*customersWidget); ok {
-				widget.update(context.Background())
-				slog.Info("Invalidated customers widget cache", "widget_type", widgetType)
+
+			for _, match := range matching {
+				match.invalidateCache()
+				match.update(ctx)
 			}
+		}()
+
+		// The content of nested widgets is fetched through their container
+		refreshed = append(refreshed, id)
+		slog.Info("Invalidated widget cache", "widget_type", widgetType, "widget_id", id, "widgets", len(matching))
+	}
+
+	// Let open dashboards fetch the refreshed widgets
+	if len(refreshed) > 0 && a.widgetEvents != nil {
+		slices.Sort(refreshed)
+		a.widgetEvents.broadcast(WidgetRefreshEvent{WidgetType: widgetType, WidgetIDs: refreshed})
+	}
+}
+
+// widgetsOfType returns candidate if it's of widgetType, or the widgets of
+// widgetType it contains
+func widgetsOfType(candidate widget, widgetType string) []widget {
+	if container, ok := candidate.(widgetContainer); ok {
+		var matching []widget
+		for _, contained := range container.containedWidgets() {
+			matching = append(matching, widgetsOfType(contained, widgetType)...)
 		}
+		return matching
+	}
+
+	var matches bool
+	switch widgetType {
+	case "revenue":
+		_, matches = candidate.(*revenueWidget)
+	case "customers":
+		_, matches = candidate.(*customersWidget)
+	default:
+		matches = candidate.GetType() == widgetType
+	}
+
+	if matches {
+		return []widget{candidate}
 	}
+
 	return nil
 }
 
+func (a *application) isReplica() bool {
+	return a.Config.Replication.Role == replicationRoleReplica
+}
+
+// Paths Stripe delivers webhooks to, the first being the one to configure in
+// the Stripe dashboard and the second kept for endpoints set up before it
+const (
+	stripeWebhookPath       = "/webhooks/stripe"
+	legacyStripeWebhookPath = "/api/stripe/webhook"
+)
+
+// webhookURL returns the URL of the Stripe webhook endpoint to paste into the
+// Stripe dashboard. The public host is only known when base-url is a full
+// URL, otherwise the address the server listens on is used.
+func (a *application) webhookURL() string {
+	if strings.HasPrefix(a.Config.Server.BaseURL, "http://") || strings.HasPrefix(a.Config.Server.BaseURL, "https://") {
+		return a.Config.Server.BaseURL + stripeWebhookPath
+	}
+
+	host := a.Config.Server.Host
+	if host == "" {
+		host = "localhost"
+	}
+
+	return fmt.Sprintf("http://%s:%d%s%s", host, a.Config.Server.Port, a.Config.Server.BaseURL, stripeWebhookPath)
+}
+
+// registerWebhookRoutes mounts the Stripe webhook endpoint when webhook
+// secrets are configured, through stripe-webhook or STRIPE_WEBHOOK_SECRET
+func (a *application) registerWebhookRoutes(mux *http.ServeMux) {
+	if a.isReplica() {
+		// Reject webhooks so that Stripe retries them, hopefully against the primary
+		rejectWebhook := func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, http.StatusServiceUnavailable, errors.New("replicas do not process webhooks"))
+		}
+		mux.HandleFunc("POST "+stripeWebhookPath, rejectWebhook)
+		mux.HandleFunc("POST "+legacyStripeWebhookPath, rejectWebhook)
+
+		slog.Info("Stripe webhook endpoint disabled on replica")
+		return
+	}
+
+	webhookHandler := a.webhookHandler
+	if webhookHandler == nil {
+		slog.Warn("Stripe webhook endpoint NOT registered - neither stripe-webhook nor STRIPE_WEBHOOK_SECRET is set")
+		return
+	}
+
+	mux.HandleFunc("POST "+stripeWebhookPath, webhookHandler.HandleWebhook)
+	mux.HandleFunc("POST "+legacyStripeWebhookPath, webhookHandler.HandleWebhook)
+
+	// Webhook events log endpoint (for debugging)
+	mux.HandleFunc("GET /api/stripe/webhook/events", func(w http.ResponseWriter, r *http.Request) {
+		if a.handleUnauthorizedWebhookAPIResponse(w, r) {
+			return
+		}
+
+		events := webhookHandler.GetEventLog()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&WebhookEventsResponse{
+			Events:     webhookHandler.presentEvents(events),
+			Count:      len(events),
+			Duplicates: countDuplicateEvents(events),
+		})
+	})
+
+	statusHandler := WebhookStatusHandler(webhookHandler)
+	mux.HandleFunc("GET /api/stripe/webhook/status", func(w http.ResponseWriter, r *http.Request) {
+		if a.handleUnauthorizedWebhookAPIResponse(w, r) {
+			return
+		}
+
+		statusHandler(w, r)
+	})
+
+	mux.HandleFunc("POST "+stripeWebhookPath+"/replay/{event}", a.handleWebhookReplayRequest)
+	mux.HandleFunc("GET "+stripeWebhookPath+"/dead-letter", a.handleDeadLettersRequest)
+	mux.HandleFunc("DELETE "+stripeWebhookPath+"/dead-letter/{event}", a.handleDeleteDeadLetterRequest)
+	mux.HandleFunc("POST "+stripeWebhookPath+"/dead-letter/{event}/requeue", a.handleRequeueDeadLetterRequest)
+
+	if !a.RequiresAuth && a.Config.StripeWebhook.StatusToken == "" {
+		slog.Warn("Webhook status, events and replay endpoints are open to anyone - configure auth or stripe-webhook status-token")
+	}
+
+	slog.Info("Stripe webhook endpoint registered", "url", a.webhookURL(), "secrets", len(webhookHandler.secrets))
+}
+
 func (a *application) server() (func() error, func() error) {
 	mux := http.NewServeMux()
 
@@ -470,7 +815,9 @@ func (a *application) server() (func() error, func() error) {
 		mux.HandleFunc("POST /api/set-theme/{key}", a.handleThemeChangeRequest)
 	}
 
+	mux.HandleFunc("GET /api/widgets/{widget}/content/{$}", a.handleWidgetContentRequest)
 	mux.HandleFunc("/api/widgets/{widget}/{path...}", a.handleWidgetRequest)
+	mux.HandleFunc("GET /api/events", a.handleEventsRequest)
 
 	// Basic health check (simple 200 OK)
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, _ *http.Request) {
@@ -497,30 +844,29 @@ func (a *application) server() (func() error, func() error) {
 		json.NewEncoder(w).Encode(response)
 	})
 
+	// Administrative pause of widget updates, background jobs and webhook processing
+	mux.HandleFunc("POST /api/admin/pause", a.handlePauseRequest)
+	mux.HandleFunc("POST /api/admin/resume", a.handleResumeRequest)
+
+	// Raw metric series for external charting tools
+	mux.HandleFunc("GET /api/v1/series", a.handleSeriesRequest)
+
+	// Stored metric history
+	mux.HandleFunc("GET /api/metrics/revenue", a.handleRevenueHistoryRequest)
+	mux.HandleFunc("GET /api/metrics/customers", a.handleCustomerHistoryRequest)
+	mux.HandleFunc("GET /api/metrics/compare", a.handleCompareRequest)
+	mux.HandleFunc("DELETE /api/metrics", a.handleMetricsPurgeRequest)
+	mux.HandleFunc("GET /api/annotations", a.handleAnnotationsRequest)
+	mux.HandleFunc("POST /api/annotations", a.handleCreateAnnotationRequest)
+	mux.HandleFunc("GET /api/export/revenue.csv", a.handleRevenueExportRequest)
+	mux.HandleFunc("GET /api/export/customers.csv", a.handleCustomerExportRequest)
+	mux.HandleFunc("POST /api/import/revenue.csv", a.handleRevenueImportRequest)
+	mux.HandleFunc("POST /api/import/customers.csv", a.handleCustomerImportRequest)
+
 	// Prometheus-compatible metrics endpoint
-	mux.HandleFunc("GET /api/metrics", MetricsHandler())
-
-	// Stripe webhook endpoint (if webhook secret is configured)
-	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
-	if webhookSecret != "" {
-		webhookHandler := GetWebhookHandler(webhookSecret, a)
-
-		mux.HandleFunc("POST /api/stripe/webhook", webhookHandler.HandleWebhook)
-
-		// Webhook events log endpoint (for debugging)
-		mux.HandleFunc("GET /api/stripe/webhook/events", func(w http.ResponseWriter, r *http.Request) {
-			events := webhookHandler.GetEventLog()
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"events": events,
-				"count":  len(events),
-			})
-		})
+	mux.HandleFunc("GET /api/metrics", MetricsHandler(a.webhookHandler))
 
-		slog.Info("Stripe webhook endpoint registered", "path", "/api/stripe/webhook")
-	} else {
-		slog.Warn("Stripe webhook endpoint NOT registered - STRIPE_WEBHOOK_SECRET not set")
-	}
+	a.registerWebhookRoutes(mux)
 
 	if a.RequiresAuth {
 		mux.HandleFunc("GET /login", a.handleLoginPageRequest)
@@ -581,6 +927,16 @@ func (a *application) server() (func() error, func() error) {
 	}
 
 	stop := func() error {
+		a.scheduler.stop()
+		a.widgetRefreshes.close()
+		a.widgetEvents.close()
+		// Queued events are written before the metrics are saved
+		if a.webhookHandler != nil {
+			a.webhookHandler.StopWorkers()
+		}
+		if err := GetSimpleMetricsDB().Close(); err != nil {
+			log.Printf("Failed to save metrics: %v", err)
+		}
 		return server.Close()
 	}
 
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,7 +31,7 @@ type HealthCheckFunc func(ctx context.Context) *HealthCheckResult
 type HealthCheckResult struct {
 	Status    HealthStatus           `json:"status"`
 	Message   string                 `json:"message,omitempty"`
-	Details   map[string]interface{} `json:"details,omitempty"`
+	Details   any                    `json:"details,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
 	Duration  time.Duration          `json:"duration"`
 }
@@ -41,6 +45,30 @@ const (
 	HealthStatusUnhealthy HealthStatus = "unhealthy"
 )
 
+// MemoryHealthDetails holds the details of the memory health check
+type MemoryHealthDetails struct {
+	AllocMB     uint64 `json:"alloc_mb"`
+	SysMB       uint64 `json:"sys_mb"`
+	NumGC       uint32 `json:"num_gc"`
+	Goroutines  int    `json:"goroutines"`
+	ThresholdMB uint64 `json:"threshold_mb"`
+
+	// Usage of the metrics store budget, from 0 to 1, when one is set
+	StoreBudgetUsage float64 `json:"store_budget_usage,omitempty"`
+}
+
+// ReadinessResponse is the response of the readiness endpoint
+type ReadinessResponse struct {
+	Ready  bool         `json:"ready"`
+	Status HealthStatus `json:"status"`
+}
+
+// LivenessResponse is the response of the liveness endpoint
+type LivenessResponse struct {
+	Alive  bool   `json:"alive"`
+	Uptime string `json:"uptime"`
+}
+
 // HealthResponse is the overall health response
 type HealthResponse struct {
 	Status    HealthStatus                  `json:"status"`
@@ -70,6 +98,7 @@ func GetHealthChecker() *HealthChecker {
 		globalHealthChecker.RegisterCheck("database", checkDatabaseHealth)
 		globalHealthChecker.RegisterCheck("memory", checkMemoryHealth)
 		globalHealthChecker.RegisterCheck("stripe_pool", checkStripePoolHealth)
+		globalHealthChecker.RegisterCheck("pause", checkPauseHealth)
 	})
 	return globalHealthChecker
 }
@@ -81,6 +110,15 @@ func (hc *HealthChecker) RegisterCheck(name string, check HealthCheckFunc) {
 	hc.checks[name] = check
 }
 
+// UnregisterCheck removes a health check and its cached result
+func (hc *HealthChecker) UnregisterCheck(name string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	delete(hc.checks, name)
+	delete(hc.lastRun, name)
+	delete(hc.results, name)
+}
+
 // RunChecks runs all registered health checks
 func (hc *HealthChecker) RunChecks(ctx context.Context) *HealthResponse {
 	hc.mu.RLock()
@@ -150,28 +188,68 @@ func (hc *HealthChecker) RunChecks(ctx context.Context) *HealthResponse {
 
 // checkDatabaseHealth checks database connectivity and performance
 func checkDatabaseHealth(ctx context.Context) *HealthCheckResult {
-	db, err := GetMetricsDatabase("")
-	if err != nil {
-		return &HealthCheckResult{
-			Status:  HealthStatusDegraded,
-			Message: "Database not initialized",
+	return newDatabaseHealthCheck(0, nil)(ctx)
+}
+
+// newDatabaseHealthCheck returns a database health check that also reports the
+// dashboard as degraded when the newest revenue snapshot of any of modes is
+// older than staleAfter, which means widget updates are failing silently
+func newDatabaseHealthCheck(staleAfter time.Duration, modes []string) HealthCheckFunc {
+	return func(ctx context.Context) *HealthCheckResult {
+		db, err := GetMetricsDatabase("")
+		if err != nil {
+			return &HealthCheckResult{
+				Status:  HealthStatusDegraded,
+				Message: "Database not initialized",
+			}
+		}
+
+		// Try a simple query
+		stats, err := db.GetDatabaseStats(ctx)
+		if err != nil {
+			return &HealthCheckResult{
+				Status:  HealthStatusUnhealthy,
+				Message: fmt.Sprintf("Database query failed: %v", err),
+			}
+		}
+
+		if stale := staleRevenueModes(stats, modes, staleAfter, time.Now()); len(stale) > 0 {
+			return &HealthCheckResult{
+				Status:  HealthStatusDegraded,
+				Message: fmt.Sprintf("No revenue snapshot within %s for mode %s, updates may be failing", staleAfter, strings.Join(stale, ", ")),
+				Details: stats,
+			}
 		}
-	}
 
-	// Try a simple query
-	stats, err := db.GetDatabaseStats(ctx)
-	if err != nil {
 		return &HealthCheckResult{
-			Status:  HealthStatusUnhealthy,
-			Message: fmt.Sprintf("Database query failed: %v", err),
+			Status:  HealthStatusHealthy,
+			Message: "Database operational",
+			Details: stats,
 		}
 	}
+}
 
-	return &HealthCheckResult{
-		Status:  HealthStatusHealthy,
-		Message: "Database operational",
-		Details: stats,
+// staleRevenueModes returns the modes whose newest revenue snapshot is older
+// than staleAfter. Modes without snapshots count as stale once the process has
+// been running for longer than staleAfter. A staleAfter of 0 disables the check.
+func staleRevenueModes(stats *DatabaseStats, modes []string, staleAfter time.Duration, now time.Time) []string {
+	if staleAfter <= 0 {
+		return nil
+	}
+
+	var stale []string
+	for _, mode := range modes {
+		newest := startTime
+		if ms, ok := stats.PerMode[mode]; ok && ms.NewestRevenueAt != nil {
+			newest = *ms.NewestRevenueAt
+		}
+
+		if now.Sub(newest) > staleAfter {
+			stale = append(stale, mode)
+		}
 	}
+
+	return stale
 }
 
 // checkMemoryHealth checks memory usage
@@ -183,21 +261,34 @@ func checkMemoryHealth(ctx context.Context) *HealthCheckResult {
 	memThresholdMB := uint64(512) // 512 MB threshold
 
 	status := HealthStatusHealthy
+	message := fmt.Sprintf("Memory usage: %d MB", memUsedMB)
 	if memUsedMB > memThresholdMB*2 {
 		status = HealthStatusUnhealthy
 	} else if memUsedMB > memThresholdMB {
 		status = HealthStatusDegraded
 	}
 
+	var storeUsage float64
+	if stats, err := GetSimpleMetricsDB().GetDatabaseStats(ctx); err == nil {
+		storeUsage = storeBudgetUsage(stats)
+		if storeUsage >= storeBudgetWarning {
+			message = fmt.Sprintf("%s, metrics store at %.0f%% of its budget, oldest snapshots are evicted once it is full", message, storeUsage*100)
+			if status == HealthStatusHealthy {
+				status = HealthStatusDegraded
+			}
+		}
+	}
+
 	return &HealthCheckResult{
 		Status:  status,
-		Message: fmt.Sprintf("Memory usage: %d MB", memUsedMB),
-		Details: map[string]interface{}{
-			"alloc_mb":      memUsedMB,
-			"sys_mb":        m.Sys / 1024 / 1024,
-			"num_gc":        m.NumGC,
-			"goroutines":    runtime.NumGoroutine(),
-			"threshold_mb":  memThresholdMB,
+		Message: message,
+		Details: &MemoryHealthDetails{
+			AllocMB:          memUsedMB,
+			SysMB:            m.Sys / 1024 / 1024,
+			NumGC:            m.NumGC,
+			Goroutines:       runtime.NumGoroutine(),
+			ThresholdMB:      memThresholdMB,
+			StoreBudgetUsage: storeUsage,
 		},
 	}
 }
@@ -207,8 +298,7 @@ func checkStripePoolHealth(ctx context.Context) *HealthCheckResult {
 	pool := GetStripeClientPool()
 	metrics := pool.GetMetrics()
 
-	circuitStates := metrics["circuit_states"].(map[string]int)
-	openCircuits := circuitStates["open"]
+	openCircuits := metrics.CircuitStates.Open
 
 	status := HealthStatusHealthy
 	message := "Stripe pool operational"
@@ -261,9 +351,9 @@ func ReadinessHandler() http.HandlerFunc {
 			w.WriteHeader(http.StatusOK)
 		}
 
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ready":  response.Status == HealthStatusHealthy,
-			"status": response.Status,
+		json.NewEncoder(w).Encode(&ReadinessResponse{
+			Ready:  response.Status == HealthStatusHealthy,
+			Status: response.Status,
 		})
 	}
 }
@@ -273,15 +363,16 @@ func LivenessHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"alive":  true,
-			"uptime": time.Since(startTime).String(),
+		json.NewEncoder(w).Encode(&LivenessResponse{
+			Alive:  true,
+			Uptime: time.Since(startTime).String(),
 		})
 	}
 }
 
-// MetricsHandler returns an HTTP handler for Prometheus-style metrics
-func MetricsHandler() http.HandlerFunc {
+// MetricsHandler returns an HTTP handler for Prometheus-style metrics, with
+// the webhook metrics of webhooks when it isn't nil
+func MetricsHandler(webhooks *WebhookHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var m runtime.MemStats
 		runtime.ReadMemStats(&m)
@@ -304,21 +395,104 @@ func MetricsHandler() http.HandlerFunc {
 		// Add Stripe pool metrics
 		pool := GetStripeClientPool()
 		poolMetrics := pool.GetMetrics()
-		circuitStates := poolMetrics["circuit_states"].(map[string]int)
 
 		metrics = append(metrics,
 			"# HELP glance_stripe_clients_total Total number of Stripe clients",
 			"# TYPE glance_stripe_clients_total gauge",
-			fmt.Sprintf("glance_stripe_clients_total %d", poolMetrics["total_clients"]),
+			fmt.Sprintf("glance_stripe_clients_total %d", poolMetrics.TotalClients),
 			"",
 			"# HELP glance_stripe_circuit_breaker_state State of circuit breakers (0=closed, 1=half-open, 2=open)",
 			"# TYPE glance_stripe_circuit_breaker_state gauge",
-			fmt.Sprintf("glance_stripe_circuit_breaker_state{state=\"closed\"} %d", circuitStates["closed"]),
-			fmt.Sprintf("glance_stripe_circuit_breaker_state{state=\"half_open\"} %d", circuitStates["half_open"]),
-			fmt.Sprintf("glance_stripe_circuit_breaker_state{state=\"open\"} %d", circuitStates["open"]),
+			fmt.Sprintf("glance_stripe_circuit_breaker_state{state=\"closed\"} %d", poolMetrics.CircuitStates.Closed),
+			fmt.Sprintf("glance_stripe_circuit_breaker_state{state=\"half_open\"} %d", poolMetrics.CircuitStates.HalfOpen),
+			fmt.Sprintf("glance_stripe_circuit_breaker_state{state=\"open\"} %d", poolMetrics.CircuitStates.Open),
 			"",
 		)
 
+		// Add webhook processing metrics
+		if webhooks != nil {
+			processing := webhooks.GetProcessingMetrics()
+
+			metrics = append(metrics,
+				"# HELP glance_webhook_events_total Webhook events processed by type and outcome",
+				"# TYPE glance_webhook_events_total counter",
+			)
+			for _, events := range processing.Events {
+				metrics = append(metrics, fmt.Sprintf("glance_webhook_events_total{type=\"%s\",outcome=\"%s\"} %d", events.Type, events.Outcome, events.Count))
+			}
+
+			metrics = append(metrics,
+				"",
+				"# HELP glance_webhook_handler_duration_seconds Time taken to run the handlers of a webhook event",
+				"# TYPE glance_webhook_handler_duration_seconds histogram",
+			)
+			for _, bucket := range processing.DurationBuckets {
+				metrics = append(metrics, fmt.Sprintf("glance_webhook_handler_duration_seconds_bucket{le=\"%s\"} %d", strconv.FormatFloat(bucket.UpperBound, 'f', -1, 64), bucket.Count))
+			}
+			metrics = append(metrics,
+				fmt.Sprintf("glance_webhook_handler_duration_seconds_bucket{le=\"+Inf\"} %d", processing.DurationCount),
+				fmt.Sprintf("glance_webhook_handler_duration_seconds_sum %f", processing.DurationSum),
+				fmt.Sprintf("glance_webhook_handler_duration_seconds_count %d", processing.DurationCount),
+				"",
+			)
+
+			// Left out before the first event, rather than reporting 1970
+			if !processing.LastEventAt.IsZero() {
+				metrics = append(metrics,
+					"# HELP glance_webhook_last_event_timestamp_seconds Unix time the last webhook event was received",
+					"# TYPE glance_webhook_last_event_timestamp_seconds gauge",
+					fmt.Sprintf("glance_webhook_last_event_timestamp_seconds %d", processing.LastEventAt.Unix()),
+					"",
+				)
+			}
+		}
+
+		// Add webhook queue metrics
+		if stats, ok := webhooks.GetQueueStats(); ok {
+			metrics = append(metrics,
+				"# HELP glance_webhook_queue_depth Webhook events waiting for a worker",
+				"# TYPE glance_webhook_queue_depth gauge",
+				fmt.Sprintf("glance_webhook_queue_depth %d", stats.Depth),
+				"",
+				"# HELP glance_webhook_queue_capacity Webhook events that can wait for a worker",
+				"# TYPE glance_webhook_queue_capacity gauge",
+				fmt.Sprintf("glance_webhook_queue_capacity %d", stats.Capacity),
+				"",
+				"# HELP glance_webhook_workers Webhook workers by state",
+				"# TYPE glance_webhook_workers gauge",
+				fmt.Sprintf("glance_webhook_workers{state=\"busy\"} %d", stats.BusyWorkers),
+				fmt.Sprintf("glance_webhook_workers{state=\"idle\"} %d", stats.Workers-stats.BusyWorkers),
+				"",
+				"# HELP glance_webhook_queue_rejected_total Webhook deliveries turned away with a full queue",
+				"# TYPE glance_webhook_queue_rejected_total counter",
+				fmt.Sprintf("glance_webhook_queue_rejected_total %d", stats.Rejected),
+				"",
+			)
+		}
+
+		deferred, dropped := globalPause.deferredStats()
+		metrics = append(metrics,
+			"# HELP glance_pause_deferred Work deferred while paused, waiting for the resume",
+			"# TYPE glance_pause_deferred gauge",
+			fmt.Sprintf("glance_pause_deferred %d", deferred),
+			"",
+			"# HELP glance_pause_deferred_dropped_total Work deferred while paused dropped over the limit, the oldest first",
+			"# TYPE glance_pause_deferred_dropped_total counter",
+			fmt.Sprintf("glance_pause_deferred_dropped_total %d", dropped),
+			"",
+		)
+
+		// Add business metrics
+		metrics = append(metrics,
+			"# HELP glance_business_anomalous_subscriptions Subscriptions flagged as likely mispriced",
+			"# TYPE glance_business_anomalous_subscriptions gauge",
+		)
+		anomalies := getAnomalousSubscriptions()
+		for _, mode := range slices.Sorted(maps.Keys(anomalies)) {
+			metrics = append(metrics, fmt.Sprintf("glance_business_anomalous_subscriptions{mode=\"%s\"} %d", mode, anomalies[mode]))
+		}
+		metrics = append(metrics, "")
+
 		// Add database metrics if available
 		db, err := GetMetricsDatabase("")
 		if err == nil {
@@ -328,19 +502,55 @@ func MetricsHandler() http.HandlerFunc {
 					"# HELP glance_db_records_total Total records in database",
 					"# TYPE glance_db_records_total gauge",
 				)
-				for key, value := range dbStats {
-					if count, ok := value.(int); ok && key != "db_size_bytes" {
-						metrics = append(metrics, fmt.Sprintf("glance_db_records_total{table=\"%s\"} %d", key, count))
-					}
-				}
-				if size, ok := dbStats["db_size_bytes"].(int); ok {
+				metrics = append(metrics,
+					fmt.Sprintf("glance_db_records_total{table=\"revenue_metrics_count\"} %d", dbStats.RevenueMetricsCount),
+					fmt.Sprintf("glance_db_records_total{table=\"customer_metrics_count\"} %d", dbStats.CustomerMetricsCount),
+					fmt.Sprintf("glance_db_records_total{table=\"modes\"} %d", dbStats.Modes),
+					"",
+					"# HELP glance_db_skipped_duplicates_total Snapshots skipped as duplicates of the latest snapshot",
+					"# TYPE glance_db_skipped_duplicates_total counter",
+					fmt.Sprintf("glance_db_skipped_duplicates_total %d", dbStats.SkippedDuplicates),
+				)
+
+				metrics = append(metrics,
+					"",
+					"# HELP glance_db_snapshots Snapshots stored per mode",
+					"# TYPE glance_db_snapshots gauge",
+				)
+				modes := slices.Sorted(maps.Keys(dbStats.PerMode))
+				for _, mode := range modes {
+					ms := dbStats.PerMode[mode]
 					metrics = append(metrics,
-						"",
-						"# HELP glance_db_size_bytes Database size in bytes",
-						"# TYPE glance_db_size_bytes gauge",
-						fmt.Sprintf("glance_db_size_bytes %d", size),
+						fmt.Sprintf("glance_db_snapshots{mode=\"%s\",table=\"revenue\"} %d", mode, ms.RevenueSnapshots),
+						fmt.Sprintf("glance_db_snapshots{mode=\"%s\",table=\"customer\"} %d", mode, ms.CustomerSnapshots),
 					)
 				}
+
+				metrics = append(metrics,
+					"",
+					"# HELP glance_db_newest_snapshot_age_seconds Age of the newest snapshot per mode",
+					"# TYPE glance_db_newest_snapshot_age_seconds gauge",
+				)
+				for _, mode := range modes {
+					ms := dbStats.PerMode[mode]
+					if ms.NewestRevenueAt != nil {
+						metrics = append(metrics, fmt.Sprintf("glance_db_newest_snapshot_age_seconds{mode=\"%s\",table=\"revenue\"} %.0f", mode, time.Since(*ms.NewestRevenueAt).Seconds()))
+					}
+					if ms.NewestCustomerAt != nil {
+						metrics = append(metrics, fmt.Sprintf("glance_db_newest_snapshot_age_seconds{mode=\"%s\",table=\"customer\"} %.0f", mode, time.Since(*ms.NewestCustomerAt).Seconds()))
+					}
+				}
+
+				metrics = append(metrics,
+					"",
+					"# HELP glance_db_approx_bytes Approximate memory held by stored snapshots",
+					"# TYPE glance_db_approx_bytes gauge",
+					fmt.Sprintf("glance_db_approx_bytes %d", dbStats.ApproxBytes),
+					"",
+					"# HELP glance_db_evicted_snapshots_total Snapshots and deltas evicted to stay within the store budget",
+					"# TYPE glance_db_evicted_snapshots_total counter",
+					fmt.Sprintf("glance_db_evicted_snapshots_total %d", dbStats.EvictedSnapshots),
+				)
 			}
 		}
 
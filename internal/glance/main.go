@@ -7,7 +7,9 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -46,7 +48,7 @@ func validateProductionEnvironment() {
 	// Check webhook secret
 	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
 	if stripeKey != "" && webhookSecret == "" {
-		warnings = append(warnings, "STRIPE_WEBHOOK_SECRET not set - real-time updates will NOT work")
+		warnings = append(warnings, "STRIPE_WEBHOOK_SECRET not set - real-time updates will NOT work unless stripe-webhook is configured")
 	}
 
 	// Print errors (fatal)
@@ -119,6 +121,8 @@ func Main() int {
 		return cliMountpointInfo(options.args[1])
 	case cliIntentDiagnose:
 		runDiagnostic()
+	case cliIntentStripeBackfill:
+		return cliStripeBackfill(options.configPath, options.args[1:])
 	case cliIntentSecretMake:
 		key, err := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
 		if err != nil {
@@ -155,6 +159,7 @@ func Main() int {
 func serveApp(configPath string) error {
 	// Validate production environment before starting
 	validateProductionEnvironment()
+	listenForPauseToggleSignal()
 
 	// TODO: refactor if this gets any more complex, the current implementation is
 	// difficult to reason about due to all of the callbacks and simultaneous operations,
@@ -241,7 +246,21 @@ func serveApp(configPath string) error {
 		}
 	}
 
-	<-exitChannel
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case <-exitChannel:
+	case <-shutdown:
+		// Lets queued webhook events be processed and the metrics be saved
+		log.Println("Shutting down...")
+		if stopServer != nil {
+			if err := stopServer(); err != nil {
+				log.Printf("Error while trying to stop server: %v", err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,195 @@
+package glance
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxAnnotations is how many annotations are kept per mode and account
+	maxAnnotations = 500
+	// annotationMaxLabel and annotationMaxDescription limit the length of an
+	// annotation's texts
+	annotationMaxLabel       = 100
+	annotationMaxDescription = 1000
+	// annotationMaxBodyBytes limits the size of a create request
+	annotationMaxBodyBytes = 16 << 10
+	// annotationsCSVSection separates the annotations from the snapshots in a
+	// CSV export, imports stop reading at it
+	annotationsCSVSection = "# annotations"
+)
+
+// Annotation marks an event such as a pricing change or an outage on the
+// metric history of a mode
+type Annotation struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Mode        string    `json:"mode"`
+	Account     string    `json:"account,omitempty"`
+	Label       string    `json:"label"`
+	Description string    `json:"description,omitempty"`
+}
+
+// SaveAnnotation stores an annotation under the mode and account it names
+func (db *SimpleMetricsDB) SaveAnnotation(ctx context.Context, annotation *Annotation) error {
+	if globalPause.isPaused() {
+		return errAdministrativelyPaused
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := metricsKey(annotation.Mode, annotation.Account)
+	db.annotations[key] = insertChronological(db.annotations[key], annotation, func(a *Annotation) time.Time { return a.Timestamp })
+
+	if len(db.annotations[key]) > maxAnnotations {
+		db.annotations[key] = db.annotations[key][len(db.annotations[key])-maxAnnotations:]
+	}
+
+	return nil
+}
+
+// ListAnnotations returns the annotations stored under a key from metricsKey in
+// the specified period, oldest first
+func (db *SimpleMetricsDB) ListAnnotations(ctx context.Context, mode string, startTime, endTime time.Time) ([]*Annotation, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	filtered := []*Annotation{}
+	for _, annotation := range db.annotations[mode] {
+		if !annotation.Timestamp.Before(startTime) && !annotation.Timestamp.After(endTime) {
+			filtered = append(filtered, annotation)
+		}
+	}
+
+	return filtered, nil
+}
+
+// writeAnnotationsCSV appends the annotations to a CSV export as a section of
+// their own, after a row holding only annotationsCSVSection
+func writeAnnotationsCSV(writer *csv.Writer, annotations []*Annotation) {
+	if len(annotations) == 0 {
+		return
+	}
+
+	writer.Write([]string{annotationsCSVSection})
+	writer.Write([]string{"timestamp", "label", "description"})
+	for _, annotation := range annotations {
+		writer.Write([]string{annotation.Timestamp.UTC().Format(time.RFC3339), annotation.Label, annotation.Description})
+	}
+}
+
+// AnnotationsResponse is the response of the annotations list endpoint
+type AnnotationsResponse struct {
+	Mode        string        `json:"mode"`
+	Account     string        `json:"account,omitempty"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Annotations []*Annotation `json:"annotations"`
+}
+
+// parseAnnotation validates an annotation sent to the create endpoint, which
+// defaults to the live mode and the current time
+func parseAnnotation(body []byte, now time.Time) (*Annotation, error) {
+	annotation := &Annotation{}
+	if err := json.Unmarshal(body, annotation); err != nil {
+		return nil, fmt.Errorf("invalid annotation: %w", err)
+	}
+
+	if annotation.Mode == "" {
+		annotation.Mode = "live"
+	}
+
+	if annotation.Mode != "live" && annotation.Mode != "test" {
+		return nil, fmt.Errorf("mode must be 'live' or 'test', got: %s", annotation.Mode)
+	}
+
+	if err := validateAccountLabel(annotation.Account); err != nil {
+		return nil, err
+	}
+
+	if annotation.Timestamp.IsZero() {
+		annotation.Timestamp = now
+	}
+
+	annotation.Label = strings.TrimSpace(annotation.Label)
+	if annotation.Label == "" {
+		return nil, errors.New("label is required")
+	}
+
+	if len(annotation.Label) > annotationMaxLabel {
+		return nil, fmt.Errorf("label must be at most %d characters", annotationMaxLabel)
+	}
+
+	if len(annotation.Description) > annotationMaxDescription {
+		return nil, fmt.Errorf("description must be at most %d characters", annotationMaxDescription)
+	}
+
+	return annotation, nil
+}
+
+func (a *application) handleAnnotationsRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query, err := parseHistoryQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	annotations, err := GetSimpleMetricsDB().ListAnnotations(r.Context(), query.key(), query.from, query.to)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&AnnotationsResponse{
+		Mode:        query.mode,
+		Account:     query.account,
+		From:        query.from,
+		To:          query.to,
+		Annotations: annotations,
+	})
+}
+
+func (a *application) handleCreateAnnotationRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, annotationMaxBodyBytes))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	annotation, err := parseAnnotation(body, time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = GetSimpleMetricsDB().SaveAnnotation(r.Context(), annotation)
+	if errors.Is(err, errAdministrativelyPaused) {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(annotation)
+}
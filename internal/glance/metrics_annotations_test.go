@@ -0,0 +1,92 @@
+package glance
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		body              string
+		expectedErr       string
+		expectedMode      string
+		expectedTimestamp time.Time
+	}{
+		{
+			name:              "defaults",
+			body:              `{"label": " Price change "}`,
+			expectedMode:      "live",
+			expectedTimestamp: now,
+		},
+		{
+			name:              "explicit mode and timestamp",
+			body:              `{"label": "Outage", "mode": "test", "timestamp": "2026-02-10T12:00:00Z"}`,
+			expectedMode:      "test",
+			expectedTimestamp: time.Date(2026, time.February, 10, 12, 0, 0, 0, time.UTC),
+		},
+		{name: "missing label", body: `{"description": "x"}`, expectedErr: "label is required"},
+		{name: "label too long", body: `{"label": "` + strings.Repeat("a", annotationMaxLabel+1) + `"}`, expectedErr: "label must be at most"},
+		{name: "invalid mode", body: `{"label": "x", "mode": "staging"}`, expectedErr: "mode must be"},
+		{name: "invalid account", body: `{"label": "x", "account": "a/b"}`, expectedErr: "account"},
+		{name: "invalid json", body: `{`, expectedErr: "invalid annotation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotation, err := parseAnnotation([]byte(tt.body), now)
+
+			if tt.expectedErr != "" {
+				if err == nil || !contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if annotation.Mode != tt.expectedMode || !annotation.Timestamp.Equal(tt.expectedTimestamp) {
+				t.Errorf("expected mode %s at %s, got %+v", tt.expectedMode, tt.expectedTimestamp, annotation)
+			}
+
+			if annotation.Label != strings.TrimSpace(annotation.Label) {
+				t.Errorf("expected label to be trimmed, got %q", annotation.Label)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_Annotations(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	start := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, day := range []int{3, 1, 2} {
+		db.SaveAnnotation(ctx, &Annotation{Timestamp: start.AddDate(0, 0, day), Mode: "live", Label: "day"})
+	}
+	db.SaveAnnotation(ctx, &Annotation{Timestamp: start.AddDate(0, 0, 2), Mode: "live", Account: "eu", Label: "eu"})
+
+	annotations, _ := db.ListAnnotations(ctx, "live", start.AddDate(0, 0, 1), start.AddDate(0, 0, 2))
+	if len(annotations) != 2 || !annotations[0].Timestamp.Before(annotations[1].Timestamp) {
+		t.Fatalf("expected 2 annotations oldest first, got %+v", annotations)
+	}
+
+	if annotations, _ := db.ListAnnotations(ctx, metricsKey("live", "eu"), start, start.AddDate(0, 0, 3)); len(annotations) != 1 {
+		t.Errorf("expected 1 annotation for the eu account, got %d", len(annotations))
+	}
+
+	if annotations, _ := db.ListAnnotations(ctx, "test", start, start.AddDate(0, 0, 3)); annotations == nil || len(annotations) != 0 {
+		t.Errorf("expected an empty list for the test mode, got %+v", annotations)
+	}
+
+	result, _ := db.PurgeMode(ctx, "live")
+	if result.AnnotationsDeleted != 4 {
+		t.Errorf("expected 4 annotations deleted, got %d", result.AnnotationsDeleted)
+	}
+}
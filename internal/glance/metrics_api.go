@@ -0,0 +1,280 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	historyDefaultRange     = 30 * 24 * time.Hour
+	historyDefaultMaxPoints = 500
+	historyMaxPoints        = 5000
+)
+
+// historyQuery holds the validated parameters of a metric history request
+type historyQuery struct {
+	mode      string
+	account   string
+	from      time.Time
+	to        time.Time
+	maxPoints int
+}
+
+// parseHistoryTime accepts either an RFC 3339 timestamp or a YYYY-MM-DD date,
+// which starts at midnight in the metrics timezone
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, defaultTimezone())
+}
+
+// key returns the key the queried snapshots are stored under
+func (q *historyQuery) key() string {
+	return metricsKey(q.mode, q.account)
+}
+
+// parseHistoryQuery validates the mode, account, from, to and max_points
+// parameters. The range defaults to the 30 days before now.
+func parseHistoryQuery(values url.Values, now time.Time) (*historyQuery, error) {
+	query := &historyQuery{
+		mode:      values.Get("mode"),
+		account:   values.Get("account"),
+		to:        now,
+		maxPoints: historyDefaultMaxPoints,
+	}
+
+	if query.mode == "" {
+		query.mode = "live"
+	}
+
+	if query.mode != "live" && query.mode != "test" {
+		return nil, fmt.Errorf("mode must be 'live' or 'test', got: %s", query.mode)
+	}
+
+	if err := validateAccountLabel(query.account); err != nil {
+		return nil, err
+	}
+
+	if value := values.Get("to"); value != "" {
+		to, err := parseHistoryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC 3339 timestamp or YYYY-MM-DD date, got: %s", value)
+		}
+		query.to = to
+	}
+
+	query.from = query.to.Add(-historyDefaultRange)
+	if value := values.Get("from"); value != "" {
+		from, err := parseHistoryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC 3339 timestamp or YYYY-MM-DD date, got: %s", value)
+		}
+		query.from = from
+	}
+
+	if !query.from.Before(query.to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	if value := values.Get("max_points"); value != "" {
+		maxPoints, err := strconv.Atoi(value)
+		if err != nil || maxPoints < 1 || maxPoints > historyMaxPoints {
+			return nil, fmt.Errorf("max_points must be a number between 1 and %d", historyMaxPoints)
+		}
+		query.maxPoints = maxPoints
+	}
+
+	return query, nil
+}
+
+// APIErrorResponse is the response of API endpoints when a request fails
+type APIErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// RevenueHistoryResponse is the response of the revenue history endpoint
+type RevenueHistoryResponse struct {
+	Mode      string             `json:"mode"`
+	Account   string             `json:"account,omitempty"`
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Count     int                `json:"count"`
+	Snapshots []*RevenueSnapshot `json:"snapshots"`
+
+	// Annotations within the range, to be shown as markers on charts
+	Annotations []*Annotation `json:"annotations"`
+}
+
+// CustomerHistoryResponse is the response of the customers history endpoint
+type CustomerHistoryResponse struct {
+	Mode      string              `json:"mode"`
+	Account   string              `json:"account,omitempty"`
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Count     int                 `json:"count"`
+	Snapshots []*CustomerSnapshot `json:"snapshots"`
+
+	// Annotations within the range, to be shown as markers on charts
+	Annotations []*Annotation `json:"annotations"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&APIErrorResponse{Error: err.Error()})
+}
+
+func (a *application) handleRevenueHistoryRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query, err := parseHistoryQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := GetSimpleMetricsDB().GetRevenueHistory(r.Context(), query.key(), query.from, query.to, query.maxPoints)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if history == nil {
+		history = []*RevenueSnapshot{}
+	}
+
+	annotations, err := GetSimpleMetricsDB().ListAnnotations(r.Context(), query.key(), query.from, query.to)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&RevenueHistoryResponse{
+		Mode:      query.mode,
+		Account:   query.account,
+		From:      query.from,
+		To:        query.to,
+		Count:     len(history),
+		Snapshots: history,
+
+		Annotations: annotations,
+	})
+}
+
+func (a *application) handleCustomerHistoryRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query, err := parseHistoryQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := GetSimpleMetricsDB().GetCustomerHistory(r.Context(), query.key(), query.from, query.to, query.maxPoints)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if history == nil {
+		history = []*CustomerSnapshot{}
+	}
+
+	annotations, err := GetSimpleMetricsDB().ListAnnotations(r.Context(), query.key(), query.from, query.to)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&CustomerHistoryResponse{
+		Mode:      query.mode,
+		Account:   query.account,
+		From:      query.from,
+		To:        query.to,
+		Count:     len(history),
+		Snapshots: history,
+
+		Annotations: annotations,
+	})
+}
+
+// MetricsPurgeResponse is the response of the purge endpoint
+type MetricsPurgeResponse struct {
+	Mode            string `json:"mode"`
+	Account         string `json:"account,omitempty"`
+	RevenueDeleted  int    `json:"revenue_deleted"`
+	CustomerDeleted int    `json:"customer_deleted"`
+	DeltasDeleted   int    `json:"deltas_deleted"`
+
+	AnnotationsDeleted int `json:"annotations_deleted"`
+}
+
+// parsePurgeMode requires the mode to be given explicitly, so that a bare
+// request never removes data. Without an account every account of the mode is
+// purged.
+func parsePurgeMode(values url.Values) (string, string, error) {
+	mode, account := values.Get("mode"), values.Get("account")
+	if mode == "" {
+		return "", "", errors.New("mode is required, use ?mode=live or ?mode=test")
+	}
+
+	if mode != "live" && mode != "test" {
+		return "", "", fmt.Errorf("mode must be 'live' or 'test', got: %s", mode)
+	}
+
+	if err := validateAccountLabel(account); err != nil {
+		return "", "", err
+	}
+
+	return mode, account, nil
+}
+
+func (a *application) handleMetricsPurgeRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	mode, account, err := parsePurgeMode(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := GetSimpleMetricsDB().PurgeMode(r.Context(), metricsKey(mode, account))
+	if errors.Is(err, errAdministrativelyPaused) {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	slog.Info("Purged metrics", "mode", mode, "account", account, "revenue_deleted", result.RevenueDeleted, "customer_deleted", result.CustomerDeleted, "deltas_deleted", result.DeltasDeleted, "annotations_deleted", result.AnnotationsDeleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&MetricsPurgeResponse{
+		Mode:            mode,
+		Account:         account,
+		RevenueDeleted:  result.RevenueDeleted,
+		CustomerDeleted: result.CustomerDeleted,
+		DeltasDeleted:   result.DeltasDeleted,
+
+		AnnotationsDeleted: result.AnnotationsDeleted,
+	})
+}
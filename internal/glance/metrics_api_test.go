@@ -0,0 +1,121 @@
+package glance
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		values    url.Values
+		wantFrom  time.Time
+		wantTo    time.Time
+		wantError string
+	}{
+		{
+			name:     "defaults to the last 30 days",
+			values:   url.Values{},
+			wantFrom: now.Add(-historyDefaultRange),
+			wantTo:   now,
+		},
+		{
+			name:     "dates",
+			values:   url.Values{"from": {"2026-01-01"}, "to": {"2026-02-01"}},
+			wantFrom: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "timestamps",
+			values:   url.Values{"from": {"2026-01-01T10:00:00Z"}, "to": {"2026-01-01T12:00:00Z"}},
+			wantFrom: time.Date(2026, time.January, 1, 10, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "from after to",
+			values:    url.Values{"from": {"2026-02-01"}, "to": {"2026-01-01"}},
+			wantError: "from must be before to",
+		},
+		{
+			name:      "invalid date",
+			values:    url.Values{"from": {"last week"}},
+			wantError: "from must be an RFC 3339 timestamp",
+		},
+		{
+			name:      "invalid mode",
+			values:    url.Values{"mode": {"staging"}},
+			wantError: "mode must be 'live' or 'test'",
+		},
+		{
+			name:      "too many points",
+			values:    url.Values{"max_points": {"100000"}},
+			wantError: "max_points must be a number between 1 and",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parseHistoryQuery(tt.values, now)
+
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !query.from.Equal(tt.wantFrom) || !query.to.Equal(tt.wantTo) {
+				t.Errorf("expected range %s - %s, got %s - %s", tt.wantFrom, tt.wantTo, query.from, query.to)
+			}
+
+			if query.mode != "live" || query.maxPoints != historyDefaultMaxPoints {
+				t.Errorf("unexpected defaults: %+v", query)
+			}
+		})
+	}
+}
+
+func TestParsePurgeMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      url.Values
+		wantMode    string
+		wantAccount string
+		wantError   string
+	}{
+		{name: "test", values: url.Values{"mode": {"test"}}, wantMode: "test"},
+		{name: "live", values: url.Values{"mode": {"live"}}, wantMode: "live"},
+		{name: "account", values: url.Values{"mode": {"live"}, "account": {"eu"}}, wantMode: "live", wantAccount: "eu"},
+		{name: "missing", values: url.Values{}, wantError: "mode is required"},
+		{name: "invalid", values: url.Values{"mode": {"all"}}, wantError: "mode must be"},
+		{name: "invalid account", values: url.Values{"mode": {"live"}, "account": {"eu/us"}}, wantError: "account must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, account, err := parsePurgeMode(tt.values)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if mode != tt.wantMode || account != tt.wantAccount {
+				t.Errorf("expected mode %q and account %q, got %q and %q", tt.wantMode, tt.wantAccount, mode, account)
+			}
+		})
+	}
+}
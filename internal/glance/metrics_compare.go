@@ -0,0 +1,199 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MetricsPeriod is a time range compared by ComparePeriods
+type MetricsPeriod struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// PeriodSummary holds the state of a period, taken from the last snapshot
+// within it. Values are null when the period has no snapshots.
+type PeriodSummary struct {
+	MetricsPeriod
+	MRR       *float64 `json:"mrr"`
+	Customers *int     `json:"customers"`
+	ChurnRate *float64 `json:"churn_rate"`
+}
+
+// PeriodChanges holds the change of each value from one period to another.
+// Values are null when either period has no data, percentages also when the
+// earlier value is zero.
+type PeriodChanges struct {
+	MRR              *float64 `json:"mrr"`
+	MRRPercent       *float64 `json:"mrr_percent"`
+	Customers        *int     `json:"customers"`
+	CustomersPercent *float64 `json:"customers_percent"`
+	ChurnRate        *float64 `json:"churn_rate"`
+}
+
+// PeriodComparison is the result of ComparePeriods and the response of the
+// compare endpoint
+type PeriodComparison struct {
+	Mode    string        `json:"mode"`
+	Account string        `json:"account,omitempty"`
+	A       PeriodSummary `json:"a"`
+	B       PeriodSummary `json:"b"`
+	Changes PeriodChanges `json:"changes"`
+}
+
+// growthPercent returns the change from previous to current in percent, or
+// false when previous is zero
+func growthPercent(previous, current float64) (float64, bool) {
+	if previous == 0 {
+		return 0, false
+	}
+
+	return ((current - previous) / previous) * 100, true
+}
+
+func (db *SimpleMetricsDB) summarizePeriod(ctx context.Context, mode string, period MetricsPeriod) (PeriodSummary, error) {
+	summary := PeriodSummary{MetricsPeriod: period}
+
+	revenue, err := db.GetSnapshotBefore(ctx, mode, period.To)
+	if err != nil && !errors.Is(err, ErrNoSnapshot) {
+		return summary, err
+	}
+
+	if err == nil && !revenue.Timestamp.Before(period.From) {
+		mrr := revenue.MRR
+		summary.MRR = &mrr
+	}
+
+	customers, err := db.GetCustomersBefore(ctx, mode, period.To)
+	if err != nil && !errors.Is(err, ErrNoSnapshot) {
+		return summary, err
+	}
+
+	if err == nil && !customers.Timestamp.Before(period.From) {
+		total, churnRate := customers.TotalCustomers, customers.ChurnRate
+		summary.Customers, summary.ChurnRate = &total, &churnRate
+	}
+
+	return summary, nil
+}
+
+// ComparePeriods summarizes two periods and the change from a to b, usually
+// with a being the earlier one
+func (db *SimpleMetricsDB) ComparePeriods(ctx context.Context, mode string, a, b MetricsPeriod) (*PeriodComparison, error) {
+	comparison := &PeriodComparison{Mode: mode}
+
+	var err error
+	if comparison.A, err = db.summarizePeriod(ctx, mode, a); err != nil {
+		return nil, err
+	}
+
+	if comparison.B, err = db.summarizePeriod(ctx, mode, b); err != nil {
+		return nil, err
+	}
+
+	changes := &comparison.Changes
+	if comparison.A.MRR != nil && comparison.B.MRR != nil {
+		delta := *comparison.B.MRR - *comparison.A.MRR
+		changes.MRR = &delta
+		if percent, ok := growthPercent(*comparison.A.MRR, *comparison.B.MRR); ok {
+			changes.MRRPercent = &percent
+		}
+	}
+
+	if comparison.A.Customers != nil && comparison.B.Customers != nil {
+		delta := *comparison.B.Customers - *comparison.A.Customers
+		changes.Customers = &delta
+		if percent, ok := growthPercent(float64(*comparison.A.Customers), float64(*comparison.B.Customers)); ok {
+			changes.CustomersPercent = &percent
+		}
+
+		churnDelta := *comparison.B.ChurnRate - *comparison.A.ChurnRate
+		changes.ChurnRate = &churnDelta
+	}
+
+	return comparison, nil
+}
+
+// parseComparePeriods reads the a_from, a_to, b_from and b_to parameters. Without
+// any of them, the previous calendar month is compared to the current one.
+func parseComparePeriods(values url.Values, now time.Time) (MetricsPeriod, MetricsPeriod, error) {
+	names := []string{"a_from", "a_to", "b_from", "b_to"}
+
+	given := 0
+	for _, name := range names {
+		if values.Get(name) != "" {
+			given++
+		}
+	}
+
+	if given == 0 {
+		currentMonth := bucketStart(now, MetricsBucketMonth)
+		return MetricsPeriod{From: currentMonth.AddDate(0, -1, 0), To: currentMonth.Add(-time.Nanosecond)},
+			MetricsPeriod{From: currentMonth, To: now},
+			nil
+	}
+
+	if given != len(names) {
+		return MetricsPeriod{}, MetricsPeriod{}, errors.New("a_from, a_to, b_from and b_to must be given together")
+	}
+
+	times := make([]time.Time, len(names))
+	for i, name := range names {
+		t, err := parseHistoryTime(values.Get(name))
+		if err != nil {
+			return MetricsPeriod{}, MetricsPeriod{}, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date, got: %s", name, values.Get(name))
+		}
+		times[i] = t
+	}
+
+	a, b := MetricsPeriod{From: times[0], To: times[1]}, MetricsPeriod{From: times[2], To: times[3]}
+	if !a.From.Before(a.To) || !b.From.Before(b.To) {
+		return MetricsPeriod{}, MetricsPeriod{}, errors.New("each period must start before it ends")
+	}
+
+	return a, b, nil
+}
+
+func (a *application) handleCompareRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	values := r.URL.Query()
+	mode := values.Get("mode")
+	if mode == "" {
+		mode = "live"
+	}
+
+	if mode != "live" && mode != "test" {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("mode must be 'live' or 'test', got: %s", mode))
+		return
+	}
+
+	account := values.Get("account")
+	if err := validateAccountLabel(account); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	periodA, periodB, err := parseComparePeriods(values, time.Now().In(defaultTimezone()))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	comparison, err := GetSimpleMetricsDB().ComparePeriods(r.Context(), metricsKey(mode, account), periodA, periodB)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	comparison.Mode, comparison.Account = mode, account
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
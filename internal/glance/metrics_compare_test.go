@@ -0,0 +1,111 @@
+package glance
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSimpleMetricsDB_ComparePeriods(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	at := func(month time.Month, day int) time.Time { return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC) }
+	month := func(m time.Month) MetricsPeriod {
+		return MetricsPeriod{From: at(m, 1), To: at(m+1, 1).Add(-time.Nanosecond)}
+	}
+
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: at(time.January, 10), MRR: 900, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: at(time.January, 28), MRR: 1000, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: at(time.February, 27), MRR: 1250, Mode: "live"})
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: at(time.January, 28), TotalCustomers: 40, ChurnRate: 5, Mode: "live"})
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: at(time.February, 27), TotalCustomers: 50, ChurnRate: 2, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: at(time.April, 2), MRR: 0, Mode: "live"})
+
+	t.Run("both periods have data", func(t *testing.T) {
+		comparison, err := db.ComparePeriods(ctx, "live", month(time.January), month(time.February))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if *comparison.A.MRR != 1000 || *comparison.B.MRR != 1250 {
+			t.Errorf("expected the last MRR of each period, got %v and %v", *comparison.A.MRR, *comparison.B.MRR)
+		}
+
+		changes := comparison.Changes
+		if *changes.MRR != 250 || !floatEquals(*changes.MRRPercent, 25, 0.01) {
+			t.Errorf("unexpected MRR change: %v (%v%%)", *changes.MRR, *changes.MRRPercent)
+		}
+
+		if *changes.Customers != 10 || !floatEquals(*changes.CustomersPercent, 25, 0.01) || !floatEquals(*changes.ChurnRate, -3, 0.01) {
+			t.Errorf("unexpected customer changes: %+v", changes)
+		}
+	})
+
+	t.Run("period without data", func(t *testing.T) {
+		comparison, _ := db.ComparePeriods(ctx, "live", month(time.February), month(time.March))
+
+		if comparison.A.MRR == nil || comparison.B.MRR != nil || comparison.B.Customers != nil {
+			t.Errorf("expected March to have no values, got %+v", comparison.B)
+		}
+
+		changes := comparison.Changes
+		if changes.MRR != nil || changes.MRRPercent != nil || changes.Customers != nil || changes.ChurnRate != nil {
+			t.Errorf("expected no changes, got %+v", changes)
+		}
+	})
+
+	t.Run("zero baseline", func(t *testing.T) {
+		comparison, _ := db.ComparePeriods(ctx, "live", month(time.April), month(time.February))
+
+		if comparison.Changes.MRR == nil || *comparison.Changes.MRR != 1250 || comparison.Changes.MRRPercent != nil {
+			t.Errorf("expected a delta without a percentage, got %+v", comparison.Changes)
+		}
+	})
+}
+
+func TestParseComparePeriods(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	t.Run("defaults to previous and current month", func(t *testing.T) {
+		a, b, err := parseComparePeriods(url.Values{}, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !a.From.Equal(time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)) || !a.To.Before(b.From) {
+			t.Errorf("unexpected previous month: %+v", a)
+		}
+
+		if !b.From.Equal(time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)) || !b.To.Equal(now) {
+			t.Errorf("unexpected current month: %+v", b)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		values    url.Values
+		wantError string
+	}{
+		{name: "all given", values: url.Values{"a_from": {"2026-01-01"}, "a_to": {"2026-02-01"}, "b_from": {"2026-02-01"}, "b_to": {"2026-03-01"}}},
+		{name: "partial", values: url.Values{"a_from": {"2026-01-01"}}, wantError: "must be given together"},
+		{name: "invalid", values: url.Values{"a_from": {"2026-01-01"}, "a_to": {"soon"}, "b_from": {"2026-02-01"}, "b_to": {"2026-03-01"}}, wantError: "a_to must be"},
+		{name: "reversed", values: url.Values{"a_from": {"2026-02-01"}, "a_to": {"2026-01-01"}, "b_from": {"2026-02-01"}, "b_to": {"2026-03-01"}}, wantError: "start before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseComparePeriods(tt.values, now)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !contains(err.Error(), tt.wantError) {
+				t.Errorf("expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package glance
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushEvery is how many CSV rows are written between flushes to the client
+const exportFlushEvery = 500
+
+var (
+	revenueCSVHeader  = []string{"timestamp", "mrr", "arr", "new_mrr", "churned_mrr", "growth_rate", "arpu", "collected", "quick_ratio", "nrr"}
+	customerCSVHeader = []string{"timestamp", "total_customers", "new_customers", "reactivated_customers", "churned_customers", "churn_rate", "active_customers", "estimated", "growth_rate", "net_growth"}
+)
+
+func formatCSVFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatCSVOptionalFloat leaves the cell of an unset value empty
+func formatCSVOptionalFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+
+	return formatCSVFloat(*value)
+}
+
+func revenueCSVRow(s *RevenueSnapshot) []string {
+	return []string{
+		s.Timestamp.UTC().Format(time.RFC3339),
+		formatCSVFloat(s.MRR),
+		formatCSVFloat(s.ARR),
+		formatCSVFloat(s.NewMRR),
+		formatCSVFloat(s.ChurnedMRR),
+		formatCSVFloat(s.GrowthRate),
+		formatCSVFloat(s.ARPU),
+		formatCSVFloat(s.Collected),
+		formatCSVOptionalFloat(s.QuickRatio),
+		formatCSVOptionalFloat(s.NRR),
+	}
+}
+
+func customerCSVRow(s *CustomerSnapshot) []string {
+	return []string{
+		s.Timestamp.UTC().Format(time.RFC3339),
+		strconv.Itoa(s.TotalCustomers),
+		strconv.Itoa(s.NewCustomers),
+		strconv.Itoa(s.ReactivatedCustomers),
+		strconv.Itoa(s.ChurnedCustomers),
+		formatCSVFloat(s.ChurnRate),
+		strconv.Itoa(s.ActiveCustomers),
+		strconv.FormatBool(s.Estimated),
+		formatCSVOptionalFloat(s.GrowthRate),
+		strconv.Itoa(s.NetGrowth),
+	}
+}
+
+// exportFilename names an export after its metric, mode, account and date range
+func exportFilename(metric string, query *historyQuery) string {
+	return fmt.Sprintf(
+		"%s-%s-%s-to-%s.csv",
+		metric,
+		strings.ReplaceAll(query.key(), "/", "-"),
+		query.from.UTC().Format(time.DateOnly),
+		query.to.UTC().Format(time.DateOnly),
+	)
+}
+
+// writeCSVExport streams rows to the client as they're formatted, flushing
+// periodically so that large exports are never held in memory as a whole.
+// Annotations follow the snapshots in a section of their own.
+func writeCSVExport[T any](w http.ResponseWriter, filename string, header []string, snapshots []T, row func(T) []string, annotations []*Annotation) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	flusher, _ := w.(http.Flusher)
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+
+	for i, snapshot := range snapshots {
+		if err := writer.Write(row(snapshot)); err != nil {
+			return
+		}
+
+		if (i+1)%exportFlushEvery == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	writeAnnotationsCSV(writer, annotations)
+	writer.Flush()
+}
+
+func (a *application) handleRevenueExportRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query, err := parseHistoryQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := GetSimpleMetricsDB().GetRevenueHistory(r.Context(), query.key(), query.from, query.to, 0)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	annotations, err := GetSimpleMetricsDB().ListAnnotations(r.Context(), query.key(), query.from, query.to)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeCSVExport(w, exportFilename("revenue", query), revenueCSVHeader, history, revenueCSVRow, annotations)
+}
+
+func (a *application) handleCustomerExportRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query, err := parseHistoryQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := GetSimpleMetricsDB().GetCustomerHistory(r.Context(), query.key(), query.from, query.to, 0)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	annotations, err := GetSimpleMetricsDB().ListAnnotations(r.Context(), query.key(), query.from, query.to)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeCSVExport(w, exportFilename("customers", query), customerCSVHeader, history, customerCSVRow, annotations)
+}
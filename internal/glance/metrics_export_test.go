@@ -0,0 +1,79 @@
+package glance
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCSVExport(t *testing.T) {
+	timestamp := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	quickRatio, nrr := 5.0, 104.5
+	snapshots := make([]*RevenueSnapshot, 0, exportFlushEvery+1)
+	for i := 0; i <= exportFlushEvery; i++ {
+		snapshots = append(snapshots, &RevenueSnapshot{Timestamp: timestamp, MRR: 1234.5, ARR: 14814, NewMRR: 100, ChurnedMRR: 20.25, GrowthRate: -1.5, ARPU: 61.725, QuickRatio: &quickRatio, NRR: &nrr})
+	}
+
+	query := &historyQuery{mode: "live", from: timestamp, to: timestamp.AddDate(0, 1, 0)}
+	recorder := httptest.NewRecorder()
+	writeCSVExport(recorder, exportFilename("revenue", query), revenueCSVHeader, snapshots, revenueCSVRow, nil)
+
+	if disposition := recorder.Header().Get("Content-Disposition"); disposition != `attachment; filename="revenue-live-2026-01-02-to-2026-02-02.csv"` {
+		t.Errorf("unexpected Content-Disposition: %s", disposition)
+	}
+
+	if !recorder.Flushed {
+		t.Error("expected the export to be flushed while streaming")
+	}
+
+	body := recorder.Body.String()
+	expectedStart := "timestamp,mrr,arr,new_mrr,churned_mrr,growth_rate,arpu,collected,quick_ratio,nrr\n2026-01-02T03:04:05Z,1234.5,14814,100,20.25,-1.5,61.725,0,5,104.5\n"
+	if !strings.HasPrefix(body, expectedStart) {
+		t.Errorf("unexpected CSV output:\n%s", body[:min(len(body), 200)])
+	}
+
+	lines := strings.Count(body, "\n")
+
+	if lines != len(snapshots)+1 {
+		t.Errorf("expected %d lines, got %d", len(snapshots)+1, lines)
+	}
+}
+
+func TestWriteCSVExport_Annotations(t *testing.T) {
+	timestamp := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	snapshots := []*RevenueSnapshot{{Timestamp: timestamp, MRR: 100, ARR: 1200}}
+	annotations := []*Annotation{{Timestamp: timestamp, Mode: "live", Label: "Price change", Description: "Pro plan, \"v2\""}}
+
+	recorder := httptest.NewRecorder()
+	writeCSVExport(recorder, "revenue.csv", revenueCSVHeader, snapshots, revenueCSVRow, annotations)
+
+	expected := "timestamp,mrr,arr,new_mrr,churned_mrr,growth_rate,arpu,collected,quick_ratio,nrr\n" +
+		"2026-01-02T03:04:05Z,100,1200,0,0,0,0,0,,\n" +
+		"# annotations\n" +
+		"timestamp,label,description\n" +
+		"2026-01-02T03:04:05Z,Price change,\"Pro plan, \"\"v2\"\"\"\n"
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("unexpected CSV output:\n%s", body)
+	}
+}
+
+func TestCustomerCSVRow(t *testing.T) {
+	row := customerCSVRow(&CustomerSnapshot{
+		Timestamp:            time.Date(2026, time.January, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		TotalCustomers:       40,
+		NewCustomers:         4,
+		ReactivatedCustomers: 2,
+		ChurnedCustomers:     1,
+		ChurnRate:            2.5,
+		ActiveCustomers:      35,
+		Estimated:            true,
+	})
+
+	expected := []string{"2026-01-02T02:04:05Z", "40", "4", "2", "1", "2.5", "35", "true"}
+	for i := range expected {
+		if row[i] != expected[i] {
+			t.Errorf("column %s: expected %q, got %q", customerCSVHeader[i], expected[i], row[i])
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package glance
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// importMaxBodyBytes limits the size of an uploaded CSV file
+	importMaxBodyBytes = 10 << 20
+	// importMaxReportedErrors limits how many row errors are listed in the summary
+	importMaxReportedErrors = 100
+)
+
+// ImportRowError describes a CSV row that was skipped
+type ImportRowError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// MetricsImportResponse is the response of the import endpoints
+type MetricsImportResponse struct {
+	Imported int              `json:"imported"`
+	Skipped  int              `json:"skipped"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+func (r *MetricsImportResponse) skip(line int, reason string) {
+	r.Skipped++
+	if len(r.Errors) < importMaxReportedErrors {
+		r.Errors = append(r.Errors, ImportRowError{Line: line, Reason: reason})
+	}
+}
+
+// csvImportRow gives access to the columns of a CSV row by header name
+type csvImportRow struct {
+	columns map[string]int
+	record  []string
+}
+
+func (r csvImportRow) value(column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.record[i])
+}
+
+func (r csvImportRow) float(column string) (float64, error) {
+	value := r.value(column)
+	if value == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a number: %s", column, value)
+	}
+
+	return f, nil
+}
+
+func (r csvImportRow) int(column string) (int, error) {
+	value := r.value(column)
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a whole number: %s", column, value)
+	}
+
+	return i, nil
+}
+
+// timestamp parses the timestamp column, which may also be named date, and
+// rejects timestamps in the future or before notBefore
+func (r csvImportRow) timestamp(now, notBefore time.Time) (time.Time, error) {
+	value := r.value("timestamp")
+	if value == "" {
+		value = r.value("date")
+	}
+
+	if value == "" {
+		return time.Time{}, errors.New("missing timestamp")
+	}
+
+	t, err := parseHistoryTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+	}
+
+	if t.After(now) {
+		return time.Time{}, fmt.Errorf("timestamp is in the future: %s", value)
+	}
+
+	if t.Before(notBefore) {
+		return time.Time{}, fmt.Errorf("timestamp is older than the metrics retention: %s", value)
+	}
+
+	return t, nil
+}
+
+// readImportCSV calls parse for every row of a CSV file with a header, recording
+// rows that fail to parse or repeat an earlier timestamp as skipped. Returns the
+// parsed snapshots along with the line each timestamp was read from.
+func readImportCSV[T any](
+	reader io.Reader,
+	required string,
+	response *MetricsImportResponse,
+	parse func(row csvImportRow) (T, time.Time, error),
+) ([]T, map[int64]int, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns[required]; !ok {
+		return nil, nil, fmt.Errorf("CSV header must include a %s column", required)
+	}
+
+	if _, ok := columns["timestamp"]; !ok {
+		if _, ok := columns["date"]; !ok {
+			return nil, nil, errors.New("CSV header must include a timestamp or date column")
+		}
+	}
+
+	var parsed []T
+	seen := make(map[int64]int)
+
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			response.skip(line, err.Error())
+			continue
+		}
+
+		// Annotations at the end of an export aren't imported
+		if len(record) > 0 && record[0] == annotationsCSVSection {
+			break
+		}
+
+		snapshot, timestamp, err := parse(csvImportRow{columns: columns, record: record})
+		if err != nil {
+			response.skip(line, err.Error())
+			continue
+		}
+
+		if previous, ok := seen[timestamp.UnixNano()]; ok {
+			response.skip(line, fmt.Sprintf("duplicate of line %d", previous))
+			continue
+		}
+
+		seen[timestamp.UnixNano()] = line
+		parsed = append(parsed, snapshot)
+	}
+
+	return parsed, seen, nil
+}
+
+func parseRevenueImportRow(mode, account string, now, notBefore time.Time) func(csvImportRow) (*RevenueSnapshot, time.Time, error) {
+	return func(row csvImportRow) (*RevenueSnapshot, time.Time, error) {
+		timestamp, err := row.timestamp(now, notBefore)
+		if err != nil {
+			return nil, timestamp, err
+		}
+
+		if row.value("mrr") == "" {
+			return nil, timestamp, errors.New("missing mrr")
+		}
+
+		snapshot := &RevenueSnapshot{Timestamp: timestamp, Mode: mode, Account: account}
+		for _, column := range []struct {
+			name  string
+			field *float64
+		}{
+			{"mrr", &snapshot.MRR},
+			{"arr", &snapshot.ARR},
+			{"new_mrr", &snapshot.NewMRR},
+			{"churned_mrr", &snapshot.ChurnedMRR},
+			{"growth_rate", &snapshot.GrowthRate},
+			{"arpu", &snapshot.ARPU},
+			{"collected", &snapshot.Collected},
+		} {
+			if *column.field, err = row.float(column.name); err != nil {
+				return nil, timestamp, err
+			}
+		}
+
+		if row.value("arr") == "" {
+			snapshot.ARR = snapshot.MRR * 12
+		}
+
+		for _, column := range []struct {
+			name  string
+			field **float64
+		}{
+			{"quick_ratio", &snapshot.QuickRatio},
+			{"nrr", &snapshot.NRR},
+		} {
+			if row.value(column.name) == "" {
+				continue
+			}
+
+			value, err := row.float(column.name)
+			if err != nil {
+				return nil, timestamp, err
+			}
+			*column.field = &value
+		}
+
+		return snapshot, timestamp, nil
+	}
+}
+
+func parseCustomerImportRow(mode, account string, now, notBefore time.Time) func(csvImportRow) (*CustomerSnapshot, time.Time, error) {
+	return func(row csvImportRow) (*CustomerSnapshot, time.Time, error) {
+		timestamp, err := row.timestamp(now, notBefore)
+		if err != nil {
+			return nil, timestamp, err
+		}
+
+		if row.value("total_customers") == "" {
+			return nil, timestamp, errors.New("missing total_customers")
+		}
+
+		snapshot := &CustomerSnapshot{Timestamp: timestamp, Mode: mode, Account: account}
+		for _, column := range []struct {
+			name  string
+			field *int
+		}{
+			{"total_customers", &snapshot.TotalCustomers},
+			{"new_customers", &snapshot.NewCustomers},
+			{"reactivated_customers", &snapshot.ReactivatedCustomers},
+			{"churned_customers", &snapshot.ChurnedCustomers},
+			{"active_customers", &snapshot.ActiveCustomers},
+			{"net_growth", &snapshot.NetGrowth},
+		} {
+			if *column.field, err = row.int(column.name); err != nil {
+				return nil, timestamp, err
+			}
+		}
+
+		if snapshot.ChurnRate, err = row.float("churn_rate"); err != nil {
+			return nil, timestamp, err
+		}
+
+		if row.value("growth_rate") != "" {
+			growthRate, err := row.float("growth_rate")
+			if err != nil {
+				return nil, timestamp, err
+			}
+			snapshot.GrowthRate = &growthRate
+		}
+
+		if value := row.value("estimated"); value != "" {
+			if snapshot.Estimated, err = strconv.ParseBool(value); err != nil {
+				return nil, timestamp, fmt.Errorf("estimated is not true or false: %s", value)
+			}
+		}
+
+		return snapshot, timestamp, nil
+	}
+}
+
+// addImportResult counts the snapshots stored by the database and the ones it
+// skipped into the response, using lines to find the row of each timestamp
+func (r *MetricsImportResponse) addImportResult(result *MetricsImportResult, lines map[int64]int) {
+	r.Imported += result.Imported
+
+	for _, timestamp := range result.Duplicates {
+		r.skip(lines[timestamp.UnixNano()], "a snapshot already exists for this timestamp")
+	}
+
+	for _, timestamp := range result.Trimmed {
+		r.skip(lines[timestamp.UnixNano()], "evicted by the metrics store budget")
+	}
+}
+
+// parseImportRequest validates the mode and account of an import request and
+// returns the oldest timestamp that may be imported
+func (a *application) parseImportRequest(r *http.Request, now time.Time) (string, string, time.Time, error) {
+	mode, account := r.URL.Query().Get("mode"), r.URL.Query().Get("account")
+	if mode == "" {
+		mode = "live"
+	}
+
+	if mode != "live" && mode != "test" {
+		return "", "", time.Time{}, fmt.Errorf("mode must be 'live' or 'test', got: %s", mode)
+	}
+
+	if err := validateAccountLabel(account); err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	return mode, account, now.Add(-time.Duration(a.Config.Metrics.Retention)), nil
+}
+
+func writeImportResponse(w http.ResponseWriter, response *MetricsImportResponse, err error) {
+	if errors.Is(err, errAdministrativelyPaused) {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if response.Errors == nil {
+		response.Errors = []ImportRowError{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (a *application) handleRevenueImportRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	now := time.Now()
+	mode, account, notBefore, err := a.parseImportRequest(r, now)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := &MetricsImportResponse{}
+	body := http.MaxBytesReader(w, r.Body, importMaxBodyBytes)
+
+	snapshots, lines, err := readImportCSV(body, "mrr", response, parseRevenueImportRow(mode, account, now, notBefore))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := GetSimpleMetricsDB().ImportRevenueSnapshots(r.Context(), metricsKey(mode, account), snapshots)
+	if err == nil {
+		response.addImportResult(result, lines)
+		if result.Imported > 0 {
+			a.InvalidateCache("revenue")
+		}
+	}
+
+	writeImportResponse(w, response, err)
+}
+
+func (a *application) handleCustomerImportRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	now := time.Now()
+	mode, account, notBefore, err := a.parseImportRequest(r, now)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := &MetricsImportResponse{}
+	body := http.MaxBytesReader(w, r.Body, importMaxBodyBytes)
+
+	snapshots, lines, err := readImportCSV(body, "total_customers", response, parseCustomerImportRow(mode, account, now, notBefore))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := GetSimpleMetricsDB().ImportCustomerSnapshots(r.Context(), metricsKey(mode, account), snapshots)
+	if err == nil {
+		response.addImportResult(result, lines)
+		if result.Imported > 0 {
+			a.InvalidateCache("customers")
+		}
+	}
+
+	writeImportResponse(w, response, err)
+}
@@ -0,0 +1,238 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeSnapshots(t *testing.T) {
+	base := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) *RevenueSnapshot {
+		return &RevenueSnapshot{Timestamp: base.AddDate(0, 0, n), MRR: float64(n)}
+	}
+	timestamp := func(s *RevenueSnapshot) time.Time { return s.Timestamp }
+
+	tests := []struct {
+		name               string
+		history            []*RevenueSnapshot
+		imported           []*RevenueSnapshot
+		expectedDays       []int
+		expectedImported   int
+		expectedDuplicates int
+	}{
+		{
+			name:             "into empty history",
+			imported:         []*RevenueSnapshot{day(2), day(1)},
+			expectedDays:     []int{1, 2},
+			expectedImported: 2,
+		},
+		{
+			name:             "between existing snapshots",
+			history:          []*RevenueSnapshot{day(1), day(5)},
+			imported:         []*RevenueSnapshot{day(3)},
+			expectedDays:     []int{1, 3, 5},
+			expectedImported: 1,
+		},
+		{
+			name:               "existing timestamp is skipped",
+			history:            []*RevenueSnapshot{day(1)},
+			imported:           []*RevenueSnapshot{{Timestamp: base.AddDate(0, 0, 1), MRR: 99}, day(2)},
+			expectedDays:       []int{1, 2},
+			expectedImported:   1,
+			expectedDuplicates: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, result := mergeSnapshots(tt.history, tt.imported, timestamp)
+
+			if len(merged) != len(tt.expectedDays) {
+				t.Fatalf("expected %d snapshots, got %d", len(tt.expectedDays), len(merged))
+			}
+
+			for i, expected := range tt.expectedDays {
+				if int(merged[i].MRR) != expected {
+					t.Errorf("snapshot %d: expected day %d, got %v", i, expected, merged[i].MRR)
+				}
+			}
+
+			if result.Imported != tt.expectedImported {
+				t.Errorf("expected %d imported, got %d", tt.expectedImported, result.Imported)
+			}
+
+			if len(result.Duplicates) != tt.expectedDuplicates {
+				t.Errorf("expected %d duplicates, got %d", tt.expectedDuplicates, len(result.Duplicates))
+			}
+		})
+	}
+}
+
+func TestReadImportCSV(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	notBefore := now.AddDate(-1, 0, 0)
+
+	tests := []struct {
+		name             string
+		csv              string
+		expectedErr      string
+		expectedParsed   int
+		expectedSkipped  int
+		expectedReasons  []string
+		expectedFirstARR float64
+	}{
+		{
+			name:             "valid rows with derived arr",
+			csv:              "timestamp,mrr\n2026-01-01T00:00:00Z,1000\n2026-02-01T00:00:00Z,1100\n",
+			expectedParsed:   2,
+			expectedFirstARR: 12000,
+		},
+		{
+			name:             "date column and mixed case header",
+			csv:              "Date,MRR,ARR\n2026-01-01,1000,15000\n",
+			expectedParsed:   1,
+			expectedFirstARR: 15000,
+		},
+		{
+			name:            "invalid and out of range timestamps",
+			csv:             "timestamp,mrr\nyesterday,1\n2026-04-01,1\n2024-01-01,1\n",
+			expectedSkipped: 3,
+			expectedReasons: []string{"invalid timestamp", "in the future", "older than the metrics retention"},
+		},
+		{
+			name:             "duplicate timestamps in file",
+			csv:              "timestamp,mrr\n2026-01-01,1000\n2026-01-01T00:00:00Z,2000\n",
+			expectedParsed:   1,
+			expectedSkipped:  1,
+			expectedReasons:  []string{"duplicate of line 2"},
+			expectedFirstARR: 12000,
+		},
+		{
+			name:            "bad values",
+			csv:             "timestamp,mrr,new_mrr\n2026-01-01,,1\n2026-01-02,abc,1\n2026-01-03,1,x\n",
+			expectedSkipped: 3,
+			expectedReasons: []string{"missing mrr", "mrr is not a number", "new_mrr is not a number"},
+		},
+		{
+			name:             "annotations section of an export",
+			csv:              "timestamp,mrr\n2026-01-01,1000\n# annotations\ntimestamp,label,description\n2026-01-01T00:00:00Z,Launch,\n",
+			expectedParsed:   1,
+			expectedFirstARR: 12000,
+		},
+		{
+			name:        "missing required column",
+			csv:         "timestamp,arr\n2026-01-01,12000\n",
+			expectedErr: "mrr column",
+		},
+		{
+			name:        "missing timestamp column",
+			csv:         "mrr\n1000\n",
+			expectedErr: "timestamp or date column",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &MetricsImportResponse{}
+			parsed, lines, err := readImportCSV(strings.NewReader(tt.csv), "mrr", response, parseRevenueImportRow("live", "", now, notBefore))
+
+			if tt.expectedErr != "" {
+				if err == nil || !contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(parsed) != tt.expectedParsed {
+				t.Errorf("expected %d parsed rows, got %d", tt.expectedParsed, len(parsed))
+			}
+
+			if response.Skipped != tt.expectedSkipped {
+				t.Errorf("expected %d skipped rows, got %d: %+v", tt.expectedSkipped, response.Skipped, response.Errors)
+			}
+
+			for i, reason := range tt.expectedReasons {
+				if i >= len(response.Errors) || !contains(response.Errors[i].Reason, reason) {
+					t.Errorf("expected error %d to contain %q, got %+v", i, reason, response.Errors)
+				}
+			}
+
+			if len(parsed) > 0 {
+				if !floatEquals(parsed[0].ARR, tt.expectedFirstARR, 0.01) {
+					t.Errorf("expected ARR %v, got %v", tt.expectedFirstARR, parsed[0].ARR)
+				}
+
+				if lines[parsed[0].Timestamp.UnixNano()] != 2 {
+					t.Errorf("expected first snapshot to be read from line 2, got %d", lines[parsed[0].Timestamp.UnixNano()])
+				}
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_ImportKeepsMonthsOfHistory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	notBefore := now.AddDate(-1, 0, 0)
+	days := 200
+
+	var csv strings.Builder
+	csv.WriteString("date,mrr\n")
+	for d := days; d > 0; d-- {
+		fmt.Fprintf(&csv, "%s,%d\n", now.AddDate(0, 0, -d).Format(time.DateOnly), 1000+d)
+	}
+
+	importCSV := func(db *SimpleMetricsDB) *MetricsImportResponse {
+		response := &MetricsImportResponse{}
+		snapshots, lines, err := readImportCSV(strings.NewReader(csv.String()), "mrr", response, parseRevenueImportRow("live", "", now, notBefore))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		result, err := db.ImportRevenueSnapshots(ctx, "live", snapshots)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		response.addImportResult(result, lines)
+		return response
+	}
+
+	t.Run("every row survives later saves", func(t *testing.T) {
+		db := newSimpleMetricsDB()
+
+		response := importCSV(db)
+		if response.Imported != days || response.Skipped != 0 {
+			t.Fatalf("expected %d imported and none skipped, got %+v", days, response)
+		}
+
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: now, MRR: 1000, Mode: "live"})
+
+		history, _ := db.GetRevenueHistory(ctx, "live", notBefore, now, 0)
+		if len(history) != days+1 || !history[0].Timestamp.Equal(now.AddDate(0, 0, -days)) {
+			t.Errorf("expected the %d imported days and the saved snapshot, got %d snapshots", days, len(history))
+		}
+	})
+
+	t.Run("rows evicted by the budget are skipped", func(t *testing.T) {
+		db := newSimpleMetricsDB()
+		db.SetBudget(0, 150)
+
+		response := importCSV(db)
+		if response.Imported != 150 || response.Skipped != days-150 {
+			t.Fatalf("expected 150 imported and %d skipped, got %d and %d", days-150, response.Imported, response.Skipped)
+		}
+
+		// The oldest rows are the ones evicted, the first of them on line 2
+		if response.Errors[0].Line != 2 || !contains(response.Errors[0].Reason, "store budget") {
+			t.Errorf("expected the first row to be evicted by the budget, got %+v", response.Errors[0])
+		}
+	})
+}
@@ -0,0 +1,348 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// metricsFileEncryptedPrefix starts metrics files written with metrics.encrypt,
+// followed by the output of EncryptionService.EncryptBytes
+const metricsFileEncryptedPrefix = "glance-metrics-encrypted:v1\n"
+
+// metricsMigration upgrades a metrics file to version, working on the decoded
+// JSON so that it can read fields the structs no longer have
+type metricsMigration struct {
+	version     int
+	description string
+	migrate     func(file map[string]any) error
+}
+
+// metricsMigrations upgrade metrics files written by older versions, in order.
+// Add one with the next version whenever the file contents change in a way
+// that decoding into the current structs doesn't already handle, such as a
+// renamed field or a new field that shouldn't default to zero.
+var metricsMigrations = []metricsMigration{
+	{version: 2, description: "derive the net growth of customer snapshots", migrate: deriveCustomerNetGrowth},
+}
+
+// deriveCustomerNetGrowth sets the net growth of customer snapshots saved
+// before it was stored, which would otherwise load as no growth at all
+func deriveCustomerNetGrowth(file map[string]any) error {
+	modes, _ := file["customers"].(map[string]any)
+	for mode, snapshots := range modes {
+		snapshots, ok := snapshots.([]any)
+		if !ok {
+			return fmt.Errorf("customer snapshots of %s are not a list", mode)
+		}
+
+		for _, snapshot := range snapshots {
+			snapshot, ok := snapshot.(map[string]any)
+			if !ok {
+				return fmt.Errorf("customer snapshot of %s is not an object", mode)
+			}
+
+			if _, exists := snapshot["net_growth"]; exists {
+				continue
+			}
+
+			newCustomers, _ := snapshot["new_customers"].(float64)
+			churnedCustomers, _ := snapshot["churned_customers"].(float64)
+			snapshot["net_growth"] = newCustomers - churnedCustomers
+		}
+	}
+
+	return nil
+}
+
+// metricsSchemaVersion is the version of metrics files written by this version,
+// files without a version predate versioning and are version 1
+func metricsSchemaVersion(migrations []metricsMigration) int {
+	if len(migrations) == 0 {
+		return 1
+	}
+
+	return migrations[len(migrations)-1].version
+}
+
+// migrateMetricsFile applies the migrations newer than the version of file,
+// refusing files written by a newer version
+func migrateMetricsFile(file map[string]any, migrations []metricsMigration) error {
+	version := 1
+	if v, ok := file["schema_version"].(float64); ok {
+		version = int(v)
+	}
+
+	if current := metricsSchemaVersion(migrations); version > current {
+		return fmt.Errorf("file has schema version %d but this version of glance only supports up to %d, upgrade glance to open it", version, current)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= version {
+			continue
+		}
+
+		if err := migration.migrate(file); err != nil {
+			return fmt.Errorf("migrating to schema version %d (%s): %w", migration.version, migration.description, err)
+		}
+
+		slog.Info("Migrated metrics file", "version", migration.version, "migration", migration.description)
+		version = migration.version
+		file["schema_version"] = float64(version)
+	}
+
+	return nil
+}
+
+// metricsFile is the contents of the file set with metrics.path
+type metricsFile struct {
+	SchemaVersion int                            `json:"schema_version"`
+	Revenue       map[string][]*RevenueSnapshot  `json:"revenue"`
+	Customers     map[string][]*CustomerSnapshot `json:"customers"`
+	Deltas        map[string][]*MetricsDelta     `json:"deltas"`
+	Annotations   map[string][]*Annotation       `json:"annotations"`
+	// Last exact customer counts and the webhook events since, which
+	// incremental counting keeps the total from
+	CustomerBaselines map[string]*CustomerCountBaseline `json:"customer_baselines"`
+	// IDs of the webhook events processed last, so that redeliveries after a
+	// restart are still skipped
+	ProcessedEvents []string `json:"processed_events"`
+	// The webhook event log and the payloads of the events, to be looked into
+	// and replayed after a restart
+	WebhookEvents   []WebhookEvent         `json:"webhook_events"`
+	WebhookPayloads []storedWebhookPayload `json:"webhook_payloads"`
+	// Widgets refreshed last, polled by replicas reading the file
+	Changes []MetricsChange `json:"changes"`
+}
+
+func encodeMetricsFile(file *metricsFile, encrypt bool, encryption *EncryptionService) ([]byte, error) {
+	contents, err := json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encrypt {
+		return contents, nil
+	}
+
+	sealed, err := encryption.EncryptBytes(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(metricsFileEncryptedPrefix), sealed...), nil
+}
+
+// decodeMetricsFile reads a metrics file, decrypting it when it was written
+// encrypted regardless of whether encryption is still enabled and migrating it
+// to the current schema version
+func decodeMetricsFile(contents []byte, encryption *EncryptionService, migrations []metricsMigration) (*metricsFile, error) {
+	if sealed, ok := bytes.CutPrefix(contents, []byte(metricsFileEncryptedPrefix)); ok {
+		var err error
+		if contents, err = encryption.DecryptBytes(sealed); err != nil {
+			return nil, fmt.Errorf("file is encrypted with a different GLANCE_MASTER_KEY than the current one: %w", err)
+		}
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("file is not a valid metrics file: %w", err)
+	}
+
+	if err := migrateMetricsFile(raw, migrations); err != nil {
+		return nil, err
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &metricsFile{}
+	if err := json.Unmarshal(migrated, file); err != nil {
+		return nil, fmt.Errorf("file is not a valid metrics file: %w", err)
+	}
+
+	return file, nil
+}
+
+// SetPersistence saves snapshots, webhook deltas, annotations, customer count
+// baselines, processed webhook event IDs and the webhook event log to path when Persist or Close is
+// called, encrypting the file with encryption when encrypt is set. Snapshots
+// already in the file are loaded the first time a path is set. An empty path
+// keeps metrics in memory only.
+func (db *SimpleMetricsDB) SetPersistence(path string, encrypt bool, encryption *EncryptionService) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.applyQueuedWrites()
+
+	if path != "" && path != db.loadedPath {
+		contents, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		if err == nil {
+			file, err := decodeMetricsFile(contents, encryption, metricsMigrations)
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", path, err)
+			}
+
+			db.loadMetricsFile(file)
+			db.enforceBudget()
+		}
+
+		db.loadedPath = path
+	}
+
+	db.persistPath = path
+	db.persistEncrypt = encrypt
+	db.encryption = encryption
+
+	return nil
+}
+
+// loadMetricsFile merges the contents of a metrics file into memory. Must be
+// called with the lock held.
+func (db *SimpleMetricsDB) loadMetricsFile(file *metricsFile) {
+	for mode, snapshots := range file.Revenue {
+		merged, _ := mergeSnapshots(db.revenueHistory[mode], snapshots, func(s *RevenueSnapshot) time.Time { return s.Timestamp })
+		db.revenueHistory[mode] = merged
+	}
+
+	for mode, snapshots := range file.Customers {
+		merged, _ := mergeSnapshots(db.customerHistory[mode], snapshots, func(s *CustomerSnapshot) time.Time { return s.Timestamp })
+		db.customerHistory[mode] = merged
+	}
+
+	for mode, deltas := range file.Deltas {
+		merged := append(slices.Clone(deltas), db.deltas[mode]...)
+		slices.SortStableFunc(merged, func(a, b *MetricsDelta) int { return a.Timestamp.Compare(b.Timestamp) })
+		if len(merged) > maxDeltas {
+			merged = merged[len(merged)-maxDeltas:]
+		}
+		db.deltas[mode] = merged
+	}
+
+	for mode, annotations := range file.Annotations {
+		merged := append(slices.Clone(annotations), db.annotations[mode]...)
+		slices.SortStableFunc(merged, func(a, b *Annotation) int { return a.Timestamp.Compare(b.Timestamp) })
+		if len(merged) > maxAnnotations {
+			merged = merged[len(merged)-maxAnnotations:]
+		}
+		db.annotations[mode] = merged
+	}
+
+	for mode, baseline := range file.CustomerBaselines {
+		if current, ok := db.customerBaselines[mode]; !ok || baseline.Timestamp.After(current.Timestamp) {
+			db.customerBaselines[mode] = baseline
+		}
+	}
+
+	// Events processed since startup are the most recent
+	processed := newProcessedEvents(maxProcessedEvents)
+	for _, id := range append(file.ProcessedEvents, db.processedEvents.ids()...) {
+		processed.mark(id)
+	}
+	db.processedEvents = processed
+
+	db.loadWebhookLog(file.WebhookEvents, file.WebhookPayloads)
+
+	// The change log continues from the file so that replicas don't miss the
+	// changes recorded after a restart
+	if n := len(file.Changes); n > 0 && file.Changes[n-1].Sequence > db.changeSequence {
+		db.changes = file.Changes
+		db.changeSequence = file.Changes[n-1].Sequence
+	}
+}
+
+// replaceWithMetricsFile replaces the metrics in memory with the contents of a
+// metrics file, as replicas do with the file saved by the primary
+func (db *SimpleMetricsDB) replaceWithMetricsFile(file *metricsFile) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.applyQueuedWrites()
+
+	db.revenueHistory = make(map[string][]*RevenueSnapshot)
+	db.customerHistory = make(map[string][]*CustomerSnapshot)
+	db.customerBaselines = make(map[string]*CustomerCountBaseline)
+	db.deltas = make(map[string][]*MetricsDelta)
+	db.annotations = make(map[string][]*Annotation)
+	db.processedEvents = newProcessedEvents(maxProcessedEvents)
+	db.webhookEvents = nil
+	db.webhookPayloads, db.webhookPayloadOrder = nil, nil
+	db.changes, db.changeSequence = nil, 0
+
+	db.loadMetricsFile(file)
+}
+
+// Persist writes snapshots, webhook deltas, annotations, customer count
+// baselines, processed webhook event IDs and the webhook event log to the path set with
+// SetPersistence, replacing the previous file
+func (db *SimpleMetricsDB) Persist() error {
+	db.flushWrites()
+	db.mu.RLock()
+
+	path, encrypt, encryption := db.persistPath, db.persistEncrypt, db.encryption
+	if path == "" {
+		db.mu.RUnlock()
+		return nil
+	}
+
+	contents, err := encodeMetricsFile(&metricsFile{
+		SchemaVersion:     metricsSchemaVersion(metricsMigrations),
+		Revenue:           db.revenueHistory,
+		Customers:         db.customerHistory,
+		Deltas:            db.deltas,
+		Annotations:       db.annotations,
+		CustomerBaselines: db.customerBaselines,
+		ProcessedEvents:   db.processedEvents.ids(),
+		WebhookEvents:     db.webhookEvents,
+		WebhookPayloads:   db.storedWebhookPayloads(),
+		Changes:           db.changes,
+	}, encrypt, encryption)
+	db.mu.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("encoding metrics: %w", err)
+	}
+
+	// Write to a temporary file first so that a crash can't leave a partial file
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(contents); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// newMetricsPersistJob returns a background job that saves metrics to the
+// file set with metrics.path
+func newMetricsPersistJob(db *SimpleMetricsDB, interval time.Duration) *backgroundJob {
+	return &backgroundJob{
+		name:    "metrics-persist",
+		nextRun: everyInterval(interval),
+		run: func(ctx context.Context) {
+			if err := db.Persist(); err != nil {
+				slog.Error("Failed to save metrics", "error", err)
+			}
+		},
+	}
+}
@@ -0,0 +1,209 @@
+package glance
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func testEncryptionService(masterKey string) *EncryptionService {
+	return &EncryptionService{key: pbkdf2.Key([]byte(masterKey), []byte("test-salt"), 1, 32, sha256.New)}
+}
+
+func TestSimpleMetricsDB_Persistence(t *testing.T) {
+	ctx := context.Background()
+	timestamp := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name          string
+		encrypt       bool
+		loadKey       string
+		expectedError string
+	}{
+		{name: "plaintext", loadKey: "key-a"},
+		{name: "encrypted", encrypt: true, loadKey: "key-a"},
+		{name: "encrypted with a changed key", encrypt: true, loadKey: "key-b", expectedError: "different GLANCE_MASTER_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+
+			db := newSimpleMetricsDB()
+			if err := db.SetPersistence(path, tt.encrypt, testEncryptionService("key-a")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timestamp, MRR: 1234.5, Mode: "live"})
+			db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: timestamp, TotalCustomers: 42, Mode: "live"})
+			db.SaveDelta(ctx, &MetricsDelta{Timestamp: timestamp, NewMRR: 10, Mode: "live"})
+			db.SaveAnnotation(ctx, &Annotation{Timestamp: timestamp, Mode: "live", Label: "Launch"})
+			db.SaveCustomerBaseline(ctx, "live", 40, timestamp)
+			db.RecordCustomerEvent(ctx, "live", true)
+			if err := db.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			contents, _ := os.ReadFile(path)
+			if encrypted := !contains(string(contents), "1234.5"); encrypted != tt.encrypt {
+				t.Errorf("expected file to be encrypted: %v, got %q", tt.encrypt, contents)
+			}
+
+			loaded := newSimpleMetricsDB()
+			err := loaded.SetPersistence(path, tt.encrypt, testEncryptionService(tt.loadKey))
+			if tt.expectedError != "" {
+				if err == nil || !contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+
+				if latest, _ := loaded.GetLatestRevenue(ctx, "live"); latest != nil {
+					t.Errorf("expected nothing to be loaded, got %+v", latest)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			revenue, _ := loaded.GetLatestRevenue(ctx, "live")
+			customers, _ := loaded.GetLatestCustomers(ctx, "live")
+			deltas, _ := loaded.GetDeltas(ctx, "live", timestamp, timestamp)
+			annotations, _ := loaded.ListAnnotations(ctx, "live", timestamp, timestamp)
+			if revenue == nil || revenue.MRR != 1234.5 || customers == nil || customers.TotalCustomers != 42 || len(deltas) != 1 || len(annotations) != 1 {
+				t.Errorf("expected saved metrics to be loaded, got %+v, %+v, %d deltas, %d annotations", revenue, customers, len(deltas), len(annotations))
+			}
+
+			if baseline, _ := loaded.GetCustomerBaseline(ctx, "live"); baseline == nil || baseline.TotalCustomers != 40 || baseline.CreatedSince != 1 || !baseline.Timestamp.Equal(timestamp) {
+				t.Errorf("expected the customer count baseline to be loaded, got %+v", baseline)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_PersistenceMissingFile(t *testing.T) {
+	db := newSimpleMetricsDB()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	if err := db.SetPersistence(path, false, testEncryptionService("key-a")); err != nil {
+		t.Fatalf("expected a missing file to start empty, got %v", err)
+	}
+
+	if err := db.Persist(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected file to be written, got %v", err)
+	}
+}
+
+func TestDecodeMetricsFile_Migrations(t *testing.T) {
+	v1 := `{
+		"revenue": {"live": [{"timestamp": "2026-01-31T23:59:59Z", "mrr": 1000, "mode": "live"}]},
+		"customers": {"live": [{"timestamp": "2026-01-31T23:59:59Z", "total_customers": 10, "mode": "live"}]}
+	}`
+
+	var migrated []int
+	migrations := []metricsMigration{
+		{version: 2, description: "derive arr", migrate: func(file map[string]any) error {
+			migrated = append(migrated, 2)
+			for _, snapshots := range file["revenue"].(map[string]any) {
+				for _, snapshot := range snapshots.([]any) {
+					snapshot := snapshot.(map[string]any)
+					snapshot["arr"] = snapshot["mrr"].(float64) * 12
+				}
+			}
+			return nil
+		}},
+		{version: 3, description: "add a column", migrate: func(file map[string]any) error {
+			migrated = append(migrated, 3)
+			return nil
+		}},
+	}
+
+	file, err := decodeMetricsFile([]byte(v1), testEncryptionService("key-a"), migrations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Equal(migrated, []int{2, 3}) || file.SchemaVersion != 3 {
+		t.Errorf("expected migrations 2 and 3 to run in order, ran %v and reached version %d", migrated, file.SchemaVersion)
+	}
+
+	revenue, customers := file.Revenue["live"][0], file.Customers["live"][0]
+	if revenue.MRR != 1000 || revenue.ARR != 12000 || revenue.NewMRR != 0 || revenue.GrowthRate != 0 {
+		t.Errorf("unexpected migrated revenue snapshot: %+v", revenue)
+	}
+
+	if customers.TotalCustomers != 10 || customers.ChurnRate != 0 || customers.Estimated {
+		t.Errorf("expected fields missing from v1 to load as zero, got %+v", customers)
+	}
+
+	migrated = nil
+	if _, err := decodeMetricsFile([]byte(`{"schema_version": 2, "revenue": {}}`), nil, migrations); err != nil || !slices.Equal(migrated, []int{3}) {
+		t.Errorf("expected only migration 3 to run on a v2 file, ran %v: %v", migrated, err)
+	}
+
+	_, err = decodeMetricsFile([]byte(`{"schema_version": 4}`), nil, migrations)
+	if err == nil || !contains(err.Error(), "upgrade glance") {
+		t.Errorf("expected a file from a newer version to be refused, got %v", err)
+	}
+}
+
+func TestSimpleMetricsDB_LoadsVersion1File(t *testing.T) {
+	ctx := context.Background()
+
+	contents, err := os.ReadFile("testdata/metrics/v1.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	db := newSimpleMetricsDB()
+	if err := db.SetPersistence(path, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	from := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	live, _ := db.GetCustomerHistory(ctx, "live", from, to, 0)
+	if len(live) != 2 || live[0].NetGrowth != 4 || live[1].NetGrowth != -2 || live[1].TotalCustomers != 42 {
+		t.Fatalf("expected the net growth to be derived from new and churned customers, got %+v", live)
+	}
+
+	// Snapshots that already had it keep theirs
+	test, _ := db.GetCustomerHistory(ctx, "test", from, to, 0)
+	if len(test) != 1 || test[0].NetGrowth != 1 {
+		t.Errorf("expected the stored net growth to be kept, got %+v", test)
+	}
+
+	revenue, _ := db.GetRevenueHistory(ctx, "live", from, to, 0)
+	if len(revenue) != 2 || revenue[1].MRR != 1080 || revenue[1].ChurnedMRR != 40 {
+		t.Errorf("expected revenue snapshots to load unchanged, got %+v", revenue)
+	}
+
+	if err := db.Persist(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	saved, _ := os.ReadFile(path)
+	if _, err := decodeMetricsFile(saved, nil, nil); err == nil {
+		t.Fatal("expected the saved file to need a newer version than 1")
+	}
+
+	file, err := decodeMetricsFile(saved, nil, metricsMigrations)
+	if err != nil || file.SchemaVersion != 2 || file.Customers["live"][0].NetGrowth != 4 {
+		t.Errorf("expected the file to be saved upgraded to version 2, got %+v: %v", file, err)
+	}
+}
@@ -0,0 +1,137 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Languages that write the currency symbol after the amount, as in 1.234,50 €
+var symbolAfterAmountLanguages = map[string]bool{
+	"cs": true, "da": true, "de": true, "es": true, "fi": true, "fr": true,
+	"hu": true, "it": true, "nb": true, "no": true, "pl": true, "ro": true,
+	"ru": true, "sk": true, "sv": true, "uk": true,
+}
+
+// moneyFormat formats amounts in the reporting currency as amounts of Currency
+// with the separators of Locale, set with the currency and locale options of
+// the money widgets
+type moneyFormat struct {
+	Currency string // lower case
+	Locale   language.Tag
+	// Value of one unit of Currency in the reporting currency
+	rate float64
+}
+
+func newMoneyFormat(currency string, locale language.Tag) moneyFormat {
+	return moneyFormat{Currency: normalizeCurrency(currency), Locale: locale, rate: 1}
+}
+
+// parseMoneyLocale parses the locale option of a money widget, defaulting to
+// English
+func parseMoneyLocale(locale string) (language.Tag, error) {
+	if locale == "" {
+		return language.English, nil
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.Und, fmt.Errorf("locale must be a language tag like en-US or de, got: %s", locale)
+	}
+
+	return tag, nil
+}
+
+// validateMoneyOptions validates the currency and locale options of a money
+// widget, setting tag to the parsed locale
+func validateMoneyOptions(currency, locale string, tag *language.Tag) error {
+	if currency != "" {
+		if err := validateCurrencyCode(currency); err != nil {
+			return fmt.Errorf("currency: %w", err)
+		}
+	}
+
+	parsed, err := parseMoneyLocale(locale)
+	if err != nil {
+		return err
+	}
+	*tag = parsed
+
+	return nil
+}
+
+// displayMoneyFormat returns the format of a widget showing amounts in
+// currency, converted from the reporting currency of converter. Falls back to
+// the reporting currency when currency is empty or has no exchange rate.
+func displayMoneyFormat(ctx context.Context, converter *CurrencyConverter, currency string, locale language.Tag) moneyFormat {
+	reporting := converter.ReportingCurrency()
+	currency = normalizeCurrency(currency)
+	if currency == "" || currency == reporting {
+		return newMoneyFormat(reporting, locale)
+	}
+
+	rate, ok := converter.Rate(ctx, currency)
+	if !ok {
+		slog.Warn("No exchange rate for the currency of a widget, showing the reporting currency", "currency", currency, "reporting_currency", reporting)
+		return newMoneyFormat(reporting, locale)
+	}
+
+	format := newMoneyFormat(currency, locale)
+	format.rate = rate
+	return format
+}
+
+// In returns the format of amounts already in currency, such as the MRR
+// billed in each currency
+func (m moneyFormat) In(currency string) moneyFormat {
+	return newMoneyFormat(currency, m.Locale)
+}
+
+// Symbol returns the symbol of the currency, or its upper case code when it
+// has none
+func (m moneyFormat) Symbol() string {
+	return strings.TrimSpace(currencySymbol(m.Currency))
+}
+
+// format formats an amount in the reporting currency with the symbol of the
+// currency, the separators of the locale and two decimals, or none for
+// currencies without minor units such as JPY
+func (m moneyFormat) format(amount float64) string {
+	if m.rate > 0 {
+		amount /= m.rate
+	}
+
+	decimals := 2
+	if zeroDecimalCurrencies[m.Currency] {
+		decimals = 0
+	}
+
+	sign := ""
+	if amount < 0 && math.Round(amount*math.Pow10(decimals)) != 0 {
+		sign = "-"
+	}
+
+	locale := m.Locale
+	if locale == language.Und {
+		locale = language.English
+	}
+
+	number := message.NewPrinter(locale).Sprintf("%."+strconv.Itoa(decimals)+"f", math.Abs(amount))
+	base, _ := locale.Base()
+	if symbolAfterAmountLanguages[base.String()] {
+		return sign + number + " " + m.Symbol()
+	}
+
+	return sign + currencySymbol(m.Currency) + number
+}
+
+// formatMoney is the template function formatting an amount of a money widget
+func formatMoney(m moneyFormat, amount float64) string {
+	return m.format(amount)
+}
@@ -0,0 +1,83 @@
+package glance
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		locale   language.Tag
+		amount   float64
+		expected string
+	}{
+		{"usd", "usd", language.English, 12345.6789, "$12,345.68"},
+		{"usd negative", "usd", language.English, -1234.5, "-$1,234.50"},
+		{"usd rounds to zero", "usd", language.English, -0.001, "$0.00"},
+		{"eur in german", "eur", language.German, 12345.6789, "12.345,68 €"},
+		{"eur in english", "EUR", language.English, 12345.6789, "€12,345.68"},
+		{"jpy has no decimals", "jpy", language.Japanese, 12345.6789, "¥12,346"},
+		{"unknown currency uses its code", "xyz", language.English, 1234.5, "XYZ 1,234.50"},
+		{"unknown currency after amount", "xyz", language.French, 1234.5, "1 234,50 XYZ"},
+		{"undetermined locale", "usd", language.Und, 1234.5, "$1,234.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatMoney(newMoneyFormat(tt.currency, tt.locale), tt.amount); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDisplayMoneyFormat(t *testing.T) {
+	ctx := context.Background()
+	converter := newCurrencyConverter("usd", map[string]float64{"eur": 1.25}, nil)
+
+	tests := []struct {
+		name     string
+		currency string
+		expected string
+	}{
+		{"reporting currency by default", "", "$1,000.00"},
+		{"converted from the reporting currency", "EUR", "€800.00"},
+		{"reporting currency without a rate", "gbp", "$1,000.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := displayMoneyFormat(ctx, converter, tt.currency, language.English)
+			if got := formatMoney(format, 1000); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+
+			if got := formatMoney(format.In("jpy"), 1000); got != "¥1,000" {
+				t.Errorf("expected amounts in another currency not to be converted, got %q", got)
+			}
+		})
+	}
+}
+
+func TestValidateMoneyOptions(t *testing.T) {
+	var tag language.Tag
+	if err := validateMoneyOptions("", "", &tag); err != nil || tag != language.English {
+		t.Errorf("expected English by default, got %v, %v", tag, err)
+	}
+
+	if err := validateMoneyOptions("eur", "de-DE", &tag); err != nil || tag != language.MustParse("de-DE") {
+		t.Errorf("expected de-DE, got %v, %v", tag, err)
+	}
+
+	if err := validateMoneyOptions("euro", "", &tag); err == nil {
+		t.Error("expected an error for an invalid currency")
+	}
+
+	if err := validateMoneyOptions("", "not a locale", &tag); err == nil {
+		t.Error("expected an error for an invalid locale")
+	}
+}
@@ -0,0 +1,182 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errAdministrativelyPaused = errors.New("administratively paused")
+
+// maxDeferredWhilePaused is how much work, mostly received webhook events, is
+// kept to replay on resume, the oldest dropped first
+const maxDeferredWhilePaused = 10000
+
+// pauseState is the process-wide administrative pause flag. It lives outside of
+// the application so that it persists across config reloads but not restarts.
+type pauseState struct {
+	mu       sync.Mutex
+	paused   bool
+	since    time.Time
+	deferred []func()
+	// Deferred work dropped over maxDeferredWhilePaused, since startup
+	dropped int
+}
+
+var globalPause = &pauseState{}
+
+func (p *pauseState) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+// pausedSince returns when the pause started and whether it's active
+func (p *pauseState) pausedSince() (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.since, p.paused
+}
+
+// pause stops background activity, returning false if already paused
+func (p *pauseState) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return false
+	}
+
+	p.paused = true
+	p.since = time.Now()
+	slog.Warn("Background activity administratively paused")
+
+	return true
+}
+
+// resume restarts background activity and replays work deferred while paused,
+// returning false if not paused
+func (p *pauseState) resume() bool {
+	p.mu.Lock()
+
+	if !p.paused {
+		p.mu.Unlock()
+		return false
+	}
+
+	p.paused = false
+	p.since = time.Time{}
+	deferred := p.deferred
+	p.deferred = nil
+	p.mu.Unlock()
+
+	slog.Info("Background activity resumed", "replaying", len(deferred))
+
+	go func() {
+		for _, fn := range deferred {
+			fn()
+		}
+	}()
+
+	return true
+}
+
+func (p *pauseState) toggle() {
+	if !p.pause() {
+		p.resume()
+	}
+}
+
+// deferWhilePaused queues fn to run on resume and returns true when paused,
+// otherwise it returns false and the caller should proceed as usual
+func (p *pauseState) deferWhilePaused(fn func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return false
+	}
+
+	p.deferred = append(p.deferred, fn)
+	if over := len(p.deferred) - maxDeferredWhilePaused; over > 0 {
+		p.deferred = p.deferred[over:]
+		p.dropped += over
+		slog.Warn("Dropped the oldest work deferred while paused", "dropped", over, "deferred", len(p.deferred))
+	}
+
+	return true
+}
+
+// deferredStats returns how much work waits for the resume and how much was
+// dropped since startup
+func (p *pauseState) deferredStats() (deferred, dropped int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.deferred), p.dropped
+}
+
+// PauseHealthDetails holds the details of the pause health check
+type PauseHealthDetails struct {
+	PausedSince time.Time `json:"paused_since"`
+}
+
+// checkPauseHealth reports the dashboard as degraded while paused
+func checkPauseHealth(ctx context.Context) *HealthCheckResult {
+	since, paused := globalPause.pausedSince()
+	if !paused {
+		return &HealthCheckResult{
+			Status:  HealthStatusHealthy,
+			Message: "Background activity running",
+		}
+	}
+
+	return &HealthCheckResult{
+		Status:  HealthStatusDegraded,
+		Message: "administratively paused",
+		Details: &PauseHealthDetails{
+			PausedSince: since,
+		},
+	}
+}
+
+// PauseStatusResponse is the response of the pause and resume endpoints
+type PauseStatusResponse struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+func writePauseStatus(w http.ResponseWriter) {
+	response := PauseStatusResponse{}
+	if since, paused := globalPause.pausedSince(); paused {
+		response.Paused = true
+		response.Since = &since
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (a *application) handlePauseRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	globalPause.pause()
+	writePauseStatus(w)
+}
+
+func (a *application) handleResumeRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	globalPause.resume()
+	writePauseStatus(w)
+}
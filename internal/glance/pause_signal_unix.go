@@ -0,0 +1,21 @@
+//go:build !windows
+
+package glance
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// listenForPauseToggleSignal toggles the administrative pause on SIGUSR2
+func listenForPauseToggleSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+
+	go func() {
+		for range signals {
+			globalPause.toggle()
+		}
+	}()
+}
@@ -0,0 +1,7 @@
+//go:build windows
+
+package glance
+
+// listenForPauseToggleSignal is a no-op since SIGUSR2 doesn't exist on Windows,
+// use the /api/admin/pause and /api/admin/resume endpoints instead
+func listenForPauseToggleSignal() {}
@@ -0,0 +1,93 @@
+package glance
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseState_DefersWorkUntilResume(t *testing.T) {
+	state := &pauseState{}
+
+	if state.deferWhilePaused(func() {}) {
+		t.Fatal("expected work not to be deferred while running")
+	}
+
+	if !state.pause() {
+		t.Fatal("expected pause to change state")
+	}
+
+	if state.pause() {
+		t.Error("expected second pause to be a no-op")
+	}
+
+	replayed := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		if !state.deferWhilePaused(func() { replayed <- i }) {
+			t.Fatal("expected work to be deferred while paused")
+		}
+	}
+
+	if !state.resume() {
+		t.Fatal("expected resume to change state")
+	}
+
+	for want := 1; want <= 2; want++ {
+		select {
+		case got := <-replayed:
+			if got != want {
+				t.Errorf("expected deferred work %d to replay in order, got %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("deferred work was not replayed on resume")
+		}
+	}
+
+	if state.isPaused() {
+		t.Error("expected state to be running after resume")
+	}
+}
+
+func TestPause_BlocksSnapshotWritesAndDegradesHealth(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	globalPause.pause()
+	defer globalPause.resume()
+
+	if err := db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now(), Mode: "live"}); err != errAdministrativelyPaused {
+		t.Errorf("expected errAdministrativelyPaused, got %v", err)
+	}
+
+	result := checkPauseHealth(ctx)
+	if result.Status != HealthStatusDegraded || result.Message != "administratively paused" {
+		t.Errorf("expected degraded health while paused, got %s: %s", result.Status, result.Message)
+	}
+}
+
+func TestPauseState_DropsOldestDeferredOverLimit(t *testing.T) {
+	state := &pauseState{}
+	state.pause()
+
+	var first atomic.Int32
+	for i := range maxDeferredWhilePaused + 2 {
+		state.deferWhilePaused(func() {
+			if i < 2 {
+				first.Add(1)
+			}
+		})
+	}
+
+	if deferred, dropped := state.deferredStats(); deferred != maxDeferredWhilePaused || dropped != 2 {
+		t.Fatalf("expected %d deferred and 2 dropped, got %d and %d", maxDeferredWhilePaused, deferred, dropped)
+	}
+
+	for _, fn := range state.deferred {
+		fn()
+	}
+
+	if first.Load() != 0 {
+		t.Error("expected the oldest deferred work to be the one dropped")
+	}
+}
@@ -0,0 +1,219 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	replicationRolePrimary = "primary"
+	replicationRoleReplica = "replica"
+)
+
+// Replicas don't talk to Stripe, they render the Stripe backed widgets from the
+// snapshots the primary saves to the shared metrics file and refresh them
+// whenever the primary records a change.
+
+// replicaSource reloads the store from the metrics file saved by the primary
+// whenever the file changed
+type replicaSource struct {
+	path       string
+	encryption *EncryptionService
+	modifiedAt time.Time
+}
+
+// reload replaces the contents of db with the metrics file when it was saved
+// again since the last reload
+func (s *replicaSource) reload(db *SimpleMetricsDB) error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing saved by the primary yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.ModTime().Equal(s.modifiedAt) {
+		return nil
+	}
+
+	contents, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	file, err := decodeMetricsFile(contents, s.encryption, metricsMigrations)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", s.path, err)
+	}
+
+	db.replaceWithMetricsFile(file)
+	s.modifiedAt = info.ModTime()
+	return nil
+}
+
+// loadFromStore populates the widget from the latest stored revenue snapshot
+func (w *revenueWidget) loadFromStore(ctx context.Context, db *SimpleMetricsDB) {
+	latest, err := db.GetLatestRevenue(ctx, w.metricsKey())
+	if errors.Is(err, ErrNoSnapshot) {
+		err = fmt.Errorf("no revenue snapshots from the primary yet")
+	}
+	if !w.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	w.Currency = GetCurrencyConverter().ReportingCurrency()
+	w.Money = displayMoneyFormat(ctx, GetCurrencyConverter(), w.DisplayCurrency, w.locale)
+	w.CurrentMRR = latest.MRR
+	w.ARR = latest.ARR
+	w.NewMRR = latest.NewMRR
+	w.ChurnedMRR = latest.ChurnedMRR
+	w.monthChurnedMRR = latest.ChurnedMRR
+	w.NetNewMRR = w.NewMRR - w.ChurnedMRR
+	// Reactivations aren't stored, so they're shown as new MRR
+	w.ReactivationMRR = 0
+	w.GrowthRate = latest.GrowthRate
+	w.ARPU = latest.ARPU
+	w.updateGoal()
+	w.CollectedRevenue = latest.Collected
+	if w.IncludeOneTime {
+		// Not stored in snapshots, replicas add up the webhook deltas
+		w.updateOneTimeRevenue(ctx, db, nil, w.now())
+	}
+	w.updateTTMRevenue(ctx, db, w.now())
+	w.setQuickRatio(latest.QuickRatio)
+	w.setNRR(latest.NRR)
+	w.updateGrossRevenueChurn(ctx, db, w.now())
+	w.updateMovements(ctx, db, w.now())
+
+	now := w.now()
+	// Growth as of the latest snapshot, whose previous update is the one
+	// before it
+	w.updateGrowth(ctx, db, latest.Timestamp.In(now.Location()))
+	w.comparePeriods(ctx, db, now)
+
+	history, err := db.GetRevenueMonthly(ctx, w.metricsKey(), now, w.TrendMonths)
+	if err != nil || !w.loadHistoricalData(history) {
+		w.TrendLabels, w.TrendValues = nil, nil
+	}
+}
+
+// loadFromStore populates the widget from the latest stored customer snapshot
+func (w *customersWidget) loadFromStore(ctx context.Context, db *SimpleMetricsDB) {
+	latest, err := db.GetLatestCustomers(ctx, w.metricsKey())
+	if errors.Is(err, ErrNoSnapshot) {
+		err = fmt.Errorf("no customer snapshots from the primary yet")
+	}
+	if !w.canContinueUpdateAfterHandlingErr(err) {
+		return
+	}
+
+	w.Money = displayMoneyFormat(ctx, GetCurrencyConverter(), w.DisplayCurrency, w.locale)
+	w.TotalCustomers = latest.TotalCustomers
+	w.NewCustomers = latest.NewCustomers
+	w.ReactivatedCustomers = latest.ReactivatedCustomers
+	w.ChurnedCustomers = latest.ChurnedCustomers
+	w.ChurnRate = latest.ChurnRate
+	w.ActiveCustomers = latest.ActiveCustomers
+	w.NetGrowth = latest.NetGrowth
+	w.GrowthRate, w.GrowthDefined = 0, latest.GrowthRate != nil
+	if latest.GrowthRate != nil {
+		w.GrowthRate = *latest.GrowthRate
+	}
+	w.GrowthBaselineLabel = w.baseline().label()
+	w.TotalIsEstimate = latest.Estimated
+
+	now := w.now()
+	history, err := db.GetCustomerMonthly(ctx, w.metricsKey(), now, w.TrendMonths)
+	if err != nil || !w.loadHistoricalData(history) {
+		w.TrendLabels, w.TrendValues, w.TrendEstimated = nil, nil, nil
+		w.TrendEstimatedMonths = 0
+	}
+}
+
+// newReplicaPollJob returns a job that reloads the metrics file saved by the
+// primary and refreshes the widgets of the changes it recorded since
+func newReplicaPollJob(app *application, db *SimpleMetricsDB, source *replicaSource, interval time.Duration) *backgroundJob {
+	if err := source.reload(db); err != nil {
+		slog.Error("Failed to load metrics saved by the primary", "error", err)
+	}
+	lastSequence := db.LatestChangeSequence(context.Background())
+
+	return &backgroundJob{
+		name:    "replica-poll",
+		nextRun: everyInterval(interval),
+		run: func(ctx context.Context) {
+			if err := source.reload(db); err != nil {
+				slog.Error("Failed to load metrics saved by the primary", "error", err)
+				return
+			}
+
+			// The primary started over without its file
+			if db.LatestChangeSequence(ctx) < lastSequence {
+				lastSequence = 0
+			}
+
+			changes, err := db.GetChangesSince(ctx, lastSequence)
+			if err != nil {
+				slog.Error("Failed to poll metrics changes", "error", err)
+				return
+			}
+
+			refreshed := make(map[string]bool)
+			for _, change := range changes {
+				lastSequence = change.Sequence
+
+				if refreshed[change.WidgetType] {
+					continue
+				}
+				refreshed[change.WidgetType] = true
+
+				app.refreshWidgets(ctx, change.WidgetType)
+			}
+		},
+	}
+}
+
+// PrimaryHealthDetails holds the details of the primary freshness health check
+type PrimaryHealthDetails struct {
+	LastSnapshotAt *time.Time `json:"last_snapshot_at,omitempty"`
+	StaleAfter     string     `json:"stale_after"`
+}
+
+// newPrimaryHealthCheck returns a health check reporting the dashboard as
+// degraded when the primary hasn't written a snapshot within staleAfter
+func newPrimaryHealthCheck(db *SimpleMetricsDB, staleAfter time.Duration) HealthCheckFunc {
+	return func(ctx context.Context) *HealthCheckResult {
+		details := &PrimaryHealthDetails{StaleAfter: staleAfter.String()}
+
+		last, ok := db.GetLatestSnapshotTime(ctx)
+		if !ok {
+			return &HealthCheckResult{
+				Status:  HealthStatusDegraded,
+				Message: "No snapshots from the primary yet",
+				Details: details,
+			}
+		}
+
+		details.LastSnapshotAt = &last
+
+		if age := time.Since(last); age > staleAfter {
+			return &HealthCheckResult{
+				Status:  HealthStatusDegraded,
+				Message: fmt.Sprintf("Primary is stale, last snapshot %s ago", age.Truncate(time.Second)),
+				Details: details,
+			}
+		}
+
+		return &HealthCheckResult{
+			Status:  HealthStatusHealthy,
+			Message: "Primary is writing snapshots",
+			Details: details,
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package glance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplication_ReplicaRendersPrimarySnapshots(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	primary := newSimpleMetricsDB()
+	if err := primary.SetPersistence(path, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A separate process, sharing only the file
+	store := newSimpleMetricsDB()
+	source := &replicaSource{path: path}
+
+	replica := &application{widgetByID: make(map[uint64]widget)}
+	replica.Config.Replication.Role = replicationRoleReplica
+
+	revenue := &revenueWidget{StripeMode: "live", store: store}
+	customers := &customersWidget{StripeMode: "live", store: store}
+	replica.widgetByID[1] = revenue
+	replica.widgetByID[2] = customers
+
+	// Nothing has been written by the primary yet
+	revenue.update(ctx)
+	if revenue.Error == nil {
+		t.Error("expected an error before the primary has written snapshots")
+	}
+
+	poll := newReplicaPollJob(replica, store, source, time.Second)
+
+	// The primary saves snapshots, records the change and writes its file
+	primary.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now(), MRR: 1200, ARR: 14400, NewMRR: 200, Mode: "live"})
+	primary.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: time.Now(), TotalCustomers: 40, ActiveCustomers: 35, Mode: "live"})
+	primary.RecordChange(ctx, "revenue")
+	primary.RecordChange(ctx, "customers")
+
+	// Not saved yet
+	poll.run(ctx)
+	if revenue.CurrentMRR != 0 {
+		t.Error("expected no refresh before the primary saved its file")
+	}
+
+	if err := primary.Persist(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	poll.run(ctx)
+
+	if revenue.Error != nil || revenue.CurrentMRR != 1200 || revenue.ARR != 14400 || revenue.NetNewMRR != 200 {
+		t.Errorf("expected replica revenue widget to show the primary's snapshot, got MRR %f (error %v)", revenue.CurrentMRR, revenue.Error)
+	}
+
+	if customers.TotalCustomers != 40 || customers.ActiveCustomers != 35 {
+		t.Errorf("expected replica customers widget to show the primary's snapshot, got %d total", customers.TotalCustomers)
+	}
+
+	if check := newPrimaryHealthCheck(store, time.Hour)(ctx); check.Status != HealthStatusHealthy {
+		t.Errorf("expected the replica to see a fresh primary, got %s: %s", check.Status, check.Message)
+	}
+
+	// Already seen changes don't refresh the widgets again
+	revenue.CurrentMRR = 0
+	poll.run(ctx)
+	if revenue.CurrentMRR != 0 {
+		t.Error("expected no refresh without new changes")
+	}
+
+	// A newer file replaces what the replica loaded before
+	primary.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now().Add(time.Second), MRR: 1300, Mode: "live"})
+	primary.RecordChange(ctx, "revenue")
+	if err := primary.Persist(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// File systems with coarse modification times
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+
+	poll.run(ctx)
+	if revenue.CurrentMRR != 1300 {
+		t.Errorf("expected the replica to reload the newer file, got MRR %f", revenue.CurrentMRR)
+	}
+}
+
+func TestReplication_PrimaryRecordsChangesOnRefresh(t *testing.T) {
+	ctx := context.Background()
+	db, _ := GetMetricsDatabase("")
+	before := db.LatestChangeSequence(ctx)
+
+	primary := &application{widgetByID: make(map[uint64]widget)}
+	primary.Config.Replication.Role = replicationRolePrimary
+
+	primary.refreshWidgets(ctx, "revenue")
+
+	changes, _ := db.GetChangesSince(ctx, before)
+	if len(changes) != 1 || changes[0].WidgetType != "revenue" {
+		t.Errorf("expected one revenue change, got %+v", changes)
+	}
+
+	replica := &application{widgetByID: make(map[uint64]widget)}
+	replica.Config.Replication.Role = replicationRoleReplica
+	replica.refreshWidgets(ctx, "revenue")
+
+	if db.LatestChangeSequence(ctx) != changes[0].Sequence {
+		t.Error("expected replicas not to record changes")
+	}
+}
+
+func TestReplication_PrimaryHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	store := newSimpleMetricsDB()
+	check := newPrimaryHealthCheck(store, time.Hour)
+
+	if result := check(ctx); result.Status != HealthStatusDegraded {
+		t.Errorf("expected degraded without snapshots, got %s", result.Status)
+	}
+
+	store.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now().Add(-2 * time.Hour), Mode: "live"})
+	if result := check(ctx); result.Status != HealthStatusDegraded {
+		t.Errorf("expected degraded with a stale primary, got %s: %s", result.Status, result.Message)
+	}
+
+	store.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: time.Now(), Mode: "test"})
+	if result := check(ctx); result.Status != HealthStatusHealthy {
+		t.Errorf("expected healthy with a fresh snapshot, got %s: %s", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,132 @@
+package glance
+
+import (
+	"slices"
+	"sync"
+)
+
+const defaultAnomalyMedianMultiple = 10.0
+
+// Reasons a subscription is flagged as anomalous
+const (
+	anomalyReasonOutlier  = "mrr far above median"
+	anomalyReasonCurrency = "currency differs from account"
+	anomalyReasonDaily    = "day-based interval"
+)
+
+// subscriptionMRR is the normalized MRR of a single subscription
+type subscriptionMRR struct {
+	ID        string
+	Currency  string
+	DailyPlan bool // at least one item is billed per day
+	MRR       float64
+}
+
+// subscriptionAnomaly is a subscription flagged as likely mispriced
+type subscriptionAnomaly struct {
+	SubscriptionID string
+	Currency       string
+	MRR            float64
+	Reasons        []string
+}
+
+// detectSubscriptionAnomalies flags subscriptions whose MRR exceeds
+// medianMultiple times the median, whose currency differs from the dominant
+// currency of the account or that are billed per day
+func detectSubscriptionAnomalies(subscriptions []subscriptionMRR, medianMultiple float64) []subscriptionAnomaly {
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	median := medianSubscriptionMRR(subscriptions)
+	currency := dominantCurrency(subscriptions)
+
+	var anomalies []subscriptionAnomaly
+	for _, sub := range subscriptions {
+		var reasons []string
+
+		if median > 0 && sub.MRR > median*medianMultiple {
+			reasons = append(reasons, anomalyReasonOutlier)
+		}
+
+		if sub.Currency != currency {
+			reasons = append(reasons, anomalyReasonCurrency)
+		}
+
+		if sub.DailyPlan {
+			reasons = append(reasons, anomalyReasonDaily)
+		}
+
+		if len(reasons) > 0 {
+			anomalies = append(anomalies, subscriptionAnomaly{
+				SubscriptionID: sub.ID,
+				Currency:       sub.Currency,
+				MRR:            sub.MRR,
+				Reasons:        reasons,
+			})
+		}
+	}
+
+	return anomalies
+}
+
+func medianSubscriptionMRR(subscriptions []subscriptionMRR) float64 {
+	values := make([]float64, len(subscriptions))
+	for i, sub := range subscriptions {
+		values[i] = sub.MRR
+	}
+
+	slices.Sort(values)
+
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+
+	return values[middle]
+}
+
+// dominantCurrency returns the currency used by the most subscriptions,
+// breaking ties alphabetically so the result is stable
+func dominantCurrency(subscriptions []subscriptionMRR) string {
+	counts := make(map[string]int)
+	for _, sub := range subscriptions {
+		counts[sub.Currency]++
+	}
+
+	dominant, dominantCount := "", 0
+	for currency, count := range counts {
+		if count > dominantCount || (count == dominantCount && currency < dominant) {
+			dominant, dominantCount = currency, count
+		}
+	}
+
+	return dominant
+}
+
+var (
+	anomalousSubscriptionsMu sync.RWMutex
+	anomalousSubscriptions   = make(map[string]int) // key: mode
+)
+
+// recordAnomalousSubscriptions stores the latest anomaly count for a mode so
+// it can be exported as a metric
+func recordAnomalousSubscriptions(mode string, count int) {
+	anomalousSubscriptionsMu.Lock()
+	defer anomalousSubscriptionsMu.Unlock()
+
+	anomalousSubscriptions[mode] = count
+}
+
+// getAnomalousSubscriptions returns a copy of the latest anomaly count per mode
+func getAnomalousSubscriptions() map[string]int {
+	anomalousSubscriptionsMu.RLock()
+	defer anomalousSubscriptionsMu.RUnlock()
+
+	counts := make(map[string]int, len(anomalousSubscriptions))
+	for mode, count := range anomalousSubscriptions {
+		counts[mode] = count
+	}
+
+	return counts
+}
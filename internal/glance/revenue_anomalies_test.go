@@ -0,0 +1,106 @@
+package glance
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDetectSubscriptionAnomalies(t *testing.T) {
+	usd := func(id string, mrr float64) subscriptionMRR {
+		return subscriptionMRR{ID: id, Currency: "usd", MRR: mrr}
+	}
+
+	tests := []struct {
+		name           string
+		subscriptions  []subscriptionMRR
+		medianMultiple float64
+		expected       map[string][]string
+	}{
+		{
+			name:           "no subscriptions",
+			subscriptions:  nil,
+			medianMultiple: 10,
+			expected:       map[string][]string{},
+		},
+		{
+			name:           "consistent pricing",
+			subscriptions:  []subscriptionMRR{usd("a", 50), usd("b", 99), usd("c", 49)},
+			medianMultiple: 10,
+			expected:       map[string][]string{},
+		},
+		{
+			name:           "price typo above median multiple",
+			subscriptions:  []subscriptionMRR{usd("a", 99), usd("b", 99), usd("c", 9999)},
+			medianMultiple: 10,
+			expected:       map[string][]string{"c": {anomalyReasonOutlier}},
+		},
+		{
+			name:           "exactly at median multiple is not flagged",
+			subscriptions:  []subscriptionMRR{usd("a", 10), usd("b", 10), usd("c", 100)},
+			medianMultiple: 10,
+			expected:       map[string][]string{},
+		},
+		{
+			name: "currency differs from dominant currency",
+			subscriptions: []subscriptionMRR{
+				usd("a", 50), usd("b", 50),
+				{ID: "c", Currency: "eur", MRR: 45},
+			},
+			medianMultiple: 10,
+			expected:       map[string][]string{"c": {anomalyReasonCurrency}},
+		},
+		{
+			name: "day-based interval",
+			subscriptions: []subscriptionMRR{
+				usd("a", 50),
+				{ID: "b", Currency: "usd", MRR: 60, DailyPlan: true},
+			},
+			medianMultiple: 10,
+			expected:       map[string][]string{"b": {anomalyReasonDaily}},
+		},
+		{
+			name: "multiple reasons",
+			subscriptions: []subscriptionMRR{
+				usd("a", 10), usd("b", 10), usd("c", 10),
+				{ID: "d", Currency: "jpy", MRR: 30000, DailyPlan: true},
+			},
+			medianMultiple: 10,
+			expected:       map[string][]string{"d": {anomalyReasonOutlier, anomalyReasonCurrency, anomalyReasonDaily}},
+		},
+		{
+			name:           "lower multiple flags more",
+			subscriptions:  []subscriptionMRR{usd("a", 10), usd("b", 10), usd("c", 35)},
+			medianMultiple: 3,
+			expected:       map[string][]string{"c": {anomalyReasonOutlier}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := detectSubscriptionAnomalies(tt.subscriptions, tt.medianMultiple)
+
+			if len(anomalies) != len(tt.expected) {
+				t.Fatalf("expected %d anomalies, got %d: %+v", len(tt.expected), len(anomalies), anomalies)
+			}
+
+			for _, anomaly := range anomalies {
+				if !slices.Equal(anomaly.Reasons, tt.expected[anomaly.SubscriptionID]) {
+					t.Errorf("subscription %s: expected reasons %v, got %v", anomaly.SubscriptionID, tt.expected[anomaly.SubscriptionID], anomaly.Reasons)
+				}
+			}
+		})
+	}
+}
+
+func TestDominantCurrency_TieBreaksAlphabetically(t *testing.T) {
+	subscriptions := []subscriptionMRR{
+		{ID: "a", Currency: "usd"},
+		{ID: "b", Currency: "eur"},
+	}
+
+	for i := 0; i < 10; i++ {
+		if currency := dominantCurrency(subscriptions); currency != "eur" {
+			t.Fatalf("expected eur, got %s", currency)
+		}
+	}
+}
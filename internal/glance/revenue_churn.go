@@ -0,0 +1,74 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// startOfMonthMRR returns MRR at the start of the current month, from the last
+// snapshot of the previous month or, without one, the earliest snapshot of
+// this month. Returns false without either.
+func startOfMonthMRR(ctx context.Context, db *SimpleMetricsDB, key string, now time.Time) (float64, bool) {
+	monthly, err := db.GetRevenueMonthly(ctx, key, now, 2)
+	if err != nil {
+		slog.Error("Failed to get monthly revenue snapshots", "error", err)
+		return 0, false
+	}
+
+	if len(monthly) == 2 && monthly[0] != nil {
+		return monthly[0].MRR, true
+	}
+
+	thisMonth, err := db.GetRevenueHistory(ctx, key, bucketStart(now, MetricsBucketMonth), now, 0)
+	if err != nil {
+		slog.Error("Failed to get revenue snapshots of this month", "error", err)
+		return 0, false
+	}
+
+	if len(thisMonth) == 0 {
+		return 0, false
+	}
+
+	return thisMonth[0].MRR, true
+}
+
+// churnWindowStartMRR returns MRR at the start of a churn window: at the
+// start of the month for the calendar month, otherwise from the last snapshot
+// taken by the start of the window. Returns false without one.
+func churnWindowStartMRR(ctx context.Context, db *SimpleMetricsDB, key string, window churnWindow, now time.Time) (float64, bool) {
+	if window.days == 0 {
+		return startOfMonthMRR(ctx, db, key, now)
+	}
+
+	snapshot, err := db.GetSnapshotBefore(ctx, key, window.start(now))
+	if errors.Is(err, ErrNoSnapshot) {
+		return 0, false
+	}
+	if err != nil {
+		slog.Error("Failed to get the revenue snapshot at the start of the churn window", "error", err)
+		return 0, false
+	}
+
+	return snapshot.MRR, true
+}
+
+// grossRevenueChurnRate returns the MRR churned in the churn window as a
+// percentage of MRR at its start, returning false when there was none to churn
+func grossRevenueChurnRate(churnedMRR, startMRR float64) (float64, bool) {
+	if startMRR <= 0 {
+		return 0, false
+	}
+
+	return churnedMRR / startMRR * 100, true
+}
+
+// updateGrossRevenueChurn sets the gross revenue churn rate over the churn
+// window
+func (w *revenueWidget) updateGrossRevenueChurn(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	w.GrossRevenueChurnRate, w.GrossRevenueChurnDefined = 0, false
+	if startMRR, ok := churnWindowStartMRR(ctx, db, w.metricsKey(), w.churnWindow, now); ok {
+		w.GrossRevenueChurnRate, w.GrossRevenueChurnDefined = grossRevenueChurnRate(w.ChurnedMRR, startMRR)
+	}
+}
@@ -0,0 +1,63 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRevenueWidget_UpdateGrossRevenueChurn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		snapshots []*RevenueSnapshot
+		expected  float64
+		defined   bool
+	}{
+		{
+			name:      "new account",
+			snapshots: nil,
+		},
+		{
+			name: "end of the previous month",
+			snapshots: []*RevenueSnapshot{
+				{Timestamp: time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC), MRR: 500, Mode: "test"},
+				{Timestamp: time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC), MRR: 2000, Mode: "test"},
+				{Timestamp: time.Date(2026, time.April, 2, 0, 0, 0, 0, time.UTC), MRR: 4000, Mode: "test"},
+			},
+			expected: 5,
+			defined:  true,
+		},
+		{
+			name: "earliest of this month",
+			snapshots: []*RevenueSnapshot{
+				{Timestamp: time.Date(2026, time.April, 2, 0, 0, 0, 0, time.UTC), MRR: 1000, Mode: "test"},
+				{Timestamp: time.Date(2026, time.April, 10, 0, 0, 0, 0, time.UTC), MRR: 4000, Mode: "test"},
+			},
+			expected: 10,
+			defined:  true,
+		},
+		{
+			name:      "no MRR at the start of the month",
+			snapshots: []*RevenueSnapshot{{Timestamp: time.Date(2026, time.April, 2, 0, 0, 0, 0, time.UTC), Mode: "test"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSimpleMetricsDB()
+			for _, snapshot := range tt.snapshots {
+				db.SaveRevenueSnapshot(ctx, snapshot)
+			}
+
+			w := &revenueWidget{StripeMode: "test", ChurnedMRR: 100}
+			w.updateGrossRevenueChurn(ctx, db, now)
+
+			if w.GrossRevenueChurnDefined != tt.defined || !floatEquals(w.GrossRevenueChurnRate, tt.expected, 0.001) {
+				t.Errorf("expected %v%% (defined %v), got %v%% (defined %v)", tt.expected, tt.defined, w.GrossRevenueChurnRate, w.GrossRevenueChurnDefined)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package glance
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// prepaidMonths returns how many months a recurring price bills for at once,
+// returning false for prices billed monthly or more often
+func prepaidMonths(recurring *stripe.PriceRecurring) (float64, bool) {
+	count := recurring.IntervalCount
+	if count < 1 {
+		count = 1
+	}
+
+	months := 0.0
+	switch recurring.Interval {
+	case stripe.PriceRecurringIntervalMonth:
+		months = float64(count)
+	case stripe.PriceRecurringIntervalYear:
+		months = 12 * float64(count)
+	}
+
+	return months, months > 1
+}
+
+// periodRemaining returns the part of the current billing period of a
+// subscription that's still ahead at t, between 0 and 1
+func periodRemaining(sub *stripe.Subscription, t time.Time) float64 {
+	if sub.CurrentPeriodEnd <= sub.CurrentPeriodStart {
+		return 0
+	}
+
+	remaining := float64(sub.CurrentPeriodEnd-t.Unix()) / float64(sub.CurrentPeriodEnd-sub.CurrentPeriodStart)
+	return min(max(remaining, 0), 1)
+}
+
+// deferredRevenue estimates the revenue of a subscription that was paid for
+// upfront but not recognized yet at t, the part of the current period still
+// ahead for items billed quarterly, yearly or for any period longer than a
+// month. items is the MRR of the subscription's items, after its discounts.
+func deferredRevenue(sub *stripe.Subscription, items []itemMRR, t time.Time) currencyAmounts {
+	deferred := make(currencyAmounts)
+
+	remaining := periodRemaining(sub, t)
+	if remaining == 0 {
+		return deferred
+	}
+
+	for _, item := range items {
+		if item.Price == nil || item.Price.Recurring == nil {
+			continue
+		}
+
+		months, ok := prepaidMonths(item.Price.Recurring)
+		if !ok {
+			continue
+		}
+
+		deferred[item.Currency] += item.Amount * months * remaining
+	}
+
+	return deferred
+}
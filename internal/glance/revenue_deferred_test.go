@@ -0,0 +1,72 @@
+package glance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestDeferredRevenue(t *testing.T) {
+	now := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	subscription := func(periodStart, periodEnd time.Time, intervals ...stripe.PriceRecurring) *stripe.Subscription {
+		sub := &stripe.Subscription{
+			ID:                 "sub_1",
+			Currency:           "usd",
+			CurrentPeriodStart: periodStart.Unix(),
+			CurrentPeriodEnd:   periodEnd.Unix(),
+			Items:              &stripe.SubscriptionItemList{},
+		}
+
+		for i := range intervals {
+			sub.Items.Data = append(sub.Items.Data, &stripe.SubscriptionItem{
+				Quantity: 1,
+				Price:    &stripe.Price{ID: "price_1", Currency: "usd", UnitAmount: 120000, Recurring: &intervals[i]},
+			})
+		}
+
+		return sub
+	}
+
+	yearly := stripe.PriceRecurring{Interval: stripe.PriceRecurringIntervalYear, IntervalCount: 1}
+	quarterly := stripe.PriceRecurring{Interval: stripe.PriceRecurringIntervalMonth, IntervalCount: 3}
+	monthly := stripe.PriceRecurring{Interval: stripe.PriceRecurringIntervalMonth, IntervalCount: 1}
+
+	tests := []struct {
+		name     string
+		sub      *stripe.Subscription
+		expected float64
+	}{
+		{
+			name: "annual plan a quarter through its year",
+			sub:  subscription(now.AddDate(0, -3, 0), now.AddDate(0, 9, 0), yearly),
+			// $1,200 a year, 275 of 365 days left
+			expected: 1200 * 275.0 / 365,
+		},
+		{
+			name:     "quarterly plan paid today",
+			sub:      subscription(now, now.AddDate(0, 3, 0), quarterly),
+			expected: 1200,
+		},
+		{
+			name:     "monthly plan",
+			sub:      subscription(now.AddDate(0, 0, -10), now.AddDate(0, 0, 20), monthly),
+			expected: 0,
+		},
+		{
+			name:     "period already over",
+			sub:      subscription(now.AddDate(-1, 0, -1), now.AddDate(0, 0, -1), yearly),
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, _ := subscriptionItemsMRR(tt.sub, nil)
+			if got := deferredRevenue(tt.sub, items, now)["usd"]; !floatEquals(got, tt.expected, 0.01) {
+				t.Errorf("expected %v deferred, got %v", tt.expected, got)
+			}
+		})
+	}
+}
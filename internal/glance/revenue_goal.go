@@ -0,0 +1,71 @@
+package glance
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// averageMonth is the length of a month, a twelfth of 365.25 days, used to
+// count the months left until a goal date
+const averageMonth = 730*time.Hour + 30*time.Minute
+
+// mrrGoal is the progress of MRR toward the mrr-goal of a revenue widget
+type mrrGoal struct {
+	Target float64
+	// Percent of the target reached, above 100 once it's exceeded
+	Percent   float64
+	Reached   bool
+	Overshoot float64 // MRR above the target once reached
+
+	// Monthly compound growth needed to reach the target by the goal date,
+	// only set when there is a date, MRR to grow from and time left
+	Date              time.Time
+	MonthsLeft        float64
+	RequiredGrowth    float64 // percent
+	HasRequiredGrowth bool
+}
+
+// parseGoalDate parses and validates the goal-date of a revenue widget, which
+// must not be in the past
+func parseGoalDate(value string, now time.Time) (time.Time, error) {
+	date, err := time.ParseInLocation(time.DateOnly, value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("goal-date must be a date like 2026-12-31, got: %s", value)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if date.Before(today) {
+		return time.Time{}, fmt.Errorf("goal-date must not be in the past, got: %s", value)
+	}
+
+	return date, nil
+}
+
+// calculateMRRGoal returns the progress of current MRR toward target, with the
+// growth needed per month to reach it by date unless date is zero
+func calculateMRRGoal(current, target float64, date, now time.Time) *mrrGoal {
+	goal := &mrrGoal{Target: target, Date: date}
+	if target > 0 {
+		goal.Percent = current / target * 100
+	}
+
+	if current >= target {
+		goal.Reached = true
+		goal.Overshoot = current - target
+		return goal
+	}
+
+	if date.IsZero() {
+		return goal
+	}
+
+	// The goal is due at the end of its date
+	goal.MonthsLeft = float64(date.AddDate(0, 0, 1).Sub(now)) / float64(averageMonth)
+	if goal.MonthsLeft > 0 && current > 0 {
+		goal.RequiredGrowth = (math.Pow(target/current, 1/goal.MonthsLeft) - 1) * 100
+		goal.HasRequiredGrowth = true
+	}
+
+	return goal
+}
@@ -0,0 +1,115 @@
+package glance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculateMRRGoal(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		current           float64
+		target            float64
+		date              time.Time
+		expectedPercent   float64
+		expectedReached   bool
+		expectedOvershoot float64
+		expectedGrowth    float64
+		expectedHasGrowth bool
+	}{
+		{
+			name:            "progress without a date",
+			current:         42000,
+			target:          60000,
+			expectedPercent: 70,
+		},
+		{
+			name:              "exceeded goal shows overshoot",
+			current:           72000,
+			target:            60000,
+			date:              now.AddDate(1, 0, 0),
+			expectedPercent:   120,
+			expectedReached:   true,
+			expectedOvershoot: 12000,
+		},
+		{
+			name:              "required growth by date",
+			current:           50000,
+			target:            60500,
+			date:              now.Add(2*averageMonth).AddDate(0, 0, -1),
+			expectedPercent:   50000.0 / 60500 * 100,
+			expectedGrowth:    10, // 1.1 * 1.1 = 1.21
+			expectedHasGrowth: true,
+		},
+		{
+			name:    "no MRR to grow from",
+			current: 0,
+			target:  1000,
+			date:    now.AddDate(0, 6, 0),
+		},
+		{
+			name:            "goal date passed",
+			current:         500,
+			target:          1000,
+			date:            now.AddDate(0, 0, -2),
+			expectedPercent: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goal := calculateMRRGoal(tt.current, tt.target, tt.date, now)
+
+			if !floatEquals(goal.Percent, tt.expectedPercent, 0.001) {
+				t.Errorf("expected %v%% of the goal, got %v", tt.expectedPercent, goal.Percent)
+			}
+
+			if goal.Reached != tt.expectedReached || !floatEquals(goal.Overshoot, tt.expectedOvershoot, 0.001) {
+				t.Errorf("expected reached %v with overshoot %v, got %v with %v", tt.expectedReached, tt.expectedOvershoot, goal.Reached, goal.Overshoot)
+			}
+
+			if goal.HasRequiredGrowth != tt.expectedHasGrowth || !floatEquals(goal.RequiredGrowth, tt.expectedGrowth, 0.01) {
+				t.Errorf("expected required growth %v (%v), got %v (%v)", tt.expectedGrowth, tt.expectedHasGrowth, goal.RequiredGrowth, goal.HasRequiredGrowth)
+			}
+		})
+	}
+}
+
+func TestRevenueWidget_InitializeGoal(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+	yesterday := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+
+	tests := []struct {
+		name          string
+		goal          float64
+		date          string
+		errorContains string
+	}{
+		{name: "goal with date", goal: 60000, date: tomorrow},
+		{name: "goal due today", goal: 60000, date: time.Now().Format(time.DateOnly)},
+		{name: "negative goal", goal: -1, errorContains: "mrr-goal must not be negative"},
+		{name: "date in the past", goal: 60000, date: yesterday, errorContains: "must not be in the past"},
+		{name: "invalid date", goal: 60000, date: "31/12/2026", errorContains: "goal-date must be a date"},
+		{name: "date without goal", date: tomorrow, errorContains: "goal-date requires mrr-goal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widget := &revenueWidget{StripeAPIKey: "sk_test_valid_key", MRRGoal: tt.goal, GoalDate: tt.date}
+			err := widget.initialize()
+
+			if tt.errorContains == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !contains(err.Error(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %v", tt.errorContains, err)
+			}
+		})
+	}
+}
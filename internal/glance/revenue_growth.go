@@ -0,0 +1,127 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	growthBaselinePreviousUpdate = "previous-update"
+	growthBaselineStartOfMonth   = "start-of-month"
+	growthBaselineStartOfYear    = "start-of-year"
+)
+
+// defaultGrowthBaseline compares against the snapshot closest to
+// growthComparisonWindow ago
+var defaultGrowthBaseline = growthBaseline{kind: "30d", window: growthComparisonWindow}
+
+var growthBaselineDaysPattern = regexp.MustCompile(`^(\d+)d$`)
+
+// growthBaseline is the point the growth rate compares MRR against, set with
+// growth-baseline: the previous update, a number of days ago, or the start of
+// the month or year
+type growthBaseline struct {
+	kind string
+	// Days back for baselines like 30d, zero otherwise
+	window time.Duration
+}
+
+// parseGrowthBaseline parses a growth-baseline option, defaulting to 30d
+func parseGrowthBaseline(value string) (growthBaseline, error) {
+	if value == "" {
+		return defaultGrowthBaseline, nil
+	}
+
+	switch value {
+	case growthBaselinePreviousUpdate, growthBaselineStartOfMonth, growthBaselineStartOfYear:
+		return growthBaseline{kind: value}, nil
+	}
+
+	matches := growthBaselineDaysPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return growthBaseline{}, fmt.Errorf("growth-baseline must be previous-update, start-of-month, start-of-year or a number of days like 30d, got: %s", value)
+	}
+
+	days, err := strconv.Atoi(matches[1])
+	if err != nil || days < 1 {
+		return growthBaseline{}, fmt.Errorf("growth-baseline must be at least 1d, got: %s", value)
+	}
+
+	return growthBaseline{kind: value, window: time.Duration(days) * 24 * time.Hour}, nil
+}
+
+// target returns the time to compare against, in the time zone of now
+func (b growthBaseline) target(now time.Time) time.Time {
+	switch b.kind {
+	case growthBaselineStartOfMonth:
+		return bucketStart(now, MetricsBucketMonth)
+	case growthBaselineStartOfYear:
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+	default:
+		return now.Add(-b.window)
+	}
+}
+
+// label describes the baseline in the growth indicator
+func (b growthBaseline) label() string {
+	switch b.kind {
+	case growthBaselinePreviousUpdate:
+		return "vs last update"
+	case growthBaselineStartOfMonth:
+		return "vs start of month"
+	case growthBaselineStartOfYear:
+		return "vs start of year"
+	default:
+		return "vs " + b.kind + " ago"
+	}
+}
+
+// short reports whether a compared snapshot taken at comparedAt is much more
+// recent than the baseline, as happens until enough history exists
+func (b growthBaseline) short(comparedAt, now time.Time) bool {
+	if b.kind == growthBaselinePreviousUpdate {
+		return false
+	}
+
+	return comparedAt.After(b.target(now).Add(growthComparisonTolerance))
+}
+
+// baselineSnapshot returns the revenue snapshot the growth rate compares
+// against. The previous update is the latest snapshot taken before now, the
+// other baselines the snapshot nearest their point in time.
+func (b growthBaseline) baselineSnapshot(ctx context.Context, db *SimpleMetricsDB, key string, now time.Time) (*RevenueSnapshot, error) {
+	if b.kind == growthBaselinePreviousUpdate {
+		return db.GetSnapshotBefore(ctx, key, now.Add(-time.Nanosecond))
+	}
+
+	return db.GetRevenueNearest(ctx, key, b.target(now))
+}
+
+// updateGrowth sets the growth rate against the snapshot of the widget's
+// growth baseline
+func (w *revenueWidget) updateGrowth(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	previous, err := w.baseline().baselineSnapshot(ctx, db, w.metricsKey(), now)
+	switch {
+	case err == nil:
+		w.compareGrowthWith(previous, now)
+	case errors.Is(err, ErrNoSnapshot):
+		// First update, growth is compared once a snapshot is stored
+	default:
+		slog.Error("Failed to get previous revenue snapshot", "error", err)
+	}
+}
+
+// baseline returns the parsed growth-baseline, the default for widgets that
+// weren't initialized from a config
+func (w *revenueWidget) baseline() growthBaseline {
+	if w.growthBaseline.kind == "" {
+		return defaultGrowthBaseline
+	}
+
+	return w.growthBaseline
+}
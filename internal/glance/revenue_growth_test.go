@@ -0,0 +1,90 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseGrowthBaseline(t *testing.T) {
+	tests := []struct {
+		value   string
+		label   string
+		wantErr bool
+	}{
+		{value: "", label: "vs 30d ago"},
+		{value: "7d", label: "vs 7d ago"},
+		{value: "previous-update", label: "vs last update"},
+		{value: "start-of-month", label: "vs start of month"},
+		{value: "start-of-year", label: "vs start of year"},
+		{value: "0d", wantErr: true},
+		{value: "2w", wantErr: true},
+		{value: "last-month", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			baseline, err := parseGrowthBaseline(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err == nil && baseline.label() != tt.label {
+				t.Errorf("expected label %q, got %q", tt.label, baseline.label())
+			}
+		})
+	}
+}
+
+func TestRevenueWidget_UpdateGrowth(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.May, 20, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	for _, snapshot := range []*RevenueSnapshot{
+		{Timestamp: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), MRR: 500},
+		{Timestamp: time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC), MRR: 800},
+		{Timestamp: time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC), MRR: 900},
+		{Timestamp: now.Add(-time.Hour), MRR: 990},
+	} {
+		snapshot.Mode = "test"
+		db.SaveRevenueSnapshot(ctx, snapshot)
+	}
+
+	tests := []struct {
+		baseline   string
+		wantGrowth float64
+		wantShort  bool
+	}{
+		{baseline: "previous-update", wantGrowth: 1.0101},
+		{baseline: "30d", wantGrowth: 25},
+		{baseline: "start-of-month", wantGrowth: 11.1111},
+		{baseline: "start-of-year", wantGrowth: 100},
+		// Only four and a half months of history
+		{baseline: "365d", wantGrowth: 100, wantShort: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseline, func(t *testing.T) {
+			baseline, err := parseGrowthBaseline(tt.baseline)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			w := &revenueWidget{StripeMode: "test", CurrentMRR: 1000, growthBaseline: baseline}
+			w.updateGrowth(ctx, db, now)
+
+			if !floatEquals(w.GrowthRate, tt.wantGrowth, 0.001) {
+				t.Errorf("expected growth rate %v, got %v", tt.wantGrowth, w.GrowthRate)
+			}
+
+			if w.GrowthWindowShort != tt.wantShort {
+				t.Errorf("expected short window %v, got %v", tt.wantShort, w.GrowthWindowShort)
+			}
+
+			if w.GrowthBaselineLabel != baseline.label() {
+				t.Errorf("expected label %q, got %q", baseline.label(), w.GrowthBaselineLabel)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/subscription"
+)
+
+// movementsTolerance is the smallest unexplained change in MRR shown as a
+// movement of its own, below which it's taken as rounding
+const movementsTolerance = 0.005
+
+// newMRR is the MRR of subscriptions created this month, with the part of it
+// from customers who had canceled a subscription before
+type newMRR struct {
+	Amounts     currencyAmounts
+	Reactivated currencyAmounts
+}
+
+// mrrMovements breaks down how MRR moved from the start of the month to now.
+// New and churned MRR come from Stripe, expansion and contraction from the
+// webhook deltas of subscription updates when there are any this month and
+// otherwise from the change in MRR that new and churned MRR don't explain.
+type mrrMovements struct {
+	Start        float64
+	New          float64 // without reactivations
+	Reactivation float64
+	Expansion    float64
+	Contraction  float64
+	Churn        float64
+	// Change not explained by the other movements when expansion and
+	// contraction come from webhooks, such as from missed events or
+	// exchange rates
+	Other float64
+	End   float64
+
+	FromWebhooks bool
+
+	// Bars of the waterfall chart, from the starting MRR to the ending MRR
+	Bars []mrrMovementBar
+}
+
+// mrrMovementBar is a bar of the MRR movements waterfall. Bottom and Height
+// position it as percentages of the chart height, so that the template can
+// draw it without any math of its own.
+type mrrMovementBar struct {
+	Label  string
+	Amount float64 // MRR for totals, the signed change otherwise
+	Total  bool
+	// MRR before and after the movement
+	From   float64
+	To     float64
+	Bottom float64
+	Height float64
+}
+
+// newMRRMovements returns the movements from startMRR to endMRR given new MRR,
+// including reactivations, and churned MRR. deltas are the webhook deltas of
+// the month, nil without any.
+func newMRRMovements(startMRR, endMRR, newMRR, reactivationMRR, churnedMRR float64, deltas *MetricsDelta) *mrrMovements {
+	m := &mrrMovements{
+		Start:        startMRR,
+		New:          newMRR - reactivationMRR,
+		Reactivation: reactivationMRR,
+		Churn:        churnedMRR,
+		End:          endMRR,
+	}
+
+	unexplained := endMRR - startMRR - newMRR + churnedMRR
+	if deltas != nil && (deltas.ExpansionMRR > 0 || deltas.ContractionMRR > 0) {
+		m.FromWebhooks = true
+		m.Expansion = deltas.ExpansionMRR
+		m.Contraction = deltas.ContractionMRR
+		m.Other = unexplained - m.Expansion + m.Contraction
+		if math.Abs(m.Other) < movementsTolerance {
+			m.Other = 0
+		}
+	} else if unexplained > 0 {
+		m.Expansion = unexplained
+	} else {
+		m.Contraction = -unexplained
+	}
+
+	m.Bars = m.bars()
+	return m
+}
+
+// bars returns the waterfall bars of the movements, leaving out the ones
+// that didn't move MRR
+func (m *mrrMovements) bars() []mrrMovementBar {
+	bars := []mrrMovementBar{{Label: "Start", Amount: m.Start, Total: true, To: m.Start}}
+
+	cumulative := m.Start
+	for _, movement := range []struct {
+		label  string
+		change float64
+	}{
+		{"New", m.New},
+		{"Expansion", m.Expansion},
+		{"Reactivation", m.Reactivation},
+		{"Contraction", -m.Contraction},
+		{"Churn", -m.Churn},
+		{"Other", m.Other},
+	} {
+		if movement.change == 0 {
+			continue
+		}
+
+		bars = append(bars, mrrMovementBar{
+			Label:  movement.label,
+			Amount: movement.change,
+			From:   cumulative,
+			To:     cumulative + movement.change,
+		})
+		cumulative += movement.change
+	}
+
+	bars = append(bars, mrrMovementBar{Label: "End", Amount: m.End, Total: true, To: m.End})
+
+	top := 0.0
+	for _, bar := range bars {
+		top = max(top, bar.From, bar.To)
+	}
+
+	if top <= 0 {
+		return bars
+	}
+
+	for i := range bars {
+		low := max(min(bars[i].From, bars[i].To), 0)
+		high := max(bars[i].From, bars[i].To, 0)
+		bars[i].Bottom = roundPercent(low / top * 100)
+		bars[i].Height = roundPercent((high - low) / top * 100)
+	}
+
+	return bars
+}
+
+func roundPercent(percent float64) float64 {
+	return math.Round(percent*100) / 100
+}
+
+// updateMovements sets the MRR movements of this month, left nil without the
+// MRR at the start of the month
+func (w *revenueWidget) updateMovements(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	w.Movements = nil
+	startMRR, ok := startOfMonthMRR(ctx, db, w.metricsKey(), now)
+	if !ok {
+		return
+	}
+
+	deltas, err := db.SumDeltas(ctx, w.StripeMode, bucketStart(now, MetricsBucketMonth), now)
+	if err != nil {
+		slog.Error("Failed to sum revenue deltas", "error", err)
+		deltas = nil
+	}
+
+	w.Movements = newMRRMovements(startMRR, w.CurrentMRR, w.NewMRR, w.ReactivationMRR, w.monthChurnedMRR, deltas)
+}
+
+// canceledSubscriptionLister lists the canceled subscriptions of a customer
+type canceledSubscriptionLister interface {
+	listCanceledSubscriptions(ctx context.Context, customerID string) ([]*stripe.Subscription, error)
+}
+
+// stripeCanceledSubscriptionLister lists canceled subscriptions from Stripe
+type stripeCanceledSubscriptionLister struct{}
+
+func (stripeCanceledSubscriptionLister) listCanceledSubscriptions(ctx context.Context, customerID string) ([]*stripe.Subscription, error) {
+	params := &stripe.SubscriptionListParams{}
+	params.Customer = stripe.String(customerID)
+	params.Status = stripe.String(string(stripe.SubscriptionStatusCanceled))
+	params.Limit = stripe.Int64(stripeListPageSize)
+	params.Context = ctx
+
+	var subs []*stripe.Subscription
+	iter := subscription.List(params)
+	for iter.Next() {
+		subs = append(subs, iter.Subscription())
+	}
+
+	return subs, iter.Err()
+}
+
+// reactivationChecker tells whether new subscriptions are reactivations,
+// looking up the canceled subscriptions of each customer once. A checker is
+// kept with each subscription scan, so that the widgets sharing the scan
+// don't look up the same customers again.
+type reactivationChecker struct {
+	lister canceledSubscriptionLister
+
+	mu sync.Mutex
+	// Time each customer's earliest canceled subscription ended, zero for
+	// customers without one
+	endedAt map[string]int64
+}
+
+func newReactivationChecker(lister canceledSubscriptionLister) *reactivationChecker {
+	return &reactivationChecker{lister: lister, endedAt: make(map[string]int64)}
+}
+
+// isReactivation reports whether the customer of sub had a subscription that
+// was canceled before sub was created
+func (r *reactivationChecker) isReactivation(ctx context.Context, sub *stripe.Subscription) (bool, error) {
+	if sub.Customer == nil || sub.Customer.ID == "" {
+		return false, nil
+	}
+
+	// Held while listing, so that widgets updating at once list a customer once
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	endedAt, ok := r.endedAt[sub.Customer.ID]
+	if !ok {
+		canceled, err := r.lister.listCanceledSubscriptions(ctx, sub.Customer.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to list canceled subscriptions of customer %s: %w", sub.Customer.ID, err)
+		}
+
+		for _, canceledSub := range canceled {
+			if ended := subscriptionEndedAt(canceledSub); ended > 0 && (endedAt == 0 || ended < endedAt) {
+				endedAt = ended
+			}
+		}
+
+		r.endedAt[sub.Customer.ID] = endedAt
+	}
+
+	return endedAt > 0 && endedAt <= sub.Created, nil
+}
+
+// subscriptionEndedAt returns when a canceled subscription ended, or when it
+// was canceled for subscriptions without an end time
+func subscriptionEndedAt(sub *stripe.Subscription) int64 {
+	if sub.EndedAt > 0 {
+		return sub.EndedAt
+	}
+
+	return sub.CanceledAt
+}
@@ -0,0 +1,166 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestNewMRRMovements(t *testing.T) {
+	tests := []struct {
+		name        string
+		deltas      *MetricsDelta
+		end         float64
+		expansion   float64
+		contraction float64
+		other       float64
+		webhooks    bool
+	}{
+		{name: "inferred expansion", end: 1350, expansion: 100},
+		{name: "inferred contraction", end: 1200, contraction: 50},
+		{name: "no deltas of subscription updates", deltas: &MetricsDelta{NewMRR: 300}, end: 1350, expansion: 100},
+		{
+			name:        "expansion and contraction from webhooks",
+			deltas:      &MetricsDelta{ExpansionMRR: 120, ContractionMRR: 20},
+			end:         1350,
+			expansion:   120,
+			contraction: 20,
+			webhooks:    true,
+		},
+		{
+			name:      "missed webhooks",
+			deltas:    &MetricsDelta{ExpansionMRR: 60},
+			end:       1350,
+			expansion: 60,
+			other:     40,
+			webhooks:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 1000 at the start, 300 new of which 50 reactivated, 50 churned
+			m := newMRRMovements(1000, tt.end, 300, 50, 50, tt.deltas)
+
+			if m.New != 250 || m.Reactivation != 50 || m.Churn != 50 || m.FromWebhooks != tt.webhooks {
+				t.Fatalf("unexpected movements: %+v", m)
+			}
+			if !floatEquals(m.Expansion, tt.expansion, 0.001) || !floatEquals(m.Contraction, tt.contraction, 0.001) || !floatEquals(m.Other, tt.other, 0.001) {
+				t.Errorf("expected expansion %v, contraction %v and other %v, got %v, %v and %v", tt.expansion, tt.contraction, tt.other, m.Expansion, m.Contraction, m.Other)
+			}
+
+			last := m.Bars[len(m.Bars)-2]
+			if !floatEquals(last.To, tt.end, 0.001) {
+				t.Errorf("expected the movements to add up to %v, got %v", tt.end, last.To)
+			}
+		})
+	}
+}
+
+func TestMRRMovements_BarPositions(t *testing.T) {
+	m := newMRRMovements(1000, 900, 200, 0, 400, nil)
+
+	// Positions are relative to the highest point, 1300 after expansion
+	expected := []mrrMovementBar{
+		{Label: "Start", Amount: 1000, Total: true, To: 1000, Bottom: 0, Height: 76.92},
+		{Label: "New", Amount: 200, From: 1000, To: 1200, Bottom: 76.92, Height: 15.38},
+		{Label: "Expansion", Amount: 100, From: 1200, To: 1300, Bottom: 92.31, Height: 7.69},
+		{Label: "Churn", Amount: -400, From: 1300, To: 900, Bottom: 69.23, Height: 30.77},
+		{Label: "End", Amount: 900, Total: true, To: 900, Bottom: 0, Height: 69.23},
+	}
+
+	if len(m.Bars) != len(expected) {
+		t.Fatalf("expected %d bars, got %+v", len(expected), m.Bars)
+	}
+
+	for i, bar := range m.Bars {
+		if bar != expected[i] {
+			t.Errorf("bar %d: expected %+v, got %+v", i, expected[i], bar)
+		}
+	}
+}
+
+func TestRevenueWidget_UpdateMovements(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	w := &revenueWidget{StripeMode: "test", CurrentMRR: 1100, NewMRR: 200, ChurnedMRR: 50, monthChurnedMRR: 50}
+
+	w.updateMovements(ctx, db, now)
+	if w.Movements != nil {
+		t.Fatalf("expected no movements without a snapshot, got %+v", w.Movements)
+	}
+
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC), MRR: 1000, Mode: "test"})
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: time.Date(2026, time.April, 5, 0, 0, 0, 0, time.UTC), ContractionMRR: 30, Mode: "test"})
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: time.Date(2026, time.March, 5, 0, 0, 0, 0, time.UTC), ExpansionMRR: 500, Mode: "test"})
+
+	w.updateMovements(ctx, db, now)
+	if w.Movements == nil || !w.Movements.FromWebhooks || w.Movements.Contraction != 30 || w.Movements.Expansion != 0 || !floatEquals(w.Movements.Other, -20, 0.001) {
+		t.Errorf("expected this month's contraction from webhooks, got %+v", w.Movements)
+	}
+}
+
+func TestSubscriptionEndedAt(t *testing.T) {
+	if got := subscriptionEndedAt(&stripe.Subscription{CanceledAt: 100, EndedAt: 200}); got != 200 {
+		t.Errorf("expected the end time, got %d", got)
+	}
+
+	if got := subscriptionEndedAt(&stripe.Subscription{CanceledAt: 100}); got != 100 {
+		t.Errorf("expected the cancellation time, got %d", got)
+	}
+}
+
+// fakeCanceledSubscriptionLister returns the canceled subscriptions of each
+// customer instead of listing them from Stripe, and counts the lookups
+type fakeCanceledSubscriptionLister struct {
+	canceled map[string][]*stripe.Subscription
+	err      error
+	lookups  atomic.Int32
+}
+
+func (l *fakeCanceledSubscriptionLister) listCanceledSubscriptions(ctx context.Context, customerID string) ([]*stripe.Subscription, error) {
+	l.lookups.Add(1)
+	return l.canceled[customerID], l.err
+}
+
+func TestSubscriptionScan_LooksUpReactivationsOnce(t *testing.T) {
+	ctx := context.Background()
+	startOfMonth := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	lister := &fakeCanceledSubscriptionLister{canceled: map[string][]*stripe.Subscription{
+		"cus_back": {{EndedAt: startOfMonth.AddDate(0, -2, 0).Unix()}},
+	}}
+	scan := &subscriptionScan{StartOfMonth: startOfMonth, reactivationCheck: newReactivationChecker(lister)}
+
+	sub := &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_back"}, Created: startOfMonth.AddDate(0, 0, 3).Unix()}
+	other := &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_new"}, Created: startOfMonth.AddDate(0, 0, 3).Unix()}
+
+	// As by the revenue and the customers widgets sharing the scan
+	for range 2 {
+		if reactivated, err := scan.reactivations().isReactivation(ctx, sub); err != nil || !reactivated {
+			t.Errorf("expected a reactivation, got %v (%v)", reactivated, err)
+		}
+		if reactivated, err := scan.reactivations().isReactivation(ctx, other); err != nil || reactivated {
+			t.Errorf("expected no reactivation, got %v (%v)", reactivated, err)
+		}
+	}
+
+	if lookups := lister.lookups.Load(); lookups != 2 {
+		t.Errorf("expected each customer to be looked up once per scan, got %d lookups", lookups)
+	}
+
+	// Failed lookups aren't remembered, to be retried
+	failing := &subscriptionScan{reactivationCheck: newReactivationChecker(&fakeCanceledSubscriptionLister{err: errors.New("unavailable")})}
+	if _, err := failing.reactivations().isReactivation(ctx, sub); err == nil {
+		t.Error("expected the error of the lookup")
+	}
+	if _, cached := failing.reactivations().endedAt["cus_back"]; cached {
+		t.Error("expected a failed lookup not to be cached")
+	}
+}
@@ -0,0 +1,122 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Window of net revenue retention in months, set with nrr-months
+const (
+	defaultNRRMonths = 12
+	maxNRRMonths     = 24
+)
+
+// nrrStartTolerance is how far the snapshot NRR starts from may be from the
+// start of the window
+const nrrStartTolerance = 15 * 24 * time.Hour
+
+// validateNRRMonths defaults an unset nrr-months and checks its range
+func validateNRRMonths(months *int) error {
+	if *months == 0 {
+		*months = defaultNRRMonths
+	}
+
+	if *months < 1 || *months > maxNRRMonths {
+		return fmt.Errorf("nrr-months must be between 1 and %d, got: %d", maxNRRMonths, *months)
+	}
+
+	return nil
+}
+
+// netRevenueRetention returns (starting MRR + expansion - contraction -
+// churn) / starting MRR as a percentage. As MRR now is the starting MRR plus
+// all of those and the new MRR since, it's calculated as the current MRR
+// less the new MRR added since start. monthly holds the last snapshot of each
+// month from the month of start through the current month, as returned by
+// GetRevenueMonthly, and new MRR of the current month is currentNewMRR.
+// Returns false when the starting MRR is 0 or a month has no snapshot to
+// count its new MRR from.
+func netRevenueRetention(start *RevenueSnapshot, monthly []*RevenueSnapshot, currentMRR, currentNewMRR float64) (float64, bool) {
+	if start.MRR <= 0 || len(monthly) < 2 {
+		return 0, false
+	}
+
+	// New MRR of the month of start is counted from start on
+	added := currentNewMRR - start.NewMRR
+	for _, snapshot := range monthly[:len(monthly)-1] {
+		if snapshot == nil {
+			return 0, false
+		}
+
+		added += snapshot.NewMRR
+	}
+
+	return (currentMRR - added) / start.MRR * 100, true
+}
+
+// nrrHealth rates net revenue retention by the usual SaaS benchmarks, above
+// 120% is best in class and below 100% the existing customers shrink
+func nrrHealth(nrr float64) string {
+	switch {
+	case nrr >= 120:
+		return "great"
+	case nrr >= 100:
+		return "okay"
+	}
+
+	return "bad"
+}
+
+// updateNRR sets net revenue retention over the last nrr-months from the
+// snapshot nearest to the start of the window, leaving it undefined when
+// there's no snapshot that old yet
+func (w *revenueWidget) updateNRR(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	w.setNRR(nil)
+
+	target := now.AddDate(0, -w.NRRMonths, 0)
+	start, err := db.GetRevenueNearest(ctx, w.metricsKey(), target)
+	if err != nil {
+		if !errors.Is(err, ErrNoSnapshot) {
+			slog.Error("Failed to get revenue snapshot for NRR", "error", err)
+		}
+		return
+	}
+
+	if start.Timestamp.Sub(target).Abs() > nrrStartTolerance {
+		return
+	}
+
+	startMonth, currentMonth := start.Timestamp.UTC(), now.UTC()
+	months := (currentMonth.Year()-startMonth.Year())*12 + int(currentMonth.Month()-startMonth.Month()) + 1
+	monthly, err := db.GetRevenueMonthly(ctx, w.metricsKey(), now, months)
+	if err != nil {
+		slog.Error("Failed to get monthly revenue snapshots for NRR", "error", err)
+		return
+	}
+
+	if nrr, ok := netRevenueRetention(start, monthly, w.CurrentMRR, w.NewMRR); ok {
+		w.setNRR(&nrr)
+	}
+}
+
+// setNRR sets net revenue retention, nil meaning there isn't enough history
+func (w *revenueWidget) setNRR(nrr *float64) {
+	w.NRR, w.NRRDefined, w.NRRHealth = 0, nrr != nil, ""
+	if nrr != nil {
+		w.NRR = *nrr
+		w.NRRHealth = nrrHealth(w.NRR)
+	}
+}
+
+// nrrValue returns net revenue retention to store, nil when it's undefined
+func (w *revenueWidget) nrrValue() *float64 {
+	if !w.NRRDefined {
+		return nil
+	}
+
+	nrr := w.NRR
+	return &nrr
+}
@@ -0,0 +1,88 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNetRevenueRetention(t *testing.T) {
+	start := &RevenueSnapshot{MRR: 1000, NewMRR: 50}
+
+	tests := []struct {
+		name       string
+		start      *RevenueSnapshot
+		monthly    []*RevenueSnapshot
+		currentMRR float64
+		currentNew float64
+		expected   float64
+		ok         bool
+	}{
+		{
+			name:       "expansion outgrows churn",
+			start:      start,
+			monthly:    []*RevenueSnapshot{{NewMRR: 150}, {NewMRR: 200}, nil},
+			currentMRR: 1500,
+			currentNew: 100,
+			// 1500 - (150 - 50 + 200 + 100) = 1100
+			expected: 110,
+			ok:       true,
+		},
+		{
+			name:       "churn without new customers",
+			start:      start,
+			monthly:    []*RevenueSnapshot{{NewMRR: 50}, {NewMRR: 0}, nil},
+			currentMRR: 900,
+			expected:   90,
+			ok:         true,
+		},
+		{
+			name:       "month without a snapshot",
+			start:      start,
+			monthly:    []*RevenueSnapshot{{NewMRR: 50}, nil, nil},
+			currentMRR: 900,
+		},
+		{
+			name:       "no starting MRR",
+			start:      &RevenueSnapshot{},
+			monthly:    []*RevenueSnapshot{{}, {}, nil},
+			currentMRR: 900,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrr, ok := netRevenueRetention(tt.start, tt.monthly, tt.currentMRR, tt.currentNew)
+			if ok != tt.ok || !floatEquals(nrr, tt.expected, 0.001) {
+				t.Errorf("expected %v (%v), got %v (%v)", tt.expected, tt.ok, nrr, ok)
+			}
+		})
+	}
+}
+
+func TestRevenueWidget_UpdateNRR(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.April, 20, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	w := &revenueWidget{StripeMode: "test", NRRMonths: 2, CurrentMRR: 1200, NewMRR: 100}
+
+	w.updateNRR(ctx, db, now)
+	if w.NRRDefined {
+		t.Errorf("expected NRR to be undefined without history, got %v", w.NRR)
+	}
+
+	for _, snapshot := range []*RevenueSnapshot{
+		{Timestamp: now.AddDate(0, -2, 2), MRR: 1000, NewMRR: 20, Mode: "test"},
+		{Timestamp: time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC), MRR: 1050, NewMRR: 70, Mode: "test"},
+		{Timestamp: time.Date(2026, time.March, 30, 0, 0, 0, 0, time.UTC), MRR: 1100, NewMRR: 50, Mode: "test"},
+	} {
+		db.SaveRevenueSnapshot(ctx, snapshot)
+	}
+
+	w.updateNRR(ctx, db, now)
+	// 1200 - (70 - 20 + 50 + 100) = 1000
+	if !w.NRRDefined || !floatEquals(w.NRR, 100, 0.001) || w.NRRHealth != "okay" {
+		t.Errorf("expected NRR of 100%% rated okay, got %v (%v, %q)", w.NRR, w.NRRDefined, w.NRRHealth)
+	}
+}
@@ -0,0 +1,57 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// isOneTimeInvoice reports whether an invoice doesn't belong to a
+// subscription, such as a setup fee or a one-off add-on
+func isOneTimeInvoice(inv *stripe.Invoice) bool {
+	return inv.Subscription == nil || inv.Subscription.ID == ""
+}
+
+// oneTimeRevenue sums what paid one-time invoices collected per currency
+func oneTimeRevenue(invoices []*stripe.Invoice) currencyAmounts {
+	amounts := make(currencyAmounts)
+	for _, inv := range invoices {
+		if !isOneTimeInvoice(inv) {
+			continue
+		}
+
+		currency := normalizeCurrency(string(inv.Currency))
+		amounts[currency] += currencyUnitAmount(float64(inv.AmountPaid), currency)
+	}
+
+	return amounts
+}
+
+// updateOneTimeRevenue sets the one-time revenue of this month. listed is what
+// the paid invoices listed from Stripe add up to, nil when they couldn't be
+// listed. The one-time payments webhooks reported since the last listing are
+// added to it, so that the total stays fresh without listing the invoices.
+func (w *revenueWidget) updateOneTimeRevenue(ctx context.Context, db *SimpleMetricsDB, listed *float64, now time.Time) {
+	startOfMonth := bucketStart(now, MetricsBucketMonth)
+	if listed != nil {
+		w.oneTimeListed, w.oneTimeListedAt = *listed, now
+	} else if w.oneTimeListedAt.Before(startOfMonth) {
+		// Nothing listed this month, every payment comes from the webhooks
+		w.oneTimeListed, w.oneTimeListedAt = 0, startOfMonth
+	}
+
+	w.OneTimeRevenue = w.oneTimeListed
+	if db == nil {
+		return
+	}
+
+	deltas, err := db.SumDeltas(ctx, w.StripeMode, w.oneTimeListedAt, now)
+	if err != nil {
+		slog.Error("Failed to sum one-time revenue deltas", "error", err)
+		return
+	}
+
+	w.OneTimeRevenue += deltas.OneTimeRevenue
+}
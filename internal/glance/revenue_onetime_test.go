@@ -0,0 +1,93 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestOneTimeRevenue(t *testing.T) {
+	invoices := []*stripe.Invoice{
+		{ID: "in_1", Currency: "usd", AmountPaid: 4900, Subscription: &stripe.Subscription{ID: "sub_1"}},
+		{ID: "in_2", Currency: "usd", AmountPaid: 15000},
+		{ID: "in_3", Currency: "EUR", AmountPaid: 2500},
+		{ID: "in_4", Currency: "jpy", AmountPaid: 3000, Subscription: &stripe.Subscription{ID: "sub_2"}},
+	}
+
+	amounts := oneTimeRevenue(invoices)
+
+	expected := map[string]float64{"usd": 150, "eur": 25}
+	if len(amounts) != len(expected) {
+		t.Fatalf("expected %d currencies, got %v", len(expected), amounts)
+	}
+
+	for currency, amount := range expected {
+		if !floatEquals(amounts[currency], amount, 0.001) {
+			t.Errorf("expected %v %s of one-time revenue, got %v", amount, currency, amounts[currency])
+		}
+	}
+}
+
+func TestRevenueWidget_UpdateOneTimeRevenue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.June, 10, 12, 0, 0, 0, time.UTC)
+
+	db := newSimpleMetricsDB()
+	w := &revenueWidget{StripeMode: "test"}
+
+	listed := 200.0
+	w.updateOneTimeRevenue(ctx, db, &listed, now)
+	if w.OneTimeRevenue != 200 {
+		t.Fatalf("expected the listed 200, got %v", w.OneTimeRevenue)
+	}
+
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: now.Add(-time.Hour), OneTimeRevenue: 75, Mode: "test"})
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: now.Add(time.Hour), OneTimeRevenue: 50, Mode: "test"})
+
+	// Payments before the listing are already part of it
+	w.updateOneTimeRevenue(ctx, db, nil, now.Add(2*time.Hour))
+	if w.OneTimeRevenue != 250 {
+		t.Errorf("expected the listed 200 and 50 from webhooks, got %v", w.OneTimeRevenue)
+	}
+
+	// Nothing listed in a new month, only its webhooks count
+	db.SaveDelta(ctx, &MetricsDelta{Timestamp: time.Date(2026, time.July, 1, 8, 0, 0, 0, time.UTC), OneTimeRevenue: 30, Mode: "test"})
+	w.updateOneTimeRevenue(ctx, db, nil, time.Date(2026, time.July, 2, 0, 0, 0, 0, time.UTC))
+	if w.OneTimeRevenue != 30 {
+		t.Errorf("expected 30 from this month's webhooks, got %v", w.OneTimeRevenue)
+	}
+}
+
+func TestHandleInvoicePaymentSucceeded_RecordsOneTimePayments(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	GetCurrencyConverter().Configure("usd", map[string]float64{"eur": 1.5}, nil)
+	defer GetCurrencyConverter().Configure("usd", nil, nil)
+
+	for _, data := range []string{
+		`{"object": {"id": "in_1", "currency": "usd", "amount_paid": 4900, "customer": {"id": "cus_1"}, "subscription": {"id": "sub_1"}}}`,
+		`{"object": {"id": "in_2", "currency": "usd", "amount_paid": 15000, "customer": {"id": "cus_2"}, "subscription": null}}`,
+		`{"object": {"id": "in_3", "currency": "eur", "amount_paid": 2000, "customer": {"id": "cus_3"}}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleInvoicePaymentSucceeded(ctx, stripe.Event{Type: "invoice.payment_succeeded", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if !floatEquals(sum.OneTimeRevenue, 180, 0.001) {
+		t.Errorf("expected 180 of one-time payments, got %v", sum.OneTimeRevenue)
+	}
+}
@@ -0,0 +1,53 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// How far the nearest snapshot may be from a month and a year ago for
+	// month-over-month and year-over-year comparisons
+	monthOverMonthTolerance = 3 * 24 * time.Hour
+	yearOverYearTolerance   = 15 * 24 * time.Hour
+)
+
+// periodComparison is the change in MRR against the snapshot nearest to a
+// fixed period ago
+type periodComparison struct {
+	Growth     float64 // percent
+	ComparedAt time.Time
+}
+
+// comparePeriod compares MRR with the snapshot nearest to target. Returns nil
+// when no snapshot is within tolerance of target, so that a short history
+// isn't compared against whichever snapshot happens to be oldest, or when the
+// snapshot has no MRR.
+func comparePeriod(ctx context.Context, db *SimpleMetricsDB, key string, current float64, target time.Time, tolerance time.Duration) *periodComparison {
+	snapshot, err := db.GetRevenueNearest(ctx, key, target)
+	if err != nil {
+		if !errors.Is(err, ErrNoSnapshot) {
+			slog.Error("Failed to get revenue snapshot for comparison", "error", err)
+		}
+		return nil
+	}
+
+	if distance := snapshot.Timestamp.Sub(target).Abs(); distance > tolerance {
+		return nil
+	}
+
+	growth, ok := growthPercent(snapshot.MRR, current)
+	if !ok {
+		return nil
+	}
+
+	return &periodComparison{Growth: growth, ComparedAt: snapshot.Timestamp}
+}
+
+// comparePeriods sets the month-over-month and year-over-year MRR growth
+func (w *revenueWidget) comparePeriods(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	w.MoM = comparePeriod(ctx, db, w.metricsKey(), w.CurrentMRR, now.AddDate(0, -1, 0), monthOverMonthTolerance)
+	w.YoY = comparePeriod(ctx, db, w.metricsKey(), w.CurrentMRR, now.AddDate(-1, 0, 0), yearOverYearTolerance)
+}
@@ -0,0 +1,75 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRevenueWidget_ComparePeriods(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.April, 3, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		snapshots []*RevenueSnapshot
+		mom       *periodComparison
+		yoy       *periodComparison
+	}{
+		{
+			name: "month of history has no year-over-year",
+			snapshots: []*RevenueSnapshot{
+				{Timestamp: now.AddDate(0, -1, 1), MRR: 800, Mode: "test"},
+				{Timestamp: now.AddDate(0, 0, -10), MRR: 900, Mode: "test"},
+			},
+			mom: &periodComparison{Growth: 25, ComparedAt: now.AddDate(0, -1, 1)},
+		},
+		{
+			name: "year of history",
+			snapshots: []*RevenueSnapshot{
+				{Timestamp: now.AddDate(-1, 0, -5), MRR: 500, Mode: "test"},
+				{Timestamp: now.AddDate(0, -1, 0), MRR: 1000, Mode: "test"},
+			},
+			mom: &periodComparison{Growth: 0, ComparedAt: now.AddDate(0, -1, 0)},
+			yoy: &periodComparison{Growth: 100, ComparedAt: now.AddDate(-1, 0, -5)},
+		},
+		{
+			name: "snapshots too far from the periods",
+			snapshots: []*RevenueSnapshot{
+				{Timestamp: now.AddDate(0, -2, 0), MRR: 800, Mode: "test"},
+				{Timestamp: now.AddDate(0, 0, -7), MRR: 900, Mode: "test"},
+			},
+		},
+		{
+			name:      "other modes are ignored",
+			snapshots: []*RevenueSnapshot{{Timestamp: now.AddDate(0, -1, 0), MRR: 800, Mode: "live"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSimpleMetricsDB()
+			for _, snapshot := range tt.snapshots {
+				db.SaveRevenueSnapshot(ctx, snapshot)
+			}
+
+			w := &revenueWidget{StripeMode: "test", CurrentMRR: 1000}
+			w.comparePeriods(ctx, db, now)
+
+			for _, c := range []struct {
+				period   string
+				got      *periodComparison
+				expected *periodComparison
+			}{{"MoM", w.MoM, tt.mom}, {"YoY", w.YoY, tt.yoy}} {
+				switch {
+				case c.expected == nil && c.got != nil:
+					t.Errorf("expected no %s comparison, got %+v", c.period, c.got)
+				case c.expected != nil && c.got == nil:
+					t.Errorf("expected %s comparison %+v, got none", c.period, c.expected)
+				case c.expected != nil && (!floatEquals(c.got.Growth, c.expected.Growth, 0.01) || !c.got.ComparedAt.Equal(c.expected.ComparedAt)):
+					t.Errorf("expected %s comparison %+v, got %+v", c.period, c.expected, c.got)
+				}
+			}
+		})
+	}
+}
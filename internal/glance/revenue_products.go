@@ -0,0 +1,176 @@
+package glance
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/product"
+)
+
+const defaultTopProducts = 5
+
+// productMRR is the MRR of a product in the reporting currency, with the MRR
+// of each of its prices
+type productMRR struct {
+	ID         string
+	Name       string
+	MRR        float64
+	Percentage float64 // of the MRR of all products
+	Prices     []priceMRR
+	// Other groups the products outside of the top products
+	Other bool
+}
+
+type priceMRR struct {
+	ID       string
+	Nickname string
+	MRR      float64
+}
+
+// priceAmounts is the MRR of a single price per currency
+type priceAmounts struct {
+	Nickname string
+	Amounts  currencyAmounts
+}
+
+// productAmounts groups the MRR of subscription items by product and price
+type productAmounts struct {
+	prices map[string]map[string]*priceAmounts
+	// Names of products that were expanded on the price
+	names map[string]string
+}
+
+func newProductAmounts() *productAmounts {
+	return &productAmounts{
+		prices: make(map[string]map[string]*priceAmounts),
+		names:  make(map[string]string),
+	}
+}
+
+func (p *productAmounts) add(item itemMRR) {
+	productID := ""
+	if item.Price.Product != nil {
+		productID = item.Price.Product.ID
+		if item.Price.Product.Name != "" {
+			p.names[productID] = item.Price.Product.Name
+		}
+	}
+
+	prices, ok := p.prices[productID]
+	if !ok {
+		prices = make(map[string]*priceAmounts)
+		p.prices[productID] = prices
+	}
+
+	price, ok := prices[item.Price.ID]
+	if !ok {
+		price = &priceAmounts{Nickname: item.Price.Nickname, Amounts: make(currencyAmounts)}
+		prices[item.Price.ID] = price
+	}
+
+	price.Amounts[item.Currency] += item.Amount
+}
+
+// productBreakdown converts the MRR of each product to the reporting currency
+// and returns the largest limit products, largest first, followed by the rest
+// of the products grouped together. Amounts without an exchange rate are left
+// out as they are from the totals.
+func productBreakdown(ctx context.Context, amounts *productAmounts, converter *CurrencyConverter, limit int) []productMRR {
+	products := make([]productMRR, 0, len(amounts.prices))
+	total := 0.0
+
+	for productID, prices := range amounts.prices {
+		breakdown := productMRR{ID: productID, Name: amounts.names[productID]}
+		for priceID, price := range prices {
+			mrr := converter.Convert(ctx, price.Amounts).Total
+			breakdown.MRR += mrr
+			breakdown.Prices = append(breakdown.Prices, priceMRR{ID: priceID, Nickname: price.Nickname, MRR: mrr})
+		}
+
+		slices.SortFunc(breakdown.Prices, func(a, b priceMRR) int {
+			return cmp.Or(cmp.Compare(b.MRR, a.MRR), strings.Compare(a.ID, b.ID))
+		})
+
+		total += breakdown.MRR
+		products = append(products, breakdown)
+	}
+
+	slices.SortFunc(products, func(a, b productMRR) int {
+		return cmp.Or(cmp.Compare(b.MRR, a.MRR), strings.Compare(a.ID, b.ID))
+	})
+
+	if len(products) > limit {
+		other := productMRR{Name: "Other", Other: true}
+		for _, rest := range products[limit:] {
+			other.MRR += rest.MRR
+		}
+		products = append(products[:limit], other)
+	}
+
+	if total > 0 {
+		for i := range products {
+			products[i].Percentage = products[i].MRR / total * 100
+		}
+	}
+
+	return products
+}
+
+// productNameCache keeps the names of products for the lifetime of a widget,
+// so that each is retrieved from Stripe once
+type productNameCache map[string]string
+
+// lookup returns the name of a product, retrieving it the first time. Products
+// that can't be retrieved are shown by ID and looked up again next time.
+func (c productNameCache) lookup(ctx context.Context, client *StripeClientWrapper, productID string) string {
+	if name, ok := c[productID]; ok {
+		return name
+	}
+
+	var retrieved *stripe.Product
+	err := client.ExecuteWithRetry(ctx, "getProduct", func() error {
+		params := &stripe.ProductParams{}
+		params.Context = ctx
+
+		var err error
+		retrieved, err = product.Get(productID, params)
+		return err
+	})
+
+	if err != nil || retrieved.Name == "" {
+		slog.Warn("Failed to retrieve product name", "product_id", productID, "error", err)
+		return productID
+	}
+
+	c[productID] = retrieved.Name
+	return retrieved.Name
+}
+
+// resolveProductNames sets the names of products that weren't expanded
+func (w *revenueWidget) resolveProductNames(ctx context.Context, client *StripeClientWrapper, products []productMRR) {
+	if w.productNames == nil {
+		w.productNames = make(productNameCache)
+	}
+
+	for i := range products {
+		p := &products[i]
+		switch {
+		case p.Other:
+			continue
+		case p.ID == "":
+			p.Name = "No product"
+			continue
+		}
+
+		if p.Name != "" {
+			w.productNames[p.ID] = p.Name
+			continue
+		}
+
+		p.Name = w.productNames.lookup(ctx, client, p.ID)
+	}
+}
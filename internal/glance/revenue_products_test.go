@@ -0,0 +1,83 @@
+package glance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestProductBreakdown(t *testing.T) {
+	price := func(id, productID, productName string) *stripe.Price {
+		return &stripe.Price{ID: id, Product: &stripe.Product{ID: productID, Name: productName}}
+	}
+
+	amounts := newProductAmounts()
+	for _, item := range []itemMRR{
+		{Price: price("price_pro_monthly", "prod_pro", "Pro"), Currency: "usd", Amount: 300},
+		{Price: price("price_pro_yearly", "prod_pro", ""), Currency: "usd", Amount: 100},
+		{Price: price("price_pro_eur", "prod_pro", ""), Currency: "eur", Amount: 100},
+		{Price: price("price_team", "prod_team", ""), Currency: "usd", Amount: 300},
+		{Price: price("price_addon", "prod_addon", ""), Currency: "usd", Amount: 50},
+		{Price: price("price_support", "prod_support", ""), Currency: "usd", Amount: 40},
+		{Price: price("price_chf", "prod_chf", ""), Currency: "chf", Amount: 1000},
+	} {
+		amounts.add(item)
+	}
+
+	converter := newCurrencyConverter("usd", map[string]float64{"eur": 1.1}, nil)
+	products := productBreakdown(context.Background(), amounts, converter, 2)
+
+	if len(products) != 3 {
+		t.Fatalf("expected 2 products and other, got %+v", products)
+	}
+
+	pro, team, other := products[0], products[1], products[2]
+	if pro.ID != "prod_pro" || pro.Name != "Pro" || !floatEquals(pro.MRR, 510, 0.001) {
+		t.Errorf("expected Pro with 510 MRR first, got %+v", pro)
+	}
+
+	if len(pro.Prices) != 3 || pro.Prices[0].ID != "price_pro_monthly" || !floatEquals(pro.Prices[1].MRR, 110, 0.001) {
+		t.Errorf("expected the prices of Pro largest first, got %+v", pro.Prices)
+	}
+
+	if team.ID != "prod_team" || !floatEquals(team.MRR, 300, 0.001) {
+		t.Errorf("expected Team second, got %+v", team)
+	}
+
+	// chf has no exchange rate and is left out like it is from MRR
+	if !other.Other || !floatEquals(other.MRR, 90, 0.001) {
+		t.Errorf("expected the remaining products grouped, got %+v", other)
+	}
+
+	if !floatEquals(pro.Percentage, 510.0/900*100, 0.001) || !floatEquals(pro.Percentage+team.Percentage+other.Percentage, 100, 0.001) {
+		t.Errorf("expected percentages of the total product MRR, got %v, %v, %v", pro.Percentage, team.Percentage, other.Percentage)
+	}
+}
+
+func TestSubscriptionItemsMRR_SpreadsDiscounts(t *testing.T) {
+	item := func(priceID string, amount int64) *stripe.SubscriptionItem {
+		return &stripe.SubscriptionItem{
+			Quantity: 1,
+			Price: &stripe.Price{
+				ID:         priceID,
+				Currency:   "usd",
+				UnitAmount: amount,
+				Recurring:  &stripe.PriceRecurring{Interval: "month", IntervalCount: 1},
+			},
+		}
+	}
+
+	items, _ := subscriptionItemsMRR(&stripe.Subscription{
+		Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{item("price_a", 7500), item("price_b", 2500)}},
+		Discount: &stripe.Discount{Coupon: &stripe.Coupon{
+			Duration:  stripe.CouponDurationForever,
+			AmountOff: 2000,
+			Currency:  "usd",
+		}},
+	}, nil)
+
+	if len(items) != 2 || !floatEquals(items[0].Amount, 60, 0.001) || !floatEquals(items[1].Amount, 20, 0.001) {
+		t.Errorf("expected the discount spread in proportion to the items, got %+v", items)
+	}
+}
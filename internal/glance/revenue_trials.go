@@ -0,0 +1,112 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/subscription"
+)
+
+const (
+	defaultTrialConversionDays = 30
+	maxTrialConversionDays     = 365
+)
+
+// validateTrialConversionDays defaults trial-conversion-days and checks that
+// it's within range
+func validateTrialConversionDays(days *int) error {
+	if *days == 0 {
+		*days = defaultTrialConversionDays
+	}
+
+	if *days < 1 || *days > maxTrialConversionDays {
+		return fmt.Errorf("trial-conversion-days must be between 1 and %d, got: %d", maxTrialConversionDays, *days)
+	}
+
+	return nil
+}
+
+// trialConversion counts the trials that ended in a window and how many of
+// them converted to a paying subscription
+type trialConversion struct {
+	Ended     int
+	Converted int
+}
+
+// rate returns the percentage of ended trials that converted, returning false
+// when no trial ended
+func (c trialConversion) rate() (float64, bool) {
+	if c.Ended == 0 {
+		return 0, false
+	}
+
+	return float64(c.Converted) / float64(c.Ended) * 100, true
+}
+
+// countTrialConversions counts the subscriptions whose trial ended between
+// since and now. Active subscriptions converted, as do past due ones with
+// countPastDue, while canceled, unpaid and expired ones didn't.
+func countTrialConversions(subscriptions []*stripe.Subscription, since, now time.Time, countPastDue bool) trialConversion {
+	var conversion trialConversion
+	seen := make(map[string]bool)
+
+	for _, sub := range subscriptions {
+		if sub.TrialEnd < since.Unix() || sub.TrialEnd > now.Unix() || seen[sub.ID] {
+			continue
+		}
+		seen[sub.ID] = true
+
+		conversion.Ended++
+		if sub.Status == stripe.SubscriptionStatusActive || (countPastDue && sub.Status == stripe.SubscriptionStatusPastDue) {
+			conversion.Converted++
+		}
+	}
+
+	return conversion
+}
+
+// listEndedTrialsWithRetry lists the canceled subscriptions whose last period
+// ended since the given time, which includes the trials canceled when they
+// ended as their period is the trial itself
+func listEndedTrialsWithRetry(ctx context.Context, client *StripeClientWrapper, since time.Time) ([]*stripe.Subscription, error) {
+	var subscriptions []*stripe.Subscription
+	err := client.ExecuteWithRetry(ctx, "listEndedTrials", func() error {
+		subscriptions = nil
+
+		params := &stripe.SubscriptionListParams{}
+		params.Status = stripe.String(string(stripe.SubscriptionStatusCanceled))
+		params.Filters.AddFilter("current_period_end", "gte", fmt.Sprintf("%d", since.Unix()))
+		params.Limit = stripe.Int64(stripeListPageSize)
+		params.Context = ctx
+		params.AddExpand("data.customer")
+
+		iter := subscription.List(params)
+		for iter.Next() {
+			if sub := iter.Subscription(); sub.TrialEnd > 0 {
+				subscriptions = append(subscriptions, sub)
+			}
+		}
+
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list canceled trials: %w", err)
+		}
+
+		return nil
+	})
+
+	return subscriptions, err
+}
+
+// updateTrialConversion sets the conversion of the trials that ended in the
+// last trial-conversion-days, from the current subscriptions of scan and the
+// canceled ones, left undefined when no trial ended
+func (w *revenueWidget) updateTrialConversion(scan *subscriptionScan, canceled []*stripe.Subscription, now time.Time) {
+	since := now.AddDate(0, 0, -w.TrialConversionDays)
+	subscriptions := append(append([]*stripe.Subscription{}, scan.Current...), canceled...)
+
+	conversion := countTrialConversions(subscriptions, since, now, w.CountPastDueAsActive)
+	w.TrialsEnded, w.TrialsConverted = conversion.Ended, conversion.Converted
+	w.TrialConversionRate, w.TrialConversionDefined = conversion.rate()
+}
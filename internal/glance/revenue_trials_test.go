@@ -0,0 +1,69 @@
+package glance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCountTrialConversions(t *testing.T) {
+	now := time.Date(2026, time.July, 31, 12, 0, 0, 0, time.UTC)
+	since := now.AddDate(0, 0, -30)
+
+	trial := func(id string, status stripe.SubscriptionStatus, trialEnd time.Time) *stripe.Subscription {
+		return &stripe.Subscription{ID: id, Status: status, TrialEnd: trialEnd.Unix()}
+	}
+
+	subscriptions := []*stripe.Subscription{
+		trial("sub_1", stripe.SubscriptionStatusActive, now.AddDate(0, 0, -3)),
+		trial("sub_2", stripe.SubscriptionStatusActive, now.AddDate(0, 0, -20)),
+		trial("sub_3", stripe.SubscriptionStatusPastDue, now.AddDate(0, 0, -5)),
+		trial("sub_4", stripe.SubscriptionStatusCanceled, now.AddDate(0, 0, -10)),
+		trial("sub_4", stripe.SubscriptionStatusCanceled, now.AddDate(0, 0, -10)),
+		// Still in trial, ended before the window, or never in trial
+		trial("sub_5", stripe.SubscriptionStatusTrialing, now.AddDate(0, 0, 5)),
+		trial("sub_6", stripe.SubscriptionStatusActive, now.AddDate(0, 0, -45)),
+		{ID: "sub_7", Status: stripe.SubscriptionStatusActive},
+	}
+
+	tests := []struct {
+		name         string
+		countPastDue bool
+		converted    int
+		rate         float64
+	}{
+		{"past due not converted", false, 2, 50},
+		{"past due counted as active", true, 3, 75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conversion := countTrialConversions(subscriptions, since, now, tt.countPastDue)
+			if conversion.Ended != 4 || conversion.Converted != tt.converted {
+				t.Fatalf("expected %d of 4 trials converted, got %+v", tt.converted, conversion)
+			}
+
+			if rate, ok := conversion.rate(); !ok || !floatEquals(rate, tt.rate, 0.001) {
+				t.Errorf("expected a conversion rate of %v%%, got %v", tt.rate, rate)
+			}
+		})
+	}
+
+	if _, ok := countTrialConversions(nil, since, now, false).rate(); ok {
+		t.Error("expected no conversion rate without ended trials")
+	}
+}
+
+func TestValidateTrialConversionDays(t *testing.T) {
+	days := 0
+	if err := validateTrialConversionDays(&days); err != nil || days != defaultTrialConversionDays {
+		t.Errorf("expected the default of %d days, got %d and %v", defaultTrialConversionDays, days, err)
+	}
+
+	for _, days := range []int{-1, 366} {
+		if err := validateTrialConversionDays(&days); err == nil {
+			t.Errorf("expected an error for %d days", days)
+		}
+	}
+}
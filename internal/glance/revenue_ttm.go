@@ -0,0 +1,56 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// ttmMonths is the number of calendar months, including the current one,
+// trailing twelve month revenue covers
+const ttmMonths = 12
+
+// trailingTwelveMonthRevenue sums the revenue collected over the last twelve
+// calendar months, from the last snapshot of each previous month and the
+// current month's collected revenue so far. monthly holds one snapshot per
+// month, oldest first and ending with the current month, as returned by
+// GetRevenueMonthly. Months without a snapshot, or whose snapshot predates
+// collected revenue, are missing, in which case the months with data,
+// counting the current month by how much of it has passed, are annualized
+// and extrapolated is true. Returns 0 without any data.
+func trailingTwelveMonthRevenue(monthly []*RevenueSnapshot, currentCollected float64, now time.Time) (revenue float64, extrapolated bool) {
+	covered := 0
+	for _, snapshot := range monthly[:max(len(monthly)-1, 0)] {
+		if snapshot == nil || snapshot.Collected == 0 {
+			continue
+		}
+
+		revenue += snapshot.Collected
+		covered++
+	}
+
+	revenue += currentCollected
+	if covered == ttmMonths-1 {
+		return revenue, false
+	}
+
+	startOfMonth := bucketStart(now, MetricsBucketMonth)
+	elapsed := float64(now.Sub(startOfMonth)) / float64(startOfMonth.AddDate(0, 1, 0).Sub(startOfMonth))
+	if months := float64(covered) + elapsed; months > 0 {
+		return revenue / months * ttmMonths, true
+	}
+
+	return 0, true
+}
+
+// updateTTMRevenue sets the revenue of the trailing twelve months from the
+// stored monthly snapshots and the current collected revenue
+func (w *revenueWidget) updateTTMRevenue(ctx context.Context, db *SimpleMetricsDB, now time.Time) {
+	monthly, err := db.GetRevenueMonthly(ctx, w.metricsKey(), now, ttmMonths)
+	if err != nil {
+		slog.Error("Failed to get monthly revenue snapshots", "error", err)
+		monthly = nil
+	}
+
+	w.TTMRevenue, w.TTMExtrapolated = trailingTwelveMonthRevenue(monthly, w.CollectedRevenue, now)
+}
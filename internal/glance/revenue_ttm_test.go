@@ -0,0 +1,49 @@
+package glance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrailingTwelveMonthRevenue(t *testing.T) {
+	// Halfway through April
+	now := time.Date(2026, time.April, 16, 0, 0, 0, 0, time.UTC)
+
+	months := func(collected ...float64) []*RevenueSnapshot {
+		monthly := make([]*RevenueSnapshot, ttmMonths)
+		for i, amount := range collected {
+			if amount >= 0 {
+				monthly[ttmMonths-1-len(collected)+i] = &RevenueSnapshot{Collected: amount}
+			}
+		}
+		return monthly
+	}
+
+	full := make([]float64, ttmMonths-1)
+	for i := range full {
+		full[i] = 1000
+	}
+
+	tests := []struct {
+		name         string
+		monthly      []*RevenueSnapshot
+		current      float64
+		expected     float64
+		extrapolated bool
+	}{
+		{"full year", months(full...), 600, 11600, false},
+		{"two months of history", months(1000, 2000), 500, 3500 / 2.5 * 12, true},
+		{"missing and pre-collected months are left out", months(1000, -1, 0, 2000), 500, 3500 / 2.5 * 12, true},
+		{"current month only", months(), 500, 12000, true},
+		{"no history", nil, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revenue, extrapolated := trailingTwelveMonthRevenue(tt.monthly, tt.current, now)
+			if !floatEquals(revenue, tt.expected, 0.01) || extrapolated != tt.extrapolated {
+				t.Errorf("expected %v (extrapolated %v), got %v (extrapolated %v)", tt.expected, tt.extrapolated, revenue, extrapolated)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// backgroundJob is periodic work that runs independently of page requests
+type backgroundJob struct {
+	name    string
+	nextRun func(now time.Time) time.Time
+	run     func(ctx context.Context)
+}
+
+// backgroundScheduler runs background jobs until stopped. Each application
+// owns one so that jobs are torn down together with the server on config reload.
+type backgroundScheduler struct {
+	jobs   []*backgroundJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+func newBackgroundScheduler() *backgroundScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &backgroundScheduler{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (s *backgroundScheduler) addJob(job *backgroundJob) {
+	s.jobs = append(s.jobs, job)
+}
+
+func (s *backgroundScheduler) start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(job)
+		}()
+	}
+}
+
+func (s *backgroundScheduler) loop(job *backgroundJob) {
+	for {
+		wait := time.Until(job.nextRun(time.Now()))
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if globalPause.isPaused() {
+			slog.Debug("Skipping background job while paused", "job", job.name)
+			continue
+		}
+
+		slog.Debug("Running background job", "job", job.name)
+		job.run(s.ctx)
+	}
+}
+
+// stop cancels running jobs and waits for them to return
+func (s *backgroundScheduler) stop() {
+	s.once.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+	})
+}
+
+func everyInterval(interval time.Duration) func(time.Time) time.Time {
+	return func(now time.Time) time.Time {
+		return now.Add(interval)
+	}
+}
+
+func dailyAt(hour int) func(time.Time) time.Time {
+	return func(now time.Time) time.Time {
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		return next
+	}
+}
@@ -0,0 +1,271 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	seriesSourceRevenue   = "revenue"
+	seriesSourceCustomers = "customers"
+
+	seriesDefaultWindow = 12
+)
+
+// seriesMaxWindows is the largest window of each granularity, a year of days
+// or five years of months
+var seriesMaxWindows = map[MetricsBucket]int{
+	MetricsBucketDay:   366,
+	MetricsBucketMonth: 60,
+}
+
+// seriesMetric describes a snapshot field that can be queried as a series
+type seriesMetric struct {
+	source string
+	field  int
+}
+
+// seriesMetrics maps metric names to snapshot fields. It's built from the
+// series struct tags so that new snapshot fields become queryable by tagging them.
+var seriesMetrics = buildSeriesMetrics(map[string]reflect.Type{
+	seriesSourceRevenue:   reflect.TypeOf(RevenueSnapshot{}),
+	seriesSourceCustomers: reflect.TypeOf(CustomerSnapshot{}),
+})
+
+func buildSeriesMetrics(sources map[string]reflect.Type) map[string]seriesMetric {
+	metrics := make(map[string]seriesMetric)
+
+	for source, snapshotType := range sources {
+		for i := 0; i < snapshotType.NumField(); i++ {
+			name := snapshotType.Field(i).Tag.Get("series")
+			if name == "" {
+				continue
+			}
+
+			if _, exists := metrics[name]; exists {
+				panic(fmt.Sprintf("series metric %q is defined more than once", name))
+			}
+
+			metrics[name] = seriesMetric{source: source, field: i}
+		}
+	}
+
+	return metrics
+}
+
+func seriesMetricNames() []string {
+	names := make([]string, 0, len(seriesMetrics))
+	for name := range seriesMetrics {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+// value returns the metric's value from a RevenueSnapshot or CustomerSnapshot,
+// returning false when an optional field is unset
+func (m seriesMetric) value(snapshot any) (float64, bool) {
+	field := reflect.ValueOf(snapshot).Elem().Field(m.field)
+
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return 0, false
+		}
+		field = field.Elem()
+	}
+
+	if field.CanFloat() {
+		return field.Float(), true
+	}
+
+	return float64(field.Int()), true
+}
+
+// SeriesPoint is a single bucket of a series, Value is null when no snapshot
+// was stored within the bucket
+type SeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     *float64  `json:"value"`
+}
+
+// SeriesResponse is the response of the series endpoint
+type SeriesResponse struct {
+	Metric      string        `json:"metric"`
+	Mode        string        `json:"mode"`
+	Account     string        `json:"account,omitempty"`
+	Granularity MetricsBucket `json:"granularity"`
+	Points      []SeriesPoint `json:"points"`
+
+	// Annotations within the window, only with annotations=true
+	Annotations []*Annotation `json:"annotations,omitempty"`
+}
+
+type seriesQuery struct {
+	metric      string
+	mode        string
+	account     string
+	granularity MetricsBucket
+	window      int
+	annotations bool
+}
+
+func parseSeriesQuery(values map[string][]string) (*seriesQuery, error) {
+	get := func(key, fallback string) string {
+		if v, ok := values[key]; ok && len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+		return fallback
+	}
+
+	query := &seriesQuery{
+		metric:      get("metric", ""),
+		mode:        get("mode", "live"),
+		account:     get("account", ""),
+		granularity: MetricsBucket(get("granularity", string(MetricsBucketMonth))),
+	}
+
+	if _, ok := seriesMetrics[query.metric]; !ok {
+		return nil, fmt.Errorf("unknown metric %q, valid metrics are: %s", query.metric, strings.Join(seriesMetricNames(), ", "))
+	}
+
+	if query.mode != "live" && query.mode != "test" {
+		return nil, fmt.Errorf("mode must be 'live' or 'test', got: %s", query.mode)
+	}
+
+	if err := validateAccountLabel(query.account); err != nil {
+		return nil, err
+	}
+
+	if query.granularity != MetricsBucketDay && query.granularity != MetricsBucketMonth {
+		return nil, fmt.Errorf("granularity must be 'day' or 'month', got: %s", query.granularity)
+	}
+
+	maxWindow := seriesMaxWindows[query.granularity]
+	window, err := strconv.Atoi(get("window", strconv.Itoa(seriesDefaultWindow)))
+	if err != nil || window < 1 || window > maxWindow {
+		return nil, fmt.Errorf("window must be a number between 1 and %d for %s granularity", maxWindow, query.granularity)
+	}
+	query.window = window
+
+	annotations, err := strconv.ParseBool(get("annotations", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("annotations must be 'true' or 'false', got: %s", get("annotations", ""))
+	}
+	query.annotations = annotations
+
+	return query, nil
+}
+
+// addBuckets moves a bucket start forward or backward by n buckets
+func addBuckets(t time.Time, bucket MetricsBucket, n int) time.Time {
+	if bucket == MetricsBucketMonth {
+		return t.AddDate(0, n, 0)
+	}
+
+	return t.AddDate(0, 0, n)
+}
+
+// buildSeries returns one point per bucket in the window ending with the bucket
+// containing now, leaving buckets without snapshots as null
+func buildSeries(ctx context.Context, db *SimpleMetricsDB, query *seriesQuery, now time.Time) ([]SeriesPoint, error) {
+	metric := seriesMetrics[query.metric]
+	last := bucketStart(now, query.granularity)
+	first := addBuckets(last, query.granularity, -(query.window - 1))
+
+	values := make(map[time.Time]float64)
+
+	switch metric.source {
+	case seriesSourceRevenue:
+		history, err := db.GetRevenueHistoryAggregated(ctx, metricsKey(query.mode, query.account), first, now, query.granularity, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, snapshot := range history {
+			if value, ok := metric.value(snapshot); ok {
+				values[bucketStart(snapshot.Timestamp.In(now.Location()), query.granularity)] = value
+			}
+		}
+	case seriesSourceCustomers:
+		history, err := db.GetCustomerHistoryAggregated(ctx, metricsKey(query.mode, query.account), first, now, query.granularity, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, snapshot := range history {
+			if value, ok := metric.value(snapshot); ok {
+				values[bucketStart(snapshot.Timestamp.In(now.Location()), query.granularity)] = value
+			}
+		}
+	}
+
+	points := make([]SeriesPoint, 0, query.window)
+	for i := 0; i < query.window; i++ {
+		start := addBuckets(first, query.granularity, i)
+		point := SeriesPoint{Timestamp: start}
+
+		if value, ok := values[start]; ok {
+			point.Value = &value
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+func (a *application) handleSeriesRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	query, err := parseSeriesQuery(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := buildSeriesResponse(r.Context(), GetSimpleMetricsDB(), query, time.Now().In(defaultTimezone()))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// buildSeriesResponse returns the series of query along with the annotations
+// within its window when they were asked for
+func buildSeriesResponse(ctx context.Context, db *SimpleMetricsDB, query *seriesQuery, now time.Time) (*SeriesResponse, error) {
+	points, err := buildSeries(ctx, db, query, now)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SeriesResponse{
+		Metric:      query.metric,
+		Mode:        query.mode,
+		Account:     query.account,
+		Granularity: query.granularity,
+		Points:      points,
+	}
+
+	if query.annotations {
+		// The window starts with the first point and ends now
+		response.Annotations, err = db.ListAnnotations(ctx, metricsKey(query.mode, query.account), points[0].Timestamp, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
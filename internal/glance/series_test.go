@@ -0,0 +1,167 @@
+package glance
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesMetrics_BuiltFromSnapshotTags(t *testing.T) {
+	for _, name := range []string{"mrr", "arr", "new_mrr", "customers", "churn_rate"} {
+		if _, ok := seriesMetrics[name]; !ok {
+			t.Errorf("expected metric %q to be registered", name)
+		}
+	}
+
+	metric := seriesMetrics["customers"]
+	if value, ok := metric.value(&CustomerSnapshot{TotalCustomers: 42}); !ok || value != 42 {
+		t.Errorf("expected customers value 42, got %f", value)
+	}
+
+	ratio := 2.5
+	quickRatio := seriesMetrics["quick_ratio"]
+	if value, ok := quickRatio.value(&RevenueSnapshot{QuickRatio: &ratio}); !ok || value != 2.5 {
+		t.Errorf("expected quick ratio 2.5, got %f", value)
+	}
+
+	if _, ok := quickRatio.value(&RevenueSnapshot{}); ok {
+		t.Error("expected an undefined quick ratio to have no value")
+	}
+}
+
+func TestParseSeriesQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    map[string][]string
+		wantError string
+	}{
+		{
+			name:   "defaults",
+			values: map[string][]string{"metric": {"mrr"}},
+		},
+		{
+			name:      "unknown metric lists valid names",
+			values:    map[string][]string{"metric": {"cash"}},
+			wantError: "valid metrics are: active_customers, arpu, arr, churn_rate,",
+		},
+		{
+			name:      "invalid granularity",
+			values:    map[string][]string{"metric": {"mrr"}, "granularity": {"week"}},
+			wantError: "granularity must be",
+		},
+		{
+			name:      "window out of range",
+			values:    map[string][]string{"metric": {"mrr"}, "window": {"0"}},
+			wantError: "window must be",
+		},
+		{
+			name:      "window of a year of months",
+			values:    map[string][]string{"metric": {"mrr"}, "window": {"366"}},
+			wantError: "between 1 and 60 for month granularity",
+		},
+		{
+			name:   "window of a year of days",
+			values: map[string][]string{"metric": {"mrr"}, "granularity": {"day"}, "window": {"366"}},
+		},
+		{
+			name:      "invalid annotations",
+			values:    map[string][]string{"metric": {"mrr"}, "annotations": {"yes"}},
+			wantError: "annotations must be",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parseSeriesQuery(tt.values)
+
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, ok := tt.values["window"]; ok {
+				return
+			}
+
+			if query.mode != "live" || query.granularity != MetricsBucketMonth || query.window != seriesDefaultWindow || query.annotations {
+				t.Errorf("unexpected defaults: %+v", query)
+			}
+		})
+	}
+}
+
+func TestBuildSeries_GapsAreNull(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	now := time.Date(2026, time.April, 15, 12, 0, 0, 0, time.UTC)
+
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Date(2026, time.February, 3, 0, 0, 0, 0, time.UTC), MRR: 100, Mode: "live"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC), MRR: 0, Mode: "live"})
+
+	points, err := buildSeries(ctx, db, &seriesQuery{metric: "mrr", mode: "live", granularity: MetricsBucketMonth, window: 4}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(points) != 4 {
+		t.Fatalf("expected 4 points, got %d", len(points))
+	}
+
+	if points[0].Value != nil || points[2].Value != nil {
+		t.Error("expected months without snapshots to be null")
+	}
+
+	if points[1].Value == nil || *points[1].Value != 100 {
+		t.Errorf("expected February value 100, got %v", points[1].Value)
+	}
+
+	if points[3].Value == nil || *points[3].Value != 0 {
+		t.Error("expected a stored zero to be kept rather than treated as a gap")
+	}
+
+	if !points[0].Timestamp.Equal(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected series to start in January, got %s", points[0].Timestamp)
+	}
+}
+
+func TestBuildSeriesResponse_Annotations(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+	now := time.Date(2026, time.April, 15, 12, 0, 0, 0, time.UTC)
+
+	for _, annotation := range []*Annotation{
+		{Timestamp: time.Date(2025, time.December, 20, 0, 0, 0, 0, time.UTC), Mode: "live", Label: "Before the window"},
+		{Timestamp: time.Date(2026, time.February, 10, 0, 0, 0, 0, time.UTC), Mode: "live", Label: "Price change"},
+		{Timestamp: time.Date(2026, time.March, 5, 0, 0, 0, 0, time.UTC), Mode: "test", Label: "Other mode"},
+	} {
+		db.SaveAnnotation(ctx, annotation)
+	}
+
+	query := &seriesQuery{metric: "mrr", mode: "live", granularity: MetricsBucketMonth, window: 4}
+
+	response, err := buildSeriesResponse(ctx, db, query, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if response.Annotations != nil {
+		t.Errorf("expected no annotations unless asked for, got %+v", response.Annotations)
+	}
+
+	query.annotations = true
+	response, err = buildSeriesResponse(ctx, db, query, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(response.Annotations) != 1 || response.Annotations[0].Label != "Price change" {
+		t.Errorf("expected only the annotation of the mode within the window, got %+v", response.Annotations)
+	}
+}
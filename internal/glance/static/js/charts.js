@@ -57,25 +57,29 @@
                 ctx.stroke();
             }
 
-            // Draw line
+            // Draw line, dashed into estimated points
+            const estimated = options?.estimated || [];
             ctx.strokeStyle = options?.color || '#3b82f6';
             ctx.lineWidth = 2;
-            ctx.beginPath();
 
             values.forEach((value, index) => {
+                if (index === 0) return;
+
                 const x = padding + index * xStep;
                 const y = height - padding - (value - minValue) * yScale;
+                const previousX = padding + (index - 1) * xStep;
+                const previousY = height - padding - (values[index - 1] - minValue) * yScale;
 
-                if (index === 0) {
-                    ctx.moveTo(x, y);
-                } else {
-                    ctx.lineTo(x, y);
-                }
+                ctx.setLineDash(estimated[index - 1] ? [4, 4] : []);
+                ctx.beginPath();
+                ctx.moveTo(previousX, previousY);
+                ctx.lineTo(x, y);
+                ctx.stroke();
             });
 
-            ctx.stroke();
+            ctx.setLineDash([]);
 
-            // Draw points
+            // Draw points, hollow when estimated
             ctx.fillStyle = options?.color || '#3b82f6';
             values.forEach((value, index) => {
                 const x = padding + index * xStep;
@@ -83,7 +87,11 @@
 
                 ctx.beginPath();
                 ctx.arc(x, y, 3, 0, 2 * Math.PI);
-                ctx.fill();
+                if (estimated[index]) {
+                    ctx.stroke();
+                } else {
+                    ctx.fill();
+                }
             });
 
             // Draw labels
@@ -118,9 +126,10 @@
         document.querySelectorAll('[data-chart-type="trend"]').forEach(function(canvas) {
             const labels = JSON.parse(canvas.dataset.labels || '[]');
             const values = JSON.parse(canvas.dataset.values || '[]');
+            const estimated = JSON.parse(canvas.dataset.estimated || '[]');
             const color = canvas.dataset.color || '#3b82f6';
 
-            BusinessCharts.renderTrendChart(canvas.id, labels, values, { color: color });
+            BusinessCharts.renderTrendChart(canvas.id, labels, values, { color: color, estimated: estimated });
         });
     });
 })();
@@ -743,6 +743,37 @@ function initThemePicker() {
     })
 }
 
+async function refreshWidget(id) {
+    const widgetElement = find(`.widget[data-widget-id="${id}"]`);
+    if (widgetElement === null) return;
+
+    const response = await fetch(`${pageData.baseURL}/api/widgets/${id}/content/`);
+    if (!response.ok) return;
+
+    const template = document.createElement("template");
+    template.innerHTML = (await response.text()).trim();
+
+    const refreshedElement = template.content.firstElementChild;
+    if (refreshedElement !== null) {
+        widgetElement.replaceWith(refreshedElement);
+    }
+}
+
+function setupWidgetRefreshes() {
+    if (!window.EventSource || find(".widget[data-widget-id]") === null) return;
+
+    // Reconnects on its own, such as after the server restarted on a config reload
+    const events = new EventSource(`${pageData.baseURL}/api/events`);
+
+    events.addEventListener("widget-refresh", (event) => {
+        const refresh = JSON.parse(event.data);
+
+        for (const id of refresh.widget_ids) {
+            refreshWidget(id);
+        }
+    });
+}
+
 async function setupPage() {
     initThemePicker();
 
@@ -765,6 +796,7 @@ async function setupPage() {
         setupMasonries();
         setupDynamicRelativeTime();
         setupLazyImages();
+        setupWidgetRefreshes();
     } finally {
         pageElement.classList.add("content-ready");
         pageElement.setAttribute("aria-busy", "false");
@@ -0,0 +1,532 @@
+package glance
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/invoice"
+)
+
+const (
+	// backfillMaxMonths limits how many months a single backfill covers
+	backfillMaxMonths = 60
+	// backfillLookback is how many months before the first backfilled month
+	// invoices are read, so that yearly subscriptions paid earlier are counted
+	backfillLookback = 12
+)
+
+// backfillLine is a paid recurring invoice line, normalized to a monthly amount
+// over the period it pays for
+type backfillLine struct {
+	Customer     string
+	Subscription string // empty for lines outside of a subscription
+	Start        time.Time
+	End          time.Time
+	Currency     string
+	MRR          float64 // in Currency until converted
+}
+
+// backfillSubscription is the lifetime of a subscription, between the events
+// it was created and canceled with. End is zero while it hasn't ended.
+type backfillSubscription struct {
+	Customer string
+	Start    time.Time
+	End      time.Time
+}
+
+func (s backfillSubscription) activeAt(t time.Time) bool {
+	return !s.Start.After(t) && (s.End.IsZero() || s.End.After(t))
+}
+
+// backfillSubscriptionsFrom returns the lifetimes of subscriptions by ID
+func backfillSubscriptionsFrom(subs []*stripe.Subscription) map[string]backfillSubscription {
+	lifetimes := make(map[string]backfillSubscription, len(subs))
+	for _, sub := range subs {
+		if sub.Customer == nil {
+			continue
+		}
+
+		start := sub.StartDate
+		if start == 0 {
+			start = sub.Created
+		}
+
+		// Canceled at the end of the period, it ended then
+		end := sub.EndedAt
+		if end == 0 && sub.Status == stripe.SubscriptionStatusCanceled {
+			end = sub.CanceledAt
+		}
+
+		lifetime := backfillSubscription{Customer: sub.Customer.ID, Start: time.Unix(start, 0)}
+		if end != 0 {
+			lifetime.End = time.Unix(end, 0)
+		}
+		lifetimes[sub.ID] = lifetime
+	}
+
+	return lifetimes
+}
+
+// normalizeMonthlyAmount normalizes a recurring amount to a monthly one,
+// returning false for unknown intervals
+func normalizeMonthlyAmount(amount float64, interval stripe.PriceRecurringInterval, intervalCount int64) (float64, bool) {
+	if intervalCount < 1 {
+		intervalCount = 1
+	}
+
+	switch interval {
+	case "month":
+		return amount / float64(intervalCount), true
+	case "year":
+		return amount / (12.0 * float64(intervalCount)), true
+	case "week":
+		return amount * 4.33 / float64(intervalCount), true
+	case "day":
+		return amount * 30 / float64(intervalCount), true
+	}
+
+	return 0, false
+}
+
+// backfillLinesFromInvoice returns the recurring, non-proration lines of a paid
+// invoice
+func backfillLinesFromInvoice(inv *stripe.Invoice) []backfillLine {
+	if inv.Customer == nil || inv.Lines == nil {
+		return nil
+	}
+
+	var lines []backfillLine
+	for _, line := range inv.Lines.Data {
+		if line.Proration || line.Period == nil || line.Price == nil || line.Price.Recurring == nil {
+			continue
+		}
+
+		currency := normalizeCurrency(string(line.Currency))
+		if currency == "" {
+			currency = normalizeCurrency(string(inv.Currency))
+		}
+
+		mrr, ok := normalizeMonthlyAmount(currencyUnitAmount(float64(line.Amount), currency), line.Price.Recurring.Interval, line.Price.Recurring.IntervalCount)
+		if !ok || mrr <= 0 {
+			continue
+		}
+
+		backfill := backfillLine{
+			Customer: inv.Customer.ID,
+			Start:    time.Unix(line.Period.Start, 0),
+			End:      time.Unix(line.Period.End, 0),
+			Currency: currency,
+			MRR:      mrr,
+		}
+		if line.Subscription != nil {
+			backfill.Subscription = line.Subscription.ID
+		}
+
+		lines = append(lines, backfill)
+	}
+
+	return lines
+}
+
+// convertBackfillLines converts the MRR of lines to the reporting currency at
+// the current rates, like the widgets do, leaving out the lines in currencies
+// without a rate and returning those currencies
+func convertBackfillLines(ctx context.Context, converter *CurrencyConverter, lines []backfillLine) ([]backfillLine, []string) {
+	converted := make([]backfillLine, 0, len(lines))
+	var unconverted []string
+
+	for _, line := range lines {
+		rate, ok := converter.Rate(ctx, line.Currency)
+		if !ok {
+			if !slices.Contains(unconverted, line.Currency) {
+				unconverted = append(unconverted, line.Currency)
+			}
+			continue
+		}
+
+		line.MRR *= rate
+		converted = append(converted, line)
+	}
+
+	return converted, unconverted
+}
+
+// backfillMonthEnd is the timestamp of the snapshot written for a month, the
+// last second of the month in the time zone of month so that re-running a
+// backfill produces the same timestamps
+func backfillMonthEnd(month time.Time) time.Time {
+	return bucketStart(month, MetricsBucketMonth).AddDate(0, 1, 0).Add(-time.Second)
+}
+
+// customersSeenBefore returns the customers with a paid period or a
+// subscription starting before t
+func customersSeenBefore(lines []backfillLine, subscriptions map[string]backfillSubscription, t time.Time) map[string]bool {
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		if line.Start.Before(t) {
+			seen[line.Customer] = true
+		}
+	}
+
+	for _, sub := range subscriptions {
+		if sub.Start.Before(t) {
+			seen[sub.Customer] = true
+		}
+	}
+
+	return seen
+}
+
+// activeMRRByCustomer sums the MRR of lines covering t per customer, leaving
+// out the lines of subscriptions that had ended by t
+func activeMRRByCustomer(lines []backfillLine, subscriptions map[string]backfillSubscription, t time.Time) map[string]float64 {
+	active := make(map[string]float64)
+	for _, line := range lines {
+		if line.Start.After(t) || !line.End.After(t) {
+			continue
+		}
+
+		if sub, ok := subscriptions[line.Subscription]; ok && !sub.activeAt(t) {
+			continue
+		}
+
+		active[line.Customer] += line.MRR
+	}
+
+	return active
+}
+
+// activeCustomersAt returns the customers with a subscription active at t, or
+// a paid period covering it
+func activeCustomersAt(subscriptions map[string]backfillSubscription, paying map[string]float64, t time.Time) map[string]bool {
+	active := make(map[string]bool, len(paying))
+	for customer := range paying {
+		active[customer] = true
+	}
+
+	for _, sub := range subscriptions {
+		if sub.activeAt(t) {
+			active[sub.Customer] = true
+		}
+	}
+
+	return active
+}
+
+// reconstructMonthlyMetrics builds one revenue and one customer snapshot per
+// month from the end of month state of the paid invoice lines and of the
+// subscriptions. MRR comes from the lines, up to the end of their subscription.
+// Customers are counted while they have a subscription or a paid period, new in
+// a month when they had neither at the end of the previous month and churned
+// when the reverse is true. Customers seen before that are reactivated rather
+// than new.
+func reconstructMonthlyMetrics(lines []backfillLine, subscriptions map[string]backfillSubscription, months []time.Time, mode, account string) ([]*RevenueSnapshot, []*CustomerSnapshot) {
+	revenue := make([]*RevenueSnapshot, 0, len(months))
+	customers := make([]*CustomerSnapshot, 0, len(months))
+
+	for _, month := range months {
+		timestamp := backfillMonthEnd(month)
+		previousEnd := bucketStart(timestamp, MetricsBucketMonth).Add(-time.Second)
+		current := activeMRRByCustomer(lines, subscriptions, timestamp)
+		previous := activeMRRByCustomer(lines, subscriptions, previousEnd)
+		currentCustomers := activeCustomersAt(subscriptions, current, timestamp)
+		previousCustomers := activeCustomersAt(subscriptions, previous, previousEnd)
+		seenBefore := customersSeenBefore(lines, subscriptions, previousEnd)
+
+		revenueSnapshot := &RevenueSnapshot{Timestamp: timestamp, Mode: mode, Account: account}
+		customerSnapshot := &CustomerSnapshot{Timestamp: timestamp, Mode: mode, Account: account}
+
+		previousMRR := 0.0
+		for customer, mrr := range previous {
+			previousMRR += mrr
+			if _, ok := current[customer]; !ok {
+				revenueSnapshot.ChurnedMRR += mrr
+			}
+		}
+
+		for customer, mrr := range current {
+			revenueSnapshot.MRR += mrr
+			if _, ok := previous[customer]; !ok {
+				revenueSnapshot.NewMRR += mrr
+			}
+		}
+
+		for customer := range previousCustomers {
+			if !currentCustomers[customer] {
+				customerSnapshot.ChurnedCustomers++
+			}
+		}
+
+		for customer := range currentCustomers {
+			if previousCustomers[customer] {
+				continue
+			}
+
+			if seenBefore[customer] {
+				customerSnapshot.ReactivatedCustomers++
+			} else {
+				customerSnapshot.NewCustomers++
+			}
+		}
+
+		revenueSnapshot.ARR = revenueSnapshot.MRR * 12
+		revenueSnapshot.ARPU = averageRevenuePerUser(revenueSnapshot.MRR, len(current))
+		if previousMRR > 0 {
+			revenueSnapshot.GrowthRate = ((revenueSnapshot.MRR - previousMRR) / previousMRR) * 100
+		}
+
+		customerSnapshot.TotalCustomers = len(currentCustomers)
+		customerSnapshot.ActiveCustomers = len(currentCustomers)
+		customerSnapshot.NetGrowth = customerSnapshot.NewCustomers - customerSnapshot.ChurnedCustomers
+		if len(previousCustomers) > 0 {
+			customerSnapshot.ChurnRate = float64(customerSnapshot.ChurnedCustomers) / float64(len(previousCustomers)) * 100
+		}
+
+		revenue = append(revenue, revenueSnapshot)
+		customers = append(customers, customerSnapshot)
+	}
+
+	return revenue, customers
+}
+
+// listPaidInvoiceLines reads the paid invoices created within a month
+func listPaidInvoiceLines(ctx context.Context, client *StripeClientWrapper, month time.Time) ([]backfillLine, int, error) {
+	var lines []backfillLine
+	count := 0
+
+	err := client.ExecuteWithRetry(ctx, "listPaidInvoices", func() error {
+		lines, count = nil, 0
+
+		params := &stripe.InvoiceListParams{}
+		params.Status = stripe.String(string(stripe.InvoiceStatusPaid))
+		params.CreatedRange = &stripe.RangeQueryParams{
+			GreaterThanOrEqual: month.Unix(),
+			LesserThan:         month.AddDate(0, 1, 0).Unix(),
+		}
+		params.Limit = stripe.Int64(stripeListPageSize)
+		params.Context = ctx
+
+		iter := invoice.List(params)
+		for iter.Next() {
+			count++
+			lines = append(lines, backfillLinesFromInvoice(iter.Invoice())...)
+		}
+
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list invoices: %w", err)
+		}
+
+		return nil
+	})
+
+	return lines, count, err
+}
+
+// listBackfillSubscriptions reads every subscription created before until,
+// canceled ones included, for the lifetimes their created and canceled events
+// give them
+func listBackfillSubscriptions(ctx context.Context, client *StripeClientWrapper, until time.Time) (map[string]backfillSubscription, error) {
+	var subs []*stripe.Subscription
+
+	err := client.ExecuteWithRetry(ctx, "listBackfillSubscriptions", func() error {
+		params := &stripe.SubscriptionListParams{}
+		params.Status = stripe.String("all")
+		params.CreatedRange = &stripe.RangeQueryParams{LesserThan: until.Unix()}
+		params.Limit = stripe.Int64(stripeListPageSize)
+		params.Context = ctx
+
+		var err error
+		if subs, err = client.subscriptions.listSubscriptions(params); err != nil {
+			return fmt.Errorf("failed to list subscriptions: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return backfillSubscriptionsFrom(subs), nil
+}
+
+// storeBackfill imports the backfilled snapshots into db under key and saves
+// it, returning the timestamps of the months that were already stored, which
+// are left as they are
+func storeBackfill(ctx context.Context, db *SimpleMetricsDB, key string, revenue []*RevenueSnapshot, customers []*CustomerSnapshot) (map[int64]bool, error) {
+	revenueResult, err := db.ImportRevenueSnapshots(ctx, key, revenue)
+	if err != nil {
+		return nil, err
+	}
+
+	customerResult, err := db.ImportCustomerSnapshots(ctx, key, customers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Persist(); err != nil {
+		return nil, fmt.Errorf("saving metrics: %w", err)
+	}
+
+	stored := make(map[int64]bool)
+	for _, timestamp := range append(revenueResult.Duplicates, customerResult.Duplicates...) {
+		stored[timestamp.UnixNano()] = true
+	}
+
+	return stored, nil
+}
+
+// cliStripeBackfill reconstructs monthly snapshots for the completed months
+// before the current one from paid Stripe invoices and the subscriptions of
+// the account, and saves them to the metrics file of the config. Snapshot
+// timestamps are stable, so a second run skips every month already stored.
+func cliStripeBackfill(configPath string, args []string) int {
+	flags := flag.NewFlagSet("stripe:backfill", flag.ContinueOnError)
+	months := flags.Int("months", 12, "Number of completed months to backfill")
+	apiKey := flags.String("api-key", os.Getenv("STRIPE_SECRET_KEY"), "Stripe secret key, defaults to STRIPE_SECRET_KEY")
+	account := flags.String("account", "", "account-label of the widgets to backfill, the default account when omitted")
+	timezone := flags.String("timezone", "", "Time zone months start in, defaults to metrics.timezone")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *months < 1 || *months > backfillMaxMonths {
+		fmt.Printf("--months must be between 1 and %d\n", backfillMaxMonths)
+		return 1
+	}
+
+	if err := validateAccountLabel(*account); err != nil {
+		fmt.Printf("--%v\n", err)
+		return 1
+	}
+
+	contents, _, err := parseYAMLIncludes(configPath)
+	if err != nil {
+		fmt.Printf("Could not parse config file: %v\n", err)
+		return 1
+	}
+
+	config, err := newConfigFromYAML(contents)
+	if err != nil {
+		fmt.Printf("Config file is invalid: %v\n", err)
+		return 1
+	}
+
+	if config.Metrics.Path == "" {
+		fmt.Printf("Backfilled snapshots are saved to metrics.path, set it in %s\n", configPath)
+		return 1
+	}
+
+	if *timezone == "" {
+		*timezone = config.Metrics.Timezone
+	}
+
+	location, err := loadTimezone(*timezone)
+	if err != nil {
+		fmt.Printf("--%v\n", err)
+		return 1
+	}
+
+	encService, err := GetEncryptionService()
+	if err != nil {
+		fmt.Printf("Encryption service unavailable: %v\n", err)
+		return 1
+	}
+
+	key, err := encService.DecryptIfNeeded(*apiKey)
+	if err != nil {
+		fmt.Printf("Failed to decrypt API key: %v\n", err)
+		return 1
+	}
+
+	if !strings.HasPrefix(key, "sk_") || len(key) < 12 {
+		fmt.Println("A Stripe secret key is required, set STRIPE_SECRET_KEY or pass --api-key")
+		return 1
+	}
+
+	mode := "live"
+	if strings.HasPrefix(key, "sk_test_") {
+		mode = "test"
+	}
+
+	db := newSimpleMetricsDB()
+	if err := db.SetPersistence(config.Metrics.Path, config.Metrics.Encrypt, encService); err != nil {
+		fmt.Printf("Failed to open metrics file: %v\n", err)
+		return 1
+	}
+
+	client, err := GetStripeClientPool().GetClient(key, mode)
+	if err != nil {
+		fmt.Printf("Failed to get Stripe client: %v\n", err)
+		return 1
+	}
+	stripe.Key = key
+
+	ctx := context.Background()
+	now := time.Now().In(widgetTimezone(location))
+	currentMonth := bucketStart(now, MetricsBucketMonth)
+	first := currentMonth.AddDate(0, -*months, 0)
+
+	var lines []backfillLine
+	for month := first.AddDate(0, -backfillLookback, 0); month.Before(currentMonth); month = month.AddDate(0, 1, 0) {
+		monthLines, count, err := listPaidInvoiceLines(ctx, client, month)
+		if err != nil {
+			fmt.Printf("Failed to read invoices for %s: %v\n", month.Format("2006-01"), err)
+			return 1
+		}
+
+		fmt.Printf("Read %d paid invoices from %s\n", count, month.Format("2006-01"))
+		lines = append(lines, monthLines...)
+	}
+
+	// Validated along with the rest of the config
+	rateProvider, _ := newExchangeRateProvider(config.Currency.RateProvider)
+	converter := newCurrencyConverter(config.Currency.ReportingCurrency, config.Currency.CurrencyRates, rateProvider)
+
+	lines, unconverted := convertBackfillLines(ctx, converter, lines)
+	if len(unconverted) > 0 {
+		fmt.Printf("Left out invoices in currencies without an exchange rate: %s\n", strings.Join(unconverted, ", "))
+	}
+
+	subscriptions, err := listBackfillSubscriptions(ctx, client, currentMonth)
+	if err != nil {
+		fmt.Printf("Failed to read subscriptions: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Read %d subscriptions\n", len(subscriptions))
+
+	// Older months would be removed by the cleanup job
+	notBefore := now.Add(-time.Duration(config.Metrics.Retention))
+	backfilled := make([]time.Time, 0, *months)
+	for month := first; month.Before(currentMonth); month = month.AddDate(0, 1, 0) {
+		if backfillMonthEnd(month).Before(notBefore) {
+			fmt.Printf("%s: skipped, older than metrics.retention\n", month.Format("2006-01"))
+			continue
+		}
+		backfilled = append(backfilled, month)
+	}
+
+	revenue, customers := reconstructMonthlyMetrics(lines, subscriptions, backfilled, mode, *account)
+	stored, err := storeBackfill(ctx, db, metricsKey(mode, *account), revenue, customers)
+	if err != nil {
+		fmt.Printf("Failed to save snapshots: %v\n", err)
+		return 1
+	}
+
+	for i := range revenue {
+		status := "saved"
+		if stored[revenue[i].Timestamp.UnixNano()] {
+			status = "already stored, skipped"
+		}
+
+		fmt.Printf("%s: MRR %.2f, %d customers, %s\n", backfilled[i].Format("2006-01"), revenue[i].MRR, customers[i].TotalCustomers, status)
+	}
+
+	fmt.Printf("\nSaved to %s, start the dashboard to see the backfilled months\n", config.Metrics.Path)
+	return 0
+}
@@ -0,0 +1,207 @@
+package glance
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestBackfillLinesFromInvoice(t *testing.T) {
+	start := time.Date(2026, time.January, 15, 0, 0, 0, 0, time.UTC)
+	period := &stripe.Period{Start: start.Unix(), End: start.AddDate(1, 0, 0).Unix()}
+	recurring := func(interval stripe.PriceRecurringInterval, count int64) *stripe.Price {
+		return &stripe.Price{Recurring: &stripe.PriceRecurring{Interval: interval, IntervalCount: count}}
+	}
+
+	lines := backfillLinesFromInvoice(&stripe.Invoice{
+		Customer: &stripe.Customer{ID: "cus_1"},
+		Currency: stripe.CurrencyUSD,
+		Lines: &stripe.InvoiceLineItemList{Data: []*stripe.InvoiceLineItem{
+			{Amount: 120000, Period: period, Price: recurring("year", 1)},
+			{Amount: 5000, Period: period, Price: recurring("month", 1), Proration: true},
+			{Amount: 5000, Period: period, Price: &stripe.Price{}},
+			{Amount: -1000, Period: period, Price: recurring("month", 1)},
+			{Amount: 3000, Period: period, Price: recurring("month", 3)},
+			// Zero-decimal currencies are charged in whole units
+			{Amount: 12000, Currency: stripe.CurrencyJPY, Period: period, Price: recurring("year", 1)},
+		}},
+	})
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %+v", len(lines), lines)
+	}
+
+	if !floatEquals(lines[0].MRR, 100, 0.01) || !floatEquals(lines[1].MRR, 10, 0.01) || !floatEquals(lines[2].MRR, 1000, 0.01) {
+		t.Errorf("unexpected MRR: %v, %v, %v", lines[0].MRR, lines[1].MRR, lines[2].MRR)
+	}
+
+	if lines[0].Customer != "cus_1" || !lines[0].Start.Equal(start) || lines[0].Currency != "usd" || lines[2].Currency != "jpy" {
+		t.Errorf("unexpected lines: %+v", lines)
+	}
+}
+
+func TestConvertBackfillLines(t *testing.T) {
+	converter := newCurrencyConverter("eur", map[string]float64{"usd": 0.9}, nil)
+	lines := []backfillLine{
+		{Customer: "cus_1", Currency: "eur", MRR: 100},
+		{Customer: "cus_2", Currency: "usd", MRR: 100},
+		{Customer: "cus_3", Currency: "gbp", MRR: 100},
+	}
+
+	converted, unconverted := convertBackfillLines(context.Background(), converter, lines)
+	if len(converted) != 2 || !floatEquals(converted[0].MRR, 100, 0.01) || !floatEquals(converted[1].MRR, 90, 0.01) {
+		t.Errorf("expected the euro and dollar lines in euros, got %+v", converted)
+	}
+
+	if len(unconverted) != 1 || unconverted[0] != "gbp" {
+		t.Errorf("expected the pound line to be left out, got %v", unconverted)
+	}
+}
+
+func TestReconstructMonthlyMetrics(t *testing.T) {
+	month := func(m time.Month) time.Time {
+		return time.Date(2026, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	monthly := func(customer string, from, to time.Month, mrr float64) []backfillLine {
+		var lines []backfillLine
+		for m := from; m <= to; m++ {
+			lines = append(lines, backfillLine{Customer: customer, Start: month(m).AddDate(0, 0, 9), End: month(m+1).AddDate(0, 0, 9), MRR: mrr})
+		}
+		return lines
+	}
+
+	var lines []backfillLine
+	lines = append(lines, monthly("cus_a", time.January, time.April, 100)...)
+	lines = append(lines, monthly("cus_b", time.February, time.February, 50)...)
+	// cus_b comes back in April after canceling in March
+	lines = append(lines, monthly("cus_b", time.April, time.April, 50)...)
+	lines = append(lines, backfillLine{Customer: "cus_c", Start: month(time.January), End: month(time.January).AddDate(1, 0, 0), MRR: 25})
+
+	months := []time.Time{month(time.February), month(time.March), month(time.April)}
+	revenue, customers := reconstructMonthlyMetrics(lines, nil, months, "live", "")
+
+	tests := []struct {
+		name             string
+		expectedMRR      float64
+		expectedNewMRR   float64
+		expectedChurned  float64
+		expectedGrowth   float64
+		expectedTotal    int
+		expectedNew      int
+		expectedChurnedC int
+		// Customers who had a paid period before, like cus_b in April
+		expectedReactivated int
+	}{
+		{name: "February", expectedMRR: 175, expectedNewMRR: 50, expectedGrowth: 40, expectedTotal: 3, expectedNew: 1},
+		{name: "March", expectedMRR: 125, expectedChurned: 50, expectedGrowth: -28.57, expectedTotal: 2, expectedChurnedC: 1},
+		{name: "April", expectedMRR: 175, expectedNewMRR: 50, expectedGrowth: 40, expectedTotal: 3, expectedReactivated: 1},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if expected := backfillMonthEnd(months[i]); !revenue[i].Timestamp.Equal(expected) || !customers[i].Timestamp.Equal(expected) {
+				t.Errorf("expected timestamp %s, got %s", expected, revenue[i].Timestamp)
+			}
+
+			if !floatEquals(revenue[i].MRR, tt.expectedMRR, 0.01) {
+				t.Errorf("expected MRR %v, got %v", tt.expectedMRR, revenue[i].MRR)
+			}
+
+			if !floatEquals(revenue[i].NewMRR, tt.expectedNewMRR, 0.01) || !floatEquals(revenue[i].ChurnedMRR, tt.expectedChurned, 0.01) {
+				t.Errorf("expected new/churned MRR %v/%v, got %v/%v", tt.expectedNewMRR, tt.expectedChurned, revenue[i].NewMRR, revenue[i].ChurnedMRR)
+			}
+
+			if !floatEquals(revenue[i].GrowthRate, tt.expectedGrowth, 0.01) {
+				t.Errorf("expected growth %v, got %v", tt.expectedGrowth, revenue[i].GrowthRate)
+			}
+
+			if customers[i].TotalCustomers != tt.expectedTotal || customers[i].NewCustomers != tt.expectedNew || customers[i].ChurnedCustomers != tt.expectedChurnedC {
+				t.Errorf("expected total/new/churned %d/%d/%d, got %d/%d/%d",
+					tt.expectedTotal, tt.expectedNew, tt.expectedChurnedC,
+					customers[i].TotalCustomers, customers[i].NewCustomers, customers[i].ChurnedCustomers)
+			}
+
+			if customers[i].ReactivatedCustomers != tt.expectedReactivated {
+				t.Errorf("expected %d reactivated customers, got %d", tt.expectedReactivated, customers[i].ReactivatedCustomers)
+			}
+		})
+	}
+}
+
+func TestReconstructMonthlyMetrics_Subscriptions(t *testing.T) {
+	month := func(m time.Month) time.Time {
+		return time.Date(2026, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// cus_a paid a year upfront but canceled in March, cus_b subscribed to a
+	// trial in February and has no paid invoice
+	lines := []backfillLine{{Customer: "cus_a", Subscription: "sub_a", Start: month(time.January), End: month(time.January).AddDate(1, 0, 0), MRR: 100}}
+	subscriptions := backfillSubscriptionsFrom([]*stripe.Subscription{
+		{ID: "sub_a", Customer: &stripe.Customer{ID: "cus_a"}, Status: stripe.SubscriptionStatusCanceled, StartDate: month(time.January).Unix(), CanceledAt: month(time.March).AddDate(0, 0, 14).Unix()},
+		{ID: "sub_b", Customer: &stripe.Customer{ID: "cus_b"}, Status: stripe.SubscriptionStatusTrialing, StartDate: month(time.February).AddDate(0, 0, 9).Unix()},
+	})
+
+	months := []time.Time{month(time.February), month(time.March)}
+	revenue, customers := reconstructMonthlyMetrics(lines, subscriptions, months, "live", "eu")
+
+	if revenue[0].MRR != 100 || customers[0].TotalCustomers != 2 || customers[0].NewCustomers != 1 {
+		t.Errorf("expected MRR 100 and 2 customers with 1 new in February, got %v, %d and %d",
+			revenue[0].MRR, customers[0].TotalCustomers, customers[0].NewCustomers)
+	}
+
+	if revenue[1].MRR != 0 || revenue[1].ChurnedMRR != 100 || customers[1].ChurnedCustomers != 1 || customers[1].TotalCustomers != 1 {
+		t.Errorf("expected the cancellation to churn the MRR and the customer in March, got %+v and %+v", revenue[1], customers[1])
+	}
+
+	if revenue[1].Account != "eu" || customers[1].Account != "eu" {
+		t.Errorf("expected the snapshots of the account, got %q and %q", revenue[1].Account, customers[1].Account)
+	}
+}
+
+func TestStoreBackfill_SkipsStoredMonths(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	months := []time.Time{time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	lines := []backfillLine{{Customer: "cus_a", Start: months[0], End: months[0].AddDate(1, 0, 0), MRR: 100}}
+
+	backfill := func(months []time.Time) map[int64]bool {
+		db := newSimpleMetricsDB()
+		if err := db.SetPersistence(path, false, testEncryptionService("key-a")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		revenue, customers := reconstructMonthlyMetrics(lines, nil, months, "live", "")
+		stored, err := storeBackfill(ctx, db, metricsKey("live", ""), revenue, customers)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return stored
+	}
+
+	if stored := backfill(months[:1]); len(stored) != 0 {
+		t.Fatalf("expected nothing stored before the first run, got %v", stored)
+	}
+
+	// A second run with one more month saves only that month
+	stored := backfill(months)
+	if !stored[backfillMonthEnd(months[0]).UnixNano()] || stored[backfillMonthEnd(months[1]).UnixNano()] {
+		t.Errorf("expected only February to be already stored, got %v", stored)
+	}
+
+	loaded := newSimpleMetricsDB()
+	if err := loaded.SetPersistence(path, false, testEncryptionService("key-a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	history, err := loaded.GetRevenueHistory(ctx, "live", months[0], months[1].AddDate(0, 1, 0), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(history) != 2 {
+		t.Errorf("expected both months in the metrics file, got %d snapshots", len(history))
+	}
+}
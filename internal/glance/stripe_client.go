@@ -25,6 +25,8 @@ type StripeClientWrapper struct {
 	mode          string
 	circuitBreaker *CircuitBreaker
 	rateLimiter   *RateLimiter
+	subscriptions subscriptionLister // faked in tests, see stripe_scan.go
+	customers     customerLister     // faked in tests, see widget-customers.go
 	lastUsed      time.Time
 	mu            sync.RWMutex
 }
@@ -88,15 +90,23 @@ func (p *StripeClientPool) GetClient(apiKey, mode string) (*StripeClientWrapper,
 		return wrapper, nil
 	}
 
-	// Create new client with circuit breaker and rate limiter
+	wrapper := newStripeClientWrapper(apiKey, mode)
+	p.clients.Store(cacheKey, wrapper)
+	return wrapper, nil
+}
+
+// newStripeClientWrapper creates a client with circuit breaker and rate limiter
+func newStripeClientWrapper(apiKey, mode string) *StripeClientWrapper {
 	sc := &client.API{}
 	sc.Init(apiKey, nil)
 
-	wrapper := &StripeClientWrapper{
-		client:   sc,
-		apiKey:   apiKey,
-		mode:     mode,
-		lastUsed: time.Now(),
+	return &StripeClientWrapper{
+		client:        sc,
+		apiKey:        apiKey,
+		mode:          mode,
+		subscriptions: stripeSubscriptionLister{},
+		customers:     stripeCustomerLister{},
+		lastUsed:      time.Now(),
 		circuitBreaker: &CircuitBreaker{
 			maxFailures:  5,
 			resetTimeout: 60 * time.Second,
@@ -109,9 +119,6 @@ func (p *StripeClientPool) GetClient(apiKey, mode string) (*StripeClientWrapper,
 			lastRefill: time.Now(),
 		},
 	}
-
-	p.clients.Store(cacheKey, wrapper)
-	return wrapper, nil
 }
 
 // ExecuteWithRetry executes a function with retry logic, circuit breaker, and rate limiting
@@ -321,22 +328,25 @@ func (p *StripeClientPool) CleanupIdleClients(maxIdleTime time.Duration) {
 	})
 }
 
-// GetMetrics returns metrics for monitoring
-func (p *StripeClientPool) GetMetrics() map[string]interface{} {
-	metrics := map[string]interface{}{
-		"total_clients": 0,
-		"circuit_states": map[string]int{
-			"closed":    0,
-			"open":      0,
-			"half_open": 0,
-		},
-	}
+// StripePoolMetrics holds Stripe client pool metrics for monitoring
+type StripePoolMetrics struct {
+	TotalClients  int                `json:"total_clients"`
+	CircuitStates CircuitStateCounts `json:"circuit_states"`
+}
 
-	totalClients := 0
-	circuitStates := map[string]int{"closed": 0, "open": 0, "half_open": 0}
+// CircuitStateCounts counts circuit breakers by state
+type CircuitStateCounts struct {
+	Closed   int `json:"closed"`
+	Open     int `json:"open"`
+	HalfOpen int `json:"half_open"`
+}
+
+// GetMetrics returns metrics for monitoring
+func (p *StripeClientPool) GetMetrics() *StripePoolMetrics {
+	metrics := &StripePoolMetrics{}
 
 	p.clients.Range(func(key, value interface{}) bool {
-		totalClients++
+		metrics.TotalClients++
 		wrapper := value.(*StripeClientWrapper)
 		wrapper.circuitBreaker.mu.RLock()
 		state := wrapper.circuitBreaker.state
@@ -344,16 +354,14 @@ func (p *StripeClientPool) GetMetrics() map[string]interface{} {
 
 		switch state {
 		case CircuitClosed:
-			circuitStates["closed"]++
+			metrics.CircuitStates.Closed++
 		case CircuitOpen:
-			circuitStates["open"]++
+			metrics.CircuitStates.Open++
 		case CircuitHalfOpen:
-			circuitStates["half_open"]++
+			metrics.CircuitStates.HalfOpen++
 		}
 		return true
 	})
 
-	metrics["total_clients"] = totalClients
-	metrics["circuit_states"] = circuitStates
 	return metrics
 }
@@ -0,0 +1,106 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/invoice"
+	"github.com/stripe/stripe-go/v81/refund"
+)
+
+// refundedAmounts sums succeeded refunds per currency, partial refunds by their
+// amount. With invoicePaymentsOnly only refunds of charges that paid an invoice
+// are counted, which needs the charge of the refunds expanded.
+func refundedAmounts(refunds []*stripe.Refund, invoicePaymentsOnly bool) currencyAmounts {
+	amounts := make(currencyAmounts)
+	for _, r := range refunds {
+		if r.Status != stripe.RefundStatusSucceeded {
+			continue
+		}
+
+		if invoicePaymentsOnly && (r.Charge == nil || r.Charge.Invoice == nil) {
+			continue
+		}
+
+		currency := normalizeCurrency(string(r.Currency))
+		amounts[currency] += currencyUnitAmount(float64(r.Amount), currency)
+	}
+
+	return amounts
+}
+
+// collectedRevenue sums what paid invoices collected per currency, less the
+// refunds of invoice payments. Refunds of charges that didn't pay an invoice
+// aren't counted, as the charges themselves aren't either.
+func collectedRevenue(invoices []*stripe.Invoice, refunds []*stripe.Refund) currencyAmounts {
+	amounts := make(currencyAmounts)
+	for _, inv := range invoices {
+		currency := normalizeCurrency(string(inv.Currency))
+		amounts[currency] += currencyUnitAmount(float64(inv.AmountPaid), currency)
+	}
+
+	for currency, amount := range refundedAmounts(refunds, true) {
+		amounts[currency] -= amount
+	}
+
+	return amounts
+}
+
+// listPaidInvoicesWithRetry lists the paid invoices created since the start of
+// the month
+func listPaidInvoicesWithRetry(ctx context.Context, client *StripeClientWrapper, startOfMonth time.Time) ([]*stripe.Invoice, error) {
+	var invoices []*stripe.Invoice
+	err := client.ExecuteWithRetry(ctx, "listPaidInvoices", func() error {
+		invoices = nil
+
+		params := &stripe.InvoiceListParams{}
+		params.Status = stripe.String(string(stripe.InvoiceStatusPaid))
+		params.CreatedRange = &stripe.RangeQueryParams{GreaterThanOrEqual: startOfMonth.Unix()}
+		params.Limit = stripe.Int64(stripeListPageSize)
+		params.Context = ctx
+
+		iter := invoice.List(params)
+		for iter.Next() {
+			invoices = append(invoices, iter.Invoice())
+		}
+
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list paid invoices: %w", err)
+		}
+
+		return nil
+	})
+
+	return invoices, err
+}
+
+// listRefundsWithRetry lists the refunds created since the start of the month,
+// with their charge expanded
+func listRefundsWithRetry(ctx context.Context, client *StripeClientWrapper, startOfMonth time.Time) ([]*stripe.Refund, error) {
+	var refunds []*stripe.Refund
+	err := client.ExecuteWithRetry(ctx, "listRefunds", func() error {
+		refunds = nil
+
+		params := &stripe.RefundListParams{}
+		params.CreatedRange = &stripe.RangeQueryParams{GreaterThanOrEqual: startOfMonth.Unix()}
+		params.Limit = stripe.Int64(stripeListPageSize)
+		params.Context = ctx
+		// The charge tells whether a refund is of an invoice payment
+		params.AddExpand("data.charge")
+
+		iter := refund.List(params)
+		for iter.Next() {
+			refunds = append(refunds, iter.Refund())
+		}
+
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list refunds: %w", err)
+		}
+
+		return nil
+	})
+
+	return refunds, err
+}
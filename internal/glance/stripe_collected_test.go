@@ -0,0 +1,53 @@
+package glance
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestCollectedRevenue(t *testing.T) {
+	invoices := []*stripe.Invoice{
+		{ID: "in_1", Currency: "usd", AmountPaid: 4900},
+		{ID: "in_2", Currency: "USD", AmountPaid: 1250},
+		{ID: "in_3", Currency: "eur", AmountPaid: 10000},
+		{ID: "in_4", Currency: "jpy", AmountPaid: 3000},
+	}
+
+	invoiceCharge := &stripe.Charge{ID: "ch_1", Invoice: &stripe.Invoice{ID: "in_1"}}
+	refunds := []*stripe.Refund{
+		{ID: "re_1", Currency: "usd", Amount: 1000, Status: stripe.RefundStatusSucceeded, Charge: invoiceCharge},
+		{ID: "re_2", Currency: "usd", Amount: 500, Status: stripe.RefundStatusPending, Charge: invoiceCharge},
+		{ID: "re_3", Currency: "eur", Amount: 2000, Status: stripe.RefundStatusSucceeded, Charge: &stripe.Charge{ID: "ch_2"}},
+		{ID: "re_4", Currency: "jpy", Amount: 500, Status: stripe.RefundStatusSucceeded, Charge: invoiceCharge},
+	}
+
+	amounts := collectedRevenue(invoices, refunds)
+
+	expected := map[string]float64{"usd": 51.5, "eur": 100, "jpy": 2500}
+	if len(amounts) != len(expected) {
+		t.Fatalf("expected %d currencies, got %v", len(expected), amounts)
+	}
+
+	for currency, amount := range expected {
+		if !floatEquals(amounts[currency], amount, 0.001) {
+			t.Errorf("expected %v %s collected, got %v", amount, currency, amounts[currency])
+		}
+	}
+}
+
+func TestRefundedAmounts(t *testing.T) {
+	refunds := []*stripe.Refund{
+		{ID: "re_1", Currency: "usd", Amount: 1000, Status: stripe.RefundStatusSucceeded, Charge: &stripe.Charge{Invoice: &stripe.Invoice{ID: "in_1"}}},
+		{ID: "re_2", Currency: "usd", Amount: 250, Status: stripe.RefundStatusSucceeded, Charge: &stripe.Charge{ID: "ch_2"}},
+		{ID: "re_3", Currency: "usd", Amount: 500, Status: stripe.RefundStatusFailed},
+	}
+
+	if all := refundedAmounts(refunds, false); !floatEquals(all["usd"], 12.5, 0.001) {
+		t.Errorf("expected 12.5 refunded, got %v", all["usd"])
+	}
+
+	if invoices := refundedAmounts(refunds, true); !floatEquals(invoices["usd"], 10, 0.001) {
+		t.Errorf("expected 10 refunded from invoice payments, got %v", invoices["usd"])
+	}
+}
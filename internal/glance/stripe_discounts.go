@@ -0,0 +1,87 @@
+package glance
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// subscriptionDiscounts returns the discounts that apply to a subscription's
+// recurring amount, in the order Stripe applies them. Discounts of the
+// subscription override a discount of its customer, which is only known when
+// the customer is expanded.
+func subscriptionDiscounts(sub *stripe.Subscription) []*stripe.Discount {
+	var discounts []*stripe.Discount
+	for _, discount := range sub.Discounts {
+		// Discounts that aren't expanded have no coupon
+		if discount != nil && discount.Coupon != nil {
+			discounts = append(discounts, discount)
+		}
+	}
+
+	if len(discounts) == 0 && sub.Discount != nil && sub.Discount.Coupon != nil {
+		discounts = append(discounts, sub.Discount)
+	}
+
+	if len(discounts) == 0 && sub.Customer != nil && sub.Customer.Discount != nil && sub.Customer.Discount.Coupon != nil {
+		discounts = append(discounts, sub.Customer.Discount)
+	}
+
+	return discounts
+}
+
+// discountActive reports whether a discount reduces recurring revenue at t.
+// Coupons that apply once only reduce the first invoice and aren't counted,
+// repeating coupons count until their end date and are full price after it.
+func discountActive(discount *stripe.Discount, t time.Time) bool {
+	if discount.Coupon.Duration == stripe.CouponDurationOnce {
+		return false
+	}
+
+	if discount.Start != 0 && t.Before(time.Unix(discount.Start, 0)) {
+		return false
+	}
+
+	return discount.End == 0 || t.Before(time.Unix(discount.End, 0))
+}
+
+// applyDiscounts reduces the monthly amounts of a subscription by its active
+// discounts, one after another. Fixed amounts are taken off every invoice, so
+// they are normalized by the billing interval of the subscription and only
+// reduce the amount in the coupon's currency, down to zero.
+func applyDiscounts(amounts currencyAmounts, discounts []*stripe.Discount, interval stripe.PriceRecurringInterval, intervalCount int64, t time.Time) {
+	for _, discount := range discounts {
+		if !discountActive(discount, t) {
+			continue
+		}
+
+		coupon := discount.Coupon
+		if coupon.PercentOff > 0 {
+			for currency, amount := range amounts {
+				amounts[currency] = amount * (1 - min(coupon.PercentOff, 100)/100)
+			}
+		}
+
+		if coupon.AmountOff > 0 {
+			currency := normalizeCurrency(string(coupon.Currency))
+			amount, ok := amounts[currency]
+			if !ok {
+				continue
+			}
+
+			monthlyOff, ok := normalizeMonthlyAmount(currencyUnitAmount(float64(coupon.AmountOff), currency), interval, intervalCount)
+			if !ok {
+				continue
+			}
+
+			amounts[currency] = max(amount-monthlyOff, 0)
+		}
+	}
+}
+
+// expandSubscriptionDiscounts includes the discounts of listed subscriptions
+// and their customers, which Stripe otherwise returns as IDs
+func expandSubscriptionDiscounts(params *stripe.SubscriptionListParams) {
+	params.AddExpand("data.discounts")
+	params.AddExpand("data.customer")
+}
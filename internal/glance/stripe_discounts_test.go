@@ -0,0 +1,113 @@
+package glance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestApplyDiscounts(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)
+	discount := func(coupon *stripe.Coupon, end time.Time) *stripe.Discount {
+		d := &stripe.Discount{Coupon: coupon, Start: now.AddDate(0, -1, 0).Unix()}
+		if !end.IsZero() {
+			d.End = end.Unix()
+		}
+		return d
+	}
+	percent := func(off float64, duration stripe.CouponDuration) *stripe.Coupon {
+		return &stripe.Coupon{PercentOff: off, Duration: duration}
+	}
+	fixed := func(off int64, currency stripe.Currency) *stripe.Coupon {
+		return &stripe.Coupon{AmountOff: off, Currency: currency, Duration: stripe.CouponDurationForever}
+	}
+
+	tests := []struct {
+		name      string
+		discounts []*stripe.Discount
+		interval  stripe.PriceRecurringInterval
+		expected  float64
+	}{
+		{name: "forever percent", discounts: []*stripe.Discount{discount(percent(50, stripe.CouponDurationForever), time.Time{})}, expected: 49.5},
+		{name: "fixed amount", discounts: []*stripe.Discount{discount(fixed(1000, "usd"), time.Time{})}, expected: 89},
+		{name: "fixed amount on a yearly plan", discounts: []*stripe.Discount{discount(fixed(12000, "usd"), time.Time{})}, interval: "year", expected: 89},
+		{name: "fixed amount in another currency", discounts: []*stripe.Discount{discount(fixed(1000, "eur"), time.Time{})}, expected: 99},
+		{name: "fixed amount above the price", discounts: []*stripe.Discount{discount(fixed(20000, "usd"), time.Time{})}, expected: 0},
+		{
+			name: "stacked percent then fixed",
+			discounts: []*stripe.Discount{
+				discount(percent(20, stripe.CouponDurationForever), time.Time{}),
+				discount(fixed(1000, "usd"), time.Time{}),
+			},
+			expected: 99*0.8 - 10,
+		},
+		{name: "repeating before its end", discounts: []*stripe.Discount{discount(percent(25, stripe.CouponDurationRepeating), now.AddDate(0, 0, 10))}, expected: 74.25},
+		{name: "repeating after its end", discounts: []*stripe.Discount{discount(percent(25, stripe.CouponDurationRepeating), now.AddDate(0, 0, -1))}, expected: 99},
+		{name: "once", discounts: []*stripe.Discount{discount(percent(100, stripe.CouponDurationOnce), time.Time{})}, expected: 99},
+		{name: "not started yet", discounts: []*stripe.Discount{{Coupon: percent(50, stripe.CouponDurationForever), Start: now.AddDate(0, 0, 1).Unix()}}, expected: 99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval := tt.interval
+			if interval == "" {
+				interval = "month"
+			}
+
+			amounts := currencyAmounts{"usd": 99}
+			applyDiscounts(amounts, tt.discounts, interval, 1, now)
+
+			if !floatEquals(amounts["usd"], tt.expected, 0.001) {
+				t.Errorf("expected %v, got %v", tt.expected, amounts["usd"])
+			}
+		})
+	}
+}
+
+func TestSubscriptionDiscounts(t *testing.T) {
+	subscriptionDiscount := &stripe.Discount{ID: "di_sub", Coupon: &stripe.Coupon{PercentOff: 10}}
+	customerDiscount := &stripe.Discount{ID: "di_cus", Coupon: &stripe.Coupon{PercentOff: 20}}
+	customer := &stripe.Customer{ID: "cus_1", Discount: customerDiscount}
+
+	tests := []struct {
+		name     string
+		sub      *stripe.Subscription
+		expected []string
+	}{
+		{name: "expanded discounts", sub: &stripe.Subscription{Discounts: []*stripe.Discount{subscriptionDiscount, {ID: "di_unexpanded"}}, Discount: subscriptionDiscount, Customer: customer}, expected: []string{"di_sub"}},
+		{name: "single discount", sub: &stripe.Subscription{Discounts: []*stripe.Discount{{ID: "di_sub"}}, Discount: subscriptionDiscount, Customer: customer}, expected: []string{"di_sub"}},
+		{name: "customer discount", sub: &stripe.Subscription{Customer: customer}, expected: []string{"di_cus"}},
+		{name: "no discounts", sub: &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_2"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discounts := subscriptionDiscounts(tt.sub)
+			if len(discounts) != len(tt.expected) {
+				t.Fatalf("expected %v, got %d discounts", tt.expected, len(discounts))
+			}
+
+			for i, id := range tt.expected {
+				if discounts[i].ID != id {
+					t.Errorf("expected discount %s, got %s", id, discounts[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestCurrencyAmounts_AddDiscountedSubscription(t *testing.T) {
+	amounts := make(currencyAmounts)
+	amounts.addSubscription(&stripe.Subscription{
+		Currency: "usd",
+		Discount: &stripe.Discount{Coupon: &stripe.Coupon{PercentOff: 50, Duration: stripe.CouponDurationForever}},
+		Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{
+			{Quantity: 1, Price: &stripe.Price{UnitAmount: 9900, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}}},
+		}},
+	}, nil)
+
+	if !floatEquals(amounts["usd"], 49.5, 0.001) {
+		t.Errorf("expected 49.50 USD per month, got %v", amounts["usd"])
+	}
+}
@@ -0,0 +1,79 @@
+package glance
+
+import (
+	"fmt"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// exclusionRules decide which customers and subscriptions are left out of the
+// metrics of a widget: the ones on a Stripe test clock, and the ones whose
+// metadata has any of the key/value pairs of exclude-metadata, such as
+// internal and demo accounts tagged internal=true. Subscriptions are also
+// excluded when their customer is.
+type exclusionRules struct {
+	metadata map[string]string
+}
+
+// newExclusionRules returns the rules of an exclude-metadata option
+func newExclusionRules(metadata map[string]string) (exclusionRules, error) {
+	for key := range metadata {
+		if key == "" {
+			return exclusionRules{}, fmt.Errorf("exclude-metadata keys must not be empty")
+		}
+	}
+
+	return exclusionRules{metadata: metadata}, nil
+}
+
+func (r exclusionRules) matchesMetadata(metadata map[string]string) bool {
+	for key, value := range r.metadata {
+		if v, ok := metadata[key]; ok && v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludesCustomer returns whether c is left out of the metrics
+func (r exclusionRules) excludesCustomer(c *stripe.Customer) bool {
+	if c == nil {
+		return false
+	}
+
+	return c.TestClock != nil || r.matchesMetadata(c.Metadata)
+}
+
+// excludesSubscription returns whether sub is left out of the metrics. The
+// metadata of its customer is only known when the customer is expanded.
+func (r exclusionRules) excludesSubscription(sub *stripe.Subscription) bool {
+	return sub.TestClock != nil || r.matchesMetadata(sub.Metadata) || r.excludesCustomer(sub.Customer)
+}
+
+// filterSubscriptions returns subs without the excluded subscriptions, and how
+// many were excluded
+func (r exclusionRules) filterSubscriptions(subs []*stripe.Subscription) ([]*stripe.Subscription, int) {
+	var kept []*stripe.Subscription
+	for _, sub := range subs {
+		if !r.excludesSubscription(sub) {
+			kept = append(kept, sub)
+		}
+	}
+
+	return kept, len(subs) - len(kept)
+}
+
+// filterScan returns a copy of scan without the excluded subscriptions, and how
+// many were excluded. The scan itself is shared with other widgets, which may
+// exclude others.
+func (r exclusionRules) filterScan(scan *subscriptionScan) (*subscriptionScan, int) {
+	filtered := *scan
+
+	var current, canceled, earlier int
+	filtered.Current, current = r.filterSubscriptions(scan.Current)
+	filtered.Canceled, canceled = r.filterSubscriptions(scan.Canceled)
+	filtered.EarlierCanceled, earlier = r.filterSubscriptions(scan.EarlierCanceled)
+
+	return &filtered, current + canceled + earlier
+}
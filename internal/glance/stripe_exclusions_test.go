@@ -0,0 +1,76 @@
+package glance
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestExclusionRules_Excludes(t *testing.T) {
+	rules, err := newExclusionRules(map[string]string{"internal": "true", "demo": "yes"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	clock := &stripe.TestHelpersTestClock{ID: "clock_1"}
+
+	tests := []struct {
+		name     string
+		sub      *stripe.Subscription
+		expected bool
+	}{
+		{"regular", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1"}}, false},
+		{"on a test clock", &stripe.Subscription{TestClock: clock, Customer: &stripe.Customer{ID: "cus_1"}}, true},
+		{"customer on a test clock", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", TestClock: clock}}, true},
+		{"flagged", &stripe.Subscription{Metadata: map[string]string{"demo": "yes"}}, true},
+		{"flagged customer", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", Metadata: map[string]string{"internal": "true"}}}, true},
+		{"other value", &stripe.Subscription{Customer: &stripe.Customer{ID: "cus_1", Metadata: map[string]string{"internal": "false"}}}, false},
+		{"other key", &stripe.Subscription{Metadata: map[string]string{"plan": "true"}}, false},
+		{"without a customer", &stripe.Subscription{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.excludesSubscription(tt.sub); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if !(exclusionRules{}).excludesCustomer(&stripe.Customer{TestClock: clock}) {
+		t.Error("expected test clock customers to be excluded without exclude-metadata")
+	}
+
+	if _, err := newExclusionRules(map[string]string{"": "true"}); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+}
+
+func TestExclusionRules_FilterScan(t *testing.T) {
+	rules, _ := newExclusionRules(map[string]string{"internal": "true"})
+
+	internal := &stripe.Customer{ID: "cus_internal", Metadata: map[string]string{"internal": "true"}}
+	scan := &subscriptionScan{
+		Current: []*stripe.Subscription{
+			{ID: "sub_1", Customer: &stripe.Customer{ID: "cus_1"}},
+			{ID: "sub_2", Customer: internal},
+			{ID: "sub_3", TestClock: &stripe.TestHelpersTestClock{ID: "clock_1"}},
+		},
+		Canceled:        []*stripe.Subscription{{ID: "sub_4", Customer: internal}},
+		EarlierCanceled: []*stripe.Subscription{{ID: "sub_5", Customer: &stripe.Customer{ID: "cus_2"}}},
+	}
+
+	filtered, excluded := rules.filterScan(scan)
+	if excluded != 3 {
+		t.Errorf("expected 3 excluded subscriptions, got %d", excluded)
+	}
+
+	if len(filtered.Current) != 1 || filtered.Current[0].ID != "sub_1" || len(filtered.Canceled) != 0 || len(filtered.EarlierCanceled) != 1 {
+		t.Errorf("unexpected filtered scan: %+v", filtered)
+	}
+
+	// Other widgets share the scan
+	if len(scan.Current) != 3 || len(scan.Canceled) != 1 {
+		t.Error("expected the shared scan to be left as is")
+	}
+}
@@ -0,0 +1,29 @@
+package glance
+
+import (
+	"context"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// stripeListPageSize is the largest page Stripe returns from list endpoints,
+// ten times the default, so that iterating over a large account takes a tenth
+// of the requests against the rate limit
+const stripeListPageSize = 100
+
+// newMRRSubscriptionListParams returns the params listing the subscriptions
+// of a status to calculate MRR from, a full page at a time and with the
+// prices of their items, their discounts and customers included. An empty
+// status lists every subscription that isn't canceled.
+func newMRRSubscriptionListParams(ctx context.Context, status string) *stripe.SubscriptionListParams {
+	params := &stripe.SubscriptionListParams{}
+	if status != "" {
+		params.Status = stripe.String(status)
+	}
+	params.Limit = stripe.Int64(stripeListPageSize)
+	params.Context = ctx
+	params.AddExpand("data.items.data.price")
+	expandSubscriptionDiscounts(params)
+
+	return params
+}
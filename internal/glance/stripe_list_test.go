@@ -0,0 +1,89 @@
+package glance
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// fakeListIter pages through total objects like the iterators of stripe-go,
+// requesting the next page of limit objects once the current one is consumed
+type fakeListIter struct {
+	total    int
+	limit    int
+	buffered int
+	listed   int
+	requests int
+}
+
+func newFakeListIter(total int, params *stripe.ListParams) *fakeListIter {
+	// Stripe returns 10 objects per page without a limit
+	limit := 10
+	if params.Limit != nil {
+		limit = int(*params.Limit)
+	}
+
+	return &fakeListIter{total: total, limit: limit}
+}
+
+func (i *fakeListIter) Next() bool {
+	if i.buffered == 0 {
+		if i.listed == i.total {
+			return false
+		}
+
+		i.requests++
+		i.buffered = min(i.limit, i.total-i.listed)
+	}
+
+	i.buffered--
+	i.listed++
+	return true
+}
+
+func TestMRRSubscriptionListParams_PageRequests(t *testing.T) {
+	const subscriptions = 5000
+
+	params := newMRRSubscriptionListParams(context.Background(), "active")
+	for _, expand := range []string{"data.items.data.price", "data.discounts", "data.customer"} {
+		if !slices.ContainsFunc(params.Expand, func(e *string) bool { return *e == expand }) {
+			t.Errorf("expected %s to be expanded, got %v", expand, params.Expand)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		params   *stripe.ListParams
+		expected int
+	}{
+		{"default page size", &stripe.ListParams{}, 500},
+		{"full pages", &params.ListParams, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iter := newFakeListIter(subscriptions, tt.params)
+			count := 0
+			for iter.Next() {
+				count++
+			}
+
+			if count != subscriptions || iter.requests != tt.expected {
+				t.Errorf("expected %d subscriptions in %d requests, got %d in %d", subscriptions, tt.expected, count, iter.requests)
+			}
+		})
+	}
+}
+
+func BenchmarkMRRSubscriptionListParams_PageRequests(b *testing.B) {
+	params := newMRRSubscriptionListParams(context.Background(), "active")
+
+	for b.Loop() {
+		iter := newFakeListIter(5000, &params.ListParams)
+		for iter.Next() {
+		}
+		b.ReportMetric(float64(iter.requests), "requests/op")
+	}
+}
@@ -0,0 +1,208 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/invoice"
+)
+
+// Where the amount of metered items is estimated from
+const (
+	meteredSourceUpcoming    = "upcoming invoice"
+	meteredSourceLastInvoice = "last invoice"
+)
+
+// meteredItem is a usage based subscription item, whose amount is only known
+// from the invoices of its subscription
+type meteredItem struct {
+	SubscriptionID string
+	Currency       string
+	Price          *stripe.Price
+}
+
+// isMeteredItem reports whether an item is billed by reported usage
+func isMeteredItem(item *stripe.SubscriptionItem) bool {
+	return item.Price != nil && item.Price.Recurring != nil &&
+		item.Price.Recurring.UsageType == stripe.PriceRecurringUsageTypeMetered
+}
+
+// meteredItems returns the metered items of a subscription
+func meteredItems(sub *stripe.Subscription) []meteredItem {
+	if sub.Items == nil {
+		return nil
+	}
+
+	var items []meteredItem
+	for _, item := range sub.Items.Data {
+		if !isMeteredItem(item) {
+			continue
+		}
+
+		currency := normalizeCurrency(string(item.Price.Currency))
+		if currency == "" {
+			currency = normalizeCurrency(string(sub.Currency))
+		}
+
+		items = append(items, meteredItem{SubscriptionID: sub.ID, Currency: currency, Price: item.Price})
+	}
+
+	return items
+}
+
+// invoicePriceAmount sums the lines of an invoice charging a price, leaving out
+// prorations, in the smallest unit of the invoice currency
+func invoicePriceAmount(inv *stripe.Invoice, priceID string) (float64, bool) {
+	if inv == nil || inv.Lines == nil {
+		return 0, false
+	}
+
+	total, found := int64(0), false
+	for _, line := range inv.Lines.Data {
+		if line.Proration || line.Price == nil || line.Price.ID != priceID {
+			continue
+		}
+
+		total += line.Amount
+		found = true
+	}
+
+	return float64(total), found
+}
+
+// meteredAmountsFromInvoice normalizes what an invoice charges for metered
+// items to monthly amounts, returning false when it charges none of them
+func meteredAmountsFromInvoice(inv *stripe.Invoice, items []meteredItem) (currencyAmounts, bool) {
+	amounts := make(currencyAmounts)
+	found := false
+
+	for _, item := range items {
+		amount, ok := invoicePriceAmount(inv, item.Price.ID)
+		if !ok {
+			continue
+		}
+
+		currency := item.Currency
+		if inv.Currency != "" {
+			currency = normalizeCurrency(string(inv.Currency))
+		}
+
+		monthlyAmount, ok := normalizeMonthlyAmount(currencyUnitAmount(amount, currency), item.Price.Recurring.Interval, item.Price.Recurring.IntervalCount)
+		if !ok {
+			continue
+		}
+
+		amounts[currency] += monthlyAmount
+		found = true
+	}
+
+	return amounts, found
+}
+
+// meteredEstimate is the estimated MRR of metered items
+type meteredEstimate struct {
+	Amounts currencyAmounts
+	// Number of subscriptions estimated from each source
+	Sources map[string]int
+}
+
+// source describes where the estimate comes from, for showing on the widget
+func (e *meteredEstimate) source() string {
+	upcoming, last := e.Sources[meteredSourceUpcoming], e.Sources[meteredSourceLastInvoice]
+	switch {
+	case upcoming > 0 && last > 0:
+		return "upcoming and last invoices"
+	case upcoming > 0:
+		return "upcoming invoices"
+	case last > 0:
+		return "last invoices"
+	}
+
+	return ""
+}
+
+// estimateMeteredMRR estimates the monthly amount of metered items from the
+// upcoming invoice of their subscription, or from its last paid invoice when
+// the upcoming one doesn't charge them yet. Every call goes through the retry
+// wrapper of the client.
+func estimateMeteredMRR(ctx context.Context, client *StripeClientWrapper, items []meteredItem) *meteredEstimate {
+	estimate := &meteredEstimate{Amounts: make(currencyAmounts), Sources: make(map[string]int)}
+
+	bySubscription := make(map[string][]meteredItem)
+	var subscriptionIDs []string
+	for _, item := range items {
+		if _, seen := bySubscription[item.SubscriptionID]; !seen {
+			subscriptionIDs = append(subscriptionIDs, item.SubscriptionID)
+		}
+		bySubscription[item.SubscriptionID] = append(bySubscription[item.SubscriptionID], item)
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		subscriptionItems := bySubscription[subscriptionID]
+
+		source := meteredSourceUpcoming
+		inv, err := upcomingInvoiceWithRetry(ctx, client, subscriptionID)
+		amounts, ok := meteredAmountsFromInvoice(inv, subscriptionItems)
+		if err != nil || !ok {
+			source = meteredSourceLastInvoice
+			inv, err = lastPaidInvoiceWithRetry(ctx, client, subscriptionID)
+			amounts, ok = meteredAmountsFromInvoice(inv, subscriptionItems)
+		}
+
+		if err != nil || !ok {
+			slog.Warn("Could not estimate metered MRR of subscription", "subscription_id", subscriptionID, "error", err)
+			continue
+		}
+
+		for currency, amount := range amounts {
+			estimate.Amounts[currency] += amount
+		}
+		estimate.Sources[source]++
+	}
+
+	return estimate
+}
+
+// upcomingInvoiceWithRetry retrieves the upcoming invoice of a subscription
+func upcomingInvoiceWithRetry(ctx context.Context, client *StripeClientWrapper, subscriptionID string) (*stripe.Invoice, error) {
+	var result *stripe.Invoice
+	err := client.ExecuteWithRetry(ctx, "upcomingInvoice", func() error {
+		params := &stripe.InvoiceUpcomingParams{Subscription: stripe.String(subscriptionID)}
+		params.Context = ctx
+
+		inv, err := invoice.Upcoming(params)
+		result = inv
+		return err
+	})
+	return result, err
+}
+
+// lastPaidInvoiceWithRetry retrieves the most recent paid invoice of a
+// subscription, returning nil when it has none
+func lastPaidInvoiceWithRetry(ctx context.Context, client *StripeClientWrapper, subscriptionID string) (*stripe.Invoice, error) {
+	var result *stripe.Invoice
+	err := client.ExecuteWithRetry(ctx, "lastPaidInvoice", func() error {
+		params := &stripe.InvoiceListParams{
+			Subscription: stripe.String(subscriptionID),
+			Status:       stripe.String(string(stripe.InvoiceStatusPaid)),
+		}
+		params.Limit = stripe.Int64(1)
+		params.Single = true
+		params.Context = ctx
+
+		result = nil
+		iter := invoice.List(params)
+		if iter.Next() {
+			result = iter.Invoice()
+		}
+
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list invoices: %w", err)
+		}
+
+		return nil
+	})
+	return result, err
+}
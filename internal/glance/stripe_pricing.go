@@ -0,0 +1,173 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/invoice"
+	"github.com/stripe/stripe-go/v81/price"
+)
+
+// itemPeriodAmount returns what a subscription item is billed per period, in
+// the smallest unit of its currency. Tiered prices are calculated from their
+// tiers, returning false when the tiers are missing or don't cover the quantity.
+func itemPeriodAmount(p *stripe.Price, quantity int64) (float64, bool) {
+	if p.BillingScheme != stripe.PriceBillingSchemeTiered {
+		unitAmount := float64(p.UnitAmount)
+		if p.UnitAmount == 0 && p.UnitAmountDecimal != 0 {
+			unitAmount = p.UnitAmountDecimal
+		}
+
+		return unitAmount * float64(quantity), true
+	}
+
+	if len(p.Tiers) == 0 {
+		return 0, false
+	}
+
+	switch p.TiersMode {
+	case stripe.PriceTiersModeVolume:
+		// Every unit is charged at the tier the total quantity falls in
+		for _, tier := range p.Tiers {
+			if tier.UpTo == 0 || quantity <= tier.UpTo {
+				return tierUnitAmount(tier)*float64(quantity) + tierFlatAmount(tier), true
+			}
+		}
+	case stripe.PriceTiersModeGraduated:
+		// Each tier charges the units that fall within it
+		total, billed := 0.0, int64(0)
+		for _, tier := range p.Tiers {
+			if billed >= quantity {
+				break
+			}
+
+			upTo := tier.UpTo
+			if upTo == 0 || upTo > quantity {
+				upTo = quantity
+			}
+
+			total += tierUnitAmount(tier)*float64(upTo-billed) + tierFlatAmount(tier)
+			billed = upTo
+		}
+
+		if billed >= quantity {
+			return total, true
+		}
+	}
+
+	return 0, false
+}
+
+func tierUnitAmount(tier *stripe.PriceTier) float64 {
+	if tier.UnitAmount == 0 && tier.UnitAmountDecimal != 0 {
+		return tier.UnitAmountDecimal
+	}
+
+	return float64(tier.UnitAmount)
+}
+
+func tierFlatAmount(tier *stripe.PriceTier) float64 {
+	if tier.FlatAmount == 0 && tier.FlatAmountDecimal != 0 {
+		return tier.FlatAmountDecimal
+	}
+
+	return float64(tier.FlatAmount)
+}
+
+// priceResolver looks up what Stripe leaves out of listed subscriptions: the
+// tiers of tiered prices, and as a last resort the upcoming invoice of a
+// subscription. Lookups are cached for the lifetime of the resolver, which is
+// a single MRR calculation.
+type priceResolver struct {
+	ctx      context.Context
+	prices   map[string]*stripe.Price
+	invoices map[string]*stripe.Invoice
+}
+
+func newPriceResolver(ctx context.Context) *priceResolver {
+	return &priceResolver{
+		ctx:      ctx,
+		prices:   make(map[string]*stripe.Price),
+		invoices: make(map[string]*stripe.Invoice),
+	}
+}
+
+// withTiers returns the price with its tiers expanded, or the price itself when
+// it isn't tiered or can't be retrieved
+func (r *priceResolver) withTiers(p *stripe.Price) *stripe.Price {
+	if p.BillingScheme != stripe.PriceBillingSchemeTiered || len(p.Tiers) > 0 || p.ID == "" {
+		return p
+	}
+
+	expanded, cached := r.prices[p.ID]
+	if !cached {
+		params := &stripe.PriceParams{}
+		params.Context = r.ctx
+		params.AddExpand("tiers")
+
+		var err error
+		expanded, err = price.Get(p.ID, params)
+		if err != nil {
+			slog.Warn("Failed to retrieve the tiers of a price", "price_id", p.ID, "error", err)
+			expanded = nil
+		}
+		r.prices[p.ID] = expanded
+	}
+
+	if expanded == nil {
+		return p
+	}
+
+	return expanded
+}
+
+// retrieve returns the price with its details and tiers, retrieving it when
+// only its ID is known, as for the items of subscription schedule phases, or
+// the price itself when it can't be retrieved
+func (r *priceResolver) retrieve(p *stripe.Price) *stripe.Price {
+	if p.Recurring != nil || p.ID == "" {
+		return r.withTiers(p)
+	}
+
+	retrieved, cached := r.prices[p.ID]
+	if !cached {
+		params := &stripe.PriceParams{}
+		params.Context = r.ctx
+		params.AddExpand("tiers")
+
+		var err error
+		retrieved, err = price.Get(p.ID, params)
+		if err != nil {
+			slog.Warn("Failed to retrieve a price", "price_id", p.ID, "error", err)
+			retrieved = nil
+		}
+		r.prices[p.ID] = retrieved
+	}
+
+	if retrieved == nil {
+		return p
+	}
+
+	return retrieved
+}
+
+// upcomingAmount returns what the upcoming invoice of a subscription charges
+// for an item's price, in the smallest unit of the invoice currency
+func (r *priceResolver) upcomingAmount(sub *stripe.Subscription, item *stripe.SubscriptionItem) (float64, bool) {
+	upcoming, cached := r.invoices[sub.ID]
+	if !cached {
+		params := &stripe.InvoiceUpcomingParams{Subscription: stripe.String(sub.ID)}
+		params.Context = r.ctx
+
+		var err error
+		upcoming, err = invoice.Upcoming(params)
+		if err != nil {
+			slog.Warn("Failed to retrieve the upcoming invoice of a subscription", "subscription_id", sub.ID, "error", err)
+			upcoming = nil
+		}
+		r.invoices[sub.ID] = upcoming
+	}
+
+	return invoicePriceAmount(upcoming, item.Price.ID)
+}
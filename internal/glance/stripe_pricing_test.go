@@ -0,0 +1,150 @@
+package glance
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestItemPeriodAmount(t *testing.T) {
+	tiered := func(mode stripe.PriceTiersMode, tiers ...*stripe.PriceTier) *stripe.Price {
+		return &stripe.Price{BillingScheme: stripe.PriceBillingSchemeTiered, TiersMode: mode, Tiers: tiers}
+	}
+
+	// 1-10 units at 10.00, 11-50 at 8.00 and everything above at 5.00
+	perUnitTiers := []*stripe.PriceTier{
+		{UpTo: 10, UnitAmount: 1000},
+		{UpTo: 50, UnitAmount: 800},
+		{UnitAmount: 500},
+	}
+
+	// A 49.00 base fee covering the first 5 seats, then 7.50 per seat
+	flatTiers := []*stripe.PriceTier{
+		{UpTo: 5, FlatAmount: 4900},
+		{UnitAmountDecimal: 750},
+	}
+
+	tests := []struct {
+		name       string
+		price      *stripe.Price
+		quantity   int64
+		expected   float64
+		expectedOK bool
+	}{
+		{name: "per unit", price: &stripe.Price{UnitAmount: 2500}, quantity: 3, expected: 7500, expectedOK: true},
+		{name: "per unit decimal", price: &stripe.Price{UnitAmountDecimal: 12.5}, quantity: 4, expected: 50, expectedOK: true},
+		{name: "volume in first tier", price: tiered(stripe.PriceTiersModeVolume, perUnitTiers...), quantity: 10, expected: 10000, expectedOK: true},
+		{name: "volume in middle tier", price: tiered(stripe.PriceTiersModeVolume, perUnitTiers...), quantity: 20, expected: 16000, expectedOK: true},
+		{name: "volume in last tier", price: tiered(stripe.PriceTiersModeVolume, perUnitTiers...), quantity: 60, expected: 30000, expectedOK: true},
+		{name: "graduated across tiers", price: tiered(stripe.PriceTiersModeGraduated, perUnitTiers...), quantity: 60, expected: 10000 + 32000 + 5000, expectedOK: true},
+		{name: "graduated in first tier", price: tiered(stripe.PriceTiersModeGraduated, perUnitTiers...), quantity: 4, expected: 4000, expectedOK: true},
+		{name: "graduated flat amount tier", price: tiered(stripe.PriceTiersModeGraduated, flatTiers...), quantity: 3, expected: 4900, expectedOK: true},
+		{name: "graduated flat amount and per unit tiers", price: tiered(stripe.PriceTiersModeGraduated, flatTiers...), quantity: 8, expected: 4900 + 2250, expectedOK: true},
+		{name: "volume flat amount tier", price: tiered(stripe.PriceTiersModeVolume, flatTiers...), quantity: 8, expected: 6000, expectedOK: true},
+		{name: "tiers not included", price: tiered(stripe.PriceTiersModeVolume), quantity: 8},
+		{name: "quantity above the last tier", price: tiered(stripe.PriceTiersModeGraduated, &stripe.PriceTier{UpTo: 10, UnitAmount: 100}), quantity: 11},
+		{name: "unknown tiers mode", price: tiered("", perUnitTiers...), quantity: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, ok := itemPeriodAmount(tt.price, tt.quantity)
+
+			if ok != tt.expectedOK {
+				t.Fatalf("expected ok %v, got %v", tt.expectedOK, ok)
+			}
+
+			if !floatEquals(amount, tt.expected, 0.001) {
+				t.Errorf("expected %v, got %v", tt.expected, amount)
+			}
+		})
+	}
+}
+
+func TestCurrencyAmounts_AddTieredSubscription(t *testing.T) {
+	amounts := make(currencyAmounts)
+	amounts.addSubscription(&stripe.Subscription{
+		Currency: "usd",
+		Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{
+			{
+				Quantity: 20,
+				Price: &stripe.Price{
+					BillingScheme: stripe.PriceBillingSchemeTiered,
+					TiersMode:     stripe.PriceTiersModeGraduated,
+					Tiers:         []*stripe.PriceTier{{UpTo: 10, UnitAmount: 1000}, {UnitAmount: 500}},
+					Recurring:     &stripe.PriceRecurring{Interval: "year", IntervalCount: 1},
+				},
+			},
+		}},
+	}, nil)
+
+	if !floatEquals(amounts["usd"], 12.5, 0.001) {
+		t.Errorf("expected 12.50 USD per month, got %v", amounts["usd"])
+	}
+}
+
+func TestMeteredAmountsFromInvoice(t *testing.T) {
+	metered := func(id string, interval stripe.PriceRecurringInterval) *stripe.Price {
+		return &stripe.Price{ID: id, Recurring: &stripe.PriceRecurring{Interval: interval, IntervalCount: 1, UsageType: stripe.PriceRecurringUsageTypeMetered}}
+	}
+
+	sub := &stripe.Subscription{
+		ID:       "sub_1",
+		Currency: "eur",
+		Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{
+			{Price: metered("price_api", "month")},
+			{Price: metered("price_storage", "year")},
+			{Quantity: 1, Price: &stripe.Price{ID: "price_base", UnitAmount: 1000, Recurring: &stripe.PriceRecurring{Interval: "month", IntervalCount: 1}}},
+		}},
+	}
+
+	items := meteredItems(sub)
+	if len(items) != 2 || items[0].Currency != "eur" {
+		t.Fatalf("expected the 2 metered items in eur, got %+v", items)
+	}
+
+	amounts := make(currencyAmounts)
+	amounts.addSubscription(sub, nil)
+	if len(amounts) != 1 || amounts["eur"] != 10 {
+		t.Errorf("expected metered items to be left out of the fixed MRR, got %v", amounts)
+	}
+
+	inv := &stripe.Invoice{
+		Currency: "eur",
+		Lines: &stripe.InvoiceLineItemList{Data: []*stripe.InvoiceLineItem{
+			{Amount: 4500, Price: &stripe.Price{ID: "price_api"}},
+			{Amount: 500, Price: &stripe.Price{ID: "price_api"}},
+			{Amount: 2000, Price: &stripe.Price{ID: "price_api"}, Proration: true},
+			{Amount: 24000, Price: &stripe.Price{ID: "price_storage"}},
+			{Amount: 1000, Price: &stripe.Price{ID: "price_base"}},
+		}},
+	}
+
+	estimated, ok := meteredAmountsFromInvoice(inv, items)
+	if !ok || !floatEquals(estimated["eur"], 50+20, 0.001) {
+		t.Errorf("expected 70 eur per month, got %v, %v", estimated, ok)
+	}
+
+	if _, ok := meteredAmountsFromInvoice(&stripe.Invoice{Lines: &stripe.InvoiceLineItemList{}}, items); ok {
+		t.Error("expected an invoice without metered lines not to give an estimate")
+	}
+}
+
+func TestMeteredEstimateSource(t *testing.T) {
+	tests := []struct {
+		sources  map[string]int
+		expected string
+	}{
+		{sources: map[string]int{meteredSourceUpcoming: 2}, expected: "upcoming invoices"},
+		{sources: map[string]int{meteredSourceLastInvoice: 1}, expected: "last invoices"},
+		{sources: map[string]int{meteredSourceUpcoming: 1, meteredSourceLastInvoice: 1}, expected: "upcoming and last invoices"},
+		{sources: map[string]int{}, expected: ""},
+	}
+
+	for _, tt := range tests {
+		estimate := &meteredEstimate{Sources: tt.sources}
+		if source := estimate.source(); source != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, source)
+		}
+	}
+}
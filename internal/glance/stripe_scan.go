@@ -0,0 +1,268 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/subscription"
+)
+
+// subscriptionScanTTL is how long the subscriptions listed for an update are
+// reused by the updates of other widgets of the same account and mode, unless
+// the widgets using them are cached for longer, see subscriptionScanEntry
+const subscriptionScanTTL = time.Minute
+
+// subscriptionLister lists the subscriptions of an account for scans, and
+// the canceled subscriptions of customers to tell reactivations apart
+type subscriptionLister interface {
+	canceledSubscriptionLister
+	listSubscriptions(params *stripe.SubscriptionListParams) ([]*stripe.Subscription, error)
+}
+
+// stripeSubscriptionLister lists subscriptions from Stripe
+type stripeSubscriptionLister struct {
+	stripeCanceledSubscriptionLister
+}
+
+func (stripeSubscriptionLister) listSubscriptions(params *stripe.SubscriptionListParams) ([]*stripe.Subscription, error) {
+	var subs []*stripe.Subscription
+	iter := subscription.List(params)
+	for iter.Next() {
+		subs = append(subs, iter.Subscription())
+	}
+
+	return subs, iter.Err()
+}
+
+// subscriptionScan holds the subscriptions of an account listed once and
+// shared between the revenue and customers widgets: every subscription that
+// isn't canceled, and the ones canceled since the start of the month. MRR,
+// new, churned, trialing and at risk MRR and the active and churned customers
+// are all derived from it.
+type subscriptionScan struct {
+	Current  []*stripe.Subscription
+	Canceled []*stripe.Subscription
+	// Start of the month the canceled subscriptions are listed from, in the
+	// time zone of the widget that listed them
+	StartOfMonth time.Time
+	// Subscriptions canceled before the start of the month, since
+	// CanceledSince, for churn windows reaching into the previous month
+	EarlierCanceled []*stripe.Subscription
+	CanceledSince   time.Time
+	listedAt        time.Time
+
+	// Shared by the copies of the scan filtered by widgets, see reactivations
+	reactivationCheck *reactivationChecker
+}
+
+// reactivations returns the reactivation checker of the scan, shared by the
+// widgets using it so that each customer is looked up once per scan. Scans
+// not listed by listSubscriptionScan look customers up on every call.
+func (s *subscriptionScan) reactivations() *reactivationChecker {
+	if s.reactivationCheck == nil {
+		return newReactivationChecker(stripeCanceledSubscriptionLister{})
+	}
+
+	return s.reactivationCheck
+}
+
+// withStatus calls fn for each current subscription with one of statuses
+func (s *subscriptionScan) withStatus(fn func(sub *stripe.Subscription), statuses ...stripe.SubscriptionStatus) {
+	for _, sub := range s.Current {
+		for _, status := range statuses {
+			if sub.Status == status {
+				fn(sub)
+				break
+			}
+		}
+	}
+}
+
+// canceledSince returns the subscriptions canceled since t, which must not be
+// before CanceledSince
+func (s *subscriptionScan) canceledSince(t time.Time) []*stripe.Subscription {
+	if t.After(s.StartOfMonth) {
+		return canceledAtOrAfter(s.Canceled, t)
+	}
+
+	return append(canceledAtOrAfter(s.EarlierCanceled, t), s.Canceled...)
+}
+
+func canceledAtOrAfter(subs []*stripe.Subscription, t time.Time) []*stripe.Subscription {
+	var canceled []*stripe.Subscription
+	for _, sub := range subs {
+		if sub.CanceledAt >= t.Unix() {
+			canceled = append(canceled, sub)
+		}
+	}
+
+	return canceled
+}
+
+// subscriptionScanEntry is the latest scan of an account and mode. Its lock
+// is held while listing, so that widgets updating at the same time wait for
+// a single scan rather than each listing the subscriptions, and share its
+// error when listing failed.
+type subscriptionScanEntry struct {
+	mu   sync.Mutex
+	scan *subscriptionScan
+	// How long the scan is reused, the shortest cache duration of the widgets
+	// using it
+	ttl time.Duration
+	// Number of listings finished, and the error of the last one
+	listings atomic.Uint64
+	err      error
+}
+
+// useTTL shortens how long the scan is reused to the cache duration of a
+// widget using it. Must be called with the lock held.
+func (e *subscriptionScanEntry) useTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = subscriptionScanTTL
+	}
+
+	if e.ttl == 0 || ttl < e.ttl {
+		e.ttl = ttl
+	}
+}
+
+// get returns the scan when it was listed within the TTL in the same month,
+// listing the subscriptions with list otherwise. Updates that waited for
+// another update's listing to finish get its error rather than listing again.
+func (e *subscriptionScanEntry) get(now time.Time, ttl time.Duration, startOfMonth, canceledSince time.Time, list func() (*subscriptionScan, error)) (*subscriptionScan, error) {
+	started := e.listings.Load()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.listings.Load() != started && e.err != nil {
+		return nil, e.err
+	}
+
+	e.useTTL(ttl)
+	if scan := e.scan; scan != nil && now.Sub(scan.listedAt) < e.ttl && scan.StartOfMonth.Equal(startOfMonth) && !scan.CanceledSince.After(canceledSince) {
+		return scan, nil
+	}
+
+	scan, err := list()
+	e.err = err
+	e.listings.Add(1)
+	if err != nil {
+		return nil, err
+	}
+
+	e.scan = scan
+	return scan, nil
+}
+
+type subscriptionScanCache struct {
+	mu      sync.Mutex
+	entries map[string]*subscriptionScanEntry
+}
+
+var subscriptionScans = &subscriptionScanCache{entries: make(map[string]*subscriptionScanEntry)}
+
+// entry returns the scan entry of an account and mode. Widgets in different
+// time zones have their own, as they list the canceled subscriptions of
+// different months.
+func (c *subscriptionScanCache) entry(apiKey, mode string, location *time.Location) *subscriptionScanEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := mode + ":" + location.String() + ":" + apiKey
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &subscriptionScanEntry{}
+		c.entries[key] = entry
+	}
+
+	return entry
+}
+
+// invalidate drops every scan, for the next update to list the subscriptions
+// again after a webhook reported a change
+func (c *subscriptionScanCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+}
+
+// scanSubscriptions returns the subscriptions of the account of client,
+// listing them unless another update did within subscriptionScanTTL in the
+// same month. Months start in the time zone of now.
+func scanSubscriptions(ctx context.Context, client *StripeClientWrapper, now time.Time) (*subscriptionScan, error) {
+	return scanSubscriptionsCanceledSince(ctx, client, now, bucketStart(now, MetricsBucketMonth), subscriptionScanTTL)
+}
+
+// scanSubscriptionsCanceledSince is scanSubscriptions also listing the
+// subscriptions canceled since canceledSince when that's before the start of
+// the month. A scan listing them since earlier is reused, for up to the
+// shortest ttl, the cache duration, of the widgets using the scan.
+func scanSubscriptionsCanceledSince(ctx context.Context, client *StripeClientWrapper, now, canceledSince time.Time, ttl time.Duration) (*subscriptionScan, error) {
+	entry := subscriptionScans.entry(client.apiKey, client.mode, now.Location())
+
+	startOfMonth := bucketStart(now, MetricsBucketMonth)
+	if canceledSince.After(startOfMonth) {
+		canceledSince = startOfMonth
+	}
+
+	return entry.get(now, ttl, startOfMonth, canceledSince, func() (*subscriptionScan, error) {
+		return listSubscriptionScan(ctx, client, now, startOfMonth, canceledSince)
+	})
+}
+
+// listSubscriptionScan lists the subscriptions that aren't canceled and the
+// ones canceled since canceledSince
+func listSubscriptionScan(ctx context.Context, client *StripeClientWrapper, now, startOfMonth, canceledSince time.Time) (*subscriptionScan, error) {
+	scan := &subscriptionScan{
+		StartOfMonth:      startOfMonth,
+		CanceledSince:     canceledSince,
+		listedAt:          now,
+		reactivationCheck: newReactivationChecker(client.subscriptions),
+	}
+	err := client.ExecuteWithRetry(ctx, "scanSubscriptions", func() error {
+		scan.Current, scan.Canceled, scan.EarlierCanceled = nil, nil, nil
+
+		// Without a status Stripe lists every subscription that isn't canceled
+		params := newMRRSubscriptionListParams(ctx, "")
+		// The phases of schedules tell how MRR changes once the current one ends
+		params.AddExpand("data.schedule")
+		// For widgets to exclude the subscriptions of test clock and flagged
+		// customers
+		params.AddExpand("data.customer")
+
+		current, err := client.subscriptions.listSubscriptions(params)
+		if err != nil {
+			return fmt.Errorf("failed to list subscriptions: %w", err)
+		}
+		scan.Current = current
+
+		params = newMRRSubscriptionListParams(ctx, string(stripe.SubscriptionStatusCanceled))
+		params.Filters.AddFilter("canceled_at", "gte", fmt.Sprintf("%d", canceledSince.Unix()))
+		params.AddExpand("data.customer")
+
+		canceled, err := client.subscriptions.listSubscriptions(params)
+		if err != nil {
+			return fmt.Errorf("failed to list canceled subscriptions: %w", err)
+		}
+
+		for _, sub := range canceled {
+			if sub.CanceledAt < startOfMonth.Unix() {
+				scan.EarlierCanceled = append(scan.EarlierCanceled, sub)
+			} else {
+				scan.Canceled = append(scan.Canceled, sub)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scan, nil
+}
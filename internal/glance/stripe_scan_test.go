@@ -0,0 +1,249 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestSubscriptionScan_DerivedMetrics(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	startOfMonth := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	sub := func(customer string, status stripe.SubscriptionStatus, amount int64, created time.Time) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       "sub_" + customer + "_" + string(status),
+			Customer: &stripe.Customer{ID: customer},
+			Status:   status,
+			Created:  created.Unix(),
+			Currency: "usd",
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price: &stripe.Price{
+					ID:         "price_1",
+					Currency:   "usd",
+					UnitAmount: amount,
+					Recurring:  &stripe.PriceRecurring{Interval: "month", IntervalCount: 1},
+				},
+			}}},
+		}
+	}
+
+	earlier := now.AddDate(0, -3, 0)
+	scan := &subscriptionScan{
+		Current: []*stripe.Subscription{
+			sub("cus_1", stripe.SubscriptionStatusActive, 1000, earlier),
+			sub("cus_1", stripe.SubscriptionStatusActive, 500, now),
+			sub("cus_2", stripe.SubscriptionStatusActive, 2000, now),
+			sub("cus_3", stripe.SubscriptionStatusTrialing, 3000, now),
+			sub("cus_4", stripe.SubscriptionStatusPastDue, 4000, earlier),
+			sub("cus_5", stripe.SubscriptionStatusIncomplete, 5000, now),
+		},
+		Canceled: []*stripe.Subscription{
+			sub("cus_6", stripe.SubscriptionStatusCanceled, 700, earlier),
+			sub("cus_6", stripe.SubscriptionStatusCanceled, 300, earlier),
+		},
+		StartOfMonth: startOfMonth,
+		// None of the customers canceled before
+		reactivationCheck: newReactivationChecker(&fakeCanceledSubscriptionLister{}),
+	}
+
+	tests := []struct {
+		name     string
+		widget   *revenueWidget
+		mrr      float64
+		newMRR   float64
+		trialing float64
+		atRisk   float64
+	}{
+		{"active only", &revenueWidget{}, 35, 25, 30, 40},
+		{"trials counted as new", &revenueWidget{IncludeTrialing: true}, 35, 55, 30, 40},
+		{"past due counted as active", &revenueWidget{CountPastDueAsActive: true}, 75, 25, 30, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := newPriceResolver(ctx)
+
+			if got := tt.widget.calculateMRR(scan, resolver, now).Totals["usd"]; !floatEquals(got, tt.mrr, 0.001) {
+				t.Errorf("expected MRR %v, got %v", tt.mrr, got)
+			}
+
+			newMRR, err := tt.widget.calculateNewMRR(ctx, scan, resolver)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := newMRR.Amounts["usd"]; !floatEquals(got, tt.newMRR, 0.001) {
+				t.Errorf("expected new MRR %v, got %v", tt.newMRR, got)
+			}
+
+			if got := tt.widget.calculateTrialingMRR(scan, resolver)["usd"]; !floatEquals(got, tt.trialing, 0.001) {
+				t.Errorf("expected trialing MRR %v, got %v", tt.trialing, got)
+			}
+
+			if got := tt.widget.calculateAtRiskMRR(scan, resolver).Amounts["usd"]; !floatEquals(got, tt.atRisk, 0.001) {
+				t.Errorf("expected MRR at risk %v, got %v", tt.atRisk, got)
+			}
+
+			if got := calculateChurnedMRR(scan.Canceled, resolver)["usd"]; !floatEquals(got, 10, 0.001) {
+				t.Errorf("expected churned MRR 10, got %v", got)
+			}
+		})
+	}
+
+	if got := countActiveCustomers(scan); got != 2 {
+		t.Errorf("expected 2 active customers, got %d", got)
+	}
+
+	if got := countChurnedCustomers(scan, scan.Canceled); got != 1 {
+		t.Errorf("expected 1 churned customer, got %d", got)
+	}
+}
+
+// fakeSubscriptionLister lists fixed subscriptions instead of the ones of a
+// Stripe account, and counts the listings
+type fakeSubscriptionLister struct {
+	fakeCanceledSubscriptionLister
+	current  []*stripe.Subscription
+	canceled []*stripe.Subscription
+	listings atomic.Int32
+}
+
+func (l *fakeSubscriptionLister) listSubscriptions(params *stripe.SubscriptionListParams) ([]*stripe.Subscription, error) {
+	l.listings.Add(1)
+	if params.Status != nil && *params.Status == string(stripe.SubscriptionStatusCanceled) {
+		return l.canceled, nil
+	}
+
+	return l.current, nil
+}
+
+// newFakeStripeClient returns a test mode client listing the subscriptions of
+// lister
+func newFakeStripeClient(apiKey string, lister subscriptionLister) *StripeClientWrapper {
+	client := newStripeClientWrapper(apiKey, "test")
+	client.subscriptions = lister
+	return client
+}
+
+func TestScanSubscriptions_SharedWithinTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 31, 23, 59, 0, 0, time.UTC)
+
+	lister := &fakeSubscriptionLister{}
+	client := newFakeStripeClient("sk_test_shared_scan", lister)
+	other := newFakeStripeClient("sk_test_other_scan", &fakeSubscriptionLister{})
+
+	defer subscriptionScans.invalidate()
+
+	first, err := scanSubscriptions(ctx, client, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if again, _ := scanSubscriptions(ctx, client, now.Add(30*time.Second)); again != first || lister.listings.Load() != 2 {
+		t.Errorf("expected the scan to be shared within the TTL, got %d listings", lister.listings.Load())
+	}
+
+	if scan, _ := scanSubscriptions(ctx, other, now); scan == first {
+		t.Error("expected another API key to have its own scan")
+	}
+
+	// The canceled subscriptions of a scan are of the month it was listed in
+	if scan, _ := scanSubscriptions(ctx, client, now.Add(2*time.Minute)); scan == first || !scan.StartOfMonth.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected the subscriptions to be listed again once the scan expired")
+	}
+
+	latest, _ := scanSubscriptions(ctx, client, now.Add(2*time.Minute))
+	subscriptionScans.invalidate()
+	if scan, _ := scanSubscriptions(ctx, client, now.Add(2*time.Minute)); scan == latest {
+		t.Error("expected the subscriptions to be listed again after invalidation")
+	}
+}
+
+func TestSubscriptionScanEntry_ShortestWidgetTTL(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+	startOfMonth := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	entry := &subscriptionScanEntry{}
+	listings := 0
+	list := func(at time.Time) func() (*subscriptionScan, error) {
+		return func() (*subscriptionScan, error) {
+			listings++
+			return &subscriptionScan{StartOfMonth: startOfMonth, CanceledSince: startOfMonth, listedAt: at}, nil
+		}
+	}
+
+	first, _ := entry.get(now, time.Hour, startOfMonth, startOfMonth, list(now))
+	if scan, _ := entry.get(now.Add(40*time.Minute), time.Hour, startOfMonth, startOfMonth, list(now.Add(40*time.Minute))); scan != first || listings != 1 {
+		t.Errorf("expected the scan to be reused within the cache duration of the widgets, got %d listings", listings)
+	}
+
+	// A widget cached for 10 minutes shortens how long the scan is reused
+	if scan, _ := entry.get(now.Add(45*time.Minute), 10*time.Minute, startOfMonth, startOfMonth, list(now.Add(45*time.Minute))); scan == first || listings != 2 {
+		t.Errorf("expected the subscriptions to be listed again, got %d listings", listings)
+	}
+
+	if entry.ttl != 10*time.Minute {
+		t.Errorf("expected a TTL of 10 minutes, got %v", entry.ttl)
+	}
+}
+
+func TestSubscriptionScanEntry_ConcurrentUpdatesShareOneListing(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+	startOfMonth := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, failing := range []bool{false, true} {
+		entry := &subscriptionScanEntry{}
+		release := make(chan struct{})
+		var listings atomic.Int32
+		list := func() (*subscriptionScan, error) {
+			listings.Add(1)
+			<-release
+			if failing {
+				return nil, errors.New("rate limited")
+			}
+			return &subscriptionScan{StartOfMonth: startOfMonth, CanceledSince: startOfMonth, listedAt: now}, nil
+		}
+
+		var wg sync.WaitGroup
+		results := make([]*subscriptionScan, 5)
+		errs := make([]error, 5)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = entry.get(now, time.Hour, startOfMonth, startOfMonth, list)
+			}()
+		}
+
+		// Let every update queue up behind the first listing
+		for listings.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := listings.Load(); got != 1 {
+			t.Errorf("failing %v: expected a single listing, got %d", failing, got)
+		}
+
+		for i := range results {
+			if failing && errs[i] == nil {
+				t.Errorf("expected update %d to share the error of the listing", i)
+			}
+			if !failing && (errs[i] != nil || results[i] != results[0]) {
+				t.Errorf("expected update %d to share the scan, got %v", i, errs[i])
+			}
+		}
+	}
+}
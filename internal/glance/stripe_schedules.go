@@ -0,0 +1,64 @@
+package glance
+
+import (
+	"github.com/stripe/stripe-go/v81"
+)
+
+// upcomingSchedulePhase returns the phase a subscription schedule moves to
+// once its current phase ends, or nil when the schedule ends with the current
+// phase, hasn't started or wasn't expanded
+func upcomingSchedulePhase(schedule *stripe.SubscriptionSchedule) *stripe.SubscriptionSchedulePhase {
+	if schedule == nil || schedule.CurrentPhase == nil || schedule.CurrentPhase.EndDate == 0 {
+		return nil
+	}
+
+	for _, phase := range schedule.Phases {
+		if phase != nil && phase.StartDate >= schedule.CurrentPhase.EndDate {
+			return phase
+		}
+	}
+
+	return nil
+}
+
+// scheduledMRRChange returns how the MRR of a subscription changes per
+// currency when its schedule moves to the next phase, given the MRR of its
+// current items. Returns false without an upcoming phase. The next phase is
+// priced like the current items, with the discounts of the subscription as
+// they apply now.
+func scheduledMRRChange(sub *stripe.Subscription, current []itemMRR, resolver *priceResolver) (currencyAmounts, bool) {
+	phase := upcomingSchedulePhase(sub.Schedule)
+	if phase == nil {
+		return nil, false
+	}
+
+	items := make([]*stripe.SubscriptionItem, 0, len(phase.Items))
+	for _, item := range phase.Items {
+		if item == nil || item.Price == nil {
+			continue
+		}
+
+		price := item.Price
+		if resolver != nil {
+			price = resolver.retrieve(price)
+		}
+
+		items = append(items, &stripe.SubscriptionItem{Price: price, Quantity: item.Quantity})
+	}
+
+	next := *sub
+	next.Items = &stripe.SubscriptionItemList{Data: items}
+	next.Schedule = nil
+	upcoming, _ := subscriptionItemsMRR(&next, resolver)
+
+	change := make(currencyAmounts)
+	for _, item := range current {
+		change[item.Currency] -= item.Amount
+	}
+
+	for _, item := range upcoming {
+		change[item.Currency] += item.Amount
+	}
+
+	return change, true
+}
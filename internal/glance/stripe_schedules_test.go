@@ -0,0 +1,104 @@
+package glance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestActiveMRR_ScheduledPhases(t *testing.T) {
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	phaseEnd := now.AddDate(0, 1, 0).Unix()
+
+	monthly := func(amount int64) *stripe.Price {
+		return &stripe.Price{
+			ID:         fmt.Sprintf("price_%d", amount),
+			Currency:   "usd",
+			UnitAmount: amount,
+			Recurring:  &stripe.PriceRecurring{Interval: "month", IntervalCount: 1},
+		}
+	}
+
+	sub := func(id string, amount int64, schedule *stripe.SubscriptionSchedule) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       id,
+			Customer: &stripe.Customer{ID: "cus_" + id},
+			Currency: "usd",
+			Schedule: schedule,
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price:    monthly(amount),
+			}}},
+		}
+	}
+
+	schedule := func(phases ...*stripe.SubscriptionSchedulePhase) *stripe.SubscriptionSchedule {
+		return &stripe.SubscriptionSchedule{
+			CurrentPhase: &stripe.SubscriptionScheduleCurrentPhase{StartDate: now.AddDate(0, -1, 0).Unix(), EndDate: phaseEnd},
+			Phases:       phases,
+		}
+	}
+
+	current := &stripe.SubscriptionSchedulePhase{StartDate: now.AddDate(0, -1, 0).Unix(), EndDate: phaseEnd}
+	next := func(amount, quantity int64) *stripe.SubscriptionSchedulePhase {
+		return &stripe.SubscriptionSchedulePhase{
+			StartDate: phaseEnd,
+			Items:     []*stripe.SubscriptionSchedulePhaseItem{{Price: monthly(amount), Quantity: quantity}},
+		}
+	}
+
+	mrr := newActiveMRR()
+	mrr.addSubscription(sub("sub_downgrade", 5000, schedule(current, next(3000, 1))), nil, false, now)
+	mrr.addSubscription(sub("sub_upgrade", 2000, schedule(current, next(2000, 2))), nil, false, now)
+	mrr.addSubscription(sub("sub_unchanged", 1000, schedule(current, next(1000, 1))), nil, false, now)
+	mrr.addSubscription(sub("sub_last_phase", 4000, schedule(current)), nil, false, now)
+	mrr.addSubscription(sub("sub_no_schedule", 6000, nil), nil, false, now)
+
+	if !floatEquals(mrr.Scheduled["usd"], 0, 0.001) {
+		t.Errorf("expected the downgrade and upgrade to cancel out, got %v", mrr.Scheduled["usd"])
+	}
+
+	if mrr.ScheduledSubscriptions != 2 {
+		t.Errorf("expected 2 subscriptions with a scheduled change, got %d", mrr.ScheduledSubscriptions)
+	}
+
+	mrr = newActiveMRR()
+	mrr.addSubscription(sub("sub_downgrade", 5000, schedule(current, next(3000, 1))), nil, false, now)
+	if !floatEquals(mrr.Scheduled["usd"], -20, 0.001) {
+		t.Errorf("expected a scheduled change of -20, got %v", mrr.Scheduled["usd"])
+	}
+
+	if !floatEquals(mrr.Totals["usd"], 50, 0.001) {
+		t.Errorf("expected current MRR of 50 until the phase changes, got %v", mrr.Totals["usd"])
+	}
+}
+
+func TestUpcomingSchedulePhase(t *testing.T) {
+	phases := []*stripe.SubscriptionSchedulePhase{
+		{StartDate: 100, EndDate: 200},
+		{StartDate: 200, EndDate: 300},
+		{StartDate: 300},
+	}
+
+	tests := []struct {
+		name     string
+		schedule *stripe.SubscriptionSchedule
+		expected *stripe.SubscriptionSchedulePhase
+	}{
+		{"not expanded", nil, nil},
+		{"not started", &stripe.SubscriptionSchedule{Phases: phases}, nil},
+		{"first phase", &stripe.SubscriptionSchedule{CurrentPhase: &stripe.SubscriptionScheduleCurrentPhase{StartDate: 100, EndDate: 200}, Phases: phases}, phases[1]},
+		{"middle phase", &stripe.SubscriptionSchedule{CurrentPhase: &stripe.SubscriptionScheduleCurrentPhase{StartDate: 200, EndDate: 300}, Phases: phases}, phases[2]},
+		{"open ended phase", &stripe.SubscriptionSchedule{CurrentPhase: &stripe.SubscriptionScheduleCurrentPhase{StartDate: 300}, Phases: phases}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upcomingSchedulePhase(tt.schedule); got != tt.expected {
+				t.Errorf("expected phase %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/stripe/stripe-go/v81"
@@ -16,12 +17,59 @@ import (
 
 // WebhookHandler handles Stripe webhook events for real-time updates
 type WebhookHandler struct {
-	secret         string
+	secrets        []webhookSecret
 	eventHandlers  map[string][]EventHandlerFunc
 	mu             sync.RWMutex
 	eventLog       []WebhookEvent
 	maxEventLog    int
 	cacheInvalidator CacheInvalidator
+	invalidations  []webhookInvalidation // in addition to the built-in ones
+	rejectedEvents atomic.Int64 // deliveries no secret verified
+
+	// How signatures are verified and why deliveries were rejected, see
+	// webhook_secrets.go
+	verifyOptions    webhook.ConstructEventOptions
+	rejectionReasons map[string]int
+
+	// Signatures aren't checked at all, see webhook_insecure.go
+	skipVerify bool
+
+	// Keeps a longer event log than eventLog when set, see webhook_event_log.go
+	eventStore *SimpleMetricsDB
+
+	// Stripe object IDs are redacted from the events listed, see webhook_auth.go
+	redactIDs bool
+
+	// Creation time of the latest event applied per object, see
+	// webhook_ordering.go
+	objectVersions map[string]int64
+	objectOrder    []string
+
+	// Processes events when set, see webhook_workers.go
+	workers *webhookWorkerPool
+
+	// Events are processed before Stripe is answered in sync mode, and the
+	// handlers that failed run again on redelivery, see webhook_processing.go
+	processing      string
+	redeliveries    map[string]webhookRetry
+	redeliveryOrder []string
+
+	// Counters for /api/metrics, see webhook_metrics.go
+	metrics webhookMetrics
+
+	// Modes events are processed from, all when nil, see webhook_modes.go
+	acceptedModes       []string
+	acceptedModesReason string
+	filteredEvents      map[string]int
+
+	// Failed handlers are retried, see webhook_retry.go
+	maxAttempts    int
+	retryBaseDelay time.Duration
+	pendingRetries atomic.Int64
+	retryTimers    map[*webhookRetry]*time.Timer // waiting for their backoff
+	retriesStopped bool
+	maxDeadLetters int
+	deadLetters    []*webhookDeadLetter // oldest first, see webhook_dead_letter.go
 }
 
 // EventHandlerFunc is a function that handles a Stripe webhook event
@@ -31,9 +79,47 @@ type EventHandlerFunc func(ctx context.Context, event stripe.Event) error
 type WebhookEvent struct {
 	ID        string    `json:"id"`
 	Type      string    `json:"type"`
+	Mode      string    `json:"mode"`
 	Processed time.Time `json:"processed"`
 	Success   bool      `json:"success"`
 	Error     string    `json:"error,omitempty"`
+	Duplicate bool      `json:"duplicate"`          // redelivery of an event already processed, skipped
+	Replayed  bool      `json:"replayed"`           // processed again on request, see webhook_replay.go
+	Stale     bool      `json:"stale"`              // older than an event already applied to its object, skipped
+	Attempts  int       `json:"attempts,omitempty"` // runs of the handlers, when they were retried
+}
+
+// WebhookReceivedResponse acknowledges a webhook delivery to Stripe
+type WebhookReceivedResponse struct {
+	Received bool   `json:"received"`
+	EventID  string `json:"event_id"`
+}
+
+// WebhookStatusResponse is the response of the webhook status endpoint
+type WebhookStatusResponse struct {
+	// Counts of the logged events matching the type, success and since
+	// parameters, of which recent_events is a page
+	TotalEvents        int               `json:"total_events"`
+	FailedEvents       int               `json:"failed_events"`
+	DuplicateEvents    int               `json:"duplicate_events"`
+	EventsByType       map[string]int    `json:"events_by_type"`
+	RecentEvents       []WebhookEvent    `json:"recent_events"` // newest first
+	Limit              int               `json:"limit"`
+	Offset             int               `json:"offset"`
+	RejectedEvents     int               `json:"rejected_events"` // deliveries whose signature no secret verified
+	RejectionReasons   map[string]int    `json:"rejection_reasons"`
+	ModeFilter         WebhookModeFilter `json:"mode_filter"`
+	PendingRetries     int               `json:"pending_retries"`
+	Processing         string            `json:"processing"`          // sync or async, see webhook_processing.go
+	AwaitingRedelivery int               `json:"awaiting_redelivery"` // events whose handlers failed in sync mode
+	DeadLetters        []WebhookEvent    `json:"dead_letters"`        // events whose handlers failed every attempt
+}
+
+// WebhookEventsResponse is the response of the webhook events log endpoint
+type WebhookEventsResponse struct {
+	Events     []WebhookEvent `json:"events"`
+	Count      int            `json:"count"`
+	Duplicates int            `json:"duplicates"`
 }
 
 // CacheInvalidator is an interface for invalidating widget caches
@@ -41,33 +127,34 @@ type CacheInvalidator interface {
 	InvalidateCache(widgetType string) error
 }
 
-var (
-	globalWebhookHandler *WebhookHandler
-	webhookHandlerOnce   sync.Once
-)
-
-// GetWebhookHandler returns the global webhook handler (singleton)
-func GetWebhookHandler(secret string, invalidator CacheInvalidator) *WebhookHandler {
-	webhookHandlerOnce.Do(func() {
-		globalWebhookHandler = &WebhookHandler{
-			secret:           secret,
-			eventHandlers:    make(map[string][]EventHandlerFunc),
-			eventLog:         make([]WebhookEvent, 0, 100),
-			maxEventLog:      100,
-			cacheInvalidator: invalidator,
-		}
-
-		// Register default event handlers
-		globalWebhookHandler.RegisterHandler("customer.subscription.created", handleSubscriptionCreated)
-		globalWebhookHandler.RegisterHandler("customer.subscription.updated", handleSubscriptionUpdated)
-		globalWebhookHandler.RegisterHandler("customer.subscription.deleted", handleSubscriptionDeleted)
-		globalWebhookHandler.RegisterHandler("customer.created", handleCustomerCreated)
-		globalWebhookHandler.RegisterHandler("customer.deleted", handleCustomerDeleted)
-		globalWebhookHandler.RegisterHandler("invoice.payment_succeeded", handleInvoicePaymentSucceeded)
-		globalWebhookHandler.RegisterHandler("invoice.payment_failed", handleInvoicePaymentFailed)
-	})
+// newWebhookHandler returns a webhook handler verifying events with secrets,
+// with the default event handlers registered
+func newWebhookHandler(secrets []webhookSecret, invalidator CacheInvalidator) *WebhookHandler {
+	handler := &WebhookHandler{
+		secrets:          secrets,
+		eventHandlers:    make(map[string][]EventHandlerFunc),
+		eventLog:         make([]WebhookEvent, 0, 100),
+		maxEventLog:      100,
+		cacheInvalidator: invalidator,
+		maxAttempts:      defaultWebhookMaxAttempts,
+		retryBaseDelay:   webhookRetryBaseDelay,
+	}
 
-	return globalWebhookHandler
+	// Register default event handlers
+	handler.RegisterHandler("customer.subscription.created", handleSubscriptionCreated)
+	handler.RegisterHandler("customer.subscription.updated", handleSubscriptionUpdated)
+	handler.RegisterHandler("customer.subscription.deleted", handleSubscriptionDeleted)
+	handler.RegisterHandler("customer.created", handleCustomerCreated)
+	handler.RegisterHandler("customer.deleted", handleCustomerDeleted)
+	handler.RegisterHandler("invoice.payment_succeeded", handleInvoicePaymentSucceeded)
+	handler.RegisterHandler("invoice.payment_failed", handleInvoicePaymentFailed)
+	handler.RegisterHandler("charge.refunded", handleChargeRefunded)
+	handler.RegisterHandler("checkout.session.completed", handleCheckoutSessionCompleted)
+	handler.RegisterHandler("customer.subscription.trial_will_end", handleTrialWillEnd)
+	handler.RegisterHandler("invoice.marked_uncollectible", handleInvoiceMarkedUncollectible)
+	handler.RegisterHandler("payment_method.detached", handlePaymentMethodDetached)
+
+	return handler
 }
 
 // RegisterHandler registers a handler for a specific event type
@@ -96,11 +183,27 @@ func (wh *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Verify signature
+	// Verify signature against the secret of each endpoint
 	signature := r.Header.Get("Stripe-Signature")
-	event, err := webhook.ConstructEvent(payload, signature, wh.secret)
-	if err != nil {
-		slog.Error("Failed to verify webhook signature", "error", err)
+	wh.mu.RLock()
+	options, skipVerify, processing := wh.verifyOptions, wh.skipVerify, wh.processing
+	wh.mu.RUnlock()
+
+	var event stripe.Event
+	if skipVerify {
+		event, err = parseUnverifiedWebhookEvent(payload)
+		if err != nil {
+			wh.countRejection(webhookRejectedInvalidPayload)
+			slog.Error("Failed to parse unverified webhook event", "error", err)
+			http.Error(w, "Invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		slog.Warn("Accepted webhook event without verifying its signature, stripe-webhook insecure-skip-verify is set", "event_id", event.ID, "event_type", event.Type)
+	} else if event, err = constructWebhookEvent(payload, signature, wh.secrets, options); err != nil {
+		reason := webhookRejectionReason(err)
+		wh.countRejection(reason)
+		slog.Error("Failed to verify webhook signature", "reason", reason, "secrets", len(wh.secrets), "error", err)
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
 		return
 	}
@@ -110,79 +213,154 @@ func (wh *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request)
 		"event_type", event.Type,
 		"livemode", event.Livemode)
 
-	// Process event asynchronously
-	go wh.processEvent(event)
+	// Acknowledged so that Stripe doesn't retry it
+	if !wh.acceptsMode(webhookEventMode(event)) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&WebhookReceivedResponse{
+			Received: true,
+			EventID:  event.ID,
+		})
+		return
+	}
+
+	// Kept to be replayed on request
+	if db, err := GetMetricsDatabase(""); err == nil {
+		db.SaveWebhookPayload(r.Context(), event.ID, webhookPayload{Payload: payload, Livemode: event.Livemode, Received: time.Now()})
+	}
+
+	// Process event asynchronously, or while Stripe waits in sync mode, or
+	// queue it for replay on resume while paused. Stripe retries events it's
+	// told to, after a while.
+	switch {
+	case globalPause.deferWhilePaused(func() { wh.processEvent(event) }):
+	case processing == webhookProcessingSync:
+		if err := wh.processEventSync(event); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+	default:
+		if err := wh.dispatch(event); err != nil {
+			slog.Warn("Turning away webhook event", "event_id", event.ID, "event_type", event.Type, "error", err)
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	}
 
 	// Respond immediately to Stripe
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"received": true,
-		"event_id": event.ID,
+	json.NewEncoder(w).Encode(&WebhookReceivedResponse{
+		Received: true,
+		EventID:  event.ID,
 	})
 }
 
 // processEvent processes a webhook event
 func (wh *WebhookHandler) processEvent(event stripe.Event) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	wh.runEvent(event, false)
+}
+
+// runEvent runs the handlers of event and logs it, returning what was logged.
+// Replayed events are processed even when they already were, and nothing is
+// logged for events without handlers.
+func (wh *WebhookHandler) runEvent(event stripe.Event, replayed bool) (WebhookEvent, bool) {
+	return wh.applyEvent(context.Background(), event, replayed, wh.scheduleRetry)
+}
 
+// applyEvent is runEvent with onFailure called with the handlers that
+// failed, to retry them
+func (wh *WebhookHandler) applyEvent(ctx context.Context, event stripe.Event, replayed bool, onFailure func(webhookRetry)) (WebhookEvent, bool) {
 	eventTypeStr := string(event.Type)
 
 	webhookEvent := WebhookEvent{
 		ID:        event.ID,
 		Type:      eventTypeStr,
+		Mode:      webhookEventMode(event),
 		Processed: time.Now(),
 		Success:   true,
+		Replayed:  replayed,
 	}
 
 	wh.mu.RLock()
 	handlers, exists := wh.eventHandlers[eventTypeStr]
 	wh.mu.RUnlock()
 
+	if !replayed {
+		wh.metrics.received(webhookEvent.Processed)
+	}
+
 	if !exists || len(handlers) == 0 {
 		slog.Debug("No handlers registered for event type", "type", eventTypeStr)
-		return
+		wh.metrics.countEvent(eventTypeStr, webhookOutcomeUnhandled)
+		return webhookEvent, false
 	}
 
-	// Execute all handlers for this event type
-	for _, handler := range handlers {
-		if err := handler(ctx, event); err != nil {
-			webhookEvent.Success = false
-			webhookEvent.Error = err.Error()
-			slog.Error("Webhook handler failed",
-				"event_id", event.ID,
-				"event_type", eventTypeStr,
-				"error", err)
-		}
+	// Stripe redelivers events it didn't see acknowledged, which would be
+	// counted twice. Replays are still marked, so that a redelivery after
+	// one is skipped.
+	if db, err := GetMetricsDatabase(""); err == nil && !db.MarkEventProcessed(context.Background(), event.ID) && !replayed {
+		slog.Debug("Skipping duplicate webhook event", "event_id", event.ID, "event_type", eventTypeStr)
+		webhookEvent.Duplicate = true
+		wh.metrics.countEvent(eventTypeStr, webhookOutcomeDuplicate)
+		wh.logEvent(webhookEvent)
+		return webhookEvent, true
 	}
 
-	// Invalidate relevant caches
-	if wh.cacheInvalidator != nil {
-		if err := wh.invalidateCachesForEvent(eventTypeStr); err != nil {
-			slog.Error("Failed to invalidate cache", "event_type", eventTypeStr, "error", err)
-		}
+	// Stripe doesn't deliver events in order, and an older state of an object
+	// would overwrite a newer one. Replays are applied regardless.
+	if !replayed && wh.isStaleEvent(event) {
+		slog.Info("Skipping webhook event older than the latest one applied to its object",
+			"event_id", event.ID,
+			"event_type", eventTypeStr,
+			"object_id", webhookEventObjectID(event),
+			"created", event.Created)
+		webhookEvent.Stale = true
+		wh.metrics.countEvent(eventTypeStr, webhookOutcomeStale)
+		wh.logEvent(webhookEvent)
+		return webhookEvent, true
+	}
+
+	// Execute all handlers for this event type, retrying the ones that fail
+	if failed, err := wh.runHandlers(ctx, event, handlers, 1); len(failed) > 0 {
+		webhookEvent.Success = false
+		webhookEvent.Error = err.Error()
+		webhookEvent.Attempts = 1
+		wh.metrics.countEvent(eventTypeStr, webhookOutcomeFailed)
+		onFailure(webhookRetry{
+			event:    event,
+			handlers: failed,
+			attempts: 1,
+			err:      err,
+			history:  []WebhookAttemptError{{Attempt: 1, At: webhookEvent.Processed, Error: err.Error()}},
+		})
+	} else {
+		wh.metrics.countEvent(eventTypeStr, webhookOutcomeSucceeded)
 	}
 
+	wh.invalidateCaches(eventTypeStr)
+
 	// Log the event
 	wh.logEvent(webhookEvent)
+	return webhookEvent, true
 }
 
-// invalidateCachesForEvent invalidates caches based on event type
-func (wh *WebhookHandler) invalidateCachesForEvent(eventType string) error {
-	switch {
-	case eventType == "customer.subscription.created" ||
-		eventType == "customer.subscription.updated" ||
-		eventType == "customer.subscription.deleted" ||
-		eventType == "invoice.payment_succeeded" ||
-		eventType == "invoice.payment_failed":
-		// Invalidate revenue cache
-		return wh.cacheInvalidator.InvalidateCache("revenue")
+// invalidateCaches invalidates the caches of the widgets an event affects
+func (wh *WebhookHandler) invalidateCaches(eventType string) {
+	if wh.cacheInvalidator == nil {
+		return
+	}
 
-	case eventType == "customer.created" ||
-		eventType == "customer.deleted" ||
-		eventType == "customer.updated":
-		// Invalidate customer cache
-		return wh.cacheInvalidator.InvalidateCache("customers")
+	if err := wh.invalidateCachesForEvent(eventType); err != nil {
+		slog.Error("Failed to invalidate cache", "event_type", eventType, "error", err)
+	}
+}
+
+// invalidateCachesForEvent invalidates the caches of the widgets events of
+// eventType affect, see webhook_invalidations.go
+func (wh *WebhookHandler) invalidateCachesForEvent(eventType string) error {
+	for _, widgetType := range wh.invalidatedWidgetTypes(eventType) {
+		if err := wh.cacheInvalidator.InvalidateCache(widgetType); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -199,19 +377,49 @@ func (wh *WebhookHandler) logEvent(event WebhookEvent) {
 	if len(wh.eventLog) > wh.maxEventLog {
 		wh.eventLog = wh.eventLog[len(wh.eventLog)-wh.maxEventLog:]
 	}
+
+	if wh.eventStore != nil {
+		wh.eventStore.SaveWebhookEvent(context.Background(), event)
+	}
 }
 
-// GetEventLog returns recent webhook events
+// GetEventLog returns recent webhook events, oldest first, from the event
+// store when there is one
 func (wh *WebhookHandler) GetEventLog() []WebhookEvent {
 	wh.mu.RLock()
 	defer wh.mu.RUnlock()
 
+	if wh.eventStore != nil {
+		return wh.eventStore.GetWebhookEvents(context.Background())
+	}
+
 	// Return a copy
 	log := make([]WebhookEvent, len(wh.eventLog))
 	copy(log, wh.eventLog)
 	return log
 }
 
+// webhookEventMode returns the Stripe mode of event, live or test
+func webhookEventMode(event stripe.Event) string {
+	if event.Livemode {
+		return "live"
+	}
+
+	return "test"
+}
+
+// countDuplicateEvents returns how many of events were skipped redeliveries
+func countDuplicateEvents(events []WebhookEvent) int {
+	count := 0
+	for _, event := range events {
+		if event.Duplicate {
+			count++
+		}
+	}
+
+	return count
+}
+
 // Default event handlers
 
 func handleSubscriptionCreated(ctx context.Context, event stripe.Event) error {
@@ -229,21 +437,27 @@ func handleSubscriptionCreated(ctx context.Context, event stripe.Event) error {
 	db, err := GetMetricsDatabase("")
 	if err == nil {
 		// Calculate MRR for this subscription
-		mrr := calculateSubscriptionMRR(&subscription)
+		mrr := calculateSubscriptionMRR(ctx, &subscription)
 
 		mode := "live"
 		if !event.Livemode {
 			mode = "test"
 		}
 
-		snapshot := &RevenueSnapshot{
+		delta := &MetricsDelta{
 			Timestamp: time.Now(),
+			EventType: string(event.Type),
 			NewMRR:    mrr,
 			Mode:      mode,
 		}
 
-		if err := db.SaveRevenueSnapshot(ctx, snapshot); err != nil {
-			slog.Error("Failed to save revenue snapshot", "error", err)
+		// Trial starts for the customers widget, see countNewTrials
+		if subscription.Status == stripe.SubscriptionStatusTrialing && subscription.TestClock == nil {
+			delta.NewTrials = 1
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save revenue delta", "error", err)
 		}
 	}
 
@@ -261,6 +475,50 @@ func handleSubscriptionUpdated(ctx context.Context, event stripe.Event) error {
 		"customer_id", subscription.Customer.ID,
 		"status", subscription.Status)
 
+	// The revenue cache is invalidated for every update, which refreshes the
+	// committed MRR once a cancellation is scheduled or withdrawn
+	if cancellationChanged(event.Data.PreviousAttributes) {
+		slog.Info("Subscription cancellation changed",
+			"subscription_id", subscription.ID,
+			"canceling", subscriptionCanceling(&subscription),
+			"cancel_at", subscription.CancelAt)
+	}
+
+	// Store the change in MRR of an active subscription whose items changed
+	// as expansion or contraction, if the database is available
+	previous, changed := subscriptionBeforeUpdate(&subscription, event.Data.PreviousAttributes)
+	if !changed || subscription.Status != stripe.SubscriptionStatusActive {
+		return nil
+	}
+
+	db, err := GetMetricsDatabase("")
+	if err == nil {
+		change := calculateSubscriptionMRR(ctx, &subscription) - calculateSubscriptionMRR(ctx, previous)
+		if change == 0 {
+			return nil
+		}
+
+		mode := "live"
+		if !event.Livemode {
+			mode = "test"
+		}
+
+		delta := &MetricsDelta{
+			Timestamp: time.Now(),
+			EventType: string(event.Type),
+			Mode:      mode,
+		}
+		if change > 0 {
+			delta.ExpansionMRR = change
+		} else {
+			delta.ContractionMRR = -change
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save revenue delta", "error", err)
+		}
+	}
+
 	return nil
 }
 
@@ -277,21 +535,22 @@ func handleSubscriptionDeleted(ctx context.Context, event stripe.Event) error {
 	// Store in database if available
 	db, err := GetMetricsDatabase("")
 	if err == nil {
-		mrr := calculateSubscriptionMRR(&subscription)
+		mrr := calculateSubscriptionMRR(ctx, &subscription)
 
 		mode := "live"
 		if !event.Livemode {
 			mode = "test"
 		}
 
-		snapshot := &RevenueSnapshot{
+		delta := &MetricsDelta{
 			Timestamp:  time.Now(),
+			EventType:  string(event.Type),
 			ChurnedMRR: mrr,
 			Mode:       mode,
 		}
 
-		if err := db.SaveRevenueSnapshot(ctx, snapshot); err != nil {
-			slog.Error("Failed to save revenue snapshot", "error", err)
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save revenue delta", "error", err)
 		}
 	}
 
@@ -314,14 +573,20 @@ func handleCustomerCreated(ctx context.Context, event stripe.Event) error {
 			mode = "test"
 		}
 
-		snapshot := &CustomerSnapshot{
+		// Left out of the customer counts, see exclusionRules
+		if customer.TestClock == nil {
+			db.RecordCustomerEvent(ctx, mode, true)
+		}
+
+		delta := &MetricsDelta{
 			Timestamp:    time.Now(),
+			EventType:    string(event.Type),
 			NewCustomers: 1,
 			Mode:         mode,
 		}
 
-		if err := db.SaveCustomerSnapshot(ctx, snapshot); err != nil {
-			slog.Error("Failed to save customer snapshot", "error", err)
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save customer delta", "error", err)
 		}
 	}
 
@@ -344,14 +609,19 @@ func handleCustomerDeleted(ctx context.Context, event stripe.Event) error {
 			mode = "test"
 		}
 
-		snapshot := &CustomerSnapshot{
+		if customer.TestClock == nil {
+			db.RecordCustomerEvent(ctx, mode, false)
+		}
+
+		delta := &MetricsDelta{
 			Timestamp:        time.Now(),
+			EventType:        string(event.Type),
 			ChurnedCustomers: 1,
 			Mode:             mode,
 		}
 
-		if err := db.SaveCustomerSnapshot(ctx, snapshot); err != nil {
-			slog.Error("Failed to save customer snapshot", "error", err)
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save customer delta", "error", err)
 		}
 	}
 
@@ -369,6 +639,31 @@ func handleInvoicePaymentSucceeded(ctx context.Context, event stripe.Event) erro
 		"customer_id", invoice.Customer.ID,
 		"amount", invoice.AmountPaid)
 
+	// Store one-time payments in database if available, for the one-time
+	// revenue of the widget to include them until it lists the invoices again
+	db, err := GetMetricsDatabase("")
+	if err == nil && isOneTimeInvoice(&invoice) && invoice.AmountPaid > 0 {
+		currency := normalizeCurrency(string(invoice.Currency))
+		amounts := currencyAmounts{currency: currencyUnitAmount(float64(invoice.AmountPaid), currency)}
+		conversion := GetCurrencyConverter().Convert(ctx, amounts)
+		if len(conversion.Unconverted) > 0 {
+			slog.Warn("One-time payment in a currency without an exchange rate left out", "invoice_id", invoice.ID, "currency", currency)
+		}
+
+		mode := webhookEventMode(event)
+
+		delta := &MetricsDelta{
+			Timestamp:      time.Now(),
+			EventType:      string(event.Type),
+			OneTimeRevenue: conversion.Total,
+			Mode:           mode,
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save one-time payment delta", "error", err)
+		}
+	}
+
 	return nil
 }
 
@@ -383,51 +678,323 @@ func handleInvoicePaymentFailed(ctx context.Context, event stripe.Event) error {
 		"customer_id", invoice.Customer.ID,
 		"amount", invoice.AmountDue)
 
+	// Store in database if available, the revenue cache is invalidated for
+	// the widget to pick up the subscription going past due
+	db, err := GetMetricsDatabase("")
+	if err == nil {
+		currency := normalizeCurrency(string(invoice.Currency))
+		amounts := currencyAmounts{currency: currencyUnitAmount(float64(invoice.AmountDue), currency)}
+		conversion := GetCurrencyConverter().Convert(ctx, amounts)
+		if len(conversion.Unconverted) > 0 {
+			slog.Warn("Failed payment in a currency without an exchange rate left out", "invoice_id", invoice.ID, "currency", currency)
+		}
+
+		mode := webhookEventMode(event)
+
+		delta := &MetricsDelta{
+			Timestamp:      time.Now(),
+			EventType:      string(event.Type),
+			FailedPayments: 1,
+			FailedAmount:   conversion.Total,
+			Mode:           mode,
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save failed payment delta", "error", err)
+		}
+	}
+
+	return nil
+}
+
+func handleChargeRefunded(ctx context.Context, event stripe.Event) error {
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		return fmt.Errorf("failed to unmarshal charge: %w", err)
+	}
+
+	refunded := refundedByEvent(&charge, event.Data.PreviousAttributes)
+
+	slog.Info("Charge refunded",
+		"charge_id", charge.ID,
+		"amount_refunded", charge.AmountRefunded,
+		"refunded", refunded)
+
+	// Store in database if available
+	db, err := GetMetricsDatabase("")
+	if err == nil && refunded > 0 {
+		currency := normalizeCurrency(string(charge.Currency))
+		amounts := currencyAmounts{currency: currencyUnitAmount(float64(refunded), currency)}
+		conversion := GetCurrencyConverter().Convert(ctx, amounts)
+		if len(conversion.Unconverted) > 0 {
+			slog.Warn("Refund in a currency without an exchange rate left out", "charge_id", charge.ID, "currency", currency)
+		}
+
+		mode := webhookEventMode(event)
+
+		delta := &MetricsDelta{
+			Timestamp: time.Now(),
+			EventType: string(event.Type),
+			Refunded:  conversion.Total,
+			Mode:      mode,
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save refund delta", "error", err)
+		}
+	}
+
+	return nil
+}
+
+func handleCheckoutSessionCompleted(ctx context.Context, event stripe.Event) error {
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		return fmt.Errorf("failed to unmarshal checkout session: %w", err)
+	}
+
+	slog.Info("Checkout session completed",
+		"session_id", session.ID,
+		"mode", session.Mode,
+		"payment_status", session.PaymentStatus,
+		"amount", session.AmountTotal)
+
+	// Store in database if available. The amount is kept apart from the
+	// one-time revenue, which the invoice of the session reports.
+	db, err := GetMetricsDatabase("")
+	if err == nil {
+		var amount float64
+		if session.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid && session.AmountTotal > 0 {
+			currency := normalizeCurrency(string(session.Currency))
+			amounts := currencyAmounts{currency: currencyUnitAmount(float64(session.AmountTotal), currency)}
+			conversion := GetCurrencyConverter().Convert(ctx, amounts)
+			if len(conversion.Unconverted) > 0 {
+				slog.Warn("Checkout in a currency without an exchange rate left out", "session_id", session.ID, "currency", currency)
+			}
+			amount = conversion.Total
+		}
+
+		mode := webhookEventMode(event)
+
+		delta := &MetricsDelta{
+			Timestamp:          time.Now(),
+			EventType:          string(event.Type),
+			CompletedCheckouts: 1,
+			CheckoutAmount:     amount,
+			Mode:               mode,
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save checkout delta", "error", err)
+		}
+	}
+
+	return nil
+}
+
+func handleTrialWillEnd(ctx context.Context, event stripe.Event) error {
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+		return fmt.Errorf("failed to unmarshal subscription: %w", err)
+	}
+
+	slog.Info("Trial will end",
+		"subscription_id", sub.ID,
+		"trial_end", sub.TrialEnd)
+
+	// Store in database if available, leaving out test clocks like the trials
+	// started
+	db, err := GetMetricsDatabase("")
+	if err == nil && sub.TestClock == nil {
+		mode := webhookEventMode(event)
+
+		delta := &MetricsDelta{
+			Timestamp:    time.Now(),
+			EventType:    string(event.Type),
+			TrialsEnding: 1,
+			Mode:         mode,
+		}
+
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save trial delta", "error", err)
+		}
+	}
+
 	return nil
 }
 
-// calculateSubscriptionMRR calculates MRR for a single subscription
-func calculateSubscriptionMRR(sub *stripe.Subscription) float64 {
-	totalMRR := 0.0
+func handleInvoiceMarkedUncollectible(ctx context.Context, event stripe.Event) error {
+	var invoice stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		return fmt.Errorf("failed to unmarshal invoice: %w", err)
+	}
+
+	// What's left unpaid is written off, the whole amount due when the event
+	// doesn't say what remains
+	unpaid := invoice.AmountRemaining
+	if unpaid == 0 && !invoice.Paid {
+		unpaid = invoice.AmountDue
+	}
+
+	slog.Warn("Invoice marked uncollectible",
+		"invoice_id", invoice.ID,
+		"customer_id", invoice.Customer.ID,
+		"amount", unpaid)
+
+	// Store in database if available
+	db, err := GetMetricsDatabase("")
+	if err == nil {
+		currency := normalizeCurrency(string(invoice.Currency))
+		amounts := currencyAmounts{currency: currencyUnitAmount(float64(unpaid), currency)}
+		conversion := GetCurrencyConverter().Convert(ctx, amounts)
+		if len(conversion.Unconverted) > 0 {
+			slog.Warn("Uncollectible invoice in a currency without an exchange rate left out", "invoice_id", invoice.ID, "currency", currency)
+		}
+
+		mode := webhookEventMode(event)
 
-	for _, item := range sub.Items.Data {
-		if item.Price == nil {
-			continue
+		delta := &MetricsDelta{
+			Timestamp:             time.Now(),
+			EventType:             string(event.Type),
+			UncollectibleInvoices: 1,
+			UncollectibleAmount:   conversion.Total,
+			Mode:                  mode,
 		}
 
-		amount := float64(item.Price.UnitAmount) / 100.0
-		interval := string(item.Price.Recurring.Interval)
-		intervalCount := item.Price.Recurring.IntervalCount
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save uncollectible invoice delta", "error", err)
+		}
+	}
+
+	return nil
+}
+
+func handlePaymentMethodDetached(ctx context.Context, event stripe.Event) error {
+	var paymentMethod stripe.PaymentMethod
+	if err := json.Unmarshal(event.Data.Raw, &paymentMethod); err != nil {
+		return fmt.Errorf("failed to unmarshal payment method: %w", err)
+	}
+
+	// Detached payment methods no longer have a customer, only the previous
+	// attributes tell which one it was
+	customerID, _ := event.Data.PreviousAttributes["customer"].(string)
+
+	slog.Info("Payment method detached",
+		"payment_method_id", paymentMethod.ID,
+		"customer_id", customerID)
 
-		var monthlyAmount float64
-		switch interval {
-		case "month":
-			monthlyAmount = amount / float64(intervalCount)
-		case "year":
-			monthlyAmount = amount / (12.0 * float64(intervalCount))
-		case "week":
-			monthlyAmount = amount * 4.33 / float64(intervalCount)
-		case "day":
-			monthlyAmount = amount * 30 / float64(intervalCount)
+	// Store in database if available, the customers cache is invalidated for
+	// the widget to pick up customers left without a payment method
+	db, err := GetMetricsDatabase("")
+	if err == nil {
+		mode := webhookEventMode(event)
+
+		delta := &MetricsDelta{
+			Timestamp:              time.Now(),
+			EventType:              string(event.Type),
+			DetachedPaymentMethods: 1,
+			Mode:                   mode,
 		}
 
-		monthlyAmount *= float64(item.Quantity)
-		totalMRR += monthlyAmount
+		if err := db.SaveDelta(ctx, delta); err != nil {
+			slog.Error("Failed to save detached payment method delta", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// cancellationChanged reports whether a customer.subscription.updated event
+// scheduled or withdrew the cancellation of a subscription
+func cancellationChanged(previous map[string]interface{}) bool {
+	_, periodEnd := previous["cancel_at_period_end"]
+	_, cancelAt := previous["cancel_at"]
+	return periodEnd || cancelAt
+}
+
+// subscriptionBeforeUpdate returns the subscription as it was before a
+// customer.subscription.updated event that changed its items, such as a plan
+// or quantity change, by applying the previous attributes of the event to it.
+// Returns false when the items didn't change.
+func subscriptionBeforeUpdate(sub *stripe.Subscription, previous map[string]interface{}) (*stripe.Subscription, bool) {
+	if _, ok := previous["items"]; !ok {
+		return nil, false
+	}
+
+	raw, err := json.Marshal(previous)
+	if err != nil {
+		return nil, false
+	}
+
+	// The items are replaced rather than merged into the current ones
+	before := *sub
+	before.Items = nil
+	if err := json.Unmarshal(raw, &before); err != nil {
+		slog.Warn("Failed to apply the previous attributes of a subscription", "subscription_id", sub.ID, "error", err)
+		return nil, false
+	}
+
+	return &before, true
+}
+
+// refundedByEvent returns the amount a charge.refunded event refunds, in the
+// smallest currency unit. amount_refunded is the total of all refunds of the
+// charge, so for a further partial refund the total before the event is
+// subtracted.
+func refundedByEvent(charge *stripe.Charge, previous map[string]interface{}) int64 {
+	refunded := charge.AmountRefunded
+	if before, ok := previous["amount_refunded"].(float64); ok {
+		refunded -= int64(before)
 	}
 
-	return totalMRR
+	return max(refunded, 0)
+}
+
+// calculateSubscriptionMRR calculates MRR for a single subscription in the
+// reporting currency, leaving out items in a currency without an exchange rate
+func calculateSubscriptionMRR(ctx context.Context, sub *stripe.Subscription) float64 {
+	amounts := make(currencyAmounts)
+	amounts.addSubscription(sub, newPriceResolver(ctx))
+
+	conversion := GetCurrencyConverter().Convert(ctx, amounts)
+	for _, unconverted := range conversion.Unconverted {
+		slog.Warn("Subscription MRR in a currency without an exchange rate left out",
+			"subscription_id", sub.ID,
+			"currency", unconverted.Currency,
+			"amount", unconverted.Amount)
+	}
+
+	return conversion.Total
 }
 
 // WebhookStatusHandler returns an HTTP handler for webhook status
 func WebhookStatusHandler(handler *WebhookHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		eventLog := handler.GetEventLog()
+		query, err := parseWebhookEventQuery(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		page := queryWebhookEvents(handler.GetEventLog(), query)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"total_events": len(eventLog),
-			"recent_events": eventLog,
+		json.NewEncoder(w).Encode(&WebhookStatusResponse{
+			TotalEvents:        page.total,
+			FailedEvents:       page.failed,
+			DuplicateEvents:    page.duplicates,
+			EventsByType:       page.byType,
+			RecentEvents:       handler.presentEvents(page.events),
+			Limit:              query.limit,
+			Offset:             query.offset,
+			RejectedEvents:     int(handler.rejectedEvents.Load()),
+			RejectionReasons:   handler.GetRejectionReasons(),
+			ModeFilter:         handler.GetModeFilter(),
+			PendingRetries:     int(handler.pendingRetries.Load()),
+			Processing:         handler.GetProcessing(),
+			AwaitingRedelivery: handler.awaitedRedeliveries(),
+			DeadLetters:        handler.presentEvents(handler.GetDeadLetters()),
 		})
 	}
 }
@@ -0,0 +1,549 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestWebhookDeltas_DoNotReplaceSnapshots(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	now := time.Now()
+	monthAgo := now.Add(-growthComparisonWindow)
+
+	// First widget update a month ago
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: monthAgo, MRR: 800, ARR: 9600, Mode: "test"})
+	db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: monthAgo, TotalCustomers: 20, Mode: "test"})
+
+	// Webhooks arrive before the next widget update
+	for _, webhook := range []struct {
+		handler EventHandlerFunc
+		event   stripe.Event
+	}{
+		{handleCustomerCreated, stripe.Event{Type: "customer.created", Data: &stripe.EventData{Raw: json.RawMessage(`{"id": "cus_1"}`)}}},
+		{handleSubscriptionCreated, stripe.Event{Type: "customer.subscription.created", Data: &stripe.EventData{Raw: json.RawMessage(`{"id": "sub_1", "customer": "cus_1"}`)}}},
+	} {
+		if err := webhook.handler(ctx, webhook.event); err != nil {
+			t.Fatalf("unexpected error handling %s: %v", webhook.event.Type, err)
+		}
+	}
+
+	latestRevenue, _ := db.GetLatestRevenue(ctx, "test")
+	if latestRevenue == nil || latestRevenue.MRR != 800 {
+		t.Errorf("expected the latest revenue snapshot to keep MRR 800, got %+v", latestRevenue)
+	}
+
+	latestCustomers, _ := db.GetLatestCustomers(ctx, "test")
+	if latestCustomers == nil || latestCustomers.TotalCustomers != 20 {
+		t.Errorf("expected the latest customer snapshot to keep 20 customers, got %+v", latestCustomers)
+	}
+
+	// Second widget update compares against the snapshot from a month ago
+	widget := &revenueWidget{CurrentMRR: 1000}
+	previous, _ := db.GetRevenueNearest(ctx, "test", now.Add(-growthComparisonWindow))
+	widget.compareGrowthWith(previous, now)
+
+	if !floatEquals(widget.GrowthRate, 25, 0.01) {
+		t.Errorf("expected growth rate 25%%, got %f", widget.GrowthRate)
+	}
+
+	sum, _ := db.SumDeltas(ctx, "test", monthAgo, now.Add(time.Minute))
+	if sum.NewCustomers != 1 {
+		t.Errorf("expected the customer.created delta to be recorded, got %+v", sum)
+	}
+
+	deltas, _ := db.GetDeltas(ctx, "test", monthAgo, now.Add(time.Minute))
+	if len(deltas) != 2 {
+		t.Errorf("expected 2 deltas, got %d", len(deltas))
+	}
+}
+
+func TestHandleChargeRefunded_RecordsPartialRefunds(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	// Two partial refunds of the same charge, the second one reporting the
+	// total refunded so far
+	for _, data := range []string{
+		`{"object": {"id": "ch_1", "currency": "usd", "amount": 10000, "amount_refunded": 2500}, "previous_attributes": {"amount_refunded": 0}}`,
+		`{"object": {"id": "ch_1", "currency": "usd", "amount": 10000, "amount_refunded": 4000}, "previous_attributes": {"amount_refunded": 2500}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleChargeRefunded(ctx, stripe.Event{Type: "charge.refunded", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if !floatEquals(sum.Refunded, 40, 0.001) {
+		t.Errorf("expected 40 refunded, got %v", sum.Refunded)
+	}
+}
+
+func TestHandleInvoicePaymentFailed_RecordsFailedPayments(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	GetCurrencyConverter().Configure("usd", map[string]float64{"eur": 1.5}, nil)
+	defer GetCurrencyConverter().Configure("usd", nil, nil)
+
+	for _, data := range []string{
+		`{"object": {"id": "in_1", "currency": "usd", "amount_due": 4900, "customer": {"id": "cus_1"}}}`,
+		`{"object": {"id": "in_2", "currency": "eur", "amount_due": 2000, "customer": {"id": "cus_2"}}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleInvoicePaymentFailed(ctx, stripe.Event{Type: "invoice.payment_failed", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.FailedPayments != 2 || !floatEquals(sum.FailedAmount, 79, 0.001) {
+		t.Errorf("expected 2 failed payments of 79, got %d of %v", sum.FailedPayments, sum.FailedAmount)
+	}
+}
+
+func TestHandleSubscriptionCreated_RecordsTrialStarts(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	for _, data := range []string{
+		`{"object": {"id": "sub_1", "customer": "cus_1", "status": "trialing"}}`,
+		`{"object": {"id": "sub_2", "customer": "cus_2", "status": "active"}}`,
+		`{"object": {"id": "sub_3", "customer": "cus_3", "status": "trialing", "test_clock": "clock_1"}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleSubscriptionCreated(ctx, stripe.Event{Type: "customer.subscription.created", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.NewTrials != 1 {
+		t.Errorf("expected 1 trial start, got %d", sum.NewTrials)
+	}
+}
+
+func TestHandleCheckoutSessionCompleted_RecordsCheckouts(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	GetCurrencyConverter().Configure("usd", map[string]float64{"eur": 1.5}, nil)
+	defer GetCurrencyConverter().Configure("usd", nil, nil)
+
+	for _, data := range []string{
+		`{"object": {"id": "cs_1", "mode": "subscription", "payment_status": "paid", "currency": "usd", "amount_total": 4900, "customer": "cus_1"}}`,
+		`{"object": {"id": "cs_2", "mode": "payment", "payment_status": "paid", "currency": "eur", "amount_total": 3000, "customer": "cus_2"}}`,
+		`{"object": {"id": "cs_3", "mode": "payment", "payment_status": "unpaid", "currency": "usd", "amount_total": 1000, "customer": "cus_3"}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleCheckoutSessionCompleted(ctx, stripe.Event{Type: "checkout.session.completed", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.CompletedCheckouts != 3 || !floatEquals(sum.CheckoutAmount, 94, 0.001) {
+		t.Errorf("expected 3 checkouts with 94 paid, got %d with %v", sum.CompletedCheckouts, sum.CheckoutAmount)
+	}
+
+	// Reported by the invoice or charge of the session instead
+	if sum.OneTimeRevenue != 0 {
+		t.Errorf("expected no one-time revenue, got %v", sum.OneTimeRevenue)
+	}
+}
+
+func TestHandleTrialWillEnd_RecordsEndingTrials(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	for _, data := range []string{
+		`{"object": {"id": "sub_1", "customer": "cus_1", "status": "trialing", "trial_end": 1767225600}}`,
+		`{"object": {"id": "sub_2", "customer": "cus_2", "status": "trialing", "trial_end": 1767225600, "test_clock": "clock_1"}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleTrialWillEnd(ctx, stripe.Event{Type: "customer.subscription.trial_will_end", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.TrialsEnding != 1 {
+		t.Errorf("expected 1 trial ending without the test clock one, got %d", sum.TrialsEnding)
+	}
+}
+
+func TestHandleInvoiceMarkedUncollectible_RecordsWrittenOffAmounts(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	GetCurrencyConverter().Configure("usd", map[string]float64{"eur": 1.5}, nil)
+	defer GetCurrencyConverter().Configure("usd", nil, nil)
+
+	for _, data := range []string{
+		// Partially paid before being written off
+		`{"object": {"id": "in_1", "currency": "usd", "amount_due": 4900, "amount_remaining": 2900, "customer": {"id": "cus_1"}}}`,
+		`{"object": {"id": "in_2", "currency": "eur", "amount_due": 2000, "customer": {"id": "cus_2"}}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleInvoiceMarkedUncollectible(ctx, stripe.Event{Type: "invoice.marked_uncollectible", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.UncollectibleInvoices != 2 || !floatEquals(sum.UncollectibleAmount, 59, 0.001) {
+		t.Errorf("expected 2 uncollectible invoices of 59, got %d of %v", sum.UncollectibleInvoices, sum.UncollectibleAmount)
+	}
+}
+
+func TestHandlePaymentMethodDetached_RecordsDetachments(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	var eventData stripe.EventData
+	data := `{"object": {"id": "pm_1", "type": "card", "customer": null}, "previous_attributes": {"customer": "cus_1"}}`
+	if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := handlePaymentMethodDetached(ctx, stripe.Event{Type: "payment_method.detached", Data: &eventData}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.DetachedPaymentMethods != 1 {
+		t.Errorf("expected 1 detached payment method, got %d", sum.DetachedPaymentMethods)
+	}
+}
+
+func TestInvalidateCachesForEvent_NewEventTypes(t *testing.T) {
+	tests := []struct {
+		eventType   string
+		widgetTypes []string
+	}{
+		{"checkout.session.completed", []string{"customers"}},
+		{"customer.subscription.trial_will_end", []string{"revenue"}},
+		{"invoice.marked_uncollectible", []string{"revenue", "customers"}},
+		{"payment_method.detached", []string{"customers"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			invalidator := &recordingInvalidator{}
+			wh := &WebhookHandler{cacheInvalidator: invalidator}
+
+			if err := wh.invalidateCachesForEvent(tt.eventType); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(invalidator.widgetTypes, tt.widgetTypes) {
+				t.Errorf("expected %v to be invalidated, got %v", tt.widgetTypes, invalidator.widgetTypes)
+			}
+		})
+	}
+}
+
+func TestCancellationChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous map[string]interface{}
+		expected bool
+	}{
+		{"cancellation scheduled", map[string]interface{}{"cancel_at_period_end": false}, true},
+		{"cancellation withdrawn", map[string]interface{}{"cancel_at_period_end": true, "canceled_at": 1700000000}, true},
+		{"cancel date set", map[string]interface{}{"cancel_at": nil}, true},
+		{"other change", map[string]interface{}{"quantity": 1}, false},
+		{"no previous attributes", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cancellationChanged(tt.previous); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandleSubscriptionUpdated_RecordsExpansionAndContraction(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	GetCurrencyConverter().Configure("usd", nil, nil)
+
+	item := func(amount, quantity int) string {
+		return fmt.Sprintf(`{"data": [{"id": "si_1", "quantity": %d, "price": {"id": "price_1", "currency": "usd", "type": "recurring", "unit_amount": %d, "recurring": {"interval": "month", "interval_count": 1}}}]}`, quantity, amount)
+	}
+
+	for _, data := range []string{
+		// Upgrade from 1 to 3 seats, then down to 2
+		`{"object": {"id": "sub_1", "status": "active", "customer": {"id": "cus_1"}, "items": ` + item(1000, 3) + `}, "previous_attributes": {"items": ` + item(1000, 1) + `}}`,
+		`{"object": {"id": "sub_1", "status": "active", "customer": {"id": "cus_1"}, "items": ` + item(1000, 2) + `}, "previous_attributes": {"items": ` + item(1000, 3) + `}}`,
+		// Changes that don't move MRR
+		`{"object": {"id": "sub_1", "status": "active", "customer": {"id": "cus_1"}, "items": ` + item(1000, 2) + `}, "previous_attributes": {"cancel_at_period_end": true}}`,
+		`{"object": {"id": "sub_2", "status": "trialing", "customer": {"id": "cus_2"}, "items": ` + item(1000, 2) + `}, "previous_attributes": {"items": ` + item(1000, 1) + `}}`,
+	} {
+		var eventData stripe.EventData
+		if err := json.Unmarshal([]byte(data), &eventData); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := handleSubscriptionUpdated(ctx, stripe.Event{Type: "customer.subscription.updated", Data: &eventData}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if !floatEquals(sum.ExpansionMRR, 20, 0.001) || !floatEquals(sum.ContractionMRR, 10, 0.001) {
+		t.Errorf("expected 20 expansion and 10 contraction, got %v and %v", sum.ExpansionMRR, sum.ContractionMRR)
+	}
+}
+
+func TestWebhookEndpoint_AcceptsSignedEvents(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	const secret = "whsec_endpoint_test"
+	app := &application{widgetByID: make(map[uint64]widget)}
+	app.webhookHandler = newWebhookHandler([]webhookSecret{{Secret: secret}}, app)
+	mux := http.NewServeMux()
+	app.registerWebhookRoutes(mux)
+
+	post := func(path, payload, signature string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		request.Header.Set("Stripe-Signature", signature)
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	payload := fmt.Sprintf(`{"id": "evt_endpoint_1", "type": "customer.created", "livemode": false, "api_version": %q, "data": {"object": {"id": "cus_endpoint_1"}}}`, stripe.APIVersion)
+
+	if response := post(stripeWebhookPath, payload, "t=1,v1=bad"); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d for a bad signature, got %d", http.StatusUnauthorized, response.Code)
+	}
+
+	response := post(stripeWebhookPath, payload, signWebhookPayload(payload, secret))
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected %d for a signed event, got %d: %s", http.StatusOK, response.Code, response.Body.String())
+	}
+
+	// Processed in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		logged := false
+		for _, event := range app.webhookHandler.GetEventLog() {
+			if event.ID == "evt_endpoint_1" && event.Type == "customer.created" {
+				logged = true
+			}
+		}
+
+		if logged {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expected the event to be logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Endpoints set up before /webhooks/stripe keep working
+	if response := post(legacyStripeWebhookPath, payload, signWebhookPayload(payload, secret)); response.Code != http.StatusOK {
+		t.Errorf("expected %d on %s, got %d", http.StatusOK, legacyStripeWebhookPath, response.Code)
+	}
+}
+
+func TestApplication_WebhookURL(t *testing.T) {
+	tests := []struct {
+		host    string
+		port    uint16
+		baseURL string
+		want    string
+	}{
+		{port: 8080, want: "http://localhost:8080/webhooks/stripe"},
+		{host: "0.0.0.0", port: 80, baseURL: "/glance", want: "http://0.0.0.0:80/glance/webhooks/stripe"},
+		{port: 8080, baseURL: "https://metrics.example.com", want: "https://metrics.example.com/webhooks/stripe"},
+	}
+
+	for _, tt := range tests {
+		app := &application{}
+		app.Config.Server.Host, app.Config.Server.Port, app.Config.Server.BaseURL = tt.host, tt.port, tt.baseURL
+		if got := app.webhookURL(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestWebhookSecret_RotatesOnReload(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "")
+	defer func() { configuredWebhookSecrets = nil }()
+
+	// Builds the application the way a config reload does
+	reload := func(secret string) *http.ServeMux {
+		config, err := newConfigFromYAML([]byte(fmt.Sprintf(`
+stripe-webhook:
+  secret: %s
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets: []
+`, secret)))
+		if err != nil {
+			t.Fatalf("unexpected config error: %v", err)
+		}
+
+		app, err := newApplication(config)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		mux := http.NewServeMux()
+		app.registerWebhookRoutes(mux)
+		return mux
+	}
+
+	post := func(mux *http.ServeMux, secret string) int {
+		payload := fmt.Sprintf(`{"id": "evt_rotation", "type": "ping", "api_version": %q}`, stripe.APIVersion)
+		request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+		request.Header.Set("Stripe-Signature", signWebhookPayload(payload, secret))
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	mux := reload("whsec_old")
+	if code := post(mux, "whsec_old"); code != http.StatusOK {
+		t.Errorf("expected %d before the rotation, got %d", http.StatusOK, code)
+	}
+
+	mux = reload("whsec_new")
+	if code := post(mux, "whsec_new"); code != http.StatusOK {
+		t.Errorf("expected %d with the new secret, got %d", http.StatusOK, code)
+	}
+	if code := post(mux, "whsec_old"); code != http.StatusUnauthorized {
+		t.Errorf("expected %d with the old secret, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestInvalidateCache_RefreshesWidgetsOnEveryPage(t *testing.T) {
+	ctx := context.Background()
+	store := newSimpleMetricsDB()
+	store.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now(), MRR: 1000, Mode: "live"})
+
+	// One revenue widget at the top of a page and another in a group
+	revenue := &revenueWidget{StripeMode: "live", store: store}
+	revenue.withCacheDuration(time.Hour)
+	grouped := &revenueWidget{StripeMode: "live", store: store}
+	grouped.withCacheDuration(time.Hour)
+	group := &groupWidget{}
+	group.Widgets = widgets{grouped}
+	customers := &customersWidget{StripeMode: "live", store: store}
+
+	app := &application{
+		widgetByID:   map[uint64]widget{1: revenue, 2: group, 3: customers},
+		widgetPage:   make(map[uint64]*page),
+		widgetEvents: newWidgetEventBroker(),
+	}
+	app.widgetRefreshes = newWidgetRefresher(0, app.refreshWidgets)
+	app.Config.Replication.Role = replicationRoleReplica
+	for id := range app.widgetByID {
+		app.widgetPage[id] = &page{}
+	}
+
+	revenue.update(ctx)
+	grouped.update(ctx)
+	now := time.Now()
+	if revenue.requiresUpdate(&now) || group.requiresUpdate(&now) {
+		t.Fatal("expected the widgets to be cached for an hour")
+	}
+
+	events, _ := app.widgetEvents.subscribe()
+	wh := newWebhookHandler(nil, app)
+
+	store.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: time.Now().Add(time.Second), MRR: 1500, Mode: "live"})
+	if err := wh.invalidateCachesForEvent("customer.subscription.created"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Broadcast once the widgets are refreshed in the background, the
+	// customers widget possibly first
+	event := <-events
+	if event.WidgetType != "revenue" {
+		event = <-events
+	}
+
+	if !slices.Equal(event.WidgetIDs, []uint64{1, 2}) {
+		t.Errorf("expected the revenue widget and the group to be refreshed, got %+v", event)
+	}
+
+	if revenue.CurrentMRR != 1500 || grouped.CurrentMRR != 1500 {
+		t.Errorf("expected both revenue widgets to show the new MRR, got %v and %v", revenue.CurrentMRR, grouped.CurrentMRR)
+	}
+}
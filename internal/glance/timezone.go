@@ -0,0 +1,52 @@
+package glance
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// metricsTimezone is the time zone of the metrics timezone option, which
+// month boundaries, trend labels and snapshot buckets are in unless a widget
+// sets its own. UTC until configured.
+var metricsTimezone atomic.Pointer[time.Location]
+
+// loadTimezone loads an IANA time zone such as Australia/Sydney, returning nil
+// for an empty name
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("timezone must be an IANA time zone like Europe/Berlin, got: %s", name)
+	}
+
+	return location, nil
+}
+
+// setMetricsTimezone sets the default time zone of month boundaries, nil
+// meaning UTC
+func setMetricsTimezone(location *time.Location) {
+	metricsTimezone.Store(location)
+}
+
+// defaultTimezone returns the time zone of the metrics timezone option
+func defaultTimezone() *time.Location {
+	if location := metricsTimezone.Load(); location != nil {
+		return location
+	}
+
+	return time.UTC
+}
+
+// widgetTimezone returns the time zone of a widget, its own when it sets one
+// and the metrics timezone otherwise
+func widgetTimezone(location *time.Location) *time.Location {
+	if location != nil {
+		return location
+	}
+
+	return defaultTimezone()
+}
@@ -0,0 +1,172 @@
+package glance
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func mustLoadTimezone(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	location, err := loadTimezone(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return location
+}
+
+func TestLoadTimezone(t *testing.T) {
+	if location, err := loadTimezone(""); location != nil || err != nil {
+		t.Errorf("expected no time zone without a name, got %v, %v", location, err)
+	}
+
+	if location, err := loadTimezone("Europe/Berlin"); err != nil || location.String() != "Europe/Berlin" {
+		t.Errorf("expected Europe/Berlin, got %v, %v", location, err)
+	}
+
+	if _, err := loadTimezone("Mars/Olympus_Mons"); err == nil {
+		t.Error("expected an error for an unknown time zone")
+	}
+
+	w := &revenueWidget{StripeAPIKey: "sk_test_timezone", Timezone: "CET+1"}
+	if err := w.initialize(); err == nil {
+		t.Error("expected the widget to reject an invalid timezone")
+	}
+}
+
+func TestWidgetTimezone_DefaultsToMetricsTimezone(t *testing.T) {
+	sydney := mustLoadTimezone(t, "Australia/Sydney")
+	losAngeles := mustLoadTimezone(t, "America/Los_Angeles")
+
+	if got := widgetTimezone(nil); got != time.UTC {
+		t.Errorf("expected UTC without a metrics timezone, got %v", got)
+	}
+
+	setMetricsTimezone(sydney)
+	defer setMetricsTimezone(nil)
+
+	if got := (&revenueWidget{}).now().Location(); got != sydney {
+		t.Errorf("expected the metrics timezone, got %v", got)
+	}
+
+	if got := (&customersWidget{timezone: losAngeles}).now().Location(); got != losAngeles {
+		t.Errorf("expected the widget's own timezone, got %v", got)
+	}
+}
+
+// At 2026-03-31 20:00 UTC it's already April in Sydney and still March in Los
+// Angeles, which is where month boundaries in different time zones disagree
+var timezoneRollover = time.Date(2026, time.March, 31, 20, 0, 0, 0, time.UTC)
+
+func TestStartOfMonthMRR_Timezones(t *testing.T) {
+	ctx := context.Background()
+
+	db := newSimpleMetricsDB()
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timezoneRollover.Add(-8 * time.Hour), MRR: 100, Mode: "test"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timezoneRollover, MRR: 200, Mode: "test"})
+	db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timezoneRollover.Add(9 * time.Hour), MRR: 300, Mode: "test"})
+
+	now := timezoneRollover.Add(14 * time.Hour)
+
+	tests := []struct {
+		name     string
+		timezone string
+		expected float64
+	}{
+		// April starts at 2026-03-31 13:00 UTC
+		{"east of UTC", "Australia/Sydney", 100},
+		{"UTC", "UTC", 200},
+		// April starts at 2026-04-01 07:00 UTC
+		{"west of UTC", "America/Los_Angeles", 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mrr, ok := startOfMonthMRR(ctx, db, "test", now.In(mustLoadTimezone(t, tt.timezone)))
+			if !ok || mrr != tt.expected {
+				t.Errorf("expected MRR %v at the start of the month, got %v", tt.expected, mrr)
+			}
+		})
+	}
+}
+
+func TestRevenueHistoryAggregated_BucketsInMetricsTimezone(t *testing.T) {
+	ctx := context.Background()
+	defer setMetricsTimezone(nil)
+
+	db := newSimpleMetricsDB()
+	for i, offset := range []time.Duration{-8 * time.Hour, 0, 9 * time.Hour} {
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timezoneRollover.Add(offset), MRR: float64(i+1) * 100, Mode: "test"})
+	}
+
+	tests := []struct {
+		name     string
+		timezone string
+		expected []float64
+	}{
+		{"east of UTC", "Australia/Sydney", []float64{100, 300}},
+		{"UTC", "UTC", []float64{200, 300}},
+		{"west of UTC", "America/Los_Angeles", []float64{300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMetricsTimezone(mustLoadTimezone(t, tt.timezone))
+
+			monthly, err := db.GetRevenueHistoryAggregated(ctx, "test", timezoneRollover.AddDate(0, -1, 0), timezoneRollover.AddDate(0, 0, 1), MetricsBucketMonth, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(monthly) != len(tt.expected) {
+				t.Fatalf("expected %d months, got %d", len(tt.expected), len(monthly))
+			}
+
+			for i, snapshot := range monthly {
+				if snapshot.MRR != tt.expected[i] {
+					t.Errorf("month %d: expected MRR %v, got %v", i, tt.expected[i], snapshot.MRR)
+				}
+			}
+		})
+	}
+}
+
+func TestScanSubscriptions_StartOfMonthInTimezone(t *testing.T) {
+	ctx := context.Background()
+
+	client := newFakeStripeClient("sk_test_timezone_scan", &fakeSubscriptionLister{})
+	defer subscriptionScans.invalidate()
+
+	sydney := mustLoadTimezone(t, "Australia/Sydney")
+	losAngeles := mustLoadTimezone(t, "America/Los_Angeles")
+
+	east, err := scanSubscriptions(ctx, client, timezoneRollover.In(sydney))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := time.Date(2026, time.April, 1, 0, 0, 0, 0, sydney); !east.StartOfMonth.Equal(expected) {
+		t.Errorf("expected the month to start at %s, got %s", expected, east.StartOfMonth)
+	}
+
+	west, err := scanSubscriptions(ctx, client, timezoneRollover.In(losAngeles))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if west == east {
+		t.Error("expected widgets in different time zones to have their own scan")
+	}
+	if expected := time.Date(2026, time.March, 1, 0, 0, 0, 0, losAngeles); !west.StartOfMonth.Equal(expected) {
+		t.Errorf("expected the month to start at %s, got %s", expected, west.StartOfMonth)
+	}
+}
+
+func TestBackfillMonthEnd_Timezone(t *testing.T) {
+	sydney := mustLoadTimezone(t, "Australia/Sydney")
+
+	got := backfillMonthEnd(time.Date(2026, time.March, 15, 0, 0, 0, 0, sydney))
+	if expected := time.Date(2026, time.March, 31, 23, 59, 59, 0, sydney); !got.Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
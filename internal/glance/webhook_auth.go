@@ -0,0 +1,94 @@
+package glance
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// stripeObjectIDPattern matches the IDs of the Stripe objects webhook events
+// and their errors refer to
+var stripeObjectIDPattern = regexp.MustCompile(`\b(evt|cus|sub|si|sub_sched|in|ii|ch|re|py|pi|pm|src|card|cs|prod|price|txn|acct)_[A-Za-z0-9]+\b`)
+
+// isWebhookAPIAuthorized reports whether r may read the webhook event log or
+// replay events, with the login of the dashboard or the status-token of the
+// stripe-webhook config as a bearer token. Without either configured, the
+// endpoints are as open as the dashboard.
+func (a *application) isWebhookAPIAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	token := a.Config.StripeWebhook.StatusToken
+	if token != "" {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			return true
+		}
+
+		if !a.RequiresAuth {
+			return false
+		}
+	}
+
+	return a.isAuthorized(w, r)
+}
+
+// handleUnauthorizedWebhookAPIResponse responds with a 401 and returns true
+// when r isn't authorized by isWebhookAPIAuthorized
+func (a *application) handleUnauthorizedWebhookAPIResponse(w http.ResponseWriter, r *http.Request) bool {
+	if a.isWebhookAPIAuthorized(w, r) {
+		return false
+	}
+
+	if a.Config.StripeWebhook.StatusToken != "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error": "Unauthorized"}`))
+
+	return true
+}
+
+// redactStripeID keeps the prefix and the last 4 characters of a Stripe object
+// ID, enough to tell events apart without revealing the objects
+func redactStripeID(id string) string {
+	prefix, rest, ok := strings.Cut(id, "_")
+	if !ok || len(rest) <= 4 {
+		return "***"
+	}
+
+	return prefix + "_***" + rest[len(rest)-4:]
+}
+
+// redactWebhookEvents returns a copy of events with the Stripe object IDs in
+// their ID and error redacted
+func redactWebhookEvents(events []WebhookEvent) []WebhookEvent {
+	redacted := make([]WebhookEvent, len(events))
+	for i, event := range events {
+		event.ID = redactStripeID(event.ID)
+		event.Error = stripeObjectIDPattern.ReplaceAllStringFunc(event.Error, redactStripeID)
+		redacted[i] = event
+	}
+
+	return redacted
+}
+
+// SetRedactIDs sets whether the endpoints listing webhook events redact the
+// Stripe object IDs in them
+func (wh *WebhookHandler) SetRedactIDs(redact bool) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.redactIDs = redact
+}
+
+// presentEvents returns events as the endpoints listing them show them
+func (wh *WebhookHandler) presentEvents(events []WebhookEvent) []WebhookEvent {
+	wh.mu.RLock()
+	redact := wh.redactIDs
+	wh.mu.RUnlock()
+
+	if redact {
+		return redactWebhookEvents(events)
+	}
+
+	return events
+}
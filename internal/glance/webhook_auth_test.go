@@ -0,0 +1,71 @@
+package glance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleUnauthorizedWebhookAPIResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		requiresAuth  bool
+		token         string
+		authorization string
+		wantCode      int // 0 when authorized
+	}{
+		{name: "open without auth or token"},
+		{name: "token", token: "s3cret", authorization: "Bearer s3cret"},
+		{name: "wrong token", token: "s3cret", authorization: "Bearer guess", wantCode: http.StatusUnauthorized},
+		{name: "missing token", token: "s3cret", wantCode: http.StatusUnauthorized},
+		{name: "token without scheme", token: "s3cret", authorization: "s3cret", wantCode: http.StatusUnauthorized},
+		{name: "token with dashboard auth", requiresAuth: true, token: "s3cret", authorization: "Bearer s3cret"},
+		{name: "dashboard auth without login", requiresAuth: true, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{RequiresAuth: tt.requiresAuth}
+			app.Config.StripeWebhook.StatusToken = tt.token
+
+			request := httptest.NewRequest(http.MethodGet, "/api/stripe/webhook/status", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			unauthorized := app.handleUnauthorizedWebhookAPIResponse(rec, request)
+			if unauthorized != (tt.wantCode != 0) {
+				t.Fatalf("expected unauthorized %v, got %v", tt.wantCode != 0, unauthorized)
+			}
+
+			if unauthorized && rec.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d", tt.wantCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRedactWebhookEvents(t *testing.T) {
+	events := []WebhookEvent{
+		{ID: "evt_1NxyzAbCdEf", Error: "failed to update sub_1Qabc123 of cus_9XyZw8 with amount_due 4900"},
+		{ID: "evt_1"},
+	}
+
+	redacted := redactWebhookEvents(events)
+	if redacted[0].ID != "evt_***CdEf" {
+		t.Errorf("unexpected redacted ID: %s", redacted[0].ID)
+	}
+
+	if expected := "failed to update sub_***c123 of cus_***yZw8 with amount_due 4900"; redacted[0].Error != expected {
+		t.Errorf("expected %q, got %q", expected, redacted[0].Error)
+	}
+
+	if redacted[1].ID != "***" {
+		t.Errorf("expected short IDs to be fully redacted, got %s", redacted[1].ID)
+	}
+
+	if events[0].ID != "evt_1NxyzAbCdEf" {
+		t.Error("expected the events not to be modified")
+	}
+}
@@ -0,0 +1,317 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// defaultWebhookMaxDeadLetters is how many events that ran out of attempts
+// are kept unless stripe-webhook max-dead-letters is set
+const defaultWebhookMaxDeadLetters = 100
+
+var errUnknownDeadLetter = errors.New("dead letter not found")
+
+// WebhookAttemptError is the error of a failed run of the handlers of an event
+type WebhookAttemptError struct {
+	Attempt int       `json:"attempt"`
+	At      time.Time `json:"at"`
+	Error   string    `json:"error"`
+}
+
+// WebhookDeadLetter is an event whose handlers still failed after the last
+// attempt
+type WebhookDeadLetter struct {
+	ID       string                `json:"id"`
+	Type     string                `json:"type"`
+	Mode     string                `json:"mode"`
+	FailedAt time.Time             `json:"failed_at"`
+	Attempts int                   `json:"attempts"`
+	Errors   []WebhookAttemptError `json:"errors"`            // oldest first
+	Payload  json.RawMessage       `json:"payload,omitempty"` // the object of the event, left out with redact-ids
+}
+
+// webhookDeadLetter keeps what's needed to requeue a dead letter
+type webhookDeadLetter struct {
+	WebhookDeadLetter
+	event    stripe.Event
+	handlers []EventHandlerFunc // the ones that failed
+}
+
+// SetMaxDeadLetters sets how many dead letters are kept before the oldest are
+// evicted
+func (wh *WebhookHandler) SetMaxDeadLetters(maxDeadLetters int) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.maxDeadLetters = max(1, maxDeadLetters)
+	wh.evictDeadLetters()
+}
+
+// evictDeadLetters drops the oldest dead letters over the limit, with mu held
+func (wh *WebhookHandler) evictDeadLetters() {
+	limit := wh.maxDeadLetters
+	if limit == 0 {
+		limit = defaultWebhookMaxDeadLetters
+	}
+
+	if evicted := len(wh.deadLetters) - limit; evicted > 0 {
+		slog.Warn("Evicting the oldest webhook dead letters", "evicted", evicted, "max_dead_letters", limit)
+		wh.deadLetters = slices.Delete(wh.deadLetters, 0, evicted)
+	}
+}
+
+// deadLetter gives up on an event, keeping it to be inspected, deleted or
+// requeued
+func (wh *WebhookHandler) deadLetter(retry webhookRetry) {
+	slog.Error("Giving up on webhook event",
+		"event_id", retry.event.ID,
+		"event_type", retry.event.Type,
+		"attempts", retry.attempts,
+		"error", retry.err)
+	wh.metrics.countEvent(string(retry.event.Type), webhookOutcomeDeadLettered)
+
+	event := WebhookEvent{
+		ID:        retry.event.ID,
+		Type:      string(retry.event.Type),
+		Mode:      webhookEventMode(retry.event),
+		Processed: time.Now(),
+		Error:     retry.err.Error(),
+		Attempts:  retry.attempts,
+	}
+
+	deadLetter := &webhookDeadLetter{
+		WebhookDeadLetter: WebhookDeadLetter{
+			ID:       event.ID,
+			Type:     event.Type,
+			Mode:     event.Mode,
+			FailedAt: event.Processed,
+			Attempts: retry.attempts,
+			Errors:   retry.history,
+		},
+		event:    retry.event,
+		handlers: retry.handlers,
+	}
+	if retry.event.Data != nil {
+		deadLetter.Payload = retry.event.Data.Raw
+	}
+
+	wh.mu.Lock()
+	// An event requeued and failing again replaces its previous dead letter
+	wh.deadLetters = slices.DeleteFunc(wh.deadLetters, func(existing *webhookDeadLetter) bool {
+		return existing.ID != "" && existing.ID == deadLetter.ID
+	})
+	wh.deadLetters = append(wh.deadLetters, deadLetter)
+	wh.evictDeadLetters()
+	wh.mu.Unlock()
+
+	wh.logEvent(event)
+}
+
+// GetDeadLetters returns the events whose handlers still failed after the
+// last attempt, as logged
+func (wh *WebhookHandler) GetDeadLetters() []WebhookEvent {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	events := make([]WebhookEvent, len(wh.deadLetters))
+	for i, deadLetter := range wh.deadLetters {
+		var lastError string
+		if len(deadLetter.Errors) > 0 {
+			lastError = deadLetter.Errors[len(deadLetter.Errors)-1].Error
+		}
+
+		events[i] = WebhookEvent{
+			ID:        deadLetter.ID,
+			Type:      deadLetter.Type,
+			Mode:      deadLetter.Mode,
+			Processed: deadLetter.FailedAt,
+			Error:     lastError,
+			Attempts:  deadLetter.Attempts,
+		}
+	}
+
+	return events
+}
+
+// GetDeadLetterQueue returns the dead letters with their error history and
+// payload, oldest first
+func (wh *WebhookHandler) GetDeadLetterQueue() []WebhookDeadLetter {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	deadLetters := make([]WebhookDeadLetter, len(wh.deadLetters))
+	for i, deadLetter := range wh.deadLetters {
+		deadLetters[i] = deadLetter.WebhookDeadLetter
+		deadLetters[i].Errors = slices.Clone(deadLetter.Errors)
+	}
+
+	return deadLetters
+}
+
+// takeDeadLetter removes the dead letter of the event id and returns it
+func (wh *WebhookHandler) takeDeadLetter(id string) (*webhookDeadLetter, error) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	index := slices.IndexFunc(wh.deadLetters, func(deadLetter *webhookDeadLetter) bool {
+		return deadLetter.ID == id
+	})
+	if index < 0 {
+		return nil, errUnknownDeadLetter
+	}
+
+	deadLetter := wh.deadLetters[index]
+	wh.deadLetters = slices.Delete(wh.deadLetters, index, index+1)
+	return deadLetter, nil
+}
+
+// DeleteDeadLetter drops the dead letter of the event id without processing it
+func (wh *WebhookHandler) DeleteDeadLetter(id string) error {
+	if _, err := wh.takeDeadLetter(id); err != nil {
+		return err
+	}
+
+	slog.Info("Deleted webhook dead letter", "event_id", id)
+	return nil
+}
+
+// RequeueDeadLetter runs the failed handlers of the dead letter of the event
+// id again in the background, with max-attempts more attempts before it's
+// dead-lettered again
+func (wh *WebhookHandler) RequeueDeadLetter(id string) error {
+	deadLetter, err := wh.takeDeadLetter(id)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Requeued webhook dead letter", "event_id", id, "event_type", deadLetter.Type)
+
+	retry := webhookRetry{
+		event:    deadLetter.event,
+		handlers: deadLetter.handlers,
+		history:  deadLetter.Errors,
+	}
+	if !globalPause.deferWhilePaused(func() { wh.retryEvent(retry) }) {
+		go wh.retryEvent(retry)
+	}
+
+	return nil
+}
+
+// presentDeadLetters returns deadLetters as the dead letter endpoint shows
+// them, without payloads when IDs are redacted since they're full of them
+func (wh *WebhookHandler) presentDeadLetters(deadLetters []WebhookDeadLetter) []WebhookDeadLetter {
+	wh.mu.RLock()
+	redact := wh.redactIDs
+	wh.mu.RUnlock()
+
+	if !redact {
+		return deadLetters
+	}
+
+	for i := range deadLetters {
+		deadLetters[i].ID = redactStripeID(deadLetters[i].ID)
+		deadLetters[i].Payload = nil
+		for j := range deadLetters[i].Errors {
+			deadLetters[i].Errors[j].Error = stripeObjectIDPattern.ReplaceAllStringFunc(deadLetters[i].Errors[j].Error, redactStripeID)
+		}
+	}
+
+	return deadLetters
+}
+
+// WebhookDeadLettersResponse is the response of the dead letter endpoint
+type WebhookDeadLettersResponse struct {
+	DeadLetters    []WebhookDeadLetter `json:"dead_letters"`
+	Count          int                 `json:"count"`
+	MaxDeadLetters int                 `json:"max_dead_letters"`
+}
+
+func (a *application) handleDeadLettersRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedWebhookAPIResponse(w, r) {
+		return
+	}
+
+	handler := a.webhookHandler
+	deadLetters := handler.GetDeadLetterQueue()
+
+	handler.mu.RLock()
+	maxDeadLetters := handler.maxDeadLetters
+	handler.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&WebhookDeadLettersResponse{
+		DeadLetters:    handler.presentDeadLetters(deadLetters),
+		Count:          len(deadLetters),
+		MaxDeadLetters: maxDeadLetters,
+	})
+}
+
+func (a *application) handleDeleteDeadLetterRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedWebhookAPIResponse(w, r) {
+		return
+	}
+
+	if err := a.webhookHandler.DeleteDeadLetter(r.PathValue("event")); err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *application) handleRequeueDeadLetterRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedWebhookAPIResponse(w, r) {
+		return
+	}
+
+	if err := a.webhookHandler.RequeueDeadLetter(r.PathValue("event")); err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// WebhookHealthDetails holds the details of the webhooks health check
+type WebhookHealthDetails struct {
+	DeadLetters    int `json:"dead_letters"`
+	MaxDeadLetters int `json:"max_dead_letters"`
+	PendingRetries int `json:"pending_retries"`
+}
+
+// newWebhookHealthCheck reports webhooks as degraded while events that ran
+// out of attempts are waiting in the dead letter queue
+func newWebhookHealthCheck(handler *WebhookHandler) HealthCheckFunc {
+	return func(ctx context.Context) *HealthCheckResult {
+		handler.mu.RLock()
+		details := &WebhookHealthDetails{
+			DeadLetters:    len(handler.deadLetters),
+			MaxDeadLetters: handler.maxDeadLetters,
+			PendingRetries: int(handler.pendingRetries.Load()),
+		}
+		handler.mu.RUnlock()
+
+		if details.DeadLetters > 0 {
+			return &HealthCheckResult{
+				Status:  HealthStatusDegraded,
+				Message: fmt.Sprintf("%d webhook events failed every attempt", details.DeadLetters),
+				Details: details,
+			}
+		}
+
+		return &HealthCheckResult{
+			Status:  HealthStatusHealthy,
+			Message: "No failed webhook events",
+			Details: details,
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func deadLetterTestEvent(t *testing.T, id string) stripe.Event {
+	return stripe.Event{
+		ID:   id + "_" + time.Now().Format(time.RFC3339Nano),
+		Type: "customer.updated",
+		Data: &stripe.EventData{Raw: json.RawMessage(`{"id": "cus_1"}`)},
+	}
+}
+
+func TestWebhookHandler_KeepsDeadLetterHistory(t *testing.T) {
+	handler := newRetryTestHandler(2, time.Millisecond)
+
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		if runs.Add(1) == 1 {
+			return errors.New("database unavailable")
+		}
+		return errors.New("still unavailable")
+	})
+
+	event := deadLetterTestEvent(t, "evt_history")
+	handler.processEvent(event)
+	waitFor(t, "the event to be dead-lettered", func() bool { return len(handler.GetDeadLetterQueue()) == 1 })
+
+	deadLetter := handler.GetDeadLetterQueue()[0]
+	if deadLetter.ID != event.ID || deadLetter.Attempts != 2 || string(deadLetter.Payload) != `{"id": "cus_1"}` {
+		t.Errorf("unexpected dead letter %+v", deadLetter)
+	}
+
+	if len(deadLetter.Errors) != 2 || deadLetter.Errors[0].Error != "database unavailable" || deadLetter.Errors[1].Attempt != 2 {
+		t.Errorf("expected the error of each attempt, got %+v", deadLetter.Errors)
+	}
+
+	if summary := handler.GetDeadLetters(); len(summary) != 1 || summary[0].Error != "still unavailable" {
+		t.Errorf("expected the last error in the summary, got %+v", summary)
+	}
+}
+
+func TestWebhookHandler_EvictsOldestDeadLetters(t *testing.T) {
+	handler := newRetryTestHandler(1, time.Millisecond)
+	handler.SetMaxDeadLetters(2)
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		return errors.New("database unavailable")
+	})
+
+	var ids []string
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		event := deadLetterTestEvent(t, id)
+		ids = append(ids, event.ID)
+		handler.processEvent(event)
+	}
+
+	deadLetters := handler.GetDeadLetterQueue()
+	if len(deadLetters) != 2 || deadLetters[0].ID != ids[1] || deadLetters[1].ID != ids[2] {
+		t.Errorf("expected the 2 newest dead letters, got %+v", deadLetters)
+	}
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	handler := newRetryTestHandler(1, time.Millisecond)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		runs.Add(1)
+		if failing.Load() {
+			return errors.New("transient bug")
+		}
+		return nil
+	})
+
+	app := &application{webhookHandler: handler}
+	requeued, deleted := deadLetterTestEvent(t, "evt_requeued"), deadLetterTestEvent(t, "evt_deleted")
+	handler.processEvent(requeued)
+	handler.processEvent(deleted)
+
+	health := newWebhookHealthCheck(handler)(context.Background())
+	if health.Status != HealthStatusDegraded {
+		t.Errorf("expected webhooks to be degraded with dead letters, got %s", health.Status)
+	}
+
+	request := func(method, path, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.SetPathValue("event", id)
+		rec := httptest.NewRecorder()
+
+		switch method {
+		case http.MethodGet:
+			app.handleDeadLettersRequest(rec, r)
+		case http.MethodDelete:
+			app.handleDeleteDeadLetterRequest(rec, r)
+		case http.MethodPost:
+			app.handleRequeueDeadLetterRequest(rec, r)
+		}
+
+		return rec
+	}
+
+	rec := request(http.MethodGet, stripeWebhookPath+"/dead-letter", "")
+	var response WebhookDeadLettersResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if response.Count != 2 || len(response.DeadLetters) != 2 || response.DeadLetters[0].Payload == nil {
+		t.Errorf("expected 2 dead letters with payloads, got %+v", response)
+	}
+
+	if rec := request(http.MethodDelete, stripeWebhookPath+"/dead-letter/"+deleted.ID, deleted.ID); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+
+	failing.Store(false)
+	if rec := request(http.MethodPost, stripeWebhookPath+"/dead-letter/"+requeued.ID+"/requeue", requeued.ID); rec.Code != http.StatusAccepted {
+		t.Errorf("expected 202, got %d", rec.Code)
+	}
+
+	waitFor(t, "the requeued event to succeed", func() bool {
+		for _, logged := range handler.GetEventLog() {
+			if logged.ID == requeued.ID && logged.Success {
+				return true
+			}
+		}
+		return false
+	})
+
+	if deadLetters := handler.GetDeadLetterQueue(); len(deadLetters) != 0 {
+		t.Errorf("expected no dead letters left, got %+v", deadLetters)
+	}
+
+	if rec := request(http.MethodDelete, stripeWebhookPath+"/dead-letter/"+deleted.ID, deleted.ID); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted dead letter, got %d", rec.Code)
+	}
+
+	if health := newWebhookHealthCheck(handler)(context.Background()); health.Status != HealthStatusHealthy {
+		t.Errorf("expected webhooks to be healthy again, got %s", health.Status)
+	}
+}
@@ -0,0 +1,86 @@
+package glance
+
+import (
+	"container/list"
+	"context"
+)
+
+// maxProcessedEvents is how many webhook event IDs are remembered to skip
+// redeliveries of, enough for the retries Stripe makes over up to three days
+const maxProcessedEvents = 10000
+
+// processedEvents remembers the IDs of the most recently processed webhook
+// events, evicting the least recently seen once full
+type processedEvents struct {
+	capacity int
+	order    *list.List // of event IDs, the most recently seen first
+	byID     map[string]*list.Element
+}
+
+func newProcessedEvents(capacity int) *processedEvents {
+	return &processedEvents{
+		capacity: capacity,
+		order:    list.New(),
+		byID:     make(map[string]*list.Element),
+	}
+}
+
+// mark records id as processed, returning false when it already was
+func (p *processedEvents) mark(id string) bool {
+	if element, ok := p.byID[id]; ok {
+		p.order.MoveToFront(element)
+		return false
+	}
+
+	p.byID[id] = p.order.PushFront(id)
+	for p.order.Len() > p.capacity {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.byID, oldest.Value.(string))
+	}
+
+	return true
+}
+
+// forget removes id, so that it is processed again when seen next
+func (p *processedEvents) forget(id string) {
+	if element, ok := p.byID[id]; ok {
+		p.order.Remove(element)
+		delete(p.byID, id)
+	}
+}
+
+// ids returns the remembered IDs, the least recently seen first, in the order
+// to mark them in again
+func (p *processedEvents) ids() []string {
+	ids := make([]string, 0, p.order.Len())
+	for element := p.order.Back(); element != nil; element = element.Prev() {
+		ids = append(ids, element.Value.(string))
+	}
+
+	return ids
+}
+
+// MarkEventProcessed records the ID of a webhook event about to be processed,
+// returning false when it was already processed and this is a redelivery.
+// Events without an ID are always processed.
+func (db *SimpleMetricsDB) MarkEventProcessed(ctx context.Context, eventID string) bool {
+	if eventID == "" {
+		return true
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.processedEvents.mark(eventID)
+}
+
+// ForgetEventProcessed removes the ID of a webhook event whose handlers failed
+// and that Stripe will redeliver, so that the redelivery is processed instead
+// of being skipped when a restart lost the handlers awaiting it
+func (db *SimpleMetricsDB) ForgetEventProcessed(ctx context.Context, eventID string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.processedEvents.forget(eventID)
+}
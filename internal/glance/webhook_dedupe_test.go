@@ -0,0 +1,100 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestProcessedEvents_EvictsLeastRecentlySeen(t *testing.T) {
+	processed := newProcessedEvents(3)
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		if !processed.mark(id) {
+			t.Errorf("expected %s to be new", id)
+		}
+	}
+
+	// Seen again, so evt_2 is evicted instead
+	if processed.mark("evt_1") {
+		t.Error("expected evt_1 to be a duplicate")
+	}
+	processed.mark("evt_4")
+
+	if expected := []string{"evt_3", "evt_1", "evt_4"}; !slices.Equal(processed.ids(), expected) {
+		t.Errorf("expected %v, got %v", expected, processed.ids())
+	}
+
+	if !processed.mark("evt_2") {
+		t.Error("expected the evicted evt_2 to be new again")
+	}
+}
+
+func TestSimpleMetricsDB_PersistsProcessedEvents(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	db := newSimpleMetricsDB()
+	if err := db.SetPersistence(path, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	db.MarkEventProcessed(ctx, "evt_1")
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded := newSimpleMetricsDB()
+	loaded.MarkEventProcessed(ctx, "evt_2")
+	if err := loaded.SetPersistence(path, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, id := range []string{"evt_1", "evt_2"} {
+		if loaded.MarkEventProcessed(ctx, id) {
+			t.Errorf("expected %s to be remembered across the restart", id)
+		}
+	}
+
+	if !loaded.MarkEventProcessed(ctx, "") || !loaded.MarkEventProcessed(ctx, "") {
+		t.Error("expected events without an ID to always be processed")
+	}
+}
+
+func TestWebhookHandler_SkipsDuplicateEvents(t *testing.T) {
+	ctx := context.Background()
+	db := GetSimpleMetricsDB()
+	db.PurgeMode(ctx, "test")
+	defer db.PurgeMode(ctx, "test")
+
+	handler := &WebhookHandler{eventHandlers: make(map[string][]EventHandlerFunc), maxEventLog: 10}
+	handler.RegisterHandler("customer.created", handleCustomerCreated)
+
+	event := stripe.Event{
+		ID:   "evt_dedupe_" + time.Now().Format(time.RFC3339Nano),
+		Type: "customer.created",
+		Data: &stripe.EventData{Raw: json.RawMessage(`{"id": "cus_dedupe"}`)},
+	}
+
+	// A retry of an event Stripe didn't see acknowledged
+	handler.processEvent(event)
+	handler.processEvent(event)
+
+	now := time.Now()
+	sum, _ := db.SumDeltas(ctx, "test", now.Add(-time.Hour), now.Add(time.Minute))
+	if sum.NewCustomers != 1 {
+		t.Errorf("expected the customer to be counted once, got %d", sum.NewCustomers)
+	}
+
+	eventLog := handler.GetEventLog()
+	if len(eventLog) != 2 || eventLog[0].Duplicate || !eventLog[1].Duplicate {
+		t.Errorf("expected the retry to be logged as a duplicate, got %+v", eventLog)
+	}
+
+	if duplicates := countDuplicateEvents(eventLog); duplicates != 1 {
+		t.Errorf("expected 1 duplicate, got %d", duplicates)
+	}
+}
@@ -0,0 +1,149 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxStoredWebhookEvents is how many webhook events the metrics store
+	// keeps, against the last 100 kept by the webhook handler without one
+	maxStoredWebhookEvents = 10000
+
+	webhookEventsDefaultLimit = 100
+	webhookEventsMaxLimit     = 1000
+)
+
+// SaveWebhookEvent adds event to the webhook events kept by the store
+func (db *SimpleMetricsDB) SaveWebhookEvent(ctx context.Context, event WebhookEvent) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.webhookEvents = append(db.webhookEvents, event)
+	if len(db.webhookEvents) > maxStoredWebhookEvents {
+		db.webhookEvents = db.webhookEvents[len(db.webhookEvents)-maxStoredWebhookEvents:]
+	}
+}
+
+// GetWebhookEvents returns the webhook events kept by the store, oldest first
+func (db *SimpleMetricsDB) GetWebhookEvents(ctx context.Context) []WebhookEvent {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return slices.Clone(db.webhookEvents)
+}
+
+// SetEventStore keeps the event log in db, which holds more events than the
+// handler and outlives it across config reloads
+func (wh *WebhookHandler) SetEventStore(db *SimpleMetricsDB) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.eventStore = db
+}
+
+// webhookEventQuery holds the validated parameters of a webhook status request
+type webhookEventQuery struct {
+	eventType string
+	success   *bool // either outcome when nil
+	since     time.Time
+	limit     int
+	offset    int
+}
+
+// parseWebhookEventQuery validates the type, success, since, limit and offset
+// parameters
+func parseWebhookEventQuery(values url.Values) (*webhookEventQuery, error) {
+	query := &webhookEventQuery{
+		eventType: values.Get("type"),
+		limit:     webhookEventsDefaultLimit,
+	}
+
+	if value := values.Get("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("success must be true or false, got: %s", value)
+		}
+		query.success = &success
+	}
+
+	if value := values.Get("since"); value != "" {
+		since, err := parseHistoryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("since must be an RFC 3339 timestamp or YYYY-MM-DD date, got: %s", value)
+		}
+		query.since = since
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > webhookEventsMaxLimit {
+			return nil, fmt.Errorf("limit must be a number between 1 and %d", webhookEventsMaxLimit)
+		}
+		query.limit = limit
+	}
+
+	if value := values.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("offset must be a number of at least 0")
+		}
+		query.offset = offset
+	}
+
+	return query, nil
+}
+
+func (q *webhookEventQuery) matches(event *WebhookEvent) bool {
+	if q.eventType != "" && event.Type != q.eventType {
+		return false
+	}
+
+	if q.success != nil && event.Success != *q.success {
+		return false
+	}
+
+	return q.since.IsZero() || !event.Processed.Before(q.since)
+}
+
+// webhookEventPage is the events of a webhook status request with the counts
+// of all the events matching it
+type webhookEventPage struct {
+	events     []WebhookEvent // newest first
+	total      int
+	failed     int
+	duplicates int
+	byType     map[string]int
+}
+
+// queryWebhookEvents filters events, oldest first, and returns the page of q
+// with the newest first
+func queryWebhookEvents(events []WebhookEvent, q *webhookEventQuery) *webhookEventPage {
+	page := &webhookEventPage{events: []WebhookEvent{}, byType: make(map[string]int)}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := &events[i]
+		if !q.matches(event) {
+			continue
+		}
+
+		if page.total >= q.offset && len(page.events) < q.limit {
+			page.events = append(page.events, *event)
+		}
+
+		page.total++
+		page.byType[event.Type]++
+		if !event.Success {
+			page.failed++
+		}
+		if event.Duplicate {
+			page.duplicates++
+		}
+	}
+
+	return page
+}
@@ -0,0 +1,135 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseWebhookEventQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "defaults", query: ""},
+		{name: "all parameters", query: "type=charge.refunded&success=false&since=2026-01-02&limit=50&offset=100"},
+		{name: "since timestamp", query: "since=2026-01-02T03:04:05Z"},
+		{name: "invalid success", query: "success=maybe", wantErr: true},
+		{name: "invalid since", query: "since=yesterday", wantErr: true},
+		{name: "limit too high", query: "limit=1001", wantErr: true},
+		{name: "limit zero", query: "limit=0", wantErr: true},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			query, err := parseWebhookEventQuery(values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if tt.name == "defaults" && (query.limit != webhookEventsDefaultLimit || query.offset != 0 || query.success != nil) {
+				t.Errorf("unexpected defaults: %+v", query)
+			}
+		})
+	}
+}
+
+func TestQueryWebhookEvents_FiltersAndPaginates(t *testing.T) {
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	var events []WebhookEvent
+	for i := range 10 {
+		eventType := "customer.created"
+		if i%2 == 1 {
+			eventType = "charge.refunded"
+		}
+
+		events = append(events, WebhookEvent{
+			ID:        fmt.Sprintf("evt_%d", i),
+			Type:      eventType,
+			Processed: start.Add(time.Duration(i) * time.Hour),
+			Success:   i%3 != 0,
+		})
+	}
+
+	success := true
+	page := queryWebhookEvents(events, &webhookEventQuery{
+		success: &success,
+		since:   start.Add(2 * time.Hour),
+		limit:   2,
+		offset:  1,
+	})
+
+	// evt_2, evt_4, evt_5, evt_7 and evt_8 succeeded from the third hour on
+	if page.total != 5 || page.failed != 0 {
+		t.Errorf("expected 5 matching events without failures, got %d and %d", page.total, page.failed)
+	}
+
+	if page.byType["customer.created"] != 3 || page.byType["charge.refunded"] != 2 {
+		t.Errorf("unexpected counts by type: %v", page.byType)
+	}
+
+	if len(page.events) != 2 || page.events[0].ID != "evt_7" || page.events[1].ID != "evt_5" {
+		t.Errorf("expected evt_7 and evt_5, newest first, got %+v", page.events)
+	}
+
+	page = queryWebhookEvents(events, &webhookEventQuery{eventType: "charge.refunded", limit: 10, offset: 20})
+	if page.total != 5 || page.failed != 2 || len(page.events) != 0 {
+		t.Errorf("expected 5 refunds with 2 failed and an empty page, got %d, %d and %+v", page.total, page.failed, page.events)
+	}
+}
+
+func TestWebhookHandler_EventStoreKeepsMoreEvents(t *testing.T) {
+	handler := &WebhookHandler{maxEventLog: 10}
+	handler.SetEventStore(newSimpleMetricsDB())
+
+	for i := range 150 {
+		handler.logEvent(WebhookEvent{ID: fmt.Sprintf("evt_%d", i), Type: "customer.created", Success: true, Processed: time.Now()})
+	}
+
+	if eventLog := handler.GetEventLog(); len(eventLog) != 150 || eventLog[0].ID != "evt_0" {
+		t.Fatalf("expected all 150 events from the store, got %d", len(eventLog))
+	}
+
+	rec := httptest.NewRecorder()
+	WebhookStatusHandler(handler)(rec, httptest.NewRequest(http.MethodGet, "/api/stripe/webhook/status?limit=20&offset=130", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var status WebhookStatusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if status.TotalEvents != 150 || len(status.RecentEvents) != 20 || status.RecentEvents[19].ID != "evt_0" {
+		t.Errorf("expected the oldest 20 of 150 events, got %d of %d", len(status.RecentEvents), status.TotalEvents)
+	}
+
+	rec = httptest.NewRecorder()
+	WebhookStatusHandler(handler)(rec, httptest.NewRequest(http.MethodGet, "/api/stripe/webhook/status?success=nope", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid parameter, got %d", rec.Code)
+	}
+}
+
+func TestSimpleMetricsDB_CapsWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	for i := range maxStoredWebhookEvents + 5 {
+		db.SaveWebhookEvent(ctx, WebhookEvent{ID: fmt.Sprintf("evt_%d", i)})
+	}
+
+	events := db.GetWebhookEvents(ctx)
+	if len(events) != maxStoredWebhookEvents || events[0].ID != "evt_5" {
+		t.Errorf("expected the last %d events from evt_5, got %d from %s", maxStoredWebhookEvents, len(events), events[0].ID)
+	}
+}
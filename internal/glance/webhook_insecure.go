@@ -0,0 +1,95 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+var errInvalidWebhookPayload = errors.New("payload is not a Stripe event")
+
+// isLiveStripeKey reports whether key is a secret or restricted key of live
+// mode
+func isLiveStripeKey(key string) bool {
+	return strings.HasPrefix(key, "sk_live_") || strings.HasPrefix(key, "rk_live_")
+}
+
+// checkInsecureSkipVerify refuses stripe-webhook insecure-skip-verify when
+// anything points at live mode, so that it can't be turned on in production
+// however the config is templated
+func checkInsecureSkipVerify(widgets map[uint64]widget, secrets []webhookSecret) error {
+	if isLiveStripeKey(os.Getenv("STRIPE_SECRET_KEY")) {
+		return errors.New("stripe-webhook insecure-skip-verify can't be used with a live STRIPE_SECRET_KEY")
+	}
+
+	for _, secret := range secrets {
+		if secret.Mode == "live" {
+			return errors.New("stripe-webhook insecure-skip-verify can't be used with a live webhook secret")
+		}
+	}
+
+	if slices.Contains(widgetStripeModes(widgets), "live") {
+		return errors.New("stripe-webhook insecure-skip-verify can't be used with live stripe-mode widgets")
+	}
+
+	encService, err := GetEncryptionService()
+	if err != nil {
+		return fmt.Errorf("checking the stripe-api-key of widgets for insecure-skip-verify: %w", err)
+	}
+
+	for _, widget := range widgets {
+		var apiKey string
+		switch widget := widget.(type) {
+		case *revenueWidget:
+			apiKey = widget.StripeAPIKey
+		case *customersWidget:
+			apiKey = widget.StripeAPIKey
+		default:
+			continue
+		}
+
+		apiKey, err := encService.DecryptIfNeeded(apiKey)
+		if err != nil {
+			return fmt.Errorf("checking the stripe-api-key of widgets for insecure-skip-verify: %w", err)
+		}
+
+		if isLiveStripeKey(apiKey) {
+			return errors.New("stripe-webhook insecure-skip-verify can't be used with a live stripe-api-key")
+		}
+	}
+
+	return nil
+}
+
+// parseUnverifiedWebhookEvent reads payload as an event without checking its
+// signature, for insecure-skip-verify
+func parseUnverifiedWebhookEvent(payload []byte) (stripe.Event, error) {
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return stripe.Event{}, fmt.Errorf("%w: %v", errInvalidWebhookPayload, err)
+	}
+
+	if event.ID == "" || event.Type == "" {
+		return stripe.Event{}, fmt.Errorf("%w: id and type are required", errInvalidWebhookPayload)
+	}
+
+	return event, nil
+}
+
+// SetInsecureSkipVerify accepts deliveries without checking their signature,
+// for sending sample events while developing handlers
+func (wh *WebhookHandler) SetInsecureSkipVerify(skip bool) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.skipVerify = skip
+	if skip {
+		slog.Warn("!!! Webhook signatures are NOT verified, anyone who can reach the endpoint can send events. Only use stripe-webhook insecure-skip-verify for local development !!!")
+	}
+}
@@ -0,0 +1,73 @@
+package glance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckInsecureSkipVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		envKey    string
+		secrets   []webhookSecret
+		widget    widget
+		wantError bool
+	}{
+		{name: "test widgets", widget: &revenueWidget{StripeMode: "test", StripeAPIKey: "sk_test_123"}},
+		{name: "test environment key", envKey: "sk_test_123"},
+		{name: "live environment key", envKey: "sk_live_123", wantError: true},
+		{name: "live restricted key", envKey: "rk_live_123", wantError: true},
+		{name: "live webhook secret", secrets: []webhookSecret{{Secret: "whsec_1", Mode: "live"}}, wantError: true},
+		{name: "live widget", widget: &customersWidget{StripeMode: "live", StripeAPIKey: "sk_test_123"}, wantError: true},
+		{name: "live key of a test widget", widget: &revenueWidget{StripeMode: "test", StripeAPIKey: "sk_live_123"}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STRIPE_SECRET_KEY", tt.envKey)
+
+			widgets := make(map[uint64]widget)
+			if tt.widget != nil {
+				widgets[1] = tt.widget
+			}
+
+			if err := checkInsecureSkipVerify(widgets, tt.secrets); (err != nil) != tt.wantError {
+				t.Errorf("expected an error %v, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_InsecureSkipVerify(t *testing.T) {
+	handler := newRetryTestHandler(1, 0)
+	handler.SetInsecureSkipVerify(true)
+
+	post := func(payload string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+		recorder := httptest.NewRecorder()
+		handler.HandleWebhook(recorder, request)
+		return recorder
+	}
+
+	if recorder := post(`{"id": "evt_unsigned", "type": "customer.created", "data": {"object": {"id": "cus_1"}}}`); recorder.Code != http.StatusOK {
+		t.Errorf("expected an unsigned event to be accepted, got %d", recorder.Code)
+	}
+
+	for _, payload := range []string{`not json`, `{"type": "customer.created"}`} {
+		if recorder := post(payload); recorder.Code != http.StatusBadRequest {
+			t.Errorf("expected %d for %s, got %d", http.StatusBadRequest, payload, recorder.Code)
+		}
+	}
+
+	if reasons := handler.GetRejectionReasons(); reasons[webhookRejectedInvalidPayload] != 2 {
+		t.Errorf("expected 2 invalid payloads, got %v", reasons)
+	}
+
+	// Signatures are checked again once it's turned off
+	handler.SetInsecureSkipVerify(false)
+	if recorder := post(`{"id": "evt_unsigned_2", "type": "customer.created"}`); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d without skipping verification, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package glance
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// webhookInvalidation invalidates the caches of widget types on events of
+// the types matching a pattern, such as customer.subscription.*
+type webhookInvalidation struct {
+	Events  string   `yaml:"events"`
+	Widgets []string `yaml:"widgets"`
+}
+
+// defaultWebhookInvalidations are the widget caches the events with built-in
+// handlers affect, which configured and registered rules add to
+var defaultWebhookInvalidations = []webhookInvalidation{
+	// Failed and written off payments also make customers delinquent
+	{Events: "invoice.payment_failed", Widgets: []string{"revenue", "customers"}},
+	{Events: "invoice.marked_uncollectible", Widgets: []string{"revenue", "customers"}},
+
+	{Events: "customer.subscription.created", Widgets: []string{"revenue"}},
+	{Events: "customer.subscription.updated", Widgets: []string{"revenue"}},
+	{Events: "customer.subscription.deleted", Widgets: []string{"revenue"}},
+	{Events: "customer.subscription.trial_will_end", Widgets: []string{"revenue"}},
+	{Events: "invoice.payment_succeeded", Widgets: []string{"revenue"}},
+	{Events: "charge.refunded", Widgets: []string{"revenue"}},
+
+	{Events: "customer.created", Widgets: []string{"customers"}},
+	{Events: "customer.deleted", Widgets: []string{"customers"}},
+	{Events: "customer.updated", Widgets: []string{"customers"}},
+	{Events: "checkout.session.completed", Widgets: []string{"customers"}},
+	{Events: "payment_method.detached", Widgets: []string{"customers"}},
+}
+
+// matches reports whether the rule applies to events of eventType. A * in
+// the pattern matches any characters, dots included.
+func (rule webhookInvalidation) matches(eventType string) bool {
+	matched, _ := path.Match(rule.Events, eventType)
+	return matched
+}
+
+// validateWebhookInvalidation checks a rule of the stripe-webhook config or
+// one registered with RegisterInvalidation
+func validateWebhookInvalidation(rule webhookInvalidation) error {
+	if rule.Events == "" {
+		return fmt.Errorf("events is empty")
+	}
+
+	if _, err := path.Match(rule.Events, ""); err != nil {
+		return fmt.Errorf("events pattern %q is malformed", rule.Events)
+	}
+
+	if len(rule.Widgets) == 0 {
+		return fmt.Errorf("no widgets for events %q", rule.Events)
+	}
+
+	for _, widgetType := range rule.Widgets {
+		if newWidgetOfType(widgetType) == nil {
+			return fmt.Errorf("unknown widget type %q for events %q", widgetType, rule.Events)
+		}
+	}
+
+	return nil
+}
+
+// validateWebhookInvalidations checks the invalidations of the stripe-webhook
+// config
+func validateWebhookInvalidations(rules []webhookInvalidation) error {
+	for i, rule := range rules {
+		if err := validateWebhookInvalidation(rule); err != nil {
+			return fmt.Errorf("stripe-webhook invalidations: rule %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// RegisterInvalidation invalidates the caches of widgetTypes on events of the
+// types matching pattern, in addition to the built-in rules
+func (wh *WebhookHandler) RegisterInvalidation(pattern string, widgetTypes ...string) error {
+	rule := webhookInvalidation{Events: pattern, Widgets: widgetTypes}
+	if err := validateWebhookInvalidation(rule); err != nil {
+		return err
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.invalidations = append(wh.invalidations, rule)
+	return nil
+}
+
+// invalidatedWidgetTypes returns the widget types whose caches events of
+// eventType invalidate, in the order of the rules matching it
+func (wh *WebhookHandler) invalidatedWidgetTypes(eventType string) []string {
+	wh.mu.RLock()
+	rules := slices.Concat(defaultWebhookInvalidations, wh.invalidations)
+	wh.mu.RUnlock()
+
+	var widgetTypes []string
+	for _, rule := range rules {
+		if !rule.matches(eventType) {
+			continue
+		}
+
+		for _, widgetType := range rule.Widgets {
+			if !slices.Contains(widgetTypes, widgetType) {
+				widgetTypes = append(widgetTypes, widgetType)
+			}
+		}
+	}
+
+	return widgetTypes
+}
@@ -0,0 +1,75 @@
+package glance
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler_RegisterInvalidation(t *testing.T) {
+	invalidator := &recordingInvalidator{}
+	wh := &WebhookHandler{cacheInvalidator: invalidator}
+
+	if err := wh.RegisterInvalidation("customer.subscription.*", "custom-api", "revenue"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := wh.RegisterInvalidation("*", "monitor"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		eventType   string
+		widgetTypes []string
+	}{
+		// Merged with the built-in rule, without invalidating revenue twice
+		{"customer.subscription.updated", []string{"revenue", "custom-api", "monitor"}},
+		{"customer.subscription.paused", []string{"custom-api", "revenue", "monitor"}},
+		{"invoice.marked_uncollectible", []string{"revenue", "customers", "monitor"}},
+		{"product.created", []string{"monitor"}},
+	}
+
+	for _, tt := range tests {
+		invalidator.widgetTypes = nil
+		if err := wh.invalidateCachesForEvent(tt.eventType); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !slices.Equal(invalidator.widgetTypes, tt.widgetTypes) {
+			t.Errorf("expected %v to be invalidated on %s, got %v", tt.widgetTypes, tt.eventType, invalidator.widgetTypes)
+		}
+	}
+
+	if err := wh.RegisterInvalidation("invoice.*", "piechart"); err == nil {
+		t.Error("expected an unknown widget type to be refused")
+	}
+}
+
+func TestValidateWebhookInvalidations(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      webhookInvalidation
+		wantError string // empty when valid
+	}{
+		{name: "valid", rule: webhookInvalidation{Events: "invoice.*", Widgets: []string{"revenue", "custom-api"}}},
+		{name: "unknown widget type", rule: webhookInvalidation{Events: "invoice.*", Widgets: []string{"revenue", "piechart"}}, wantError: `rule 1: unknown widget type "piechart" for events "invoice.*"`},
+		{name: "no events", rule: webhookInvalidation{Widgets: []string{"revenue"}}, wantError: "events is empty"},
+		{name: "no widgets", rule: webhookInvalidation{Events: "invoice.*"}, wantError: "no widgets"},
+		{name: "malformed pattern", rule: webhookInvalidation{Events: "invoice.[", Widgets: []string{"revenue"}}, wantError: "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWebhookInvalidations([]webhookInvalidation{tt.rule})
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// How long the webhook event log and the payloads of events are kept unless
+// stripe-webhook event-retention and payload-retention are set. Payloads are
+// kept for less since they hold the whole event.
+const (
+	defaultWebhookEventRetention   = 30 * 24 * time.Hour
+	defaultWebhookPayloadRetention = 7 * 24 * time.Hour
+)
+
+// storedWebhookPayload is a webhook payload as saved in the metrics file
+type storedWebhookPayload struct {
+	ID string `json:"id"`
+	webhookPayload
+}
+
+// SetWebhookRetention sets how long webhook events and their payloads are
+// kept. With a payloadRetention of 0, payloads aren't saved to the metrics
+// file and can only be replayed until a restart.
+func (db *SimpleMetricsDB) SetWebhookRetention(eventRetention, payloadRetention time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.webhookEventRetention = eventRetention
+	db.webhookPayloadRetention = payloadRetention
+}
+
+// storedWebhookPayloads returns the payloads to save to the metrics file,
+// oldest first. Must be called with the lock held.
+func (db *SimpleMetricsDB) storedWebhookPayloads() []storedWebhookPayload {
+	if db.webhookPayloadRetention <= 0 {
+		return nil
+	}
+
+	payloads := make([]storedWebhookPayload, 0, len(db.webhookPayloadOrder))
+	for _, id := range db.webhookPayloadOrder {
+		payloads = append(payloads, storedWebhookPayload{ID: id, webhookPayload: db.webhookPayloads[id]})
+	}
+
+	return payloads
+}
+
+// loadWebhookLog merges the webhook events and payloads of a metrics file
+// into memory, the ones received since startup being the most recent. Must
+// be called with the lock held.
+func (db *SimpleMetricsDB) loadWebhookLog(events []WebhookEvent, payloads []storedWebhookPayload) {
+	db.webhookEvents = append(slices.Clone(events), db.webhookEvents...)
+	if len(db.webhookEvents) > maxStoredWebhookEvents {
+		db.webhookEvents = db.webhookEvents[len(db.webhookEvents)-maxStoredWebhookEvents:]
+	}
+
+	if db.webhookPayloads == nil {
+		db.webhookPayloads = make(map[string]webhookPayload)
+	}
+
+	var order []string
+	for _, payload := range payloads {
+		if _, exists := db.webhookPayloads[payload.ID]; exists || payload.ID == "" {
+			continue
+		}
+		db.webhookPayloads[payload.ID] = payload.webhookPayload
+		order = append(order, payload.ID)
+	}
+	db.webhookPayloadOrder = append(order, db.webhookPayloadOrder...)
+
+	for len(db.webhookPayloadOrder) > maxWebhookPayloads {
+		delete(db.webhookPayloads, db.webhookPayloadOrder[0])
+		db.webhookPayloadOrder = db.webhookPayloadOrder[1:]
+	}
+}
+
+// CleanupWebhookLog removes the webhook events and payloads older than their
+// retention, returning how many of each were removed
+func (db *SimpleMetricsDB) CleanupWebhookLog(ctx context.Context) (eventsRemoved, payloadsRemoved int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := db.now()
+
+	if db.webhookEventRetention > 0 {
+		cutoff := now.Add(-db.webhookEventRetention)
+		kept := slices.DeleteFunc(db.webhookEvents, func(event WebhookEvent) bool {
+			return event.Processed.Before(cutoff)
+		})
+		eventsRemoved = len(db.webhookEvents) - len(kept)
+		db.webhookEvents = kept
+	}
+
+	if db.webhookPayloadRetention > 0 {
+		cutoff := now.Add(-db.webhookPayloadRetention)
+		db.webhookPayloadOrder = slices.DeleteFunc(db.webhookPayloadOrder, func(id string) bool {
+			// Payloads saved before they had a receipt time are kept until evicted
+			received := db.webhookPayloads[id].Received
+			if received.IsZero() || !received.Before(cutoff) {
+				return false
+			}
+
+			delete(db.webhookPayloads, id)
+			payloadsRemoved++
+			return true
+		})
+	}
+
+	return eventsRemoved, payloadsRemoved
+}
+
+// newWebhookLogCleanupJob returns a background job that removes webhook
+// events and payloads older than their retention
+func newWebhookLogCleanupJob(db *SimpleMetricsDB, interval time.Duration) *backgroundJob {
+	return &backgroundJob{
+		name:    "webhook-log-cleanup",
+		nextRun: everyInterval(interval),
+		run: func(ctx context.Context) {
+			events, payloads := db.CleanupWebhookLog(ctx)
+			if events > 0 || payloads > 0 {
+				slog.Info("Cleaned up old webhook events", "events_removed", events, "payloads_removed", payloads)
+			}
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSimpleMetricsDB_PersistsWebhookLog(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name             string
+		payloadRetention time.Duration
+		wantPayload      bool
+	}{
+		{name: "with payloads", payloadRetention: defaultWebhookPayloadRetention, wantPayload: true},
+		{name: "without payloads", payloadRetention: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+
+			db := newSimpleMetricsDB()
+			db.SetWebhookRetention(defaultWebhookEventRetention, tt.payloadRetention)
+			if err := db.SetPersistence(path, false, testEncryptionService("key-a")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			db.SaveWebhookEvent(ctx, WebhookEvent{ID: "evt_before_crash", Type: "invoice.paid", Processed: time.Now(), Error: "boom"})
+			db.SaveWebhookPayload(ctx, "evt_before_crash", webhookPayload{Payload: json.RawMessage(`{"id": "evt_before_crash"}`), Livemode: true, Received: time.Now()})
+			if err := db.Persist(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Events received since the restart come after the saved ones
+			loaded := newSimpleMetricsDB()
+			loaded.SaveWebhookEvent(ctx, WebhookEvent{ID: "evt_after_restart", Type: "invoice.paid", Processed: time.Now()})
+			if err := loaded.SetPersistence(path, false, testEncryptionService("key-a")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			events := loaded.GetWebhookEvents(ctx)
+			if len(events) != 2 || events[0].ID != "evt_before_crash" || events[0].Error != "boom" || events[1].ID != "evt_after_restart" {
+				t.Errorf("expected the saved event followed by the new one, got %+v", events)
+			}
+
+			payload, exists := loaded.GetWebhookPayload(ctx, "evt_before_crash")
+			if exists != tt.wantPayload {
+				t.Fatalf("expected the payload to be saved: %v, got %v", tt.wantPayload, exists)
+			}
+
+			if exists && (!payload.Livemode || string(payload.Payload) != `{"id":"evt_before_crash"}`) {
+				t.Errorf("unexpected payload %+v", payload)
+			}
+		})
+	}
+}
+
+func TestSimpleMetricsDB_CleanupWebhookLog(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	db := newSimpleMetricsDB()
+	db.now = func() time.Time { return now }
+	db.SetWebhookRetention(30*24*time.Hour, 7*24*time.Hour)
+
+	for _, age := range []time.Duration{40 * 24 * time.Hour, 10 * 24 * time.Hour, time.Hour} {
+		id := "evt_" + age.String()
+		db.SaveWebhookEvent(ctx, WebhookEvent{ID: id, Processed: now.Add(-age)})
+		db.SaveWebhookPayload(ctx, id, webhookPayload{Payload: json.RawMessage(`{}`), Received: now.Add(-age)})
+	}
+
+	events, payloads := db.CleanupWebhookLog(ctx)
+	if events != 1 || payloads != 2 {
+		t.Errorf("expected 1 event and 2 payloads removed, got %d and %d", events, payloads)
+	}
+
+	if kept := db.GetWebhookEvents(ctx); len(kept) != 2 || kept[0].ID != "evt_240h0m0s" {
+		t.Errorf("expected the events of the last 30 days, got %+v", kept)
+	}
+
+	if _, exists := db.GetWebhookPayload(ctx, "evt_240h0m0s"); exists {
+		t.Error("expected payloads older than 7 days to be removed")
+	}
+
+	if _, exists := db.GetWebhookPayload(ctx, "evt_1h0m0s"); !exists {
+		t.Error("expected recent payloads to be kept")
+	}
+}
@@ -0,0 +1,132 @@
+package glance
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Outcomes webhook events are counted by in /api/metrics. An event whose
+// handlers failed is counted again once it's retried or dead-lettered.
+const (
+	webhookOutcomeSucceeded    = "succeeded"
+	webhookOutcomeFailed       = "failed"
+	webhookOutcomeDuplicate    = "duplicate"
+	webhookOutcomeStale        = "stale"
+	webhookOutcomeUnhandled    = "unhandled"
+	webhookOutcomeRetried      = "retried"
+	webhookOutcomeDeadLettered = "dead_lettered"
+)
+
+// webhookDurationBuckets are the upper bounds in seconds of the buckets the
+// durations of handler runs are counted in
+var webhookDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type webhookOutcomeKey struct {
+	eventType string
+	outcome   string
+}
+
+// webhookMetrics counts processed webhook events for /api/metrics, usable
+// without initializing
+type webhookMetrics struct {
+	mu            sync.Mutex
+	events        map[webhookOutcomeKey]int64
+	durations     []int64 // per bucket of webhookDurationBuckets, not cumulative
+	durationSum   float64
+	durationCount int64
+	lastEventAt   time.Time
+}
+
+// received records that an event was delivered at
+func (m *webhookMetrics) received(at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if at.After(m.lastEventAt) {
+		m.lastEventAt = at
+	}
+}
+
+func (m *webhookMetrics) countEvent(eventType, outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[webhookOutcomeKey]int64)
+	}
+	m.events[webhookOutcomeKey{eventType, outcome}]++
+}
+
+// observeDuration records how long the handlers of an event took to run
+func (m *webhookMetrics) observeDuration(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.durations == nil {
+		m.durations = make([]int64, len(webhookDurationBuckets))
+	}
+
+	seconds := duration.Seconds()
+	if bucket, _ := slices.BinarySearch(webhookDurationBuckets, seconds); bucket < len(webhookDurationBuckets) {
+		m.durations[bucket]++
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// WebhookEventCount is how many events of a type had an outcome
+type WebhookEventCount struct {
+	Type    string
+	Outcome string
+	Count   int64
+}
+
+// WebhookDurationBucket is how many handler runs took up to UpperBound seconds
+type WebhookDurationBucket struct {
+	UpperBound float64
+	Count      int64 // cumulative
+}
+
+// WebhookProcessingMetrics are the counters of processed webhook events
+type WebhookProcessingMetrics struct {
+	Events          []WebhookEventCount // by type, then outcome
+	DurationBuckets []WebhookDurationBucket
+	DurationSum     float64
+	DurationCount   int64
+	LastEventAt     time.Time // zero before the first event
+}
+
+// GetProcessingMetrics returns the counters of the events processed since
+// the handler was created
+func (wh *WebhookHandler) GetProcessingMetrics() WebhookProcessingMetrics {
+	m := &wh.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := WebhookProcessingMetrics{
+		Events:          make([]WebhookEventCount, 0, len(m.events)),
+		DurationBuckets: make([]WebhookDurationBucket, len(webhookDurationBuckets)),
+		DurationSum:     m.durationSum,
+		DurationCount:   m.durationCount,
+		LastEventAt:     m.lastEventAt,
+	}
+
+	for key, count := range m.events {
+		metrics.Events = append(metrics.Events, WebhookEventCount{Type: key.eventType, Outcome: key.outcome, Count: count})
+	}
+	slices.SortFunc(metrics.Events, func(a, b WebhookEventCount) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Outcome, b.Outcome))
+	})
+
+	var cumulative int64
+	for i, upperBound := range webhookDurationBuckets {
+		if m.durations != nil {
+			cumulative += m.durations[i]
+		}
+		metrics.DurationBuckets[i] = WebhookDurationBucket{UpperBound: upperBound, Count: cumulative}
+	}
+
+	return metrics
+}
@@ -0,0 +1,84 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestMetricsHandler_WebhookProcessing(t *testing.T) {
+	handler := newRetryTestHandler(1, time.Millisecond)
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		return nil
+	})
+	handler.RegisterHandler("invoice.paid", func(ctx context.Context, event stripe.Event) error {
+		return errors.New("database unavailable")
+	})
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		MetricsHandler(handler)(recorder, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	if body := scrape(); strings.Contains(body, "glance_webhook_last_event_timestamp_seconds") {
+		t.Error("expected no last event timestamp before the first event")
+	}
+
+	event := retryTestEvent(t)
+	handler.processEvent(event)
+	handler.processEvent(event)
+
+	failing := retryTestEvent(t)
+	failing.Type = "invoice.paid"
+	handler.processEvent(failing)
+	handler.processEvent(stripe.Event{ID: failing.ID + "_unhandled", Type: "charge.refunded"})
+
+	body := scrape()
+	if lastEventAt := handler.GetProcessingMetrics().LastEventAt; time.Since(lastEventAt) > time.Minute {
+		t.Errorf("expected the last event to have been received now, got %v", lastEventAt)
+	}
+
+	for _, metric := range []string{
+		`glance_webhook_events_total{type="customer.updated",outcome="succeeded"} 1`,
+		`glance_webhook_events_total{type="customer.updated",outcome="duplicate"} 1`,
+		`glance_webhook_events_total{type="invoice.paid",outcome="failed"} 1`,
+		`glance_webhook_events_total{type="invoice.paid",outcome="dead_lettered"} 1`,
+		`glance_webhook_events_total{type="charge.refunded",outcome="unhandled"} 1`,
+		`glance_webhook_handler_duration_seconds_bucket{le="+Inf"} 2`,
+		"glance_webhook_handler_duration_seconds_count 2",
+		fmt.Sprintf("glance_webhook_last_event_timestamp_seconds %d", handler.GetProcessingMetrics().LastEventAt.Unix()),
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("expected %q in the metrics", metric)
+		}
+	}
+}
+
+func TestWebhookMetrics_DurationBuckets(t *testing.T) {
+	handler := &WebhookHandler{}
+	handler.metrics.observeDuration(5 * time.Millisecond)
+	handler.metrics.observeDuration(300 * time.Millisecond)
+	handler.metrics.observeDuration(time.Minute)
+
+	metrics := handler.GetProcessingMetrics()
+	counts := make(map[float64]int64)
+	for _, bucket := range metrics.DurationBuckets {
+		counts[bucket.UpperBound] = bucket.Count
+	}
+
+	if counts[0.01] != 1 || counts[0.25] != 1 || counts[0.5] != 2 || counts[10] != 2 {
+		t.Errorf("unexpected cumulative buckets %+v", metrics.DurationBuckets)
+	}
+
+	if metrics.DurationCount != 3 || !floatEquals(metrics.DurationSum, 60.305, 0.001) {
+		t.Errorf("expected 3 durations adding up to 60.305s, got %d adding up to %v", metrics.DurationCount, metrics.DurationSum)
+	}
+}
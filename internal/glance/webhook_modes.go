@@ -0,0 +1,124 @@
+package glance
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// Values of stripe-webhook accept-mode
+const (
+	webhookAcceptAuto = "auto"
+	webhookAcceptLive = "live"
+	webhookAcceptTest = "test"
+	webhookAcceptBoth = "both"
+)
+
+func validateWebhookAcceptMode(acceptMode string) error {
+	switch acceptMode {
+	case webhookAcceptAuto, webhookAcceptLive, webhookAcceptTest, webhookAcceptBoth:
+		return nil
+	}
+
+	return fmt.Errorf("stripe-webhook accept-mode must be 'auto', 'live', 'test' or 'both', got: %s", acceptMode)
+}
+
+// widgetStripeModes returns the Stripe modes of the revenue and customers
+// widgets, sorted
+func widgetStripeModes(widgets map[uint64]widget) []string {
+	var modes []string
+	for _, widget := range widgets {
+		var mode string
+		switch widget := widget.(type) {
+		case *revenueWidget:
+			mode = widget.StripeMode
+		case *customersWidget:
+			mode = widget.StripeMode
+		default:
+			continue
+		}
+
+		if !slices.Contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+
+	slices.Sort(modes)
+	return modes
+}
+
+// resolveWebhookModes returns the Stripe modes webhook events are accepted
+// from and why. With auto they're the modes the widgets use, so that events
+// of another mode don't write snapshots no widget shows.
+func resolveWebhookModes(acceptMode string, widgets map[uint64]widget) ([]string, string) {
+	switch acceptMode {
+	case webhookAcceptLive, webhookAcceptTest:
+		return []string{acceptMode}, "stripe-webhook accept-mode"
+	case webhookAcceptBoth:
+		return []string{"live", "test"}, "stripe-webhook accept-mode"
+	}
+
+	if modes := widgetStripeModes(widgets); len(modes) > 0 {
+		return modes, "stripe-mode of the configured widgets"
+	}
+
+	return []string{"live", "test"}, "no revenue or customers widgets configured"
+}
+
+// SetAcceptedModes limits the webhook events processed to the ones of modes,
+// reason being shown with the events filtered out
+func (wh *WebhookHandler) SetAcceptedModes(modes []string, reason string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.acceptedModes = modes
+	wh.acceptedModesReason = reason
+}
+
+// acceptsMode reports whether events of mode are processed, counting the
+// ones that aren't
+func (wh *WebhookHandler) acceptsMode(mode string) bool {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.acceptedModes == nil || slices.Contains(wh.acceptedModes, mode) {
+		return true
+	}
+
+	if wh.filteredEvents == nil {
+		wh.filteredEvents = make(map[string]int)
+	}
+	wh.filteredEvents[mode]++
+
+	slog.Debug("Skipping webhook event of a mode not accepted",
+		"mode", mode,
+		"accepted_modes", wh.acceptedModes,
+		"reason", wh.acceptedModesReason)
+
+	return false
+}
+
+// WebhookModeFilter is how many webhook events were dropped by mode and why
+type WebhookModeFilter struct {
+	AcceptedModes  []string       `json:"accepted_modes"`
+	Reason         string         `json:"reason"`
+	FilteredEvents map[string]int `json:"filtered_events"` // by mode
+}
+
+// GetModeFilter returns the modes events are accepted from and how many
+// events of other modes were dropped
+func (wh *WebhookHandler) GetModeFilter() WebhookModeFilter {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	filter := WebhookModeFilter{
+		AcceptedModes:  slices.Clone(wh.acceptedModes),
+		Reason:         wh.acceptedModesReason,
+		FilteredEvents: make(map[string]int, len(wh.filteredEvents)),
+	}
+	for mode, count := range wh.filteredEvents {
+		filter.FilteredEvents[mode] = count
+	}
+
+	return filter
+}
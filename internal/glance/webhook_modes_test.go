@@ -0,0 +1,84 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestResolveWebhookModes(t *testing.T) {
+	liveWidgets := map[uint64]widget{
+		1: &revenueWidget{StripeMode: "live"},
+		2: &customersWidget{StripeMode: "live"},
+		3: &clockWidget{},
+	}
+	mixedWidgets := map[uint64]widget{
+		1: &revenueWidget{StripeMode: "live"},
+		2: &customersWidget{StripeMode: "test"},
+	}
+
+	tests := []struct {
+		name       string
+		acceptMode string
+		widgets    map[uint64]widget
+		expected   []string
+	}{
+		{name: "auto with live widgets", acceptMode: webhookAcceptAuto, widgets: liveWidgets, expected: []string{"live"}},
+		{name: "auto with both modes", acceptMode: webhookAcceptAuto, widgets: mixedWidgets, expected: []string{"live", "test"}},
+		{name: "auto without Stripe widgets", acceptMode: webhookAcceptAuto, expected: []string{"live", "test"}},
+		{name: "test", acceptMode: webhookAcceptTest, widgets: liveWidgets, expected: []string{"test"}},
+		{name: "both", acceptMode: webhookAcceptBoth, widgets: liveWidgets, expected: []string{"live", "test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modes, reason := resolveWebhookModes(tt.acceptMode, tt.widgets)
+			if !slices.Equal(modes, tt.expected) || reason == "" {
+				t.Errorf("expected %v with a reason, got %v (%q)", tt.expected, modes, reason)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_FiltersEventsByMode(t *testing.T) {
+	const secret = "whsec_modes"
+	handler := &WebhookHandler{secrets: []webhookSecret{{Secret: secret}}, eventHandlers: make(map[string][]EventHandlerFunc), maxEventLog: 10}
+	handler.SetAcceptedModes(resolveWebhookModes(webhookAcceptAuto, map[uint64]widget{1: &revenueWidget{StripeMode: "live"}}))
+
+	var processed atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		processed.Add(1)
+		return nil
+	})
+
+	payload := fmt.Sprintf(`{"id": "evt_test_mode", "type": "customer.updated", "livemode": false, "api_version": %q}`, stripe.APIVersion)
+	request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+	request.Header.Set("Stripe-Signature", signWebhookPayload(payload, secret))
+	recorder := httptest.NewRecorder()
+	handler.HandleWebhook(recorder, request)
+
+	// Acknowledged so that Stripe doesn't retry it, but not processed
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	filter := handler.GetModeFilter()
+	if filter.FilteredEvents["test"] != 1 || !slices.Equal(filter.AcceptedModes, []string{"live"}) || filter.Reason == "" {
+		t.Errorf("expected 1 filtered test event, got %+v", filter)
+	}
+
+	if !handler.acceptsMode("live") {
+		t.Error("expected live events to be accepted")
+	}
+
+	if processed.Load() != 0 || len(handler.GetEventLog()) != 0 {
+		t.Error("expected the filtered event not to be processed")
+	}
+}
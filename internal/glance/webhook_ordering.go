@@ -0,0 +1,71 @@
+package glance
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// maxTrackedWebhookObjects is how many Stripe objects the creation time of
+// their latest event is kept for, the first tracked being forgotten first
+const maxTrackedWebhookObjects = 10000
+
+// webhookEventObjectID returns the ID of the object an event is about, empty
+// when it has none
+func webhookEventObjectID(event stripe.Event) string {
+	if event.Data == nil || len(event.Data.Raw) == 0 {
+		return ""
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(event.Data.Raw, &object); err != nil {
+		return ""
+	}
+
+	return object.ID
+}
+
+// isStateEvent reports whether an event carries the current state of its
+// object, which an older event of the object would regress. Other events,
+// such as an invoice being paid, are facts that still apply late.
+func isStateEvent(eventType string) bool {
+	return strings.HasSuffix(eventType, ".updated")
+}
+
+// isStaleEvent reports whether event is a state event older than an event
+// already applied to the same object, Stripe not delivering events in order.
+// Otherwise it's recorded as the latest event of its object.
+func (wh *WebhookHandler) isStaleEvent(event stripe.Event) bool {
+	objectID := webhookEventObjectID(event)
+	if objectID == "" || event.Created == 0 {
+		return false
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	// Events created the same second can't be told apart and are applied
+	latest, tracked := wh.objectVersions[objectID]
+	if tracked && event.Created < latest {
+		return isStateEvent(string(event.Type))
+	}
+
+	if wh.objectVersions == nil {
+		wh.objectVersions = make(map[string]int64)
+	}
+
+	if !tracked {
+		wh.objectOrder = append(wh.objectOrder, objectID)
+	}
+	wh.objectVersions[objectID] = event.Created
+
+	for len(wh.objectOrder) > maxTrackedWebhookObjects {
+		delete(wh.objectVersions, wh.objectOrder[0])
+		wh.objectOrder = wh.objectOrder[1:]
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func orderingTestEvent(t *testing.T, eventType, subscriptionID, status string, created time.Time) stripe.Event {
+	return stripe.Event{
+		ID:      fmt.Sprintf("evt_%s_%s_%d", t.Name(), status, time.Now().UnixNano()),
+		Type:    stripe.EventType(eventType),
+		Created: created.Unix(),
+		Data:    &stripe.EventData{Raw: json.RawMessage(fmt.Sprintf(`{"id": %q, "status": %q}`, subscriptionID, status))},
+	}
+}
+
+func TestWebhookHandler_SkipsStaleEvents(t *testing.T) {
+	handler := newRetryTestHandler(1, time.Millisecond)
+
+	var mu sync.Mutex
+	var applied []string
+	record := func(ctx context.Context, event stripe.Event) error {
+		var subscription struct{ Status string }
+		json.Unmarshal(event.Data.Raw, &subscription)
+
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, string(event.Type)+":"+subscription.Status)
+		return nil
+	}
+	handler.RegisterHandler("customer.subscription.created", record)
+	handler.RegisterHandler("customer.subscription.updated", record)
+
+	subscriptionID := "sub_" + t.Name()
+	start := time.Now().Add(-time.Hour)
+
+	// The update of 10:05 arrives before the one of 10:00
+	newer := orderingTestEvent(t, "customer.subscription.updated", subscriptionID, "canceled", start.Add(5*time.Minute))
+	older := orderingTestEvent(t, "customer.subscription.updated", subscriptionID, "past_due", start)
+	handler.processEvent(newer)
+	handler.processEvent(older)
+
+	// Events that aren't a state of the object still apply late
+	created := orderingTestEvent(t, "customer.subscription.created", subscriptionID, "active", start.Add(-time.Minute))
+	handler.processEvent(created)
+
+	// Other objects aren't affected
+	handler.processEvent(orderingTestEvent(t, "customer.subscription.updated", subscriptionID+"_other", "active", start))
+
+	expected := []string{"customer.subscription.updated:canceled", "customer.subscription.created:active", "customer.subscription.updated:active"}
+	if fmt.Sprint(applied) != fmt.Sprint(expected) {
+		t.Errorf("expected %v to be applied, got %v", expected, applied)
+	}
+
+	var stale []string
+	for _, event := range handler.GetEventLog() {
+		if event.Stale {
+			stale = append(stale, event.ID)
+		}
+	}
+	if len(stale) != 1 || stale[0] != older.ID {
+		t.Errorf("expected the older update to be logged as stale, got %v", stale)
+	}
+
+	// Replays are applied regardless of their age
+	if _, handled := handler.runEvent(older, true); !handled || applied[len(applied)-1] != "customer.subscription.updated:past_due" {
+		t.Errorf("expected the replayed update to be applied, got %v", applied)
+	}
+}
+
+func TestWebhookHandler_BoundsTrackedObjects(t *testing.T) {
+	handler := &WebhookHandler{}
+
+	for i := range maxTrackedWebhookObjects + 10 {
+		event := orderingTestEvent(t, "customer.updated", fmt.Sprintf("cus_%d", i), "active", time.Now())
+		handler.isStaleEvent(event)
+	}
+
+	if len(handler.objectVersions) != maxTrackedWebhookObjects || len(handler.objectOrder) != maxTrackedWebhookObjects {
+		t.Errorf("expected %d tracked objects, got %d", maxTrackedWebhookObjects, len(handler.objectVersions))
+	}
+
+	if _, tracked := handler.objectVersions["cus_0"]; tracked {
+		t.Error("expected the first tracked object to be forgotten")
+	}
+}
@@ -0,0 +1,168 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// Values of stripe-webhook processing
+const (
+	webhookProcessingAsync = "async"
+	webhookProcessingSync  = "sync"
+)
+
+const (
+	// webhookSyncTimeout bounds the handlers run while Stripe waits for the
+	// response, safely under the time Stripe gives up on a delivery after
+	webhookSyncTimeout = 10 * time.Second
+
+	// maxAwaitedRedeliveries is how many events whose handlers failed in sync
+	// mode are remembered, so that their redelivery runs only the failed ones
+	maxAwaitedRedeliveries = 1000
+)
+
+// errWebhookHandlersFailed is answered to Stripe instead of the error of the
+// handler, which is logged
+var errWebhookHandlersFailed = errors.New("webhook handlers failed, the event will be processed again when redelivered")
+
+func validateWebhookProcessing(processing string) error {
+	switch processing {
+	case webhookProcessingAsync, webhookProcessingSync:
+		return nil
+	}
+
+	return fmt.Errorf("stripe-webhook processing must be 'async' or 'sync', got: %s", processing)
+}
+
+// SetProcessing sets whether events are processed before Stripe is answered
+// or in the background
+func (wh *WebhookHandler) SetProcessing(processing string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.processing = processing
+}
+
+// GetProcessing returns whether events are processed in sync or async mode
+func (wh *WebhookHandler) GetProcessing() string {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	if wh.processing == "" {
+		return webhookProcessingAsync
+	}
+
+	return wh.processing
+}
+
+// processEventSync runs the handlers of event while Stripe waits, returning
+// an error when any failed so that Stripe redelivers the event instead of
+// it being retried here. A redelivery runs only the handlers that failed.
+// The widgets the event affects are refreshed in the background, so Stripe
+// doesn't wait on their requests to Stripe.
+func (wh *WebhookHandler) processEventSync(event stripe.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookSyncTimeout)
+	defer cancel()
+
+	if retry, redelivered := wh.takeRedelivery(event.ID); redelivered {
+		if retry, failed := wh.rerunHandlers(ctx, retry); failed {
+			return wh.awaitRedelivery(retry)
+		}
+
+		// Skip any later redelivery again
+		if db, err := GetMetricsDatabase(""); err == nil {
+			db.MarkEventProcessed(ctx, event.ID)
+		}
+		return nil
+	}
+
+	var err error
+	wh.applyEvent(ctx, event, false, func(retry webhookRetry) {
+		err = wh.awaitRedelivery(retry)
+	})
+
+	return err
+}
+
+// awaitRedelivery remembers the failed handlers of retry to run when Stripe
+// redelivers the event, returning the error to answer Stripe with. Once out
+// of attempts the event is dead-lettered and acknowledged instead.
+//
+// Only the handlers are kept in memory, so the event is also no longer
+// counted as processed. A redelivery after a restart then runs all of its
+// handlers again rather than being skipped as a duplicate.
+func (wh *WebhookHandler) awaitRedelivery(retry webhookRetry) error {
+	wh.mu.Lock()
+	maxAttempts := wh.maxAttempts
+	wh.mu.Unlock()
+
+	if retry.attempts >= maxAttempts {
+		wh.deadLetter(retry)
+		return nil
+	}
+
+	slog.Info("Waiting for Stripe to redeliver webhook event",
+		"event_id", retry.event.ID,
+		"event_type", retry.event.Type,
+		"attempt", retry.attempts+1)
+
+	if retry.event.ID == "" {
+		return errWebhookHandlersFailed
+	}
+
+	if db, err := GetMetricsDatabase(""); err == nil {
+		db.ForgetEventProcessed(context.Background(), retry.event.ID)
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.redeliveries == nil {
+		wh.redeliveries = make(map[string]webhookRetry)
+	}
+	if _, exists := wh.redeliveries[retry.event.ID]; !exists {
+		wh.redeliveryOrder = append(wh.redeliveryOrder, retry.event.ID)
+	}
+	wh.redeliveries[retry.event.ID] = retry
+
+	for len(wh.redeliveryOrder) > maxAwaitedRedeliveries {
+		delete(wh.redeliveries, wh.redeliveryOrder[0])
+		wh.redeliveryOrder = wh.redeliveryOrder[1:]
+	}
+
+	return errWebhookHandlersFailed
+}
+
+// takeRedelivery returns the failed handlers of an event awaiting its
+// redelivery, forgetting them
+func (wh *WebhookHandler) takeRedelivery(id string) (webhookRetry, bool) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	retry, exists := wh.redeliveries[id]
+	if !exists {
+		return webhookRetry{}, false
+	}
+
+	delete(wh.redeliveries, id)
+	wh.redeliveryOrder = slices.DeleteFunc(wh.redeliveryOrder, func(awaited string) bool {
+		return awaited == id
+	})
+
+	return retry, true
+}
+
+// awaitedRedeliveries returns how many events are waiting for Stripe to
+// redeliver them
+func (wh *WebhookHandler) awaitedRedeliveries() int {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	return len(wh.redeliveries)
+}
@@ -0,0 +1,183 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestWebhookHandler_ProcessingModes(t *testing.T) {
+	tests := []struct {
+		processing    string
+		wantFirstCode int
+	}{
+		// Stripe is told to redeliver the event
+		{processing: webhookProcessingSync, wantFirstCode: http.StatusInternalServerError},
+		// The event is acknowledged and retried here
+		{processing: webhookProcessingAsync, wantFirstCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.processing, func(t *testing.T) {
+			handler := newRetryTestHandler(3, time.Millisecond)
+			handler.SetInsecureSkipVerify(true)
+			handler.SetProcessing(tt.processing)
+
+			var succeeding, flaky atomic.Int32
+			handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+				succeeding.Add(1)
+				return nil
+			})
+			handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+				if flaky.Add(1) == 1 {
+					return errors.New("database unavailable")
+				}
+				return nil
+			})
+
+			eventID := fmt.Sprintf("evt_%s_%d", strings.ReplaceAll(t.Name(), "/", "_"), time.Now().UnixNano())
+			deliver := func() int {
+				payload := fmt.Sprintf(`{"id": %q, "type": "customer.updated"}`, eventID)
+				recorder := httptest.NewRecorder()
+				handler.HandleWebhook(recorder, httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload)))
+				return recorder.Code
+			}
+
+			if code := deliver(); code != tt.wantFirstCode {
+				t.Fatalf("expected %d for the failing delivery, got %d", tt.wantFirstCode, code)
+			}
+
+			if tt.processing == webhookProcessingSync {
+				if handler.awaitedRedeliveries() != 1 || handler.pendingRetries.Load() != 0 {
+					t.Fatalf("expected the event to wait for a redelivery instead of a retry")
+				}
+
+				if code := deliver(); code != http.StatusOK {
+					t.Fatalf("expected the redelivery to succeed, got %d", code)
+				}
+			}
+
+			waitFor(t, "the failed handler to succeed", func() bool {
+				events := handler.GetEventLog()
+				return len(events) == 2 && events[1].Success && events[1].Attempts == 2
+			})
+
+			if succeeding.Load() != 1 || flaky.Load() != 2 {
+				t.Errorf("expected only the failed handler to run again, got %d and %d runs", succeeding.Load(), flaky.Load())
+			}
+
+			if handler.awaitedRedeliveries() != 0 {
+				t.Errorf("expected no events waiting for a redelivery")
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_SyncProcessingDeadLetters(t *testing.T) {
+	handler := newRetryTestHandler(1, time.Millisecond)
+	handler.SetProcessing(webhookProcessingSync)
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		return errors.New("database unavailable")
+	})
+
+	// Out of attempts, the event is acknowledged so that Stripe stops
+	// redelivering it
+	if err := handler.processEventSync(retryTestEvent(t)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if len(handler.GetDeadLetters()) != 1 || handler.awaitedRedeliveries() != 0 {
+		t.Errorf("expected the event to be dead-lettered")
+	}
+}
+
+func TestWebhookHandler_SyncRedeliveryAfterRestart(t *testing.T) {
+	var runs atomic.Int32
+	newHandler := func() *WebhookHandler {
+		handler := newRetryTestHandler(3, time.Millisecond)
+		handler.SetProcessing(webhookProcessingSync)
+		handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+			if runs.Add(1) == 1 {
+				return errors.New("database unavailable")
+			}
+			return nil
+		})
+		return handler
+	}
+
+	event := retryTestEvent(t)
+	if err := newHandler().processEventSync(event); err == nil {
+		t.Fatal("expected the failed event to wait for its redelivery")
+	}
+
+	// A restarted handler no longer has the failed handlers, the redelivery
+	// runs them all instead of being skipped as a duplicate
+	restarted := newHandler()
+	if err := restarted.processEventSync(event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if runs.Load() != 2 {
+		t.Fatalf("expected the redelivery to run the handler again, got %d runs", runs.Load())
+	}
+
+	restarted.processEventSync(event)
+	if runs.Load() != 2 {
+		t.Errorf("expected a later redelivery to be skipped, got %d runs", runs.Load())
+	}
+}
+
+func TestWebhookHandler_SyncProcessingDoesNotWaitForRefresh(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	app := &application{widgetByID: make(map[uint64]widget)}
+	app.widgetRefreshes = newWidgetRefresher(0, func(ctx context.Context, widgetType string) {
+		<-release
+	})
+
+	handler := newRetryTestHandler(3, time.Millisecond)
+	handler.SetProcessing(webhookProcessingSync)
+	handler.cacheInvalidator = app
+	handler.RegisterHandler("customer.subscription.updated", func(ctx context.Context, event stripe.Event) error {
+		return nil
+	})
+
+	event := retryTestEvent(t)
+	event.Type = "customer.subscription.updated"
+
+	done := make(chan error, 1)
+	go func() { done <- handler.processEventSync(event) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Stripe to be answered without waiting for the widget refresh")
+	}
+}
+
+func TestWebhookStatusHandler_ReportsProcessing(t *testing.T) {
+	handler := newRetryTestHandler(1, 0)
+
+	for _, processing := range []string{webhookProcessingAsync, webhookProcessingSync} {
+		handler.SetProcessing(processing)
+
+		recorder := httptest.NewRecorder()
+		WebhookStatusHandler(handler)(recorder, httptest.NewRequest(http.MethodGet, "/api/stripe/webhook/status", nil))
+
+		if !strings.Contains(recorder.Body.String(), fmt.Sprintf(`"processing":%q`, processing)) {
+			t.Errorf("expected the status to report %s processing, got %s", processing, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// maxWebhookPayloads is how many webhook payloads are kept to be replayed
+const maxWebhookPayloads = 1000
+
+var (
+	errUnknownWebhookEvent = errors.New("webhook event not found")
+	errNoEventHandlers     = errors.New("no handlers registered for the event type")
+)
+
+// webhookPayload is the verified body of a webhook delivery, with the mode it
+// was attributed to by the secret that verified it
+type webhookPayload struct {
+	Payload  json.RawMessage `json:"payload"`
+	Livemode bool            `json:"livemode"`
+	Received time.Time       `json:"received"`
+}
+
+// SaveWebhookPayload keeps the payload of the webhook event id to be replayed,
+// evicting the oldest once full
+func (db *SimpleMetricsDB) SaveWebhookPayload(ctx context.Context, id string, payload webhookPayload) {
+	if id == "" {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.webhookPayloads == nil {
+		db.webhookPayloads = make(map[string]webhookPayload)
+	}
+
+	if _, exists := db.webhookPayloads[id]; !exists {
+		db.webhookPayloadOrder = append(db.webhookPayloadOrder, id)
+	}
+	db.webhookPayloads[id] = payload
+
+	for len(db.webhookPayloadOrder) > maxWebhookPayloads {
+		delete(db.webhookPayloads, db.webhookPayloadOrder[0])
+		db.webhookPayloadOrder = db.webhookPayloadOrder[1:]
+	}
+}
+
+// GetWebhookPayload returns the payload kept for the webhook event id
+func (db *SimpleMetricsDB) GetWebhookPayload(ctx context.Context, id string) (webhookPayload, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	payload, exists := db.webhookPayloads[id]
+	return payload, exists
+}
+
+// ReplayEvent runs the handlers of the stored webhook event id again, even
+// though it was already processed, and logs it as replayed
+func (wh *WebhookHandler) ReplayEvent(ctx context.Context, id string) (WebhookEvent, error) {
+	db, err := GetMetricsDatabase("")
+	if err != nil {
+		return WebhookEvent{}, err
+	}
+
+	stored, exists := db.GetWebhookPayload(ctx, id)
+	if !exists {
+		return WebhookEvent{}, errUnknownWebhookEvent
+	}
+
+	var event stripe.Event
+	if err := json.Unmarshal(stored.Payload, &event); err != nil {
+		return WebhookEvent{}, fmt.Errorf("decoding stored event: %w", err)
+	}
+	event.Livemode = stored.Livemode
+
+	slog.Info("Replaying webhook event", "event_id", event.ID, "event_type", event.Type)
+
+	replayed, handled := wh.runEvent(event, true)
+	if !handled {
+		return WebhookEvent{}, errNoEventHandlers
+	}
+
+	return replayed, nil
+}
+
+// WebhookReplayResponse is the response of the webhook replay endpoint
+type WebhookReplayResponse struct {
+	Event WebhookEvent `json:"event"`
+}
+
+func (a *application) handleWebhookReplayRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedWebhookAPIResponse(w, r) {
+		return
+	}
+
+	// Writes are held back while paused, which a replay can't wait for
+	if globalPause.isPaused() {
+		writeAPIError(w, http.StatusServiceUnavailable, errAdministrativelyPaused)
+		return
+	}
+
+	event, err := a.webhookHandler.ReplayEvent(r.Context(), r.PathValue("event"))
+	if errors.Is(err, errUnknownWebhookEvent) {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if errors.Is(err, errNoEventHandlers) {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&WebhookReplayResponse{Event: a.webhookHandler.presentEvents([]WebhookEvent{event})[0]})
+}
@@ -0,0 +1,93 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestSimpleMetricsDB_EvictsOldestWebhookPayloads(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	for i := range maxWebhookPayloads + 1 {
+		db.SaveWebhookPayload(ctx, fmt.Sprintf("evt_%d", i), webhookPayload{Payload: json.RawMessage(`{}`)})
+	}
+
+	if _, exists := db.GetWebhookPayload(ctx, "evt_0"); exists {
+		t.Error("expected the oldest payload to be evicted")
+	}
+
+	if _, exists := db.GetWebhookPayload(ctx, fmt.Sprintf("evt_%d", maxWebhookPayloads)); !exists {
+		t.Error("expected the newest payload to be kept")
+	}
+}
+
+func TestWebhookReplay_ReprocessesStoredEvents(t *testing.T) {
+	const secret = "whsec_replay"
+	handler := newRetryTestHandler(1, time.Hour)
+	handler.secrets = []webhookSecret{{Secret: secret, Mode: "test"}}
+
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		if runs.Add(1) == 1 {
+			return errors.New("transient bug")
+		}
+		return nil
+	})
+
+	app := &application{webhookHandler: handler}
+	eventID := "evt_replay_" + time.Now().Format(time.RFC3339Nano)
+	payload := fmt.Sprintf(`{"id": %q, "type": "customer.updated", "livemode": true, "api_version": %q, "data": {"object": {"id": "cus_1"}}}`, eventID, stripe.APIVersion)
+
+	request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+	request.Header.Set("Stripe-Signature", signWebhookPayload(payload, secret))
+	handler.HandleWebhook(httptest.NewRecorder(), request)
+
+	waitFor(t, "the event to fail", func() bool {
+		return len(handler.GetDeadLetters()) == 1
+	})
+
+	replay := func(id string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, stripeWebhookPath+"/replay/"+id, nil)
+		request.SetPathValue("event", id)
+		rec := httptest.NewRecorder()
+		app.handleWebhookReplayRequest(rec, request)
+		return rec
+	}
+
+	rec := replay(eventID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response WebhookReplayResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Still attributed to the mode of the secret that verified it
+	if !response.Event.Replayed || !response.Event.Success || response.Event.Mode != "test" {
+		t.Errorf("expected a successful replay in test mode, got %+v", response.Event)
+	}
+
+	// Stripe redelivering the event afterwards is still a duplicate
+	handler.processEvent(stripe.Event{ID: eventID, Type: "customer.updated"})
+	eventLog := handler.GetEventLog()
+	if last := eventLog[len(eventLog)-1]; !last.Duplicate || runs.Load() != 2 {
+		t.Errorf("expected the redelivery to be skipped after %d runs, got %+v", runs.Load(), last)
+	}
+
+	if rec := replay("evt_unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown event, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,197 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const (
+	// webhookEventTimeout bounds each run of the handlers of an event,
+	// including retries
+	webhookEventTimeout = 30 * time.Second
+
+	// Stripe was already told an event was received when its handlers fail, so
+	// they are retried here, doubling the delay from webhookRetryBaseDelay up to
+	// webhookRetryMaxDelay
+	defaultWebhookMaxAttempts = 5
+	webhookRetryBaseDelay     = 30 * time.Second
+	webhookRetryMaxDelay      = time.Hour
+)
+
+// webhookRetry is an event whose handlers failed, to be run again
+type webhookRetry struct {
+	event    stripe.Event
+	handlers []EventHandlerFunc // only the ones that failed
+	attempts int                // runs so far, including the first
+	err      error              // of the last run
+	history  []WebhookAttemptError
+}
+
+// webhookRetryDelay returns how long to wait after the given number of
+// attempts before the next one
+func webhookRetryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= webhookRetryMaxDelay {
+			return webhookRetryMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// SetMaxAttempts sets how many times the handlers of an event are run,
+// including the first, before the event is dead-lettered
+func (wh *WebhookHandler) SetMaxAttempts(attempts int) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.maxAttempts = max(1, attempts)
+}
+
+// runHandlers runs handlers for event with a fresh timeout, unless ctx ends
+// sooner, returning the ones that failed and the last error
+func (wh *WebhookHandler) runHandlers(ctx context.Context, event stripe.Event, handlers []EventHandlerFunc, attempt int) ([]EventHandlerFunc, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookEventTimeout)
+	defer cancel()
+
+	started := time.Now()
+	defer func() { wh.metrics.observeDuration(time.Since(started)) }()
+
+	var failed []EventHandlerFunc
+	var lastErr error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			failed = append(failed, handler)
+			lastErr = err
+			slog.Error("Webhook handler failed",
+				"event_id", event.ID,
+				"event_type", event.Type,
+				"attempt", attempt,
+				"error", err)
+		}
+	}
+
+	return failed, lastErr
+}
+
+// scheduleRetry runs the failed handlers of retry again after a backoff, or
+// dead-letters the event once it's out of attempts. It never blocks, so new
+// events are processed while retries wait.
+func (wh *WebhookHandler) scheduleRetry(retry webhookRetry) {
+	wh.mu.RLock()
+	maxAttempts, baseDelay, stopped := wh.maxAttempts, wh.retryBaseDelay, wh.retriesStopped
+	wh.mu.RUnlock()
+
+	// Stripe won't redeliver the event, the dead letter keeps it for a replay
+	if retry.attempts >= maxAttempts || stopped {
+		wh.deadLetter(retry)
+		return
+	}
+
+	delay := webhookRetryDelay(baseDelay, retry.attempts)
+	slog.Info("Retrying webhook handlers",
+		"event_id", retry.event.ID,
+		"event_type", retry.event.Type,
+		"attempt", retry.attempts+1,
+		"in", delay)
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.retryTimers == nil {
+		wh.retryTimers = make(map[*webhookRetry]*time.Timer)
+	}
+
+	wh.pendingRetries.Add(1)
+	waiting := &retry
+	wh.retryTimers[waiting] = time.AfterFunc(delay, func() {
+		if !wh.takeRetryTimer(waiting) {
+			return
+		}
+
+		// Replayed on resume like new events, and no longer pending either
+		// way, as work deferred while paused may be dropped
+		wh.pendingRetries.Add(-1)
+		run := func() { wh.retryEvent(retry) }
+		if !globalPause.deferWhilePaused(run) {
+			run()
+		}
+	})
+}
+
+// takeRetryTimer forgets the timer of a retry that is due, returning false
+// when the retries were stopped before it fired
+func (wh *WebhookHandler) takeRetryTimer(retry *webhookRetry) bool {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if _, exists := wh.retryTimers[retry]; !exists {
+		return false
+	}
+
+	delete(wh.retryTimers, retry)
+	return true
+}
+
+// stopRetries cancels the retries waiting for their backoff and dead-letters
+// their events, which would otherwise be lost with the process. Retries
+// scheduled afterwards are dead-lettered right away.
+func (wh *WebhookHandler) stopRetries() {
+	wh.mu.Lock()
+	timers := wh.retryTimers
+	wh.retryTimers = nil
+	wh.retriesStopped = true
+	wh.mu.Unlock()
+
+	if len(timers) > 0 {
+		slog.Warn("Dead-lettering webhook events waiting to be retried", "events", len(timers))
+	}
+
+	for retry, timer := range timers {
+		timer.Stop()
+		wh.pendingRetries.Add(-1)
+		wh.deadLetter(*retry)
+	}
+}
+
+// retryEvent runs the failed handlers of retry again
+func (wh *WebhookHandler) retryEvent(retry webhookRetry) {
+	if retry, failed := wh.rerunHandlers(context.Background(), retry); failed {
+		wh.scheduleRetry(retry)
+	}
+}
+
+// rerunHandlers runs the failed handlers of retry again, returning it with the
+// ones still failing, and logs the event when none are
+func (wh *WebhookHandler) rerunHandlers(ctx context.Context, retry webhookRetry) (webhookRetry, bool) {
+	retry.attempts++
+	failed, err := wh.runHandlers(ctx, retry.event, retry.handlers, retry.attempts)
+	if len(failed) > 0 {
+		retry.handlers, retry.err = failed, err
+		retry.history = append(retry.history, WebhookAttemptError{Attempt: retry.attempts, At: time.Now(), Error: err.Error()})
+		return retry, true
+	}
+
+	slog.Info("Webhook handlers succeeded on retry",
+		"event_id", retry.event.ID,
+		"event_type", retry.event.Type,
+		"attempts", retry.attempts)
+
+	wh.metrics.countEvent(string(retry.event.Type), webhookOutcomeRetried)
+	wh.invalidateCaches(string(retry.event.Type))
+	wh.logEvent(WebhookEvent{
+		ID:        retry.event.ID,
+		Type:      string(retry.event.Type),
+		Mode:      webhookEventMode(retry.event),
+		Processed: time.Now(),
+		Success:   true,
+		Attempts:  retry.attempts,
+	})
+
+	return retry, false
+}
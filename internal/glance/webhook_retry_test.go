@@ -0,0 +1,195 @@
+package glance
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 30 * time.Second},
+		{attempts: 2, expected: time.Minute},
+		{attempts: 4, expected: 4 * time.Minute},
+		{attempts: 20, expected: webhookRetryMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := webhookRetryDelay(webhookRetryBaseDelay, tt.attempts); got != tt.expected {
+			t.Errorf("after %d attempts: expected %v, got %v", tt.attempts, tt.expected, got)
+		}
+	}
+}
+
+// waitFor polls condition until it holds, failing the test after a second
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newRetryTestHandler(maxAttempts int, baseDelay time.Duration) *WebhookHandler {
+	return &WebhookHandler{
+		eventHandlers:  make(map[string][]EventHandlerFunc),
+		maxEventLog:    10,
+		maxAttempts:    maxAttempts,
+		retryBaseDelay: baseDelay,
+	}
+}
+
+func retryTestEvent(t *testing.T) stripe.Event {
+	return stripe.Event{ID: "evt_" + t.Name() + time.Now().Format(time.RFC3339Nano), Type: "customer.updated"}
+}
+
+func TestWebhookHandler_RetriesFailedHandlers(t *testing.T) {
+	handler := newRetryTestHandler(3, time.Millisecond)
+
+	var succeeding, flaky atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		succeeding.Add(1)
+		return nil
+	})
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		if flaky.Add(1) == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	event := retryTestEvent(t)
+	handler.processEvent(event)
+
+	waitFor(t, "the retry to succeed", func() bool {
+		for _, logged := range handler.GetEventLog() {
+			if logged.ID == event.ID && logged.Success && logged.Attempts == 2 {
+				return true
+			}
+		}
+		return false
+	})
+
+	// Only the handler that failed runs again
+	if succeeding.Load() != 1 || flaky.Load() != 2 {
+		t.Errorf("expected 1 and 2 runs, got %d and %d", succeeding.Load(), flaky.Load())
+	}
+
+	if deadLetters := handler.GetDeadLetters(); len(deadLetters) != 0 {
+		t.Errorf("expected no dead letters, got %+v", deadLetters)
+	}
+}
+
+func TestWebhookHandler_DeadLettersAfterMaxAttempts(t *testing.T) {
+	handler := newRetryTestHandler(3, time.Millisecond)
+
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		runs.Add(1)
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected every attempt to have a timeout")
+		}
+		return errors.New("database unavailable")
+	})
+
+	event := retryTestEvent(t)
+	handler.processEvent(event)
+
+	waitFor(t, "the event to be dead-lettered", func() bool { return len(handler.GetDeadLetters()) == 1 })
+
+	deadLetter := handler.GetDeadLetters()[0]
+	if deadLetter.ID != event.ID || deadLetter.Attempts != 3 || deadLetter.Error != "database unavailable" {
+		t.Errorf("unexpected dead letter %+v", deadLetter)
+	}
+
+	if runs.Load() != 3 {
+		t.Errorf("expected 3 runs, got %d", runs.Load())
+	}
+
+	if pending := handler.pendingRetries.Load(); pending != 0 {
+		t.Errorf("expected no pending retries, got %d", pending)
+	}
+}
+
+func TestWebhookHandler_RetriesDoNotBlockNewEvents(t *testing.T) {
+	handler := newRetryTestHandler(defaultWebhookMaxAttempts, time.Hour)
+
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		if runs.Add(1) == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	handler.processEvent(retryTestEvent(t))
+	handler.processEvent(retryTestEvent(t))
+
+	if runs.Load() != 2 || handler.pendingRetries.Load() != 1 {
+		t.Errorf("expected the second event to run while the first waits to retry, got %d runs and %d pending retries",
+			runs.Load(), handler.pendingRetries.Load())
+	}
+}
+
+func TestWebhookHandler_StopDeadLettersWaitingRetries(t *testing.T) {
+	handler := newRetryTestHandler(defaultWebhookMaxAttempts, time.Hour)
+
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		runs.Add(1)
+		return errors.New("database unavailable")
+	})
+
+	handler.processEvent(retryTestEvent(t))
+	handler.StopWorkers()
+
+	if len(handler.GetDeadLetters()) != 1 || handler.pendingRetries.Load() != 0 {
+		t.Fatalf("expected the waiting retry to be dead-lettered on stop, got %d dead letters and %d pending retries",
+			len(handler.GetDeadLetters()), handler.pendingRetries.Load())
+	}
+
+	// Failing after the stop, the event can't wait for a retry either
+	handler.processEvent(retryTestEvent(t))
+	if len(handler.GetDeadLetters()) != 2 || runs.Load() != 2 {
+		t.Errorf("expected the event failing after the stop to be dead-lettered, got %d dead letters and %d runs",
+			len(handler.GetDeadLetters()), runs.Load())
+	}
+}
+
+func TestWebhookHandler_RetriesDeferredWhilePausedAreNotPending(t *testing.T) {
+	handler := newRetryTestHandler(defaultWebhookMaxAttempts, time.Millisecond)
+
+	var runs atomic.Int32
+	handler.RegisterHandler("customer.updated", func(ctx context.Context, event stripe.Event) error {
+		if runs.Add(1) == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	handler.processEvent(retryTestEvent(t))
+	globalPause.pause()
+
+	// Deferred work may be dropped, so the retry stops counting once deferred
+	waitFor(t, "the retry to be deferred", func() bool {
+		deferred, _ := globalPause.deferredStats()
+		return deferred == 1
+	})
+	if pending := handler.pendingRetries.Load(); pending != 0 {
+		t.Errorf("expected no pending retries while deferred, got %d", pending)
+	}
+
+	globalPause.resume()
+	waitFor(t, "the deferred retry to run", func() bool { return runs.Load() == 2 })
+}
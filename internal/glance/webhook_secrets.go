@@ -0,0 +1,175 @@
+package glance
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+// webhookSecret is the signing secret of a Stripe webhook endpoint. With a
+// mode, the events it verifies are attributed to that mode, otherwise to the
+// mode the event says it's from.
+type webhookSecret struct {
+	Secret string `yaml:"secret"`
+	Mode   string `yaml:"mode"`
+}
+
+var errNoWebhookSecret = errors.New("no webhook secret configured")
+
+// defaultWebhookTolerance is how long after they were signed deliveries are
+// accepted unless stripe-webhook tolerance is set, as long as Stripe's default
+const defaultWebhookTolerance = webhook.DefaultTolerance
+
+// configuredWebhookSecrets are the secrets of the stripe-webhook config, set
+// when the application starts
+var configuredWebhookSecrets []webhookSecret
+
+// configWebhookSecrets returns the secrets of the stripe-webhook config, the
+// secrets list followed by the single secret
+func configWebhookSecrets(config *config) []webhookSecret {
+	secrets := append([]webhookSecret{}, config.StripeWebhook.Secrets...)
+	if config.StripeWebhook.Secret != "" {
+		secrets = append(secrets, webhookSecret{Secret: config.StripeWebhook.Secret})
+	}
+
+	return secrets
+}
+
+// validateWebhookSecrets checks the secrets list of the stripe-webhook config
+func validateWebhookSecrets(secrets []webhookSecret) error {
+	for i, secret := range secrets {
+		if secret.Secret == "" {
+			return fmt.Errorf("stripe-webhook secrets: secret %d is empty", i+1)
+		}
+
+		if secret.Mode != "" && secret.Mode != "live" && secret.Mode != "test" {
+			return fmt.Errorf("stripe-webhook secrets: mode of secret %d must be 'live' or 'test', got: %s", i+1, secret.Mode)
+		}
+	}
+
+	return nil
+}
+
+// stripeWebhookSecrets returns the secrets webhook signatures are verified
+// with, from the stripe-webhook config or STRIPE_WEBHOOK_SECRET, empty when
+// webhooks aren't configured
+func stripeWebhookSecrets() []webhookSecret {
+	if len(configuredWebhookSecrets) > 0 {
+		return configuredWebhookSecrets
+	}
+
+	if secret := os.Getenv("STRIPE_WEBHOOK_SECRET"); secret != "" {
+		return []webhookSecret{{Secret: secret}}
+	}
+
+	return nil
+}
+
+// Reasons webhook deliveries are rejected for, see webhookRejectionReason
+const (
+	webhookRejectedMissingSignature = "missing_signature"
+	webhookRejectedInvalidHeader    = "invalid_header"
+	webhookRejectedExpiredTimestamp = "expired_timestamp"
+	webhookRejectedBadSignature     = "bad_signature"
+	webhookRejectedNoSecret         = "no_secret"
+	webhookRejectedInvalidPayload   = "invalid_payload"
+)
+
+// webhookRejectionReason returns why constructWebhookEvent failed with err.
+// Signatures are checked after the timestamp, so an expired timestamp doesn't
+// tell whether the signature was valid.
+func webhookRejectionReason(err error) string {
+	switch {
+	case errors.Is(err, webhook.ErrNotSigned):
+		return webhookRejectedMissingSignature
+	case errors.Is(err, webhook.ErrInvalidHeader):
+		return webhookRejectedInvalidHeader
+	case errors.Is(err, webhook.ErrTooOld):
+		return webhookRejectedExpiredTimestamp
+	case errors.Is(err, webhook.ErrNoValidSignature):
+		return webhookRejectedBadSignature
+	case errors.Is(err, errNoWebhookSecret):
+		return webhookRejectedNoSecret
+	}
+
+	// Such as an API version mismatch
+	return webhookRejectedInvalidPayload
+}
+
+// constructWebhookEvent verifies the signature of payload against each of
+// secrets until one matches, returning the event attributed to the mode of
+// that secret, or the error of the last secret when none matches. A zero
+// tolerance in options is Stripe's default of 5 minutes.
+func constructWebhookEvent(payload []byte, signature string, secrets []webhookSecret, options webhook.ConstructEventOptions) (stripe.Event, error) {
+	err := errNoWebhookSecret
+	for _, secret := range secrets {
+		var event stripe.Event
+		event, err = webhook.ConstructEventWithOptions(payload, signature, secret.Secret, options)
+		// Only a bad signature can be verified by another secret, anything
+		// else such as an API version mismatch is the same for all of them
+		if errors.Is(err, webhook.ErrNoValidSignature) {
+			continue
+		}
+		if err != nil {
+			return stripe.Event{}, err
+		}
+
+		if secret.Mode != "" {
+			livemode := secret.Mode == "live"
+			if event.Livemode != livemode {
+				slog.Warn("Webhook event mode differs from the mode of its secret, using the secret's",
+					"event_id", event.ID,
+					"livemode", event.Livemode,
+					"secret_mode", secret.Mode)
+			}
+			event.Livemode = livemode
+		}
+
+		return event, nil
+	}
+
+	return stripe.Event{}, err
+}
+
+// SetVerification sets how long after they were signed deliveries are
+// accepted, and whether events of another API version than the library's are
+func (wh *WebhookHandler) SetVerification(tolerance time.Duration, ignoreAPIVersionMismatch bool) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.verifyOptions = webhook.ConstructEventOptions{
+		Tolerance:                tolerance,
+		IgnoreAPIVersionMismatch: ignoreAPIVersionMismatch,
+	}
+}
+
+// countRejection counts a delivery rejected for reason
+func (wh *WebhookHandler) countRejection(reason string) {
+	wh.rejectedEvents.Add(1)
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.rejectionReasons == nil {
+		wh.rejectionReasons = make(map[string]int)
+	}
+	wh.rejectionReasons[reason]++
+}
+
+// GetRejectionReasons returns how many deliveries were rejected by reason
+func (wh *WebhookHandler) GetRejectionReasons() map[string]int {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	reasons := make(map[string]int, len(wh.rejectionReasons))
+	for reason, count := range wh.rejectionReasons {
+		reasons[reason] = count
+	}
+
+	return reasons
+}
@@ -0,0 +1,216 @@
+package glance
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+// signWebhookPayload returns the Stripe-Signature header Stripe would send
+// with payload for an endpoint with secret
+func signWebhookPayload(payload, secret string) string {
+	return signWebhookPayloadAt(payload, secret, time.Now())
+}
+
+// signWebhookPayloadAt is signWebhookPayload with the payload signed at
+// signedAt, such as in the past for a delayed delivery or a skewed clock
+func signWebhookPayloadAt(payload, secret string, signedAt time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%s", signedAt.Unix(), hex.EncodeToString(webhook.ComputeSignature(signedAt, []byte(payload), secret)))
+}
+
+func TestConstructWebhookEvent(t *testing.T) {
+	secrets := []webhookSecret{
+		{Secret: "whsec_live", Mode: "live"},
+		{Secret: "whsec_test", Mode: "test"},
+		{Secret: "whsec_any"},
+	}
+
+	tests := []struct {
+		name         string
+		livemode     bool
+		secret       string
+		wantLivemode bool
+		wantErr      bool
+	}{
+		{name: "live endpoint", livemode: true, secret: "whsec_live", wantLivemode: true},
+		{name: "test endpoint", secret: "whsec_test"},
+		{name: "secret without a mode", livemode: true, secret: "whsec_any", wantLivemode: true},
+		{name: "attributed to the mode of the secret", livemode: true, secret: "whsec_test"},
+		{name: "unknown secret", secret: "whsec_other", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := fmt.Sprintf(`{"id": "evt_1", "type": "customer.created", "livemode": %v, "api_version": %q}`, tt.livemode, stripe.APIVersion)
+			event, err := constructWebhookEvent([]byte(payload), signWebhookPayload(payload, tt.secret), secrets, webhook.ConstructEventOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if event.ID != "evt_1" || event.Livemode != tt.wantLivemode {
+				t.Errorf("expected evt_1 with livemode %v, got %s with livemode %v", tt.wantLivemode, event.ID, event.Livemode)
+			}
+		})
+	}
+
+	if _, err := constructWebhookEvent([]byte(`{}`), signWebhookPayload(`{}`, "whsec_live"), nil, webhook.ConstructEventOptions{}); err == nil {
+		t.Error("expected an error without secrets")
+	}
+
+	// Verified by the first secret, and not reported as a bad signature of
+	// the last one
+	payload := `{"id": "evt_1", "type": "customer.created", "api_version": "2020-08-27"}`
+	if _, err := constructWebhookEvent([]byte(payload), signWebhookPayload(payload, "whsec_live"), secrets, webhook.ConstructEventOptions{}); webhookRejectionReason(err) != webhookRejectedInvalidPayload {
+		t.Errorf("expected an API version mismatch to be rejected as %s, got %v", webhookRejectedInvalidPayload, err)
+	}
+}
+
+func TestWebhookHandler_CountsRejectedEvents(t *testing.T) {
+	handler := &WebhookHandler{secrets: []webhookSecret{{Secret: "whsec_live", Mode: "live"}, {Secret: "whsec_test", Mode: "test"}}}
+
+	payload := `{"id": "evt_1", "type": "customer.updated"}`
+	for _, signature := range []string{signWebhookPayload(payload, "whsec_other"), ""} {
+		request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+		request.Header.Set("Stripe-Signature", signature)
+		recorder := httptest.NewRecorder()
+		handler.HandleWebhook(recorder, request)
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("expected %d, got %d", http.StatusUnauthorized, recorder.Code)
+		}
+	}
+
+	if rejected := handler.rejectedEvents.Load(); rejected != 2 {
+		t.Errorf("expected 2 rejected events, got %d", rejected)
+	}
+
+	reasons := handler.GetRejectionReasons()
+	if reasons[webhookRejectedBadSignature] != 1 || reasons[webhookRejectedMissingSignature] != 1 {
+		t.Errorf("expected a bad and a missing signature, got %v", reasons)
+	}
+}
+
+func TestConstructWebhookEvent_Tolerance(t *testing.T) {
+	payload := fmt.Sprintf(`{"id": "evt_1", "type": "customer.created", "api_version": %q}`, stripe.APIVersion)
+	secrets := []webhookSecret{{Secret: "whsec_live"}}
+
+	tests := []struct {
+		name       string
+		signedAgo  time.Duration
+		tolerance  time.Duration
+		secret     string
+		wantReason string // empty when verified
+	}{
+		{name: "within the default tolerance", signedAgo: 4 * time.Minute},
+		{name: "past the default tolerance", signedAgo: 6 * time.Minute, wantReason: webhookRejectedExpiredTimestamp},
+		{name: "within a loosened tolerance", signedAgo: 6 * time.Minute, tolerance: 10 * time.Minute},
+		{name: "past a tightened tolerance", signedAgo: 2 * time.Minute, tolerance: time.Minute, wantReason: webhookRejectedExpiredTimestamp},
+		// The clock of the server is behind the one of Stripe
+		{name: "signed in the future", signedAgo: -2 * time.Minute},
+		{name: "bad signature", secret: "whsec_other", wantReason: webhookRejectedBadSignature},
+		{name: "expired and bad signature", signedAgo: time.Hour, secret: "whsec_other", wantReason: webhookRejectedExpiredTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			if secret == "" {
+				secret = "whsec_live"
+			}
+
+			signature := signWebhookPayloadAt(payload, secret, time.Now().Add(-tt.signedAgo))
+			_, err := constructWebhookEvent([]byte(payload), signature, secrets, webhook.ConstructEventOptions{Tolerance: tt.tolerance})
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if reason := webhookRejectionReason(err); reason != tt.wantReason {
+				t.Errorf("expected %s, got %s (%v)", tt.wantReason, reason, err)
+			}
+		})
+	}
+
+	if reason := webhookRejectionReason(errNoWebhookSecret); reason != webhookRejectedNoSecret {
+		t.Errorf("expected %s without secrets, got %s", webhookRejectedNoSecret, reason)
+	}
+
+	if reason := webhookRejectionReason(webhook.ErrInvalidHeader); reason != webhookRejectedInvalidHeader {
+		t.Errorf("expected %s, got %s", webhookRejectedInvalidHeader, reason)
+	}
+}
+
+func TestWebhookHandler_AppliesTolerance(t *testing.T) {
+	handler := &WebhookHandler{secrets: []webhookSecret{{Secret: "whsec_live"}}, eventHandlers: make(map[string][]EventHandlerFunc), maxEventLog: 10}
+	handler.SetVerification(time.Minute, false)
+
+	payload := fmt.Sprintf(`{"id": "evt_1", "type": "customer.updated", "api_version": %q}`, stripe.APIVersion)
+	request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+	request.Header.Set("Stripe-Signature", signWebhookPayloadAt(payload, "whsec_live", time.Now().Add(-2*time.Minute)))
+	recorder := httptest.NewRecorder()
+	handler.HandleWebhook(recorder, request)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+
+	if reasons := handler.GetRejectionReasons(); reasons[webhookRejectedExpiredTimestamp] != 1 {
+		t.Errorf("expected an expired timestamp, got %v", reasons)
+	}
+}
+
+func TestWebhooksConfigured(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "")
+	defer func() { configuredWebhookSecrets = nil }()
+
+	configuredWebhookSecrets = []webhookSecret{{Secret: "whsec_live", Mode: "live"}}
+	if !webhooksConfigured("live") || webhooksConfigured("test") {
+		t.Error("expected webhooks to be configured for live mode only")
+	}
+
+	configuredWebhookSecrets = nil
+	if webhooksConfigured("live") {
+		t.Error("expected webhooks not to be configured without secrets")
+	}
+
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_env")
+	if !webhooksConfigured("live") || !webhooksConfigured("test") {
+		t.Error("expected STRIPE_WEBHOOK_SECRET to cover both modes")
+	}
+}
+
+func TestValidateWebhookSecrets(t *testing.T) {
+	tests := []struct {
+		secrets       []webhookSecret
+		expectedError string
+	}{
+		{secrets: []webhookSecret{{Secret: "whsec_live", Mode: "live"}, {Secret: "whsec_any"}}},
+		{secrets: []webhookSecret{{Mode: "live"}}, expectedError: "secret 1 is empty"},
+		{secrets: []webhookSecret{{Secret: "whsec_live", Mode: "production"}}, expectedError: "must be 'live' or 'test'"},
+	}
+
+	for _, tt := range tests {
+		err := validateWebhookSecrets(tt.secrets)
+		if tt.expectedError == "" && err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else if tt.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedError)) {
+			t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+		}
+	}
+}
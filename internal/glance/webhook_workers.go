@@ -0,0 +1,190 @@
+package glance
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const (
+	// Events are processed by defaultWebhookWorkers workers, with up to
+	// defaultWebhookQueueSize more waiting, unless stripe-webhook workers and
+	// queue-size are set
+	defaultWebhookWorkers   = 4
+	defaultWebhookQueueSize = 100
+
+	// webhookEnqueueTimeout is how long a delivery waits for room in a full
+	// queue before Stripe is told to retry it later. Stripe waits up to 20
+	// seconds for a response.
+	webhookEnqueueTimeout = 2 * time.Second
+)
+
+var (
+	errWebhookQueueFull   = errors.New("webhook queue is full, retry later")
+	errWebhookQueueClosed = errors.New("server is shutting down, retry later")
+)
+
+// webhookWorkerPool processes webhook events with a fixed number of workers,
+// so that a burst of events doesn't hit the metrics store and Stripe all at
+// once
+type webhookWorkerPool struct {
+	mu       sync.RWMutex // held for writing to close queue
+	queue    chan stripe.Event
+	closed   bool
+	workers  int
+	busy     atomic.Int64
+	rejected atomic.Int64 // deliveries turned away with a full queue
+	done     sync.WaitGroup
+}
+
+func newWebhookWorkerPool(workers, queueSize int, process func(stripe.Event)) *webhookWorkerPool {
+	pool := &webhookWorkerPool{
+		queue:   make(chan stripe.Event, queueSize),
+		workers: workers,
+	}
+
+	pool.done.Add(workers)
+	for range workers {
+		go func() {
+			defer pool.done.Done()
+			for event := range pool.queue {
+				pool.busy.Add(1)
+				process(event)
+				pool.busy.Add(-1)
+			}
+		}()
+	}
+
+	return pool
+}
+
+// enqueue queues event for the workers, waiting up to timeout for room when
+// the queue is full
+func (p *webhookWorkerPool) enqueue(event stripe.Event, timeout time.Duration) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errWebhookQueueClosed
+	}
+
+	select {
+	case p.queue <- event:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case p.queue <- event:
+		return nil
+	case <-timer.C:
+		p.rejected.Add(1)
+		return errWebhookQueueFull
+	}
+}
+
+// close stops accepting events and waits for the workers to process the
+// events already queued
+func (p *webhookWorkerPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	queued := len(p.queue)
+	close(p.queue)
+	p.mu.Unlock()
+
+	if queued > 0 {
+		slog.Info("Processing queued webhook events before stopping", "queued", queued)
+	}
+	p.done.Wait()
+}
+
+// WebhookQueueStats is the state of the webhook worker pool
+type WebhookQueueStats struct {
+	Depth       int   `json:"depth"`
+	Capacity    int   `json:"capacity"`
+	Workers     int   `json:"workers"`
+	BusyWorkers int   `json:"busy_workers"`
+	Rejected    int64 `json:"rejected"`
+}
+
+func (p *webhookWorkerPool) stats() WebhookQueueStats {
+	return WebhookQueueStats{
+		Depth:       len(p.queue),
+		Capacity:    cap(p.queue),
+		Workers:     p.workers,
+		BusyWorkers: int(p.busy.Load()),
+		Rejected:    p.rejected.Load(),
+	}
+}
+
+// StartWorkers processes events received from now on with workers workers
+// and up to queueSize more waiting. Without workers, every event is processed
+// in its own goroutine.
+func (wh *WebhookHandler) StartWorkers(workers, queueSize int) {
+	pool := newWebhookWorkerPool(max(1, workers), max(1, queueSize), wh.processEvent)
+
+	wh.mu.Lock()
+	previous := wh.workers
+	wh.workers = pool
+	wh.mu.Unlock()
+
+	if previous != nil {
+		previous.close()
+	}
+}
+
+// StopWorkers waits for the queued events to be processed, after which events
+// are turned away, and dead-letters the events waiting to be retried
+func (wh *WebhookHandler) StopWorkers() {
+	wh.mu.RLock()
+	pool := wh.workers
+	wh.mu.RUnlock()
+
+	if pool != nil {
+		pool.close()
+	}
+
+	wh.stopRetries()
+}
+
+// dispatch hands event to the workers
+func (wh *WebhookHandler) dispatch(event stripe.Event) error {
+	wh.mu.RLock()
+	pool := wh.workers
+	wh.mu.RUnlock()
+
+	if pool == nil {
+		go wh.processEvent(event)
+		return nil
+	}
+
+	return pool.enqueue(event, webhookEnqueueTimeout)
+}
+
+// GetQueueStats returns the state of the worker pool, false without one
+func (wh *WebhookHandler) GetQueueStats() (WebhookQueueStats, bool) {
+	if wh == nil {
+		return WebhookQueueStats{}, false
+	}
+
+	wh.mu.RLock()
+	pool := wh.workers
+	wh.mu.RUnlock()
+
+	if pool == nil {
+		return WebhookQueueStats{}, false
+	}
+
+	return pool.stats(), true
+}
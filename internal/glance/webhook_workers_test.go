@@ -0,0 +1,136 @@
+package glance
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestWebhookWorkerPool_BoundsConcurrency(t *testing.T) {
+	var running, peak, processed atomic.Int32
+	release := make(chan struct{})
+
+	pool := newWebhookWorkerPool(2, 10, func(event stripe.Event) {
+		current := running.Add(1)
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		processed.Add(1)
+	})
+
+	for i := range 6 {
+		if err := pool.enqueue(stripe.Event{ID: "evt_" + string(rune('a'+i))}, time.Second); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	waitFor(t, "both workers to be busy", func() bool { return pool.stats().BusyWorkers == 2 })
+	if stats := pool.stats(); stats.Depth != 4 || stats.Capacity != 10 || stats.Workers != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	close(release)
+	pool.close()
+
+	if processed.Load() != 6 {
+		t.Errorf("expected the queue to be drained, processed %d events", processed.Load())
+	}
+
+	if peak.Load() != 2 {
+		t.Errorf("expected at most 2 events processed at once, got %d", peak.Load())
+	}
+
+	if err := pool.enqueue(stripe.Event{ID: "evt_late"}, time.Second); !errors.Is(err, errWebhookQueueClosed) {
+		t.Errorf("expected events to be turned away once closed, got %v", err)
+	}
+}
+
+func TestWebhookWorkerPool_RejectsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWebhookWorkerPool(1, 1, func(event stripe.Event) { <-release })
+	defer func() {
+		close(release)
+		pool.close()
+	}()
+
+	if err := pool.enqueue(stripe.Event{ID: "evt_processing"}, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, "the worker to be busy", func() bool { return pool.stats().BusyWorkers == 1 })
+
+	if err := pool.enqueue(stripe.Event{ID: "evt_queued"}, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pool.enqueue(stripe.Event{ID: "evt_rejected"}, 10*time.Millisecond); !errors.Is(err, errWebhookQueueFull) {
+		t.Errorf("expected a full queue, got %v", err)
+	}
+
+	if rejected := pool.stats().Rejected; rejected != 1 {
+		t.Errorf("expected 1 rejected event, got %d", rejected)
+	}
+}
+
+func TestWebhookHandler_TurnsAwayEventsWithoutWorkers(t *testing.T) {
+	handler := &WebhookHandler{
+		secrets:       []webhookSecret{{Secret: "whsec_live"}},
+		eventHandlers: make(map[string][]EventHandlerFunc),
+		maxEventLog:   10,
+	}
+	handler.StartWorkers(1, 1)
+	handler.StopWorkers()
+
+	payload := fmt.Sprintf(`{"id": "evt_shutdown", "type": "customer.updated", "api_version": %q}`, stripe.APIVersion)
+	request := httptest.NewRequest(http.MethodPost, stripeWebhookPath, strings.NewReader(payload))
+	request.Header.Set("Stripe-Signature", signWebhookPayload(payload, "whsec_live"))
+	recorder := httptest.NewRecorder()
+	handler.HandleWebhook(recorder, request)
+
+	// Stripe retries the event later
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	if events := handler.GetEventLog(); len(events) != 0 {
+		t.Errorf("expected the event not to be processed, got %+v", events)
+	}
+}
+
+func TestMetricsHandler_WebhookQueue(t *testing.T) {
+	handler := newRetryTestHandler(1, time.Millisecond)
+	handler.StartWorkers(3, 20)
+	defer handler.StopWorkers()
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler(handler)(recorder, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, metric := range []string{
+		"glance_webhook_queue_depth 0",
+		"glance_webhook_queue_capacity 20",
+		`glance_webhook_workers{state="idle"} 3`,
+		"glance_webhook_queue_rejected_total 0",
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("expected %q in the metrics", metric)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	MetricsHandler(nil)(recorder, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+	if strings.Contains(recorder.Body.String(), "glance_webhook_queue") {
+		t.Error("expected no webhook metrics without webhooks")
+	}
+}
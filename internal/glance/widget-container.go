@@ -10,6 +10,15 @@ type containerWidgetBase struct {
 	Widgets widgets `yaml:"widgets"`
 }
 
+// widgetContainer is a widget holding other widgets, such as a group
+type widgetContainer interface {
+	containedWidgets() widgets
+}
+
+func (widget *containerWidgetBase) containedWidgets() widgets {
+	return widget.Widgets
+}
+
 func (widget *containerWidgetBase) _initializeWidgets() error {
 	for i := range widget.Widgets {
 		if err := widget.Widgets[i].initialize(); err != nil {
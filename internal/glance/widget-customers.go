@@ -2,16 +2,16 @@ package glance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
-	"os"
-	"strconv"
+	"math"
 	"time"
 
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/customer"
-	"github.com/stripe/stripe-go/v81/subscription"
+	"golang.org/x/text/language"
 )
 
 var customersWidgetTemplate = mustParseTemplate("customers.html", "widget-base.html")
@@ -19,25 +19,215 @@ var customersWidgetTemplate = mustParseTemplate("customers.html", "widget-base.h
 type customersWidget struct {
 	widgetBase       `yaml:",inline"`
 	StripeAPIKey     string `yaml:"stripe-api-key"`
-	StripeMode       string `yaml:"stripe-mode"` // 'live' or 'test'
+	StripeMode       string `yaml:"stripe-mode"`   // 'live' or 'test'
+	AccountLabel     string `yaml:"account-label"`
+	Counting         string `yaml:"counting"`      // 'exact', 'estimated' or 'incremental'
+	CustomerBase     string `yaml:"customer-base"` // 'all' or 'paying', the churn rate denominator
+	TrendMonths      int    `yaml:"trend-months"`
+
+	// Point the growth rate compares the total against: previous-update, a
+	// number of days like 30d, start-of-month or start-of-year
+	GrowthBaseline string `yaml:"growth-baseline"`
+	growthBaseline growthBaseline
+
+	// Number of countries listed in the geography breakdown, the rest are
+	// grouped as Other
+	TopCountries int `yaml:"top-countries"`
+
+	// Number of plans listed in the breakdown by plan, the rest are grouped
+	// as Other
+	TopPlans int `yaml:"top-plans"`
+
+	// Number of delinquent customers listed by MRR, none by default
+	DelinquentList int `yaml:"delinquent-list"`
+
+	// Customer metadata key holding the acquisition channel, such as a
+	// utm_source stamped at signup, new customers are grouped by
+	ChannelMetadataKey string `yaml:"channel-metadata-key"`
+
+	// Numeric customer metadata key, such as an NPS score, averaged over the
+	// retained and the churned customers
+	MetadataScoreKey string `yaml:"metadata-score-key"`
+
+	// Whether customers of active subscriptions without a payment method are
+	// counted
+	ShowPaymentHealth bool `yaml:"show-payment-health"`
+
+	// Period churned customers and the churn rate are measured over,
+	// calendar-month, 30d or 90d
+	ChurnWindow      string `yaml:"churn-window"`
+	churnWindow      churnWindow
+	ChurnWindowLabel string `yaml:"-"`
+
+	// Customers and subscriptions left out of the metrics besides the ones on
+	// a test clock, the ones with metadata matching any of these pairs
+	ExcludeMetadata map[string]string `yaml:"exclude-metadata"`
+	exclusions      exclusionRules
+
+	// Email domains counted as consumers rather than businesses, added to
+	// the built-in free providers unless default-free-email-providers is false
+	FreeEmailProviders        []string `yaml:"free-email-providers"`
+	DefaultFreeEmailProviders *bool    `yaml:"default-free-email-providers"`
+	freeEmailProviders        freeEmailProviders
+
+	// Average monthly revenue per customer in the reporting currency the LTV
+	// is computed from when no MRR is available, none by default
+	FallbackARPU float64 `yaml:"fallback-arpu"`
+
+	// Customer acquisition cost for the LTV/CAC ratio, flat or per month
+	CACConfig cacConfig `yaml:"cac"`
+	cac       cacSchedule
+
+	// Ad accounts whose spend last month per new customer is the CAC,
+	// falling back to cac
+	AdSpendConfig *adSpendConfig `yaml:"ad-spend"`
+	adSpend       []adSpendProvider
+
+	// Time zone months start in, for new and churned customers, trend
+	// labels and snapshot buckets, defaulting to the metrics timezone
+	Timezone string `yaml:"timezone"`
+	timezone *time.Location
+
+	// Currency and locale amounts are shown in, converted from the reporting
+	// currency
+	DisplayCurrency string `yaml:"currency"`
+	Locale          string `yaml:"locale"`
+	locale          language.Tag
+
+	// Set on replicas, which render from the shared store instead of Stripe
+	store *SimpleMetricsDB
 
 	// Customer metrics
-	TotalCustomers   int     `yaml:"-"`
-	NewCustomers     int     `yaml:"-"`
-	ChurnedCustomers int     `yaml:"-"`
-	ChurnRate        float64 `yaml:"-"`
-	ActiveCustomers  int     `yaml:"-"`
+	TotalCustomers       int     `yaml:"-"`
+	NewCustomers         int     `yaml:"-"` // started their first-ever subscription this month
+	ReactivatedCustomers int     `yaml:"-"` // re-subscribed this month after canceling
+	ChurnedCustomers     int     `yaml:"-"`
+	ChurnRate            float64 `yaml:"-"`
+	ActiveCustomers      int     `yaml:"-"`
+	// Subscriptions that started a trial this month
+	NewTrials int `yaml:"-"`
+
+	// Customers with an active or trialing subscription, the rest who never
+	// subscribed or only canceled, and the paying share of the total
+	PayingCustomers int     `yaml:"-"`
+	FreeCustomers   int     `yaml:"-"`
+	PayingShare     float64 `yaml:"-"`
+
+	// New minus churned customers, and the change of the total against the
+	// snapshot of growth-baseline, undefined until history reaches back to it
+	NetGrowth           int       `yaml:"-"`
+	GrowthRate          float64   `yaml:"-"`
+	GrowthDefined       bool      `yaml:"-"`
+	GrowthComparedAt    time.Time `yaml:"-"`
+	GrowthBaselineLabel string    `yaml:"-"`
+
+	// MRR churned over the churn window, and as a percentage of MRR at its
+	// start next to the logo churn rate
+	ChurnedMRR          float64 `yaml:"-"`
+	RevenueChurnRate    float64 `yaml:"-"`
+	RevenueChurnDefined bool    `yaml:"-"`
 
 	// Financial metrics (if available)
 	CAC              float64 `yaml:"-"` // Customer Acquisition Cost
 	LTV              float64 `yaml:"-"` // Lifetime Value
 	LTVtoCAC         float64 `yaml:"-"` // LTV/CAC ratio
+	// Where the revenue per customer of the LTV came from, see
+	// ltvSourceStoredMRR, and whether it was left out for lack of revenue data
+	LTVSource      string `yaml:"-"`
+	LTVUnavailable bool   `yaml:"-"`
+	// Months a customer stays on average, modeled as 1 / monthly churn rate,
+	// infinite without churn, and the actual mean age of the active
+	// subscriptions
+	AverageLifetimeMonths   float64 `yaml:"-"`
+	AverageLifetimeInfinite bool    `yaml:"-"`
+	AverageLifetimeDefined  bool    `yaml:"-"`
+	ActualLifetimeMonths    float64 `yaml:"-"`
+	ActualLifetimeDefined   bool    `yaml:"-"`
+	// Last month's ad spend when the CAC was computed from it
+	AdSpend          float64 `yaml:"-"`
+	CACFromAdSpend   bool    `yaml:"-"`
+	Money            moneyFormat `yaml:"-"`
+
+	// Customers and MRR by country, the top countries followed by Other and
+	// Unknown. Only with exact counting.
+	Countries []countryCustomers `yaml:"-"`
+
+	// New customers this month and the MRR of their active subscriptions per
+	// acquisition channel, with channel-metadata-key
+	Channels []channelCustomers `yaml:"-"`
+
+	// Active, new and churned customers and the churn rate per price, the
+	// top plans by active customers followed by Other
+	Plans []planCustomers `yaml:"-"`
+	// Product names by ID, looked up once for the lifetime of the widget
+	productNames productNameCache
+
+	// Customers and MRR by email domain, businesses on their own domain,
+	// consumers on a free provider and unknown without an email. Only with
+	// exact counting.
+	BusinessCustomers       int     `yaml:"-"`
+	BusinessMRR             float64 `yaml:"-"`
+	ConsumerCustomers       int     `yaml:"-"`
+	ConsumerMRR             float64 `yaml:"-"`
+	UnknownSegmentCustomers int     `yaml:"-"`
+	UnknownSegmentMRR       float64 `yaml:"-"`
+
+	// Number of delinquent customers and the ones with the most MRR, up to
+	// delinquent-list
+	DelinquentCustomers int                  `yaml:"-"`
+	TopDelinquent       []delinquentCustomer `yaml:"-"`
+	// Set when the customers weren't listed and the customers of past due
+	// subscriptions are counted instead
+	DelinquentFromPastDue bool `yaml:"-"`
+
+	// Customers of active subscriptions Stripe has no payment method to
+	// charge for, and the MRR of those subscriptions, with show-payment-health
+	NoPaymentMethodCustomers int     `yaml:"-"`
+	NoPaymentMethodMRR       float64 `yaml:"-"`
+
+	// Average metadata-score-key of the customers with an active subscription
+	// and of the ones who churned over the churn window, with the number of
+	// customers that have a score
+	RetainedScore metadataScore `yaml:"-"`
+	ChurnedScore  metadataScore `yaml:"-"`
+
+	// Number of customers and subscriptions left out of the last update by
+	// the exclusion rules, to sanity check exclude-metadata
+	ExcludedCustomers     int `yaml:"-"`
+	ExcludedSubscriptions int `yaml:"-"`
 
 	// Trend data
 	TrendLabels      []string  `yaml:"-"`
 	TrendValues      []int     `yaml:"-"`
+	// Whether each trend point is estimated rather than stored history, and
+	// how many are
+	TrendEstimated       []bool `yaml:"-"`
+	TrendEstimatedMonths int    `yaml:"-"`
+
+	// Estimation details when counting is 'estimated'
+	TotalIsEstimate    bool      `yaml:"-"`
+	// Whether the total was kept from webhooks or listed with incremental
+	// counting, see customerCountSourceWebhook
+	CountSource        string    `yaml:"-"`
+	TotalMargin        int       `yaml:"-"`
+	EstimateConfidence float64   `yaml:"-"` // percent
+	LastExactCountAt   time.Time `yaml:"-"`
 }
 
+const (
+	customerCountingExact       = "exact"
+	customerCountingEstimated   = "estimated"
+	customerCountingIncremental = "incremental"
+)
+
+// customerEstimateSamplePages is how many pages of the most recently created
+// customers are listed when estimating the total
+const customerEstimateSamplePages = 5
+
+// customerExactCountHour is the local hour at which estimated and incremental
+// widgets take a full exact count
+const customerExactCountHour = 3
+
 func (w *customersWidget) initialize() error {
 	w.widgetBase.withTitle("Customer Metrics").withCacheDuration(time.Hour)
 
@@ -53,427 +243,714 @@ func (w *customersWidget) initialize() error {
 		return fmt.Errorf("stripe-mode must be 'live' or 'test', got: %s", w.StripeMode)
 	}
 
+	if err := validateAccountLabel(w.AccountLabel); err != nil {
+		return fmt.Errorf("account-label: %w", err)
+	}
+
+	if w.Counting == "" {
+		w.Counting = customerCountingExact
+	}
+
+	if w.Counting != customerCountingExact && w.Counting != customerCountingEstimated && w.Counting != customerCountingIncremental {
+		return fmt.Errorf("counting must be 'exact', 'estimated' or 'incremental', got: %s", w.Counting)
+	}
+
+	// Webhook events are counted per mode, as they don't tell which of the
+	// accounts of a mode they came from
+	if w.Counting == customerCountingIncremental && w.AccountLabel != "" {
+		return fmt.Errorf("counting: incremental can't be used with account-label, as customer webhook events are counted per mode")
+	}
+
+	if err := validateCustomerBase(&w.CustomerBase); err != nil {
+		return err
+	}
+
+	if err := validateTrendMonths(&w.TrendMonths); err != nil {
+		return err
+	}
+
+	if err := validateMoneyOptions(w.DisplayCurrency, w.Locale, &w.locale); err != nil {
+		return err
+	}
+
+	if w.TopCountries == 0 {
+		w.TopCountries = defaultTopCountries
+	}
+
+	if w.TopCountries < 0 {
+		return fmt.Errorf("top-countries must be positive, got: %d", w.TopCountries)
+	}
+
+	if w.TopPlans == 0 {
+		w.TopPlans = defaultTopPlans
+	}
+
+	if w.TopPlans < 0 {
+		return fmt.Errorf("top-plans must be positive, got: %d", w.TopPlans)
+	}
+
+	if w.FallbackARPU < 0 {
+		return fmt.Errorf("fallback-arpu must not be negative, got: %v", w.FallbackARPU)
+	}
+
+	if w.DelinquentList < 0 {
+		return fmt.Errorf("delinquent-list must not be negative, got: %d", w.DelinquentList)
+	}
+
+	timezone, err := loadTimezone(w.Timezone)
+	if err != nil {
+		return err
+	}
+	w.timezone = timezone
+
+	if w.growthBaseline, err = parseGrowthBaseline(w.GrowthBaseline); err != nil {
+		return err
+	}
+
+	if w.churnWindow, err = parseChurnWindow(w.ChurnWindow); err != nil {
+		return err
+	}
+	w.ChurnWindowLabel = w.churnWindow.label()
+
+	if w.CACConfig.set() {
+		cac, err := parseCAC(w.CACConfig)
+		if err != nil {
+			return err
+		}
+		w.cac = cac
+	} else {
+		w.cac = cacFromEnv()
+	}
+
+	if w.exclusions, err = newExclusionRules(w.ExcludeMetadata); err != nil {
+		return err
+	}
+
+	useDefaultProviders := w.DefaultFreeEmailProviders == nil || *w.DefaultFreeEmailProviders
+	if w.freeEmailProviders, err = newFreeEmailProviders(useDefaultProviders, w.FreeEmailProviders); err != nil {
+		return err
+	}
+
+	if w.adSpend, err = newAdSpendProviders(w.AdSpendConfig); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (w *customersWidget) update(ctx context.Context) {
-	// Get decrypted API key
+// getStripeClient decrypts the configured API key and returns a pooled client for it
+func (w *customersWidget) getStripeClient() (*StripeClientWrapper, error) {
 	encService, err := GetEncryptionService()
 	if err != nil {
-		w.withError(fmt.Errorf("encryption service unavailable: %w", err))
-		return
+		return nil, fmt.Errorf("encryption service unavailable: %w", err)
 	}
 
 	apiKey, err := encService.DecryptIfNeeded(w.StripeAPIKey)
 	if err != nil {
-		w.withError(fmt.Errorf("failed to decrypt API key: %w", err))
-		return
+		return nil, fmt.Errorf("failed to decrypt API key: %w", err)
 	}
 
-	// Get Stripe client with resilience
 	pool := GetStripeClientPool()
 	client, err := pool.GetClient(apiKey, w.StripeMode)
 	if err != nil {
-		w.withError(fmt.Errorf("failed to get Stripe client: %w", err))
-		return
+		return nil, fmt.Errorf("failed to get Stripe client: %w", err)
 	}
 
 	// Set Stripe API key for direct API calls
 	stripe.Key = apiKey
 
+	return client, nil
+}
+
+// metricsKey is the key the widget's snapshots are stored under
+func (w *customersWidget) metricsKey() string {
+	return metricsKey(w.StripeMode, w.AccountLabel)
+}
+
+// now returns the current time in the time zone of the widget
+func (w *customersWidget) now() time.Time {
+	return time.Now().In(widgetTimezone(w.timezone))
+}
+
+func (w *customersWidget) update(ctx context.Context) {
+	if w.store != nil {
+		w.loadFromStore(ctx, w.store)
+		return
+	}
+
+	// Get Stripe client with resilience
+	client, err := w.getStripeClient()
+	if err != nil {
+		w.withError(err)
+		return
+	}
+
+	w.Money = displayMoneyFormat(ctx, GetCurrencyConverter(), w.DisplayCurrency, w.locale)
+
 	// Try to load from database first for trend data
+	var history []*CustomerSnapshot
 	db, dbErr := GetMetricsDatabase("")
 	if dbErr == nil {
-		// Get historical data from database
-		endTime := time.Now()
-		startTime := endTime.AddDate(0, -6, 0) // Last 6 months
-		history, err := db.GetCustomerHistory(ctx, w.StripeMode, startTime, endTime)
-		if err == nil && len(history) > 0 {
-			w.loadHistoricalData(history)
+		// Get one snapshot per month from the database
+		monthly, err := db.GetCustomerMonthly(ctx, w.metricsKey(), w.now(), w.TrendMonths)
+		if err == nil {
+			history = monthly
 		}
 	}
 
-	// Get total customers with retry
-	totalCustomers, err := w.getTotalCustomersWithRetry(ctx, client)
+	// Get total customers with retry, estimate it for very large accounts or
+	// keep it from webhooks. Countries and delinquent customers are only
+	// known when every customer is listed.
+	var totalCustomers int
+	var listed *listedCustomers
+	w.ExcludedCustomers = 0
+	w.CountSource = ""
+	switch w.Counting {
+	case customerCountingEstimated:
+		totalCustomers, err = w.estimateTotalCustomers(ctx, client)
+	case customerCountingIncremental:
+		totalCustomers, listed, err = w.countCustomersIncrementally(ctx, client)
+	default:
+		listed, err = w.listCustomersWithRetry(ctx, client)
+	}
+	if err == nil && listed != nil {
+		totalCustomers = len(listed.Countries)
+		w.ExcludedCustomers = listed.Excluded
+	}
 	if !w.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
 	w.TotalCustomers = totalCustomers
 
-	// Get active customers (with active subscriptions)
-	activeCustomers, err := w.getActiveCustomersWithRetry(ctx, client)
-	if err != nil {
-		slog.Error("Failed to get active customers", "error", err)
+	// Subscriptions are listed once and shared with the revenue widget of the
+	// same account
+	churnSince := w.churnWindow.start(w.now())
+	scan, scanErr := scanSubscriptionsCanceledSince(ctx, client, w.now(), churnSince, w.cacheDuration)
+	w.ExcludedSubscriptions = 0
+	if scanErr != nil {
+		slog.Error("Failed to list subscriptions", "error", scanErr)
 	} else {
-		w.ActiveCustomers = activeCustomers
+		scan, w.ExcludedSubscriptions = w.exclusions.filterScan(scan)
+		w.ActiveCustomers = countActiveCustomers(scan)
 	}
 
-	// Get new customers this month
-	newCustomers, err := w.getNewCustomersWithRetry(ctx, client)
-	if err != nil {
-		slog.Error("Failed to get new customers", "error", err)
-	} else {
-		w.NewCustomers = newCustomers
+	if w.ExcludedCustomers > 0 || w.ExcludedSubscriptions > 0 {
+		slog.Debug("Excluded customers and subscriptions from customer metrics", "mode", w.StripeMode, "customers", w.ExcludedCustomers, "subscriptions", w.ExcludedSubscriptions)
 	}
 
-	// Get churned customers this month
-	churnedCustomers, err := w.getChurnedCustomersWithRetry(ctx, client)
-	if err != nil {
-		slog.Error("Failed to get churned customers", "error", err)
-	} else {
-		w.ChurnedCustomers = churnedCustomers
-	}
-
-	// Calculate churn rate
-	if w.TotalCustomers > 0 {
-		w.ChurnRate = (float64(w.ChurnedCustomers) / float64(w.TotalCustomers)) * 100
-	}
-
-	// Calculate LTV using actual MRR data
-	// LTV = Average MRR per customer / Monthly churn rate
-	if w.ActiveCustomers > 0 && w.ChurnRate > 0 {
-		// Try to get current MRR from database first (most efficient)
-		var avgRevenuePerCustomer float64
-		if dbErr == nil {
-			revenueSnapshot, err := db.GetLatestRevenue(ctx, w.StripeMode)
-			if err == nil && revenueSnapshot != nil && revenueSnapshot.MRR > 0 {
-				// Use actual MRR data
-				avgRevenuePerCustomer = revenueSnapshot.MRR / float64(w.ActiveCustomers)
-				slog.Debug("Calculated LTV from database MRR",
-					"mrr", revenueSnapshot.MRR,
-					"active_customers", w.ActiveCustomers,
-					"avg_revenue", avgRevenuePerCustomer)
-			} else {
-				// Fallback: Calculate MRR directly from Stripe
-				currentMRR, err := w.calculateCurrentMRRWithRetry(ctx, client)
-				if err == nil && currentMRR > 0 {
-					avgRevenuePerCustomer = currentMRR / float64(w.ActiveCustomers)
-					slog.Debug("Calculated LTV from fresh MRR calculation",
-						"mrr", currentMRR,
-						"active_customers", w.ActiveCustomers,
-						"avg_revenue", avgRevenuePerCustomer)
-				} else {
-					// Ultimate fallback: use a conservative estimate
-					avgRevenuePerCustomer = 29.0 // Conservative default for SaaS
-					slog.Warn("Using default average revenue for LTV calculation - could not fetch MRR",
-						"default", avgRevenuePerCustomer,
-						"error", err)
-				}
-			}
+	// New and reactivated customers from the subscriptions started this month,
+	// and churned customers from the ones canceled in the churn window
+	w.Channels = nil
+	if scanErr == nil {
+		starts, err := countCustomerStartsWithRetry(ctx, client, scan)
+		if err != nil {
+			slog.Error("Failed to count new and reactivated customers", "error", err)
 		} else {
-			// No database, calculate fresh
-			currentMRR, err := w.calculateCurrentMRRWithRetry(ctx, client)
-			if err == nil && currentMRR > 0 {
-				avgRevenuePerCustomer = currentMRR / float64(w.ActiveCustomers)
-			} else {
-				avgRevenuePerCustomer = 29.0 // Conservative default
-				slog.Warn("Using default average revenue for LTV calculation",
-					"default", avgRevenuePerCustomer)
+			w.NewCustomers = starts.New
+			w.ReactivatedCustomers = starts.Reactivated
+
+			// New customers by the acquisition channel in their metadata
+			if w.ChannelMetadataKey != "" {
+				w.Channels = channelBreakdown(ctx, starts.NewCustomers, w.ChannelMetadataKey, scan, GetCurrencyConverter(), maxChannels)
 			}
 		}
 
-		monthlyChurnRate := w.ChurnRate / 100.0
-		if monthlyChurnRate > 0 {
-			w.LTV = avgRevenuePerCustomer / monthlyChurnRate
-		}
+		w.ChurnedCustomers = countChurnedCustomers(scan, scan.canceledSince(churnSince))
 	}
 
-	// CAC: Allow manual override via environment variable
-	// In production, integrate with Google Ads, Facebook Ads, etc.
-	cacEnv := os.Getenv("BUSINESS_CAC")
-	if cacEnv != "" {
-		// Parse CAC from environment variable
-		if cacValue, err := strconv.ParseFloat(cacEnv, 64); err == nil {
-			w.CAC = cacValue
-			slog.Debug("Using CAC from environment variable", "cac", cacValue)
-		}
+	if scanErr != nil {
+		scan = nil
+	}
+
+	// Customers and churn per plan, from the same subscriptions
+	w.updatePlans(ctx, client, scan, churnSince)
+
+	// Average metadata score of the retained and churned customers
+	w.updateMetadataScore(scan, churnSince)
+
+	// Break customers and their MRR down by country and email domain
+	w.Countries = nil
+	var segments customerSegments
+	if listed != nil {
+		w.Countries = countryBreakdown(ctx, listed.Countries, scan, GetCurrencyConverter(), w.TopCountries)
+		segments = listed.Segments
+	}
+	w.updateSegments(ctx, segments, scan)
+
+	// Customers Stripe marks delinquent, or without the customer list the
+	// customers of past due subscriptions
+	var delinquent map[string]string
+	w.DelinquentFromPastDue = listed == nil
+	if listed != nil {
+		delinquent = listed.Delinquent
+	} else if scan != nil {
+		delinquent = pastDueCustomers(scan)
 	}
+	w.DelinquentCustomers, w.TopDelinquent = delinquentBreakdown(ctx, delinquent, scan, GetCurrencyConverter(), w.DelinquentList)
+
+	// Customers whose next renewal has nothing to charge, from the customers
+	// expanded on the subscriptions
+	w.NoPaymentMethodCustomers, w.NoPaymentMethodMRR = 0, 0
+	if w.ShowPaymentHealth && scan != nil {
+		health := countMissingPaymentMethods(ctx, scan, GetCurrencyConverter(), w.now())
+		w.NoPaymentMethodCustomers, w.NoPaymentMethodMRR = health.Customers, health.MRR
+	}
+
+	// Paying customers apart from the ones who never paid or only canceled
+	w.updatePayingSplit(scan)
+
+	// Calculate churn rate over the churn window, of all customers or of the
+	// paying ones
+	w.ChurnRate = 0
+	if base := w.churnBase(); base > 0 {
+		w.ChurnRate = (float64(w.ChurnedCustomers) / float64(base)) * 100
+	}
+
+	// Revenue churn over the same window, as one big customer churning
+	// barely moves the logo churn rate
+	var metricsDB *SimpleMetricsDB
+	if dbErr == nil {
+		metricsDB = db
+	}
+	w.updateRevenueChurn(ctx, metricsDB, scan, w.now())
+
+	// Growth of the total against the stored history
+	w.updateGrowth(ctx, metricsDB, w.now())
+
+	// Trial starts this month, the top of the funnel
+	w.updateNewTrials(ctx, metricsDB, scan, w.now())
+
+	// LTV = Average MRR per customer / Monthly churn rate, from the stored
+	// or the listed MRR, or fallback-arpu without either
+	w.updateLTV(ctx, metricsDB, scan, scanErr)
+
+	// Average customer lifetime from the same churn rate as the LTV
+	w.updateLifetime(scan, w.now())
+
+	// CAC of the month being displayed from the cac option, replaced by last
+	// month's ad spend per new customer with ad-spend
 	// If no CAC set, leave it as 0 (will be displayed as N/A in UI)
+	now := w.now()
+	w.CAC = w.cac.at(now)
+	w.AdSpend, w.CACFromAdSpend = 0, false
+	if len(w.adSpend) > 0 && dbErr == nil {
+		w.updateCACFromAdSpend(ctx, db, now)
+	}
 
 	// Calculate LTV/CAC ratio
+	w.LTVtoCAC = 0
 	if w.CAC > 0 {
 		w.LTVtoCAC = w.LTV / w.CAC
 	}
 
-	// Generate trend data
-	w.generateTrendData()
+	// Generate trend data from stored history, estimating only the months
+	// before it
+	w.updateTrend(history)
 
 	// Save to database for historical tracking
 	if dbErr == nil {
 		snapshot := &CustomerSnapshot{
-			Timestamp:        time.Now(),
-			TotalCustomers:   w.TotalCustomers,
-			NewCustomers:     w.NewCustomers,
-			ChurnedCustomers: w.ChurnedCustomers,
-			ChurnRate:        w.ChurnRate,
-			ActiveCustomers:  w.ActiveCustomers,
-			Mode:             w.StripeMode,
+			Timestamp:            time.Now(),
+			TotalCustomers:       w.TotalCustomers,
+			NewCustomers:         w.NewCustomers,
+			ReactivatedCustomers: w.ReactivatedCustomers,
+			ChurnedCustomers:     w.ChurnedCustomers,
+			ChurnRate:            w.ChurnRate,
+			ActiveCustomers:      w.ActiveCustomers,
+			GrowthRate:           w.growthRateValue(),
+			NetGrowth:            w.NetGrowth,
+			Mode:                 w.StripeMode,
+			Account:              w.AccountLabel,
+			Estimated:            w.TotalIsEstimate,
 		}
 
-		if err := db.SaveCustomerSnapshot(ctx, snapshot); err != nil {
+		// Only queued, so the error is known before the snapshot is stored
+		if err := db.SaveCustomerSnapshot(ctx, snapshot); errors.Is(err, errAdministrativelyPaused) {
+			slog.Info("Not saving customer snapshot while paused", "mode", w.StripeMode)
+		} else if err != nil {
 			slog.Error("Failed to save customer snapshot", "error", err)
 		}
 	}
 }
 
-func (w *customersWidget) getTotalCustomers(ctx context.Context) (int, error) {
-	params := &stripe.CustomerListParams{}
-	params.Context = ctx
+// listedCustomers is what the customers widget reads from the list of every
+// customer
+type listedCustomers struct {
+	Countries customerCountries
+	Segments  customerSegments
+	// Number of customers left out by the exclusion rules
+	Excluded int
+	// Names of the customers Stripe marks delinquent by ID
+	Delinquent map[string]string
+}
 
-	count := 0
-	iter := customer.List(params)
+// customerLister lists the customers matching params, calling fn with each
+// until it returns false
+type customerLister interface {
+	listCustomers(params *stripe.CustomerListParams, fn func(c *stripe.Customer) bool) error
+}
 
-	for iter.Next() {
-		count++
-	}
+// stripeCustomerLister lists customers from Stripe
+type stripeCustomerLister struct{}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list customers: %w", err)
+func (stripeCustomerLister) listCustomers(params *stripe.CustomerListParams, fn func(c *stripe.Customer) bool) error {
+	iter := customer.List(params)
+	for iter.Next() {
+		if !fn(iter.Customer()) {
+			break
+		}
 	}
 
-	return count, nil
+	return iter.Err()
 }
 
-func (w *customersWidget) getActiveCustomers(ctx context.Context) (int, error) {
-	// Get customers with active subscriptions
-	params := &stripe.SubscriptionListParams{}
-	params.Status = stripe.String("active")
+// listCustomers lists every customer with their country, the segment of their
+// email domain and whether they are delinquent, expanding the default payment method so that the country of its
+// card is known without retrieving each customer
+func (w *customersWidget) listCustomers(ctx context.Context, lister customerLister) (*listedCustomers, error) {
+	params := &stripe.CustomerListParams{}
+	params.Limit = stripe.Int64(stripeListPageSize)
 	params.Context = ctx
+	params.AddExpand("data.invoice_settings.default_payment_method")
 
-	// Use a map to track unique customers
-	uniqueCustomers := make(map[string]bool)
-	iter := subscription.List(params)
+	listed := &listedCustomers{Countries: make(customerCountries), Segments: make(customerSegments), Delinquent: make(map[string]string)}
 
-	for iter.Next() {
-		sub := iter.Subscription()
-		if sub.Customer != nil {
-			uniqueCustomers[sub.Customer.ID] = true
+	err := lister.listCustomers(params, func(c *stripe.Customer) bool {
+		if w.exclusions.excludesCustomer(c) {
+			listed.Excluded++
+			return true
 		}
-	}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list active subscriptions: %w", err)
+		listed.Countries[c.ID] = customerCountry(c)
+		listed.Segments[c.ID] = w.freeEmailProviders.segment(c.Email)
+		if c.Delinquent {
+			listed.Delinquent[c.ID] = customerDisplayName(c)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customers: %w", err)
 	}
 
-	return len(uniqueCustomers), nil
+	return listed, nil
 }
 
-func (w *customersWidget) getNewCustomers(ctx context.Context) (int, error) {
-	// Get customers created this month
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+// customerSample is the result of listing customers created since a point in time
+type customerSample struct {
+	count    int
+	complete bool
+	oldest   time.Time
+}
+
+// sampleNewCustomers lists customers created since the given time, newest first,
+// stopping after customerEstimateSamplePages pages
+func (w *customersWidget) sampleNewCustomers(ctx context.Context, lister customerLister, since time.Time) (customerSample, error) {
+	const pageSize = stripeListPageSize
 
 	params := &stripe.CustomerListParams{}
-	params.Filters.AddFilter("created", "gte", fmt.Sprintf("%d", startOfMonth.Unix()))
+	params.Filters.AddFilter("created", "gte", fmt.Sprintf("%d", since.Unix()))
+	params.Limit = stripe.Int64(pageSize)
 	params.Context = ctx
 
-	count := 0
-	iter := customer.List(params)
+	sample := customerSample{complete: true}
 
-	for iter.Next() {
-		count++
+	// Excluded customers count toward the pages listed but not the sample
+	sampled := 0
+	err := lister.listCustomers(params, func(c *stripe.Customer) bool {
+		if sampled >= customerEstimateSamplePages*pageSize {
+			sample.complete = false
+			return false
+		}
+		sampled++
+
+		sample.oldest = time.Unix(c.Created, 0)
+		if !w.exclusions.excludesCustomer(c) {
+			sample.count++
+		}
+		return true
+	})
+	if err != nil {
+		return customerSample{}, fmt.Errorf("failed to sample new customers: %w", err)
 	}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list new customers: %w", err)
+	return sample, nil
+}
+
+// estimateTotalCustomers estimates the total number of customers from the last
+// exact count instead of listing all of them. When no exact count exists yet one
+// is taken now.
+func (w *customersWidget) estimateTotalCustomers(ctx context.Context, client *StripeClientWrapper) (int, error) {
+	db, err := GetMetricsDatabase("")
+	if err != nil {
+		return 0, err
 	}
 
-	return count, nil
+	baseline, err := db.GetCustomerBaseline(ctx, w.metricsKey())
+	if err != nil {
+		return 0, err
+	}
+
+	if baseline == nil {
+		listed, err := w.recordExactCount(ctx, client)
+		if err != nil {
+			return 0, err
+		}
+
+		w.TotalIsEstimate = false
+		w.TotalMargin = 0
+		w.LastExactCountAt = time.Now()
+		return len(listed.Countries), nil
+	}
+
+	sample, err := w.sampleNewCustomersWithRetry(ctx, client, baseline.Timestamp)
+	if err != nil {
+		return 0, err
+	}
+
+	estimate := estimateCustomerTotal(customerEstimateInput{
+		Now:             time.Now(),
+		BaselineTotal:   baseline.TotalCustomers,
+		BaselineAt:      baseline.Timestamp,
+		SampledNew:      sample.count,
+		SampleComplete:  sample.complete,
+		OldestSampledAt: sample.oldest,
+		WebhookCreated:  baseline.CreatedSince,
+		WebhookDeleted:  baseline.DeletedSince,
+	})
+
+	w.TotalIsEstimate = true
+	w.TotalMargin = estimate.Margin
+	w.EstimateConfidence = estimate.Confidence * 100
+	w.LastExactCountAt = baseline.Timestamp
+
+	return estimate.Total, nil
 }
 
-func (w *customersWidget) getChurnedCustomers(ctx context.Context) (int, error) {
-	// Get subscriptions canceled this month
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+// recordExactCount enumerates all customers and stores the result as the
+// baseline for future estimates and incremental counts, logging how far the
+// count kept from webhooks drifted from it
+func (w *customersWidget) recordExactCount(ctx context.Context, client *StripeClientWrapper) (*listedCustomers, error) {
+	startedAt := time.Now()
 
-	params := &stripe.SubscriptionListParams{}
-	params.Status = stripe.String("canceled")
-	params.Filters.AddFilter("canceled_at", "gte", fmt.Sprintf("%d", startOfMonth.Unix()))
-	params.Context = ctx
+	listed, err := w.listCustomersWithRetry(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	total := len(listed.Countries)
 
-	// Use a map to track unique customers who churned
-	uniqueCustomers := make(map[string]bool)
-	iter := subscription.List(params)
+	db, err := GetMetricsDatabase("")
+	if err != nil {
+		return nil, err
+	}
 
-	for iter.Next() {
-		sub := iter.Subscription()
-		if sub.Customer != nil {
-			uniqueCustomers[sub.Customer.ID] = true
-		}
+	previous, err := db.GetCustomerBaseline(ctx, w.metricsKey())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.SaveCustomerBaseline(ctx, w.metricsKey(), total, startedAt); err != nil {
+		return nil, err
 	}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list churned subscriptions: %w", err)
+	attrs := []any{"mode", w.StripeMode, "total", total, "duration", time.Since(startedAt)}
+	if previous != nil {
+		attrs = append(attrs, "webhook_drift", total-incrementalCustomerCount(previous))
 	}
+	slog.Info("Recorded exact customer count", attrs...)
 
-	return len(uniqueCustomers), nil
+	return listed, nil
 }
 
-func (w *customersWidget) generateTrendData() {
-	// For MVP, generate simple trend based on current data
-	// In production, query historical data
+// runExactCount is the nightly background job for widgets using estimated or
+// incremental counting, reconciling the count kept since the last one
+func (w *customersWidget) runExactCount(ctx context.Context) {
+	client, err := w.getStripeClient()
+	if err != nil {
+		slog.Error("Failed to take exact customer count", "error", err)
+		return
+	}
 
-	now := time.Now()
-	months := 6
+	if _, err := w.recordExactCount(ctx, client); err != nil {
+		slog.Error("Failed to take exact customer count", "mode", w.StripeMode, "error", err)
+	}
+}
+
+// subscriptionCustomers is the set of distinct customers of subscriptions
+type subscriptionCustomers map[string]bool
 
-	w.TrendLabels = make([]string, months)
-	w.TrendValues = make([]int, months)
+func (c subscriptionCustomers) add(sub *stripe.Subscription) {
+	if sub.Customer != nil {
+		c[sub.Customer.ID] = true
+	}
+}
 
-	// Generate last 6 months
-	for i := months - 1; i >= 0; i-- {
-		monthDate := now.AddDate(0, -i, 0)
-		w.TrendLabels[months-1-i] = monthDate.Format("Jan")
+// countActiveCustomers returns the number of customers with an active
+// subscription
+func countActiveCustomers(scan *subscriptionScan) int {
+	uniqueCustomers := make(subscriptionCustomers)
+	scan.withStatus(uniqueCustomers.add, stripe.SubscriptionStatusActive)
 
-		// For MVP, simulate growth trend
-		// In production, fetch actual historical data
-		if i == 0 {
-			w.TrendValues[months-1-i] = w.TotalCustomers
-		} else {
-			// Simulate historical customer count with growth
-			growthPerMonth := w.NewCustomers - w.ChurnedCustomers
-			w.TrendValues[months-1-i] = w.TotalCustomers - (growthPerMonth * i)
+	return len(uniqueCustomers)
+}
 
-			// Ensure non-negative
-			if w.TrendValues[months-1-i] < 0 {
-				w.TrendValues[months-1-i] = 0
-			}
+// churnedCustomers returns the customers of canceled subscriptions left
+// without an active or trialing subscription in scan, by ID. Customers who
+// still have one only switched plans, as with upgrades done by canceling and
+// creating a subscription, or dropped one of their plans.
+func churnedCustomers(scan *subscriptionScan, canceled []*stripe.Subscription) map[string]*stripe.Customer {
+	remaining := make(subscriptionCustomers)
+	scan.withStatus(remaining.add, stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing)
+
+	churned := make(map[string]*stripe.Customer)
+	for _, sub := range canceled {
+		if sub.Customer != nil && !remaining[sub.Customer.ID] {
+			churned[sub.Customer.ID] = sub.Customer
 		}
 	}
+
+	return churned
 }
 
-func (w *customersWidget) Render() template.HTML {
-	return w.renderTemplate(w, customersWidgetTemplate)
+// countChurnedCustomers returns the number of churned customers, see
+// churnedCustomers
+func countChurnedCustomers(scan *subscriptionScan, canceled []*stripe.Subscription) int {
+	return len(churnedCustomers(scan, canceled))
 }
 
-// getTotalCustomersWithRetry wraps getTotalCustomers with circuit breaker and retry logic
-func (w *customersWidget) getTotalCustomersWithRetry(ctx context.Context, client *StripeClientWrapper) (int, error) {
-	var result int
-	err := client.ExecuteWithRetry(ctx, "getTotalCustomers", func() error {
-		count, err := w.getTotalCustomers(ctx)
-		result = count
-		return err
-	})
-	return result, err
+// updateTrend sets the trend chart from one stored snapshot per month and the
+// current total, see loadHistoricalData, estimating the months before the
+// first snapshot
+func (w *customersWidget) updateTrend(monthly []*CustomerSnapshot) {
+	if !w.loadHistoricalData(monthly) {
+		w.TrendLabels = []string{trendLabel(w.now(), w.TrendMonths)}
+		w.TrendValues = []int{w.TotalCustomers}
+		w.TrendEstimated = []bool{false}
+		w.TrendEstimatedMonths = 0
+	}
+
+	w.estimateLeadingMonths()
 }
 
-// getActiveCustomersWithRetry wraps getActiveCustomers with circuit breaker and retry logic
-func (w *customersWidget) getActiveCustomersWithRetry(ctx context.Context, client *StripeClientWrapper) (int, error) {
-	var result int
-	err := client.ExecuteWithRetry(ctx, "getActiveCustomers", func() error {
-		count, err := w.getActiveCustomers(ctx)
-		result = count
-		return err
-	})
-	return result, err
+// estimateLeadingMonths fills the trend chart up to trend-months with the
+// months before its first point, estimated from this month's net customer
+// growth and marked in TrendEstimated. Stored history and the current total
+// are never replaced, and estimates are only shown, never stored.
+func (w *customersWidget) estimateLeadingMonths() {
+	missing := w.TrendMonths - len(w.TrendValues)
+	if missing <= 0 || len(w.TrendValues) == 0 {
+		return
+	}
+
+	now := w.now()
+	first := bucketStart(now, MetricsBucketMonth).AddDate(0, -(len(w.TrendValues) - 1), 0)
+	growthPerMonth := w.NewCustomers - int(math.Round(w.churnWindow.perMonth(float64(w.ChurnedCustomers))))
+
+	labels := make([]string, missing, w.TrendMonths)
+	values := make([]int, missing, w.TrendMonths)
+	estimated := make([]bool, missing, w.TrendMonths)
+	for i := 0; i < missing; i++ {
+		monthsBefore := missing - i
+		labels[i] = trendLabel(first.AddDate(0, -monthsBefore, 0), w.TrendMonths)
+		values[i] = max(w.TrendValues[0]-growthPerMonth*monthsBefore, 0)
+		estimated[i] = true
+	}
+
+	w.TrendLabels = append(labels, w.TrendLabels...)
+	w.TrendValues = append(values, w.TrendValues...)
+	w.TrendEstimated = append(estimated, w.TrendEstimated...)
+	w.TrendEstimatedMonths = missing
 }
 
-// getNewCustomersWithRetry wraps getNewCustomers with circuit breaker and retry logic
-func (w *customersWidget) getNewCustomersWithRetry(ctx context.Context, client *StripeClientWrapper) (int, error) {
-	var result int
-	err := client.ExecuteWithRetry(ctx, "getNewCustomers", func() error {
-		count, err := w.getNewCustomers(ctx)
-		result = count
+func (w *customersWidget) Render() template.HTML {
+	return w.renderTemplate(w, customersWidgetTemplate)
+}
+
+// listCustomersWithRetry wraps listCustomers with circuit breaker and retry logic
+func (w *customersWidget) listCustomersWithRetry(ctx context.Context, client *StripeClientWrapper) (*listedCustomers, error) {
+	var result *listedCustomers
+	err := client.ExecuteWithRetry(ctx, "listCustomers", func() error {
+		listed, err := w.listCustomers(ctx, client.customers)
+		result = listed
 		return err
 	})
 	return result, err
 }
 
-// getChurnedCustomersWithRetry wraps getChurnedCustomers with circuit breaker and retry logic
-func (w *customersWidget) getChurnedCustomersWithRetry(ctx context.Context, client *StripeClientWrapper) (int, error) {
-	var result int
-	err := client.ExecuteWithRetry(ctx, "getChurnedCustomers", func() error {
-		count, err := w.getChurnedCustomers(ctx)
-		result = count
+// sampleNewCustomersWithRetry wraps sampleNewCustomers with circuit breaker and retry logic
+func (w *customersWidget) sampleNewCustomersWithRetry(ctx context.Context, client *StripeClientWrapper, since time.Time) (customerSample, error) {
+	var result customerSample
+	err := client.ExecuteWithRetry(ctx, "sampleNewCustomers", func() error {
+		sample, err := w.sampleNewCustomers(ctx, client.customers, since)
+		result = sample
 		return err
 	})
 	return result, err
 }
 
-// calculateCurrentMRR calculates the current MRR from active subscriptions
-// This is used for LTV calculation when database snapshot is not available
-func (w *customersWidget) calculateCurrentMRR(ctx context.Context) (float64, error) {
-	// Fetch all active subscriptions
-	params := &stripe.SubscriptionListParams{}
-	params.Status = stripe.String("active")
-	params.Context = ctx
-
-	totalMRR := 0.0
-	iter := subscription.List(params)
+// calculateCurrentMRR calculates the current MRR from the active subscriptions
+// of scan, or returns scanErr when they couldn't be listed. This is used for
+// LTV calculation when database snapshot is not available
+func calculateCurrentMRR(ctx context.Context, scan *subscriptionScan, scanErr error) (float64, error) {
+	if scanErr != nil {
+		return 0, scanErr
+	}
 
-	for iter.Next() {
-		sub := iter.Subscription()
+	amounts := make(currencyAmounts)
+	resolver := newPriceResolver(ctx)
+	now := time.Now()
 
-		// Calculate MRR for this subscription
-		for _, item := range sub.Items.Data {
-			if item.Price == nil {
-				continue
-			}
+	scan.withStatus(func(sub *stripe.Subscription) {
+		// Paused subscriptions aren't part of MRR, as on the revenue widget
+		if !subscriptionPaused(sub, now) {
+			amounts.addSubscription(sub, resolver)
+		}
+	}, stripe.SubscriptionStatusActive)
 
-			// Get the amount in dollars (Stripe uses cents)
-			amount := float64(item.Price.UnitAmount) / 100.0
-
-			// Normalize to monthly based on interval
-			interval := item.Price.Recurring.Interval
-			intervalCount := item.Price.Recurring.IntervalCount
-
-			var monthlyAmount float64
-			switch interval {
-			case "month":
-				monthlyAmount = amount / float64(intervalCount)
-			case "year":
-				monthlyAmount = amount / (12.0 * float64(intervalCount))
-			case "week":
-				monthlyAmount = amount * 4.33 / float64(intervalCount)
-			case "day":
-				monthlyAmount = amount * 30 / float64(intervalCount)
-			default:
-				slog.Warn("Unknown subscription interval", "interval", interval)
-				continue
-			}
+	return GetCurrencyConverter().Convert(ctx, amounts).Total, nil
+}
 
-			// Multiply by quantity
-			monthlyAmount *= float64(item.Quantity)
-			totalMRR += monthlyAmount
-		}
+// loadHistoricalData populates the trend chart from one snapshot per calendar
+// month, oldest first and ending with the current month, using the current
+// total for the current month. Months before the first snapshot are left out
+// and months without a snapshot repeat the previous month, so that the chart
+// always has one point per consecutive month. Returns false when there is no
+// history from previous months.
+func (w *customersWidget) loadHistoricalData(monthly []*CustomerSnapshot) bool {
+	if len(monthly) < 2 {
+		return false
 	}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list subscriptions for MRR: %w", err)
-	}
+	now := w.now()
+	first := bucketStart(now, MetricsBucketMonth).AddDate(0, -(len(monthly) - 1), 0)
 
-	return totalMRR, nil
-}
+	labels := make([]string, 0, len(monthly))
+	values := make([]int, 0, len(monthly))
 
-// calculateCurrentMRRWithRetry wraps calculateCurrentMRR with circuit breaker and retry logic
-func (w *customersWidget) calculateCurrentMRRWithRetry(ctx context.Context, client *StripeClientWrapper) (float64, error) {
-	var result float64
-	err := client.ExecuteWithRetry(ctx, "calculateCurrentMRR", func() error {
-		mrr, err := w.calculateCurrentMRR(ctx)
-		result = mrr
-		return err
-	})
-	return result, err
-}
+	var previous *CustomerSnapshot
+	for i, snapshot := range monthly[:len(monthly)-1] {
+		if snapshot == nil {
+			snapshot = previous
+		}
 
-// loadHistoricalData loads historical data from database snapshots
-func (w *customersWidget) loadHistoricalData(history []*CustomerSnapshot) {
-	if len(history) == 0 {
-		return
+		if snapshot == nil {
+			continue
+		}
+
+		labels = append(labels, trendLabel(first.AddDate(0, i, 0), len(monthly)))
+		values = append(values, snapshot.TotalCustomers)
+		previous = snapshot
 	}
 
-	// Use database data to populate trend chart
-	maxPoints := 6
-	if len(history) > maxPoints {
-		history = history[:maxPoints]
+	if len(labels) == 0 {
+		return false
 	}
 
-	w.TrendLabels = make([]string, len(history))
-	w.TrendValues = make([]int, len(history))
+	labels = append(labels, trendLabel(now, len(monthly)))
+	values = append(values, w.TotalCustomers)
 
-	// Reverse chronological order (oldest first for chart)
-	for i := range history {
-		idx := len(history) - 1 - i
-		w.TrendLabels[i] = history[idx].Timestamp.Format("Jan")
-		w.TrendValues[i] = history[idx].TotalCustomers
-	}
+	w.TrendLabels = labels
+	w.TrendValues = values
+	w.TrendEstimated = make([]bool, len(values))
+	w.TrendEstimatedMonths = 0
+	return true
 }
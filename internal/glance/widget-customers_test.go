@@ -1,8 +1,11 @@
 package glance
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/stripe/stripe-go/v81"
 )
 
 func TestCustomersWidget_Initialize(t *testing.T) {
@@ -42,6 +45,67 @@ func TestCustomersWidget_Initialize(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "estimated counting",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				Counting:     "estimated",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid counting",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				Counting:     "approximate",
+			},
+			expectError:   true,
+			errorContains: "counting must be 'exact', 'estimated' or 'incremental'",
+		},
+		{
+			name: "incremental counting",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				Counting:     "incremental",
+			},
+			expectError: false,
+		},
+		{
+			name: "negative fallback ARPU",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				FallbackARPU: -29,
+			},
+			expectError:   true,
+			errorContains: "fallback-arpu must not be negative",
+		},
+		{
+			name: "paying customer base",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				CustomerBase: "paying",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid customer base",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				CustomerBase: "active",
+			},
+			expectError:   true,
+			errorContains: "customer-base must be 'all' or 'paying'",
+		},
+		{
+			name: "incremental counting with an account label",
+			widget: &customersWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				Counting:     "incremental",
+				AccountLabel: "eu",
+			},
+			expectError:   true,
+			errorContains: "account-label",
+		},
 	}
 
 	for _, tt := range tests {
@@ -222,14 +286,15 @@ func TestCustomersWidget_LTVtoCACRatio(t *testing.T) {
 	}
 }
 
-func TestCustomersWidget_GenerateTrendData(t *testing.T) {
+func TestCustomersWidget_UpdateTrendWithoutHistory(t *testing.T) {
 	widget := &customersWidget{
 		TotalCustomers:   1000,
 		NewCustomers:     50,
 		ChurnedCustomers: 20,
+		TrendMonths:      defaultTrendMonths,
 	}
 
-	widget.generateTrendData()
+	widget.updateTrend(nil)
 
 	// Check that trend data was generated
 	if len(widget.TrendLabels) != 6 {
@@ -240,11 +305,15 @@ func TestCustomersWidget_GenerateTrendData(t *testing.T) {
 		t.Errorf("expected 6 trend values, got %d", len(widget.TrendValues))
 	}
 
-	// Check that current month has total customers
+	// Check that current month has total customers and is the only real point
 	if widget.TrendValues[5] != widget.TotalCustomers {
 		t.Errorf("expected last trend value to be total customers (%d), got %d", widget.TotalCustomers, widget.TrendValues[5])
 	}
 
+	if widget.TrendEstimatedMonths != 5 || widget.TrendEstimated[5] {
+		t.Errorf("expected the 5 months before the current one to be estimated, got %v", widget.TrendEstimated)
+	}
+
 	// Check that all values are non-negative
 	for i, val := range widget.TrendValues {
 		if val < 0 {
@@ -266,6 +335,59 @@ func TestCustomersWidget_GenerateTrendData(t *testing.T) {
 	}
 }
 
+func TestCustomersWidget_UpdateTrendPrefersHistory(t *testing.T) {
+	ctx := context.Background()
+	db := newSimpleMetricsDB()
+
+	widget := &customersWidget{StripeMode: "test", TotalCustomers: 140, NewCustomers: 50, ChurnedCustomers: 10}
+	now := widget.now()
+	for i, total := range []int{100, 110, 125} {
+		month := bucketStart(now, MetricsBucketMonth).AddDate(0, i-3, 1)
+		db.SaveCustomerSnapshot(ctx, &CustomerSnapshot{Timestamp: month, TotalCustomers: total, Mode: "test"})
+	}
+
+	tests := []struct {
+		name           string
+		trendMonths    int
+		expectedValues []int
+		estimated      int
+	}{
+		{"history covers the chart", 4, []int{100, 110, 125, 140}, 0},
+		// Two months before the history, extrapolated back by 40 a month
+		{"months before the history", 6, []int{20, 60, 100, 110, 125, 140}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widget.TrendMonths = tt.trendMonths
+			monthly, err := db.GetCustomerMonthly(ctx, "test", now, tt.trendMonths)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			widget.updateTrend(monthly)
+
+			if len(widget.TrendValues) != len(tt.expectedValues) || len(widget.TrendLabels) != len(tt.expectedValues) {
+				t.Fatalf("expected %d points, got %v", len(tt.expectedValues), widget.TrendValues)
+			}
+
+			for i, value := range tt.expectedValues {
+				if widget.TrendValues[i] != value {
+					t.Errorf("point %d: expected %d, got %d", i, value, widget.TrendValues[i])
+				}
+
+				if widget.TrendEstimated[i] != (i < tt.estimated) {
+					t.Errorf("point %d: expected estimated to be %v", i, i < tt.estimated)
+				}
+			}
+
+			if widget.TrendEstimatedMonths != tt.estimated {
+				t.Errorf("expected %d estimated months, got %d", tt.estimated, widget.TrendEstimatedMonths)
+			}
+		})
+	}
+}
+
 func TestCustomersWidget_NetCustomerGrowth(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -309,3 +431,66 @@ func TestCustomersWidget_NetCustomerGrowth(t *testing.T) {
 		})
 	}
 }
+
+func TestCountChurnedCustomers_MultipleSubscriptions(t *testing.T) {
+	sub := func(customer string, status stripe.SubscriptionStatus) *stripe.Subscription {
+		return &stripe.Subscription{Customer: &stripe.Customer{ID: customer}, Status: status}
+	}
+
+	tests := []struct {
+		name     string
+		current  []*stripe.Subscription
+		canceled []*stripe.Subscription
+		expected int
+	}{
+		{
+			name:     "canceled the only subscription",
+			canceled: []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusCanceled)},
+			expected: 1,
+		},
+		{
+			name:     "upgrade by canceling and creating a subscription",
+			current:  []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusActive)},
+			canceled: []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusCanceled)},
+			expected: 0,
+		},
+		{
+			name:     "upgrade to a trial of the new plan",
+			current:  []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusTrialing)},
+			canceled: []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusCanceled)},
+			expected: 0,
+		},
+		{
+			name: "two plans dropping one",
+			current: []*stripe.Subscription{
+				sub("cus_1", stripe.SubscriptionStatusActive),
+				sub("cus_2", stripe.SubscriptionStatusActive),
+			},
+			canceled: []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusCanceled)},
+			expected: 0,
+		},
+		{
+			name: "two plans dropping both",
+			canceled: []*stripe.Subscription{
+				sub("cus_1", stripe.SubscriptionStatusCanceled),
+				sub("cus_1", stripe.SubscriptionStatusCanceled),
+			},
+			expected: 1,
+		},
+		{
+			name:     "left with an unpaid subscription",
+			current:  []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusIncompleteExpired)},
+			canceled: []*stripe.Subscription{sub("cus_1", stripe.SubscriptionStatusCanceled)},
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan := &subscriptionScan{Current: tt.current, Canceled: tt.canceled}
+			if got := countChurnedCustomers(scan, scan.Canceled); got != tt.expected {
+				t.Errorf("expected %d churned customers, got %d", tt.expected, got)
+			}
+		})
+	}
+}
@@ -2,13 +2,14 @@ package glance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"time"
 
 	"github.com/stripe/stripe-go/v81"
-	"github.com/stripe/stripe-go/v81/subscription"
+	"golang.org/x/text/language"
 )
 
 var revenueWidgetTemplate = mustParseTemplate("revenue.html", "widget-base.html")
@@ -17,6 +18,73 @@ type revenueWidget struct {
 	widgetBase      `yaml:",inline"`
 	StripeAPIKey    string `yaml:"stripe-api-key"`
 	StripeMode      string `yaml:"stripe-mode"` // 'live' or 'test'
+	AccountLabel    string `yaml:"account-label"`
+
+	// Set on replicas, which render from the shared store instead of Stripe
+	store *SimpleMetricsDB
+
+	// Subscriptions whose MRR exceeds this multiple of the median are flagged
+	AnomalyMedianMultiple float64 `yaml:"anomaly-median-multiple"`
+
+	// Estimate metered items from invoices, which costs extra API calls
+	IncludeMetered bool `yaml:"include-metered"`
+
+	// Show the MRR of subscriptions in trial and count them as new MRR when
+	// they start, along with the conversion of the trials that ended in the
+	// last trial-conversion-days
+	IncludeTrialing     bool `yaml:"include-trialing"`
+	TrialConversionDays int  `yaml:"trial-conversion-days"`
+
+	// Show revenue from paid invoices that don't belong to a subscription,
+	// such as setup fees, separately from MRR
+	IncludeOneTime bool `yaml:"include-one-time"`
+
+	// Count subscriptions that are past due after a failed payment toward MRR
+	// while Stripe retries the payment, so that MRR doesn't dip for a card
+	// that recovers a day later
+	CountPastDueAsActive bool `yaml:"count-past-due-as-active"`
+
+	// Number of months net revenue retention is calculated over
+	NRRMonths int `yaml:"nrr-months"`
+
+	// Target MRR to show progress toward, and optionally the date to reach it by
+	MRRGoal  float64 `yaml:"mrr-goal"`
+	GoalDate string  `yaml:"goal-date"`
+	goalDate time.Time
+
+	// Number of months in the trend chart, including the current month
+	TrendMonths int `yaml:"trend-months"`
+
+	// Point the growth rate compares MRR against: previous-update, a number
+	// of days like 30d, start-of-month or start-of-year
+	GrowthBaseline string `yaml:"growth-baseline"`
+	growthBaseline growthBaseline
+
+	// Period churned MRR and the gross revenue churn rate are measured over,
+	// calendar-month, 30d or 90d
+	ChurnWindow      string `yaml:"churn-window"`
+	churnWindow      churnWindow
+	ChurnWindowLabel string `yaml:"-"`
+
+	// Subscriptions left out of the metrics besides the ones on a test clock,
+	// the ones of customers or with metadata matching any of these pairs
+	ExcludeMetadata map[string]string `yaml:"exclude-metadata"`
+	exclusions      exclusionRules
+
+	// Time zone months start in, for new and churned MRR, trend labels
+	// and snapshot buckets, defaulting to the metrics timezone
+	Timezone string `yaml:"timezone"`
+	timezone *time.Location
+
+	// Currency and locale amounts are shown in, converted from the reporting
+	// currency. Metrics are still calculated and stored in the reporting
+	// currency.
+	DisplayCurrency string `yaml:"currency"`
+	Locale          string `yaml:"locale"`
+	locale          language.Tag
+
+	// Number of products listed in the MRR breakdown, the rest are grouped
+	TopProducts int `yaml:"top-products"`
 
 	// Revenue metrics
 	CurrentMRR   float64 `yaml:"-"`
@@ -24,14 +92,183 @@ type revenueWidget struct {
 	GrowthRate   float64 `yaml:"-"`
 	ARR          float64 `yaml:"-"`
 	NewMRR       float64 `yaml:"-"`
-	ChurnedMRR   float64 `yaml:"-"`
+	ChurnedMRR   float64 `yaml:"-"` // over the churn window
 	NetNewMRR    float64 `yaml:"-"`
+	// MRR churned this calendar month, which net new MRR, the quick ratio
+	// and the movements compare with this month's new MRR
+	monthChurnedMRR float64
+
+	// Part of NewMRR from customers who had canceled a subscription before
+	ReactivationMRR float64 `yaml:"-"`
+
+	// How MRR moved since the start of the month, nil without a snapshot
+	// from then
+	Movements *mrrMovements `yaml:"-"`
+
+	// MRR churned this month as a percentage of MRR at the start of the
+	// month, undefined without a snapshot from then or any MRR to churn
+	GrossRevenueChurnRate    float64 `yaml:"-"`
+	GrossRevenueChurnDefined bool    `yaml:"-"`
+
+	// Average MRR per paying customer, and its growth against the same
+	// snapshot as GrowthRate when that snapshot has an ARPU
+	ARPU         float64 `yaml:"-"`
+	ARPUGrowth   float64 `yaml:"-"`
+	ARPUCompared bool    `yaml:"-"`
+
+	// Cash collected through paid invoices this month, less refunds. Unlike
+	// MRR it includes one-off invoices and proration.
+	CollectedRevenue float64 `yaml:"-"`
+
+	// Cash received through paid invoices this month before refunds, which
+	// includes plans paid upfront in full, and the estimated part of those
+	// plans not recognized as revenue yet, to reconcile cash against MRR
+	CashCollectedThisMonth float64 `yaml:"-"`
+	DeferredRevenue        float64 `yaml:"-"`
+
+	// Revenue collected over the trailing twelve months, annualized from the
+	// months with data when TTMExtrapolated. Unlike ARR it doesn't assume the
+	// current MRR held all year.
+	TTMRevenue      float64 `yaml:"-"`
+	TTMExtrapolated bool    `yaml:"-"`
+
+	// Succeeded refunds this month, partial refunds by their amount
+	RefundedThisMonth float64 `yaml:"-"`
+
+	// Paid invoices this month that don't belong to a subscription, with
+	// include-one-time. Not part of MRR.
+	OneTimeRevenue float64 `yaml:"-"`
+	// Total of the last listing of paid invoices and when it was listed,
+	// payments reported by webhooks since then are added to it
+	oneTimeListed   float64
+	oneTimeListedAt time.Time
+
+	// Growth against the snapshots nearest to a month and a year ago, nil
+	// without a snapshot that close to either
+	MoM *periodComparison `yaml:"-"`
+	YoY *periodComparison `yaml:"-"`
+
+	// Progress toward mrr-goal, nil without a goal
+	Goal *mrrGoal `yaml:"-"`
+
+	// Quick ratio of MRR gained to MRR lost this month, undefined when
+	// nothing was lost. QuickRatioHealth is "great", "okay" or "bad".
+	QuickRatio        float64 `yaml:"-"`
+	QuickRatioDefined bool    `yaml:"-"`
+	QuickRatioHealth  string  `yaml:"-"`
+
+	// Net revenue retention over nrr-months as a percentage, undefined until
+	// there's a snapshot that old. NRRHealth is "great", "okay" or "bad".
+	NRR        float64 `yaml:"-"`
+	NRRDefined bool    `yaml:"-"`
+	NRRHealth  string  `yaml:"-"`
+
+	// Growth is compared against the snapshot nearest growth-baseline,
+	// GrowthWindowShort is set when no snapshot that old exists yet.
+	// GrowthBaselineLabel names the baseline in the growth indicator.
+	GrowthComparedAt    time.Time `yaml:"-"`
+	GrowthWindowDays    int       `yaml:"-"`
+	GrowthWindowShort   bool      `yaml:"-"`
+	GrowthBaselineLabel string    `yaml:"-"`
+
+	// Reporting currency the metrics are calculated in, the format they are
+	// shown with, and the MRR billed in each currency. Unconverted holds currencies without an exchange rate, which
+	// are left out of the totals.
+	Currency          string        `yaml:"-"`
+	Money             moneyFormat   `yaml:"-"`
+	CurrencyBreakdown []currencyMRR `yaml:"-"`
+	Unconverted       []currencyMRR `yaml:"-"`
+
+	// MRR of active subscriptions whose collection is paused, not part of CurrentMRR
+	PausedMRR float64 `yaml:"-"`
+
+	// Part of CurrentMRR of subscriptions set to cancel, and CurrentMRR
+	// without it
+	CancelingMRR float64 `yaml:"-"`
+	CommittedMRR float64 `yaml:"-"`
+
+	// Change in MRR committed by subscription schedules once they move to
+	// their next phase, and the number of subscriptions changing
+	ScheduledMRRChange     float64 `yaml:"-"`
+	ScheduledSubscriptions int     `yaml:"-"`
+
+	// MRR of subscriptions in trial once they convert, not part of CurrentMRR
+	TrialingMRR float64 `yaml:"-"`
+
+	// Percentage of the trials that ended in the last trial-conversion-days
+	// that converted to a paying subscription, undefined without any
+	TrialConversionRate    float64 `yaml:"-"`
+	TrialConversionDefined bool    `yaml:"-"`
+	TrialsEnded            int     `yaml:"-"`
+	TrialsConverted        int     `yaml:"-"`
+
+	// MRR of past_due subscriptions whose latest payment failed, part of
+	// CurrentMRR only with count-past-due-as-active, and the number of their
+	// customers
+	AtRiskMRR       float64 `yaml:"-"`
+	AtRiskCustomers int     `yaml:"-"`
+
+	// Part of CurrentMRR estimated from the invoices of metered items, and
+	// which invoices it's estimated from
+	MeteredMRR    float64 `yaml:"-"`
+	MeteredSource string  `yaml:"-"`
+
+	// MRR of the top products, not including metered items
+	Products []productMRR `yaml:"-"`
+	// Product names by ID, looked up once for the lifetime of the widget
+	productNames productNameCache
+
+	// Subscriptions flagged as likely mispriced
+	Anomalies []subscriptionAnomaly `yaml:"-"`
+
+	// Number of subscriptions left out of the last update by the exclusion
+	// rules, to sanity check exclude-metadata
+	ExcludedSubscriptions int `yaml:"-"`
 
 	// Trend data for charts
 	TrendLabels  []string  `yaml:"-"`
 	TrendValues  []float64 `yaml:"-"`
 }
 
+const (
+	// growthComparisonWindow is how far back the growth rate compares MRR
+	growthComparisonWindow = 30 * 24 * time.Hour
+	// growthComparisonTolerance is how much younger than the window the compared
+	// snapshot may be before the window is flagged as short
+	growthComparisonTolerance = 2 * 24 * time.Hour
+)
+
+// Number of months shown in the revenue and customers trend charts, including
+// the current month, set with trend-months
+const (
+	defaultTrendMonths = 6
+	minTrendMonths     = 2
+	maxTrendMonths     = 24
+)
+
+// validateTrendMonths defaults an unset trend-months and checks its range
+func validateTrendMonths(months *int) error {
+	if *months == 0 {
+		*months = defaultTrendMonths
+	}
+
+	if *months < minTrendMonths || *months > maxTrendMonths {
+		return fmt.Errorf("trend-months must be between %d and %d, got: %d", minTrendMonths, maxTrendMonths, *months)
+	}
+
+	return nil
+}
+
+// trendLabel labels a month of a trend chart, with the year when the chart
+// spans more than a year and month names would repeat
+func trendLabel(month time.Time, months int) string {
+	if months > 12 {
+		return month.Format("Jan 06")
+	}
+
+	return month.Format("Jan")
+}
+
 type chartPoint struct {
 	Month string
 	Value float64
@@ -52,10 +289,98 @@ func (w *revenueWidget) initialize() error {
 		return fmt.Errorf("stripe-mode must be 'live' or 'test', got: %s", w.StripeMode)
 	}
 
+	if err := validateAccountLabel(w.AccountLabel); err != nil {
+		return fmt.Errorf("account-label: %w", err)
+	}
+
+	if w.AnomalyMedianMultiple == 0 {
+		w.AnomalyMedianMultiple = defaultAnomalyMedianMultiple
+	}
+
+	if err := validateTrendMonths(&w.TrendMonths); err != nil {
+		return err
+	}
+
+	if err := validateNRRMonths(&w.NRRMonths); err != nil {
+		return err
+	}
+
+	if err := validateTrialConversionDays(&w.TrialConversionDays); err != nil {
+		return err
+	}
+
+	baseline, err := parseGrowthBaseline(w.GrowthBaseline)
+	if err != nil {
+		return err
+	}
+	w.growthBaseline = baseline
+
+	if w.churnWindow, err = parseChurnWindow(w.ChurnWindow); err != nil {
+		return err
+	}
+	w.ChurnWindowLabel = w.churnWindow.label()
+
+	if w.exclusions, err = newExclusionRules(w.ExcludeMetadata); err != nil {
+		return err
+	}
+
+	if w.MRRGoal < 0 {
+		return fmt.Errorf("mrr-goal must not be negative, got: %g", w.MRRGoal)
+	}
+
+	timezone, err := loadTimezone(w.Timezone)
+	if err != nil {
+		return err
+	}
+	w.timezone = timezone
+
+	if w.GoalDate != "" {
+		if w.MRRGoal == 0 {
+			return fmt.Errorf("goal-date requires mrr-goal")
+		}
+
+		date, err := parseGoalDate(w.GoalDate, w.now())
+		if err != nil {
+			return err
+		}
+		w.goalDate = date
+	}
+
+	if err := validateMoneyOptions(w.DisplayCurrency, w.Locale, &w.locale); err != nil {
+		return err
+	}
+
+	if w.TopProducts == 0 {
+		w.TopProducts = defaultTopProducts
+	}
+
+	if w.TopProducts < 0 {
+		return fmt.Errorf("top-products must be positive, got: %d", w.TopProducts)
+	}
+
+	if w.AnomalyMedianMultiple <= 1 {
+		return fmt.Errorf("anomaly-median-multiple must be greater than 1, got: %g", w.AnomalyMedianMultiple)
+	}
+
 	return nil
 }
 
+// metricsKey is the key the widget's snapshots are stored under
+func (w *revenueWidget) metricsKey() string {
+	return metricsKey(w.StripeMode, w.AccountLabel)
+}
+
+// now returns the current time in the time zone of the widget
+func (w *revenueWidget) now() time.Time {
+	return time.Now().In(widgetTimezone(w.timezone))
+}
+
 func (w *revenueWidget) update(ctx context.Context) {
+	if w.store != nil {
+		w.loadFromStore(ctx, w.store)
+		return
+	}
+
 	// Get decrypted API key
 	encService, err := GetEncryptionService()
 	if err != nil {
@@ -81,60 +406,195 @@ func (w *revenueWidget) update(ctx context.Context) {
 	stripe.Key = apiKey
 
 	// Try to load from database first for trend data
+	var history []*RevenueSnapshot
 	db, dbErr := GetMetricsDatabase("")
 	if dbErr == nil {
-		// Get historical data from database
-		endTime := time.Now()
-		startTime := endTime.AddDate(0, -6, 0) // Last 6 months
-		history, err := db.GetRevenueHistory(ctx, w.StripeMode, startTime, endTime)
-		if err == nil && len(history) > 0 {
-			w.loadHistoricalData(history)
+		// Get one snapshot per month from the database
+		monthly, err := db.GetRevenueMonthly(ctx, w.metricsKey(), w.now(), w.TrendMonths)
+		if err == nil {
+			history = monthly
 		}
 	}
 
-	// Calculate current MRR with resilience
-	currentMRR, err := w.calculateMRRWithRetry(ctx, client)
+	// List the subscriptions once, shared with the customers widget of the
+	// same account, and derive MRR and its movements from them
+	churnSince := w.churnWindow.start(w.now())
+	scan, err := scanSubscriptionsCanceledSince(ctx, client, w.now(), churnSince, w.cacheDuration)
 	if !w.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
+	scan, w.ExcludedSubscriptions = w.exclusions.filterScan(scan)
+
+	resolver := newPriceResolver(ctx)
+	mrr := w.calculateMRR(scan, resolver, w.now())
+	mrrByCurrency := mrr.Totals
+
+	// Convert to the reporting currency, keeping currencies without a rate apart
+	converter := GetCurrencyConverter()
+	w.Currency = converter.ReportingCurrency()
+	w.Money = displayMoneyFormat(ctx, converter, w.DisplayCurrency, w.locale)
+
+	// Metered items are estimated from invoices and marked as such
+	w.MeteredMRR, w.MeteredSource = 0, ""
+	if len(mrr.Metered) > 0 {
+		estimate := estimateMeteredMRR(ctx, client, mrr.Metered)
+		for currency, amount := range estimate.Amounts {
+			mrrByCurrency[currency] += amount
+		}
+
+		w.MeteredMRR = converter.Convert(ctx, estimate.Amounts).Total
+		w.MeteredSource = estimate.source()
+	}
+
+	conversion := converter.Convert(ctx, mrrByCurrency)
+	w.CurrentMRR = conversion.Total
+	w.ARR = w.CurrentMRR * 12
+	w.CurrencyBreakdown = conversion.Breakdown
+	w.Unconverted = conversion.Unconverted
+	if len(w.Unconverted) > 0 {
+		slog.Warn("MRR in currencies without an exchange rate left out", "mode", w.StripeMode, "currencies", len(w.Unconverted))
+	}
+
+	w.ARPU = averageRevenuePerUser(w.CurrentMRR, len(mrr.Customers))
+	w.updateGoal()
+
+	// Break MRR down by product, looking up the names of the top products
+	w.Products = productBreakdown(ctx, mrr.Products, converter, w.TopProducts)
+	w.resolveProductNames(ctx, client, w.Products)
+
+	// Paused subscriptions are shown apart and move back into MRR once resumed
+	w.PausedMRR = converter.Convert(ctx, mrr.Paused).Total
 
-	w.CurrentMRR = currentMRR
-	w.ARR = currentMRR * 12
+	// Subscriptions set to cancel still count toward MRR until they do
+	w.CancelingMRR = converter.Convert(ctx, mrr.Canceling).Total
+	w.CommittedMRR = w.CurrentMRR - w.CancelingMRR
+
+	// Plans paid upfront for longer than a month, recognized month by month
+	w.DeferredRevenue = converter.Convert(ctx, mrr.Deferred).Total
+
+	// Upcoming phases of subscription schedules, such as committed downgrades
+	w.ScheduledMRRChange = converter.Convert(ctx, mrr.Scheduled).Total
+	w.ScheduledSubscriptions = mrr.ScheduledSubscriptions
+
+	// Flag subscriptions that are likely mispriced
+	w.Anomalies = detectSubscriptionAnomalies(mrr.Subscriptions, w.AnomalyMedianMultiple)
+	recordAnomalousSubscriptions(w.StripeMode, len(w.Anomalies))
+	if len(w.Anomalies) > 0 {
+		slog.Warn("Anomalous subscriptions detected", "mode", w.StripeMode, "count", len(w.Anomalies))
+	}
 
 	// Calculate growth rate from database if available
 	if dbErr == nil {
-		prevSnapshot, err := db.GetLatestRevenue(ctx, w.StripeMode)
-		if err == nil && prevSnapshot != nil {
-			w.PreviousMRR = prevSnapshot.MRR
-			if w.PreviousMRR > 0 {
-				w.GrowthRate = ((w.CurrentMRR - w.PreviousMRR) / w.PreviousMRR) * 100
-			}
-		}
-	} else if w.PreviousMRR > 0 {
+		now := w.now()
+		w.updateGrowth(ctx, db, now)
+		w.comparePeriods(ctx, db, now)
+	} else if growth, ok := growthPercent(w.PreviousMRR, w.CurrentMRR); ok {
 		// Fallback to in-memory previous value
-		w.GrowthRate = ((w.CurrentMRR - w.PreviousMRR) / w.PreviousMRR) * 100
+		w.GrowthRate = growth
+		w.GrowthBaselineLabel = growthBaseline{kind: growthBaselinePreviousUpdate}.label()
 	}
 
 	// Calculate new MRR (subscriptions created this month)
-	newMRR, err := w.calculateNewMRRWithRetry(ctx, client)
+	newMRR, err := w.calculateNewMRRWithRetry(ctx, client, scan, resolver)
 	if err != nil {
 		slog.Error("Failed to calculate new MRR", "error", err)
 	} else {
-		w.NewMRR = newMRR
+		w.NewMRR = converter.Convert(ctx, newMRR.Amounts).Total
+		w.ReactivationMRR = converter.Convert(ctx, newMRR.Reactivated).Total
+	}
+
+	// Calculate trialing MRR (subscriptions in trial, if enabled)
+	w.TrialingMRR = 0
+	w.TrialConversionDefined = false
+	if w.IncludeTrialing {
+		w.TrialingMRR = converter.Convert(ctx, w.calculateTrialingMRR(scan, resolver)).Total
+
+		canceled, err := listEndedTrialsWithRetry(ctx, client, w.now().AddDate(0, 0, -w.TrialConversionDays))
+		if err != nil {
+			slog.Error("Failed to list canceled trials", "error", err)
+		} else {
+			canceled, excluded := w.exclusions.filterSubscriptions(canceled)
+			w.ExcludedSubscriptions += excluded
+			w.updateTrialConversion(scan, canceled, w.now())
+		}
+	}
+
+	if w.ExcludedSubscriptions > 0 {
+		slog.Debug("Excluded subscriptions from revenue metrics", "mode", w.StripeMode, "subscriptions", w.ExcludedSubscriptions)
+	}
+
+	// Calculate MRR at risk (subscriptions past due after a failed payment),
+	// already collected along with MRR when counted toward it
+	atRisk := mrr.PastDue
+	if !w.CountPastDueAsActive {
+		atRisk = w.calculateAtRiskMRR(scan, resolver)
+	}
+	w.AtRiskMRR = converter.Convert(ctx, atRisk.Amounts).Total
+	w.AtRiskCustomers = len(atRisk.Customers)
+
+	// Calculate churned MRR (subscriptions canceled in the churn window, and
+	// this month for the comparisons with new MRR)
+	w.ChurnedMRR = converter.Convert(ctx, calculateChurnedMRR(scan.canceledSince(churnSince), resolver)).Total
+	w.monthChurnedMRR = converter.Convert(ctx, calculateChurnedMRR(scan.Canceled, resolver)).Total
+
+	w.NetNewMRR = w.NewMRR - w.monthChurnedMRR
+
+	// Calculate refunds and revenue collected this month from paid invoices,
+	// collected revenue is left out when refunds can't be subtracted from it
+	now := w.now()
+	startOfMonth := bucketStart(now, MetricsBucketMonth)
+	refunds, refundsErr := listRefundsWithRetry(ctx, client, startOfMonth)
+	if refundsErr != nil {
+		slog.Error("Failed to list refunds", "error", refundsErr)
+	} else {
+		w.RefundedThisMonth = converter.Convert(ctx, refundedAmounts(refunds, false)).Total
 	}
 
-	// Calculate churned MRR (subscriptions canceled this month)
-	churnedMRR, err := w.calculateChurnedMRRWithRetry(ctx, client)
+	invoices, err := listPaidInvoicesWithRetry(ctx, client, startOfMonth)
 	if err != nil {
-		slog.Error("Failed to calculate churned MRR", "error", err)
+		slog.Error("Failed to list paid invoices", "error", err)
 	} else {
-		w.ChurnedMRR = churnedMRR
+		w.CashCollectedThisMonth = converter.Convert(ctx, collectedRevenue(invoices, nil)).Total
+		if refundsErr == nil {
+			w.CollectedRevenue = converter.Convert(ctx, collectedRevenue(invoices, refunds)).Total
+		}
+	}
+
+	// One-time revenue from paid invoices without a subscription, kept fresh
+	// by webhooks when the invoices can't be listed
+	if w.IncludeOneTime {
+		var listed *float64
+		if err == nil {
+			total := converter.Convert(ctx, oneTimeRevenue(invoices)).Total
+			listed = &total
+		}
+		w.updateOneTimeRevenue(ctx, db, listed, now)
+	}
+
+	if dbErr == nil {
+		w.updateTTMRevenue(ctx, db, now)
+		w.updateNRR(ctx, db, now)
+		w.updateGrossRevenueChurn(ctx, db, now)
+		w.updateMovements(ctx, db, now)
+	}
+
+	// Expansion and contraction of existing subscriptions come from the MRR
+	// movements, without them only new and churned MRR are compared
+	expansion, contraction := 0.0, 0.0
+	if w.Movements != nil {
+		expansion, contraction = w.Movements.Expansion, w.Movements.Contraction
 	}
 
-	w.NetNewMRR = w.NewMRR - w.ChurnedMRR
+	if ratio, ok := quickRatio(w.NewMRR, expansion, w.monthChurnedMRR, contraction); ok {
+		w.setQuickRatio(&ratio)
+	} else {
+		w.setQuickRatio(nil)
+	}
 
-	// Generate trend data (last 6 months)
-	w.generateTrendData()
+	// Generate trend data (last trend-months months), simulated until there's stored history
+	if !w.loadHistoricalData(history) {
+		w.generateTrendData()
+	}
 
 	// Save to database for historical tracking
 	if dbErr == nil {
@@ -145,10 +605,18 @@ func (w *revenueWidget) update(ctx context.Context) {
 			GrowthRate: w.GrowthRate,
 			NewMRR:     w.NewMRR,
 			ChurnedMRR: w.ChurnedMRR,
+			ARPU:       w.ARPU,
+			Collected:  w.CollectedRevenue,
+			QuickRatio: w.quickRatioValue(),
+			NRR:        w.nrrValue(),
 			Mode:       w.StripeMode,
+			Account:    w.AccountLabel,
 		}
 
-		if err := db.SaveRevenueSnapshot(ctx, snapshot); err != nil {
+		// Only queued, so the error is known before the snapshot is stored
+		if err := db.SaveRevenueSnapshot(ctx, snapshot); errors.Is(err, errAdministrativelyPaused) {
+			slog.Info("Not saving revenue snapshot while paused", "mode", w.StripeMode)
+		} else if err != nil {
 			slog.Error("Failed to save revenue snapshot", "error", err)
 		}
 	}
@@ -157,180 +625,304 @@ func (w *revenueWidget) update(ctx context.Context) {
 	w.PreviousMRR = w.CurrentMRR
 }
 
-func (w *revenueWidget) calculateMRR(ctx context.Context) (float64, error) {
-	// Fetch all active subscriptions
-	params := &stripe.SubscriptionListParams{}
-	params.Status = stripe.String("active")
-	params.Context = ctx
-
-	totalMRR := 0.0
-	iter := subscription.List(params)
-
-	for iter.Next() {
-		sub := iter.Subscription()
-
-		// Calculate MRR for this subscription
-		for _, item := range sub.Items.Data {
-			if item.Price == nil {
-				continue
-			}
-
-			// Get the amount in dollars (Stripe uses cents)
-			amount := float64(item.Price.UnitAmount) / 100.0
-
-			// Normalize to monthly based on interval
-			interval := item.Price.Recurring.Interval
-			intervalCount := item.Price.Recurring.IntervalCount
-
-			var monthlyAmount float64
-			switch interval {
-			case "month":
-				monthlyAmount = amount / float64(intervalCount)
-			case "year":
-				monthlyAmount = amount / (12.0 * float64(intervalCount))
-			case "week":
-				monthlyAmount = amount * 4.33 / float64(intervalCount) // ~4.33 weeks per month
-			case "day":
-				monthlyAmount = amount * 30 / float64(intervalCount)
-			default:
-				slog.Warn("Unknown interval", "interval", interval)
-				continue
-			}
-
-			// Multiply by quantity
-			monthlyAmount *= float64(item.Quantity)
-
-			totalMRR += monthlyAmount
+// compareGrowthWith sets the growth rate against a previous snapshot, flagging
+// the comparison window as short when the snapshot is recent
+func (w *revenueWidget) compareGrowthWith(previous *RevenueSnapshot, now time.Time) {
+	w.PreviousMRR = previous.MRR
+	w.GrowthRate, _ = growthPercent(w.PreviousMRR, w.CurrentMRR)
+	w.ARPUGrowth, w.ARPUCompared = growthPercent(previous.ARPU, w.ARPU)
+
+	baseline := w.baseline()
+	w.GrowthComparedAt = previous.Timestamp
+	w.GrowthWindowDays = int(now.Sub(previous.Timestamp) / (24 * time.Hour))
+	w.GrowthWindowShort = baseline.short(previous.Timestamp, now)
+	w.GrowthBaselineLabel = baseline.label()
+}
+
+// subscriptionPaused reports whether collection of a subscription is paused at
+// t. Paused subscriptions keep status=active, and Stripe clears pause_collection
+// once they resume.
+func subscriptionPaused(sub *stripe.Subscription, t time.Time) bool {
+	if sub.PauseCollection == nil {
+		return false
+	}
+
+	return sub.PauseCollection.ResumesAt == 0 || t.Before(time.Unix(sub.PauseCollection.ResumesAt, 0))
+}
+
+// subscriptionCanceling reports whether a subscription is set to cancel, at
+// the end of its period or at a set date. Such subscriptions stay active and
+// count toward MRR until they cancel.
+func subscriptionCanceling(sub *stripe.Subscription) bool {
+	return sub.CancelAtPeriodEnd || sub.CancelAt != 0
+}
+
+// activeMRR is the MRR of active subscriptions, with paused subscriptions kept
+// apart from the totals. Customers and Products are of the subscriptions that
+// aren't paused.
+type activeMRR struct {
+	Totals        currencyAmounts
+	Paused        currencyAmounts
+	Subscriptions []subscriptionMRR
+	Metered       []meteredItem
+	Customers     subscriptionCustomers
+	Products      *productAmounts
+	// Part of Totals of subscriptions set to cancel
+	Canceling currencyAmounts
+	// Revenue of plans billed for longer than a month that was paid for but
+	// not recognized yet
+	Deferred currencyAmounts
+	// Part of Totals of past due subscriptions, when they are counted
+	PastDue *atRiskMRR
+	// Change in MRR once subscription schedules move to their next phase,
+	// and the number of subscriptions it changes for
+	Scheduled              currencyAmounts
+	ScheduledSubscriptions int
+}
+
+func newActiveMRR() *activeMRR {
+	return &activeMRR{
+		Totals:        make(currencyAmounts),
+		Paused:        make(currencyAmounts),
+		Subscriptions: make([]subscriptionMRR, 0),
+		Customers:     make(subscriptionCustomers),
+		Products:      newProductAmounts(),
+		Canceling:     make(currencyAmounts),
+		Deferred:      make(currencyAmounts),
+		PastDue:       newAtRiskMRR(),
+		Scheduled:     make(currencyAmounts),
+	}
+}
+
+// addSubscription adds the MRR of an active subscription, to Paused when its
+// collection is paused at t and to Totals otherwise. Metered items are only
+// collected from subscriptions that aren't paused.
+func (m *activeMRR) addSubscription(sub *stripe.Subscription, resolver *priceResolver, includeMetered bool, t time.Time) {
+	if subscriptionPaused(sub, t) {
+		m.Paused.addSubscription(sub, resolver)
+		return
+	}
+
+	if includeMetered {
+		m.Metered = append(m.Metered, meteredItems(sub)...)
+	}
+
+	items, dailyPlan := subscriptionItemsMRR(sub, resolver)
+	subMRR := subscriptionMRR{ID: sub.ID, Currency: string(sub.Currency), DailyPlan: dailyPlan}
+
+	canceling := subscriptionCanceling(sub)
+	for _, item := range items {
+		subMRR.MRR += item.Amount
+		m.Totals[item.Currency] += item.Amount
+		m.Products.add(item)
+
+		if canceling {
+			m.Canceling[item.Currency] += item.Amount
 		}
 	}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list subscriptions: %w", err)
+	for currency, amount := range deferredRevenue(sub, items, t) {
+		m.Deferred[currency] += amount
 	}
 
-	return totalMRR, nil
+	m.Subscriptions = append(m.Subscriptions, subMRR)
+	m.Customers.add(sub)
+
+	if change, ok := scheduledMRRChange(sub, items, resolver); ok {
+		changed := false
+		for currency, amount := range change {
+			m.Scheduled[currency] += amount
+			changed = changed || amount != 0
+		}
+
+		if changed {
+			m.ScheduledSubscriptions++
+		}
+	}
 }
 
-func (w *revenueWidget) calculateNewMRR(ctx context.Context) (float64, error) {
-	// Get start of current month
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+// averageRevenuePerUser divides MRR by the number of paying customers,
+// returning 0 when there are none
+func averageRevenuePerUser(mrr float64, customers int) float64 {
+	if customers == 0 {
+		return 0
+	}
 
-	// Fetch subscriptions created this month
-	params := &stripe.SubscriptionListParams{}
-	params.Status = stripe.String("active")
-	params.Filters.AddFilter("created", "gte", fmt.Sprintf("%d", startOfMonth.Unix()))
-	params.Context = ctx
+	return mrr / float64(customers)
+}
 
-	newMRR := 0.0
-	iter := subscription.List(params)
+// updateGoal sets the progress of the current MRR toward mrr-goal
+func (w *revenueWidget) updateGoal() {
+	w.Goal = nil
+	if w.MRRGoal > 0 {
+		w.Goal = calculateMRRGoal(w.CurrentMRR, w.MRRGoal, w.goalDate, w.now())
+	}
+}
 
-	for iter.Next() {
-		sub := iter.Subscription()
+// quickRatio returns (new + expansion MRR) / (churned + contraction MRR),
+// returning false when no MRR was lost and the ratio is undefined
+func quickRatio(newMRR, expansionMRR, churnedMRR, contractionMRR float64) (float64, bool) {
+	lost := churnedMRR + contractionMRR
+	if lost <= 0 {
+		return 0, false
+	}
 
-		// Calculate MRR for this subscription
-		for _, item := range sub.Items.Data {
-			if item.Price == nil {
-				continue
-			}
+	return (newMRR + expansionMRR) / lost, true
+}
 
-			amount := float64(item.Price.UnitAmount) / 100.0
-			interval := item.Price.Recurring.Interval
-			intervalCount := item.Price.Recurring.IntervalCount
+// quickRatioHealth rates a quick ratio by the usual SaaS thresholds. An
+// undefined ratio, with nothing lost, is great.
+func quickRatioHealth(ratio float64, defined bool) string {
+	switch {
+	case !defined || ratio > 4:
+		return "great"
+	case ratio >= 2:
+		return "okay"
+	}
 
-			var monthlyAmount float64
-			switch interval {
-			case "month":
-				monthlyAmount = amount / float64(intervalCount)
-			case "year":
-				monthlyAmount = amount / (12.0 * float64(intervalCount))
-			case "week":
-				monthlyAmount = amount * 4.33 / float64(intervalCount)
-			case "day":
-				monthlyAmount = amount * 30 / float64(intervalCount)
-			default:
-				continue
-			}
+	return "bad"
+}
 
-			monthlyAmount *= float64(item.Quantity)
-			newMRR += monthlyAmount
-		}
+// setQuickRatio sets the quick ratio, nil meaning it's undefined
+func (w *revenueWidget) setQuickRatio(ratio *float64) {
+	w.QuickRatio, w.QuickRatioDefined = 0, ratio != nil
+	if ratio != nil {
+		w.QuickRatio = *ratio
 	}
+	w.QuickRatioHealth = quickRatioHealth(w.QuickRatio, w.QuickRatioDefined)
+}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list new subscriptions: %w", err)
+// quickRatioValue returns the quick ratio to store, nil when it's undefined
+func (w *revenueWidget) quickRatioValue() *float64 {
+	if !w.QuickRatioDefined {
+		return nil
 	}
 
-	return newMRR, nil
+	ratio := w.QuickRatio
+	return &ratio
 }
 
-func (w *revenueWidget) calculateChurnedMRR(ctx context.Context) (float64, error) {
-	// Get start of current month
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+// calculateMRR returns the MRR of the active subscriptions per currency along
+// with the normalized MRR of each subscription, and the metered items when
+// include-metered is set. With count-past-due-as-active past due subscriptions
+// are counted as active and also kept in PastDue.
+func (w *revenueWidget) calculateMRR(scan *subscriptionScan, resolver *priceResolver, now time.Time) *activeMRR {
+	statuses := []stripe.SubscriptionStatus{stripe.SubscriptionStatusActive}
+	if w.CountPastDueAsActive {
+		statuses = append(statuses, stripe.SubscriptionStatusPastDue)
+	}
 
-	// Fetch subscriptions canceled this month
-	params := &stripe.SubscriptionListParams{}
-	params.Status = stripe.String("canceled")
-	params.Filters.AddFilter("canceled_at", "gte", fmt.Sprintf("%d", startOfMonth.Unix()))
-	params.Context = ctx
+	mrr := newActiveMRR()
+	scan.withStatus(func(sub *stripe.Subscription) {
+		mrr.addSubscription(sub, resolver, w.IncludeMetered, now)
+		if sub.Status == stripe.SubscriptionStatusPastDue {
+			mrr.PastDue.add(sub, resolver)
+		}
+	}, statuses...)
 
-	churnedMRR := 0.0
-	iter := subscription.List(params)
+	return mrr
+}
 
-	for iter.Next() {
-		sub := iter.Subscription()
+// calculateNewMRR returns the MRR of subscriptions created this month, telling
+// reactivations of customers who had canceled before apart from new customers
+func (w *revenueWidget) calculateNewMRR(ctx context.Context, scan *subscriptionScan, resolver *priceResolver) (*newMRR, error) {
+	// Trials are counted as new in the month they start, so that they aren't
+	// counted again in the month they convert to active
+	statuses := []stripe.SubscriptionStatus{stripe.SubscriptionStatusActive}
+	if w.IncludeTrialing {
+		statuses = append(statuses, stripe.SubscriptionStatusTrialing)
+	}
 
-		// Calculate MRR that was lost
-		for _, item := range sub.Items.Data {
-			if item.Price == nil {
-				continue
-			}
+	mrr := &newMRR{Amounts: make(currencyAmounts), Reactivated: make(currencyAmounts)}
+	reactivations := scan.reactivations()
 
-			amount := float64(item.Price.UnitAmount) / 100.0
-			interval := item.Price.Recurring.Interval
-			intervalCount := item.Price.Recurring.IntervalCount
+	var err error
+	scan.withStatus(func(sub *stripe.Subscription) {
+		if err != nil || sub.Created < scan.StartOfMonth.Unix() {
+			return
+		}
 
-			var monthlyAmount float64
-			switch interval {
-			case "month":
-				monthlyAmount = amount / float64(intervalCount)
-			case "year":
-				monthlyAmount = amount / (12.0 * float64(intervalCount))
-			case "week":
-				monthlyAmount = amount * 4.33 / float64(intervalCount)
-			case "day":
-				monthlyAmount = amount * 30 / float64(intervalCount)
-			default:
-				continue
-			}
+		mrr.Amounts.addSubscription(sub, resolver)
 
-			monthlyAmount *= float64(item.Quantity)
-			churnedMRR += monthlyAmount
+		reactivated, checkErr := reactivations.isReactivation(ctx, sub)
+		if checkErr != nil {
+			err = checkErr
+			return
+		}
+		if reactivated {
+			mrr.Reactivated.addSubscription(sub, resolver)
 		}
+	}, statuses...)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if err := iter.Err(); err != nil {
-		return 0, fmt.Errorf("failed to list churned subscriptions: %w", err)
+	return mrr, nil
+}
+
+// calculateTrialingMRR returns the MRR subscriptions in trial will have once
+// they convert
+func (w *revenueWidget) calculateTrialingMRR(scan *subscriptionScan, resolver *priceResolver) currencyAmounts {
+	trialingMRR := make(currencyAmounts)
+	scan.withStatus(func(sub *stripe.Subscription) {
+		trialingMRR.addSubscription(sub, resolver)
+	}, stripe.SubscriptionStatusTrialing)
+
+	return trialingMRR
+}
+
+// atRiskMRR is the MRR of subscriptions that may be lost to failed payments
+type atRiskMRR struct {
+	Amounts   currencyAmounts
+	Customers subscriptionCustomers
+}
+
+func newAtRiskMRR() *atRiskMRR {
+	return &atRiskMRR{Amounts: make(currencyAmounts), Customers: make(subscriptionCustomers)}
+}
+
+func (a *atRiskMRR) add(sub *stripe.Subscription, resolver *priceResolver) {
+	a.Amounts.addSubscription(sub, resolver)
+	a.Customers.add(sub)
+}
+
+// calculateAtRiskMRR returns the MRR of subscriptions that are past due, which
+// Stripe marks them as once a renewal payment fails and keeps retrying until
+// it succeeds or the subscription is canceled
+func (w *revenueWidget) calculateAtRiskMRR(scan *subscriptionScan, resolver *priceResolver) *atRiskMRR {
+	atRisk := newAtRiskMRR()
+	scan.withStatus(func(sub *stripe.Subscription) {
+		atRisk.add(sub, resolver)
+	}, stripe.SubscriptionStatusPastDue)
+
+	return atRisk
+}
+
+// calculateChurnedMRR returns the MRR of canceled subscriptions
+func calculateChurnedMRR(canceled []*stripe.Subscription, resolver *priceResolver) currencyAmounts {
+	churnedMRR := make(currencyAmounts)
+	for _, sub := range canceled {
+		churnedMRR.addSubscription(sub, resolver)
 	}
 
-	return churnedMRR, nil
+	return churnedMRR
 }
 
 func (w *revenueWidget) generateTrendData() {
 	// For MVP, generate simple trend based on current data
 	// In production, you'd query historical data from database or Stripe
 
-	now := time.Now()
-	months := 6
+	now := w.now()
+	months := w.TrendMonths
 
 	w.TrendLabels = make([]string, months)
 	w.TrendValues = make([]float64, months)
 
-	// Generate last 6 months
+	// Generate the last trend-months months
 	for i := months - 1; i >= 0; i-- {
 		monthDate := now.AddDate(0, -i, 0)
-		w.TrendLabels[months-1-i] = monthDate.Format("Jan")
+		w.TrendLabels[months-1-i] = trendLabel(monthDate, months)
 
 		// For MVP, simulate growth trend
 		// In production, fetch actual historical data
@@ -348,58 +940,57 @@ func (w *revenueWidget) Render() template.HTML {
 	return w.renderTemplate(w, revenueWidgetTemplate)
 }
 
-// calculateMRRWithRetry wraps calculateMRR with circuit breaker and retry logic
-func (w *revenueWidget) calculateMRRWithRetry(ctx context.Context, client *StripeClientWrapper) (float64, error) {
-	var result float64
-	err := client.ExecuteWithRetry(ctx, "calculateMRR", func() error {
-		mrr, err := w.calculateMRR(ctx)
-		result = mrr
-		return err
-	})
-	return result, err
-}
-
 // calculateNewMRRWithRetry wraps calculateNewMRR with circuit breaker and retry logic
-func (w *revenueWidget) calculateNewMRRWithRetry(ctx context.Context, client *StripeClientWrapper) (float64, error) {
-	var result float64
+func (w *revenueWidget) calculateNewMRRWithRetry(ctx context.Context, client *StripeClientWrapper, scan *subscriptionScan, resolver *priceResolver) (*newMRR, error) {
+	var result *newMRR
 	err := client.ExecuteWithRetry(ctx, "calculateNewMRR", func() error {
-		mrr, err := w.calculateNewMRR(ctx)
+		mrr, err := w.calculateNewMRR(ctx, scan, resolver)
 		result = mrr
 		return err
 	})
 	return result, err
 }
 
-// calculateChurnedMRRWithRetry wraps calculateChurnedMRR with circuit breaker and retry logic
-func (w *revenueWidget) calculateChurnedMRRWithRetry(ctx context.Context, client *StripeClientWrapper) (float64, error) {
-	var result float64
-	err := client.ExecuteWithRetry(ctx, "calculateChurnedMRR", func() error {
-		mrr, err := w.calculateChurnedMRR(ctx)
-		result = mrr
-		return err
-	})
-	return result, err
-}
+// loadHistoricalData populates the trend chart from one snapshot per calendar
+// month, oldest first and ending with the current month, using the current
+// MRR for the current month. Months before the first snapshot are left out
+// and months without a snapshot repeat the previous month, so that the chart
+// always has one point per consecutive month. Returns false when there is no
+// history from previous months.
+func (w *revenueWidget) loadHistoricalData(monthly []*RevenueSnapshot) bool {
+	if len(monthly) < 2 {
+		return false
+	}
 
-// loadHistoricalData loads historical data from database snapshots
-func (w *revenueWidget) loadHistoricalData(history []*RevenueSnapshot) {
-	if len(history) == 0 {
-		return
+	now := w.now()
+	first := bucketStart(now, MetricsBucketMonth).AddDate(0, -(len(monthly) - 1), 0)
+
+	labels := make([]string, 0, len(monthly))
+	values := make([]float64, 0, len(monthly))
+
+	var previous *RevenueSnapshot
+	for i, snapshot := range monthly[:len(monthly)-1] {
+		if snapshot == nil {
+			snapshot = previous
+		}
+
+		if snapshot == nil {
+			continue
+		}
+
+		labels = append(labels, trendLabel(first.AddDate(0, i, 0), len(monthly)))
+		values = append(values, snapshot.MRR)
+		previous = snapshot
 	}
 
-	// Use database data to populate trend chart
-	maxPoints := 6
-	if len(history) > maxPoints {
-		history = history[:maxPoints]
+	if len(labels) == 0 {
+		return false
 	}
 
-	w.TrendLabels = make([]string, len(history))
-	w.TrendValues = make([]float64, len(history))
+	labels = append(labels, trendLabel(now, len(monthly)))
+	values = append(values, w.CurrentMRR)
 
-	// Reverse chronological order (oldest first for chart)
-	for i := range history {
-		idx := len(history) - 1 - i
-		w.TrendLabels[i] = history[idx].Timestamp.Format("Jan")
-		w.TrendValues[i] = history[idx].MRR
-	}
+	w.TrendLabels = labels
+	w.TrendValues = values
+	return true
 }
@@ -1,8 +1,11 @@
 package glance
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/stripe/stripe-go/v81"
 )
 
 func TestRevenueWidget_Initialize(t *testing.T) {
@@ -42,6 +45,33 @@ func TestRevenueWidget_Initialize(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "invalid anomaly median multiple",
+			widget: &revenueWidget{
+				StripeAPIKey:          "sk_test_valid_key",
+				AnomalyMedianMultiple: 0.5,
+			},
+			expectError:   true,
+			errorContains: "anomaly-median-multiple must be greater than 1",
+		},
+		{
+			name: "invalid account label",
+			widget: &revenueWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				AccountLabel: "eu entity",
+			},
+			expectError:   true,
+			errorContains: "account-label",
+		},
+		{
+			name: "trend months out of range",
+			widget: &revenueWidget{
+				StripeAPIKey: "sk_live_valid_key",
+				TrendMonths:  25,
+			},
+			expectError:   true,
+			errorContains: "trend-months must be between 2 and 24",
+		},
 	}
 
 	for _, tt := range tests {
@@ -69,6 +99,12 @@ func TestRevenueWidget_Initialize(t *testing.T) {
 				if tt.widget.StripeMode == "" {
 					t.Error("expected StripeMode to default to 'live'")
 				}
+				if tt.widget.AnomalyMedianMultiple != defaultAnomalyMedianMultiple {
+					t.Errorf("expected anomaly median multiple to default to %v, got %v", defaultAnomalyMedianMultiple, tt.widget.AnomalyMedianMultiple)
+				}
+				if tt.widget.TrendMonths != defaultTrendMonths {
+					t.Errorf("expected trend months to default to %d, got %d", defaultTrendMonths, tt.widget.TrendMonths)
+				}
 			}
 		})
 	}
@@ -76,8 +112,9 @@ func TestRevenueWidget_Initialize(t *testing.T) {
 
 func TestRevenueWidget_GenerateTrendData(t *testing.T) {
 	widget := &revenueWidget{
-		CurrentMRR: 10000.0,
-		GrowthRate: 10.0, // 10% growth
+		CurrentMRR:  10000.0,
+		GrowthRate:  10.0, // 10% growth
+		TrendMonths: defaultTrendMonths,
 	}
 
 	widget.generateTrendData()
@@ -110,6 +147,169 @@ func TestRevenueWidget_GenerateTrendData(t *testing.T) {
 	}
 }
 
+func TestRevenueWidget_GenerateTrendData_TrendMonths(t *testing.T) {
+	widget := &revenueWidget{CurrentMRR: 1000, TrendMonths: 18}
+	widget.generateTrendData()
+
+	if len(widget.TrendLabels) != 18 || len(widget.TrendValues) != 18 {
+		t.Fatalf("expected 18 months, got %d labels and %d values", len(widget.TrendLabels), len(widget.TrendValues))
+	}
+
+	// Month names repeat over more than a year, so labels include the year
+	if expected := time.Now().Format("Jan 06"); widget.TrendLabels[17] != expected {
+		t.Errorf("expected the last label to be %q, got %q", expected, widget.TrendLabels[17])
+	}
+}
+
+func TestRevenueWidget_LoadHistoricalData(t *testing.T) {
+	now := time.Now()
+	month := func(offset int) time.Time {
+		return bucketStart(now, MetricsBucketMonth).AddDate(0, offset, 0)
+	}
+
+	tests := []struct {
+		name           string
+		monthly        []*RevenueSnapshot
+		expectedLabels []string
+		expectedValues []float64
+	}{
+		{
+			name:    "empty history",
+			monthly: make([]*RevenueSnapshot, defaultTrendMonths),
+		},
+		{
+			name:    "only the current month",
+			monthly: []*RevenueSnapshot{nil, nil, nil, nil, nil, {Timestamp: now, MRR: 400}},
+		},
+		{
+			name: "every month",
+			monthly: []*RevenueSnapshot{
+				{Timestamp: month(-5), MRR: 100},
+				{Timestamp: month(-4), MRR: 200},
+				{Timestamp: month(-3), MRR: 300},
+				{Timestamp: month(-2), MRR: 400},
+				{Timestamp: month(-1), MRR: 500},
+				{Timestamp: now, MRR: 450},
+			},
+			expectedLabels: []string{month(-5).Format("Jan"), month(-4).Format("Jan"), month(-3).Format("Jan"), month(-2).Format("Jan"), month(-1).Format("Jan"), now.Format("Jan")},
+			expectedValues: []float64{100, 200, 300, 400, 500, 600},
+		},
+		{
+			name: "leading and interior gaps",
+			monthly: []*RevenueSnapshot{
+				nil,
+				nil,
+				{Timestamp: month(-3), MRR: 300},
+				nil,
+				{Timestamp: month(-1), MRR: 500},
+				nil,
+			},
+			expectedLabels: []string{month(-3).Format("Jan"), month(-2).Format("Jan"), month(-1).Format("Jan"), now.Format("Jan")},
+			expectedValues: []float64{300, 300, 500, 600},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widget := &revenueWidget{CurrentMRR: 600}
+			loaded := widget.loadHistoricalData(tt.monthly)
+
+			if loaded != (tt.expectedValues != nil) {
+				t.Fatalf("expected loaded to be %v", tt.expectedValues != nil)
+			}
+
+			if len(widget.TrendValues) != len(tt.expectedValues) {
+				t.Fatalf("expected %d trend values, got %d", len(tt.expectedValues), len(widget.TrendValues))
+			}
+
+			for i := range tt.expectedValues {
+				if widget.TrendValues[i] != tt.expectedValues[i] || widget.TrendLabels[i] != tt.expectedLabels[i] {
+					t.Errorf("point %d: expected %s %f, got %s %f", i, tt.expectedLabels[i], tt.expectedValues[i], widget.TrendLabels[i], widget.TrendValues[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRevenueWidget_CompareGrowthWith(t *testing.T) {
+	now := time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		previous   *RevenueSnapshot
+		wantGrowth float64
+		wantDays   int
+		wantShort  bool
+	}{
+		{
+			name:       "month old snapshot",
+			previous:   &RevenueSnapshot{Timestamp: now.Add(-growthComparisonWindow), MRR: 800},
+			wantGrowth: 25,
+			wantDays:   30,
+			wantShort:  false,
+		},
+		{
+			name:       "only recent history",
+			previous:   &RevenueSnapshot{Timestamp: now.AddDate(0, 0, -5), MRR: 1000},
+			wantGrowth: 0,
+			wantDays:   5,
+			wantShort:  true,
+		},
+		{
+			name:       "no previous revenue",
+			previous:   &RevenueSnapshot{Timestamp: now.AddDate(0, 0, -29), MRR: 0},
+			wantGrowth: 0,
+			wantDays:   29,
+			wantShort:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widget := &revenueWidget{CurrentMRR: 1000, GrowthRate: 99}
+			widget.compareGrowthWith(tt.previous, now)
+
+			if !floatEquals(widget.GrowthRate, tt.wantGrowth, 0.01) {
+				t.Errorf("expected growth rate %f, got %f", tt.wantGrowth, widget.GrowthRate)
+			}
+
+			if widget.GrowthWindowDays != tt.wantDays {
+				t.Errorf("expected window of %d days, got %d", tt.wantDays, widget.GrowthWindowDays)
+			}
+
+			if widget.GrowthWindowShort != tt.wantShort {
+				t.Errorf("expected short window %v, got %v", tt.wantShort, widget.GrowthWindowShort)
+			}
+		})
+	}
+}
+
+func TestRevenueWidget_GrowthFromHourlySaves(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	db := newSimpleMetricsDB()
+	db.now = func() time.Time { return now }
+
+	// Five weeks of hourly saves up to now, MRR growing by one each hour
+	hours := 35 * 24
+	for i := 0; i < hours; i++ {
+		timestamp := now.Add(-time.Duration(hours-1-i) * time.Hour)
+		db.SaveRevenueSnapshot(ctx, &RevenueSnapshot{Timestamp: timestamp, MRR: float64(1000 + i), Mode: "live"})
+	}
+
+	w := &revenueWidget{StripeMode: "live", CurrentMRR: float64(1000 + hours - 1)}
+	w.updateGrowth(ctx, db, now)
+
+	baselineMRR := float64(1000 + hours - 1 - 30*24)
+	if !w.GrowthComparedAt.Equal(now.Add(-growthComparisonWindow)) || w.GrowthWindowShort {
+		t.Fatalf("expected growth compared against the snapshot of 30 days ago, got %s (short %v)", w.GrowthComparedAt, w.GrowthWindowShort)
+	}
+
+	if expected := (w.CurrentMRR - baselineMRR) / baselineMRR * 100; !floatEquals(w.GrowthRate, expected, 0.001) {
+		t.Errorf("expected growth rate %v, got %v", expected, w.GrowthRate)
+	}
+}
+
 func TestRevenueWidget_MRRCalculation(t *testing.T) {
 	// Test interval normalization logic
 	tests := []struct {
@@ -196,6 +396,110 @@ func TestRevenueWidget_MRRCalculation(t *testing.T) {
 	}
 }
 
+func TestActiveMRR_PausedSubscriptions(t *testing.T) {
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	sub := func(id string, amount int64, pause *stripe.SubscriptionPauseCollection) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:              id,
+			Customer:        &stripe.Customer{ID: "cus_" + id},
+			Currency:        "usd",
+			PauseCollection: pause,
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price: &stripe.Price{
+					Currency:   "usd",
+					UnitAmount: amount,
+					Recurring:  &stripe.PriceRecurring{Interval: "month", IntervalCount: 1},
+				},
+			}}},
+		}
+	}
+
+	mrr := newActiveMRR()
+	mrr.addSubscription(sub("sub_active", 5000, nil), nil, false, now)
+	mrr.addSubscription(sub("sub_paused", 2000, &stripe.SubscriptionPauseCollection{Behavior: "void"}), nil, false, now)
+	mrr.addSubscription(sub("sub_resuming", 1000, &stripe.SubscriptionPauseCollection{
+		Behavior:  "void",
+		ResumesAt: now.AddDate(0, 0, 7).Unix(),
+	}), nil, false, now)
+	mrr.addSubscription(sub("sub_resumed", 3000, &stripe.SubscriptionPauseCollection{
+		Behavior:  "void",
+		ResumesAt: now.AddDate(0, 0, -1).Unix(),
+	}), nil, false, now)
+
+	if !floatEquals(mrr.Totals["usd"], 80, 0.001) {
+		t.Errorf("expected MRR of 80 without paused subscriptions, got %v", mrr.Totals["usd"])
+	}
+
+	if !floatEquals(mrr.Paused["usd"], 30, 0.001) {
+		t.Errorf("expected paused MRR of 30, got %v", mrr.Paused["usd"])
+	}
+
+	if len(mrr.Subscriptions) != 2 || mrr.Subscriptions[0].ID != "sub_active" || mrr.Subscriptions[1].ID != "sub_resumed" {
+		t.Errorf("expected only unpaused subscriptions to be listed, got %+v", mrr.Subscriptions)
+	}
+
+	if len(mrr.Customers) != 2 || mrr.Customers["cus_sub_paused"] {
+		t.Errorf("expected only customers of unpaused subscriptions, got %v", mrr.Customers)
+	}
+}
+
+func TestAverageRevenuePerUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		mrr       float64
+		customers int
+		expected  float64
+	}{
+		{"several customers", 1000, 8, 125},
+		{"single customer", 49, 1, 49},
+		{"no paying customers", 0, 0, 0},
+		{"MRR without customers", 100, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if arpu := averageRevenuePerUser(tt.mrr, tt.customers); !floatEquals(arpu, tt.expected, 0.001) {
+				t.Errorf("expected ARPU %v, got %v", tt.expected, arpu)
+			}
+		})
+	}
+}
+
+func TestQuickRatio(t *testing.T) {
+	tests := []struct {
+		name            string
+		newMRR          float64
+		expansionMRR    float64
+		churnedMRR      float64
+		contractionMRR  float64
+		expectedRatio   float64
+		expectedDefined bool
+		expectedHealth  string
+	}{
+		{"great", 900, 100, 200, 0, 5, true, "great"},
+		{"okay", 500, 100, 150, 50, 3, true, "okay"},
+		{"exactly 4 is okay", 400, 0, 100, 0, 4, true, "okay"},
+		{"bad", 100, 0, 100, 0, 1, true, "bad"},
+		{"nothing gained", 0, 0, 100, 0, 0, true, "bad"},
+		{"no losses", 500, 0, 0, 0, 0, false, "great"},
+		{"no movement", 0, 0, 0, 0, 0, false, "great"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio, defined := quickRatio(tt.newMRR, tt.expansionMRR, tt.churnedMRR, tt.contractionMRR)
+			if defined != tt.expectedDefined || !floatEquals(ratio, tt.expectedRatio, 0.001) {
+				t.Errorf("expected ratio %v (defined %v), got %v (defined %v)", tt.expectedRatio, tt.expectedDefined, ratio, defined)
+			}
+
+			if health := quickRatioHealth(ratio, defined); health != tt.expectedHealth {
+				t.Errorf("expected health %q, got %q", tt.expectedHealth, health)
+			}
+		})
+	}
+}
+
 func TestRevenueWidget_GrowthRateCalculation(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -261,3 +565,101 @@ func floatEquals(a, b, tolerance float64) bool {
 	}
 	return diff < tolerance
 }
+
+func TestCheckMetricsAccounts(t *testing.T) {
+	revenue := func(apiKey, account string) widget {
+		return &revenueWidget{StripeAPIKey: apiKey, StripeMode: "live", AccountLabel: account}
+	}
+
+	tests := []struct {
+		name        string
+		widgets     []widget
+		expectError bool
+	}{
+		{name: "same key shared by widgets", widgets: []widget{revenue("sk_live_us", ""), &customersWidget{StripeAPIKey: "sk_live_us", StripeMode: "live"}}},
+		{name: "different keys with labels", widgets: []widget{revenue("sk_live_us", "us"), revenue("sk_live_eu", "eu")}},
+		{name: "one labelled and one default", widgets: []widget{revenue("sk_live_us", ""), revenue("sk_live_eu", "eu")}},
+		{name: "different keys without labels", widgets: []widget{revenue("sk_live_us", ""), revenue("sk_live_eu", "")}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widgets := make(map[uint64]widget)
+			for i, w := range tt.widgets {
+				widgets[uint64(i)] = w
+			}
+
+			if err := checkMetricsAccounts(widgets); (err != nil) != tt.expectError {
+				t.Errorf("expected error: %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestAtRiskMRR_CountsCustomersOnce(t *testing.T) {
+	sub := func(id, customer string, amount int64) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:       id,
+			Customer: &stripe.Customer{ID: customer},
+			Currency: "usd",
+			Status:   stripe.SubscriptionStatusPastDue,
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price: &stripe.Price{
+					Currency:   "usd",
+					UnitAmount: amount,
+					Recurring:  &stripe.PriceRecurring{Interval: "year", IntervalCount: 1},
+				},
+			}}},
+		}
+	}
+
+	atRisk := newAtRiskMRR()
+	atRisk.add(sub("sub_1", "cus_1", 12000), nil)
+	atRisk.add(sub("sub_2", "cus_1", 24000), nil)
+	atRisk.add(sub("sub_3", "cus_2", 6000), nil)
+
+	if !floatEquals(atRisk.Amounts["usd"], 35, 0.001) {
+		t.Errorf("expected 35 MRR at risk, got %v", atRisk.Amounts["usd"])
+	}
+
+	if len(atRisk.Customers) != 2 {
+		t.Errorf("expected 2 customers at risk, got %d", len(atRisk.Customers))
+	}
+}
+
+func TestActiveMRR_CancelingSubscriptions(t *testing.T) {
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	sub := func(id string, amount int64, periodEnd bool, cancelAt int64, pause *stripe.SubscriptionPauseCollection) *stripe.Subscription {
+		return &stripe.Subscription{
+			ID:                id,
+			Customer:          &stripe.Customer{ID: "cus_" + id},
+			Currency:          "usd",
+			CancelAtPeriodEnd: periodEnd,
+			CancelAt:          cancelAt,
+			PauseCollection:   pause,
+			Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{
+				Quantity: 1,
+				Price: &stripe.Price{
+					Currency:   "usd",
+					UnitAmount: amount,
+					Recurring:  &stripe.PriceRecurring{Interval: "month", IntervalCount: 1},
+				},
+			}}},
+		}
+	}
+
+	mrr := newActiveMRR()
+	mrr.addSubscription(sub("sub_active", 5000, false, 0, nil), nil, false, now)
+	mrr.addSubscription(sub("sub_period_end", 2000, true, 0, nil), nil, false, now)
+	mrr.addSubscription(sub("sub_cancel_at", 1000, false, now.AddDate(0, 2, 0).Unix(), nil), nil, false, now)
+	mrr.addSubscription(sub("sub_paused", 3000, true, 0, &stripe.SubscriptionPauseCollection{Behavior: "void"}), nil, false, now)
+
+	if !floatEquals(mrr.Totals["usd"], 80, 0.001) {
+		t.Errorf("expected canceling subscriptions to stay in MRR of 80, got %v", mrr.Totals["usd"])
+	}
+
+	if !floatEquals(mrr.Canceling["usd"], 30, 0.001) {
+		t.Errorf("expected 30 MRR canceling without paused subscriptions, got %v", mrr.Canceling["usd"])
+	}
+}
@@ -22,6 +22,19 @@ func newWidget(widgetType string) (widget, error) {
 		return nil, errors.New("widget 'type' property is empty or not specified")
 	}
 
+	w := newWidgetOfType(widgetType)
+	if w == nil {
+		return nil, fmt.Errorf("unknown widget type: %s", widgetType)
+	}
+
+	w.setID(widgetIDCounter.Add(1))
+
+	return w, nil
+}
+
+// newWidgetOfType returns an unconfigured widget of widgetType, nil when
+// there's no such type
+func newWidgetOfType(widgetType string) widget {
 	var w widget
 
 	switch widgetType {
@@ -95,12 +108,10 @@ func newWidget(widgetType string) (widget, error) {
 	// case "twitch-channels":
 	// 	w = &twitchChannelsWidget{}
 	default:
-		return nil, fmt.Errorf("unknown widget type: %s", widgetType)
+		return nil
 	}
 
-	w.setID(widgetIDCounter.Add(1))
-
-	return w, nil
+	return w
 }
 
 type widgets []widget
@@ -144,6 +155,7 @@ type widget interface {
 
 	initialize() error
 	requiresUpdate(*time.Time) bool
+	invalidateCache()
 	setProviders(*widgetProviders)
 	update(context.Context)
 	setID(uint64)
@@ -195,10 +207,20 @@ func (w *widgetBase) requiresUpdate(now *time.Time) bool {
 	return now.After(w.nextUpdate)
 }
 
+// invalidateCache makes the widget update on its next render regardless of
+// its cache duration
+func (w *widgetBase) invalidateCache() {
+	w.nextUpdate = time.Time{}
+}
+
 func (w *widgetBase) IsWIP() bool {
 	return w.WIP
 }
 
+func (w *widgetBase) IsPaused() bool {
+	return globalPause.isPaused()
+}
+
 func (w *widgetBase) update(ctx context.Context) {
 
 }
@@ -0,0 +1,195 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxEventSubscribers caps the browsers subscribed to /api/events at once
+	maxEventSubscribers = 100
+
+	// eventKeepAliveInterval is how often subscribers are sent a comment so
+	// that proxies don't close idle connections
+	eventKeepAliveInterval = 30 * time.Second
+
+	// eventReconnectDelay is how long browsers wait before reconnecting, such
+	// as after the server restarted on a config reload
+	eventReconnectDelay = 5 * time.Second
+)
+
+var (
+	errTooManySubscribers = errors.New("too many subscribers to widget refreshes")
+	errEventsClosed       = errors.New("server is restarting")
+)
+
+// WidgetRefreshEvent tells browsers that widgets were refreshed, so that they
+// fetch their content again
+type WidgetRefreshEvent struct {
+	WidgetType string   `json:"widget_type"`
+	WidgetIDs  []uint64 `json:"widget_ids"`
+}
+
+// widgetEventBroker broadcasts widget refreshes to the browsers subscribed to
+// /api/events
+type widgetEventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan WidgetRefreshEvent]struct{}
+	closed      bool
+}
+
+func newWidgetEventBroker() *widgetEventBroker {
+	return &widgetEventBroker{subscribers: make(map[chan WidgetRefreshEvent]struct{})}
+}
+
+// subscribe returns a channel receiving the refreshes broadcast from now on,
+// closed when the broker is
+func (b *widgetEventBroker) subscribe() (chan WidgetRefreshEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, errEventsClosed
+	}
+
+	if len(b.subscribers) >= maxEventSubscribers {
+		return nil, errTooManySubscribers
+	}
+
+	events := make(chan WidgetRefreshEvent, 8)
+	b.subscribers[events] = struct{}{}
+	return events, nil
+}
+
+func (b *widgetEventBroker) unsubscribe(events chan WidgetRefreshEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[events]; ok {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+// broadcast sends event to every subscriber, skipping the ones too slow to
+// keep up rather than blocking the webhook that refreshed the widgets
+func (b *widgetEventBroker) broadcast(event WidgetRefreshEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			slog.Debug("Dropping widget refresh for a slow subscriber", "widget_type", event.WidgetType)
+		}
+	}
+}
+
+// close disconnects every subscriber and refuses new ones, for the server to
+// stop without waiting on open connections
+func (b *widgetEventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for events := range b.subscribers {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+func (b *widgetEventBroker) subscriberCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// handleEventsRequest streams widget refreshes to the browser as server-sent
+// events until it disconnects or the server stops
+func (a *application) handleEventsRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	events, err := a.widgetEvents.subscribe()
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer a.widgetEvents.unsubscribe(events)
+	slog.Debug("Browser subscribed to widget refreshes", "subscribers", a.widgetEvents.subscriberCount())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprintf(w, "retry: %d\n\n", eventReconnectDelay.Milliseconds())
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(&event)
+			if err != nil {
+				slog.Error("Failed to encode widget refresh", "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: widget-refresh\ndata: %s\n\n", data)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// handleWidgetContentRequest renders a single widget, for browsers to replace
+// it after a refresh
+func (a *application) handleWidgetContentRequest(w http.ResponseWriter, r *http.Request) {
+	widgetID, err := strconv.ParseUint(r.PathValue("widget"), 10, 64)
+	if err != nil {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	widget, exists := a.widgetByID[widgetID]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
+
+	// Widgets are updated with their page locked
+	if page, ok := a.widgetPage[widgetID]; ok {
+		page.mu.Lock()
+		defer page.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(widget.Render()))
+}
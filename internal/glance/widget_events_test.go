@@ -0,0 +1,137 @@
+package glance
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWidgetEventBroker(t *testing.T) {
+	broker := newWidgetEventBroker()
+
+	subscribers := make([]chan WidgetRefreshEvent, 0, maxEventSubscribers)
+	for range maxEventSubscribers {
+		events, err := broker.subscribe()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		subscribers = append(subscribers, events)
+	}
+
+	if _, err := broker.subscribe(); !errors.Is(err, errTooManySubscribers) {
+		t.Errorf("expected %v past the cap, got %v", errTooManySubscribers, err)
+	}
+
+	broker.unsubscribe(subscribers[0])
+	if broker.subscriberCount() != maxEventSubscribers-1 {
+		t.Errorf("expected %d subscribers, got %d", maxEventSubscribers-1, broker.subscriberCount())
+	}
+
+	broker.broadcast(WidgetRefreshEvent{WidgetType: "revenue", WidgetIDs: []uint64{1}})
+	if event := <-subscribers[1]; event.WidgetType != "revenue" || len(event.WidgetIDs) != 1 {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// Full subscribers are skipped instead of blocking
+	for range 20 {
+		broker.broadcast(WidgetRefreshEvent{WidgetType: "customers"})
+	}
+
+	broker.close()
+	if _, ok := <-subscribers[2]; !ok {
+		t.Error("expected buffered events to be delivered before the channel closes")
+	}
+	if _, err := broker.subscribe(); !errors.Is(err, errEventsClosed) {
+		t.Errorf("expected %v after closing, got %v", errEventsClosed, err)
+	}
+}
+
+func TestApplication_HandleEventsRequest(t *testing.T) {
+	app := &application{widgetEvents: newWidgetEventBroker()}
+	server := httptest.NewServer(http.HandlerFunc(app.handleEventsRequest))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", contentType)
+	}
+
+	waitFor(t, "the browser to subscribe", func() bool { return app.widgetEvents.subscriberCount() == 1 })
+	app.widgetEvents.broadcast(WidgetRefreshEvent{WidgetType: "revenue", WidgetIDs: []uint64{3, 7}})
+
+	// Closed on a config reload, which ends the stream
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		app.widgetEvents.close()
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	expected := []string{
+		fmt.Sprintf("retry: %d", eventReconnectDelay.Milliseconds()),
+		"event: widget-refresh",
+		`data: {"widget_type":"revenue","widget_ids":[3,7]}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	if app.widgetEvents.subscriberCount() != 0 {
+		t.Error("expected the browser to be unsubscribed")
+	}
+}
+
+func TestApplication_HandleWidgetContentRequest(t *testing.T) {
+	config, err := newConfigFromYAML([]byte(`
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: iframe
+            source: https://example.com/status
+`))
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+
+	app, err := newApplication(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	widgetID := app.Config.Pages[0].Columns[0].Widgets[0].GetID()
+
+	get := func(id string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/widgets/"+id+"/content/", nil)
+		request.SetPathValue("widget", id)
+		recorder := httptest.NewRecorder()
+		app.handleWidgetContentRequest(recorder, request)
+		return recorder
+	}
+
+	response := get(fmt.Sprint(widgetID))
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), fmt.Sprintf(`data-widget-id="%d"`, widgetID)) {
+		t.Errorf("expected the widget's HTML, got %d: %s", response.Code, response.Body.String())
+	}
+
+	if response := get("999999"); response.Code != http.StatusNotFound {
+		t.Errorf("expected %d for an unknown widget, got %d", http.StatusNotFound, response.Code)
+	}
+}
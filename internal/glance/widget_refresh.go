@@ -0,0 +1,88 @@
+package glance
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// widgetRefreshDelay gathers the webhook events of a burst, such as an
+	// account migration, into a single refresh of the widgets they affect
+	widgetRefreshDelay = time.Second
+
+	// widgetRefreshTimeout bounds a refresh, including the Stripe requests
+	// of the widgets
+	widgetRefreshTimeout = 2 * time.Minute
+)
+
+// widgetRefresher refreshes the widgets of a type in the background, one
+// refresh at a time per type. Refreshes requested while one is waiting are
+// coalesced into it, and the ones requested while it runs into a single
+// refresh after it.
+type widgetRefresher struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	refresh func(ctx context.Context, widgetType string)
+	pending map[string]bool // requested and not started yet
+	running map[string]bool
+	closed  bool
+}
+
+func newWidgetRefresher(delay time.Duration, refresh func(ctx context.Context, widgetType string)) *widgetRefresher {
+	return &widgetRefresher{
+		delay:   delay,
+		refresh: refresh,
+		pending: make(map[string]bool),
+		running: make(map[string]bool),
+	}
+}
+
+// request schedules a refresh of the widgets of widgetType, unless one is
+// already waiting to start
+func (r *widgetRefresher) request(widgetType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed || r.pending[widgetType] {
+		return
+	}
+
+	r.pending[widgetType] = true
+
+	// Scheduled once the running refresh is done
+	if !r.running[widgetType] {
+		time.AfterFunc(r.delay, func() { r.run(widgetType) })
+	}
+}
+
+func (r *widgetRefresher) run(widgetType string) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.pending[widgetType] = false
+	r.running[widgetType] = true
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), widgetRefreshTimeout)
+	r.refresh(ctx, widgetType)
+	cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.running[widgetType] = false
+	if r.pending[widgetType] && !r.closed {
+		time.AfterFunc(r.delay, func() { r.run(widgetType) })
+	}
+}
+
+// close drops the refreshes that haven't started, for the server to stop
+func (r *widgetRefresher) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+}
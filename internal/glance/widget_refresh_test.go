@@ -0,0 +1,42 @@
+package glance
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWidgetRefresher_CoalescesRequests(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	refresher := newWidgetRefresher(time.Millisecond, func(ctx context.Context, widgetType string) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the refresh to have a deadline")
+		}
+		runs.Add(1)
+		<-release
+	})
+
+	refresher.request("revenue")
+	waitFor(t, "the first refresh to start", func() bool { return runs.Load() == 1 })
+
+	// A burst while the first refresh runs is refreshed once after it
+	for range 1000 {
+		refresher.request("revenue")
+	}
+	close(release)
+
+	waitFor(t, "the second refresh", func() bool { return runs.Load() == 2 })
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != 2 {
+		t.Errorf("expected 2 refreshes, got %d", runs.Load())
+	}
+
+	refresher.close()
+	refresher.request("revenue")
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != 2 {
+		t.Errorf("expected no refresh after closing, got %d", runs.Load())
+	}
+}